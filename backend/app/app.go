@@ -0,0 +1,213 @@
+// Package app runs a Notty instance. New wires one up from a config, Start
+// starts its components (the job workers, schedulers and servers) in the
+// order they were registered and Stop stops them in reverse, so nothing
+// is stopped while something started after it still uses it. main is one
+// user; other Go programs embed Notty the same way, adding components of
+// their own. Notes are kept in package state, so there is one instance per
+// process.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"note/backend/config"
+	"note/backend/handlers"
+	"note/backend/slo"
+)
+
+var (
+	// ErrStarted is returned when an app is started twice
+	ErrStarted = errors.New("app already started")
+	// ErrExists is returned when a second app is set up in a process, or
+	// a stopped one started again, while another one is set up and not
+	// stopped
+	ErrExists = errors.New("an app was already set up in this process")
+)
+
+// exists guards setting up more than the one app notes are kept for
+var exists sync.Mutex
+
+// Component is a part of the app with a lifetime. Start must not block
+// beyond getting it going: ctx only bounds starting, and the component
+// runs until Stop, which must return once ctx is done.
+type Component interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// App is a configured instance with its components
+type App struct {
+	cfg  *config.Config
+	echo *echo.Echo
+	slo  *slo.Tracker
+
+	// embedded apps leave serving HTTP to the program embedding them
+	embedded bool
+
+	mu         sync.Mutex
+	components []Component
+	servers    []Component // started after the components, stopped first
+	started    []Component
+	running    bool
+	startedAt  time.Time
+
+	// holds is set while the app holds exists: from New until Stop, and
+	// again once started after that. released is set in between.
+	holds, released bool
+
+	// failed gets the first error of a component after it started, like
+	// the HTTP server failing to listen
+	failed chan error
+}
+
+// New sets up an instance from cfg and registers its components, which
+// don't run before Start
+func New(cfg *config.Config) (*App, error) {
+	return newApp(cfg, false)
+}
+
+// Embedded sets up an instance like New, but without the HTTP server:
+// the program embedding it serves Handler on its own
+func Embedded(cfg *config.Config) (*App, error) {
+	return newApp(cfg, true)
+}
+
+func newApp(cfg *config.Config, embedded bool) (*App, error) {
+	if !exists.TryLock() {
+		return nil, ErrExists
+	}
+	if err := cfg.Validate(); err != nil {
+		exists.Unlock()
+		return nil, err
+	}
+	a := &App{cfg: cfg, echo: echo.New(), embedded: embedded, failed: make(chan error, 1), holds: true}
+	if err := a.setup(); err != nil {
+		exists.Unlock()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Echo returns the HTTP server, e.g. to add routes before Start
+func (a *App) Echo() *echo.Echo {
+	return a.echo
+}
+
+// Failed reports the first component that broke down after it started
+func (a *App) Failed() <-chan error {
+	return a.failed
+}
+
+// UseRepositories serves the routes that go through handlers.Repository,
+// those that create, read, update, delete and watch single notes plus
+// GraphQL and gRPC, from the repositories open returns instead of from
+// memory. The rest of the API keeps working on the notes in memory; see
+// handlers.Repository. It must be called before Start.
+func (a *App) UseRepositories(open func(handlers.Scope) handlers.Repository) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		return ErrStarted
+	}
+	handlers.Repositories = open
+	return nil
+}
+
+// Register adds a component, to start after those registered before it
+// and before the servers start listening.
+// The components of New are all registered by then, the HTTP server last.
+func (a *App) Register(c Component) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.components = append(a.components, c)
+}
+
+// registerServer adds a server, to start once every component did
+func (a *App) registerServer(c Component) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.servers = append(a.servers, c)
+}
+
+// Start starts the components in order. If one fails, those started
+// before it are stopped again.
+func (a *App) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		return ErrStarted
+	}
+	if a.released {
+		if !exists.TryLock() {
+			return ErrExists
+		}
+		a.holds, a.released = true, false
+	}
+	a.running = true
+	for _, c := range append(a.components[:len(a.components):len(a.components)], a.servers...) {
+		if err := c.Start(ctx); err != nil {
+			err = fmt.Errorf("starting %s: %w", c.Name(), err)
+			return errors.Join(err, a.stop(ctx))
+		}
+		a.started = append(a.started, c)
+	}
+	a.startedAt = time.Now()
+	return nil
+}
+
+// Stop stops the started components in reverse order. Components that
+// don't stop before ctx is done are left behind. Another app can be set
+// up once it stopped.
+func (a *App) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.stop(ctx)
+	if a.holds {
+		a.holds, a.released = false, true
+		exists.Unlock()
+	}
+	return err
+}
+
+func (a *App) stop(ctx context.Context) error {
+	var errs []error
+	for i := len(a.started) - 1; i >= 0; i-- {
+		c := a.started[i]
+		if err := c.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", c.Name(), err))
+		}
+	}
+	a.started = nil
+	a.running = false
+	return errors.Join(errs...)
+}
+
+// Run starts the app and keeps it running until ctx is done or a
+// component fails, then stops it within the configured shutdown timeout
+func (a *App) Run(ctx context.Context) error {
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-a.failed:
+	}
+	stopCtx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	return errors.Join(err, a.Stop(stopCtx))
+}
+
+// fail reports that a running component broke down
+func (a *App) fail(c Component, err error) {
+	select {
+	case a.failed <- fmt.Errorf("%s: %w", c.Name(), err):
+	default:
+	}
+}
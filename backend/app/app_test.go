@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStartOrder(t *testing.T) {
+	var order []string
+	component := func(name string) Component {
+		return Hooks(name, func(context.Context) error {
+			order = append(order, "start "+name)
+			return nil
+		}, func(context.Context) error {
+			order = append(order, "stop "+name)
+			return nil
+		})
+	}
+	a := &App{failed: make(chan error, 1)}
+	a.Register(component("workers"))
+	a.registerServer(component("server"))
+	// Registered later, like a component of a program embedding the app
+	a.Register(component("embedder"))
+
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Start(context.Background()); !errors.Is(err, ErrStarted) {
+		t.Errorf("starting twice: %v", err)
+	}
+	if err := a.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start workers", "start embedder", "start server", "stop server", "stop embedder", "stop workers"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
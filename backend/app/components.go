@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"note/backend/backup"
+	"note/backend/handlers"
+	"note/backend/ingest"
+)
+
+// Hooks is a component made of a start and a stop function, either of
+// which may be nil
+func Hooks(name string, start, stop func(ctx context.Context) error) Component {
+	return &hooks{name, start, stop}
+}
+
+type hooks struct {
+	name        string
+	start, stop func(ctx context.Context) error
+}
+
+func (h *hooks) Name() string { return h.name }
+
+func (h *hooks) Start(ctx context.Context) error {
+	if h.start == nil {
+		return nil
+	}
+	return h.start(ctx)
+}
+
+func (h *hooks) Stop(ctx context.Context) error {
+	if h.stop == nil {
+		return nil
+	}
+	return h.stop(ctx)
+}
+
+// Loop is a component running run in the background until it is stopped,
+// when the context run got is done
+func Loop(name string, run func(ctx context.Context)) Component {
+	return &loop{name: name, run: run}
+}
+
+type loop struct {
+	name   string
+	run    func(ctx context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (l *loop) Name() string { return l.name }
+
+func (l *loop) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel, l.done = cancel, make(chan struct{})
+	go func() {
+		defer close(l.done)
+		l.run(ctx)
+	}()
+	return nil
+}
+
+func (l *loop) Stop(ctx context.Context) error {
+	l.cancel()
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backups restores the last backup when it starts, before anything reads
+// the notes, and then keeps taking backups
+type backups struct {
+	loop
+	storage backup.Storage
+}
+
+func newBackups(storage backup.Storage, schedule backup.Schedule, fullEvery int) *backups {
+	b := &backups{storage: storage}
+	b.loop = loop{name: "backups", run: func(ctx context.Context) {
+		backup.Run(ctx, storage, handlers.ChangeLog{}, schedule, fullEvery)
+	}}
+	return b
+}
+
+func (b *backups) Start(ctx context.Context) error {
+	restored, state, seq, err := backup.Restore(b.storage)
+	switch {
+	case err == nil:
+		handlers.ChangeLog{}.Restore(restored, state, seq)
+		log.Printf("restored %d notes from backup (seq %d)", len(restored), seq)
+	case !errors.Is(err, backup.ErrNoBackup):
+		return err
+	}
+	return b.loop.Start(ctx)
+}
+
+// httpServer serves the web app and HTTP API, with the redirect from
+// plain HTTP once TLS is on
+type httpServer struct {
+	app      *App
+	redirect *http.Server
+}
+
+func (s *httpServer) Name() string { return "http server" }
+
+func (s *httpServer) Start(context.Context) error {
+	if s.redirect = s.app.redirectServer(); s.redirect != nil {
+		go func() {
+			if err := s.redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				s.app.fail(s, fmt.Errorf("redirect: %w", err))
+			}
+		}()
+	}
+	go func() {
+		if err := s.app.serve(); !errors.Is(err, http.ErrServerClosed) {
+			s.app.fail(s, err)
+		}
+	}()
+	return nil
+}
+
+func (s *httpServer) Stop(ctx context.Context) error {
+	var err error
+	if s.redirect != nil {
+		err = s.redirect.Shutdown(ctx)
+	}
+	return errors.Join(s.app.echo.Shutdown(ctx), err)
+}
+
+// grpcServer serves the gRPC API
+type grpcServer struct {
+	addr string
+	srv  *grpc.Server
+	app  *App
+}
+
+func (s *grpcServer) Name() string { return "grpc server" }
+
+func (s *grpcServer) Start(context.Context) error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := s.srv.Serve(lis); err != nil {
+			s.app.fail(s, err)
+		}
+	}()
+	return nil
+}
+
+// Stop lets calls in progress finish, and cancels them once ctx is done
+func (s *grpcServer) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// ingestServer receives mail for ingest addresses
+type ingestServer struct {
+	addr string
+	srv  *ingest.Server
+	lis  net.Listener
+	app  *App
+}
+
+func (s *ingestServer) Name() string { return "ingest server" }
+
+func (s *ingestServer) Start(context.Context) error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.lis = lis
+	go func() {
+		if err := s.srv.Serve(lis); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.app.fail(s, err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops taking connections; messages being received are finished
+// by their own timeouts
+func (s *ingestServer) Stop(context.Context) error {
+	return s.lis.Close()
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"note/backend/status"
+)
+
+// Checker is a component that can tell how it is doing beyond having
+// started. Check fails while it works poorly, and with an error wrapping
+// an Outage while it doesn't work at all.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Outage is the error of a health check of a component that is down
+type Outage string
+
+func (o Outage) Error() string { return string(o) }
+
+// checkTimeout bounds each health check
+const checkTimeout = 2 * time.Second
+
+// Checked adds a health check to c
+func Checked(c Component, check func(ctx context.Context) error) Component {
+	return &checked{c, check}
+}
+
+type checked struct {
+	Component
+	check func(ctx context.Context) error
+}
+
+func (c *checked) Check(ctx context.Context) error { return c.check(ctx) }
+
+// Check reports a loop that returned before it was stopped
+func (l *loop) Check(context.Context) error {
+	select {
+	case <-l.done:
+		return Outage("stopped running")
+	default:
+		return nil
+	}
+}
+
+// Health reports the components of the app: those not started are down,
+// the others as their checks say. The availability is that of the SLO
+// over its budget period.
+func (a *App) Health(ctx context.Context) status.Health {
+	a.mu.Lock()
+	components, started, since := a.components, map[Component]bool{}, a.startedAt
+	for _, c := range a.started {
+		started[c] = true
+	}
+	a.mu.Unlock()
+
+	h := status.Health{Since: since, Components: []status.Component{}}
+	if availability, ok := a.slo.Availability(); ok {
+		h.Availability = &availability
+	}
+	for _, c := range components {
+		component := status.Component{Name: c.Name(), Status: status.Operational}
+		var err error
+		if !started[c] {
+			err = Outage("not running")
+		} else if checker, ok := c.(Checker); ok {
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			err = checker.Check(checkCtx)
+			cancel()
+		}
+		if err != nil {
+			component.Status, component.Detail = status.Degraded, err.Error()
+			if errors.As(err, new(Outage)) {
+				component.Status = status.Outage
+			}
+		}
+		h.Components = append(h.Components, component)
+	}
+	return h
+}
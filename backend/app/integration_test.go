@@ -0,0 +1,2233 @@
+package app_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"note/backend/app"
+	"note/backend/backup"
+	"note/backend/config"
+	"note/backend/handlers"
+	"note/backend/ratelimit"
+)
+
+// These tests run the whole router, with its middleware, over HTTP against
+// the in-memory store. Notes are shared by all tests, so each test only
+// looks at the notes it created.
+
+const adminToken = "test-admin-token"
+
+var server *httptest.Server
+
+// backupDir is where the instance keeps its backups
+var backupDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	if backupDir, err = os.MkdirTemp("", "notty-backups"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cfg := config.Default()
+	cfg.AdminToken = adminToken
+	cfg.BackupDir = backupDir
+	cfg.BackupInterval = config.Duration{Duration: 24 * time.Hour}
+	cfg.Sandbox = true
+	cfg.StatusPage = true
+	unlimited := map[ratelimit.Tier]ratelimit.Limit{ratelimit.Anonymous: {}, ratelimit.Authenticated: {}}
+	cfg.RateLimits = ratelimit.Policy{
+		Tiers:  unlimited,
+		Routes: map[string]map[ratelimit.Tier]ratelimit.Limit{"/api/export": unlimited, "/api/notes/:id/export": unlimited},
+	}
+	a, err := app.Embedded(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	a.Echo().Logger.SetOutput(io.Discard)
+	if err := a.Start(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	server = httptest.NewServer(a.Echo())
+	code := m.Run()
+	server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a.Stop(ctx)
+	os.RemoveAll(backupDir)
+	os.Exit(code)
+}
+
+func TestOneApp(t *testing.T) {
+	if _, err := app.Embedded(config.Default()); !errors.Is(err, app.ErrExists) {
+		t.Errorf("setting up a second app: %v, want ErrExists", err)
+	}
+}
+
+// client makes requests as one caller: anonymous, the admin token or an
+// API key, in a workspace when set
+type client struct {
+	t         *testing.T
+	token     string
+	workspace string
+}
+
+func anonymous(t *testing.T) client { return client{t: t} }
+func admin(t *testing.T) client     { return client{t: t, token: adminToken} }
+
+// do sends body, JSON-encoded unless it is a string or bytes, and returns
+// the response with its body read
+func (c client) do(method, path string, body any) (*http.Response, []byte) {
+	c.t.Helper()
+	var r io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(b)
+	case []byte:
+		r, contentType = bytes.NewReader(b), ""
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, server.URL+path, r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.workspace != "" {
+		req.Header.Set("X-Notty-Workspace", c.workspace)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return res, data
+}
+
+// expect makes a request, fails the test unless it is answered with want
+// and decodes the JSON response into out, if given
+func (c client) expect(want int, method, path string, body any, out ...any) *http.Response {
+	c.t.Helper()
+	res, data := c.do(method, path, body)
+	if res.StatusCode != want {
+		c.t.Fatalf("%s %s = %d, want %d: %s", method, path, res.StatusCode, want, data)
+	}
+	if len(out) > 0 {
+		if err := json.Unmarshal(data, out[0]); err != nil {
+			c.t.Fatalf("%s %s: decoding %s: %v", method, path, data, err)
+		}
+	}
+	return res
+}
+
+type note struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Notebook string `json:"notebook"`
+	Items    []struct {
+		ID   string `json:"id"`
+		Done bool   `json:"done"`
+	} `json:"items"`
+	Workspace string `json:"workspace"`
+}
+
+func (c client) createNote(title, content string) note {
+	c.t.Helper()
+	var n note
+	c.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{"title": title, "content": content}, &n)
+	return n
+}
+
+func contains(list []note, id string) bool {
+	for _, n := range list {
+		if n.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+const missingNote = "01a13f0a-0000-7000-8000-000000000000"
+
+func TestNotes(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Integration", "first")
+	c.expect(http.StatusBadRequest, "POST", "/api/notes", map[string]any{"content": "no title"})
+	c.expect(http.StatusBadRequest, "POST", "/api/notes", "{not json")
+
+	var got note
+	c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID, nil, &got)
+	if got.Title != "Integration" || got.Content != "first" {
+		t.Errorf("GET note = %+v", got)
+	}
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+missingNote, nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/notes/not-an-id", nil)
+
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+n.ID, map[string]any{"title": "Integration", "content": "second"}, &got)
+	if got.Content != "second" {
+		t.Errorf("PUT note = %+v", got)
+	}
+	c.expect(http.StatusBadRequest, "PUT", "/api/notes/"+n.ID, map[string]any{"content": "no title"})
+	c.expect(http.StatusNotFound, "PUT", "/api/notes/"+missingNote, map[string]any{"title": "x"})
+
+	var list []note
+	c.expect(http.StatusOK, "GET", "/api/notes", nil, &list)
+	if !contains(list, n.ID) {
+		t.Error("GET /api/notes doesn't list the note")
+	}
+	res := c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID, nil)
+	if etag := res.Header.Get("ETag"); etag == "" {
+		t.Error("GET note has no ETag")
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID+"/activity", nil)
+	c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID+"/export", nil)
+
+	c.expect(http.StatusOK, "DELETE", "/api/notes/"+n.ID, nil)
+	c.expect(http.StatusNotFound, "DELETE", "/api/notes/"+n.ID, nil)
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+n.ID, nil)
+}
+
+func TestNotesDiff(t *testing.T) {
+	c := anonymous(t)
+	kept := c.createNote("Kept", "")
+	edited := c.createNote("Edited", "")
+	removed := c.createNote("Removed", "")
+	etag := c.expect(http.StatusOK, "GET", "/api/notes", nil).Header.Get("ETag")
+
+	type diff struct {
+		ETag    string   `json:"etag"`
+		Reset   bool     `json:"reset"`
+		Changed []string `json:"changed"`
+		Deleted []string `json:"deleted"`
+	}
+	var d diff
+	c.expect(http.StatusOK, "GET", "/api/notes/diff?etag="+url.QueryEscape(etag), nil, &d)
+	if d.ETag != etag || d.Reset || len(d.Changed) != 0 || len(d.Deleted) != 0 {
+		t.Errorf("diff without changes = %+v", d)
+	}
+
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+edited.ID, map[string]any{"title": "Edited", "content": "again"})
+	c.expect(http.StatusOK, "DELETE", "/api/notes/"+removed.ID, nil)
+	added := c.createNote("Added", "")
+	c.expect(http.StatusOK, "GET", "/api/notes/diff?etag="+url.QueryEscape(etag), nil, &d)
+	changed := strings.Join(d.Changed, " ")
+	if !strings.Contains(changed, edited.ID) || !strings.Contains(changed, added.ID) || strings.Contains(changed, kept.ID) {
+		t.Errorf("changed = %v, want %s and %s", d.Changed, edited.ID, added.ID)
+	}
+	if len(d.Deleted) != 1 || d.Deleted[0] != removed.ID {
+		t.Errorf("deleted = %v, want %s", d.Deleted, removed.ID)
+	}
+	if latest := c.expect(http.StatusOK, "GET", "/api/notes", nil).Header.Get("ETag"); d.ETag != latest {
+		t.Errorf("diff etag = %s, list etag = %s", d.ETag, latest)
+	}
+
+	c.expect(http.StatusOK, "GET", "/api/notes/diff", nil, &d)
+	if !d.Reset || !strings.Contains(strings.Join(d.Changed, " "), kept.ID) {
+		t.Errorf("diff without etag = %+v, want a reset listing every note", d)
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/notes/diff?etag=bogus", nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/notes/diff?etag="+url.QueryEscape(`"notes-999999999"`), nil)
+}
+
+func TestSanitization(t *testing.T) {
+	c := anonymous(t)
+	// Notes are saved as written and only cleaned where others see them
+	content := "x<y and <p>Hi <a href=\"javascript:steal()\">there</a></p><script>steal()</script>"
+	n := c.createNote("<b onclick=\"steal()\">Bold</b>", content)
+	if n.Title != "<b onclick=\"steal()\">Bold</b>" || n.Content != content {
+		t.Errorf("created note = %q, %q", n.Title, n.Content)
+	}
+	var share struct {
+		Token string `json:"token"`
+	}
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/shares", nil, &share)
+	res, data := c.do("GET", "/embed/"+share.Token, nil)
+	if res.StatusCode != http.StatusOK || strings.Contains(string(data), "steal()") {
+		t.Errorf("embed = %d: %s", res.StatusCode, data)
+	}
+}
+
+func TestStats(t *testing.T) {
+	adm := admin(t)
+	var key struct {
+		Key string `json:"key"`
+	}
+	adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "stats", "scope": "read-write"}, &key)
+	c := client{t: t, token: key.Key}
+	var ws struct {
+		ID string `json:"id"`
+	}
+	c.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Stats"}, &ws)
+	c.workspace = ws.ID
+
+	n := c.createNote("Plan", "Ship the #release on Friday")
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+n.ID, map[string]any{"title": "Plan", "content": "Ship the #release on Monday #work"})
+	c.createNote("Standup", "#work notes")
+
+	var noteStats struct {
+		Words          int      `json:"words"`
+		ReadingMinutes int      `json:"reading_minutes"`
+		Revisions      int      `json:"revisions"`
+		Tags           []string `json:"tags"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID+"/stats", nil, &noteStats)
+	if noteStats.Words != 7 || noteStats.ReadingMinutes != 1 || noteStats.Revisions != 2 || len(noteStats.Tags) != 2 {
+		t.Errorf("note stats = %+v", noteStats)
+	}
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+missingNote+"/stats", nil)
+
+	var all struct {
+		Notes int `json:"notes"`
+		Words int `json:"words"`
+		Tags  []struct {
+			Tag   string `json:"tag"`
+			Notes int    `json:"notes"`
+		} `json:"tags"`
+		Activity []struct {
+			Date  string `json:"date"`
+			Count int    `json:"count"`
+		} `json:"activity"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/stats?days=7", nil, &all)
+	if all.Notes != 2 || all.Words != 10 {
+		t.Errorf("stats = %+v", all)
+	}
+	if len(all.Tags) != 2 || all.Tags[0].Tag != "work" || all.Tags[0].Notes != 2 {
+		t.Errorf("tags = %+v", all.Tags)
+	}
+	if len(all.Activity) != 7 || all.Activity[6].Count != 2 || all.Activity[6].Date != time.Now().UTC().Format(time.DateOnly) {
+		t.Errorf("activity = %+v", all.Activity)
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/stats?days=0", nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/stats?tz=Mars/Olympus", nil)
+}
+
+func TestChecklistItems(t *testing.T) {
+	c := anonymous(t)
+	var n note
+	c.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{
+		"title": "Chores",
+		"items": []map[string]any{{"text": "dishes"}, {"text": "laundry"}},
+	}, &n)
+	if len(n.Items) != 2 {
+		t.Fatalf("created note has %d items, want 2", len(n.Items))
+	}
+	var list []note
+	c.expect(http.StatusOK, "GET", "/api/notes?open_tasks=true", nil, &list)
+	if !contains(list, n.ID) {
+		t.Error("open_tasks listing misses a note with open items")
+	}
+	for _, item := range n.Items {
+		c.expect(http.StatusOK, "PATCH", "/api/notes/"+n.ID+"/items/"+item.ID, map[string]any{"done": true})
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes?open_tasks=true", nil, &list)
+	if contains(list, n.ID) {
+		t.Error("open_tasks listing has a note whose items are all done")
+	}
+	c.expect(http.StatusNotFound, "PATCH", "/api/notes/"+n.ID+"/items/missing", map[string]any{"done": true})
+}
+
+func TestRelations(t *testing.T) {
+	c := anonymous(t)
+	a, b := c.createNote("Blocker", ""), c.createNote("Blocked", "")
+	path := "/api/notes/" + a.ID + "/relations"
+	var rel struct {
+		ID string `json:"id"`
+	}
+	c.expect(http.StatusCreated, "POST", path, map[string]any{"type": "blocks", "to": b.ID}, &rel)
+	c.expect(http.StatusConflict, "POST", path, map[string]any{"type": "blocks", "to": b.ID})
+	c.expect(http.StatusConflict, "POST", "/api/notes/"+b.ID+"/relations", map[string]any{"type": "blocks", "to": a.ID}) // a cycle
+	c.expect(http.StatusBadRequest, "POST", path, map[string]any{"type": "likes", "to": b.ID})
+	c.expect(http.StatusBadRequest, "POST", path, map[string]any{"type": "blocks", "to": a.ID})
+	c.expect(http.StatusNotFound, "POST", path, map[string]any{"type": "blocks", "to": missingNote})
+	c.expect(http.StatusOK, "GET", path, nil)
+	c.expect(http.StatusOK, "GET", "/api/notes/"+b.ID+"/backlinks", nil)
+	c.expect(http.StatusOK, "DELETE", path+"/"+rel.ID, nil)
+	c.expect(http.StatusNotFound, "DELETE", path+"/"+rel.ID, nil)
+}
+
+func TestListings(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Searchable zebra", "stripes")
+
+	var found struct {
+		Results []note `json:"results"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/search?q=zebra", nil, &found)
+	if !contains(found.Results, n.ID) {
+		t.Errorf("search for zebra = %+v", found)
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/search", nil)
+	c.expect(http.StatusOK, "GET", "/api/search/status", nil)
+
+	var sync struct {
+		Cursor int64  `json:"cursor"`
+		Reset  bool   `json:"reset"`
+		Notes  []note `json:"notes"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/sync", nil, &sync)
+	if !sync.Reset || !contains(sync.Notes, n.ID) {
+		t.Errorf("first sync = %+v, want a reset with the note", sync)
+	}
+	c.expect(http.StatusOK, "GET", fmt.Sprintf("/api/sync?since=%d", sync.Cursor), nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/sync?since=abc", nil)
+	// A cursor past the end was kept from before a restore
+	c.expect(http.StatusOK, "GET", fmt.Sprintf("/api/sync?since=%d", sync.Cursor+1000), nil, &sync)
+	if !sync.Reset || !contains(sync.Notes, n.ID) {
+		t.Errorf("sync past the end = %+v, want a reset with the note", sync)
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/sync?limit=0", nil)
+
+	for _, path := range []string{
+		"/api/graph", "/api/notes/duplicates", "/api/inbox", "/api/review/queue",
+		"/api/capabilities", "/api/usage", "/api/ingest", "/api/notifications",
+		"/api/notifications/preferences", "/api/templates",
+		"/api/webhooks", "/api/workspaces", "/api/trash",
+	} {
+		c.expect(http.StatusOK, "GET", path, nil)
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/notes/nearby", nil)
+	c.expect(http.StatusOK, "GET", "/api/notes/nearby?lat=52.5&lng=13.4&radius=1000", nil)
+}
+
+func TestEditing(t *testing.T) {
+	c := anonymous(t)
+	a, b := c.createNote("Part one", "alpha"), c.createNote("Part two", "beta")
+	linking := c.createNote("Index", "see [[Part two]], [[Part two|the rest]] and notty://note/"+b.ID)
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+linking.ID+"/relations", map[string]any{"type": "blocks", "to": b.ID})
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+a.ID+"/relations", map[string]any{"type": "related-to", "to": b.ID})
+
+	var merged note
+	c.expect(http.StatusOK, "POST", "/api/notes/merge", map[string]any{"ids": []string{a.ID, b.ID}}, &merged)
+	if merged.ID != a.ID || !strings.Contains(merged.Content, "alpha") || !strings.Contains(merged.Content, "beta") {
+		t.Errorf("merged note = %+v", merged)
+	}
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+b.ID, nil)
+
+	// What pointed at the absorbed note points at the kept one
+	var relations []struct{ Type, From, To string }
+	c.expect(http.StatusOK, "GET", "/api/notes/"+a.ID+"/relations", nil, &relations)
+	if len(relations) != 1 || relations[0].Type != "blocks" || relations[0].From != linking.ID || relations[0].To != a.ID {
+		t.Errorf("relations of the merged note = %+v, want only the one moved from %s", relations, b.ID)
+	}
+	var got note
+	c.expect(http.StatusOK, "GET", "/api/notes/"+linking.ID, nil, &got)
+	if want := "see [[" + a.ID + "|Part two]], [[" + a.ID + "|the rest]] and notty://note/" + a.ID; got.Content != want {
+		t.Errorf("linking note = %q, want %q", got.Content, want)
+	}
+
+	// The absorbed note waits in the trash
+	var trash []struct {
+		ID         string `json:"id"`
+		MergedInto string `json:"merged_into"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/trash", nil, &trash)
+	if len(trash) != 1 || trash[0].ID != b.ID || trash[0].MergedInto != a.ID {
+		t.Errorf("trash = %+v, want %s merged into %s", trash, b.ID, a.ID)
+	}
+	c.expect(http.StatusOK, "POST", "/api/trash/"+b.ID+"/restore", nil, &got)
+	if got.ID != b.ID || got.Content != "beta" {
+		t.Errorf("restored note = %+v", got)
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes/"+b.ID, nil)
+	c.expect(http.StatusNotFound, "POST", "/api/trash/"+b.ID+"/restore", nil)
+	c.expect(http.StatusOK, "POST", "/api/notes/merge", map[string]any{"ids": []string{a.ID, b.ID}})
+	c.expect(http.StatusOK, "DELETE", "/api/trash/"+b.ID, nil)
+	c.expect(http.StatusNotFound, "DELETE", "/api/trash/"+b.ID, nil)
+	c.expect(http.StatusBadRequest, "POST", "/api/notes/merge", map[string]any{"ids": []string{a.ID}})
+	c.expect(http.StatusNotFound, "POST", "/api/notes/merge", map[string]any{"ids": []string{a.ID, missingNote}})
+
+	res, data := c.do("POST", "/api/notes/replace", map[string]any{"find": "alpha", "replace": "gamma", "ids": []string{a.ID}})
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		t.Fatalf("replace = %d: %s", res.StatusCode, data)
+	}
+	c.expect(http.StatusBadRequest, "POST", "/api/notes/replace", map[string]any{"replace": "x"})
+}
+
+func TestInboxTriage(t *testing.T) {
+	c := anonymous(t)
+	a, b := c.createNote("Receipt", ""), c.createNote("Idea", "")
+	c.expect(http.StatusBadRequest, "POST", "/api/inbox/triage", map[string]any{"moves": []any{}})
+	c.expect(http.StatusBadRequest, "POST", "/api/inbox/triage", map[string]any{"moves": []any{map[string]any{"id": "not an id", "notebook": "x"}}})
+
+	// A missing note moves none of them
+	c.expect(http.StatusNotFound, "POST", "/api/inbox/triage", map[string]any{"moves": []any{
+		map[string]any{"id": a.ID, "notebook": "Finance"},
+		map[string]any{"id": missingNote, "notebook": "Finance"},
+	}})
+	var got note
+	c.expect(http.StatusOK, "GET", "/api/notes/"+a.ID, nil, &got)
+	if got.Notebook != a.Notebook {
+		t.Errorf("a failed triage moved the note to %q", got.Notebook)
+	}
+
+	var moved []note
+	c.expect(http.StatusOK, "POST", "/api/inbox/triage", map[string]any{"moves": []any{
+		map[string]any{"id": a.ID, "notebook": "Finance"},
+		map[string]any{"id": b.ID, "notebook": "Ideas"},
+	}}, &moved)
+	if len(moved) != 2 {
+		t.Errorf("moved %d notes, want 2", len(moved))
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes/"+b.ID, nil, &got)
+	if got.Notebook != "Ideas" {
+		t.Errorf("triaged note is in %q, want Ideas", got.Notebook)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	c := anonymous(t)
+	var tmpl struct {
+		ID string `json:"id"`
+	}
+	c.expect(http.StatusCreated, "POST", "/api/templates", map[string]any{"name": "Standup", "title": "Standup", "content": "yesterday / today"}, &tmpl)
+	var n note
+	c.expect(http.StatusCreated, "POST", "/api/templates/"+tmpl.ID+"/notes", nil, &n)
+	if n.Content != "yesterday / today" {
+		t.Errorf("note from template = %+v", n)
+	}
+	c.expect(http.StatusOK, "GET", "/api/templates/export", nil)
+	c.expect(http.StatusOK, "DELETE", "/api/templates/"+tmpl.ID, nil)
+	c.expect(http.StatusNotFound, "POST", "/api/templates/"+tmpl.ID+"/notes", nil)
+	c.expect(http.StatusNotFound, "DELETE", "/api/templates/"+tmpl.ID, nil)
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAttachments(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("With picture", "")
+	img := testPNG(t, 64, 32)
+
+	var a struct {
+		ID          string `json:"id"`
+		ContentType string `json:"content_type"`
+		Width       int    `json:"width"`
+	}
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/attachments?name=pic.png", img, &a)
+	if a.ContentType != "image/png" || a.Width != 64 {
+		t.Errorf("attachment = %+v, want a sniffed 64 pixel wide PNG", a)
+	}
+	c.expect(http.StatusNotFound, "POST", "/api/notes/"+missingNote+"/attachments", img)
+
+	res, data := c.do("GET", "/api/attachments/"+a.ID, nil)
+	if res.StatusCode != http.StatusOK || !bytes.Equal(data, img) {
+		t.Errorf("download = %d with %d bytes, want the upload", res.StatusCode, len(data))
+	}
+	res, data = c.do("GET", "/api/attachments/"+a.ID+"?w=16", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("thumbnail = %d: %s", res.StatusCode, data)
+	}
+	if cfg, err := png.DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width != 16 || cfg.Height != 8 {
+		t.Errorf("thumbnail is %+v (%v), want 16x8", cfg, err)
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/attachments/"+a.ID+"?w=0", nil)
+	c.expect(http.StatusUnsupportedMediaType, "GET", "/api/attachments/"+a.ID+"/preview", nil)
+
+	for format, name := range map[string]string{"webp": "pic.webp", "jpeg": "pic.jpg"} {
+		// The second request comes from the cache
+		for range 2 {
+			res, data = c.do("GET", "/api/attachments/"+a.ID+"?w=16&format="+format, nil)
+			if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "image/"+format {
+				t.Errorf("%s = %d of %s", format, res.StatusCode, res.Header.Get("Content-Type"))
+			}
+			if !strings.Contains(res.Header.Get("Content-Disposition"), name) {
+				t.Errorf("%s is named %s", format, res.Header.Get("Content-Disposition"))
+			}
+		}
+		if format == "webp" && !bytes.HasPrefix(data, []byte("RIFF")) {
+			t.Error("WebP conversion is not a WebP")
+		}
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/attachments/"+a.ID+"?format=avif", nil)
+
+	var list []struct{ ID string }
+	c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID+"/attachments", nil, &list)
+	if len(list) != 1 {
+		t.Errorf("note has %d attachments, want 1", len(list))
+	}
+	c.expect(http.StatusOK, "DELETE", "/api/attachments/"+a.ID, nil)
+	c.expect(http.StatusNotFound, "GET", "/api/attachments/"+a.ID, nil)
+	c.expect(http.StatusNotFound, "DELETE", "/api/attachments/"+a.ID, nil)
+}
+
+func TestAttachmentTypeMismatch(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Mislabeled", "")
+	req, _ := http.NewRequest("POST", server.URL+"/api/notes/"+n.ID+"/attachments", bytes.NewReader(testPNG(t, 2, 2)))
+	req.Header.Set("Content-Type", "image/jpeg")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("PNG uploaded as JPEG = %d, want 415", res.StatusCode)
+	}
+}
+
+func TestWorkspaceAttachmentPolicy(t *testing.T) {
+	adm := admin(t)
+	newKey := func(name string) client {
+		var key struct {
+			Key string `json:"key"`
+		}
+		adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": name, "scope": "read-write"}, &key)
+		return client{t: t, token: key.Key}
+	}
+	owner, outsider := newKey("archivist"), newKey("outsider")
+	var ws struct {
+		ID          string `json:"id"`
+		Attachments *struct {
+			AllowedTypes []string `json:"allowed_types"`
+		} `json:"attachments"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Archive"}, &ws)
+	owner.workspace = ws.ID
+	n := owner.createNote("Scan", "")
+	img := testPNG(t, 8, 8)
+
+	outsider.expect(http.StatusNotFound, "PUT", "/api/workspaces/"+ws.ID, map[string]any{"attachments": map[string]any{"max_size": 1}})
+	owner.expect(http.StatusBadRequest, "PUT", "/api/workspaces/"+ws.ID, map[string]any{"attachments": map[string]any{"allowed_types": []string{"*/*"}}})
+	owner.expect(http.StatusOK, "PUT", "/api/workspaces/"+ws.ID, map[string]any{"attachments": map[string]any{"allowed_types": []string{"application/pdf"}}}, &ws)
+	if ws.Attachments == nil || !slices.Equal(ws.Attachments.AllowedTypes, []string{"application/pdf"}) {
+		t.Errorf("workspace attachments = %+v", ws.Attachments)
+	}
+	var caps struct {
+		Attachments struct {
+			AllowedTypes []string `json:"allowed_types"`
+		} `json:"attachments"`
+	}
+	owner.expect(http.StatusOK, "GET", "/api/capabilities", nil, &caps)
+	if !slices.Equal(caps.Attachments.AllowedTypes, []string{"application/pdf"}) {
+		t.Errorf("capabilities in the workspace allow %v", caps.Attachments.AllowedTypes)
+	}
+	owner.expect(http.StatusUnsupportedMediaType, "POST", "/api/notes/"+n.ID+"/attachments", img)
+
+	// Other workspaces keep the instance's policy
+	anonymous(t).expect(http.StatusCreated, "POST", "/api/notes/"+anonymous(t).createNote("Elsewhere", "").ID+"/attachments", img)
+
+	owner.expect(http.StatusOK, "PUT", "/api/workspaces/"+ws.ID, map[string]any{"attachments": map[string]any{"max_size": 10}})
+	owner.expect(http.StatusRequestEntityTooLarge, "POST", "/api/notes/"+n.ID+"/attachments", img)
+	owner.expect(http.StatusOK, "PUT", "/api/workspaces/"+ws.ID, map[string]any{"attachments": map[string]any{}})
+	owner.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/attachments", img)
+}
+
+func TestExportAssets(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Exported with a picture", "")
+	img := testPNG(t, 4, 4)
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/attachments?name=pic.png", img)
+
+	res, data := c.do("GET", "/api/notes/"+n.ID+"/export", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("export = %d", res.StatusCode)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		Notes []struct {
+			Assets []string `json:"assets"`
+		} `json:"notes"`
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Notes) != 1 || len(manifest.Notes[0].Assets) != 1 || !bytes.Equal(files[manifest.Notes[0].Assets[0]], img) {
+		t.Errorf("exported notes = %+v, want the picture as an asset", manifest.Notes)
+	}
+
+	// Notes of other workspaces aren't exported
+	var key struct {
+		Key string `json:"key"`
+	}
+	admin(t).expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "exporter", "scope": "read-write"}, &key)
+	member := client{t: t, token: key.Key}
+	var ws struct {
+		ID string `json:"id"`
+	}
+	member.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Exports"}, &ws)
+	member.workspace = ws.ID
+	member.expect(http.StatusNotFound, "GET", "/api/notes/"+n.ID+"/export", nil)
+}
+
+func TestExportJob(t *testing.T) {
+	c := anonymous(t)
+	c.createNote("Exported", "")
+	res, data := c.do("GET", "/api/export", nil)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/zip" || len(data) == 0 {
+		t.Fatalf("export = %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var verified struct {
+		Valid    bool `json:"valid"`
+		Signed   bool `json:"signed"`
+		Manifest struct {
+			Files []struct{ Path string } `json:"files"`
+		} `json:"manifest"`
+	}
+	c.expect(http.StatusOK, "POST", "/api/export/verify", data, &verified)
+	if !verified.Valid || verified.Signed || len(verified.Manifest.Files) == 0 {
+		t.Errorf("verifying the export = %+v", verified)
+	}
+	c.expect(http.StatusBadRequest, "POST", "/api/export/verify", []byte("not a zip"))
+	c.expect(http.StatusNotFound, "GET", "/api/export/signing-key", nil)
+
+	res = c.expect(http.StatusAccepted, "GET", "/api/export?async=true", nil)
+	location := res.Header.Get("Location")
+	if location == "" {
+		t.Fatal("async export has no Location")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var job struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		c.expect(http.StatusOK, "GET", location, nil, &job)
+		if job.Status == "done" {
+			break
+		}
+		if job.Status == "failed" || time.Now().After(deadline) {
+			t.Fatalf("export job = %+v", job)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	res, data = c.do("GET", location+"/output", nil)
+	if res.StatusCode != http.StatusOK || len(data) == 0 {
+		t.Errorf("export job output = %d with %d bytes", res.StatusCode, len(data))
+	}
+	c.expect(http.StatusNotFound, "GET", "/api/jobs/missing", nil)
+}
+
+func TestPublicAPI(t *testing.T) {
+	c := anonymous(t)
+	c.expect(http.StatusUnauthorized, "GET", "/api/public/notes", nil)
+	c.expect(http.StatusUnauthorized, "GET", "/api/calendar.ics", nil)
+
+	newKey := func(name string) client {
+		var key struct {
+			Key string `json:"key"`
+		}
+		admin(t).expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": name, "scope": "read-write"}, &key)
+		return client{t: t, token: key.Key}
+	}
+	owner, other := newKey("site owner"), newKey("someone else")
+
+	// Tokens are owned by the API key that made them
+	c.expect(http.StatusUnauthorized, "POST", "/api/tokens", map[string]any{"name": "site"})
+	c.expect(http.StatusUnauthorized, "GET", "/api/tokens", nil)
+	var tok struct {
+		Token string `json:"token"`
+		Info  struct {
+			ID string `json:"id"`
+		} `json:"info"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/tokens", map[string]any{"name": "site"}, &tok)
+	reader := client{t: t, token: tok.Token}
+	reader.expect(http.StatusOK, "GET", "/api/public/notes", nil)
+	reader.expect(http.StatusNotFound, "GET", "/api/public/notes/"+missingNote, nil)
+	owner.expect(http.StatusBadRequest, "POST", "/api/tokens", map[string]any{"name": "bad", "scope": "write:everything"})
+
+	var list []struct {
+		ID string `json:"id"`
+	}
+	other.expect(http.StatusOK, "GET", "/api/tokens", nil, &list)
+	if len(list) != 0 {
+		t.Errorf("another key lists tokens %+v", list)
+	}
+	other.expect(http.StatusNotFound, "DELETE", "/api/tokens/"+tok.Info.ID, nil)
+	owner.expect(http.StatusOK, "GET", "/api/tokens", nil, &list)
+	if len(list) != 1 || list[0].ID != tok.Info.ID {
+		t.Errorf("tokens of the owner = %+v", list)
+	}
+
+	// Tokens read the published notes of their owner and workspace only
+	var post note
+	owner.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{"title": "Post", "content": "hello", "published": true}, &post)
+	var published []note
+	reader.expect(http.StatusOK, "GET", "/api/public/notes", nil, &published)
+	if len(published) != 1 || published[0].ID != post.ID {
+		t.Errorf("public notes = %+v, want only %s", published, post.ID)
+	}
+	var ws struct {
+		ID string `json:"id"`
+	}
+	other.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Elsewhere"}, &ws)
+	other.workspace = ws.ID
+	other.expect(http.StatusCreated, "POST", "/api/tokens", map[string]any{"name": "site"}, &tok)
+	outsider := client{t: t, token: tok.Token}
+	outsider.expect(http.StatusOK, "GET", "/api/public/notes", nil, &published)
+	if len(published) != 0 {
+		t.Errorf("another owner's token in another workspace reads %+v", published)
+	}
+	outsider.expect(http.StatusNotFound, "GET", "/api/public/notes/"+post.ID, nil)
+	feed := "/api/public/notebooks/" + url.PathEscape(post.Notebook) + "/feed.atom"
+	if res, data := reader.do("GET", feed, nil); res.StatusCode != http.StatusOK || !strings.Contains(string(data), post.ID) {
+		t.Errorf("notebook feed = %d: %s", res.StatusCode, data)
+	}
+	outsider.expect(http.StatusNotFound, "GET", feed, nil)
+
+	owner.expect(http.StatusOK, "DELETE", "/api/tokens/"+list[0].ID, nil)
+	reader.expect(http.StatusUnauthorized, "GET", "/api/public/notes", nil)
+}
+
+func TestShares(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Shared", "for everyone")
+	var share struct {
+		Token string `json:"token"`
+	}
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/shares", nil, &share)
+	res, data := c.do("GET", "/embed/"+share.Token, nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(data), "for everyone") {
+		t.Errorf("embed = %d", res.StatusCode)
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID+"/shares", nil)
+
+	// Only the owner of the note revokes its share
+	var key struct {
+		Key string `json:"key"`
+	}
+	admin(t).expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "share holder", "scope": "read-write"}, &key)
+	holder := client{t: t, token: key.Key}
+	holder.expect(http.StatusForbidden, "DELETE", "/api/shares/"+share.Token, nil)
+	var ws struct {
+		ID string `json:"id"`
+	}
+	holder.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Own"}, &ws)
+	holder.workspace = ws.ID
+	holder.expect(http.StatusNotFound, "DELETE", "/api/shares/"+share.Token, nil)
+	c.expect(http.StatusOK, "DELETE", "/api/shares/"+share.Token, nil)
+	c.expect(http.StatusNotFound, "GET", "/embed/"+share.Token, nil)
+	c.expect(http.StatusNotFound, "POST", "/api/notes/"+missingNote+"/shares", nil)
+}
+
+func TestNotebookShares(t *testing.T) {
+	var key struct {
+		Key string `json:"key"`
+	}
+	admin(t).expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "blogger", "scope": "read-write"}, &key)
+	owner := client{t: t, token: key.Key}
+	anonymous(t).createNote("Unowned", "")
+	anonymous(t).expect(http.StatusForbidden, "POST", "/api/notebooks/Inbox/shares", nil)
+
+	// The same notebook in another workspace stays out of the share
+	var ws struct {
+		ID string `json:"id"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Drafts"}, &ws)
+	elsewhere := owner
+	elsewhere.workspace = ws.ID
+	draft := elsewhere.createNote("Draft", "not yet")
+	post := owner.createNote("Post", "out now")
+	var share struct {
+		Token string `json:"token"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/notebooks/Inbox/shares", nil, &share)
+	res, data := owner.do("GET", "/share/"+share.Token+"/feed.atom", nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(data), post.ID) || strings.Contains(string(data), draft.ID) || strings.Contains(string(data), "Unowned") {
+		t.Errorf("shared notebook feed = %d: %s", res.StatusCode, data)
+	}
+}
+
+func TestSharedEmbedUnderLoad(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Popular", "first")
+	var share struct {
+		Token string `json:"token"`
+	}
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/shares", nil, &share)
+
+	const readers = 20
+	nonces := make(chan string, readers)
+	var wg sync.WaitGroup
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, data := c.do("GET", "/embed/"+share.Token, nil)
+			if res.StatusCode != http.StatusOK || !strings.Contains(string(data), "first") {
+				t.Errorf("embed = %d: %s", res.StatusCode, data)
+				return
+			}
+			csp := res.Header.Get("Content-Security-Policy")
+			_, rest, _ := strings.Cut(csp, "script-src 'nonce-")
+			nonce, _, _ := strings.Cut(rest, "'")
+			if nonce == "" || !strings.Contains(string(data), `nonce="`+nonce+`"`) {
+				t.Errorf("page doesn't use the nonce of its CSP %q", csp)
+			}
+			nonces <- nonce
+		}()
+	}
+	wg.Wait()
+	close(nonces)
+	seen := map[string]bool{}
+	for nonce := range nonces {
+		if seen[nonce] {
+			t.Errorf("nonce %q sent twice", nonce)
+		}
+		seen[nonce] = true
+	}
+
+	// A change shows up right away, not once the cached page expires
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+n.ID, map[string]any{"title": "Popular", "content": "second"})
+	if _, data := c.do("GET", "/embed/"+share.Token, nil); !strings.Contains(string(data), "second") {
+		t.Errorf("embed after update = %s", data)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	c := anonymous(t)
+	c.expect(http.StatusBadRequest, "POST", "/api/webhooks", map[string]any{"url": "not a url"})
+	c.expect(http.StatusBadRequest, "POST", "/api/webhooks", map[string]any{"url": "http://169.254.169.254/latest/meta-data"})
+	var hook struct {
+		ID string `json:"id"`
+	}
+	c.expect(http.StatusCreated, "POST", "/api/webhooks", map[string]any{"url": "https://example.com/hook"}, &hook)
+	c.expect(http.StatusOK, "GET", "/api/webhooks/"+hook.ID+"/deliveries", nil)
+	c.expect(http.StatusOK, "DELETE", "/api/webhooks/"+hook.ID, nil)
+	c.expect(http.StatusNotFound, "DELETE", "/api/webhooks/"+hook.ID, nil)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	adm := admin(t)
+	newKey := func(name string) client {
+		var key struct {
+			Key string `json:"key"`
+		}
+		adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": name, "scope": "read-write"}, &key)
+		return client{t: t, token: key.Key}
+	}
+	owner, editor := newKey("owner"), newKey("editor")
+	quiet := map[string]any{"defaults": map[string]any{"note.updated": map[string]any{"subscriptions": false}}}
+
+	// The default workspace's preferences take the instance's admin role
+	anonymous(t).expect(http.StatusForbidden, "PUT", "/api/notifications/preferences", quiet)
+	owner.expect(http.StatusForbidden, "PUT", "/api/notifications/preferences", quiet)
+	adm.expect(http.StatusOK, "PUT", "/api/notifications/preferences", map[string]any{})
+
+	// Other workspaces' take their admin role, and keep to them
+	var ws struct {
+		ID string `json:"id"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Quiet"}, &ws)
+	owner.workspace, editor.workspace = ws.ID, ws.ID
+	var inv struct {
+		Code string `json:"code"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/workspaces/"+ws.ID+"/invitations", map[string]any{"role": "editor"}, &inv)
+	editor.expect(http.StatusOK, "POST", "/api/invitations/"+inv.Code+"/accept", nil)
+	editor.expect(http.StatusForbidden, "PUT", "/api/notifications/preferences", quiet)
+	owner.expect(http.StatusOK, "PUT", "/api/notifications/preferences", quiet)
+
+	var prefs struct {
+		Defaults map[string]map[string]bool `json:"defaults"`
+	}
+	editor.expect(http.StatusOK, "GET", "/api/notifications/preferences", nil, &prefs)
+	if on, ok := prefs.Defaults["note.updated"]["subscriptions"]; !ok || on {
+		t.Errorf("workspace preferences = %+v", prefs)
+	}
+	prefs.Defaults = nil
+	anonymous(t).expect(http.StatusOK, "GET", "/api/notifications/preferences", nil, &prefs)
+	if len(prefs.Defaults) != 0 {
+		t.Errorf("the default workspace got another workspace's preferences %+v", prefs)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	anon, adm := anonymous(t), admin(t)
+	for _, path := range []string{"/api/admin/stats", "/api/admin/limits", "/api/admin/users", "/api/admin/audit", "/api/admin/cache", "/api/admin/reports", "/api/admin/usage-reports", "/api/admin/jobs/dead", "/api/admin/incidents"} {
+		anon.expect(http.StatusUnauthorized, "GET", path, nil)
+		adm.expect(http.StatusOK, "GET", path, nil)
+	}
+	adm.expect(http.StatusBadRequest, "PUT", "/api/admin/limits", map[string]any{"max_notes": -1})
+	adm.expect(http.StatusAccepted, "POST", "/api/admin/search/rebuild", nil)
+	adm.expect(http.StatusBadRequest, "POST", "/api/admin/jobs/dead/retry", map[string]any{})
+	var discarded struct {
+		NotFound []string `json:"not_found"`
+	}
+	adm.expect(http.StatusOK, "POST", "/api/admin/jobs/dead/discard", map[string]any{"ids": []string{"nope"}}, &discarded)
+	if len(discarded.NotFound) != 1 {
+		t.Errorf("discarding an unknown job = %+v", discarded)
+	}
+	client{t: t, token: "wrong"}.expect(http.StatusUnauthorized, "GET", "/api/admin/stats", nil)
+}
+
+func TestDisableUser(t *testing.T) {
+	adm := admin(t)
+	var key struct {
+		Key  string `json:"key"`
+		Info struct {
+			ID string `json:"id"`
+		} `json:"info"`
+	}
+	adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "suspended", "scope": "read-write"}, &key)
+	user := client{t: t, token: key.Key}
+	user.expect(http.StatusOK, "GET", "/api/notes", nil)
+
+	anonymous(t).expect(http.StatusUnauthorized, "POST", "/api/admin/users/"+key.Info.ID+"/disable", nil)
+	user.expect(http.StatusForbidden, "POST", "/api/admin/users/"+key.Info.ID+"/disable", nil)
+	adm.expect(http.StatusNotFound, "POST", "/api/admin/users/nobody/disable", nil)
+	adm.expect(http.StatusOK, "POST", "/api/admin/users/"+key.Info.ID+"/disable", nil)
+	user.expect(http.StatusForbidden, "GET", "/api/notes", nil)
+	adm.expect(http.StatusOK, "POST", "/api/admin/users/"+key.Info.ID+"/enable", nil)
+	user.expect(http.StatusOK, "GET", "/api/notes", nil)
+}
+
+func TestAPIKeys(t *testing.T) {
+	adm := admin(t)
+	type created struct {
+		Key  string `json:"key"`
+		Info struct {
+			ID string `json:"id"`
+		} `json:"info"`
+	}
+	newKey := func(c client, name, scope string) (client, string) {
+		var key created
+		c.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": name, "scope": scope}, &key)
+		return client{t: t, token: key.Key}, key.Info.ID
+	}
+	listed := func(c client, id string) bool {
+		var keys []struct {
+			ID string `json:"id"`
+		}
+		c.expect(http.StatusOK, "GET", "/api/apikeys", nil, &keys)
+		for _, k := range keys {
+			if k.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	anonymous(t).expect(http.StatusUnauthorized, "POST", "/api/apikeys", map[string]any{"name": "anyone", "scope": "read"})
+	anonymous(t).expect(http.StatusUnauthorized, "GET", "/api/apikeys", nil)
+	writer, writerID := newKey(adm, "writer", "read-write")
+	other, otherID := newKey(adm, "other", "read-write")
+	writer.expect(http.StatusForbidden, "POST", "/api/apikeys", map[string]any{"name": "escalated", "scope": "admin"})
+	_, readerID := newKey(writer, "reader", "read")
+	if !listed(writer, readerID) || !listed(writer, writerID) || listed(writer, otherID) {
+		t.Error("a key lists other keys than itself and those it created")
+	}
+	if !listed(adm, readerID) || !listed(adm, otherID) {
+		t.Error("the admin doesn't list every key")
+	}
+	writer.expect(http.StatusNotFound, "DELETE", "/api/apikeys/"+otherID, nil)
+	other.expect(http.StatusNotFound, "DELETE", "/api/apikeys/"+readerID, nil)
+	writer.expect(http.StatusOK, "DELETE", "/api/apikeys/"+readerID, nil)
+	adm.expect(http.StatusOK, "DELETE", "/api/apikeys/"+otherID, nil)
+}
+
+func TestSessions(t *testing.T) {
+	var key struct {
+		Key string `json:"key"`
+	}
+	admin(t).expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "browser", "scope": "read-write"}, &key)
+	res, _ := client{t: t, token: key.Key}.do("POST", "/api/session", nil)
+	var session *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == "notty_session" {
+			session = c
+		}
+	}
+	if res.StatusCode != http.StatusCreated || session == nil || !session.HttpOnly {
+		t.Fatalf("login = %d with session cookie %v", res.StatusCode, session)
+	}
+
+	// browser makes a request with the session cookie, the CSRF cookie
+	// and header when csrf is set, and headers
+	browser := func(method, path, csrf string, header map[string]string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(`{"title": "From a browser"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: session.Name, Value: session.Value})
+		if csrf != "" {
+			req.AddCookie(&http.Cookie{Name: "notty_csrf", Value: csrf})
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	res = browser("GET", "/api/apikeys", "", nil)
+	var csrf string
+	for _, c := range res.Cookies() {
+		if c.Name == "notty_csrf" {
+			csrf = c.Value
+		}
+	}
+	if res.StatusCode != http.StatusOK || csrf == "" {
+		t.Fatalf("GET with a session = %d with CSRF token %q", res.StatusCode, csrf)
+	}
+
+	// Without the CSRF token, not even a token that doesn't authenticate
+	// gets a forged request through
+	for _, forged := range []*http.Response{
+		browser("POST", "/api/notes", "", nil),
+		browser("POST", "/api/notes?token=anything", "", nil),
+		browser("POST", "/api/notes", "", map[string]string{"Authorization": "Bearer anything"}),
+	} {
+		if forged.StatusCode < 400 || forged.StatusCode == http.StatusUnauthorized {
+			t.Errorf("forged request = %d, want it refused for its CSRF token", forged.StatusCode)
+		}
+	}
+	if res := browser("POST", "/api/notes", csrf, nil); res.StatusCode != http.StatusCreated {
+		t.Errorf("POST with the CSRF token = %d", res.StatusCode)
+	}
+
+	if res := browser("DELETE", "/api/session", csrf, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("logout = %d", res.StatusCode)
+	}
+	if res := browser("GET", "/api/apikeys", "", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET after logout = %d, want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	adm := admin(t)
+	kept := anonymous(t).createNote("Backed up", "")
+	img := testPNG(t, 8, 8)
+	var a struct {
+		ID string `json:"id"`
+	}
+	anonymous(t).expect(http.StatusCreated, "POST", "/api/notes/"+kept.ID+"/attachments?name=pic.png", img, &a)
+	if err := backup.Take(backup.Dir(backupDir), handlers.ChangeLog{}, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The list has the sequence of the backup again once it is restored
+	etag := anonymous(t).expect(http.StatusOK, "GET", "/api/notes", nil).Header.Get("ETag")
+	lost := anonymous(t).createNote("After the backup", "")
+	var later struct {
+		ID string `json:"id"`
+	}
+	anonymous(t).expect(http.StatusCreated, "POST", "/api/notes/"+lost.ID+"/attachments?name=pic.png", img, &later)
+
+	anonymous(t).expect(http.StatusUnauthorized, "POST", "/api/admin/restore", nil)
+	adm.expect(http.StatusConflict, "POST", "/api/admin/restore", nil)
+	var result struct {
+		Notes int `json:"notes"`
+	}
+	adm.expect(http.StatusOK, "POST", "/api/admin/restore?force=true", nil, &result)
+	if result.Notes == 0 {
+		t.Error("restored no notes")
+	}
+	anonymous(t).expect(http.StatusOK, "GET", "/api/notes/"+kept.ID, nil)
+	anonymous(t).expect(http.StatusNotFound, "GET", "/api/notes/"+lost.ID, nil)
+	if res, data := anonymous(t).do("GET", "/api/attachments/"+a.ID, nil); res.StatusCode != http.StatusOK || !bytes.Equal(data, img) {
+		t.Errorf("attachment after the restore = %d with %d bytes, want the backed up file", res.StatusCode, len(data))
+	}
+	anonymous(t).expect(http.StatusNotFound, "GET", "/api/attachments/"+later.ID, nil)
+
+	var d struct {
+		Reset bool `json:"reset"`
+	}
+	anonymous(t).expect(http.StatusOK, "GET", "/api/notes/diff?etag="+url.QueryEscape(etag), nil, &d)
+	if !d.Reset {
+		t.Error("diff from an ETag of before the restore is no reset")
+	}
+	if got := anonymous(t).expect(http.StatusOK, "GET", "/api/notes", nil).Header.Get("ETag"); got == etag {
+		t.Errorf("list ETag %s did not change with the restore", got)
+	}
+}
+
+func TestEmailTemplates(t *testing.T) {
+	adm := admin(t)
+	var preview struct {
+		Subject string `json:"subject"`
+		Text    string `json:"text"`
+		HTML    string `json:"html"`
+	}
+	adm.expect(http.StatusOK, "GET", "/api/admin/email/templates/digest/preview", nil, &preview)
+	if preview.Subject != "Notty digest: 2 notes changed" || !strings.Contains(preview.Text, "- Groceries: updated 2 times") {
+		t.Errorf("digest preview = %+v", preview)
+	}
+	if !strings.Contains(preview.HTML, `<h1 style="`) {
+		t.Errorf("digest HTML has no inlined styles: %s", preview.HTML)
+	}
+	res := adm.expect(http.StatusOK, "GET", "/api/admin/email/templates/event/preview?format=html", nil)
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("HTML preview is %s", res.Header.Get("Content-Type"))
+	}
+	adm.expect(http.StatusOK, "GET", "/api/admin/email/templates", nil)
+	adm.expect(http.StatusNotFound, "GET", "/api/admin/email/templates/welcome/preview", nil)
+	adm.expect(http.StatusNotImplemented, "POST", "/api/admin/email/test", map[string]any{})
+	anonymous(t).expect(http.StatusUnauthorized, "GET", "/api/admin/email/templates/event/preview", nil)
+}
+
+func TestWorkspaces(t *testing.T) {
+	adm := admin(t)
+	newKey := func(name string) client {
+		var key struct {
+			Key  string `json:"key"`
+			Info struct {
+				ID string `json:"id"`
+			} `json:"info"`
+		}
+		adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": name, "scope": "read-write"}, &key)
+		return client{t: t, token: key.Key}
+	}
+	owner, guest := newKey("owner"), newKey("guest")
+
+	anonymous(t).expect(http.StatusForbidden, "POST", "/api/workspaces", map[string]any{"name": "Nobody's"})
+	owner.expect(http.StatusBadRequest, "POST", "/api/workspaces", map[string]any{"name": " "})
+	var ws struct {
+		ID string `json:"id"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Team"}, &ws)
+
+	owner.workspace = ws.ID
+	secret := owner.createNote("Team secret", "")
+	if secret.Workspace != ws.ID {
+		t.Errorf("note created in workspace %q, want %q", secret.Workspace, ws.ID)
+	}
+	var list []note
+	anonymous(t).expect(http.StatusOK, "GET", "/api/notes", nil, &list)
+	if contains(list, secret.ID) {
+		t.Error("the default workspace lists a note of another workspace")
+	}
+	anonymous(t).expect(http.StatusNotFound, "GET", "/api/notes/"+secret.ID, nil)
+
+	guest.workspace = ws.ID
+	guest.expect(http.StatusNotFound, "GET", "/api/notes", nil)
+	var inv struct {
+		Code string `json:"code"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/workspaces/"+ws.ID+"/invitations", map[string]any{"role": "viewer"}, &inv)
+	guest.expect(http.StatusBadRequest, "POST", "/api/invitations/wrong-code/accept", nil)
+	guest.expect(http.StatusOK, "POST", "/api/invitations/"+inv.Code+"/accept", nil)
+	guest.expect(http.StatusBadRequest, "POST", "/api/invitations/"+inv.Code+"/accept", nil)
+
+	guest.expect(http.StatusOK, "GET", "/api/notes", nil, &list)
+	if !contains(list, secret.ID) {
+		t.Error("a member doesn't see the workspace's notes")
+	}
+	guest.expect(http.StatusForbidden, "POST", "/api/notes", map[string]any{"title": "not allowed"})
+	guest.expect(http.StatusForbidden, "POST", "/api/workspaces/"+ws.ID+"/invitations", nil)
+
+	// Nothing of the workspace shows through links, relations, webhooks
+	// or notifications from the default workspace
+	anon := anonymous(t)
+	linking := anon.createNote("Links to the secret", "See [[Team secret]] and notty://note/"+secret.ID)
+	anon.expect(http.StatusNotFound, "GET", "/api/notes/"+secret.ID+"/backlinks", nil)
+	owner.expect(http.StatusOK, "GET", "/api/notes/"+secret.ID+"/backlinks", nil, &list)
+	if contains(list, linking.ID) {
+		t.Error("a note of the default workspace is a backlink in another workspace")
+	}
+	anon.expect(http.StatusNotFound, "POST", "/api/notes/"+linking.ID+"/relations", map[string]any{"type": "blocks", "to": secret.ID})
+	var hook struct {
+		ID string `json:"id"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/webhooks", map[string]any{"url": "https://example.com/team"}, &hook)
+	anon.expect(http.StatusNotFound, "GET", "/api/webhooks/"+hook.ID+"/deliveries", nil)
+	anon.expect(http.StatusNotFound, "DELETE", "/api/webhooks/"+hook.ID, nil)
+	var hooks []struct {
+		ID string `json:"id"`
+	}
+	anon.expect(http.StatusOK, "GET", "/api/webhooks", nil, &hooks)
+	for _, h := range hooks {
+		if h.ID == hook.ID {
+			t.Error("the default workspace lists a webhook of another workspace")
+		}
+	}
+	owner.expect(http.StatusOK, "DELETE", "/api/webhooks/"+hook.ID, nil)
+	var notifications []struct {
+		Event struct {
+			NoteID string `json:"note_id"`
+		} `json:"event"`
+	}
+	notified := func(c client) bool {
+		c.expect(http.StatusOK, "GET", "/api/notifications", nil, &notifications)
+		for _, n := range notifications {
+			if n.Event.NoteID == secret.ID {
+				return true
+			}
+		}
+		return false
+	}
+	for deadline := time.Now().Add(2 * time.Second); !notified(owner); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the workspace isn't notified of its new note")
+		}
+	}
+	if notified(anon) {
+		t.Error("the default workspace is notified of a note of another workspace")
+	}
+
+	owner.expect(http.StatusConflict, "DELETE", "/api/workspaces/"+ws.ID, nil)
+	owner.expect(http.StatusOK, "DELETE", "/api/notes/"+secret.ID, nil)
+	guest.expect(http.StatusForbidden, "DELETE", "/api/workspaces/"+ws.ID, nil)
+	owner.expect(http.StatusOK, "DELETE", "/api/workspaces/"+ws.ID, nil)
+	owner.expect(http.StatusNotFound, "GET", "/api/workspaces/"+ws.ID, nil)
+}
+
+// graphql runs a GraphQL query and decodes its data into out, failing the
+// test on errors
+func (c client) graphql(query string, out any) {
+	c.t.Helper()
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	c.expect(http.StatusOK, "POST", "/api/graphql", map[string]any{"query": query}, &res)
+	if len(res.Errors) > 0 {
+		c.t.Fatalf("%s: %s", query, res.Errors[0].Message)
+	}
+	if err := json.Unmarshal(res.Data, out); err != nil {
+		c.t.Fatalf("%s: decoding %s: %v", query, res.Data, err)
+	}
+}
+
+func TestGraphQLWorkspaces(t *testing.T) {
+	var key struct {
+		Key string `json:"key"`
+	}
+	admin(t).expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "member", "scope": "read-write"}, &key)
+	member := client{t: t, token: key.Key}
+	var ws struct {
+		ID string `json:"id"`
+	}
+	member.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "GraphQL"}, &ws)
+	member.workspace = ws.ID
+	secret := member.createNote("Team secret", "")
+
+	var list struct {
+		Notes []note `json:"notes"`
+	}
+	anonymous(t).graphql(`{ notes { id } }`, &list)
+	if contains(list.Notes, secret.ID) {
+		t.Error("the default workspace lists a note of another workspace")
+	}
+	var one struct {
+		Note *note `json:"note"`
+	}
+	anonymous(t).graphql(`{ note(id: "`+secret.ID+`") { id } }`, &one)
+	if one.Note != nil {
+		t.Error("a note of another workspace is found from the default workspace")
+	}
+	var res struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	anonymous(t).expect(http.StatusOK, "POST", "/api/graphql", map[string]any{"query": `mutation { deleteNote(id: "` + secret.ID + `") }`}, &res)
+	if len(res.Errors) == 0 {
+		t.Error("a note of another workspace is deleted from the default workspace")
+	}
+
+	member.graphql(`{ notes { id } }`, &list)
+	if !contains(list.Notes, secret.ID) {
+		t.Error("GraphQL doesn't list the notes of the workspace picked")
+	}
+	var created struct {
+		CreateNote note `json:"createNote"`
+	}
+	member.graphql(`mutation { createNote(input: {title: "Also the team's"}) { id } }`, &created)
+	var got note
+	member.expect(http.StatusOK, "GET", "/api/notes/"+created.CreateNote.ID, nil, &got)
+	if got.Workspace != ws.ID {
+		t.Errorf("note created over GraphQL in workspace %q, want %q", got.Workspace, ws.ID)
+	}
+}
+
+func TestGraphQLTags(t *testing.T) {
+	c := anonymous(t)
+	tagged := c.createNote("Plans #Garden", "and #graphql-tags")
+	other := c.createNote("Other", "#graphql-tags only")
+	untagged := c.createNote("Untagged", "")
+
+	type tag struct {
+		Name  string `json:"name"`
+		Notes []note `json:"notes"`
+	}
+	var one struct {
+		Note struct {
+			Tags []tag `json:"tags"`
+		} `json:"note"`
+	}
+	c.graphql(`{ note(id: "`+tagged.ID+`") { tags { name notes { id } } } }`, &one)
+	if tags := one.Note.Tags; len(tags) != 2 || tags[0].Name != "garden" || tags[1].Name != "graphql-tags" ||
+		!contains(tags[1].Notes, other.ID) || contains(tags[1].Notes, untagged.ID) {
+		t.Errorf("tags of the note = %+v", tags)
+	}
+
+	var byName struct {
+		Tag     *tag  `json:"tag"`
+		Missing *tag  `json:"missing"`
+		Tags    []tag `json:"tags"`
+		Notes   []note
+	}
+	c.graphql(`{ tag(name: "#GraphQL-Tags") { name notes { id } } missing: tag(name: "nowhere") { name } tags { name } Notes: notes(tag: "garden") { id } }`, &byName)
+	if byName.Tag == nil || !contains(byName.Tag.Notes, tagged.ID) || !contains(byName.Tag.Notes, other.ID) {
+		t.Errorf("tag = %+v, want both tagged notes", byName.Tag)
+	}
+	if byName.Missing != nil {
+		t.Errorf("a tag no note has = %+v", byName.Missing)
+	}
+	names := map[string]bool{}
+	for _, tag := range byName.Tags {
+		names[tag.Name] = true
+	}
+	if !names["garden"] || !names["graphql-tags"] {
+		t.Errorf("tags = %+v", byName.Tags)
+	}
+	if len(byName.Notes) != 1 || byName.Notes[0].ID != tagged.ID {
+		t.Errorf("notes tagged garden = %+v", byName.Notes)
+	}
+}
+
+func TestTransfers(t *testing.T) {
+	adm := admin(t)
+	newKey := func(name string) (client, string) {
+		var key struct {
+			Key  string `json:"key"`
+			Info struct {
+				ID string `json:"id"`
+			} `json:"info"`
+		}
+		adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": name, "scope": "read-write"}, &key)
+		return client{t: t, token: key.Key}, key.Info.ID
+	}
+	alice, aliceID := newKey("alice")
+	bob, bobID := newKey("bob")
+
+	type transfer struct {
+		ID     string   `json:"id"`
+		Status string   `json:"status"`
+		Moved  []string `json:"moved"`
+	}
+	n := alice.createNote("Handover", "runbook")
+	alice.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/shares", nil)
+	bob.expect(http.StatusForbidden, "POST", "/api/notes/"+n.ID+"/transfer", map[string]any{"to_user": bobID})
+	alice.expect(http.StatusBadRequest, "POST", "/api/notes/"+n.ID+"/transfer", map[string]any{"to_user": aliceID})
+	alice.expect(http.StatusNotFound, "POST", "/api/notes/"+n.ID+"/transfer", map[string]any{"to_user": "nobody"})
+	var offered transfer
+	alice.expect(http.StatusCreated, "POST", "/api/notes/"+n.ID+"/transfer", map[string]any{"to_user": bobID}, &offered)
+	if offered.Status != "pending" {
+		t.Fatalf("transfer = %+v, want it pending", offered)
+	}
+	var list struct {
+		Incoming []transfer `json:"incoming"`
+	}
+	bob.expect(http.StatusOK, "GET", "/api/transfers", nil, &list)
+	if len(list.Incoming) != 1 || list.Incoming[0].ID != offered.ID {
+		t.Errorf("bob's incoming transfers = %+v", list.Incoming)
+	}
+	alice.expect(http.StatusForbidden, "POST", "/api/transfers/"+offered.ID+"/accept", nil)
+	var accepted transfer
+	bob.expect(http.StatusOK, "POST", "/api/transfers/"+offered.ID+"/accept", nil, &accepted)
+	if accepted.Status != "accepted" || len(accepted.Moved) != 1 {
+		t.Errorf("accepted transfer = %+v", accepted)
+	}
+	bob.expect(http.StatusConflict, "POST", "/api/transfers/"+offered.ID+"/accept", nil)
+	var got struct {
+		Owner string `json:"owner"`
+	}
+	bob.expect(http.StatusOK, "GET", "/api/notes/"+n.ID, nil, &got)
+	if got.Owner != bobID {
+		t.Errorf("owner after transfer = %q, want %q", got.Owner, bobID)
+	}
+	var shares []any
+	bob.expect(http.StatusOK, "GET", "/api/notes/"+n.ID+"/shares", nil, &shares)
+	if len(shares) != 0 {
+		t.Error("the old owner's share links survived the transfer")
+	}
+
+	// Into a workspace the sender edits it moves right away
+	var ws struct {
+		ID string `json:"id"`
+	}
+	alice.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Team docs"}, &ws)
+	personal := alice.createNote("Personal", "becomes a team doc")
+	var sync struct {
+		Cursor  int64    `json:"cursor"`
+		Deleted []string `json:"deleted"`
+	}
+	alice.expect(http.StatusOK, "GET", "/api/sync", nil, &sync)
+	res := alice.expect(http.StatusOK, "GET", "/api/notes/diff", nil)
+	var moved transfer
+	alice.expect(http.StatusOK, "POST", "/api/notes/"+personal.ID+"/transfer", map[string]any{"to_workspace": ws.ID}, &moved)
+	if moved.Status != "accepted" {
+		t.Errorf("transfer into the sender's workspace = %+v", moved)
+	}
+	alice.expect(http.StatusNotFound, "GET", "/api/notes/"+personal.ID, nil)
+
+	// Clients of the workspace it left learn it is gone from there
+	alice.expect(http.StatusOK, "GET", fmt.Sprintf("/api/sync?since=%d", sync.Cursor), nil, &sync)
+	if !slices.Contains(sync.Deleted, personal.ID) {
+		t.Errorf("sync after the move = %+v, want %s deleted", sync, personal.ID)
+	}
+	var diff struct {
+		Changed []string `json:"changed"`
+		Deleted []string `json:"deleted"`
+	}
+	alice.expect(http.StatusOK, "GET", "/api/notes/diff?etag="+url.QueryEscape(res.Header.Get("ETag")), nil, &diff)
+	if !slices.Contains(diff.Deleted, personal.ID) || slices.Contains(diff.Changed, personal.ID) {
+		t.Errorf("diff after the move = %+v, want %s deleted", diff, personal.ID)
+	}
+	alice.workspace = ws.ID
+	alice.expect(http.StatusOK, "GET", "/api/notes/"+personal.ID, nil)
+	alice.workspace = ""
+
+	// Whole notebooks, which the recipient may decline
+	for _, title := range []string{"One", "Two"} {
+		alice.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{"title": title, "notebook": "Leaving"})
+	}
+	var notebook transfer
+	alice.expect(http.StatusCreated, "POST", "/api/notebooks/Leaving/transfer", map[string]any{"to_user": bobID}, &notebook)
+	bob.expect(http.StatusOK, "POST", "/api/transfers/"+notebook.ID+"/decline", nil)
+	alice.expect(http.StatusConflict, "DELETE", "/api/transfers/"+notebook.ID, nil)
+	alice.expect(http.StatusNotFound, "POST", "/api/notebooks/Nothing/transfer", map[string]any{"to_user": bobID})
+}
+
+func TestWorkspaceQuotas(t *testing.T) {
+	adm := admin(t)
+	var key struct {
+		Key string `json:"key"`
+	}
+	adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "metered", "scope": "read-write"}, &key)
+	owner := client{t: t, token: key.Key}
+	var ws struct {
+		ID string `json:"id"`
+	}
+	owner.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Metered"}, &ws)
+	quotas := "/api/admin/workspaces/" + ws.ID + "/quotas"
+	adm.expect(http.StatusBadRequest, "PUT", quotas, map[string]any{"storage": map[string]any{"limit": 1}})
+	adm.expect(http.StatusNotFound, "PUT", "/api/admin/workspaces/nope/quotas", map[string]any{})
+
+	adm.expect(http.StatusOK, "PUT", quotas, map[string]any{"api_requests": map[string]any{"limit": 2}})
+	owner.workspace = ws.ID
+	for i := 0; i < 2; i++ {
+		if res := owner.expect(http.StatusOK, "GET", "/api/notes", nil); res.Header.Get("X-Notty-Quota-Warning") != "" {
+			t.Fatalf("request %d warned about a quota not reached yet", i+1)
+		}
+	}
+	if res := owner.expect(http.StatusOK, "GET", "/api/notes", nil); res.Header.Get("X-Notty-Quota-Warning") != "api_requests" {
+		t.Error("no warning over a soft quota")
+	}
+
+	adm.expect(http.StatusOK, "PUT", quotas, map[string]any{"api_requests": map[string]any{"limit": 2, "hard": true}})
+	var refused struct {
+		Code string `json:"code"`
+	}
+	res := owner.expect(http.StatusTooManyRequests, "GET", "/api/notes", nil, &refused)
+	if refused.Code != "quota_exceeded" || res.Header.Get("Retry-After") == "" {
+		t.Errorf("refusal = %+v with Retry-After %q", refused, res.Header.Get("Retry-After"))
+	}
+	anonymous(t).expect(http.StatusOK, "GET", "/api/notes", nil)
+
+	var usage []struct {
+		Feature string `json:"feature"`
+		Period  string `json:"period"`
+		Used    int    `json:"used"`
+		Limit   int    `json:"limit"`
+		Hard    bool   `json:"hard"`
+	}
+	owner.workspace = ""
+	owner.expect(http.StatusOK, "GET", "/api/workspaces/"+ws.ID+"/usage", nil, &usage)
+	if len(usage) == 0 || usage[0].Feature != "api_requests" || usage[0].Period != "day" || usage[0].Used < 4 || usage[0].Limit != 2 || !usage[0].Hard {
+		t.Errorf("usage = %+v", usage)
+	}
+	anonymous(t).expect(http.StatusNotFound, "GET", "/api/workspaces/"+ws.ID+"/usage", nil)
+
+	adm.expect(http.StatusOK, "PUT", quotas, "null")
+	owner.workspace = ws.ID
+	owner.expect(http.StatusOK, "GET", "/api/notes", nil)
+}
+
+func TestEvents(t *testing.T) {
+	c := anonymous(t)
+	c.expect(http.StatusBadRequest, "GET", "/api/events?last_event_id=abc", nil)
+
+	var sync struct {
+		Cursor int64 `json:"cursor"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/sync", nil, &sync)
+	n := c.createNote("Evented", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/events", nil)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(sync.Cursor))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var got strings.Builder
+	buf := make([]byte, 4096)
+	for !strings.Contains(got.String(), n.ID) {
+		k, err := res.Body.Read(buf)
+		if err != nil {
+			t.Fatalf("stream ended before the change of the note: %v\n%s", err, got.String())
+		}
+		got.Write(buf[:k])
+	}
+	if !strings.Contains(got.String(), "event: create") {
+		t.Errorf("stream = %s, want a create event", got.String())
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	res, data := anonymous(t).do("GET", "/metrics", nil)
+	if res.StatusCode != http.StatusOK || !bytes.Contains(data, []byte("# TYPE")) {
+		t.Errorf("metrics = %d", res.StatusCode)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	adm := admin(t)
+	var key struct {
+		Key  string `json:"key"`
+		Info struct {
+			ID string `json:"id"`
+		} `json:"info"`
+	}
+	adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "integrator", "scope": "read-write"}, &key)
+	c := client{t: t, token: key.Key}
+
+	var seeded []note
+	c.expect(http.StatusOK, "GET", "/api/notes?sandbox=true", nil, &seeded)
+	if len(seeded) != 3 {
+		t.Fatalf("sandbox has %d notes, want the 3 samples", len(seeded))
+	}
+	var scratch note
+	c.expect(http.StatusCreated, "POST", "/api/notes?sandbox=true", map[string]any{"title": "Scratch"}, &scratch)
+	c.expect(http.StatusOK, "GET", "/api/notes/"+scratch.ID+"?sandbox=true", nil)
+
+	// Real data and the sandbox don't see each other
+	real := c.createNote("Real", "")
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+scratch.ID, nil)
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+real.ID+"?sandbox=true", nil)
+	var list []note
+	c.expect(http.StatusOK, "GET", "/api/notes", nil, &list)
+	if contains(list, scratch.ID) || contains(list, seeded[0].ID) {
+		t.Error("sandbox notes are listed outside of the sandbox")
+	}
+
+	c.expect(http.StatusForbidden, "GET", "/api/webhooks?sandbox=true", nil)
+	c.expect(http.StatusForbidden, "POST", "/api/notes/"+scratch.ID+"/shares?sandbox=true", nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/notes?sandbox=true&workspace=other", nil)
+	c.expect(http.StatusNotFound, "GET", "/api/notes?workspace=sandbox:"+key.Info.ID, nil)
+	anonymous(t).expect(http.StatusUnauthorized, "GET", "/api/notes?sandbox=true", nil)
+	adm.expect(http.StatusUnauthorized, "GET", "/api/sandbox", nil)
+
+	var reset struct {
+		Deleted int `json:"deleted"`
+	}
+	c.expect(http.StatusOK, "POST", "/api/sandbox/reset", nil, &reset)
+	if reset.Deleted != 4 {
+		t.Errorf("reset deleted %d notes, want 4", reset.Deleted)
+	}
+	var sandbox struct {
+		Workspace string `json:"workspace"`
+		Notes     int    `json:"notes"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/sandbox", nil, &sandbox)
+	if sandbox.Workspace != "sandbox:"+key.Info.ID || sandbox.Notes != 0 {
+		t.Errorf("sandbox after reset = %+v", sandbox)
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes/"+real.ID, nil)
+	c.expect(http.StatusOK, "GET", "/api/notes?sandbox=true", nil, &seeded)
+	if len(seeded) != 3 {
+		t.Errorf("sandbox has %d notes after reset, want the 3 samples", len(seeded))
+	}
+}
+
+func TestReadingPosition(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Long read", strings.Repeat("All work and no play. ", 100))
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+n.ID+"/position", nil)
+	res := c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID, nil)
+	etag := res.Header.Get("ETag")
+
+	c.expect(http.StatusBadRequest, "PUT", "/api/notes/"+n.ID+"/position", map[string]any{"progress": 2})
+	c.expect(http.StatusBadRequest, "PUT", "/api/notes/"+n.ID+"/position", map[string]any{"offset": -1})
+	c.expect(http.StatusNotFound, "PUT", "/api/notes/"+missingNote+"/position", map[string]any{"offset": 1})
+	var pos struct {
+		Offset   int     `json:"offset"`
+		Progress float64 `json:"progress"`
+		Device   string  `json:"device"`
+	}
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+n.ID+"/position", map[string]any{"offset": 1 << 20, "progress": 0.5, "device": "phone"}, &pos)
+	if pos.Offset != len(n.Content) || pos.Progress != 0.5 || pos.Device != "phone" {
+		t.Errorf("saved position = %+v", pos)
+	}
+
+	// Fetching the note again brings the position along, under a new ETag
+	var fetched struct {
+		Title    string `json:"title"`
+		Position *struct {
+			Progress float64 `json:"progress"`
+		} `json:"position"`
+	}
+	res = c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID, nil, &fetched)
+	if fetched.Title != n.Title || fetched.Position == nil || fetched.Position.Progress != 0.5 {
+		t.Errorf("note with position = %+v", fetched)
+	}
+	if res.Header.Get("ETag") == etag {
+		t.Error("the ETag didn't change with the position")
+	}
+
+	// Positions are per user
+	adm := admin(t)
+	var key struct {
+		Key string `json:"key"`
+	}
+	adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "reader", "scope": "read-write"}, &key)
+	other := client{t: t, token: key.Key}
+	other.expect(http.StatusNotFound, "GET", "/api/notes/"+n.ID+"/position", nil)
+
+	c.expect(http.StatusOK, "DELETE", "/api/notes/"+n.ID+"/position", nil)
+	c.expect(http.StatusNotFound, "DELETE", "/api/notes/"+n.ID+"/position", nil)
+	fetched.Position = nil
+	c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID, nil, &fetched)
+	if fetched.Position != nil {
+		t.Error("a deleted position is still returned")
+	}
+}
+
+func TestAttachmentsZip(t *testing.T) {
+	c := anonymous(t)
+	var first, second note
+	c.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{"title": "Trip", "notebook": "Zipped"}, &first)
+	c.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{"title": "Receipts", "notebook": "Zipped"}, &second)
+	img := testPNG(t, 8, 8)
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+first.ID+"/attachments?name=pic.png", img)
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+first.ID+"/attachments?name=pic.png", img)
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+second.ID+"/attachments?name=scan.png", img)
+
+	files := func(path string) (map[string][]byte, []string) {
+		t.Helper()
+		res, data := c.do("GET", path, nil)
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/zip" {
+			t.Fatalf("GET %s = %d %s", path, res.StatusCode, data)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, _ := f.Open()
+			found[f.Name], _ = io.ReadAll(rc)
+			rc.Close()
+		}
+		var manifest struct {
+			Attachments []struct {
+				Path   string `json:"path"`
+				NoteID string `json:"note_id"`
+			} `json:"attachments"`
+		}
+		if err := json.Unmarshal(found["manifest.json"], &manifest); err != nil {
+			t.Fatalf("manifest of %s: %v", path, err)
+		}
+		var paths []string
+		for _, a := range manifest.Attachments {
+			if !bytes.Equal(found[a.Path], img) {
+				t.Errorf("%s of %s isn't the upload", a.Path, path)
+			}
+			paths = append(paths, a.Path)
+		}
+		return found, paths
+	}
+
+	_, paths := files("/api/notes/" + first.ID + "/attachments.zip")
+	if len(paths) != 2 || paths[0] != "pic.png" || !strings.HasSuffix(paths[1], "-pic.png") {
+		t.Errorf("note archive has %v", paths)
+	}
+	_, paths = files("/api/notebooks/Zipped/attachments.zip")
+	if len(paths) != 3 || !strings.HasPrefix(paths[0], "trip/") || paths[2] != "receipts/scan.png" {
+		t.Errorf("notebook archive has %v", paths)
+	}
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+missingNote+"/attachments.zip", nil)
+	c.expect(http.StatusNotFound, "GET", "/api/notebooks/Nowhere/attachments.zip", nil)
+}
+
+func TestListPreferences(t *testing.T) {
+	adm := admin(t)
+	var key struct {
+		Key string `json:"key"`
+	}
+	adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": "lister", "scope": "read-write"}, &key)
+	c := client{t: t, token: key.Key}
+	for _, title := range []string{"banana", "Apple", "cherry"} {
+		c.createNote(title, "")
+	}
+
+	c.expect(http.StatusBadRequest, "PUT", "/api/preferences/list", map[string]any{"sort": "color"})
+	c.expect(http.StatusBadRequest, "PUT", "/api/preferences/list", map[string]any{"page_size": 1000})
+	c.expect(http.StatusOK, "PUT", "/api/preferences/list", map[string]any{"sort": "title", "page_size": 2, "group": "notebook"})
+	var prefs struct {
+		Sort     string `json:"sort"`
+		PageSize int    `json:"page_size"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/preferences/list", nil, &prefs)
+	if prefs.Sort != "title" || prefs.PageSize != 2 {
+		t.Errorf("preferences = %+v", prefs)
+	}
+
+	// Lists without parameters follow the preferences
+	var page []note
+	res := c.expect(http.StatusOK, "GET", "/api/notes", nil, &page)
+	total, _ := strconv.Atoi(res.Header.Get("X-Total-Count"))
+	if len(page) != 2 || total < 3 || res.Header.Get("X-Notty-Group") != "notebook" {
+		t.Fatalf("preferred list = %d notes of %d, grouped by %q", len(page), total, res.Header.Get("X-Notty-Group"))
+	}
+	var all []note
+	c.expect(http.StatusOK, "GET", "/api/notes?limit=0&group=none", nil, &all)
+	if len(all) != total {
+		t.Errorf("?limit=0 lists %d notes, want %d", len(all), total)
+	}
+	for i := 1; i < len(all); i++ {
+		if strings.ToLower(all[i-1].Title) > strings.ToLower(all[i].Title) {
+			t.Fatalf("%q comes before %q", all[i-1].Title, all[i].Title)
+		}
+	}
+	var last []note
+	c.expect(http.StatusOK, "GET", fmt.Sprintf("/api/notes?offset=%d", total-1), nil, &last)
+	if len(last) != 1 {
+		t.Errorf("last page has %d notes", len(last))
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/notes?order=sideways", nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/notes?limit=-1", nil)
+
+	// The ETag is the list's own, and still good for syncing
+	etag := res.Header.Get("ETag")
+	res = anonymous(t).expect(http.StatusOK, "GET", "/api/notes", nil)
+	if res.Header.Get("ETag") == etag || res.Header.Get("X-Total-Count") != "" {
+		t.Error("other callers get the preferred list")
+	}
+	c.expect(http.StatusOK, "GET", "/api/sync?etag="+url.QueryEscape(etag), nil)
+
+	c.expect(http.StatusOK, "PUT", "/api/preferences/list", map[string]any{})
+	res = c.expect(http.StatusOK, "GET", "/api/notes", nil)
+	if res.Header.Get("X-Total-Count") != "" {
+		t.Error("cleared preferences still page the list")
+	}
+}
+
+func TestNoteLanguage(t *testing.T) {
+	c := anonymous(t)
+	type languageNote struct {
+		ID       string `json:"id"`
+		Language string `json:"language"`
+		Detected bool   `json:"language_detected"`
+	}
+	var en, de languageNote
+	c.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{
+		"title": "Plans for the garden", "content": "We want to plant the tomatoes and the beans in May",
+	}, &en)
+	if en.Language != "en" || !en.Detected {
+		t.Errorf("English note = %+v, want a detected en", en)
+	}
+	c.expect(http.StatusCreated, "POST", "/api/notes", map[string]any{
+		"title": "Gartenpläne", "content": "Wir wollen die Tomaten und die Bohnen im Mai pflanzen",
+	}, &de)
+	if de.Language != "de" {
+		t.Errorf("German note = %+v, want de", de)
+	}
+
+	// A language the client sets sticks, a detected one follows the text
+	en = languageNote{ID: en.ID}
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+en.ID, map[string]any{
+		"title": "Plans for the garden", "content": "We want to plant the tomatoes and the beans in May", "language": "en-GB",
+	}, &en)
+	if en.Language != "en-GB" || en.Detected {
+		t.Errorf("note with a language = %+v, want en-GB as set", en)
+	}
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+de.ID, map[string]any{
+		"title": "Garden plans", "content": "We want to plant the tomatoes and the beans in May", "language": "de", "language_detected": true,
+	}, &de)
+	if de.Language != "en" {
+		t.Errorf("rewritten note = %+v, want en", de)
+	}
+
+	var list []note
+	c.expect(http.StatusOK, "GET", "/api/notes?lang=en", nil, &list)
+	if !contains(list, en.ID) || !contains(list, de.ID) {
+		t.Error("?lang=en leaves out notes in en or en-GB")
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes?lang=en-GB", nil, &list)
+	if !contains(list, en.ID) || contains(list, de.ID) {
+		t.Error("?lang=en-GB doesn't list just the notes in en-GB")
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/notes?lang=English", nil)
+
+	var found struct {
+		Results []note `json:"results"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/search?q=tomatoes&lang=en-GB", nil, &found)
+	if !contains(found.Results, en.ID) || contains(found.Results, de.ID) {
+		t.Errorf("search in en-GB = %+v", found.Results)
+	}
+}
+
+func TestCopyToWorkspace(t *testing.T) {
+	adm := admin(t)
+	newKey := func(name string) client {
+		var key struct {
+			Key string `json:"key"`
+		}
+		adm.expect(http.StatusCreated, "POST", "/api/apikeys", map[string]any{"name": name, "scope": "read-write"}, &key)
+		return client{t: t, token: key.Key}
+	}
+	alice, bob := newKey("copier"), newKey("outsider")
+	var ws struct {
+		ID string `json:"id"`
+	}
+	alice.expect(http.StatusCreated, "POST", "/api/workspaces", map[string]any{"name": "Copies"}, &ws)
+
+	target := alice.createNote("Glossary", "terms")
+	src := alice.createNote("Guide", "")
+	var a struct {
+		ID string `json:"id"`
+	}
+	img := testPNG(t, 8, 8)
+	alice.expect(http.StatusCreated, "POST", "/api/notes/"+src.ID+"/attachments?name=pic.png", img, &a)
+	content := "See notty://note/" + target.ID + ", [[" + src.ID + "|this guide]] and ![pic](/api/attachments/" + a.ID + ")"
+	alice.expect(http.StatusOK, "PUT", "/api/notes/"+src.ID, map[string]any{"title": "Guide", "content": content, "published": true})
+	alice.expect(http.StatusCreated, "POST", "/api/notes/"+src.ID+"/shares", nil)
+
+	copyTo := func(c client, want int, id, query string, out ...any) {
+		t.Helper()
+		c.expect(want, "POST", "/api/notes/"+id+"/copy-to"+query, nil, out...)
+	}
+	copyTo(alice, http.StatusBadRequest, src.ID, "")
+	copyTo(alice, http.StatusBadRequest, src.ID, "?workspace=")
+	copyTo(alice, http.StatusNotFound, src.ID, "?workspace=nope")
+	copyTo(alice, http.StatusNotFound, missingNote, "?workspace="+ws.ID)
+	copyTo(bob, http.StatusNotFound, src.ID, "?workspace="+ws.ID)
+
+	type copied struct {
+		ID         string `json:"id"`
+		Content    string `json:"content"`
+		Workspace  string `json:"workspace"`
+		Published  bool   `json:"published"`
+		CopiedFrom string `json:"copied_from"`
+	}
+	var glossary, guide copied
+	copyTo(alice, http.StatusCreated, target.ID, "?workspace="+ws.ID, &glossary)
+	copyTo(alice, http.StatusCreated, src.ID, "?workspace="+ws.ID, &guide)
+	if guide.Workspace != ws.ID || guide.CopiedFrom != src.ID || guide.Published || guide.ID == src.ID {
+		t.Errorf("copy = %+v", guide)
+	}
+
+	alice.workspace = ws.ID
+	var files []struct {
+		ID string `json:"id"`
+	}
+	alice.expect(http.StatusOK, "GET", "/api/notes/"+guide.ID+"/attachments", nil, &files)
+	if len(files) != 1 || files[0].ID == a.ID {
+		t.Fatalf("attachments of the copy = %+v", files)
+	}
+	if res, data := alice.do("GET", "/api/attachments/"+files[0].ID, nil); res.StatusCode != http.StatusOK || !bytes.Equal(data, img) {
+		t.Errorf("copied attachment = %d with %d bytes", res.StatusCode, len(data))
+	}
+	want := "See notty://note/" + glossary.ID + ", [[" + guide.ID + "|this guide]] and ![pic](/api/attachments/" + files[0].ID + ")"
+	if guide.Content != want {
+		t.Errorf("content of the copy = %q, want %q", guide.Content, want)
+	}
+	var shares []any
+	alice.expect(http.StatusOK, "GET", "/api/notes/"+guide.ID+"/shares", nil, &shares)
+	if len(shares) != 0 {
+		t.Error("share links were copied")
+	}
+
+	// The original stays as it was, and keeps its files after the copy goes
+	alice.expect(http.StatusOK, "DELETE", "/api/notes/"+guide.ID, nil)
+	alice.workspace = ""
+	var original note
+	alice.expect(http.StatusOK, "GET", "/api/notes/"+src.ID, nil, &original)
+	if original.Content != content {
+		t.Errorf("content of the original = %q", original.Content)
+	}
+	if res, data := alice.do("GET", "/api/attachments/"+a.ID, nil); res.StatusCode != http.StatusOK || !bytes.Equal(data, img) {
+		t.Errorf("original attachment = %d with %d bytes", res.StatusCode, len(data))
+	}
+}
+
+func TestTasks(t *testing.T) {
+	c := anonymous(t)
+	today := time.Now().UTC().Format(time.DateOnly)
+	chores := c.createNote("Chores", "- [ ] call the plumber due:2000-01-01\n- [x] buy milk\n- [ ] water plants due:"+today)
+	later := c.createNote("Someday", "1. [ ] learn the cello")
+
+	type task struct {
+		ID     string `json:"id"`
+		Text   string `json:"text"`
+		Done   bool   `json:"done"`
+		Due    string `json:"due"`
+		NoteID string `json:"note_id"`
+	}
+	mine := func(query string) []task {
+		t.Helper()
+		var all, list []task
+		c.expect(http.StatusOK, "GET", "/api/tasks"+query, nil, &all)
+		for _, task := range all {
+			if task.NoteID == chores.ID || task.NoteID == later.ID {
+				list = append(list, task)
+			}
+		}
+		return list
+	}
+	texts := func(list []task) []string {
+		var texts []string
+		for _, task := range list {
+			texts = append(texts, task.Text)
+		}
+		return texts
+	}
+	all := mine("")
+	if got := texts(all); !slices.Equal(got, []string{"call the plumber due:2000-01-01", "water plants due:" + today, "buy milk", "learn the cello"}) {
+		t.Errorf("tasks = %q, due soonest first", got)
+	}
+	for query, want := range map[string][]string{
+		"?done=false&due=none": {"learn the cello"},
+		"?done=true":           {"buy milk"},
+		"?due=overdue":         {"call the plumber due:2000-01-01"},
+		"?due=today":           {"water plants due:" + today},
+		"?due=2000-12-31":      {"call the plumber due:2000-01-01"},
+	} {
+		if got := texts(mine(query)); !slices.Equal(got, want) {
+			t.Errorf("tasks%s = %q, want %q", query, got, want)
+		}
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/tasks?due=soon", nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/tasks?done=maybe", nil)
+
+	// Checking a task off writes it back into the note
+	var done task
+	c.expect(http.StatusOK, "PATCH", "/api/notes/"+chores.ID+"/tasks/"+all[0].ID, map[string]any{"done": true}, &done)
+	if !done.Done || done.ID != all[0].ID {
+		t.Errorf("checked off task = %+v", done)
+	}
+	var n note
+	c.expect(http.StatusOK, "GET", "/api/notes/"+chores.ID, nil, &n)
+	if !strings.HasPrefix(n.Content, "- [x] call the plumber") {
+		t.Errorf("content = %q, want the task checked off", n.Content)
+	}
+	c.expect(http.StatusOK, "PATCH", "/api/notes/"+chores.ID+"/tasks/"+all[0].ID, nil, &done)
+	if done.Done {
+		t.Error("toggling a finished task left it finished")
+	}
+
+	// Edited tasks are no longer found by their old ID
+	c.expect(http.StatusOK, "PUT", "/api/notes/"+later.ID, map[string]any{"title": "Someday", "content": "1. [ ] learn the violin"})
+	c.expect(http.StatusNotFound, "PATCH", "/api/notes/"+later.ID+"/tasks/"+all[3].ID, map[string]any{"done": true})
+	c.expect(http.StatusNotFound, "PATCH", "/api/notes/"+missingNote+"/tasks/"+all[3].ID, nil)
+}
+
+func TestStatusPage(t *testing.T) {
+	type page struct {
+		Status     string `json:"status"`
+		Components []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"components"`
+		Incidents []struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"incidents"`
+	}
+	var p page
+	anonymous(t).expect(http.StatusOK, "GET", "/status.json", nil, &p)
+	workers := false
+	for _, c := range p.Components {
+		workers = workers || c.Name == "job workers" && c.Status == "operational"
+	}
+	if !workers {
+		t.Errorf("components = %+v, want the job workers operational", p.Components)
+	}
+
+	anonymous(t).expect(http.StatusUnauthorized, "POST", "/api/admin/incidents", map[string]any{"title": "Slow sync", "impact": "minor"})
+	admin(t).expect(http.StatusBadRequest, "POST", "/api/admin/incidents", map[string]any{"title": "Slow sync", "impact": "dire"})
+	var inc struct {
+		ID         string  `json:"id"`
+		ResolvedAt *string `json:"resolved_at"`
+	}
+	admin(t).expect(http.StatusCreated, "POST", "/api/admin/incidents", map[string]any{"title": "Database <down>", "impact": "major"}, &inc)
+	anonymous(t).expect(http.StatusOK, "GET", "/status.json", nil, &p)
+	if p.Status != "outage" || len(p.Incidents) != 1 || p.Incidents[0].ID != inc.ID {
+		t.Errorf("status = %s with incidents %+v, want an outage for the incident", p.Status, p.Incidents)
+	}
+	res, body := anonymous(t).do("GET", "/status", nil)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), "Database &lt;down&gt;") || !strings.Contains(string(body), "ongoing") {
+		t.Errorf("GET /status = %d: %s", res.StatusCode, body)
+	}
+	if csp := res.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "style-src 'nonce-") {
+		t.Errorf("Content-Security-Policy = %q, want a style nonce", csp)
+	}
+
+	admin(t).expect(http.StatusOK, "PATCH", "/api/admin/incidents/"+inc.ID, map[string]any{"resolved": true}, &inc)
+	if inc.ResolvedAt == nil {
+		t.Error("resolving left the incident open")
+	}
+	anonymous(t).expect(http.StatusOK, "GET", "/status.json", nil, &p)
+	if p.Status == "outage" || len(p.Incidents) != 1 {
+		t.Errorf("status = %s with incidents %+v, want the resolved incident listed", p.Status, p.Incidents)
+	}
+	admin(t).expect(http.StatusNoContent, "DELETE", "/api/admin/incidents/"+inc.ID, nil)
+	admin(t).expect(http.StatusNotFound, "PATCH", "/api/admin/incidents/"+inc.ID, map[string]any{"resolved": false})
+}
+
+func TestRelatedNotes(t *testing.T) {
+	c := anonymous(t)
+	pasta := c.createNote("Pasta", "#zzcooking #zzitalian dinner ideas")
+	pizza := c.createNote("Pizza", "#zzcooking #zzitalian dough")
+	soup := c.createNote("Soup", "#zzcooking")
+	linked := c.createNote("Shopping", "flour, see notty://note/"+pizza.ID)
+	c.expect(http.StatusCreated, "POST", "/api/notes/"+pasta.ID+"/relations", map[string]any{"type": "related-to", "to": linked.ID})
+
+	var list []struct {
+		ID      string  `json:"id"`
+		Title   string  `json:"title"`
+		Score   float64 `json:"score"`
+		Signals struct {
+			Tags  float64 `json:"tags"`
+			Links float64 `json:"links"`
+		} `json:"signals"`
+	}
+	c.expect(http.StatusOK, "GET", "/api/notes/"+pasta.ID+"/related?limit=3", nil, &list)
+	var ids []string
+	for _, r := range list {
+		ids = append(ids, r.ID)
+	}
+	// Pizza shares both tags and is two hops away through the shopping list
+	if !slices.Equal(ids, []string{pizza.ID, linked.ID, soup.ID}) {
+		t.Fatalf("related = %+v, want pizza, shopping, soup", list)
+	}
+	if list[0].Signals.Tags != 1 || list[0].Signals.Links != 0.5 || list[0].Title != "Pizza" {
+		t.Errorf("pizza = %+v", list[0])
+	}
+
+	c.expect(http.StatusOK, "GET", "/api/notes/"+pasta.ID+"/related?strategy=strongest&limit=1", nil, &list)
+	if len(list) != 1 || list[0].Score != 1 {
+		t.Errorf("strongest = %+v", list)
+	}
+	c.expect(http.StatusBadRequest, "GET", "/api/notes/"+pasta.ID+"/related?strategy=newest", nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/notes/"+pasta.ID+"/related?limit=0", nil)
+	c.expect(http.StatusNotFound, "GET", "/api/notes/"+missingNote+"/related", nil)
+}
+
+func TestMergePreview(t *testing.T) {
+	c := anonymous(t)
+	n := c.createNote("Packing list", "passport\ncharger\nsocks")
+	base := c.expect(http.StatusOK, "GET", "/api/notes/"+n.ID, nil).Header.Get("ETag")
+
+	// Someone else saves first
+	put := func(etag string, title, content string) (*http.Response, []byte) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{"title": title, "content": content})
+		req, _ := http.NewRequest("PUT", server.URL+"/api/notes/"+n.ID, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", etag)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return res, data
+	}
+	res, data := put(base, "Packing list", "passport\nphone charger\nsocks")
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") == base {
+		t.Fatalf("PUT with a current If-Match = %d, ETag %s: %s", res.StatusCode, res.Header.Get("ETag"), data)
+	}
+	theirs := res.Header.Get("ETag")
+
+	// Our draft from the same base conflicts on one line only
+	draft := "passport\nUSB charger\nsocks\nsunscreen"
+	res, data = put(base, "Beach trip", draft)
+	if res.StatusCode != http.StatusConflict || !strings.Contains(string(data), "phone charger") {
+		t.Fatalf("PUT with a stale If-Match = %d: %s, want 409 with the current note", res.StatusCode, data)
+	}
+
+	var p struct {
+		Base          *struct{ Content string } `json:"base"`
+		Merged        struct{ Title, Content string }
+		Conflicts     int    `json:"conflicts"`
+		TitleConflict bool   `json:"title_conflict"`
+		ETag          string `json:"etag"`
+	}
+	c.expect(http.StatusOK, "POST", "/api/notes/"+n.ID+"/merge-preview", map[string]any{"base": base, "title": "Beach trip", "content": draft}, &p)
+	want := "passport\n<<<<<<< yours\nUSB charger\n||||||| base\ncharger\n=======\nphone charger\n>>>>>>> theirs\nsocks\nsunscreen"
+	if p.Base == nil || p.Merged.Content != want || p.Conflicts != 1 || p.Merged.Title != "Beach trip" || p.TitleConflict || p.ETag != theirs {
+		t.Errorf("merge preview = %+v, want content %q", p, want)
+	}
+
+	// The merge is saved over their version
+	if res, data := put(p.ETag, p.Merged.Title, "passport\nUSB charger\nsocks\nsunscreen"); res.StatusCode != http.StatusOK {
+		t.Errorf("saving the merge = %d: %s", res.StatusCode, data)
+	}
+	c.expect(http.StatusBadRequest, "POST", "/api/notes/"+n.ID+"/merge-preview", map[string]any{"title": "x", "content": "y"})
+	c.expect(http.StatusNotFound, "POST", "/api/notes/"+missingNote+"/merge-preview", map[string]any{"base": base, "title": "x"})
+
+	// A base the log doesn't have merges the whole draft as a conflict
+	c.expect(http.StatusOK, "POST", "/api/notes/"+n.ID+"/merge-preview", map[string]any{"base": `"unknown"`, "title": "Beach trip", "content": "towel"}, &p)
+	if p.Base != nil || p.Conflicts != 1 {
+		t.Errorf("merge preview without base = %+v", p)
+	}
+}
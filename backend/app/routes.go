@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"note/backend/auth"
+	"note/backend/graph"
+	"note/backend/handlers"
+	"note/backend/slo"
+	"note/backend/spa"
+	"note/frontend"
+)
+
+// routes registers the HTTP API and the web app
+func (a *App) routes() {
+	e, cfg := a.echo, a.cfg
+
+	// Routes of the private API, open to API keys and the admin token, in
+	// the workspace a request picks
+	api := e.Group("/api", auth.RequireAPIKey(handlers.APIKeys, cfg.RequireAPIKeys, cfg.AdminToken), handlers.WorkspaceScope, handlers.WorkspaceQuotas)
+	api.GET("/notes", handlers.GetNotes)
+	api.GET("/notes/duplicates", handlers.GetDuplicates)
+	api.GET("/notes/nearby", handlers.GetNearbyNotes)
+	api.GET("/notes/diff", handlers.GetNotesDiff)
+	api.GET("/stats", handlers.GetStats)
+	api.POST("/notes/merge", handlers.MergeNotes)
+	api.POST("/notes/replace", handlers.ReplaceNotes)
+	api.GET("/trash", handlers.GetTrash)
+	api.POST("/trash/:id/restore", handlers.RestoreNote)
+	api.DELETE("/trash/:id", handlers.PurgeNote)
+	api.GET("/notes/replace/:id", handlers.GetReplaceJob)
+	api.POST("/notes", handlers.CreateNote)
+	api.GET("/notes/:id", handlers.GetNote)
+	api.PUT("/notes/:id", handlers.UpdateNote)
+	api.DELETE("/notes/:id", handlers.DeleteNote)
+	api.POST("/notes/:id/merge-preview", handlers.PreviewMerge)
+	api.PATCH("/notes/:id/items/:itemId", handlers.UpdateItem)
+	api.PATCH("/notes/:id/tasks/:taskId", handlers.UpdateTask)
+	api.GET("/notes/:id/activity", handlers.GetNoteActivity)
+	api.GET("/notes/:id/stats", handlers.GetNoteStats)
+	api.GET("/notes/:id/position", handlers.GetReadingPosition)
+	api.PUT("/notes/:id/position", handlers.UpdateReadingPosition)
+	api.DELETE("/notes/:id/position", handlers.DeleteReadingPosition)
+	api.POST("/notes/:id/transfer", handlers.CreateTransfer)
+	api.POST("/notes/:id/copy-to", handlers.CopyNoteToWorkspace)
+	api.GET("/notes/:id/relations", handlers.GetRelations)
+	api.GET("/notes/:id/backlinks", handlers.GetBacklinks)
+	api.GET("/notes/:id/related", handlers.GetRelatedNotes)
+	api.POST("/notes/:id/relations", handlers.CreateRelation)
+	api.DELETE("/notes/:id/relations/:relationId", handlers.DeleteRelation)
+	api.GET("/notes/:id/export", handlers.ExportNote)
+	api.POST("/notes/:id/attachments", handlers.UploadAttachment)
+	api.GET("/notes/:id/attachments", handlers.GetAttachments)
+	api.GET("/notes/:id/attachments.zip", handlers.GetNoteAttachmentsZip)
+	api.GET("/attachments/:attachmentId", handlers.GetAttachment)
+	api.GET("/attachments/:attachmentId/preview", handlers.GetAttachmentPreview)
+	api.DELETE("/attachments/:attachmentId", handlers.DeleteAttachment)
+	api.GET("/export", handlers.ExportNotes)
+	api.GET("/export/signing-key", handlers.GetExportSigningKey)
+	api.POST("/export/verify", handlers.VerifyExport)
+	api.GET("/sync", handlers.Sync)
+	api.GET("/events", handlers.StreamEvents)
+	api.GET("/graph", handlers.GetGraph)
+	api.GET("/usage", handlers.GetUsage)
+	api.GET("/capabilities", handlers.GetCapabilities)
+	api.GET("/ingest", handlers.GetIngestSettings)
+	api.PUT("/ingest", handlers.UpdateIngestSettings)
+	api.GET("/search", handlers.SearchNotes)
+	api.GET("/tasks", handlers.GetTasks)
+	api.GET("/search/status", handlers.GetSearchStatus)
+	api.GET("/inbox", handlers.GetInbox)
+	api.GET("/review/queue", handlers.GetReviewQueue)
+	api.POST("/review/queue/:id", handlers.ReviewNote)
+	api.POST("/inbox/triage", handlers.TriageInbox)
+	api.POST("/notes/:id/shares", handlers.CreateShare)
+	api.GET("/notes/:id/shares", handlers.GetShares)
+	api.DELETE("/shares/:token", handlers.DeleteShare)
+	api.POST("/notebooks/:notebook/shares", handlers.CreateNotebookShare)
+	api.GET("/notebooks/:notebook/shares", handlers.GetNotebookShares)
+	api.POST("/notebooks/:notebook/transfer", handlers.CreateNotebookTransfer)
+	api.GET("/notebooks/:notebook/attachments.zip", handlers.GetNotebookAttachmentsZip)
+	api.POST("/tokens", handlers.CreateToken)
+	api.GET("/tokens", handlers.GetTokens)
+	api.DELETE("/tokens/:id", handlers.DeleteToken)
+	api.GET("/notifications", handlers.GetNotifications)
+	api.POST("/notifications/:id/read", handlers.ReadNotification)
+	api.GET("/notifications/preferences", handlers.GetNotificationPreferences)
+	api.PUT("/notifications/preferences", handlers.UpdateNotificationPreferences)
+	api.GET("/preferences/list", handlers.GetListPreferences)
+	api.PUT("/preferences/list", handlers.UpdateListPreferences)
+	api.POST("/webhooks", handlers.CreateWebhook)
+	api.GET("/webhooks", handlers.GetWebhooks)
+	api.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+	api.GET("/webhooks/:id/deliveries", handlers.GetWebhookDeliveries)
+	api.GET("/templates", handlers.GetTemplates)
+	api.POST("/templates", handlers.CreateTemplate)
+	api.GET("/templates/export", handlers.ExportTemplates)
+	api.POST("/templates/import", handlers.ImportTemplates)
+	api.DELETE("/templates/:id", handlers.DeleteTemplate)
+	api.POST("/templates/:id/notes", handlers.CreateNoteFromTemplate)
+	api.POST("/apikeys", handlers.CreateAPIKey)
+	api.GET("/apikeys", handlers.GetAPIKeys)
+	api.DELETE("/apikeys/:id", handlers.DeleteAPIKey)
+	api.POST("/session", handlers.CreateSession)
+	api.DELETE("/session", handlers.DeleteSession)
+	api.GET("/jobs/:id", handlers.GetJob)
+	api.GET("/jobs/:id/output", handlers.GetJobOutput)
+	api.POST("/workspaces", handlers.CreateWorkspace)
+	api.GET("/workspaces", handlers.GetWorkspaces)
+	api.GET("/workspaces/:workspace", handlers.GetWorkspace)
+	api.PUT("/workspaces/:workspace", handlers.UpdateWorkspace)
+	api.DELETE("/workspaces/:workspace", handlers.DeleteWorkspace)
+	api.PUT("/workspaces/:workspace/members/:user", handlers.SetWorkspaceMember)
+	api.DELETE("/workspaces/:workspace/members/:user", handlers.RemoveWorkspaceMember)
+	api.POST("/workspaces/:workspace/invitations", handlers.CreateInvitation)
+	api.GET("/workspaces/:workspace/invitations", handlers.GetInvitations)
+	api.DELETE("/workspaces/:workspace/invitations/:invitationId", handlers.DeleteInvitation)
+	api.GET("/workspaces/:workspace/usage", handlers.GetWorkspaceUsage)
+	api.GET("/transfers", handlers.GetTransfers)
+	api.POST("/transfers/:transferId/accept", handlers.AcceptTransfer)
+	api.POST("/transfers/:transferId/decline", handlers.DeclineTransfer)
+	api.DELETE("/transfers/:transferId", handlers.CancelTransfer)
+	api.POST("/invitations/:code/accept", handlers.AcceptInvitation)
+	api.GET("/sandbox", handlers.GetSandbox)
+	api.POST("/sandbox/reset", handlers.ResetSandbox)
+
+	// GraphQL lets clients fetch exactly the fields they need in one request
+	api.Any("/graphql", handlers.ServeScoped(graph.NewHandler(&graph.Resolver{Store: graphStore, AcceptLegacyIDs: cfg.AcceptLegacyIDs})))
+
+	// Read-only API for published notes, e.g. for embedding in static sites
+	public := e.Group("/api/public", auth.RequireScope(handlers.Tokens, auth.ScopeReadPublished))
+	public.GET("/notes", handlers.GetPublicNotes)
+	public.GET("/notes/:id", handlers.GetPublicNote)
+	public.GET("/notebooks/:notebook/feed.atom", handlers.GetNotebookFeed)
+
+	// Calendar apps subscribe to reminders with a read:calendar token
+	e.GET("/api/calendar.ics", handlers.GetCalendar, auth.RequireScope(handlers.Tokens, auth.ScopeReadCalendar))
+
+	// Feed readers follow recent notes with a read:feed token
+	e.GET("/api/feed.atom", handlers.GetRecentFeed, auth.RequireScope(handlers.Tokens, auth.ScopeReadFeed))
+
+	// SLO metrics for Prometheus
+	e.GET("/metrics", slo.Handler(a.slo), auth.RequireSecret(cfg.MetricsToken))
+
+	// The public status page, for teams to check on an instance
+	if cfg.StatusPage {
+		e.GET("/status", handlers.GetStatusPage)
+		e.GET("/status.json", handlers.GetStatusJSON)
+	}
+
+	// Shared notes rendered for iframes
+	e.GET("/embed/:token", handlers.EmbedNote)
+	e.POST("/share/:token/report", handlers.ReportShare)
+	e.GET("/share/:token/feed.atom", handlers.GetSharedNotebookFeed)
+
+	// Moderation and other instance administration, for the admin token
+	// and admin API keys
+	admin := e.Group("/api/admin", auth.RequireRole(handlers.APIKeys, cfg.AdminToken, auth.ScopeAdmin))
+	admin.GET("/reports", handlers.GetReports)
+	admin.POST("/reports/:id/resolve", handlers.ResolveReport)
+	admin.POST("/restore", handlers.RestoreBackup)
+	admin.GET("/jobs/dead", handlers.GetDeadJobs)
+	admin.POST("/jobs/dead/retry", handlers.RetryDeadJobs)
+	admin.POST("/jobs/dead/discard", handlers.DiscardDeadJobs)
+	admin.GET("/users", handlers.GetUsers)
+	admin.POST("/users/:id/disable", handlers.DisableUser)
+	admin.POST("/users/:id/enable", handlers.EnableUser)
+	admin.GET("/stats", handlers.GetInstanceStats)
+	admin.GET("/usage-reports", handlers.GetUsageReports)
+	admin.GET("/cache", handlers.GetCacheStats)
+	admin.GET("/audit", handlers.GetAuditLog)
+	admin.POST("/search/rebuild", handlers.RebuildSearchIndex)
+	admin.GET("/limits", handlers.GetLimits)
+	admin.PUT("/limits", handlers.UpdateLimits)
+	admin.GET("/email/templates", handlers.GetEmailTemplates)
+	admin.GET("/email/templates/:name/preview", handlers.PreviewEmailTemplate)
+	admin.POST("/email/test", handlers.SendTestEmail)
+	admin.GET("/workspaces/:workspace/quotas", handlers.GetWorkspaceQuotas)
+	admin.PUT("/workspaces/:workspace/quotas", handlers.UpdateWorkspaceQuotas)
+	admin.GET("/incidents", handlers.GetIncidents)
+	admin.POST("/incidents", handlers.CreateIncident)
+	admin.PATCH("/incidents/:id", handlers.UpdateIncident)
+	admin.DELETE("/incidents/:id", handlers.DeleteIncident)
+
+	// The web app, when it was built into the binary. Its client routes
+	// fall back to index.html, but unknown API paths stay errors.
+	if dist, ok := frontend.Dist(); ok {
+		e.GET("/*", spa.Handler(dist, "/api/", "/embed/", "/share/"))
+	}
+}
+
+// graphStore is the store of a GraphQL request, which ServeScoped put in
+// its context
+func graphStore(ctx context.Context) (graph.Store, error) {
+	return handlers.StoreFrom(ctx)
+}
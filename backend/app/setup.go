@@ -0,0 +1,425 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/crypto/acme/autocert"
+	"note/backend/audit"
+	"note/backend/auth"
+	"note/backend/backup"
+	"note/backend/chaos"
+	"note/backend/config"
+	"note/backend/email"
+	"note/backend/encryption"
+	"note/backend/eventsink"
+	"note/backend/export"
+	"note/backend/handlers"
+	"note/backend/idcodec"
+	"note/backend/ingest"
+	"note/backend/jobs"
+	"note/backend/metering"
+	"note/backend/migrate"
+	"note/backend/notify"
+	"note/backend/publish"
+	"note/backend/ratelimit"
+	"note/backend/related"
+	"note/backend/reminder"
+	"note/backend/rpc"
+	"note/backend/search"
+	"note/backend/security"
+	"note/backend/slo"
+)
+
+// setup configures the handlers, registers the components in the order
+// they depend on each other and adds the routes
+func (a *App) setup() error {
+	cfg, e := a.cfg, a.echo
+
+	// Client addresses come from X-Forwarded-For only behind a trusted
+	// proxy; anyone can send the header
+	proxies, err := cfg.TrustedProxyRanges()
+	if err != nil {
+		return err
+	}
+	if len(proxies) == 0 {
+		e.IPExtractor = echo.ExtractIPDirect()
+	} else {
+		trust := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+		for _, r := range proxies {
+			trust = append(trust, echo.TrustIPRange(r))
+		}
+		e.IPExtractor = echo.ExtractIPFromXFFHeader(trust...)
+	}
+
+	// Middleware
+	e.Use(security.Logger())
+	a.slo = slo.New(slo.Objectives{
+		Availability: cfg.SLO.Availability,
+		Latency:      cfg.SLO.Latency.Duration,
+		Routes:       cfg.SLO.Routes,
+	})
+	e.Use(slo.Middleware(a.slo))
+	e.Use(middleware.Recover())
+	e.Use(security.CORS(cfg.CORS))
+	e.Use(security.Headers(security.DefaultPolicies().Merge(cfg.SecurityHeaders)))
+	e.Use(chaos.Middleware(cfg.Faults))
+	e.Use(security.CSRF(cfg.CSRF, func(secret string) bool {
+		_, err := auth.Authenticate(handlers.APIKeys, cfg.AdminToken, secret)
+		return err == nil
+	}))
+	e.Use(metering.Middleware(handlers.Meter, handlers.MeterIdentity))
+	e.Use(ratelimit.Middleware(ratelimit.DefaultPolicy().Merge(cfg.RateLimits), ratelimit.ByToken(cfg.AdminToken, handlers.Tokens, handlers.APIKeys)))
+
+	// The audit log is kept in memory only until it has a file
+	if cfg.AuditFile != "" {
+		auditLog, err := audit.Open(cfg.AuditFile)
+		if err != nil {
+			return fmt.Errorf("opening audit log: %w", err)
+		}
+		handlers.Audit = auditLog
+	}
+
+	// Long-lived API keys survive restarts once they have a file
+	if cfg.APIKeysFile != "" {
+		if err := handlers.APIKeys.Persist(cfg.APIKeysFile); err != nil {
+			return fmt.Errorf("loading API keys: %w", err)
+		}
+	}
+	sameSite, err := cfg.CSRF.SameSiteMode()
+	if err != nil {
+		return err
+	}
+	handlers.APIKeys.Sessions = auth.NewSessions(cfg.CSRF.SessionCookie, cfg.CSRF.Secure, sameSite)
+
+	// Integer note IDs keep working until the transition is switched off
+	handlers.AcceptLegacyIDs = cfg.AcceptLegacyIDs
+	handlers.InboxNotebook = cfg.InboxNotebook
+	handlers.Sanitization = cfg.Sanitize
+	handlers.StripImageLocation = cfg.StripImageLocation
+	if cfg.PublicIDKey != "" {
+		codec, err := idcodec.NewHashid(cfg.PublicIDKey)
+		if err != nil {
+			return fmt.Errorf("invalid public ID key: %w", err)
+		}
+		handlers.PublicIDs = codec
+	}
+	handlers.SetCacheSize(cfg.CacheSize)
+	handlers.Review = handlers.ReviewSettings{
+		After:           cfg.ReviewAfter.Duration,
+		Batch:           cfg.ReviewBatch,
+		ArchiveNotebook: cfg.ArchiveNotebook,
+	}
+	handlers.Limits = handlers.InstanceLimits{
+		MaxNotes:     cfg.MaxNotes,
+		MaxNoteSize:  cfg.MaxNoteSize,
+		MaxAPIKeys:   cfg.MaxAPIKeys,
+		PerUser:      handlers.Quota(cfg.Quota),
+		PerWorkspace: cfg.WorkspaceQuotas,
+		Attachments: handlers.AttachmentPolicy{
+			AllowedTypes: cfg.AttachmentTypes,
+			MaxSize:      cfg.MaxAttachmentSize,
+		},
+	}
+	if err := handlers.Limits.Attachments.Validate(); err != nil {
+		return fmt.Errorf("invalid attachment policy: %w", err)
+	}
+
+	// In-app notifications are always available; other channels register
+	// their notifiers here once configured
+	handlers.Notifications.Register(notify.ChannelInApp, handlers.Inbox)
+	handlers.Webhooks.Admit = handlers.AdmitWebhookDelivery
+	handlers.Notifications.Register(notify.ChannelSubscriptions, handlers.Webhooks)
+	if cfg.WebhookURL != "" {
+		handlers.Notifications.Register(notify.ChannelWebhook, notify.NewWebhookNotifier(cfg.WebhookURL))
+	}
+	templates, err := email.Load(cfg.EmailTemplatesDir, cfg.EmailBrand)
+	if err != nil {
+		return fmt.Errorf("loading email templates: %w", err)
+	}
+	handlers.EmailTemplates = templates
+	if cfg.SMTPAddr != "" && len(cfg.EmailTo) > 0 {
+		handlers.Email = &notify.EmailNotifier{
+			Addr:      cfg.SMTPAddr,
+			Username:  cfg.SMTPUsername,
+			Password:  cfg.SMTPPassword,
+			From:      cfg.SMTPFrom,
+			To:        cfg.EmailTo,
+			Templates: templates,
+		}
+		handlers.Notifications.Register(notify.ChannelEmail, handlers.Email)
+	}
+
+	// Data written to disk is encrypted once keys are configured
+	if cfg.EncryptionKeys != "" {
+		keys, err := encryption.ParseKeyring(cfg.EncryptionKeys)
+		if err != nil {
+			return fmt.Errorf("invalid encryption keys: %w", err)
+		}
+		backup.Keys = keys
+		// Workspace data keys are opened whenever keys are configured, so
+		// backups sealed with them restore after turning it off. Unwrapped
+		// keys are cached for up to 1024 workspaces.
+		backup.DataKeys = encryption.NewDataKeys(keys, 1024)
+		backup.SealWorkspaces = cfg.EncryptWorkspaces
+	}
+	if cfg.ExportSigningKey != "" {
+		key, err := export.ParseSigningKey(cfg.ExportSigningKey)
+		if err != nil {
+			return fmt.Errorf("invalid export signing key: %w", err)
+		}
+		handlers.ExportSigningKey = key
+	}
+
+	// The schema is brought up to date before anything uses the database;
+	// migrations rewriting rows carry on in the background after that
+	if cfg.Database.MigrateOnStart {
+		a.Register(Hooks("migrations", func(ctx context.Context) error {
+			return migrateDatabase(ctx, cfg.Database)
+		}, nil))
+		a.Register(Loop("background migrations", func(ctx context.Context) {
+			if err := migrateInBackground(ctx, cfg.Database); err != nil && ctx.Err() == nil {
+				log.Printf("background migrations: %v", err)
+			}
+			<-ctx.Done() // done isn't down
+		}))
+	}
+
+	// Backups are opt-in: restore the last state on start, then keep
+	// writing incremental backups in the background
+	if storage := backupStorage(cfg); storage != nil {
+		schedule := backup.Every(cfg.BackupInterval.Duration)
+		if cfg.BackupSchedule != "" {
+			schedule, _ = backup.ParseSchedule(cfg.BackupSchedule) // checked by Validate
+		}
+		handlers.Backups = storage
+		a.Register(newBackups(storage, schedule, cfg.BackupFullEvery))
+	}
+
+	// Build the search index once the notes are in; until then searches
+	// fall back to substring matching
+	handlers.SearchIndex.SetLanguage(cfg.SearchLanguage)
+	a.Register(Checked(Hooks("search index", func(context.Context) error {
+		go handlers.RebuildSearch()
+		return nil
+	}, nil), checkSearchIndex))
+
+	// Digests still pending go out when the app stops, after everything
+	// that notifies has stopped
+	a.Register(Hooks("notifications", nil, func(context.Context) error {
+		handlers.Notifications.Flush()
+		return nil
+	}))
+
+	// Exports, restores, webhook deliveries and due notifications run as
+	// background jobs, kept in Redis once it is configured
+	if cfg.RedisURL != "" {
+		store, err := jobs.NewRedisStore(cfg.RedisURL)
+		if err != nil {
+			return fmt.Errorf("connecting to Redis: %w", err)
+		}
+		handlers.Jobs = jobs.New(store)
+	}
+	handlers.RegisterJobs()
+	a.Register(Loop("job workers", func(ctx context.Context) {
+		handlers.Jobs.Run(ctx, cfg.JobWorkers)
+		<-ctx.Done()
+		handlers.Jobs.Wait()
+	}))
+
+	a.Register(Loop("storage metering", func(ctx context.Context) {
+		handlers.MeterStorage(ctx, time.Hour)
+	}))
+	a.Register(Loop("review", func(ctx context.Context) {
+		handlers.ResurfaceNotes(ctx, cfg.ReviewInterval.Duration)
+	}))
+	a.Register(Loop("reminders", func(ctx context.Context) {
+		reminder.Run(ctx, handlers.Reminders{}, handlers.QueuedNotifications{}, cfg.ReminderInterval.Duration)
+	}))
+	a.Register(Loop("publishing", func(ctx context.Context) {
+		publish.Run(ctx, handlers.Publications{}, handlers.QueuedNotifications{}, cfg.PublishInterval.Duration)
+	}))
+	if cfg.Sandbox {
+		handlers.SandboxEnabled = true
+		schedule, _ := backup.ParseSchedule(cfg.SandboxReset) // checked by Validate
+		a.Register(Loop("sandbox reset", func(ctx context.Context) {
+			handlers.ResetSandboxes(ctx, schedule)
+		}))
+	}
+
+	// Related notes compare meaning too once notes are embedded
+	if cfg.Embeddings.URL != "" {
+		handlers.Embeddings = related.NewHTTPEmbedder(cfg.Embeddings.URL, cfg.Embeddings.Model, cfg.Embeddings.APIKey)
+		a.Register(Loop("embeddings", func(ctx context.Context) {
+			handlers.EmbedNotes(ctx, cfg.Embeddings.Interval.Duration)
+		}))
+	}
+
+	// Every change from startup on goes to the event sink, if there is one
+	if cfg.EventSink.URL != "" {
+		pub, err := eventsink.Open(cfg.EventSink.URL)
+		if err != nil {
+			return fmt.Errorf("connecting to the event sink: %w", err)
+		}
+		a.Register(Loop("event sink", func(ctx context.Context) {
+			eventsink.Run(ctx, handlers.PublishedChanges{}, pub, eventsink.Topic(cfg.EventSink.Topic))
+			pub.Close()
+		}))
+	}
+
+	// Emails to ingest addresses become notes
+	if cfg.IngestAddr != "" {
+		handlers.IngestDomain = cfg.IngestDomain
+		a.registerServer(&ingestServer{
+			addr: cfg.IngestAddr,
+			srv:  &ingest.Server{Domain: cfg.IngestDomain, Mailbox: handlers.Mailbox{}},
+			app:  a,
+		})
+	}
+
+	// The gRPC API serves the same notes for internal services and CLIs
+	if cfg.GRPCAddr != "" {
+		a.registerServer(&grpcServer{
+			addr: cfg.GRPCAddr,
+			srv:  rpc.NewGRPCServer(&rpc.Server{Store: grpcStore(cfg), AcceptLegacyIDs: handlers.AcceptLegacyIDs}),
+			app:  a,
+		})
+	}
+
+	// Certificates are fetched once the server runs
+	if t := cfg.TLS; len(t.AutoDomains) > 0 {
+		e.AutoTLSManager.Prompt = autocert.AcceptTOS
+		e.AutoTLSManager.HostPolicy = autocert.HostWhitelist(t.AutoDomains...)
+		e.AutoTLSManager.Cache = autocert.DirCache(t.CacheDir)
+		e.AutoTLSManager.Email = t.AutoEmail
+	}
+	handlers.Health = a.Health
+	handlers.StatusTitle = cfg.StatusTitle
+	a.routes()
+	if !a.embedded {
+		a.registerServer(&httpServer{app: a})
+	}
+	return nil
+}
+
+// migrateDatabase applies the migrations the database is missing
+func migrateDatabase(ctx context.Context, db config.Database) error {
+	m, err := migrate.Open(db.Driver, db.URL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	done, err := m.Up(ctx)
+	for _, migration := range done {
+		log.Printf("applied migration %s", migration)
+	}
+	return err
+}
+
+// migrateInBackground runs the background migrations until they are done,
+// logging every tenth of the way
+func migrateInBackground(ctx context.Context, db config.Database) error {
+	m, err := migrate.Open(db.Driver, db.URL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	logged := map[string]int{}
+	return m.RunBackground(ctx, migrate.DefaultBatch, func(p migrate.Progress) {
+		if tenth := int(p.Percent() / 10); tenth > logged[p.Name] {
+			logged[p.Name] = tenth
+			log.Printf("background migration %s: %.0f%% (%d of %d rows)", p.Name, p.Percent(), p.Done, p.Total)
+		}
+	})
+}
+
+// backupStorage returns where backups go, or nil if they are off
+func backupStorage(cfg *config.Config) backup.Storage {
+	if s3 := cfg.BackupS3; s3.Bucket != "" {
+		return &backup.S3{
+			Bucket:       s3.Bucket,
+			Region:       s3.Region,
+			Prefix:       s3.Prefix,
+			Endpoint:     s3.Endpoint,
+			PathStyle:    s3.PathStyle,
+			AccessKey:    s3.AccessKey,
+			SecretKey:    s3.SecretKey,
+			SessionToken: s3.SessionToken,
+		}
+	}
+	if cfg.BackupDir != "" {
+		return backup.Dir(cfg.BackupDir)
+	}
+	return nil
+}
+
+// serve serves HTTP, or HTTPS once TLS is configured. It blocks until
+// the server is shut down.
+func (a *App) serve() error {
+	e, cfg := a.echo, a.cfg
+	t := cfg.TLS
+	switch {
+	case !t.Enabled():
+		return e.Start(cfg.Addr)
+	case len(t.AutoDomains) > 0:
+		return e.StartAutoTLS(cfg.Addr)
+	}
+	return e.StartTLS(cfg.Addr, t.CertFile, t.KeyFile)
+}
+
+// redirectServer returns the server sending plain HTTP to HTTPS, which
+// also answers the challenges of automatic certificates, or nil when
+// there is none
+func (a *App) redirectServer() *http.Server {
+	t := a.cfg.TLS
+	if !t.Enabled() || t.RedirectAddr == "" {
+		return nil
+	}
+	redirect := redirectToHTTPS(a.cfg.Addr)
+	if len(t.AutoDomains) > 0 {
+		redirect = a.echo.AutoTLSManager.HTTPHandler(redirect)
+	}
+	return &http.Server{Addr: t.RedirectAddr, Handler: redirect, ReadHeaderTimeout: 10 * time.Second}
+}
+
+// redirectToHTTPS sends requests to the same URL on the HTTPS address
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// checkSearchIndex reports the search index degraded while it is rebuilt,
+// when searches match substrings instead, and down when it failed to
+// build
+func checkSearchIndex(context.Context) error {
+	switch st := handlers.SearchIndex.Status(); st.State {
+	case search.Rebuilding:
+		return errors.New("rebuilding")
+	case search.Down:
+		return Outage(st.LastError)
+	}
+	return nil
+}
+
+// grpcStore authenticates gRPC callers like the private REST API does
+func grpcStore(cfg *config.Config) func(secret, workspace string) (rpc.Store, error) {
+	return func(secret, workspace string) (rpc.Store, error) {
+		return handlers.StoreFor(secret, workspace, cfg.RequireAPIKeys, cfg.AdminToken, "grpc")
+	}
+}
@@ -0,0 +1,145 @@
+// Package audit keeps an append-only record of who changed which note
+// and when. Entries are never changed or removed once written.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	Create   = "create"
+	Update   = "update"
+	Delete   = "delete"
+	Share    = "share"
+	Unshare  = "unshare"
+	Merge    = "merge"
+	Move     = "move"
+	Replace  = "replace"
+	Moderate = "moderate"
+	Relate   = "relate"
+	Unrelate = "unrelate"
+	Transfer = "transfer"
+	Trash    = "trash"
+	Restore  = "restore"
+)
+
+// Actors that aren't API keys
+const (
+	Anonymous = "anonymous" // requests without a key while keys are optional
+	System    = "system"    // background work like reminders
+)
+
+// Entry is one recorded action
+type Entry struct {
+	Seq    int64     `json:"seq"`
+	At     time.Time `json:"at"`
+	Actor  string    `json:"actor"` // API key ID, "admin" or one of the actors above
+	Action string    `json:"action"`
+	NoteID string    `json:"note_id"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Filter selects entries. Zero fields don't filter.
+type Filter struct {
+	NoteID string
+	Actor  string
+	Action string
+	Since  time.Time // inclusive
+	Until  time.Time // exclusive
+	Limit  int
+}
+
+func (f Filter) match(e Entry) bool {
+	return (f.NoteID == "" || e.NoteID == f.NoteID) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Since.IsZero() || !e.At.Before(f.Since)) &&
+		(f.Until.IsZero() || e.At.Before(f.Until))
+}
+
+// Log is safe for concurrent use. Without a file it only lives in memory.
+type Log struct {
+	mu      sync.Mutex
+	entries []Entry
+	file    *os.File
+}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+// Open reads the entries in path, if it exists, and appends every later
+// entry to it
+func Open(path string) (*Log, error) {
+	l := NewLog()
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for line := 1; scanner.Scan(); line++ {
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			l.entries = append(l.entries, e)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends an entry. It is kept in memory even if writing it to
+// the file fails.
+func (l *Log) Record(actor, action, noteID, detail string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := Entry{Seq: 1, At: time.Now(), Actor: actor, Action: action, NoteID: noteID, Detail: detail}
+	if n := len(l.entries); n > 0 {
+		e.Seq = l.entries[n-1].Seq + 1
+	}
+	l.entries = append(l.entries, e)
+	if l.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// Query returns the matching entries, newest first
+func (l *Log) Query(f Filter) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	found := []Entry{}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if f.Limit > 0 && len(found) == f.Limit {
+			break
+		}
+		if f.match(l.entries[i]) {
+			found = append(found, l.entries[i])
+		}
+	}
+	return found
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const tokenKey = "auth.token"
+
+// AdminTokenID is the ID of the token FromContext returns for requests
+// made with the admin token
+const AdminTokenID = "admin"
+
+// RequireScope only lets requests through that carry a token with the
+// given scope, either as "Authorization: Bearer <token>" or as ?token=
+// for clients like static sites that can't set headers.
+func RequireScope(store *TokenStore, scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			secret := BearerToken(c.Request())
+			if secret == "" {
+				secret = c.QueryParam("token")
+			}
+			token, err := store.Lookup(secret)
+			if err != nil || token.Scope != scope {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or missing token"})
+			}
+			c.Set(tokenKey, token)
+			return next(c)
+		}
+	}
+}
+
+// FromContext returns the token RequireScope, RequireAPIKey or RequireRole
+// accepted for this request
+func FromContext(c echo.Context) (Token, bool) {
+	token, ok := c.Get(tokenKey).(Token)
+	return token, ok
+}
+
+// BearerToken extracts the token from an Authorization header
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get(echo.HeaderAuthorization)
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// RequireAPIKey authenticates requests to the private API by API key.
+// Read keys may only make safe requests, and disabled keys none. The admin token is accepted as
+// well so the first keys can be created, and so are the session cookies
+// of browsers that logged in with either. Unless required is set,
+// requests without any key are let through, which keeps the API open
+// until keys are rolled out.
+func RequireAPIKey(store *TokenStore, required bool, adminSecret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if BearerToken(c.Request()) == "" && !required {
+				if _, err := sessionKey(c, store, adminSecret); errors.Is(err, errNoSession) {
+					return next(c)
+				}
+			}
+			key, code, msg := authenticate(c, store, adminSecret)
+			if code != 0 {
+				return c.JSON(code, map[string]string{"error": msg})
+			}
+			if !key.HasRole(ScopeReadWrite) && !safeMethod(c.Request().Method) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "API key is read-only"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireRole only lets requests through with the admin token or an API
+// key whose scope grants at least role
+func RequireRole(store *TokenStore, adminSecret, role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key, code, msg := authenticate(c, store, adminSecret)
+			if code != 0 {
+				return c.JSON(code, map[string]string{"error": msg})
+			}
+			if !key.HasRole(role) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "API key needs the " + role + " role"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireSecret only lets requests through that bring secret as their
+// bearer token. An empty secret lets every request through.
+func RequireSecret(secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if secret != "" && subtle.ConstantTimeCompare([]byte(BearerToken(c.Request())), []byte(secret)) != 1 {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or missing token"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// authenticate looks up the bearer token of the request, or without one
+// the key its session acts for, and stores it in the context. When it
+// fails, it returns the status and error message to respond with.
+func authenticate(c echo.Context, store *TokenStore, adminSecret string) (Token, int, string) {
+	var key Token
+	var err error
+	if secret := BearerToken(c.Request()); secret != "" {
+		key, err = Authenticate(store, adminSecret, secret)
+	} else if key, err = sessionKey(c, store, adminSecret); errors.Is(err, errNoSession) {
+		return Token{}, http.StatusUnauthorized, "API key required"
+	}
+	switch {
+	case errors.Is(err, ErrDisabledToken):
+		return Token{}, http.StatusForbidden, "API key is disabled"
+	case err != nil:
+		return Token{}, http.StatusUnauthorized, "Invalid API key"
+	}
+	c.Set(tokenKey, key)
+	return key, 0, ""
+}
+
+// Authenticate returns the API key of a secret, for APIs outside of HTTP
+// like gRPC. The admin token stands for an admin key.
+func Authenticate(store *TokenStore, adminSecret, secret string) (Token, error) {
+	if adminSecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(adminSecret)) == 1 {
+		return Token{ID: AdminTokenID, Name: "Admin token", Scope: ScopeAdmin}, nil
+	}
+	key, err := store.Lookup(secret)
+	if err != nil {
+		return Token{}, err
+	}
+	if !key.HasRole(ScopeRead) {
+		return Token{}, ErrInvalidToken
+	}
+	return key, nil
+}
+
+var errNoSession = errors.New("no session")
+
+// sessionKey returns the key the session of a request acts for
+func sessionKey(c echo.Context, store *TokenStore, adminSecret string) (Token, error) {
+	if store.Sessions == nil {
+		return Token{}, errNoSession
+	}
+	id, ok := store.Sessions.keyID(c.Request())
+	switch {
+	case !ok:
+		return Token{}, errNoSession
+	case id == AdminTokenID && adminSecret != "":
+		return Token{ID: AdminTokenID, Name: "Admin token", Scope: ScopeAdmin}, nil
+	case id == AdminTokenID:
+		return Token{}, ErrInvalidToken
+	}
+	key, err := store.byID(id)
+	if err == nil && !key.HasRole(ScopeRead) {
+		err = ErrInvalidToken
+	}
+	return key, err
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionTTL is how long a browser session lasts after it started
+const SessionTTL = 7 * 24 * time.Hour
+
+// Sessions let browsers authenticate with a cookie instead of a bearer
+// token. Logging in with an API key or the admin token starts a session
+// acting for that key until it ends, expires or the key is revoked or
+// disabled. Only hashes of the session IDs are kept.
+type Sessions struct {
+	// Cookie names the session cookie; Secure and SameSite apply to it
+	Cookie   string
+	Secure   bool
+	SameSite http.SameSite
+
+	mu       sync.Mutex
+	sessions map[string]session // by hash
+}
+
+type session struct {
+	keyID   string
+	expires time.Time
+}
+
+func NewSessions(cookie string, secure bool, sameSite http.SameSite) *Sessions {
+	return &Sessions{Cookie: cookie, Secure: secure, SameSite: sameSite, sessions: map[string]session{}}
+}
+
+// Start starts a session for key and returns the cookie that carries it
+func (s *Sessions) Start(key Token) (*http.Cookie, error) {
+	id, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, h)
+		}
+	}
+	s.sessions[hash(id)] = session{keyID: key.ID, expires: now.Add(SessionTTL)}
+	return s.cookie(id, now.Add(SessionTTL)), nil
+}
+
+// End ends the session of the request, if it has one, and returns the
+// cookie that clears it
+func (s *Sessions) End(r *http.Request) *http.Cookie {
+	if c, err := r.Cookie(s.Cookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, hash(c.Value))
+		s.mu.Unlock()
+	}
+	return s.cookie("", time.Unix(0, 0))
+}
+
+// keyID returns the ID of the key the session of a request acts for
+func (s *Sessions) keyID(r *http.Request) (string, bool) {
+	c, err := r.Cookie(s.Cookie)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[hash(c.Value)]
+	if !ok || time.Now().After(sess.expires) {
+		return "", false
+	}
+	return sess.keyID, true
+}
+
+func (s *Sessions) cookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.Cookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.Secure,
+		SameSite: s.SameSite,
+	}
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scopes a token can carry
+const (
+	// ScopeReadPublished only allows reading published notes, which makes
+	// the token safe to ship inside a static site.
+	ScopeReadPublished = "read:published"
+
+	// ScopeReadCalendar only allows reading the calendar feed of reminders
+	ScopeReadCalendar = "read:calendar"
+
+	// ScopeReadFeed only allows reading the Atom feed of recent notes
+	ScopeReadFeed = "read:feed"
+
+	// API keys for the private API, from least to most privileged. Read
+	// keys may only make safe requests like GET, read-write keys may do
+	// anything but administer the instance, which takes an admin key.
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+	ScopeAdmin     = "admin"
+)
+
+var roleRank = map[string]int{ScopeRead: 1, ScopeReadWrite: 2, ScopeAdmin: 3}
+
+var (
+	// ErrInvalidToken is returned for unknown or revoked tokens
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrDisabledToken is returned for tokens an admin has disabled
+	ErrDisabledToken = errors.New("token disabled")
+)
+
+// Token is an API token. The secret itself is only known at creation
+// time, the store keeps its SHA-256 hash.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scope     string    `json:"scope"`
+	Notebook  string    `json:"notebook,omitempty"`  // empty means every notebook
+	Owner     string    `json:"owner,omitempty"`     // API key that created it, whose notes feeds show
+	Workspace string    `json:"workspace,omitempty"` // workspace it was created in, the only one it reads
+	CreatedAt time.Time `json:"created_at"`
+	Disabled  bool      `json:"disabled,omitempty"`
+	hash      string
+}
+
+// HasRole reports whether the token is an API key whose scope grants at
+// least role, one of the API key scopes
+func (t Token) HasRole(role string) bool {
+	rank, ok := roleRank[t.Scope]
+	return ok && rank >= roleRank[role]
+}
+
+// TokenStore keeps issued tokens in memory, and in a file once one is
+// attached with Persist
+type TokenStore struct {
+	// Sessions, when set, authenticate browsers that logged in with one
+	// of the store's keys by their session cookie
+	Sessions *Sessions
+
+	mu     sync.Mutex
+	tokens map[string]*Token // by hash
+	file   string
+}
+
+func NewTokenStore() *TokenStore {
+	return &TokenStore{tokens: make(map[string]*Token)}
+}
+
+// Create issues a new token and returns it together with its secret
+func (s *TokenStore) Create(name, scope, notebook, owner, workspace string) (Token, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Token{}, "", err
+	}
+	token := &Token{
+		ID:        id,
+		Name:      name,
+		Scope:     scope,
+		Notebook:  notebook,
+		Owner:     owner,
+		Workspace: workspace,
+		CreatedAt: time.Now(),
+		hash:      hash(secret),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.hash] = token
+	if err := s.save(); err != nil {
+		delete(s.tokens, token.hash)
+		return Token{}, "", err
+	}
+	return *token, secret, nil
+}
+
+// Lookup finds the token a secret belongs to
+func (s *TokenStore) Lookup(secret string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash(secret)]
+	if !ok {
+		return Token{}, ErrInvalidToken
+	}
+	if token.Disabled {
+		return *token, ErrDisabledToken
+	}
+	return *token, nil
+}
+
+// byID finds a token by ID, with the errors of Lookup
+func (s *TokenStore) byID(id string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.ID == id {
+			if token.Disabled {
+				return *token, ErrDisabledToken
+			}
+			return *token, nil
+		}
+	}
+	return Token{}, ErrInvalidToken
+}
+
+// SetDisabled disables or re-enables a token by ID. A disabled token is
+// kept, but Lookup refuses it. It reports false if there is no such token.
+func (s *TokenStore) SetDisabled(id string, disabled bool) (Token, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.ID == id {
+			token.Disabled = disabled
+			return *token, true, s.save()
+		}
+	}
+	return Token{}, false, nil
+}
+
+// List returns every token, oldest first
+func (s *TokenStore) List() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Token, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		list = append(list, *token)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Revoke deletes a token by ID and reports whether it existed
+func (s *TokenStore) Revoke(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, token := range s.tokens {
+		if token.ID == id {
+			delete(s.tokens, h)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// storedToken is a token as written to the store's file
+type storedToken struct {
+	Token
+	Hash string `json:"hash"`
+}
+
+// Persist loads the tokens saved in path, if it exists, and saves every
+// later change there. Only hashes of the secrets are written.
+func (s *TokenStore) Persist(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var stored []storedToken
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, st := range stored {
+			token := st.Token
+			token.hash = st.Hash
+			s.tokens[token.hash] = &token
+		}
+	}
+	s.file = path
+	return nil
+}
+
+// save writes every token to the file, if there is one. Callers must hold mu.
+func (s *TokenStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+	stored := make([]storedToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		stored = append(stored, storedToken{Token: *token, Hash: token.hash})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].CreatedAt.Before(stored[j].CreatedAt) })
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,515 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"note/backend/encryption"
+	"note/backend/models"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoBackup is returned by Restore when there is nothing to restore from
+var ErrNoBackup = errors.New("no base backup found")
+
+// Keys encrypts backup files at rest when set. Files written without
+// encryption stay readable after it is turned on.
+var Keys *encryption.Keyring
+
+// DataKeys opens the notes of workspaces sealed with their own data key.
+// With SealWorkspaces set, backups seal them so too: then a backup, even
+// with its file decrypted, only gives up the notes of a workspace to
+// someone holding its data key.
+var (
+	DataKeys       *encryption.DataKeys
+	SealWorkspaces bool
+)
+
+// Source is where backups read notes, changes and what hangs off the
+// notes from
+type Source interface {
+	Snapshot() ([]models.Note, int64)
+	ChangesSince(seq int64) []models.Change
+	// State returns what hangs off the notes by their workspace
+	State() map[string]State
+}
+
+// State is what hangs off the notes of a workspace
+type State struct {
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	Relations   []models.Relation `json:"relations,omitempty"`
+	Shares      []Share           `json:"shares,omitempty"`
+	Positions   []Position        `json:"positions,omitempty"`
+	Reviews     []Review          `json:"reviews,omitempty"`
+}
+
+// Attachment is an attachment with its file. The file is kept in a file
+// of its own, written once, since attachments never change.
+type Attachment struct {
+	models.Attachment
+	Data []byte `json:"-"`
+}
+
+// Share is a share with who it belongs to, which the API never shows
+type Share struct {
+	models.Share
+	Owner     string `json:"owner,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// Position is where the holder of an API key ("" without one) left off
+// reading a note
+type Position struct {
+	NoteID string `json:"note_id"`
+	Key    string `json:"key,omitempty"`
+	models.ReadingPosition
+}
+
+// Review is when a note was last reviewed
+type Review struct {
+	NoteID     string    `json:"note_id"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+}
+
+// Base is a full dump of every note and its state as of Seq. Notes and
+// state of workspaces sealed with their data key are in Workspaces and
+// States instead.
+type Base struct {
+	Seq        int64            `json:"seq"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Notes      []models.Note    `json:"notes"`
+	State      map[string]State `json:"state,omitempty"`
+	Workspaces []Sealed         `json:"workspaces,omitempty"`
+	States     []Sealed         `json:"states,omitempty"`
+}
+
+// Increment holds the changes with sequence From through To, and the
+// state of the notes as of To. Changes of notes in workspaces sealed with
+// their data key are in Workspaces instead, but for deletes, which only
+// hold the ID of the note, and their state in States. An increment
+// without changes, From past To, only has newer state.
+type Increment struct {
+	From       int64            `json:"from"`
+	To         int64            `json:"to"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Changes    []models.Change  `json:"changes"`
+	State      map[string]State `json:"state,omitempty"`
+	Workspaces []Sealed         `json:"workspaces,omitempty"`
+	States     []Sealed         `json:"states,omitempty"`
+}
+
+// Sealed is the JSON of the notes or changes of a workspace, sealed with
+// its data key, and that key wrapped by the master key
+type Sealed struct {
+	Workspace string `json:"workspace"`
+	Key       []byte `json:"key"`
+	Data      []byte `json:"data"`
+}
+
+// File names sort by sequence so a directory listing is already in
+// restore order.
+func baseName(seq int64) string {
+	return fmt.Sprintf("base-%020d.json", seq)
+}
+
+func incrementName(from, to int64) string {
+	return fmt.Sprintf("incr-%020d-%020d.json", from, to)
+}
+
+func attachmentName(id string) string {
+	return "attachment-" + id + ".json"
+}
+
+// Take writes one backup into dst. A full base is written when dst has
+// none yet or when fullEvery increments have piled up since the last one,
+// otherwise only the changes since the previous backup are written.
+func Take(dst Storage, src Source, fullEvery int) error {
+	base, increments, err := list(dst)
+	if err != nil {
+		return err
+	}
+
+	if base == nil || len(increments) >= fullEvery {
+		return writeBase(dst, src)
+	}
+
+	covered, last := base.Seq, base.State
+	if len(increments) > 0 {
+		covered, last = increments[len(increments)-1].To, increments[len(increments)-1].State
+	}
+	changes := src.ChangesSince(covered)
+	state := src.State()
+	if len(changes) == 0 && sameState(state, last) {
+		return nil // nothing happened since the last backup
+	}
+	if len(changes) > 0 && changes[0].Seq != covered+1 {
+		// The change log no longer reaches back to the last backup
+		// (e.g. after a restart), so only a full dump is consistent.
+		return writeBase(dst, src)
+	}
+	if err := writeAttachments(dst, state); err != nil {
+		return err
+	}
+
+	inc := Increment{
+		From:      covered + 1,
+		To:        covered,
+		CreatedAt: time.Now(),
+		Changes:   changes,
+		State:     state,
+	}
+	if len(changes) > 0 {
+		inc.To = changes[len(changes)-1].Seq
+	}
+	if SealWorkspaces {
+		byWorkspace := map[string][]models.Change{}
+		inc.Changes = nil
+		for _, change := range changes {
+			if change.Note == nil {
+				inc.Changes = append(inc.Changes, change)
+			} else {
+				byWorkspace[change.Note.Workspace] = append(byWorkspace[change.Note.Workspace], change)
+			}
+		}
+		if inc.Workspaces, err = seal(byWorkspace); err != nil {
+			return err
+		}
+		if inc.States, err = sealState(state); err != nil {
+			return err
+		}
+		inc.State = nil
+	}
+	return writeJSON(dst, incrementName(inc.From, inc.To), inc)
+}
+
+// writeBase writes a full dump of the notes in src and their state
+func writeBase(dst Storage, src Source) error {
+	notes, seq := src.Snapshot()
+	state := src.State()
+	if err := writeAttachments(dst, state); err != nil {
+		return err
+	}
+	base := Base{Seq: seq, CreatedAt: time.Now(), Notes: notes, State: state}
+	if SealWorkspaces {
+		byWorkspace := map[string][]models.Note{}
+		for _, note := range notes {
+			byWorkspace[note.Workspace] = append(byWorkspace[note.Workspace], note)
+		}
+		var err error
+		if base.Workspaces, err = seal(byWorkspace); err != nil {
+			return err
+		}
+		if base.States, err = sealState(state); err != nil {
+			return err
+		}
+		base.Notes, base.State = nil, nil
+	}
+	return writeJSON(dst, baseName(seq), base)
+}
+
+// writeAttachments writes the file of every attachment in state that
+// dst doesn't have yet, sealed with the data key of its workspace when
+// workspaces are sealed
+func writeAttachments(dst Storage, state map[string]State) error {
+	names, err := dst.List()
+	if err != nil {
+		return err
+	}
+	have := map[string]bool{}
+	for _, name := range names {
+		have[name] = true
+	}
+	for ws, st := range state {
+		for _, a := range st.Attachments {
+			name := attachmentName(a.ID)
+			if have[name] {
+				continue
+			}
+			file := Sealed{Workspace: ws, Data: a.Data}
+			if SealWorkspaces {
+				if DataKeys == nil {
+					return errors.New("sealing workspaces needs encryption keys")
+				}
+				if file.Data, file.Key, err = DataKeys.Seal(ws, a.Data); err != nil {
+					return err
+				}
+			}
+			if err := writeJSON(dst, name, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readAttachments reads the files of the attachments in state
+func readAttachments(src Storage, state State) error {
+	for i, a := range state.Attachments {
+		name := attachmentName(a.ID)
+		var file Sealed
+		if err := readJSON(src, name, &file); err != nil {
+			return err
+		}
+		data := file.Data
+		if file.Key != nil {
+			if DataKeys == nil {
+				return fmt.Errorf("%s is sealed but no encryption keys are configured", name)
+			}
+			var err error
+			if data, err = DataKeys.Open(file.Workspace, file.Key, file.Data); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		state.Attachments[i].Data = data
+	}
+	return nil
+}
+
+// sameState reports whether two states hold the same
+func sameState(a, b map[string]State) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	return err == nil && bytes.Equal(x, y)
+}
+
+// sealState seals the state of each workspace with its data key
+func sealState(state map[string]State) ([]Sealed, error) {
+	byWorkspace := map[string][]State{}
+	for ws, st := range state {
+		byWorkspace[ws] = []State{st}
+	}
+	return seal(byWorkspace)
+}
+
+// unsealState opens the state of workspaces sealed with their data key
+// into state, which it returns
+func unsealState(name string, sealed []Sealed, state map[string]State) (map[string]State, error) {
+	for _, s := range sealed {
+		list, err := unseal[State](name, []Sealed{s})
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			state = map[string]State{}
+		}
+		for _, st := range list {
+			state[s.Workspace] = st
+		}
+	}
+	return state, nil
+}
+
+// seal seals what each workspace has with its data key, in the order of
+// the workspaces
+func seal[T any](byWorkspace map[string][]T) ([]Sealed, error) {
+	if DataKeys == nil {
+		return nil, errors.New("sealing workspaces needs encryption keys")
+	}
+	workspaces := make([]string, 0, len(byWorkspace))
+	for ws := range byWorkspace {
+		workspaces = append(workspaces, ws)
+	}
+	sort.Strings(workspaces)
+	var sealed []Sealed
+	for _, ws := range workspaces {
+		data, err := json.Marshal(byWorkspace[ws])
+		if err != nil {
+			return nil, err
+		}
+		data, key, err := DataKeys.Seal(ws, data)
+		if err != nil {
+			return nil, err
+		}
+		sealed = append(sealed, Sealed{Workspace: ws, Key: key, Data: data})
+	}
+	return sealed, nil
+}
+
+// unseal opens what workspaces sealed with their data key
+func unseal[T any](name string, sealed []Sealed) ([]T, error) {
+	var all []T
+	for _, s := range sealed {
+		if DataKeys == nil {
+			return nil, fmt.Errorf("%s has sealed workspaces but no encryption keys are configured", name)
+		}
+		data, err := DataKeys.Open(s.Workspace, s.Key, s.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: workspace %q: %w", name, s.Workspace, err)
+		}
+		var list []T
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		all = append(all, list...)
+	}
+	return all, nil
+}
+
+// Restore rebuilds the notes and their state, with the files of their
+// attachments, from the newest base in src plus every increment written
+// after it. It returns the sequence the result reflects.
+func Restore(src Storage) ([]models.Note, State, int64, error) {
+	base, increments, err := list(src)
+	if err != nil {
+		return nil, State{}, 0, err
+	}
+	if base == nil {
+		return nil, State{}, 0, ErrNoBackup
+	}
+
+	notes := base.Notes
+	seq := base.Seq
+	byWorkspace := base.State
+	for _, inc := range increments {
+		if inc.From != seq+1 {
+			return nil, State{}, 0, fmt.Errorf("backup gap: have up to %d, next increment starts at %d", seq, inc.From)
+		}
+		for _, change := range inc.Changes {
+			notes = Apply(notes, change)
+		}
+		seq = inc.To
+		byWorkspace = inc.State
+	}
+
+	var state State
+	workspaces := make([]string, 0, len(byWorkspace))
+	for ws := range byWorkspace {
+		workspaces = append(workspaces, ws)
+	}
+	sort.Strings(workspaces)
+	for _, ws := range workspaces {
+		st := byWorkspace[ws]
+		state.Attachments = append(state.Attachments, st.Attachments...)
+		state.Relations = append(state.Relations, st.Relations...)
+		state.Shares = append(state.Shares, st.Shares...)
+		state.Positions = append(state.Positions, st.Positions...)
+		state.Reviews = append(state.Reviews, st.Reviews...)
+	}
+	if err := readAttachments(src, state); err != nil {
+		return nil, State{}, 0, err
+	}
+	return notes, state, seq, nil
+}
+
+// Apply returns notes with a single change applied
+func Apply(notes []models.Note, change models.Change) []models.Note {
+	for i, note := range notes {
+		if note.ID != change.NoteID {
+			continue
+		}
+		if change.Op == models.ChangeDelete {
+			return append(notes[:i], notes[i+1:]...)
+		}
+		notes[i] = *change.Note
+		return notes
+	}
+	if change.Op != models.ChangeDelete && change.Note != nil {
+		notes = append(notes, *change.Note)
+	}
+	return notes
+}
+
+// list loads the newest base in st and the increments that follow it
+func list(st Storage) (*Base, []Increment, error) {
+	var baseFiles, incrFiles []string
+	names, err := st.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		switch {
+		case path.Ext(name) != ".json":
+		case strings.HasPrefix(name, "base-"):
+			baseFiles = append(baseFiles, name)
+		case strings.HasPrefix(name, "incr-"):
+			incrFiles = append(incrFiles, name)
+		}
+	}
+	if len(baseFiles) == 0 {
+		return nil, nil, nil
+	}
+	sort.Strings(baseFiles)
+	sort.Strings(incrFiles)
+
+	base := new(Base)
+	name := baseFiles[len(baseFiles)-1]
+	if err := readJSON(st, name, base); err != nil {
+		return nil, nil, err
+	}
+	notes, err := unseal[models.Note](name, base.Workspaces)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(notes) > 0 {
+		base.Notes = append(base.Notes, notes...)
+		sort.SliceStable(base.Notes, func(i, j int) bool { return base.Notes[i].CreatedAt.Before(base.Notes[j].CreatedAt) })
+	}
+	if base.State, err = unsealState(name, base.States, base.State); err != nil {
+		return nil, nil, err
+	}
+	base.Workspaces, base.States = nil, nil
+
+	var increments []Increment
+	for _, name := range incrFiles {
+		var inc Increment
+		if err := readJSON(st, name, &inc); err != nil {
+			return nil, nil, err
+		}
+		if inc.From <= base.Seq {
+			continue
+		}
+		changes, err := unseal[models.Change](name, inc.Workspaces)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(changes) > 0 {
+			inc.Changes = append(inc.Changes, changes...)
+			sort.Slice(inc.Changes, func(i, j int) bool { return inc.Changes[i].Seq < inc.Changes[j].Seq })
+		}
+		if inc.State, err = unsealState(name, inc.States, inc.State); err != nil {
+			return nil, nil, err
+		}
+		inc.Workspaces, inc.States = nil, nil
+		increments = append(increments, inc)
+	}
+	return base, increments, nil
+}
+
+func writeJSON(dst Storage, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if Keys != nil {
+		if data, err = Keys.Seal(data); err != nil {
+			return err
+		}
+	}
+	return dst.Write(name, data)
+}
+
+func readJSON(src Storage, name string, v any) error {
+	data, err := src.Read(name)
+	if err != nil {
+		return err
+	}
+	if encryption.Sealed(data) {
+		if Keys == nil {
+			return fmt.Errorf("%s is encrypted but no encryption keys are configured", name)
+		}
+		if data, err = Keys.Open(data); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return json.Unmarshal(data, v)
+}
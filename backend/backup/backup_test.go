@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"note/backend/encryption"
+	"note/backend/models"
+)
+
+// fakeSource is a store of notes whose changes all follow a snapshot
+type fakeSource struct {
+	notes   []models.Note
+	seq     int64
+	changes []models.Change
+	state   map[string]State
+}
+
+func (s *fakeSource) Snapshot() ([]models.Note, int64) { return s.notes, s.seq }
+
+func (s *fakeSource) State() map[string]State { return s.state }
+
+func (s *fakeSource) ChangesSince(seq int64) []models.Change {
+	var out []models.Change
+	for _, c := range s.changes {
+		if c.Seq > seq {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func TestSealWorkspaces(t *testing.T) {
+	master, err := encryption.ParseKeyring("master:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	DataKeys, SealWorkspaces = encryption.NewDataKeys(master, 16), true
+	t.Cleanup(func() { DataKeys, SealWorkspaces = nil, false })
+
+	dir := Dir(t.TempDir())
+	src := &fakeSource{
+		notes: []models.Note{
+			{ID: "a", Title: "acme secret", Workspace: "acme"},
+			{ID: "b", Title: "globex secret", Workspace: "globex"},
+		},
+		seq: 2,
+		state: map[string]State{"acme": {Attachments: []Attachment{
+			{Attachment: models.Attachment{ID: "x", NoteID: "a", Name: "secret.txt"}, Data: []byte("secret file")},
+		}}},
+	}
+	if err := Take(dir, src, 10); err != nil {
+		t.Fatal(err)
+	}
+	src.changes = []models.Change{
+		{Seq: 3, Op: models.ChangeUpdate, NoteID: "a", Note: &models.Note{ID: "a", Title: "acme plans", Workspace: "acme"}},
+		{Seq: 4, Op: models.ChangeDelete, NoteID: "b"},
+	}
+	if err := Take(dir, src, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(string(dir), "*"))
+	for _, file := range files {
+		data, _ := os.ReadFile(file)
+		if bytes.Contains(data, []byte("secret")) || bytes.Contains(data, []byte("plans")) {
+			t.Errorf("%s has notes in the clear", filepath.Base(file))
+		}
+	}
+
+	// A fresh process only needs the master key to restore
+	DataKeys = encryption.NewDataKeys(master, 16)
+	notes, state, seq, err := Restore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 4 || len(notes) != 1 || notes[0].Title != "acme plans" {
+		t.Errorf("restored %+v as of %d", notes, seq)
+	}
+	if len(state.Attachments) != 1 || string(state.Attachments[0].Data) != "secret file" {
+		t.Errorf("restored attachments %+v", state.Attachments)
+	}
+
+	// The notes of one workspace can't be passed off as another's
+	var base Base
+	if err := readJSON(dir, baseName(2), &base); err != nil {
+		t.Fatal(err)
+	}
+	acme, globex := base.Workspaces[0], base.Workspaces[1]
+	if _, err := DataKeys.Open("globex", globex.Key, acme.Data); err == nil {
+		t.Error("opened the notes of acme with the key of globex")
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	dir := Dir(t.TempDir())
+	src := &fakeSource{
+		notes: []models.Note{{ID: "a"}, {ID: "b"}},
+		seq:   2,
+		state: map[string]State{"": {
+			Attachments: []Attachment{{Attachment: models.Attachment{ID: "x", NoteID: "a"}, Data: []byte("file")}},
+			Relations:   []models.Relation{{ID: "r", Type: models.RelationRelatedTo, From: "a", To: "b"}},
+		}},
+	}
+	if err := Take(dir, src, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// A share made since the last backup is backed up without any change
+	// to a note
+	st := src.state[""]
+	st.Shares = []Share{{Share: models.Share{Token: "t", NoteID: "b"}, Owner: "alice"}}
+	src.state = map[string]State{"": st}
+	if err := Take(dir, src, 10); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(string(dir), "incr-*"))
+	if len(files) != 1 {
+		t.Fatalf("increments %v, want one", files)
+	}
+	if err := Take(dir, src, 10); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := filepath.Glob(filepath.Join(string(dir), "incr-*")); len(again) != 1 {
+		t.Errorf("increments %v after nothing changed", again)
+	}
+
+	notes, state, seq, err := Restore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 2 || len(notes) != 2 {
+		t.Errorf("restored %+v as of %d", notes, seq)
+	}
+	if len(state.Attachments) != 1 || string(state.Attachments[0].Data) != "file" {
+		t.Errorf("restored attachments %+v", state.Attachments)
+	}
+	if len(state.Relations) != 1 || len(state.Shares) != 1 || state.Shares[0].Owner != "alice" {
+		t.Errorf("restored relations %+v and shares %+v", state.Relations, state.Shares)
+	}
+}
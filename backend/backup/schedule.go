@@ -0,0 +1,41 @@
+package backup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule tells when the next backup is due
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// ParseSchedule reads a five-field cron expression like "0 3 * * *", or a
+// descriptor like "@daily" or "@every 30m"
+func ParseSchedule(expr string) (Schedule, error) {
+	return cron.ParseStandard(expr)
+}
+
+// Every is a schedule with a fixed interval between backups
+func Every(interval time.Duration) Schedule {
+	return cron.Every(interval)
+}
+
+// Run takes a backup into dst at every time schedule names. It never
+// returns before ctx is done; failures are logged and retried at the next
+// scheduled time.
+func Run(ctx context.Context, dst Storage, src Source, schedule Schedule, fullEvery int) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(schedule.Next(time.Now()))):
+		}
+		if err := Take(dst, src, fullEvery); err != nil {
+			log.Printf("backup failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package backup
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Storage is where backup files are kept
+type Storage interface {
+	// List returns the names of every file, in any order
+	List() ([]string, error)
+	Read(name string) ([]byte, error)
+	// Write must never leave a partly written file under name
+	Write(name string, data []byte) error
+}
+
+// Dir keeps backups as files in a local directory
+type Dir string
+
+func (d Dir) List() ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d Dir) Read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), name))
+}
+
+// Write goes through a temporary file so a crash never leaves a
+// half-written backup behind
+func (d Dir) Write(name string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(string(d), name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
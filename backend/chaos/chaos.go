@@ -0,0 +1,112 @@
+// Package chaos injects latency, errors and dropped connections into API
+// requests so clients can test their retries, backoff and offline mode
+// against a real server. It is meant for test instances only.
+package chaos
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Header is set on responses a fault was injected into, so clients can
+// tell injected failures from real ones
+const Header = "X-Notty-Fault"
+
+// Fault is what happens to the requests of a route. Rates are the share
+// of requests affected, from 0 to 1.
+type Fault struct {
+	LatencyMS int `json:"latency_ms"` // added before the request is handled
+	JitterMS  int `json:"jitter_ms"`  // up to this much more, at random
+
+	ErrorRate float64 `json:"error_rate"`
+	Status    int     `json:"status"` // of injected errors; 503 if unset
+
+	// DropRate closes the connection without a response, like a client
+	// going offline mid-request would see
+	DropRate float64 `json:"drop_rate"`
+}
+
+// Config lists the faults by route pattern, like "/api/notes/:id". The
+// route "*" applies to every route not listed. Nothing is injected until
+// Enabled is set as well.
+type Config struct {
+	Enabled bool             `json:"enabled"`
+	Routes  map[string]Fault `json:"routes"`
+}
+
+// Validate rejects rates and statuses that make no sense
+func (cfg Config) Validate() error {
+	for route, f := range cfg.Routes {
+		if f.LatencyMS < 0 || f.JitterMS < 0 {
+			return fmt.Errorf("fault latency of %s can't be negative", route)
+		}
+		if f.ErrorRate < 0 || f.ErrorRate > 1 || f.DropRate < 0 || f.DropRate > 1 {
+			return fmt.Errorf("fault rates of %s must be between 0 and 1", route)
+		}
+		if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+			return fmt.Errorf("fault status of %s must be 4xx or 5xx", route)
+		}
+	}
+	return nil
+}
+
+// Middleware injects the configured faults. Requests that don't match a
+// route pass through untouched, as do all requests while it is disabled.
+func Middleware(cfg Config) echo.MiddlewareFunc {
+	if !cfg.Enabled || len(cfg.Routes) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+	log.Printf("Fault injection is on for %d routes; don't use this instance in production", len(cfg.Routes))
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			f, ok := cfg.Routes[c.Path()]
+			if !ok {
+				f, ok = cfg.Routes["*"]
+			}
+			if !ok {
+				return next(c)
+			}
+			if delay := time.Duration(f.LatencyMS) * time.Millisecond; delay > 0 || f.JitterMS > 0 {
+				if f.JitterMS > 0 {
+					delay += time.Duration(rand.IntN(f.JitterMS+1)) * time.Millisecond
+				}
+				select {
+				case <-time.After(delay):
+				case <-c.Request().Context().Done():
+					return c.Request().Context().Err()
+				}
+				c.Response().Header().Set(Header, "latency")
+			}
+			if f.DropRate > 0 && rand.Float64() < f.DropRate {
+				return drop(c)
+			}
+			if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+				status := f.Status
+				if status == 0 {
+					status = http.StatusServiceUnavailable
+				}
+				c.Response().Header().Set(Header, "error")
+				if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests {
+					c.Response().Header().Set("Retry-After", "1")
+				}
+				return c.JSON(status, map[string]string{"error": "Injected fault"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// drop closes the connection without writing anything
+func drop(c echo.Context) error {
+	conn, _, err := http.NewResponseController(c.Response().Writer).Hijack()
+	if err != nil {
+		// HTTP/2 can't be hijacked; aborting the handler resets the stream
+		panic(http.ErrAbortHandler)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,694 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"note/backend/backup"
+	"note/backend/chaos"
+	"note/backend/email"
+	"note/backend/metering"
+	"note/backend/ratelimit"
+	"note/backend/sanitize"
+	"note/backend/search"
+	"note/backend/security"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting the server reads at startup. Settings come
+// from the JSON file named by NOTTY_CONFIG, if any, and NOTTY_*
+// environment variables override the file.
+type Config struct {
+	Addr string `json:"addr"`
+
+	// TLS serves HTTPS on Addr, with a certificate from files or from
+	// Let's Encrypt; it is plain HTTP while neither is set
+	TLS TLS `json:"tls"`
+
+	// GRPCAddr is where the gRPC API listens; it is disabled while empty
+	GRPCAddr string `json:"grpc_addr"`
+
+	// AdminToken unlocks the admin API; it is disabled while empty
+	AdminToken string `json:"admin_token"`
+
+	// RequireAPIKeys rejects private API requests without an API key.
+	// Keys are kept in APIKeysFile, or only in memory while it is empty.
+	RequireAPIKeys bool   `json:"require_api_keys"`
+	APIKeysFile    string `json:"api_keys_file"`
+
+	// Instance-wide limits admins start with; zero means no limit
+	MaxNotes    int `json:"max_notes"`
+	MaxNoteSize int `json:"max_note_size"`
+	MaxAPIKeys  int `json:"max_api_keys"`
+
+	// SearchLanguage is the language search analyzes notes in that don't
+	// declare one: simple, en, de, es, zh, ja or ko
+	SearchLanguage string `json:"search_language"`
+
+	// AttachmentTypes are the media types that may be attached, like
+	// application/pdf or image/*; any may while it is empty.
+	// MaxAttachmentSize caps attachments below the 10 MiB they can have.
+	AttachmentTypes   []string `json:"attachment_types"`
+	MaxAttachmentSize int      `json:"max_attachment_size"`
+
+	// StripImageLocation removes GPS data from uploaded photos unless an
+	// upload asks to keep it
+	StripImageLocation bool `json:"strip_image_location"`
+
+	// JobWorkers is how many background jobs run at once
+	JobWorkers int `json:"job_workers"`
+	// ShutdownTimeout is how long requests and jobs get to finish when
+	// the server stops
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// RedisURL keeps the job queue in Redis, e.g.
+	// redis://:password@localhost:6379/0, so queued jobs survive restarts.
+	// While empty jobs are kept in memory.
+	RedisURL string `json:"redis_url"`
+
+	// Database is the SQL database whose schema `notty migrate` manages
+	Database Database `json:"database"`
+
+	// CacheSize is how many encoded notes are kept for fast reads; zero
+	// turns the read cache off
+	CacheSize int `json:"cache_size"`
+
+	// Quota is what each API key may store at most
+	Quota Quota `json:"quota"`
+
+	// WorkspaceQuotas is what each workspace may use of metered features,
+	// like {"api_requests": {"limit": 10000, "hard": true}}. Admins can
+	// change it and give single workspaces others.
+	WorkspaceQuotas metering.Quotas `json:"workspace_quotas"`
+
+	// AuditFile is where the audit log is appended to; while empty it is
+	// only kept in memory
+	AuditFile string `json:"audit_file"`
+
+	// PublicIDKey turns on opaque note IDs in public URLs and feeds,
+	// derived from this secret. While empty they show the real IDs.
+	PublicIDKey string `json:"public_id_key"`
+
+	// IngestAddr is where the SMTP server that turns emails into notes
+	// listens; it is disabled while empty. Mail is taken for addresses at
+	// IngestDomain, which the MX record of the domain must point here.
+	IngestAddr   string `json:"ingest_addr"`
+	IngestDomain string `json:"ingest_domain"`
+
+	// AcceptLegacyIDs keeps integer note IDs working in URLs
+	AcceptLegacyIDs bool `json:"accept_legacy_ids"`
+
+	// InboxNotebook is where notes created without a notebook go. An
+	// empty name leaves them without one.
+	InboxNotebook string `json:"inbox_notebook"`
+
+	// Backups go to the S3 bucket when one is named, otherwise to
+	// BackupDir. They are disabled while neither is set.
+	BackupDir string   `json:"backup_dir"`
+	BackupS3  BackupS3 `json:"backup_s3"`
+
+	// BackupSchedule is a cron expression like "0 3 * * *". Without one a
+	// backup is taken every BackupInterval.
+	BackupSchedule  string   `json:"backup_schedule"`
+	BackupInterval  Duration `json:"backup_interval"`
+	BackupFullEvery int      `json:"backup_full_every"`
+
+	// EncryptionKeys is a comma separated list of id:base64-key pairs.
+	// The first key encrypts, all of them can decrypt.
+	EncryptionKeys string `json:"encryption_keys"`
+
+	// EncryptWorkspaces seals the notes of each workspace in backups with
+	// a data key of its own, wrapped by the first of EncryptionKeys
+	EncryptWorkspaces bool `json:"encrypt_workspaces"`
+
+	// ExportSigningKey signs the manifest of every export, so exports can
+	// be proven unchanged later. It is the base64 seed of an Ed25519 key.
+	ExportSigningKey string `json:"export_signing_key"`
+
+	// Notes unedited and unreviewed for ReviewAfter are queued for review,
+	// up to ReviewBatch at a time, every ReviewInterval. Archiving them
+	// moves them to ArchiveNotebook; an empty name turns it off.
+	ReviewAfter     Duration `json:"review_after"`
+	ReviewBatch     int      `json:"review_batch"`
+	ReviewInterval  Duration `json:"review_interval"`
+	ArchiveNotebook string   `json:"archive_notebook"`
+
+	// ReminderInterval is how often due reminders are looked for
+	ReminderInterval Duration `json:"reminder_interval"`
+
+	// PublishInterval is how often notes due to be published are looked for
+	PublishInterval Duration `json:"publish_interval"`
+
+	// Sandbox lets API keys work in a scratch workspace of their own with
+	// X-Notty-Sandbox: true. Sandboxes are emptied at the times of the
+	// cron expression SandboxReset.
+	Sandbox      bool   `json:"sandbox"`
+	SandboxReset string `json:"sandbox_reset"`
+
+	// EventSink publishes every note change to NATS or Kafka. It is off
+	// while its URL is unset.
+	EventSink EventSink `json:"event_sink"`
+
+	// Embeddings lets related notes compare what notes mean, with an
+	// embedding model. It is off while its URL is unset.
+	Embeddings Embeddings `json:"embeddings"`
+
+	// Notification channels other than in-app are off while unset
+	WebhookURL   string   `json:"notify_webhook_url"`
+	SMTPAddr     string   `json:"smtp_addr"`
+	SMTPUsername string   `json:"smtp_username"`
+	SMTPPassword string   `json:"smtp_password"`
+	SMTPFrom     string   `json:"smtp_from"`
+	EmailTo      []string `json:"notify_email_to"`
+
+	// EmailTemplatesDir holds email templates that replace the built-in
+	// ones of the same name, like event.html.tmpl. EmailBrand is what
+	// every email is branded with.
+	EmailTemplatesDir string      `json:"email_templates_dir"`
+	EmailBrand        email.Brand `json:"email_brand"`
+
+	// Sanitize says how each field of notes is cleaned of markup that
+	// could run scripts when notes are saved and when they are rendered
+	// for others, like {"save": {"content": "html"}}. Modes are "html",
+	// which keeps safe markup, "text", which escapes it all, and "none".
+	Sanitize sanitize.Config `json:"sanitize"`
+
+	// SecurityHeaders replaces the default header policy of the route
+	// prefixes it lists, e.g. {"/embed/": {...}}
+	SecurityHeaders security.Policies `json:"security_headers"`
+
+	// RateLimits overrides the default limits of the tiers and routes it
+	// lists
+	RateLimits ratelimit.Policy `json:"rate_limits"`
+
+	// TrustedProxies are the addresses or CIDR ranges of the reverse
+	// proxies in front of the server, whose X-Forwarded-For gives the
+	// client address that anonymous requests are rate limited by. Without
+	// any, the address of the connection is used and the header ignored.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// CORS decides which other sites may call the API from a browser
+	CORS security.CORSConfig `json:"cors"`
+
+	// CSRF protects requests that authenticate with a session cookie
+	CSRF security.CSRFConfig `json:"csrf"`
+
+	// SLO is what the metrics at /metrics measure the service against
+	SLO SLO `json:"slo"`
+
+	// Faults injects latency and errors into API requests for client
+	// testing. Never turn it on in production.
+	Faults chaos.Config `json:"faults"`
+
+	// MetricsToken is the bearer token Prometheus scrapes /metrics with;
+	// the endpoint is open while it is empty
+	MetricsToken string `json:"metrics_token"`
+
+	// StatusPage serves a public status page at /status, and as JSON at
+	// /status.json, with the health of the instance and the incidents
+	// admins post. StatusTitle heads it.
+	StatusPage  bool   `json:"status_page"`
+	StatusTitle string `json:"status_title"`
+}
+
+// Database locates a SQL database. Driver names a database/sql driver
+// the binary is built with, "pgx" for PostgreSQL or "sqlite", and URL is
+// its data source name. MigrateOnStart applies pending migrations before
+// the server starts, and keeps it from starting on a database migrated by
+// a newer version; migrations rewriting rows then run in the background.
+type Database struct {
+	Driver         string `json:"driver"`
+	URL            string `json:"url"`
+	MigrateOnStart bool   `json:"migrate_on_start"`
+}
+
+// SLO sets the service level objectives. Availability is the share of
+// API requests that must not fail with a server error, Latency what the
+// p99 of each of Routes ("METHOD /path/:param") should stay under.
+type SLO struct {
+	Availability float64  `json:"availability"`
+	Latency      Duration `json:"latency"`
+	Routes       []string `json:"routes"`
+}
+
+// TLS configures HTTPS. CertFile and KeyFile name a PEM certificate and
+// its key. AutoDomains instead gets certificates for the domains listed
+// from Let's Encrypt, which requires Addr to be reachable on port 443,
+// and keeps them in CacheDir.
+type TLS struct {
+	CertFile    string   `json:"cert_file"`
+	KeyFile     string   `json:"key_file"`
+	AutoDomains []string `json:"auto_domains"`
+	AutoEmail   string   `json:"auto_email"` // for expiry notices from Let's Encrypt
+	CacheDir    string   `json:"cache_dir"`
+
+	// RedirectAddr is where plain HTTP is redirected to HTTPS, like ":80".
+	// It also answers Let's Encrypt's HTTP challenges. Disabled while empty.
+	RedirectAddr string `json:"redirect_addr"`
+}
+
+// Enabled reports whether HTTPS is configured
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || len(t.AutoDomains) > 0
+}
+
+// BackupS3 locates a bucket on AWS or another S3-compatible store
+type BackupS3 struct {
+	Bucket       string `json:"bucket"`
+	Region       string `json:"region"`
+	Prefix       string `json:"prefix"`
+	Endpoint     string `json:"endpoint"`
+	PathStyle    bool   `json:"path_style"`
+	AccessKey    string `json:"access_key"`
+	SecretKey    string `json:"secret_key"`
+	SessionToken string `json:"session_token"`
+}
+
+// EventSink names the broker that changes are published to, as a URL like
+// nats://host:4222 or kafka://host1:9092,host2:9092, and the topic. "{op}"
+// in Topic stands for the operation, so each gets a topic of its own.
+type EventSink struct {
+	URL   string `json:"url"`
+	Topic string `json:"topic"`
+}
+
+// Embeddings locates a service speaking the OpenAI embeddings API, like
+// https://api.openai.com/v1/embeddings, and the model it should use.
+// Notes are embedded in the background every Interval.
+type Embeddings struct {
+	URL      string   `json:"url"`
+	Model    string   `json:"model"`
+	APIKey   string   `json:"api_key"`
+	Interval Duration `json:"interval"`
+}
+
+// Quota limits the notes of a single user; zero means no limit
+type Quota struct {
+	MaxNotes    int `json:"max_notes"`
+	MaxNoteSize int `json:"max_note_size"`
+	MaxStorage  int `json:"max_storage"`
+}
+
+// Duration is a time.Duration written as a string like "30s" in the file
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Default returns the configuration used where nothing else is set
+func Default() *Config {
+	return &Config{
+		Addr:             ":8080",
+		AcceptLegacyIDs:  true,
+		InboxNotebook:    "Inbox",
+		CacheSize:        1000,
+		JobWorkers:       4,
+		ShutdownTimeout:  Duration{30 * time.Second},
+		SearchLanguage:   search.English,
+		TLS:              TLS{CacheDir: "certs"},
+		BackupInterval:   Duration{time.Hour},
+		BackupFullEvery:  24, // one full dump a day with hourly backups
+		BackupS3:         BackupS3{Region: "us-east-1"},
+		ReviewAfter:      Duration{180 * 24 * time.Hour},
+		ReviewBatch:      10,
+		ReviewInterval:   Duration{time.Hour},
+		ArchiveNotebook:  "Archive",
+		ReminderInterval: Duration{30 * time.Second},
+		PublishInterval:  Duration{30 * time.Second},
+		SandboxReset:     "@daily",
+		StatusTitle:      "Notty status",
+		EventSink:        EventSink{Topic: "notty.changes"},
+		Embeddings:       Embeddings{Model: "text-embedding-3-small", Interval: Duration{time.Minute}},
+		SMTPFrom:         "notty@localhost",
+		EmailBrand:       email.DefaultBrand(),
+		Sanitize:         sanitize.DefaultConfig(),
+		CORS: security.CORSConfig{
+			AllowMethods:  []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+			AllowHeaders:  []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "X-CSRF-Token"},
+			ExposeHeaders: []string{"ETag", "Last-Modified"},
+			MaxAge:        600,
+			OpenPrefixes:  []string{"/api/public/"},
+		},
+		CSRF: security.CSRFConfig{
+			SessionCookie: "notty_session",
+			CookieName:    "notty_csrf",
+			SameSite:      "strict",
+			Secure:        true,
+		},
+		SLO: SLO{
+			Availability: 0.999,
+			Latency:      Duration{500 * time.Millisecond},
+			Routes: []string{
+				"GET /api/notes",
+				"POST /api/notes",
+				"GET /api/notes/:id",
+				"PUT /api/notes/:id",
+				"GET /api/search",
+				"GET /api/sync",
+			},
+		},
+	}
+}
+
+// Load reads the configuration file, if there is one, and then the
+// NOTTY_* environment variables
+func Load() (*Config, error) {
+	cfg := Default()
+	if path := os.Getenv("NOTTY_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	envString(&cfg.Addr, "NOTTY_ADDR")
+	envString(&cfg.GRPCAddr, "NOTTY_GRPC_ADDR")
+	envString(&cfg.TLS.CertFile, "NOTTY_TLS_CERT_FILE")
+	envString(&cfg.TLS.KeyFile, "NOTTY_TLS_KEY_FILE")
+	envList(&cfg.TLS.AutoDomains, "NOTTY_TLS_AUTO_DOMAINS")
+	envString(&cfg.TLS.AutoEmail, "NOTTY_TLS_AUTO_EMAIL")
+	envString(&cfg.TLS.CacheDir, "NOTTY_TLS_CACHE_DIR")
+	envString(&cfg.TLS.RedirectAddr, "NOTTY_TLS_REDIRECT_ADDR")
+	envString(&cfg.AdminToken, "NOTTY_ADMIN_TOKEN")
+	envString(&cfg.APIKeysFile, "NOTTY_API_KEYS_FILE")
+	envString(&cfg.PublicIDKey, "NOTTY_PUBLIC_ID_KEY")
+	envString(&cfg.AuditFile, "NOTTY_AUDIT_FILE")
+	envString(&cfg.SearchLanguage, "NOTTY_SEARCH_LANGUAGE")
+	envString(&cfg.IngestAddr, "NOTTY_INGEST_ADDR")
+	envString(&cfg.IngestDomain, "NOTTY_INGEST_DOMAIN")
+	if v, ok := os.LookupEnv("NOTTY_INBOX_NOTEBOOK"); ok {
+		cfg.InboxNotebook = v // may be set empty to turn the inbox off
+	}
+	if v, ok := os.LookupEnv("NOTTY_ARCHIVE_NOTEBOOK"); ok {
+		cfg.ArchiveNotebook = v // may be set empty to turn archiving off
+	}
+	envString(&cfg.BackupDir, "NOTTY_BACKUP_DIR")
+	envString(&cfg.BackupSchedule, "NOTTY_BACKUP_SCHEDULE")
+	// The standard AWS variables work, the NOTTY_ ones take precedence
+	envString(&cfg.BackupS3.Region, "AWS_REGION")
+	envString(&cfg.BackupS3.AccessKey, "AWS_ACCESS_KEY_ID")
+	envString(&cfg.BackupS3.SecretKey, "AWS_SECRET_ACCESS_KEY")
+	envString(&cfg.BackupS3.SessionToken, "AWS_SESSION_TOKEN")
+	envString(&cfg.BackupS3.Bucket, "NOTTY_BACKUP_S3_BUCKET")
+	envString(&cfg.BackupS3.Region, "NOTTY_BACKUP_S3_REGION")
+	envString(&cfg.BackupS3.Prefix, "NOTTY_BACKUP_S3_PREFIX")
+	envString(&cfg.BackupS3.Endpoint, "NOTTY_BACKUP_S3_ENDPOINT")
+	envString(&cfg.BackupS3.AccessKey, "NOTTY_BACKUP_S3_ACCESS_KEY")
+	envString(&cfg.BackupS3.SecretKey, "NOTTY_BACKUP_S3_SECRET_KEY")
+	envString(&cfg.EncryptionKeys, "NOTTY_ENCRYPTION_KEYS")
+	envString(&cfg.SandboxReset, "NOTTY_SANDBOX_RESET")
+	envString(&cfg.ExportSigningKey, "NOTTY_EXPORT_SIGNING_KEY")
+	envString(&cfg.EventSink.URL, "NOTTY_EVENT_SINK_URL")
+	envString(&cfg.EventSink.Topic, "NOTTY_EVENT_SINK_TOPIC")
+	envString(&cfg.Embeddings.URL, "NOTTY_EMBEDDINGS_URL")
+	envString(&cfg.Embeddings.Model, "NOTTY_EMBEDDINGS_MODEL")
+	envString(&cfg.Embeddings.APIKey, "NOTTY_EMBEDDINGS_API_KEY")
+	envString(&cfg.WebhookURL, "NOTTY_NOTIFY_WEBHOOK_URL")
+	envString(&cfg.SMTPAddr, "NOTTY_SMTP_ADDR")
+	envString(&cfg.SMTPUsername, "NOTTY_SMTP_USERNAME")
+	envString(&cfg.SMTPPassword, "NOTTY_SMTP_PASSWORD")
+	envString(&cfg.SMTPFrom, "NOTTY_SMTP_FROM")
+	envList(&cfg.EmailTo, "NOTTY_NOTIFY_EMAIL_TO")
+	envString(&cfg.EmailTemplatesDir, "NOTTY_EMAIL_TEMPLATES_DIR")
+	envString(&cfg.EmailBrand.Name, "NOTTY_EMAIL_BRAND_NAME")
+	envString(&cfg.EmailBrand.URL, "NOTTY_EMAIL_BRAND_URL")
+	envString(&cfg.EmailBrand.LogoURL, "NOTTY_EMAIL_BRAND_LOGO_URL")
+	envList(&cfg.CORS.AllowOrigins, "NOTTY_CORS_ORIGINS")
+	envList(&cfg.TrustedProxies, "NOTTY_TRUSTED_PROXIES")
+	envList(&cfg.SLO.Routes, "NOTTY_SLO_ROUTES")
+	envString(&cfg.MetricsToken, "NOTTY_METRICS_TOKEN")
+	envString(&cfg.StatusTitle, "NOTTY_STATUS_TITLE")
+	envString(&cfg.RedisURL, "NOTTY_REDIS_URL")
+	envString(&cfg.Database.Driver, "NOTTY_DATABASE_DRIVER")
+	envString(&cfg.Database.URL, "NOTTY_DATABASE_URL")
+	envList(&cfg.AttachmentTypes, "NOTTY_ATTACHMENT_TYPES")
+
+	// NOTTY_FAULTS holds the routes of Faults as JSON and turns it on
+	if v := os.Getenv("NOTTY_FAULTS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &cfg.Faults.Routes); err != nil {
+			return nil, invalid("NOTTY_FAULTS", v)
+		}
+		cfg.Faults.Enabled = true
+	}
+
+	for _, err := range []error{
+		envBool(&cfg.RequireAPIKeys, "NOTTY_REQUIRE_API_KEYS"),
+		envBool(&cfg.AcceptLegacyIDs, "NOTTY_LEGACY_IDS"),
+		envBool(&cfg.StripImageLocation, "NOTTY_STRIP_IMAGE_LOCATION"),
+		envBool(&cfg.Sandbox, "NOTTY_SANDBOX"),
+		envBool(&cfg.StatusPage, "NOTTY_STATUS_PAGE"),
+		envBool(&cfg.EncryptWorkspaces, "NOTTY_ENCRYPT_WORKSPACES"),
+		envInt(&cfg.MaxNotes, "NOTTY_MAX_NOTES"),
+		envInt(&cfg.MaxNoteSize, "NOTTY_MAX_NOTE_SIZE"),
+		envInt(&cfg.MaxAPIKeys, "NOTTY_MAX_API_KEYS"),
+		envInt(&cfg.MaxAttachmentSize, "NOTTY_MAX_ATTACHMENT_SIZE"),
+		envInt(&cfg.CacheSize, "NOTTY_CACHE_SIZE"),
+		envInt(&cfg.JobWorkers, "NOTTY_JOB_WORKERS"),
+		envInt(&cfg.Quota.MaxNotes, "NOTTY_QUOTA_NOTES"),
+		envInt(&cfg.Quota.MaxNoteSize, "NOTTY_QUOTA_NOTE_SIZE"),
+		envInt(&cfg.Quota.MaxStorage, "NOTTY_QUOTA_STORAGE"),
+		envDuration(&cfg.BackupInterval, "NOTTY_BACKUP_INTERVAL"),
+		envInt(&cfg.BackupFullEvery, "NOTTY_BACKUP_FULL_EVERY"),
+		envBool(&cfg.BackupS3.PathStyle, "NOTTY_BACKUP_S3_PATH_STYLE"),
+		envDuration(&cfg.ReviewAfter, "NOTTY_REVIEW_AFTER"),
+		envInt(&cfg.ReviewBatch, "NOTTY_REVIEW_BATCH"),
+		envDuration(&cfg.ReviewInterval, "NOTTY_REVIEW_INTERVAL"),
+		envDuration(&cfg.ReminderInterval, "NOTTY_REMINDER_INTERVAL"),
+		envDuration(&cfg.PublishInterval, "NOTTY_PUBLISH_INTERVAL"),
+		envDuration(&cfg.Embeddings.Interval, "NOTTY_EMBEDDINGS_INTERVAL"),
+		envDuration(&cfg.ShutdownTimeout, "NOTTY_SHUTDOWN_TIMEOUT"),
+		envBool(&cfg.Database.MigrateOnStart, "NOTTY_MIGRATE_ON_START"),
+		envBool(&cfg.CSRF.Secure, "NOTTY_SECURE_COOKIES"),
+		envBool(&cfg.CORS.AllowCredentials, "NOTTY_CORS_CREDENTIALS"),
+		envBool(&cfg.CORS.Dev, "NOTTY_CORS_DEV"),
+		envFloat(&cfg.SLO.Availability, "NOTTY_SLO_AVAILABILITY"),
+		envDuration(&cfg.SLO.Latency, "NOTTY_SLO_LATENCY"),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration is complete and consistent
+func (cfg *Config) Validate() error {
+	if cfg.BackupInterval.Duration <= 0 {
+		return fmt.Errorf("backup interval must be positive")
+	}
+	if cfg.BackupSchedule != "" {
+		if _, err := backup.ParseSchedule(cfg.BackupSchedule); err != nil {
+			return fmt.Errorf("invalid backup schedule %q: %w", cfg.BackupSchedule, err)
+		}
+	}
+	if _, err := backup.ParseSchedule(cfg.SandboxReset); err != nil {
+		return fmt.Errorf("invalid sandbox reset schedule %q: %w", cfg.SandboxReset, err)
+	}
+	if cfg.EncryptWorkspaces && cfg.EncryptionKeys == "" {
+		return fmt.Errorf("encrypt_workspaces needs encryption_keys")
+	}
+	if cfg.EventSink.URL != "" {
+		u, err := url.Parse(cfg.EventSink.URL)
+		if err != nil || (u.Scheme != "nats" && u.Scheme != "kafka") || u.Host == "" {
+			return fmt.Errorf("event_sink url must look like nats://host:port or kafka://host:port")
+		}
+		if strings.TrimSpace(cfg.EventSink.Topic) == "" {
+			return fmt.Errorf("event_sink needs a topic")
+		}
+	}
+	if cfg.Embeddings.URL != "" {
+		if u, err := url.Parse(cfg.Embeddings.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("embeddings url must be an http or https URL")
+		}
+		if cfg.Embeddings.Model == "" || cfg.Embeddings.Interval.Duration <= 0 {
+			return fmt.Errorf("embeddings need a model and a positive interval")
+		}
+	}
+	if cfg.BackupFullEvery <= 0 {
+		return fmt.Errorf("backup_full_every must be positive")
+	}
+	if cfg.MaxNotes < 0 || cfg.MaxNoteSize < 0 || cfg.MaxAPIKeys < 0 ||
+		cfg.Quota.MaxNotes < 0 || cfg.Quota.MaxNoteSize < 0 || cfg.Quota.MaxStorage < 0 {
+		return fmt.Errorf("limits can't be negative")
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	if cfg.TLS.CertFile != "" && len(cfg.TLS.AutoDomains) > 0 {
+		return fmt.Errorf("tls takes either a certificate file or auto_domains, not both")
+	}
+	if cfg.TLS.RedirectAddr != "" && !cfg.TLS.Enabled() {
+		return fmt.Errorf("tls redirect_addr needs a certificate file or auto_domains")
+	}
+	if cfg.IngestAddr != "" && cfg.IngestDomain == "" {
+		return fmt.Errorf("ingest_domain is required with ingest_addr")
+	}
+	if cfg.ReviewAfter.Duration <= 0 || cfg.ReviewBatch <= 0 || cfg.ReviewInterval.Duration <= 0 {
+		return fmt.Errorf("review_after, review_batch and review_interval must be positive")
+	}
+	if cfg.JobWorkers <= 0 {
+		return fmt.Errorf("job_workers must be positive")
+	}
+	if cfg.ShutdownTimeout.Duration <= 0 {
+		return fmt.Errorf("shutdown_timeout must be positive")
+	}
+	if (cfg.Database.Driver == "") != (cfg.Database.URL == "") {
+		return fmt.Errorf("database driver and url must be set together")
+	}
+	if cfg.Database.MigrateOnStart && cfg.Database.URL == "" {
+		return fmt.Errorf("migrate_on_start needs a database")
+	}
+	if cfg.ReminderInterval.Duration <= 0 {
+		return fmt.Errorf("reminder interval must be positive")
+	}
+	if cfg.PublishInterval.Duration <= 0 {
+		return fmt.Errorf("publish interval must be positive")
+	}
+	if err := cfg.CORS.Validate(); err != nil {
+		return err
+	}
+	if _, err := cfg.CSRF.SameSiteMode(); err != nil {
+		return err
+	}
+	if _, err := cfg.TrustedProxyRanges(); err != nil {
+		return err
+	}
+	if !search.Supported(cfg.SearchLanguage) {
+		return fmt.Errorf("search_language must be simple, en, de, es, zh, ja or ko")
+	}
+	if err := cfg.WorkspaceQuotas.Validate(); err != nil {
+		return err
+	}
+	if strings.TrimSpace(cfg.EmailBrand.Name) == "" {
+		return fmt.Errorf("email_brand needs a name")
+	}
+	if err := cfg.Sanitize.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Faults.Validate(); err != nil {
+		return err
+	}
+	if !(cfg.SLO.Availability > 0 && cfg.SLO.Availability < 1) {
+		return fmt.Errorf("slo availability must be between 0 and 1")
+	}
+	if cfg.SLO.Latency.Duration <= 0 {
+		return fmt.Errorf("slo latency must be positive")
+	}
+	for _, route := range cfg.SLO.Routes {
+		if method, path, ok := strings.Cut(route, " "); !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("slo route %q must look like \"GET /api/notes\"", route)
+		}
+	}
+	return nil
+}
+
+// TrustedProxyRanges parses TrustedProxies, taking a single address as
+// a range of its own
+func (cfg *Config) TrustedProxyRanges() ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, proxy := range cfg.TrustedProxies {
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q must be an IP address or CIDR range", proxy)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+func envString(dst *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*dst = v
+	}
+}
+
+func envList(dst *[]string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*dst = nil
+		for _, item := range strings.Split(v, ",") {
+			*dst = append(*dst, strings.TrimSpace(item))
+		}
+	}
+}
+
+func envBool(dst *bool, key string) error {
+	if v := os.Getenv(key); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return invalid(key, v)
+		}
+		*dst = b
+	}
+	return nil
+}
+
+func envInt(dst *int, key string) error {
+	if v := os.Getenv(key); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return invalid(key, v)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+func envFloat(dst *float64, key string) error {
+	if v := os.Getenv(key); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return invalid(key, v)
+		}
+		*dst = f
+	}
+	return nil
+}
+
+func envDuration(dst *Duration, key string) error {
+	if v := os.Getenv(key); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return invalid(key, v)
+		}
+		dst.Duration = d
+	}
+	return nil
+}
+
+func invalid(key, value string) error {
+	return fmt.Errorf("invalid value %q for %s", value, key)
+}
@@ -0,0 +1,141 @@
+// Package dedupe finds notes that are copies or near copies of each other
+package dedupe
+
+import (
+	"crypto/sha256"
+	"note/backend/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultThreshold is the similarity above which notes count as near
+// duplicates
+const DefaultThreshold = 0.85
+
+// Group is a set of notes that duplicate each other. Exact groups have
+// the same title and content once case and whitespace are ignored.
+type Group struct {
+	Exact      bool          `json:"exact"`
+	Similarity float64       `json:"similarity"` // lowest similarity between two linked notes
+	Notes      []models.Note `json:"notes"`
+}
+
+// Find groups notes whose similarity is at least threshold. Encrypted
+// content can't be compared, so encrypted notes only match exact copies.
+//
+// Near duplicates are found by comparing every pair, which is fine for
+// the few thousand notes an instance holds in memory.
+func Find(notes []models.Note, threshold float64) []Group {
+	n := len(notes)
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	lowest := make(map[int]float64)
+	link := func(i, j int, similarity float64) {
+		ri, rj := find(i), find(j)
+		low := similarity
+		for _, r := range []int{ri, rj} {
+			if s, ok := lowest[r]; ok && s < low {
+				low = s
+			}
+		}
+		delete(lowest, ri)
+		delete(lowest, rj)
+		if ri != rj {
+			parent[rj] = ri
+		}
+		lowest[ri] = low
+	}
+
+	hashes := make([][32]byte, n)
+	shingles := make([]map[string]bool, n)
+	for i, note := range notes {
+		text := Normalize(note.Title) + "\n" + Normalize(note.Content)
+		hashes[i] = sha256.Sum256([]byte(text))
+		if !note.ContentEncrypted {
+			shingles[i] = trigrams(text)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if hashes[i] == hashes[j] {
+				link(i, j, 1)
+				continue
+			}
+			if shingles[i] == nil || shingles[j] == nil {
+				continue
+			}
+			if s := jaccard(shingles[i], shingles[j]); s >= threshold {
+				link(i, j, s)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	var roots []int
+	for i := range notes {
+		r := find(i)
+		if _, ok := lowest[r]; !ok {
+			continue // a note without duplicates
+		}
+		if _, ok := members[r]; !ok {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], i)
+	}
+	groups := make([]Group, 0, len(roots))
+	for _, r := range roots {
+		g := Group{Exact: true, Similarity: lowest[r]}
+		for _, i := range members[r] {
+			g.Notes = append(g.Notes, notes[i])
+			g.Exact = g.Exact && hashes[i] == hashes[members[r][0]]
+		}
+		groups = append(groups, g)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Similarity > groups[j].Similarity })
+	return groups
+}
+
+// normalize lowercases s and collapses runs of whitespace
+func Normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), unicode.IsSpace), " ")
+}
+
+// trigrams returns the word trigrams of s, or its words for short texts
+func trigrams(s string) map[string]bool {
+	words := strings.Fields(s)
+	set := make(map[string]bool)
+	if len(words) < 3 {
+		for _, w := range words {
+			set[w] = true
+		}
+		return set
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		set[words[i]+" "+words[i+1]+" "+words[i+2]] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for k := range a {
+		if b[k] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,194 @@
+// Package email renders the emails Notty sends from Go templates. Each
+// kind of email has a subject, a plain-text and an HTML template; the HTML
+// is put in a shared layout and its stylesheet inlined, since many mail
+// clients ignore <style>. Deployments can replace any template file with
+// their own from a directory.
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"mime"
+	"mime/quotedprintable"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+// Names are the emails there are templates for
+var Names = []string{"event", "digest", "test"}
+
+// Brand is what emails are branded with
+type Brand struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`      // of the web app, linked from every email
+	LogoURL string `json:"logo_url,omitempty"` // shown above the content
+	Color   string `json:"color,omitempty"`    // of headings and links, as CSS
+	Footer  string `json:"footer,omitempty"`
+}
+
+// DefaultBrand is Notty's own
+func DefaultBrand() Brand {
+	return Brand{Name: "Notty", Color: "#2563eb"}
+}
+
+// Data is what a template is executed with. Render adds the Brand.
+type Data map[string]any
+
+// Message is a rendered email
+type Message struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// Templates are the parsed templates of every email
+type Templates struct {
+	brand   Brand
+	subject map[string]*texttemplate.Template
+	text    map[string]*texttemplate.Template
+	html    map[string]*htmltemplate.Template
+	custom  []string // files taken from the directory
+}
+
+// Load parses the built-in templates, with the files in dir in place of
+// those of the same name when dir isn't empty. Files are named
+// <email>.subject.tmpl, <email>.txt.tmpl and <email>.html.tmpl, and
+// layout.html.tmpl wraps the "content" every HTML template defines.
+func Load(dir string, brand Brand) (*Templates, error) {
+	files := map[string]string{}
+	err := fs.WalkDir(builtin, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := builtin.ReadFile(path)
+		files[d.Name()] = string(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{
+		brand:   brand,
+		subject: map[string]*texttemplate.Template{},
+		text:    map[string]*texttemplate.Template{},
+		html:    map[string]*htmltemplate.Template{},
+	}
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			name := filepath.Base(path)
+			if _, ok := files[name]; !ok {
+				return nil, fmt.Errorf("unknown email template %s", name)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = string(data)
+			t.custom = append(t.custom, name)
+		}
+		sort.Strings(t.custom)
+	}
+
+	layout, err := htmltemplate.New("layout").Parse(files["layout.html.tmpl"])
+	if err != nil {
+		return nil, fmt.Errorf("layout.html.tmpl: %w", err)
+	}
+	for _, name := range Names {
+		if t.subject[name], err = texttemplate.New(name).Parse(files[name+".subject.tmpl"]); err != nil {
+			return nil, fmt.Errorf("%s.subject.tmpl: %w", name, err)
+		}
+		if t.text[name], err = texttemplate.New(name).Parse(files[name+".txt.tmpl"]); err != nil {
+			return nil, fmt.Errorf("%s.txt.tmpl: %w", name, err)
+		}
+		page, err := layout.Clone()
+		if err == nil {
+			page, err = page.Parse(files[name+".html.tmpl"])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s.html.tmpl: %w", name, err)
+		}
+		t.html[name] = page
+	}
+	return t, nil
+}
+
+// Custom lists the template files taken from the directory
+func (t *Templates) Custom() []string {
+	return t.custom
+}
+
+// Render executes the templates of an email with data
+func (t *Templates) Render(name string, data Data) (Message, error) {
+	subject, ok := t.subject[name]
+	if !ok {
+		return Message{}, fmt.Errorf("no email template %q", name)
+	}
+	all := Data{"Brand": t.brand}
+	for k, v := range data {
+		all[k] = v
+	}
+	var msg Message
+	var b strings.Builder
+	if err := subject.Execute(&b, all); err != nil {
+		return Message{}, err
+	}
+	msg.Subject = strings.Join(strings.Fields(b.String()), " ") // one header line
+	b.Reset()
+	if err := t.text[name].Execute(&b, all); err != nil {
+		return Message{}, err
+	}
+	msg.Text = b.String()
+	b.Reset()
+	if err := t.html[name].ExecuteTemplate(&b, "layout", all); err != nil {
+		return Message{}, err
+	}
+	html, err := InlineCSS(b.String())
+	if err != nil {
+		return Message{}, err
+	}
+	msg.HTML = html
+	return msg, nil
+}
+
+// Bytes returns the message as an email from from to to, with its text and
+// HTML as alternatives
+func (m Message) Bytes(from string, to []string) []byte {
+	boundary := "notty-" + uuid.NewString()
+	var b bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `multipart/alternative; boundary="` + boundary + `"`},
+	} {
+		b.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	for _, part := range [][2]string{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		b.WriteString("\r\n--" + boundary + "\r\n")
+		b.WriteString("Content-Type: " + part[0] + "; charset=utf-8\r\n")
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		w := quotedprintable.NewWriter(&b)
+		w.Write([]byte(part[1]))
+		w.Close()
+	}
+	b.WriteString("\r\n--" + boundary + "--\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,110 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	templates, err := Load("", Brand{Name: "Acme Notes", Color: "#ff0000", LogoURL: "javascript:alert(1)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := templates.Render("event", Data{
+		"Summary": "Note shared: <script>alert(1)</script>\r\nBcc: x",
+		"Event":   map[string]any{"NoteID": "n1", "At": time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC), "Detail": "a & b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Note shared: <script>alert(1)</script> Bcc: x" {
+		t.Errorf("subject = %q, want it on one line", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "a & b") || !strings.Contains(msg.Text, "At: Thu, 15 Oct 2026 09:00:00 UTC") {
+		t.Errorf("text = %q", msg.Text)
+	}
+	for _, unsafe := range []string{"<script>", "javascript:"} {
+		if strings.Contains(msg.HTML, unsafe) {
+			t.Errorf("HTML contains %s:\n%s", unsafe, msg.HTML)
+		}
+	}
+	if !strings.Contains(msg.HTML, `<h1 style="font-size: 20px; margin: 0 0 16px; color: #ff0000">`) {
+		t.Errorf("heading not styled inline:\n%s", msg.HTML)
+	}
+	if !strings.Contains(msg.HTML, "a &amp; b") || !strings.Contains(msg.HTML, "Acme Notes") {
+		t.Errorf("HTML = %s", msg.HTML)
+	}
+}
+
+func TestLoadFromDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "test.subject.tmpl"), []byte("Hello from {{.Brand.Name}}"), 0o644)
+	templates, err := Load(dir, DefaultBrand())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := templates.Render("test", nil); msg.Subject != "Hello from Notty" {
+		t.Errorf("subject = %q, want the one from the directory", msg.Subject)
+	}
+	if got := templates.Custom(); len(got) != 1 || got[0] != "test.subject.tmpl" {
+		t.Errorf("Custom() = %q", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "event.html.tmpl"), []byte("{{define \"content\"}}{{.Broken"), 0o644)
+	if _, err := Load(dir, DefaultBrand()); err == nil || !strings.Contains(err.Error(), "event.html.tmpl") {
+		t.Errorf("Load() with a broken template: err = %v", err)
+	}
+	os.Remove(filepath.Join(dir, "event.html.tmpl"))
+	os.WriteFile(filepath.Join(dir, "welcome.html.tmpl"), nil, 0o644)
+	if _, err := Load(dir, DefaultBrand()); err == nil {
+		t.Error("Load() accepted an unknown template")
+	}
+}
+
+func TestInlineCSS(t *testing.T) {
+	doc := `<html><head><style>
+/* comment */
+p, .note { color: red; }
+p.note { color: blue }
+#main { margin: 0 }
+a:hover { color: green }
+@media (max-width: 600px) { p { margin: 0 } }
+</style></head><body><div id="main"><p class="note" style="font-weight: bold">x</p><p>y</p></div></body></html>`
+	got, err := InlineCSS(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<div id="main" style="margin: 0">`,
+		`<p class="note" style="color: red; color: red; color: blue; font-weight: bold">x</p>`,
+		`<p style="color: red">y</p>`,
+		`a:hover { color: green }`,
+		`@media (max-width: 600px) { p { margin: 0 } }`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InlineCSS() lacks %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "p.note") {
+		t.Errorf("inlined rule left in <style>:\n%s", got)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	msg := Message{Subject: "Grüße", Text: "plain", HTML: "<p>html</p>"}
+	data := string(msg.Bytes("notty@example.com", []string{"a@example.com", "b@example.com"}))
+	for _, want := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n",
+		"Content-Type: multipart/alternative;",
+		"Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nplain",
+		"Content-Type: text/html; charset=utf-8",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message lacks %q:\n%s", want, data)
+		}
+	}
+}
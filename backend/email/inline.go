@@ -0,0 +1,195 @@
+package email
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// rule is a CSS rule with a selector simple enough to inline
+type rule struct {
+	tag, id string
+	classes []string
+	decls   string
+}
+
+// specificity orders rules like browsers do: ids over classes over tags
+func (r rule) specificity() int {
+	s := len(r.classes) * 10
+	if r.id != "" {
+		s += 100
+	}
+	if r.tag != "" {
+		s++
+	}
+	return s
+}
+
+func (r rule) matches(n *nethtml.Node) bool {
+	if r.tag != "" && r.tag != n.Data {
+		return false
+	}
+	if r.id != "" && attr(n, "id") != r.id {
+		return false
+	}
+	classes := strings.Fields(attr(n, "class"))
+	for _, want := range r.classes {
+		found := false
+		for _, class := range classes {
+			found = found || class == want
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	cssComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	// simpleSelector is a tag, #id and .classes, like p or a.button
+	simpleSelector = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*)?(#[\w-]+)?((?:\.[\w-]+)*)$`)
+)
+
+// parseCSS splits a stylesheet into the rules it can inline and the CSS
+// it can't, like @media blocks and selectors with combinators or pseudo
+// classes, which stay in the <style> element
+func parseCSS(css string) ([]rule, string) {
+	css = cssComment.ReplaceAllString(css, "")
+	var rules []rule
+	var kept strings.Builder
+	for css = strings.TrimSpace(css); css != ""; css = strings.TrimSpace(css) {
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			break
+		}
+		// Find the end of the block, counting nested ones like in @media
+		end, depth := -1, 0
+		for i := open; i < len(css) && end < 0; i++ {
+			switch css[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			break
+		}
+		prelude, body, block := strings.TrimSpace(css[:open]), strings.TrimSpace(css[open+1:end]), css[:end+1]
+		css = css[end+1:]
+
+		var parsed []rule
+		for _, sel := range strings.Split(prelude, ",") {
+			m := simpleSelector.FindStringSubmatch(strings.TrimSpace(sel))
+			if m == nil || m[0] == "" || strings.HasPrefix(prelude, "@") {
+				parsed = nil
+				break
+			}
+			r := rule{tag: strings.ToLower(m[1]), id: strings.TrimPrefix(m[2], "#"), decls: body}
+			if m[3] != "" {
+				r.classes = strings.Split(m[3][1:], ".")
+			}
+			parsed = append(parsed, r)
+		}
+		if parsed == nil {
+			kept.WriteString(block + "\n")
+			continue
+		}
+		rules = append(rules, parsed...)
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].specificity() < rules[j].specificity() })
+	return rules, kept.String()
+}
+
+// InlineCSS moves the rules of the <style> elements of an HTML document
+// into the style attributes of the elements they apply to, before the
+// declarations those already have. Rules it can't inline are left in the
+// first <style> element.
+func InlineCSS(document string) (string, error) {
+	doc, err := nethtml.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", err
+	}
+	var styles []*nethtml.Node
+	var css strings.Builder
+	walk(doc, func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode && n.DataAtom == atom.Style {
+			styles = append(styles, n)
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				css.WriteString(c.Data + "\n")
+			}
+		}
+	})
+	if len(styles) == 0 {
+		return document, nil
+	}
+	rules, kept := parseCSS(css.String())
+	for i, style := range styles {
+		if i == 0 && kept != "" {
+			for c := style.FirstChild; c != nil; c = style.FirstChild {
+				style.RemoveChild(c)
+			}
+			style.AppendChild(&nethtml.Node{Type: nethtml.TextNode, Data: kept})
+			continue
+		}
+		style.Parent.RemoveChild(style)
+	}
+
+	walk(doc, func(n *nethtml.Node) {
+		if n.Type != nethtml.ElementNode || n.DataAtom == atom.Style || n.DataAtom == atom.Head {
+			return
+		}
+		var decls []string
+		for _, r := range rules {
+			if r.matches(n) {
+				decls = append(decls, strings.TrimSuffix(r.decls, ";"))
+			}
+		}
+		if len(decls) == 0 {
+			return
+		}
+		if own := strings.TrimSpace(attr(n, "style")); own != "" {
+			decls = append(decls, strings.TrimSuffix(own, ";"))
+		}
+		setAttr(n, "style", strings.Join(decls, "; "))
+	})
+	var b strings.Builder
+	if err := nethtml.Render(&b, doc); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func walk(n *nethtml.Node, f func(*nethtml.Node)) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling // f may remove c
+		f(c)
+		walk(c, f)
+		c = next
+	}
+}
+
+func attr(n *nethtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *nethtml.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, nethtml.Attribute{Key: key, Val: val})
+}
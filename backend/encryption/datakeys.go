@@ -0,0 +1,146 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"note/backend/cache"
+	"sync"
+)
+
+// dataKeySize is the length of data keys: AES-256
+const dataKeySize = 32
+
+// ErrWrongWorkspace means a data key or sealed data belongs to another
+// workspace than it was opened for
+var ErrWrongWorkspace = errors.New("sealed for another workspace")
+
+// DataKeys seals the data of each workspace with a key of its own, its
+// data key. Data keys are random and only ever stored wrapped, sealed by
+// the primary key of a master keyring, so data of one workspace can't be
+// opened with the data key of another and no data key is any use without
+// the master keys.
+//
+// A workspace keeps its data key while the process runs, or from the
+// first data of it that is opened. Unwrapped keys are cached so opening
+// many pieces of data sealed with the same key unwraps it once.
+type DataKeys struct {
+	master *Keyring
+
+	mu   sync.Mutex
+	keys map[string]dataKey // in use, by workspace
+
+	unwrapped *cache.LRU[string, *Keyring] // by wrapped key
+}
+
+type dataKey struct {
+	wrapped []byte
+	ring    *Keyring
+}
+
+// NewDataKeys returns data keys wrapped by master, keeping up to
+// cacheSize unwrapped keys
+func NewDataKeys(master *Keyring, cacheSize int) *DataKeys {
+	return &DataKeys{
+		master:    master,
+		keys:      map[string]dataKey{},
+		unwrapped: cache.New[string, *Keyring](cacheSize),
+	}
+}
+
+// Seal encrypts plaintext with the data key of workspace, making one if
+// it has none yet, and returns it with the wrapped data key to open it
+func (d *DataKeys) Seal(workspace string, plaintext []byte) (sealed, wrappedKey []byte, err error) {
+	d.mu.Lock()
+	key, ok := d.keys[workspace]
+	if !ok {
+		raw := make([]byte, dataKeySize)
+		if _, err := rand.Read(raw); err != nil {
+			d.mu.Unlock()
+			return nil, nil, err
+		}
+		// The workspace is wrapped with the key, so it can't be passed off
+		// as the key of another
+		wrapped, err := d.master.Seal(append(raw, workspace...))
+		if err != nil {
+			d.mu.Unlock()
+			return nil, nil, err
+		}
+		ring := &Keyring{keys: map[string]cipher.AEAD{}}
+		if err := ring.add(dataKeyID(workspace), raw); err != nil {
+			d.mu.Unlock()
+			return nil, nil, err
+		}
+		key = dataKey{wrapped: wrapped, ring: ring}
+		d.keys[workspace] = key
+	}
+	d.mu.Unlock()
+	sealed, err = key.ring.Seal(plaintext)
+	return sealed, key.wrapped, err
+}
+
+// Open decrypts data of workspace sealed with the given wrapped data key
+func (d *DataKeys) Open(workspace string, wrappedKey, sealed []byte) ([]byte, error) {
+	ring, err := d.unwrap(workspace, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ring.Open(sealed)
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, ErrWrongWorkspace
+	}
+	return data, err
+}
+
+// unwrap returns the data key of workspace wrapped in wrappedKey, from the
+// cache if it was unwrapped before. The first key unwrapped for a
+// workspace stays its key when it has none.
+func (d *DataKeys) unwrap(workspace string, wrappedKey []byte) (*Keyring, error) {
+	if ring, ok := d.unwrapped.Get(string(wrappedKey)); ok {
+		if _, ok := ring.keys[dataKeyID(workspace)]; !ok {
+			return nil, ErrWrongWorkspace
+		}
+		return ring, nil
+	}
+	if !Sealed(wrappedKey) {
+		return nil, errors.New("not a wrapped data key")
+	}
+	plain, err := d.master.Open(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(plain) < dataKeySize {
+		return nil, errors.New("not a wrapped data key")
+	}
+	raw, owner := plain[:dataKeySize], plain[dataKeySize:]
+	if !bytes.Equal(owner, []byte(workspace)) {
+		return nil, ErrWrongWorkspace
+	}
+	ring := &Keyring{keys: map[string]cipher.AEAD{}}
+	if err := ring.add(dataKeyID(workspace), raw); err != nil {
+		return nil, err
+	}
+	d.unwrapped.Add(string(wrappedKey), ring)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.keys[workspace]; !ok {
+		d.keys[workspace] = dataKey{wrapped: wrappedKey, ring: ring}
+	}
+	return ring, nil
+}
+
+// CacheStats returns the counters of the unwrapped key cache
+func (d *DataKeys) CacheStats() cache.Stats {
+	return d.unwrapped.Stats()
+}
+
+// dataKeyID is the key ID data of a workspace is sealed with, which keeps
+// data from being opened as that of another workspace
+func dataKeyID(workspace string) string {
+	sum := sha256.Sum256([]byte(workspace))
+	return "ws-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,67 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	k, err := ParseKeyring("master:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestDataKeys(t *testing.T) {
+	master := testKeyring(t)
+	d := NewDataKeys(master, 8)
+	sealedA, keyA, err := d.Seal("acme", []byte("notes of acme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedB, keyB, err := d.Seal("globex", []byte("notes of globex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keyA, keyB) {
+		t.Fatal("workspaces share a data key")
+	}
+	if _, key, _ := d.Seal("acme", []byte("more")); !bytes.Equal(key, keyA) {
+		t.Error("a workspace got a second data key")
+	}
+
+	// After a restart the wrapped keys open what they sealed, once
+	restarted := NewDataKeys(master, 8)
+	for range 3 {
+		data, err := restarted.Open("acme", keyA, sealedA)
+		if err != nil || string(data) != "notes of acme" {
+			t.Fatalf("opening acme = %q, %v", data, err)
+		}
+	}
+	if stats := restarted.CacheStats(); stats.Misses != 1 || stats.Hits != 2 {
+		t.Errorf("cache = %+v, want the key unwrapped once", stats)
+	}
+	if _, key, _ := restarted.Seal("acme", []byte("after restart")); !bytes.Equal(key, keyA) {
+		t.Error("a workspace didn't keep the data key it was restored with")
+	}
+
+	// Neither keys nor data pass for those of another workspace
+	for name, open := range map[string]func() ([]byte, error){
+		"key of another":     func() ([]byte, error) { return restarted.Open("globex", keyA, sealedB) },
+		"data of another":    func() ([]byte, error) { return restarted.Open("acme", keyA, sealedB) },
+		"claimed by another": func() ([]byte, error) { return NewDataKeys(master, 8).Open("globex", keyA, sealedA) },
+	} {
+		if _, err := open(); !errors.Is(err, ErrWrongWorkspace) {
+			t.Errorf("%s: %v, want ErrWrongWorkspace", name, err)
+		}
+	}
+
+	other, _ := ParseKeyring("other:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)))
+	if _, err := NewDataKeys(other, 8).Open("acme", keyA, sealedA); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("opening without the master key: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// magic starts every sealed blob, followed by a version byte, the length
+// of the key ID, the key ID, the nonce and the AES-GCM ciphertext.
+var magic = []byte("NTYE")
+
+const version = 1
+
+// ErrUnknownKey means data was sealed with a key the keyring doesn't have
+var ErrUnknownKey = errors.New("encrypted with an unknown key")
+
+// Keyring holds the AES keys used for encryption at rest. The primary key
+// seals new data; older keys stay around so data sealed before a key
+// rotation can still be opened.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeyring reads keys in the form "id:base64key,id:base64key". The
+// first key is the primary one. Keys must be 16, 24 or 32 bytes long.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, pair := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid key entry %q, want id:base64key", pair)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if err := k.add(id, raw); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// add adds a key, the primary one if it is the first
+func (k *Keyring) add(id string, raw []byte) error {
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return fmt.Errorf("key %s: %w", id, err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	if _, dup := k.keys[id]; dup {
+		return fmt.Errorf("duplicate key id %s", id)
+	}
+	k.keys[id] = gcm
+	if k.primary == "" {
+		k.primary = id
+	}
+	return nil
+}
+
+// Seal encrypts plaintext with the primary key
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	gcm := k.keys[k.primary]
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte{}, magic...)
+	out = append(out, version, byte(len(k.primary)))
+	out = append(out, k.primary...)
+	out = append(out, nonce...)
+	// The header is authenticated too, so the key ID can't be swapped
+	header := append([]byte{}, out...)
+	return gcm.Seal(out, nonce, plaintext, header), nil
+}
+
+// Open decrypts data sealed by any key in the keyring. Data that was never
+// sealed is returned unchanged, which keeps files written before
+// encryption was turned on readable.
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+	if !Sealed(data) {
+		return data, nil
+	}
+	rest := data[len(magic):]
+	if len(rest) < 2 || rest[0] != version {
+		return nil, errors.New("unsupported encryption format")
+	}
+	idLen := int(rest[1])
+	rest = rest[2:]
+	if len(rest) < idLen {
+		return nil, errors.New("truncated encrypted data")
+	}
+	gcm, ok := k.keys[string(rest[:idLen])]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, rest[:idLen])
+	}
+	rest = rest[idLen:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("truncated encrypted data")
+	}
+	header := data[:len(data)-len(rest)+gcm.NonceSize()]
+	return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+}
+
+// Sealed reports whether data looks like the output of Seal
+func Sealed(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
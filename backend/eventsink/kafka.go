@@ -0,0 +1,66 @@
+package eventsink
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Kafka publishes to a Kafka cluster, waiting for every in-sync replica.
+// Messages go to the partition their key hashes to, as with the Java
+// client, so the changes of a note stay in order.
+type Kafka struct {
+	client *kgo.Client
+}
+
+// kafkaTimeout bounds connecting, and how long brokers may take to get a
+// batch replicated
+const kafkaTimeout = 10 * time.Second
+
+// DialKafka connects to a URL like kafka://host:9092, or
+// kafka://host1:9092,host2:9092 with more than one bootstrap broker
+func DialKafka(u *url.URL) (*Kafka, error) {
+	var seeds []string
+	for _, addr := range strings.Split(u.Host, ",") {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "9092")
+		}
+		seeds = append(seeds, addr)
+	}
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(seeds...),
+		kgo.ClientID("notty"),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.ProduceRequestTimeout(kafkaTimeout),
+		kgo.DialTimeout(kafkaTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Kafka{client: client}, nil
+}
+
+func (k *Kafka) Publish(msgs []Message) error {
+	records := make([]*kgo.Record, len(msgs))
+	for i, m := range msgs {
+		records[i] = &kgo.Record{Topic: m.Topic, Key: []byte(m.Key), Value: m.Value}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*kafkaTimeout)
+	defer cancel()
+	return k.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+func (k *Kafka) Close() error {
+	k.client.Close()
+	return nil
+}
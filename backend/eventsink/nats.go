@@ -0,0 +1,167 @@
+package eventsink
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATS publishes to a NATS server. It speaks just enough of the client
+// protocol to publish, and makes sure the server got a batch by
+// following it with a PING and waiting for the PONG.
+type NATS struct {
+	addr    string
+	connect []byte // the CONNECT line
+
+	mu         sync.Mutex
+	conn       net.Conn
+	r          *bufio.Reader
+	maxPayload int
+}
+
+// natsTimeout bounds connecting and waiting for the server to answer
+const natsTimeout = 10 * time.Second
+
+// DialNATS connects to a URL like nats://[user:password@]host:4222, or
+// nats://token@host:4222 to authenticate with a token
+func DialNATS(u *url.URL) (*NATS, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	opts := map[string]any{"verbose": false, "pedantic": false, "lang": "go", "version": "1", "protocol": 0, "name": "notty"}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), password
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	n := &NATS{addr: addr, connect: append(append([]byte("CONNECT "), data...), "\r\n"...)}
+	if err := n.dial(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *NATS) Publish(msgs []Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	err := n.publish(msgs)
+	var serverErr natsError
+	if err == nil || errors.As(err, &serverErr) {
+		return err
+	}
+	// The connection may just have been dropped: try once more on a new one
+	if err := n.dial(); err != nil {
+		return err
+	}
+	return n.publish(msgs)
+}
+
+func (n *NATS) publish(msgs []Message) error {
+	if n.conn == nil {
+		return errors.New("nats: not connected")
+	}
+	var b strings.Builder
+	for _, m := range msgs {
+		if n.maxPayload > 0 && len(m.Value) > n.maxPayload {
+			return natsError(fmt.Sprintf("message of %d bytes is over the server's limit of %d", len(m.Value), n.maxPayload))
+		}
+		fmt.Fprintf(&b, "PUB %s %d\r\n%s\r\n", m.Topic, len(m.Value), m.Value)
+	}
+	b.WriteString("PING\r\n")
+	n.conn.SetDeadline(time.Now().Add(natsTimeout))
+	if _, err := n.conn.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	return n.pong()
+}
+
+// pong reads until the server answers a PING, answering its own PINGs
+func (n *NATS) pong() error {
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return natsError(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+// dial (re)connects and introduces the client. Callers must hold mu,
+// except DialNATS.
+func (n *NATS) dial() error {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	conn, err := net.DialTimeout("tcp", n.addr, natsTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	info, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		conn.Close()
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	var server struct {
+		MaxPayload int `json:"max_payload"`
+	}
+	json.Unmarshal([]byte(info), &server)
+	if _, err := conn.Write(append(n.connect, "PING\r\n"...)); err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn, n.r, n.maxPayload = conn, r, server.MaxPayload
+	if err := n.pong(); err != nil {
+		conn.Close()
+		n.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+// natsError is an error the server sent
+type natsError string
+
+func (e natsError) Error() string { return "nats: " + string(e) }
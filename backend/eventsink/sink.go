@@ -0,0 +1,128 @@
+// Package eventsink publishes the note change log to a message broker,
+// NATS or Kafka, so data platforms can follow note activity without
+// polling the changes endpoint.
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"note/backend/models"
+	"strings"
+	"time"
+)
+
+// Message is one change as it is published. Key is the ID of the note,
+// which keeps the changes of a note in order on Kafka.
+type Message struct {
+	Topic string
+	Key   string
+	Value []byte
+}
+
+// Publisher sends messages to a broker. Publish returns once the broker
+// took all of them, or with an error if it may not have.
+type Publisher interface {
+	Publish(msgs []Message) error
+	Close() error
+}
+
+// Open connects to the broker of a URL like nats://host:4222 or
+// kafka://host:9092
+func Open(rawURL string) (Publisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("event sink url must look like nats://host:port or kafka://host:port")
+	}
+	switch u.Scheme {
+	case "nats":
+		return DialNATS(u)
+	case "kafka":
+		return DialKafka(u)
+	}
+	return nil, fmt.Errorf("event sink url must start with nats:// or kafka://, not %s://", u.Scheme)
+}
+
+// Topic names where changes are published. "{op}" in it is replaced by
+// the operation of the change, so "notty.notes.{op}" publishes creates to
+// notty.notes.create.
+type Topic string
+
+// For returns the topic of a change with the given operation
+func (t Topic) For(op string) string {
+	return strings.ReplaceAll(string(t), "{op}", op)
+}
+
+// Source is the change log to publish, like handlers.PublishedChanges
+type Source interface {
+	// Watch returns the changes after since and a channel closed once
+	// there are more
+	Watch(since int64) ([]models.Change, <-chan struct{}, error)
+	// Latest is the sequence of the last change
+	Latest() int64
+}
+
+// batchSize is the most changes published at once
+const batchSize = 500
+
+// Retries of failed publishes wait from minBackoff to maxBackoff
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Run publishes every change made from now on until ctx is done. Changes
+// that fail to publish are retried, in order, until the broker takes
+// them; if the change log drops them in the meantime they are skipped.
+func Run(ctx context.Context, src Source, pub Publisher, topic Topic) {
+	since := src.Latest()
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		pending, changed, err := src.Watch(since)
+		if err != nil {
+			latest := src.Latest()
+			log.Printf("event sink: %v; skipping changes %d to %d", err, since+1, latest)
+			since = latest
+			continue
+		}
+		if len(pending) == 0 {
+			select {
+			case <-changed:
+			case <-ctx.Done():
+			}
+			continue
+		}
+		if len(pending) > batchSize {
+			pending = pending[:batchSize]
+		}
+		msgs, err := messages(pending, topic)
+		if err == nil {
+			err = pub.Publish(msgs)
+		}
+		if err != nil {
+			log.Printf("event sink: publishing changes %d to %d: %v", pending[0].Seq, pending[len(pending)-1].Seq, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+			}
+			backoff = min(2*backoff, maxBackoff)
+			continue
+		}
+		backoff = minBackoff
+		since = pending[len(pending)-1].Seq
+	}
+}
+
+func messages(changes []models.Change, topic Topic) ([]Message, error) {
+	msgs := make([]Message, len(changes))
+	for i, change := range changes {
+		value, err := json.Marshal(change)
+		if err != nil {
+			return nil, err
+		}
+		msgs[i] = Message{Topic: topic.For(change.Op), Key: change.NoteID, Value: value}
+	}
+	return msgs, nil
+}
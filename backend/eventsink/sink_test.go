@@ -0,0 +1,230 @@
+package eventsink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"note/backend/models"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// fakeSource is a change log that changes once
+type fakeSource struct {
+	changes []models.Change
+	changed chan struct{}
+}
+
+func (s *fakeSource) Watch(since int64) ([]models.Change, <-chan struct{}, error) {
+	var pending []models.Change
+	for _, change := range s.changes {
+		if change.Seq > since {
+			pending = append(pending, change)
+		}
+	}
+	return pending, s.changed, nil
+}
+
+func (s *fakeSource) Latest() int64 { return 0 }
+
+// fakePublisher fails its first publish
+type fakePublisher struct {
+	mu        sync.Mutex
+	failed    bool
+	published []Message
+	done      chan struct{}
+	want      int
+}
+
+func (p *fakePublisher) Publish(msgs []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.failed {
+		p.failed = true
+		return errors.New("broker is down")
+	}
+	p.published = append(p.published, msgs...)
+	if len(p.published) == p.want {
+		close(p.done)
+	}
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+func TestTopic(t *testing.T) {
+	if got := Topic("notty.{op}").For("create"); got != "notty.create" {
+		t.Errorf("topic is %q", got)
+	}
+	if got := Topic("notty.changes").For("create"); got != "notty.changes" {
+		t.Errorf("topic is %q", got)
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	src := &fakeSource{changed: make(chan struct{})}
+	for i, op := range []string{"create", "update", "delete"} {
+		src.changes = append(src.changes, models.Change{Seq: int64(i + 1), Op: op, NoteID: "n1"})
+	}
+	pub := &fakePublisher{done: make(chan struct{}), want: 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Run(ctx, src, pub, "notes.{op}")
+
+	select {
+	case <-pub.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("changes were not published")
+	}
+	for i, m := range pub.published {
+		var change models.Change
+		if err := json.Unmarshal(m.Value, &change); err != nil {
+			t.Fatal(err)
+		}
+		if change.Seq != int64(i+1) || m.Topic != "notes."+change.Op || m.Key != "n1" {
+			t.Errorf("message %d is %s %s: %+v", i, m.Topic, m.Key, change)
+		}
+	}
+}
+
+// listen starts a fake broker that serves every connection with serve
+func listen(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNATS(t *testing.T) {
+	received := make(chan string, 10)
+	addr := listen(t, func(conn net.Conn) {
+		io.WriteString(conn, `INFO {"max_payload":64}`+"\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch fields := strings.Fields(line); fields[0] {
+			case "CONNECT":
+				if !strings.Contains(line, `"auth_token":"secret"`) {
+					io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+					return
+				}
+			case "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case "PUB":
+				size, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, size+2)
+				io.ReadFull(r, payload)
+				received <- fields[1] + " " + string(payload[:size])
+			}
+		}
+	})
+
+	u, _ := url.Parse("nats://secret@" + addr)
+	n, err := DialNATS(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	if err := n.Publish([]Message{{Topic: "a", Value: []byte("one")}, {Topic: "b", Value: []byte("two")}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a one", "b two"} {
+		if got := <-received; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if err := n.Publish([]Message{{Topic: "a", Value: make([]byte, 65)}}); err == nil {
+		t.Error("a message over max_payload was published")
+	}
+
+	// A dropped connection is dialed again
+	n.conn.Close()
+	if err := n.Publish([]Message{{Topic: "c", Value: []byte("three")}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "c three" {
+		t.Errorf("got %q after reconnecting", got)
+	}
+
+	u, _ = url.Parse("nats://wrong@" + addr)
+	if _, err := DialNATS(u); err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("dialing with a wrong token: %v", err)
+	}
+}
+
+func TestKafka(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, "changes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	u, _ := url.Parse("kafka://" + strings.Join(cluster.ListenAddrs(), ","))
+	k, err := DialKafka(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	msgs := []Message{
+		{Topic: "changes", Key: "n1", Value: []byte("first")},
+		{Topic: "changes", Key: "n2", Value: []byte("other")},
+		{Topic: "changes", Key: "n1", Value: []byte("second")},
+	}
+	if err := k.Publish(msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("changes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	byKey := map[string][]*kgo.Record{}
+	for got := 0; got < len(msgs); {
+		fetches := consumer.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatal("records did not arrive")
+		}
+		fetches.EachRecord(func(rec *kgo.Record) {
+			byKey[string(rec.Key)] = append(byKey[string(rec.Key)], rec)
+			got++
+		})
+	}
+	n1 := byKey["n1"]
+	if len(n1) != 2 || string(n1[0].Value) != "first" || string(n1[1].Value) != "second" || n1[0].Partition != n1[1].Partition {
+		t.Errorf("records of n1 are %+v", n1)
+	}
+	if len(byKey["n2"]) != 1 || byKey["n2"][0].Topic != "changes" {
+		t.Errorf("records of n2 are %+v", byKey["n2"])
+	}
+}
@@ -0,0 +1,101 @@
+package export
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"note/backend/models"
+	"path"
+	"time"
+)
+
+// AttachmentsFormat identifies the layout of attachment archives
+const AttachmentsFormat = "notty-attachments/1"
+
+// AttachmentFile is an attachment with its file and the title of its note
+type AttachmentFile struct {
+	models.Attachment
+	NoteTitle string
+	Data      []byte
+}
+
+// AttachmentEntry describes one file of an attachment archive
+type AttachmentEntry struct {
+	Path string `json:"path"`
+	models.Attachment
+	NoteTitle string `json:"note_title"`
+	SHA256    string `json:"sha256"`
+}
+
+// AttachmentManifest is the manifest.json of an attachment archive
+type AttachmentManifest struct {
+	Format      string            `json:"format"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	Notebook    string            `json:"notebook,omitempty"`
+	Attachments []AttachmentEntry `json:"attachments"`
+}
+
+// WriteAttachments writes attachments as a zip archive with manifest.json.
+// Files are grouped in a folder per note when they come from more than
+// one; names repeating within a folder get the start of their ID.
+func WriteAttachments(w io.Writer, notebook string, files []AttachmentFile) error {
+	manifest := AttachmentManifest{Format: AttachmentsFormat, ExportedAt: time.Now(), Notebook: notebook, Attachments: []AttachmentEntry{}}
+	folders := map[string]string{} // by note ID
+	usedFolders := map[string]bool{}
+	for _, f := range files {
+		if _, ok := folders[f.NoteID]; !ok {
+			name := slug(f.NoteTitle)
+			if usedFolders[name] {
+				name = fmt.Sprintf("%s-%s", name, f.NoteID[:8])
+			}
+			usedFolders[name] = true
+			folders[f.NoteID] = name
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	used := map[string]bool{ManifestFile: true}
+	for _, f := range files {
+		name := path.Base(f.Name)
+		if name == "." || name == "/" || name == "" {
+			name = "attachment"
+		}
+		if len(folders) > 1 {
+			name = path.Join(folders[f.NoteID], name)
+		}
+		if used[name] {
+			dir, base := path.Split(name)
+			name = dir + f.ID[:8] + "-" + base
+		}
+		used[name] = true
+
+		zf, err := create(zw, name, f.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if _, err := zf.Write(f.Data); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(f.Data)
+		manifest.Attachments = append(manifest.Attachments, AttachmentEntry{
+			Path:       name,
+			Attachment: f.Attachment,
+			NoteTitle:  f.NoteTitle,
+			SHA256:     hex.EncodeToString(sum[:]),
+		})
+	}
+
+	zf, err := create(zw, ManifestFile, manifest.ExportedAt)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(zf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,200 @@
+package export
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"note/backend/links"
+	"note/backend/models"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format identifies the bundle layout in the manifest
+const Format = "notty-bundle/1"
+
+// Asset is a file that belongs to a note and is shipped next to it
+type Asset struct {
+	Name string
+	Data []byte
+}
+
+// Manifest describes every file in a bundle so importers don't have to
+// guess from file names, and lets anyone check none of them was changed
+// since the export.
+type Manifest struct {
+	Format     string         `json:"format"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Notebook   string         `json:"notebook,omitempty"`
+	Notes      []ManifestNote `json:"notes"`
+
+	// Signer is who asked for the export, like the ID of their API key
+	Signer string     `json:"signer,omitempty"`
+	Files  []FileHash `json:"files"`
+	// KeyID names the server key manifest.sig was made with, when the
+	// server signs exports
+	KeyID string `json:"key_id,omitempty"`
+}
+
+// ManifestNote is one note of a bundle
+type ManifestNote struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Notebook  string    `json:"notebook,omitempty"`
+	Path      string    `json:"path"`
+	Assets    []string  `json:"assets,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// ContentEncrypted means the file holds the client's ciphertext as is
+	ContentEncrypted bool `json:"content_encrypted,omitempty"`
+}
+
+// Bundle is a set of notes exported together. Assets are keyed by note ID.
+type Bundle struct {
+	Notebook string
+	Notes    []models.Note
+	Assets   map[string][]Asset
+
+	// Signer goes in the manifest. With a Key the manifest is signed too.
+	Signer string
+	Key    ed25519.PrivateKey
+}
+
+// WriteZip writes the bundle as a zip archive: one Markdown file per
+// note at the root, their assets under assets/<note>/, manifest.json and,
+// when the bundle has a key, manifest.sig.
+func (b Bundle) WriteZip(w io.Writer) error {
+	paths := b.paths()
+	manifest := Manifest{Format: Format, ExportedAt: time.Now(), Notebook: b.Notebook, Signer: b.Signer}
+	if b.Key != nil {
+		manifest.KeyID = KeyID(b.Key.Public().(ed25519.PublicKey))
+	}
+	write := func(zw *zip.Writer, name string, modified time.Time, data []byte) error {
+		f, err := create(zw, name, modified)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, FileHash{Path: name, SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data))})
+		_, err = f.Write(data)
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for _, note := range b.Notes {
+		entry := ManifestNote{
+			ID:        note.ID,
+			Title:     note.Title,
+			Notebook:  note.Notebook,
+			Path:      paths[note.ID],
+			CreatedAt: note.CreatedAt,
+			UpdatedAt: note.UpdatedAt,
+
+			ContentEncrypted: note.ContentEncrypted,
+		}
+
+		if err := write(zw, entry.Path, note.UpdatedAt, []byte(b.markdown(note, paths))); err != nil {
+			return err
+		}
+
+		for _, asset := range b.Assets[note.ID] {
+			name := path.Join("assets", strings.TrimSuffix(entry.Path, ".md"), path.Base(asset.Name))
+			if err := write(zw, name, note.UpdatedAt, asset.Data); err != nil {
+				return err
+			}
+			entry.Assets = append(entry.Assets, name)
+		}
+		manifest.Notes = append(manifest.Notes, entry)
+	}
+
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	raw = append(raw, '\n')
+	f, err := create(zw, ManifestFile, manifest.ExportedAt)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(raw); err != nil {
+		return err
+	}
+	if b.Key != nil {
+		f, err := create(zw, SignatureFile, manifest.ExportedAt)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, base64.StdEncoding.EncodeToString(ed25519.Sign(b.Key, raw))+"\n"); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// create adds a compressed file that carries a real modification time
+func create(zw *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+}
+
+// markdown renders a note with its links to other exported notes pointing
+// at their files. Links to notes outside the bundle are left untouched.
+func (b Bundle) markdown(note models.Note, paths map[string]string) string {
+	if note.ContentEncrypted {
+		return note.Content
+	}
+	content := links.NoteURL.ReplaceAllStringFunc(note.Content, func(link string) string {
+		id := links.NoteURL.FindStringSubmatch(link)[1]
+		if n, err := strconv.Atoi(id); err == nil {
+			id = models.LegacyNoteID(n)
+		}
+		if p, ok := paths[id]; ok {
+			return p
+		}
+		return link
+	})
+	return "# " + note.Title + "\n\n" + content + "\n"
+}
+
+// paths gives every note a unique file name derived from its title
+func (b Bundle) paths() map[string]string {
+	paths := make(map[string]string, len(b.Notes))
+	used := make(map[string]bool)
+	for _, note := range b.Notes {
+		name := slug(note.Title)
+		if used[name] {
+			name = fmt.Sprintf("%s-%s", name, note.ID[:8])
+		}
+		used[name] = true
+		paths[note.ID] = name + ".md"
+	}
+	return paths
+}
+
+// slug turns a title into a file name that is safe on every platform
+func slug(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r > 127:
+			sb.WriteRune(r)
+			dash = false
+		case !dash && sb.Len() > 0:
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(sb.String(), "-")
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Kinds of graph nodes
+const (
+	NodeNote     = "note"
+	NodeNotebook = "notebook"
+)
+
+// EdgeInNotebook links a note to its notebook and EdgeLinksTo a note to
+// one its content links to; other edges are named after the note relation
+// they stand for
+const (
+	EdgeInNotebook = "in-notebook"
+	EdgeLinksTo    = "links-to"
+)
+
+// Graph is a knowledge base as nodes and edges, for visualizing it in
+// other tools
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Node is a note or a notebook. Notebook node IDs are prefixed with
+// "notebook:" so they can't clash with note IDs.
+type Node struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Label    string `json:"label"`
+	Notebook string `json:"notebook,omitempty"`
+}
+
+// Edge goes from Source to Target unless Undirected is set
+type Edge struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	Undirected bool   `json:"undirected,omitempty"`
+}
+
+// graphML mirrors the subset of the GraphML format WriteGraphML writes
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID       string        `xml:"id,attr"`
+	Source   string        `xml:"source,attr"`
+	Target   string        `xml:"target,attr"`
+	Directed bool          `xml:"directed,attr"`
+	Data     []graphMLData `xml:"data"`
+}
+
+// WriteGraphML writes g in GraphML, which tools like Gephi, yEd and
+// Cytoscape open
+func WriteGraphML(w io.Writer, g Graph) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "notebook", For: "node", AttrName: "notebook", AttrType: "string"},
+			{ID: "edge_kind", For: "edge", AttrName: "kind", AttrType: "string"},
+		},
+	}
+	doc.Graph.ID = "notes"
+	doc.Graph.EdgeDefault = "directed"
+	for _, n := range g.Nodes {
+		node := graphMLNode{ID: n.ID, Data: []graphMLData{{"kind", n.Kind}, {"label", n.Label}}}
+		if n.Notebook != "" {
+			node.Data = append(node.Data, graphMLData{"notebook", n.Notebook})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:       e.ID,
+			Source:   e.Source,
+			Target:   e.Target,
+			Directed: !e.Undirected,
+			Data:     []graphMLData{{"edge_kind", e.Kind}},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,146 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Names of the files that make a bundle verifiable. The manifest lists
+// the SHA-256 of every other file; the signature covers the manifest.
+const (
+	ManifestFile  = "manifest.json"
+	SignatureFile = "manifest.sig"
+)
+
+// FileHash is the SHA-256 of one file of a bundle
+type FileHash struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// ParseSigningKey reads an Ed25519 signing key: its 32-byte seed in
+// base64
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes of base64", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// KeyID names a public key in manifests: the start of its SHA-256 in hex
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Verification is what Verify found out about a bundle
+type Verification struct {
+	// Valid is set when every file matches the manifest, and the
+	// signature the key, if there is one
+	Valid    bool     `json:"valid"`
+	Signed   bool     `json:"signed"`
+	Manifest Manifest `json:"manifest"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// ErrNoManifest is returned for archives that aren't bundles
+var ErrNoManifest = errors.New("archive has no manifest.json")
+
+// Verify checks the files of a zip bundle against the SHA-256 in its
+// manifest, and its signature with key when key isn't nil. Signed bundles
+// only count as valid with a key to check them against. It returns an
+// error only when the archive can't be read as a bundle at all.
+func Verify(r io.ReaderAt, size int64, key ed25519.PublicKey) (Verification, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Verification{}, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if files[ManifestFile] == nil {
+		return Verification{}, ErrNoManifest
+	}
+	raw, err := read(files[ManifestFile])
+	if err != nil {
+		return Verification{}, err
+	}
+	var v Verification
+	if err := json.Unmarshal(raw, &v.Manifest); err != nil {
+		return Verification{}, fmt.Errorf("reading manifest: %w", err)
+	}
+	problem := func(format string, args ...any) { v.Problems = append(v.Problems, fmt.Sprintf(format, args...)) }
+	if len(v.Manifest.Files) == 0 {
+		problem("the manifest has no file hashes")
+	}
+
+	listed := map[string]bool{ManifestFile: true, SignatureFile: true}
+	for _, want := range v.Manifest.Files {
+		listed[want.Path] = true
+		f := files[want.Path]
+		if f == nil {
+			problem("%s is missing", want.Path)
+			continue
+		}
+		data, err := read(f)
+		if err != nil {
+			problem("%s can't be read: %v", want.Path, err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != want.SHA256 || int64(len(data)) != want.Size {
+			problem("%s was changed", want.Path)
+		}
+	}
+	var extra []string
+	for name := range files {
+		if !listed[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		problem("%s isn't in the manifest", name)
+	}
+
+	if sig := files[SignatureFile]; sig != nil {
+		v.Signed = true
+		encoded, err := read(sig)
+		signature, decodeErr := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+		switch {
+		case err != nil || decodeErr != nil:
+			problem("the signature can't be read")
+		case key == nil:
+			problem("the export is signed, but there is no key to check the signature with")
+		case v.Manifest.KeyID != KeyID(key):
+			problem("the export was signed with key %s, not %s", v.Manifest.KeyID, KeyID(key))
+		case !ed25519.Verify(key, raw, signature):
+			problem("the signature doesn't match the manifest")
+		}
+	} else if v.Manifest.KeyID != "" {
+		problem("the signature is missing")
+	}
+	v.Valid = len(v.Problems) == 0
+	return v, nil
+}
+
+func read(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,151 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io"
+	"note/backend/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSeed = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+
+func testBundle(key ed25519.PrivateKey) []byte {
+	now := time.Now()
+	b := Bundle{
+		Notes: []models.Note{
+			{ID: "a", Title: "First", Content: "Hello", CreatedAt: now, UpdatedAt: now},
+			{ID: "b", Title: "Second", Content: "World", CreatedAt: now, UpdatedAt: now},
+		},
+		Assets: map[string][]Asset{"a": {{Name: "photo.png", Data: []byte("png")}}},
+		Signer: "key-1",
+		Key:    key,
+	}
+	var buf bytes.Buffer
+	if err := b.WriteZip(&buf); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// rewrite copies a zip archive, letting change replace or drop its files,
+// and adds the files of add
+func rewrite(t *testing.T, data []byte, change func(name string, data []byte) ([]byte, bool), add map[string]string) []byte {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		content, err := read(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, keep := change(f.Name, content)
+		if !keep {
+			continue
+		}
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	for name, content := range add {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func keep(name string, data []byte) ([]byte, bool) { return data, true }
+
+func verify(t *testing.T, data []byte, key ed25519.PublicKey) Verification {
+	t.Helper()
+	v, err := Verify(bytes.NewReader(data), int64(len(data)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	data := testBundle(nil)
+	v := verify(t, data, nil)
+	if !v.Valid || v.Signed || len(v.Manifest.Files) != 3 || v.Manifest.Signer != "key-1" {
+		t.Fatalf("Verify = %+v", v)
+	}
+
+	changed := rewrite(t, data, func(name string, data []byte) ([]byte, bool) {
+		if strings.HasSuffix(name, ".md") && bytes.Contains(data, []byte("Hello")) {
+			return bytes.Replace(data, []byte("Hello"), []byte("Howdy"), 1), true
+		}
+		return data, true
+	}, nil)
+	if v := verify(t, changed, nil); v.Valid || len(v.Problems) != 1 || !strings.HasSuffix(v.Problems[0], "was changed") {
+		t.Errorf("Verify of a changed note = %+v", v)
+	}
+
+	added := rewrite(t, data, keep, map[string]string{"extra.md": "sneaked in"})
+	if v := verify(t, added, nil); v.Valid || len(v.Problems) != 1 {
+		t.Errorf("Verify with an extra file = %+v", v)
+	}
+
+	removed := rewrite(t, data, func(name string, data []byte) ([]byte, bool) { return data, !strings.HasPrefix(name, "assets/") }, nil)
+	if v := verify(t, removed, nil); v.Valid || len(v.Problems) != 1 || !strings.HasSuffix(v.Problems[0], "is missing") {
+		t.Errorf("Verify without an asset = %+v", v)
+	}
+}
+
+func TestVerifySigned(t *testing.T) {
+	key, err := ParseSigningKey(testSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := key.Public().(ed25519.PublicKey)
+	data := testBundle(key)
+	v := verify(t, data, public)
+	if !v.Valid || !v.Signed || v.Manifest.KeyID != KeyID(public) {
+		t.Fatalf("Verify = %+v", v)
+	}
+	if v := verify(t, data, nil); v.Valid {
+		t.Error("a signed export is valid without a key to check it with")
+	}
+	other, _ := ParseSigningKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, ed25519.SeedSize)))
+	if v := verify(t, data, other.Public().(ed25519.PublicKey)); v.Valid {
+		t.Error("a signed export is valid with another key")
+	}
+
+	// Changing a file and its hash in the manifest breaks the signature
+	forged := rewrite(t, data, func(name string, data []byte) ([]byte, bool) {
+		if name == ManifestFile {
+			return bytes.Replace(data, []byte(`"signer": "key-1"`), []byte(`"signer": "key-2"`), 1), true
+		}
+		return data, true
+	}, nil)
+	if v := verify(t, forged, public); v.Valid || v.Manifest.Signer != "key-2" {
+		t.Errorf("Verify of a forged manifest = %+v", v)
+	}
+
+	unsigned := rewrite(t, data, func(name string, data []byte) ([]byte, bool) { return data, name != SignatureFile }, nil)
+	if v := verify(t, unsigned, public); v.Valid || v.Signed {
+		t.Errorf("Verify without the signature = %+v", v)
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	for _, s := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseSigningKey(s); err == nil {
+			t.Errorf("ParseSigningKey(%q) succeeded", s)
+		}
+	}
+}
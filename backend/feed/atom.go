@@ -0,0 +1,88 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+// Feed is an Atom feed document (RFC 4287)
+type Feed struct {
+	XMLName xml.Name `xml:"feed"`
+	NS      string   `xml:"xmlns,attr"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Links   []Link   `xml:"link"`
+	Entries []Entry  `xml:"entry"`
+}
+
+// Entry is one item of a feed
+type Entry struct {
+	ID        string `xml:"id"`
+	Title     string `xml:"title"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published,omitempty"`
+	Links     []Link `xml:"link"`
+	Summary   *Text  `xml:"summary,omitempty"`
+	Content   *Text  `xml:"content,omitempty"`
+}
+
+// Link points at a related resource
+type Link struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// Text is a plain-text construct
+type Text struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// New starts a feed with the required fields set
+func New(id, title, self string, updated time.Time) *Feed {
+	return &Feed{
+		NS:      atomNS,
+		ID:      id,
+		Title:   title,
+		Updated: Time(updated),
+		Links:   []Link{{Rel: "self", Type: "application/atom+xml", Href: self}},
+	}
+}
+
+// Marshal renders the feed with an XML declaration
+func (f *Feed) Marshal() ([]byte, error) {
+	body, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// Time formats t the way Atom wants it
+func Time(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Summary shortens content to at most n characters, cutting at a word
+// boundary where possible
+func Summary(content string, n int) *Text {
+	content = strings.Join(strings.Fields(content), " ")
+	if content == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(content) > n {
+		runes := []rune(content)[:n]
+		cut := string(runes)
+		if i := strings.LastIndex(cut, " "); i > n/2 {
+			cut = cut[:i]
+		}
+		content = cut + "…"
+	}
+	return &Text{Type: "text", Body: content}
+}
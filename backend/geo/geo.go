@@ -0,0 +1,194 @@
+// Package geo finds notes by where they were written, using a grid of
+// bounding boxes over latitude and longitude
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// EarthRadius is the mean radius of the earth in meters
+const EarthRadius = 6_371_000
+
+// MaxRadius is half the circumference of the earth; every point is
+// within it
+const MaxRadius = math.Pi * EarthRadius
+
+// cellSize is the side of a grid cell in degrees
+const cellSize = 1.0
+
+// Point is a position in degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Valid reports whether p is a position on the earth
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Distance returns the great-circle distance between a and b in meters
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat, dLng := lat2-lat1, radians(b.Lng-a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+
+// Box is a range of latitudes and longitudes. MinLng is greater than
+// MaxLng for boxes that cross the antimeridian.
+type Box struct {
+	MinLat, MaxLat float64
+	MinLng, MaxLng float64
+}
+
+// BoundingBox returns a box containing every point within radius meters
+// of center
+func BoundingBox(center Point, radius float64) Box {
+	dLat := radius / EarthRadius * 180 / math.Pi
+	box := Box{MinLat: center.Lat - dLat, MaxLat: center.Lat + dLat, MinLng: -180, MaxLng: 180}
+	// A box reaching a pole spans every longitude
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat, box.MaxLat = math.Max(box.MinLat, -90), math.Min(box.MaxLat, 90)
+		return box
+	}
+	dLng := math.Asin(math.Min(1, math.Sin(radius/EarthRadius)/math.Cos(radians(center.Lat)))) * 180 / math.Pi
+	if dLng >= 180 || radius >= MaxRadius/2 {
+		return box
+	}
+	box.MinLng, box.MaxLng = wrap(center.Lng-dLng), wrap(center.Lng+dLng)
+	return box
+}
+
+func wrap(lng float64) float64 {
+	if lng < -180 {
+		return lng + 360
+	}
+	if lng > 180 {
+		return lng - 360
+	}
+	return lng
+}
+
+// Contains reports whether p is in the box
+func (b Box) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLng <= b.MaxLng {
+		return p.Lng >= b.MinLng && p.Lng <= b.MaxLng
+	}
+	return p.Lng >= b.MinLng || p.Lng <= b.MaxLng
+}
+
+// lngRanges splits the box at the antimeridian
+func (b Box) lngRanges() [][2]float64 {
+	if b.MinLng <= b.MaxLng {
+		return [][2]float64{{b.MinLng, b.MaxLng}}
+	}
+	return [][2]float64{{b.MinLng, 180}, {-180, b.MaxLng}}
+}
+
+type cell struct{ lat, lng int }
+
+func cellOf(p Point) cell {
+	return cell{int(math.Floor(p.Lat / cellSize)), int(math.Floor(p.Lng / cellSize))}
+}
+
+// Hit is a point found near another, with its distance in meters
+type Hit struct {
+	ID       string
+	Distance float64
+}
+
+// Index maps IDs to points, bucketed by grid cell so a query only looks
+// at the cells its bounding box overlaps. It is not safe for concurrent
+// use.
+type Index struct {
+	points map[string]Point
+	cells  map[cell]map[string]Point
+}
+
+func NewIndex() *Index {
+	return &Index{points: map[string]Point{}, cells: map[cell]map[string]Point{}}
+}
+
+// Put sets the point of id, replacing any earlier one
+func (x *Index) Put(id string, p Point) {
+	x.Remove(id)
+	c := cellOf(p)
+	if x.cells[c] == nil {
+		x.cells[c] = map[string]Point{}
+	}
+	x.cells[c][id] = p
+	x.points[id] = p
+}
+
+// Remove drops the point of id, if it has one
+func (x *Index) Remove(id string) {
+	p, ok := x.points[id]
+	if !ok {
+		return
+	}
+	c := cellOf(p)
+	delete(x.cells[c], id)
+	if len(x.cells[c]) == 0 {
+		delete(x.cells, c)
+	}
+	delete(x.points, id)
+}
+
+// Len returns the number of points
+func (x *Index) Len() int { return len(x.points) }
+
+// Within returns the IDs of the points in box, in no particular order
+func (x *Index) Within(box Box) []string {
+	var ids []string
+	visit := func(id string, p Point) {
+		if box.Contains(p) {
+			ids = append(ids, id)
+		}
+	}
+	// Scanning every point beats visiting more cells than there are points
+	cells := 0
+	for _, r := range box.lngRanges() {
+		cells += (int(math.Floor(box.MaxLat/cellSize)) - int(math.Floor(box.MinLat/cellSize)) + 1) *
+			(int(math.Floor(r[1]/cellSize)) - int(math.Floor(r[0]/cellSize)) + 1)
+	}
+	if cells > len(x.points) {
+		for id, p := range x.points {
+			visit(id, p)
+		}
+		return ids
+	}
+	for _, r := range box.lngRanges() {
+		for lat := int(math.Floor(box.MinLat / cellSize)); lat <= int(math.Floor(box.MaxLat/cellSize)); lat++ {
+			for lng := int(math.Floor(r[0] / cellSize)); lng <= int(math.Floor(r[1]/cellSize)); lng++ {
+				for id, p := range x.cells[cell{lat, lng}] {
+					visit(id, p)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// Near returns the points within radius meters of center, nearest first
+func (x *Index) Near(center Point, radius float64) []Hit {
+	var hits []Hit
+	for _, id := range x.Within(BoundingBox(center, radius)) {
+		if d := Distance(center, x.points[id]); d <= radius {
+			hits = append(hits, Hit{id, d})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Distance != hits[j].Distance {
+			return hits[i].Distance < hits[j].Distance
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
@@ -0,0 +1,21 @@
+package graph
+
+import (
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+)
+
+// NewHandler serves GraphQL queries over GET and POST
+func NewHandler(r *Resolver) http.Handler {
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: r}))
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	// Nesting notebooks and notes can't go deeper than this usefully, so
+	// anything more complex is likely abuse
+	srv.Use(extension.FixedComplexityLimit(500))
+	return srv
+}
@@ -0,0 +1,11 @@
+package graph
+
+// Notebook is a notebook name; its notes are resolved on demand
+type Notebook struct {
+	Name string `json:"name"`
+}
+
+// Tag is a hashtag; its notes are resolved on demand
+type Tag struct {
+	Name string `json:"name"`
+}
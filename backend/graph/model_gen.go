@@ -0,0 +1,30 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+import (
+	"time"
+)
+
+type Mutation struct {
+}
+
+type NoteInput struct {
+	Title            string          `json:"title"`
+	Content          string          `json:"content"`
+	Notebook         string          `json:"notebook"`
+	Published        bool            `json:"published"`
+	Items            []TodoItemInput `json:"items,omitempty"`
+	RemindAt         *time.Time      `json:"remindAt,omitempty"`
+	ContentEncrypted bool            `json:"contentEncrypted"`
+}
+
+type Query struct {
+}
+
+type TodoItemInput struct {
+	ID       *string `json:"id,omitempty"`
+	Text     string  `json:"text"`
+	Done     bool    `json:"done"`
+	Position int     `json:"position"`
+}
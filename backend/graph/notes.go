@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"note/backend/handlers"
+	"note/backend/models"
+	"slices"
+	"strings"
+)
+
+var errInvalidID = errors.New("invalid note ID")
+
+// noteID resolves an ID argument. Legacy integer IDs resolve to the UUID
+// their note was migrated to.
+func (r *Resolver) noteID(raw string) (string, error) {
+	id, ok := models.ResolveNoteID(raw, r.AcceptLegacyIDs)
+	if !ok {
+		return "", errInvalidID
+	}
+	return id, nil
+}
+
+// list returns the notes, optionally only those of one notebook, with a
+// tag or with open checklist items
+func (r *Resolver) list(ctx context.Context, notebook, tag *string, openTasks *bool) ([]models.Note, error) {
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, _ := store.List(openTasks != nil && *openTasks)
+	if notebook == nil && tag == nil {
+		return all, nil
+	}
+	filtered := []models.Note{}
+	for _, note := range all {
+		if notebook != nil && note.Notebook != *notebook {
+			continue
+		}
+		if tag != nil && !slices.Contains(handlers.NoteTags(note), tagName(*tag)) {
+			continue
+		}
+		filtered = append(filtered, note)
+	}
+	return filtered, nil
+}
+
+// tagName is a tag as NoteTags gives it, lowercased and without the #
+func tagName(raw string) string {
+	return strings.ToLower(strings.TrimPrefix(raw, "#"))
+}
+
+func fromInput(input NoteInput) models.Note {
+	note := models.Note{
+		Title:            input.Title,
+		Content:          input.Content,
+		Notebook:         input.Notebook,
+		Published:        input.Published,
+		RemindAt:         input.RemindAt,
+		ContentEncrypted: input.ContentEncrypted,
+	}
+	for _, item := range input.Items {
+		todo := models.TodoItem{Text: item.Text, Done: item.Done, Position: item.Position}
+		if item.ID != nil {
+			todo.ID = *item.ID
+		}
+		note.Items = append(note.Items, todo)
+	}
+	return note
+}
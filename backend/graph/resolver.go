@@ -0,0 +1,26 @@
+package graph
+
+import (
+	"context"
+	"note/backend/models"
+)
+
+// Store is where GraphQL reads and writes notes, the part of the
+// handlers.Repository of the REST API it uses
+type Store interface {
+	List(openTasks bool) ([]models.Note, int64)
+	Get(id string) (models.Note, error)
+	Create(note models.Note) (models.Note, error)
+	Update(id string, note models.Note) (models.Note, error)
+	Delete(id string) error
+}
+
+// Resolver resolves the schema against the Store of each request
+type Resolver struct {
+	// Store returns the store of the caller of a request, scoped to the
+	// workspace they work in
+	Store func(ctx context.Context) (Store, error)
+
+	// AcceptLegacyIDs resolves integer note IDs like the REST API does
+	AcceptLegacyIDs bool
+}
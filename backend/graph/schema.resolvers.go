@@ -0,0 +1,204 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+	"errors"
+	"note/backend/handlers"
+	"note/backend/models"
+	"slices"
+	"sort"
+)
+
+// CreateNote is the resolver for the createNote field.
+func (r *mutationResolver) CreateNote(ctx context.Context, input NoteInput) (*models.Note, error) {
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	note, err := store.Create(fromInput(input))
+	if err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// UpdateNote is the resolver for the updateNote field.
+func (r *mutationResolver) UpdateNote(ctx context.Context, id string, input NoteInput) (*models.Note, error) {
+	id, err := r.noteID(id)
+	if err != nil {
+		return nil, err
+	}
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	note, err := store.Update(id, fromInput(input))
+	if err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// DeleteNote is the resolver for the deleteNote field.
+func (r *mutationResolver) DeleteNote(ctx context.Context, id string) (bool, error) {
+	id, err := r.noteID(id)
+	if err != nil {
+		return false, err
+	}
+	store, err := r.Store(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := store.Delete(id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Notebook is the resolver for the notebook field.
+func (r *noteResolver) Notebook(ctx context.Context, obj *models.Note) (*Notebook, error) {
+	if obj.Notebook == "" {
+		return nil, nil
+	}
+	return &Notebook{Name: obj.Notebook}, nil
+}
+
+// Tags is the resolver for the tags field.
+func (r *noteResolver) Tags(ctx context.Context, obj *models.Note) ([]Tag, error) {
+	tags := []Tag{}
+	for _, name := range handlers.NoteTags(*obj) {
+		tags = append(tags, Tag{Name: name})
+	}
+	return tags, nil
+}
+
+// Notes is the resolver for the notes field.
+func (r *notebookResolver) Notes(ctx context.Context, obj *Notebook, openTasks *bool) ([]models.Note, error) {
+	return r.list(ctx, &obj.Name, nil, openTasks)
+}
+
+// Notes is the resolver for the notes field.
+func (r *queryResolver) Notes(ctx context.Context, notebook *string, tag *string, openTasks *bool) ([]models.Note, error) {
+	return r.list(ctx, notebook, tag, openTasks)
+}
+
+// Note is the resolver for the note field.
+func (r *queryResolver) Note(ctx context.Context, id string) (*models.Note, error) {
+	id, err := r.noteID(id)
+	if err != nil {
+		return nil, err
+	}
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	note, err := store.Get(id)
+	if errors.Is(err, handlers.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// Notebooks is the resolver for the notebooks field.
+func (r *queryResolver) Notebooks(ctx context.Context) ([]Notebook, error) {
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := store.List(false)
+	seen := map[string]bool{}
+	notebooks := []Notebook{}
+	for _, note := range list {
+		if note.Notebook != "" && !seen[note.Notebook] {
+			seen[note.Notebook] = true
+			notebooks = append(notebooks, Notebook{Name: note.Notebook})
+		}
+	}
+	sort.Slice(notebooks, func(i, j int) bool { return notebooks[i].Name < notebooks[j].Name })
+	return notebooks, nil
+}
+
+// Notebook is the resolver for the notebook field.
+func (r *queryResolver) Notebook(ctx context.Context, name string) (*Notebook, error) {
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := store.List(false)
+	for _, note := range list {
+		if note.Notebook == name {
+			return &Notebook{Name: name}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Tags is the resolver for the tags field.
+func (r *queryResolver) Tags(ctx context.Context) ([]Tag, error) {
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, _ := store.List(false)
+	seen := map[string]bool{}
+	tags := []Tag{}
+	for _, note := range list {
+		for _, name := range handlers.NoteTags(note) {
+			if !seen[name] {
+				seen[name] = true
+				tags = append(tags, Tag{Name: name})
+			}
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// Tag is the resolver for the tag field.
+func (r *queryResolver) Tag(ctx context.Context, name string) (*Tag, error) {
+	store, err := r.Store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name = tagName(name)
+	list, _ := store.List(false)
+	for _, note := range list {
+		if slices.Contains(handlers.NoteTags(note), name) {
+			return &Tag{Name: name}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Notes is the resolver for the notes field.
+func (r *tagResolver) Notes(ctx context.Context, obj *Tag, openTasks *bool) ([]models.Note, error) {
+	return r.list(ctx, nil, &obj.Name, openTasks)
+}
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Note returns NoteResolver implementation.
+func (r *Resolver) Note() NoteResolver { return &noteResolver{r} }
+
+// Notebook returns NotebookResolver implementation.
+func (r *Resolver) Notebook() NotebookResolver { return &notebookResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// Tag returns TagResolver implementation.
+func (r *Resolver) Tag() TagResolver { return &tagResolver{r} }
+
+type mutationResolver struct{ *Resolver }
+type noteResolver struct{ *Resolver }
+type notebookResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type tagResolver struct{ *Resolver }
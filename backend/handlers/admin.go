@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/auth"
+	"note/backend/metering"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// InstanceLimits caps what the whole instance stores. Zero means no limit.
+type InstanceLimits struct {
+	MaxNotes    int `json:"max_notes"`
+	MaxNoteSize int `json:"max_note_size"` // bytes of title, content and items
+	MaxAPIKeys  int `json:"max_api_keys"`
+
+	// PerUser applies to the notes each API key owns
+	PerUser Quota `json:"per_user"`
+
+	// PerWorkspace caps what each workspace uses of metered features,
+	// unless it has quotas of its own
+	PerWorkspace metering.Quotas `json:"per_workspace"`
+
+	// Attachments restricts what may be attached to notes. Admins of a
+	// workspace can restrict it further there.
+	Attachments AttachmentPolicy `json:"attachments"`
+}
+
+// Limits is set from the config on start and by admins later. It is
+// guarded by mu.
+var Limits InstanceLimits
+
+// There are no user accounts yet, so API keys are the accounts admins
+// manage: listing users lists keys, and disabling a user disables a key.
+
+// List every account
+func GetUsers(c echo.Context) error {
+	return c.JSON(http.StatusOK, APIKeys.List())
+}
+
+// Disable an account; its key is refused until it is enabled again
+func DisableUser(c echo.Context) error {
+	return setUserDisabled(c, true)
+}
+
+// Enable a disabled account
+func EnableUser(c echo.Context) error {
+	return setUserDisabled(c, false)
+}
+
+func setUserDisabled(c echo.Context, disabled bool) error {
+	key, ok, err := APIKeys.SetDisabled(c.Param("id"), disabled)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+type notebookStats struct {
+	Name  string `json:"name"`
+	Notes int    `json:"notes"`
+	Bytes int    `json:"bytes"`
+}
+
+// Get note counts and storage usage of the instance
+func GetInstanceStats(c echo.Context) error {
+	keys := APIKeys.List()
+	disabled := 0
+	for _, key := range keys {
+		if key.Disabled {
+			disabled++
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	published, encrypted, storage := 0, 0, 0
+	byNotebook := map[string]*notebookStats{}
+	attached := map[string]int{}
+	for _, a := range attachments {
+		attached[a.NoteID] += a.Size
+	}
+	for _, note := range notes {
+		size := noteSize(note) + attached[note.ID]
+		storage += size
+		if note.Published {
+			published++
+		}
+		if note.ContentEncrypted {
+			encrypted++
+		}
+		nb := byNotebook[note.Notebook]
+		if nb == nil {
+			nb = &notebookStats{Name: note.Notebook}
+			byNotebook[note.Notebook] = nb
+		}
+		nb.Notes++
+		nb.Bytes += size
+	}
+	notebooks := make([]notebookStats, 0, len(byNotebook))
+	for _, nb := range byNotebook {
+		notebooks = append(notebooks, *nb)
+	}
+	sort.Slice(notebooks, func(i, j int) bool { return notebooks[i].Name < notebooks[j].Name })
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"notes":          len(notes),
+		"published":      published,
+		"encrypted":      encrypted,
+		"storage_bytes":  storage,
+		"notebooks":      notebooks,
+		"users":          len(keys),
+		"users_disabled": disabled,
+		"limits":         Limits,
+	})
+}
+
+// Get the instance-wide limits
+func GetLimits(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return c.JSON(http.StatusOK, Limits)
+}
+
+// Replace the instance-wide limits. Notes already over a new limit are
+// kept, but can only be saved again once they fit.
+func UpdateLimits(c echo.Context) error {
+	var limits InstanceLimits
+	if err := c.Bind(&limits); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if limits.MaxNotes < 0 || limits.MaxNoteSize < 0 || limits.MaxAPIKeys < 0 ||
+		limits.PerUser.MaxNotes < 0 || limits.PerUser.MaxNoteSize < 0 || limits.PerUser.MaxStorage < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Limits can't be negative"})
+	}
+	if err := limits.Attachments.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := limits.PerWorkspace.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	Limits = limits
+	return c.JSON(http.StatusOK, Limits)
+}
+
+// isAdmin reports whether the request was made with the admin role
+func isAdmin(c echo.Context) bool {
+	key, ok := auth.FromContext(c)
+	return ok && key.HasRole(auth.ScopeAdmin)
+}
+
+// ownerOf returns the ID of the API key the request was made with, or ""
+// for requests without one and with the admin token
+func ownerOf(c echo.Context) string {
+	key, ok := auth.FromContext(c)
+	if !ok || key.ID == auth.AdminTokenID {
+		return ""
+	}
+	return key.ID
+}
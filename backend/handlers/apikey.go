@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeys holds the keys for programmatic access to the private API.
+// There are no user accounts yet, so every key acts for the instance.
+var APIKeys = auth.NewTokenStore()
+
+type createAPIKeyRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"` // read, read-write or admin
+}
+
+// keyManager returns the API key of a request that manages keys, which
+// admins do for every key and other keys for those they created. It
+// reports false once it answered the request.
+func keyManager(c echo.Context) (auth.Token, bool, error) {
+	key, ok := auth.FromContext(c)
+	if !ok {
+		return auth.Token{}, false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "API keys are managed with an API key"})
+	}
+	return key, true, nil
+}
+
+// manages reports whether key may see and revoke other: admins manage
+// every key, other keys themselves and the keys they created
+func manages(key, other auth.Token) bool {
+	return key.HasRole(auth.ScopeAdmin) || other.ID == key.ID || other.Owner == key.ID
+}
+
+// Create an API key with at most the role of the caller's. The secret is
+// only returned in this response.
+func CreateAPIKey(c echo.Context) error {
+	key, ok, err := keyManager(c)
+	if !ok {
+		return err
+	}
+	req := new(createAPIKeyRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Name is required"})
+	}
+	switch req.Scope {
+	case auth.ScopeRead, auth.ScopeReadWrite, auth.ScopeAdmin:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Scope must be read, read-write or admin"})
+	}
+	if !key.HasRole(req.Scope) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "API keys can't create keys with more than their own " + key.Scope + " role"})
+	}
+	mu.Lock()
+	max := Limits.MaxAPIKeys
+	mu.Unlock()
+	if max > 0 && len(APIKeys.List()) >= max {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "API key limit reached"})
+	}
+	created, secret, err := APIKeys.Create(req.Name, req.Scope, "", ownerOf(c), "")
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"key": secret, "info": created})
+}
+
+// List the API keys the caller manages, without their secrets
+func GetAPIKeys(c echo.Context) error {
+	key, ok, err := keyManager(c)
+	if !ok {
+		return err
+	}
+	list := []auth.Token{}
+	for _, other := range APIKeys.List() {
+		if manages(key, other) {
+			list = append(list, other)
+		}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// Revoke an API key the caller manages by ID
+func DeleteAPIKey(c echo.Context) error {
+	key, ok, err := keyManager(c)
+	if !ok {
+		return err
+	}
+	managed := false
+	for _, other := range APIKeys.List() {
+		if other.ID == c.Param("id") {
+			managed = manages(key, other)
+		}
+	}
+	if !managed {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+	}
+	ok, err = APIKeys.Revoke(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "API key revoked successfully"})
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/export"
+	"note/backend/imaging"
+	"note/backend/ink"
+	"note/backend/models"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxAttachmentSize = 10 << 20
+	maxPreviewSize    = 2048    // pixels on the longer side
+	maxCachedImage    = 1 << 20 // bytes of a converted image that is cached
+)
+
+// StripImageLocation removes where photos were taken from uploaded JPEGs
+// unless an upload asks otherwise with ?strip_location=false
+var StripImageLocation bool
+
+// storedAttachment is an attachment with its file
+type storedAttachment struct {
+	models.Attachment
+	data []byte
+}
+
+// rendition is an image attachment scaled or converted for a request
+type rendition struct {
+	contentType string
+	data        []byte
+}
+
+// attachments are keyed by ID and guarded by mu like the notes they
+// belong to
+var attachments = map[string]*storedAttachment{}
+
+// attachmentsOf returns the attachments of a note, oldest first. Callers
+// must hold mu.
+func attachmentsOf(noteID string) []*storedAttachment {
+	var list []*storedAttachment
+	for _, a := range attachments {
+		if a.NoteID == noteID {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// attachmentBytes is what the attachments of a note count against
+// storage. Callers must hold mu.
+func attachmentBytes(noteID string) int {
+	size := 0
+	for _, a := range attachments {
+		if a.NoteID == noteID {
+			size += a.Size
+		}
+	}
+	return size
+}
+
+// deleteAttachments drops the attachments of a deleted note. Callers must
+// hold mu.
+func deleteAttachments(noteID string) {
+	for id, a := range attachments {
+		if a.NoteID == noteID {
+			delete(attachments, id)
+		}
+	}
+}
+
+// Attach a file to a note. The request body is the file, its
+// Content-Type header the file's type and ?name= its name. The type is
+// checked against the content, and taken from it when missing, and then
+// against the attachment policy. Ink drawings are checked to be valid,
+// and the location is stripped from photos with ?strip_location=true or
+// when the instance does so.
+func UploadAttachment(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	declared, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		declared = ""
+	}
+	stripLocation := StripImageLocation
+	if v := c.QueryParam("strip_location"); v != "" {
+		stripLocation = v == "true"
+	}
+	name := attachmentName(c.QueryParam("name"))
+	mu.Lock()
+	policy := attachmentPolicy(workspaceOf(c))
+	mu.Unlock()
+	data, err := io.ReadAll(io.LimitReader(c.Request().Body, int64(policy.maxSize())+1))
+	if err != nil {
+		return err
+	}
+	contentType, data, err := policy.check(declared, data, stripLocation)
+	switch {
+	case errors.Is(err, errAttachmentTooLarge):
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+			"error": fmt.Sprintf("Attachments can be at most %d bytes", policy.maxSize()),
+			"code":  codeAttachmentTooLarge,
+		})
+	case errors.Is(err, errAttachmentType):
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{
+			"error": fmt.Sprintf("Attachments of type %s are not allowed; allowed are %s", contentType, strings.Join(policy.AllowedTypes, ", ")),
+			"code":  codeAttachmentType,
+		})
+	case errors.Is(err, errInvalidInk):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": err.Error()})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var owner string
+	found := false
+	for _, note := range notes {
+		if note.ID == id {
+			owner, found = note.Owner, true
+		}
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	quota := Limits.PerUser.MaxStorage
+	if owner != "" && quota > 0 && usageOf(owner).StorageBytes+len(data) > quota {
+		return limitResponse(c, ErrStorageLimit)
+	}
+	a := addAttachment(id, name, contentType, data)
+	recordAudit(actorOf(c), audit.Update, id, "attached "+name)
+	return c.JSON(http.StatusCreated, a.Attachment)
+}
+
+// attachmentName is the base name of the file name a client gave, with
+// no directories on any OS
+func attachmentName(name string) string {
+	name = path.Base("/" + strings.ReplaceAll(name, `\`, "/"))
+	if name == "/" || name == "." {
+		return "attachment"
+	}
+	return name
+}
+
+// addAttachment stores a file with a note. Callers must hold mu.
+func addAttachment(noteID, name, contentType string, data []byte) *storedAttachment {
+	a := &storedAttachment{
+		Attachment: models.Attachment{
+			ID:          uuid.NewString(),
+			NoteID:      noteID,
+			Name:        name,
+			ContentType: contentType,
+			Size:        len(data),
+			CreatedAt:   time.Now(),
+		},
+		data: data,
+	}
+	if imaging.Decodable(contentType) {
+		a.Width, a.Height, _ = imaging.Size(data)
+	}
+	attachments[a.ID] = a
+	return a
+}
+
+// List the attachments of a note
+func GetAttachments(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	list := []models.Attachment{}
+	for _, a := range attachmentsOf(id) {
+		list = append(list, a.Attachment)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// attachment finds an attachment by the :attachmentId route parameter.
+// Callers must hold mu.
+func attachment(c echo.Context) (*storedAttachment, bool) {
+	a, ok := attachments[c.Param("attachmentId")]
+	return a, ok
+}
+
+// Download an attachment. Images come scaled down to at most ?w= pixels
+// wide and converted to ?format= jpeg, png or webp, which are cached for
+// the next request.
+func GetAttachment(c echo.Context) error {
+	mu.Lock()
+	a, ok := attachment(c)
+	mu.Unlock()
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment not found"})
+	}
+	contentType, data, name := a.ContentType, a.data, a.Name
+	width, format := 0, c.QueryParam("format")
+	if v := c.QueryParam("w"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPreviewSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "w must be 1 to 2048"})
+		}
+		width = n
+	}
+	to, ok := imaging.Formats[format]
+	if format != "" && !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be jpeg, png or webp"})
+	}
+	if width > 0 || to != "" {
+		r, err := attachmentRendition(a, width, to)
+		switch {
+		case errors.Is(err, imaging.ErrUnsupported):
+			return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "Can't convert images of type " + a.ContentType})
+		case errors.Is(err, imaging.ErrTooLarge):
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Image is too large to convert"})
+		case err != nil:
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Image can't be read: " + err.Error()})
+		}
+		if ext := path.Ext(name); r.contentType != contentType && ext != "" {
+			name = strings.TrimSuffix(name, ext) + imaging.Extension(r.contentType)
+		}
+		contentType, data = r.contentType, r.data
+	}
+	// Never let a browser render an uploaded file as a page of this site
+	c.Response().Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	return c.Blob(http.StatusOK, contentType, data)
+}
+
+// attachmentRendition returns an image scaled to width and converted to
+// the content type to, from the cache or made and cached unless it is
+// large
+func attachmentRendition(a *storedAttachment, width int, to string) (rendition, error) {
+	key := fmt.Sprintf("%s|%d|%s", a.ID, width, to)
+	if r, ok := renditionCache.Get(key); ok {
+		return r, nil
+	}
+	data, contentType, err := imaging.Convert(a.data, a.ContentType, width, to)
+	if err != nil {
+		return rendition{}, err
+	}
+	r := rendition{contentType: contentType, data: data}
+	if len(data) <= maxCachedImage {
+		renditionCache.Add(key, r)
+	}
+	return r, nil
+}
+
+// Render a preview of an attachment, as ?format=svg or png, the latter
+// at most ?size= pixels wide and high. Only ink drawings have previews.
+func GetAttachmentPreview(c echo.Context) error {
+	mu.Lock()
+	a, ok := attachment(c)
+	mu.Unlock()
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment not found"})
+	}
+	if a.ContentType != ink.ContentType {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "No preview for " + a.ContentType})
+	}
+	size := maxPreviewSize
+	if v := c.QueryParam("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPreviewSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "size must be 1 to 2048"})
+		}
+		size = n
+	}
+	drawing, err := ink.Parse(a.data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	switch c.QueryParam("format") {
+	case "", "svg":
+		if err := drawing.SVG(&buf); err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, "image/svg+xml", buf.Bytes())
+	case "png":
+		if err := drawing.PNG(&buf, size); err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, "image/png", buf.Bytes())
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be svg or png"})
+}
+
+// Delete an attachment
+func DeleteAttachment(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	a, ok := attachment(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment not found"})
+	}
+	delete(attachments, a.ID)
+	recordAudit(actorOf(c), audit.Update, a.NoteID, "removed attachment "+a.Name)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Attachment deleted successfully"})
+}
+
+// Download every attachment of a note as a zip archive with a manifest
+func GetNoteAttachmentsZip(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	var files []export.AttachmentFile
+	found := false
+	for _, note := range notes {
+		if note.ID == id {
+			files, found = attachmentFiles(note), true
+		}
+	}
+	mu.Unlock()
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	return writeAttachments(c, "", files, fmt.Sprintf("note-%s-attachments.zip", id))
+}
+
+// Download the attachments of every note in a notebook as a zip archive
+// with a folder per note and a manifest
+func GetNotebookAttachmentsZip(c echo.Context) error {
+	name, ws := c.Param("notebook"), workspaceOf(c)
+	mu.Lock()
+	var files []export.AttachmentFile
+	found := false
+	for _, note := range notes {
+		if note.Workspace == ws && note.Notebook == name {
+			files, found = append(files, attachmentFiles(note)...), true
+		}
+	}
+	mu.Unlock()
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Notebook not found"})
+	}
+	return writeAttachments(c, name, files, name+"-attachments.zip")
+}
+
+// attachmentFiles returns the attachments of a note for an archive.
+// Callers must hold mu.
+func attachmentFiles(note models.Note) []export.AttachmentFile {
+	var files []export.AttachmentFile
+	for _, a := range attachmentsOf(note.ID) {
+		files = append(files, export.AttachmentFile{Attachment: a.Attachment, NoteTitle: note.Title, Data: a.data})
+	}
+	return files
+}
+
+func writeAttachments(c echo.Context, notebook string, files []export.AttachmentFile, filename string) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	res.WriteHeader(http.StatusOK)
+	return export.WriteAttachments(res, notebook, files)
+}
+
+// bundleAssets collects the attachments of the notes in a bundle, with
+// an SVG rendering next to each ink drawing. Callers must hold mu.
+func bundleAssets(list []models.Note) map[string][]export.Asset {
+	assets := map[string][]export.Asset{}
+	for _, note := range list {
+		for _, a := range attachmentsOf(note.ID) {
+			// Names may repeat within a note, IDs don't
+			name := fmt.Sprintf("%s-%s", a.ID[:8], a.Name)
+			assets[note.ID] = append(assets[note.ID], export.Asset{Name: name, Data: a.data})
+			if a.ContentType != ink.ContentType {
+				continue
+			}
+			if drawing, err := ink.Parse(a.data); err == nil {
+				var svg bytes.Buffer
+				if drawing.SVG(&svg) == nil {
+					assets[note.ID] = append(assets[note.ID], export.Asset{Name: name + ".svg", Data: svg.Bytes()})
+				}
+			}
+		}
+	}
+	return assets
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/auth"
+	"note/backend/models"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxAuditEntries = 1000
+
+// Audit records who changed which note. Set it to a file-backed log with
+// audit.Open before serving to keep it across restarts.
+var Audit = audit.NewLog()
+
+// actorOf names who made the request in the audit log
+func actorOf(c echo.Context) string {
+	if key, ok := auth.FromContext(c); ok {
+		return key.ID
+	}
+	return audit.Anonymous
+}
+
+// recordAudit adds an entry to the audit log. A failed write is logged
+// rather than failing the change, which has already happened.
+func recordAudit(actor, action, noteID, detail string) {
+	if err := Audit.Record(actor, action, noteID, detail); err != nil {
+		log.Printf("writing audit log: %v", err)
+	}
+}
+
+// Get who did what to a note, newest first. Deleted notes keep their
+// activity.
+func GetNoteActivity(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	entries := Audit.Query(audit.Filter{NoteID: id})
+	if len(entries) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// Search the audit log of the whole instance by ?actor=, ?action=,
+// ?note=, and ?since= and ?until= as RFC 3339 times, newest first, up to
+// ?limit= entries
+func GetAuditLog(c echo.Context) error {
+	f := audit.Filter{
+		Actor:  c.QueryParam("actor"),
+		Action: c.QueryParam("action"),
+		Limit:  100,
+	}
+	if note := c.QueryParam("note"); note != "" {
+		id, ok := models.ResolveNoteID(note, AcceptLegacyIDs)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+		}
+		f.NoteID = id
+	}
+	for param, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := c.QueryParam(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": param + " must be an RFC 3339 time"})
+			}
+			*dst = t
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditEntries {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be 1 to 1000"})
+		}
+		f.Limit = n
+	}
+	return c.JSON(http.StatusOK, Audit.Query(f))
+}
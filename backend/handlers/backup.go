@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note/backend/backup"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Backups is where backups are kept. Restoring through the API is off
+// while it is nil.
+var Backups backup.Storage
+
+// errHasNotes is returned when restoring over existing notes unforced
+var errHasNotes = errors.New("instance already has notes; pass ?force=true to replace them")
+
+type restoreResult struct {
+	Notes int   `json:"notes"`
+	Seq   int64 `json:"seq"`
+}
+
+// Load the latest backup. It is meant for bringing up a fresh instance,
+// so replacing existing notes takes ?force=true. With ?async=true it runs
+// as a job instead.
+func RestoreBackup(c echo.Context) error {
+	if Backups == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{"error": "Backups are not configured"})
+	}
+	force := c.QueryParam("force") == "true"
+	if c.QueryParam("async") == "true" {
+		return enqueueJob(c, jobRestore, restoreJob{Force: force})
+	}
+
+	result, err := restoreBackup(force)
+	switch {
+	case errors.Is(err, backup.ErrNoBackup):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No backup found"})
+	case errors.Is(err, errHasNotes):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Instance already has notes; pass ?force=true to replace them"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func restoreBackup(force bool) (restoreResult, error) {
+	restored, state, seq, err := backup.Restore(Backups)
+	if err != nil {
+		return restoreResult{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(notes) > 0 && !force {
+		return restoreResult{}, errHasNotes
+	}
+	restore(restored, state, seq)
+	return restoreResult{Notes: len(restored), Seq: seq}, nil
+}
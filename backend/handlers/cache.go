@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/backup"
+	"note/backend/cache"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// cachedNote is a note as GetNote sends it
+type cachedNote struct {
+	body     []byte
+	etag     string
+	modified time.Time
+}
+
+// cachedList is a list as GetNotes sends it, as of change seq
+type cachedList struct {
+	body []byte
+	seq  int64
+}
+
+// Encoded responses of GetNote and GetNotes. recordChange and restore
+// drop the entries a change makes stale.
+var (
+	noteCache = cache.New[string, cachedNote](1000)
+	listCache = cache.New[string, cachedList](8) // one per kind of list
+
+	// renditionCache holds the images GetAttachment scaled or converted,
+	// by attachment, width and type. Attachments are never changed, only
+	// deleted, so entries are never stale.
+	renditionCache = cache.New[string, rendition](128)
+)
+
+// SetCacheSize sets how many notes are cached; zero turns caching off.
+// Call it before serving.
+func SetCacheSize(notes int) {
+	noteCache = cache.New[string, cachedNote](notes)
+	lists, pages, images := 8, 256, 128
+	if notes <= 0 {
+		lists, pages, images = 0, 0, 0
+	}
+	listCache = cache.New[string, cachedList](lists)
+	publicCache = cache.New[string, rendered](pages)
+	renditionCache = cache.New[string, rendition](images)
+}
+
+// invalidateCache drops the cached responses a change to the note with
+// the given ID makes stale. Callers must hold mu.
+func invalidateCache(id string) {
+	noteCache.Remove(id)
+	listCache.Purge()
+}
+
+// Get the hit and miss counts of the read caches
+func GetCacheStats(c echo.Context) error {
+	stats := map[string]cache.Stats{
+		"notes":  noteCache.Stats(),
+		"lists":  listCache.Stats(),
+		"public": publicCache.Stats(),
+		"images": renditionCache.Stats(),
+	}
+	if backup.DataKeys != nil {
+		stats["data_keys"] = backup.DataKeys.CacheStats()
+	}
+	return c.JSON(http.StatusOK, stats)
+}
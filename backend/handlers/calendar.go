@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/auth"
+	"note/backend/ical"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// reminderDuration is how long the events of a calendar feed last
+const reminderDuration = 30 * time.Minute
+
+// Serve an iCalendar feed of the reminders and scheduled publications of
+// the token owner's notes, for calendar apps to subscribe to. Those can't send headers, so the
+// read:calendar token usually comes as ?token=.
+func GetCalendar(c echo.Context) error {
+	token, _ := auth.FromContext(c)
+	cal := ical.Calendar{Name: "Notty"}
+	if token.Notebook != "" {
+		cal.Name += " – " + token.Notebook
+	}
+	mu.Lock()
+	for _, note := range notes {
+		if !ownNote(token, note) {
+			continue
+		}
+		description := note.Content
+		if note.ContentEncrypted {
+			description = ""
+		}
+		if note.RemindAt != nil {
+			cal.Events = append(cal.Events, ical.Event{
+				UID:         note.ID + "-reminder@notty",
+				Summary:     note.Title,
+				Description: description,
+				Start:       *note.RemindAt,
+				Duration:    reminderDuration,
+				Modified:    note.UpdatedAt,
+			})
+		}
+		if note.PublishAt != nil && note.PublishedAt == nil {
+			cal.Events = append(cal.Events, ical.Event{
+				UID:      note.ID + "-publish@notty",
+				Summary:  "Publish: " + note.Title,
+				Start:    *note.PublishAt,
+				Duration: reminderDuration,
+				Modified: note.UpdatedAt,
+			})
+		}
+	}
+	mu.Unlock()
+	sort.SliceStable(cal.Events, func(i, j int) bool { return cal.Events[i].Start.Before(cal.Events[j].Start) })
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `inline; filename="notty.ics"`)
+	c.Response().WriteHeader(http.StatusOK)
+	return cal.Write(c.Response())
+}
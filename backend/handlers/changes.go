@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"note/backend/backup"
+	"note/backend/geo"
+	"note/backend/links"
+	"note/backend/models"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// mu guards notes, the change log and the other state of this package.
+// Handlers hold it while they touch any of it; background work such as
+// backups takes it too, outside of a request.
+var mu sync.Mutex
+
+var changes []models.Change
+var lastSeq int64
+var lastModified time.Time // time of the latest write to any note
+
+// epoch tells change logs apart whose sequences may overlap: it is new
+// on every start and restore
+var epoch = newEpoch()
+
+func newEpoch() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// changed is closed and replaced on every change so watchers can wait
+// for the next one
+var changed = make(chan struct{})
+
+// historyBase is the notes as of historyStart, where the change log
+// begins. Replaying the log over it gives the notes at any later time.
+var historyBase []models.Note
+var historyStart = time.Now()
+
+// maxChanges is how many changes the log keeps. The oldest are folded
+// into historyBase beyond that; cursors from before them get a reset.
+var maxChanges = 10000
+
+// notebookSeq is the sequence of the latest change that touched a notebook
+var notebookSeq = map[string]int64{}
+
+// recordChange appends a write to the change log. Callers must hold mu.
+func recordChange(op string, id string, note *models.Note) {
+	record(models.Change{Op: op, NoteID: id}, note)
+}
+
+// recordMove records a note moving into another workspace out of the one
+// it was in. Callers must hold mu.
+func recordMove(note *models.Note, from string) {
+	record(models.Change{Op: models.ChangeUpdate, NoteID: note.ID, LeftWorkspace: from}, note)
+}
+
+// record appends a change to the log and brings everything that follows
+// the notes up to date. Callers must hold mu.
+func record(change models.Change, note *models.Note) {
+	id := change.NoteID
+	lastSeq++
+	change.Seq, change.At = lastSeq, time.Now()
+	if note != nil {
+		copied := *note
+		change.Note = &copied
+	}
+	changes = append(changes, change)
+	if len(changes) > maxChanges {
+		// Drop a tenth at once rather than copying the log on every write
+		dropped := changes[:len(changes)-maxChanges+maxChanges/10]
+		historyBase = replay(historyBase, dropped)
+		historyStart = dropped[len(dropped)-1].At
+		changes = append([]models.Change(nil), changes[len(dropped):]...)
+	}
+	SearchIndex.Update(change)
+	indexLocation(id, note)
+	indexLinks(id, note)
+	forgetEmbedding(id, note)
+	invalidateCache(id)
+	lastModified = change.At
+	close(changed)
+	changed = make(chan struct{})
+}
+
+// lastWrite returns the time of the latest write to any note
+func lastWrite() time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+	return lastModified
+}
+
+// touchNotebooks marks notebooks as changed by the latest change, e.g. the
+// old and new notebook of a moved note. Callers must hold mu.
+func touchNotebooks(names ...string) {
+	for _, name := range names {
+		notebookSeq[name] = lastSeq
+	}
+}
+
+// ChangeLog exposes the in-memory notes and their change log to
+// subsystems that live outside the HTTP handlers, like backups.
+type ChangeLog struct{}
+
+// Snapshot returns a copy of every note and the sequence it reflects
+func (ChangeLog) Snapshot() ([]models.Note, int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]models.Note(nil), notes...), lastSeq
+}
+
+// ChangesSince returns the changes with a sequence greater than seq
+func (ChangeLog) ChangesSince(seq int64) []models.Change {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, change := range changes {
+		if change.Seq > seq {
+			return append([]models.Change(nil), changes[i:]...)
+		}
+	}
+	return nil
+}
+
+// State returns the attachments, relations, shares, reading positions
+// and review times of the notes by workspace, each in a stable order
+func (ChangeLog) State() map[string]backup.State {
+	mu.Lock()
+	defer mu.Unlock()
+	workspaceOf := map[string]string{}
+	for _, note := range notes {
+		workspaceOf[note.ID] = note.Workspace
+	}
+	state := map[string]backup.State{}
+	for _, a := range attachments {
+		if ws, ok := workspaceOf[a.NoteID]; ok {
+			st := state[ws]
+			st.Attachments = append(st.Attachments, backup.Attachment{Attachment: a.Attachment, Data: a.data})
+			state[ws] = st
+		}
+	}
+	for _, r := range relations {
+		if ws, ok := workspaceOf[r.From]; ok {
+			st := state[ws]
+			st.Relations = append(st.Relations, r)
+			state[ws] = st
+		}
+	}
+	for _, share := range shares {
+		ws, ok := share.Workspace, share.NoteID == ""
+		if !ok {
+			ws, ok = workspaceOf[share.NoteID]
+		}
+		if ok {
+			st := state[ws]
+			st.Shares = append(st.Shares, backup.Share{Share: share, Owner: share.Owner, Workspace: share.Workspace})
+			state[ws] = st
+		}
+	}
+	for id, byKey := range positions {
+		if ws, ok := workspaceOf[id]; ok {
+			st := state[ws]
+			for key, pos := range byKey {
+				st.Positions = append(st.Positions, backup.Position{NoteID: id, Key: key, ReadingPosition: pos})
+			}
+			state[ws] = st
+		}
+	}
+	for id, at := range reviewedAt {
+		if ws, ok := workspaceOf[id]; ok {
+			st := state[ws]
+			st.Reviews = append(st.Reviews, backup.Review{NoteID: id, ReviewedAt: at})
+			state[ws] = st
+		}
+	}
+	for ws, st := range state {
+		sort.Slice(st.Attachments, func(i, j int) bool { return st.Attachments[i].ID < st.Attachments[j].ID })
+		sort.Slice(st.Relations, func(i, j int) bool { return st.Relations[i].ID < st.Relations[j].ID })
+		sort.Slice(st.Shares, func(i, j int) bool { return st.Shares[i].Token < st.Shares[j].Token })
+		sort.Slice(st.Positions, func(i, j int) bool {
+			if st.Positions[i].NoteID != st.Positions[j].NoteID {
+				return st.Positions[i].NoteID < st.Positions[j].NoteID
+			}
+			return st.Positions[i].Key < st.Positions[j].Key
+		})
+		sort.Slice(st.Reviews, func(i, j int) bool { return st.Reviews[i].NoteID < st.Reviews[j].NoteID })
+		state[ws] = st
+	}
+	return state
+}
+
+// Restore replaces all notes and what hangs off them with a restored
+// state. The change log restarts at seq so later backups continue where
+// the restored one ended.
+func (ChangeLog) Restore(restored []models.Note, state backup.State, seq int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	restore(restored, state, seq)
+}
+
+// restore is ChangeLog.Restore for callers that hold mu
+func restore(restored []models.Note, state backup.State, seq int64) {
+	notes = append([]models.Note(nil), restored...)
+	trash = nil
+	changes = nil
+	historyBase = append([]models.Note(nil), restored...)
+	historyStart = time.Now()
+	lastSeq = seq
+	epoch = newEpoch()
+	notebookSeq = map[string]int64{}
+	feedCache = map[string]cachedFeed{}
+	noteCache.Purge()
+	listCache.Purge()
+	close(changed) // watchers find out their cursor is gone
+	changed = make(chan struct{})
+	lastModified = time.Time{}
+	for _, note := range notes {
+		if note.UpdatedAt.After(lastModified) {
+			lastModified = note.UpdatedAt
+		}
+	}
+	locations = geo.NewIndex()
+	noteLinks = map[string][]links.Link{}
+	for _, note := range notes {
+		indexLocation(note.ID, &note)
+		indexLinks(note.ID, &note)
+	}
+	restoreState(state)
+	SearchIndex.StartRebuild()
+	go finishSearchRebuild(append([]models.Note(nil), notes...))
+}
+
+// restoreState replaces what hangs off the notes with state, leaving out
+// what belongs to notes that weren't restored. Callers must hold mu.
+func restoreState(state backup.State) {
+	attachments = map[string]*storedAttachment{}
+	for _, a := range state.Attachments {
+		if noteExists(a.NoteID) {
+			attachments[a.ID] = &storedAttachment{Attachment: a.Attachment, data: a.Data}
+		}
+	}
+	relations = nil
+	for _, r := range state.Relations {
+		if noteExists(r.From) && noteExists(r.To) {
+			relations = append(relations, r)
+		}
+	}
+	shares = map[string]models.Share{}
+	for _, s := range state.Shares {
+		if s.NoteID == "" || noteExists(s.NoteID) {
+			share := s.Share
+			share.Owner, share.Workspace = s.Owner, s.Workspace
+			shares[share.Token] = share
+		}
+	}
+	positions = map[string]map[string]models.ReadingPosition{}
+	for _, p := range state.Positions {
+		if !noteExists(p.NoteID) {
+			continue
+		}
+		if positions[p.NoteID] == nil {
+			positions[p.NoteID] = map[string]models.ReadingPosition{}
+		}
+		positions[p.NoteID][p.Key] = p.ReadingPosition
+	}
+	reviewQueue = nil
+	reviewedAt = map[string]time.Time{}
+	for _, r := range state.Reviews {
+		if noteExists(r.NoteID) {
+			reviewedAt[r.NoteID] = r.ReviewedAt
+		}
+	}
+}
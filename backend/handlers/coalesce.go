@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"note/backend/cache"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/singleflight"
+)
+
+// publicTTL is how long a public page is served as rendered. Changes to
+// notes and revoked share links render it again right away; the TTL
+// bounds how long anything else takes to show.
+const publicTTL = 10 * time.Second
+
+// rendered is a public page as sent to readers
+type rendered struct {
+	status      int
+	contentType string
+	body        []byte
+	etag        string
+	modified    time.Time
+	at          time.Time
+}
+
+// Public pages, keyed by what they show and the change sequence they were
+// rendered at. Readers asking for a page at once share a single render.
+var (
+	publicCache = cache.New[string, rendered](256)
+	rendering   singleflight.Group
+)
+
+// revokedShares counts revoked share links, so that pages rendered before
+// a revocation aren't served after it. Guarded by mu.
+var revokedShares int64
+
+// renderOnce returns the page key names, rendering it with render unless
+// it was rendered since the last change to the notes or shares less than
+// publicTTL ago or is being rendered for another reader
+func renderOnce(key string, render func() (rendered, error)) (rendered, error) {
+	mu.Lock()
+	key += "@" + strconv.FormatInt(lastSeq, 10) + "." + strconv.FormatInt(revokedShares, 10)
+	mu.Unlock()
+	if page, ok := publicCache.Get(key); ok && time.Since(page.at) < publicTTL {
+		return page, nil
+	}
+	v, err, _ := rendering.Do(key, func() (any, error) {
+		page, err := render()
+		if err != nil {
+			return rendered{}, err
+		}
+		page.at = time.Now()
+		publicCache.Add(key, page)
+		return page, nil
+	})
+	return v.(rendered), err
+}
+
+// renderedJSON renders v as a JSON page
+func renderedJSON(status int, v any) (rendered, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return rendered{}, err
+	}
+	return rendered{status: status, contentType: echo.MIMEApplicationJSON, body: body}, nil
+}
+
+// sendRendered sends a page, or 304 Not Modified if the reader has it
+func sendRendered(c echo.Context, page rendered) error {
+	if page.etag != "" && notModified(c, page.etag, page.modified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(page.status, page.contentType, page.body)
+}
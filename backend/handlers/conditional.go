@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"note/backend/models"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// noteETag changes whenever the note is written
+func noteETag(note models.Note) string {
+	return fmt.Sprintf(`"%s-%d"`, note.ID, note.UpdatedAt.UnixNano())
+}
+
+// etagMatches reports whether etag is one of the ETags in the value of an
+// If-Match or If-None-Match header, or the header is "*"
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesNote reports whether the value of an If-Match header names the
+// version of note, by its ETag with or without a reading position
+func matchesNote(header string, note models.Note) bool {
+	etag := noteETag(note)
+	withPosition := strings.TrimSuffix(etag, `"`) + "-"
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" || strings.HasPrefix(candidate, withPosition) {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets ETag and Last-Modified on the response and reports
+// whether the client's cached copy is still current. If-None-Match wins
+// over If-Modified-Since when a client sends both (RFC 9110 13.2.2).
+func notModified(c echo.Context, etag string, modified time.Time) bool {
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	req := c.Request()
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		return etagMatches(match, etag)
+	}
+	if since := req.Header.Get("If-Modified-Since"); since != "" && !modified.IsZero() {
+		t, err := http.ParseTime(since)
+		// Last-Modified only has second precision
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
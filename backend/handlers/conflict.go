@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/models"
+	"note/backend/textdiff"
+
+	"github.com/labstack/echo/v4"
+)
+
+// noteVersion finds the note as it was when it had the given ETag, in the
+// change log or as the log begins. It reports false once the log no
+// longer goes back that far. Callers must hold mu.
+func noteVersion(id, etag string) (models.Note, bool) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		if note := changes[i].Note; changes[i].NoteID == id && note != nil && matchesNote(etag, *note) {
+			return *note, true
+		}
+	}
+	for _, note := range historyBase {
+		if note.ID == id && matchesNote(etag, note) {
+			return note, true
+		}
+	}
+	return models.Note{}, false
+}
+
+// noteText is the title and content of a version of a note
+type noteText struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+type mergePreviewRequest struct {
+	// Base is the ETag of the version the draft was edited from, which
+	// the If-Match header may give instead
+	Base string `json:"base"`
+	noteText
+}
+
+type mergePreview struct {
+	// Base is nil when the change log no longer has that version; the
+	// whole draft is then merged as a conflicting change
+	Base   *noteText `json:"base"`
+	Theirs noteText  `json:"theirs"`
+	Yours  noteText  `json:"yours"`
+	// Merged has conflicting lines of the content between <<<<<<< yours,
+	// ||||||| base, ======= and >>>>>>> theirs markers. A title both
+	// changed is left at yours, with TitleConflict set.
+	Merged        noteText `json:"merged"`
+	Conflicts     int      `json:"conflicts"`
+	TitleConflict bool     `json:"title_conflict"`
+	// ETag is the version to save the merge over with If-Match
+	ETag string `json:"etag"`
+}
+
+// Propose how to merge a draft into a note that was changed since the
+// draft's base version, after an update answered 409: {"base": "<ETag>",
+// "title": ..., "content": ...}. Nothing is saved; the client saves the
+// merge, once its conflicts are resolved, with If-Match of the returned
+// etag.
+func PreviewMerge(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	var req mergePreviewRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Base == "" {
+		req.Base = c.Request().Header.Get("If-Match")
+	}
+	if req.Base == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "base must be the ETag the draft was edited from"})
+	}
+
+	current, err := storeOf(c).Get(id)
+	if err != nil {
+		return storeError(c, err)
+	}
+	mu.Lock()
+	base, known := noteVersion(id, req.Base)
+	mu.Unlock()
+	if current.ContentEncrypted || (known && base.ContentEncrypted) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Encrypted notes can't be merged on the server"})
+	}
+
+	p := mergePreview{
+		Theirs: noteText{current.Title, current.Content},
+		Yours:  req.noteText,
+		ETag:   noteETag(current),
+	}
+	if known {
+		p.Base = &noteText{base.Title, base.Content}
+	}
+	var baseTitle, baseContent string
+	if p.Base != nil {
+		baseTitle, baseContent = p.Base.Title, p.Base.Content
+	}
+	p.Merged.Content, p.Conflicts = textdiff.Merge3(baseContent, p.Yours.Content, p.Theirs.Content)
+	switch {
+	case p.Yours.Title == p.Theirs.Title || p.Theirs.Title == baseTitle:
+		p.Merged.Title = p.Yours.Title
+	case p.Yours.Title == baseTitle:
+		p.Merged.Title = p.Theirs.Title
+	default:
+		p.Merged.Title, p.TitleConflict = p.Yours.Title, true
+	}
+	return c.JSON(http.StatusOK, p)
+}
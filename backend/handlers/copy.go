@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/audit"
+	"note/backend/links"
+	"note/backend/models"
+	"note/backend/workspace"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// copyToPath is the route copying notes between workspaces. Its
+// ?workspace= names where the copy goes, so the note is looked up in the
+// workspace the header picks.
+const copyToPath = "/api/notes/:id/copy-to"
+
+// Copy a note into another workspace the caller may edit, named by
+// ?workspace= (empty for the default one). The copy belongs to the caller
+// and starts out unpublished, unshared and without reminders. Its
+// attachments are copied along, sharing their files with the original,
+// and links to the note itself or to notes copied into that workspace
+// before point at the copies there.
+func CopyNoteToWorkspace(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	to, given := c.QueryParams()["workspace"]
+	if !given || len(to) != 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Name the workspace to copy to with ?workspace="})
+	}
+	target := to[0]
+	if target == workspaceOf(c) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "workspace must be another workspace"})
+	}
+	role, ok := workspaceRole(c, target)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+	}
+	if !role.Grants(workspace.Editor) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Copying into a workspace takes the editor role in it"})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var src models.Note
+	found := false
+	for _, n := range notes {
+		if n.ID == id && n.Workspace == workspaceOf(c) {
+			src, found = n, true
+		}
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+
+	note := models.Note{
+		Title:            src.Title,
+		Content:          src.Content,
+		Notebook:         src.Notebook,
+		ContentEncrypted: src.ContentEncrypted,
+		PrivateSections:  src.PrivateSections,
+		Language:         src.Language,
+		LanguageDetected: src.LanguageDetected,
+		Location:         src.Location,
+		Workspace:        target,
+		Owner:            ownerOf(c),
+		CopiedFrom:       src.ID,
+	}
+	for _, item := range src.Items {
+		note.Items = append(note.Items, models.TodoItem{Text: item.Text, Done: item.Done, Position: item.Position})
+	}
+	if err := checkLimits(note, ""); err != nil {
+		return limitResponse(c, err)
+	}
+	files := attachmentsOf(src.ID)
+	if quota := Limits.PerUser.MaxStorage; note.Owner != "" && quota > 0 {
+		if usageOf(note.Owner).StorageBytes+noteSize(note)+attachmentBytes(src.ID) > quota {
+			return limitResponse(c, ErrStorageLimit)
+		}
+	}
+
+	// The copy needs its ID before its links can point at it
+	note.ID = models.NewNoteID()
+	copiedNotes := map[string]string{src.ID: note.ID}
+	for _, other := range notes {
+		if other.Workspace == target && other.CopiedFrom != "" {
+			copiedNotes[other.CopiedFrom] = other.ID
+		}
+	}
+	copiedFiles := map[string]string{}
+	var copies []*storedAttachment
+	for _, a := range files {
+		copied := *a
+		copied.ID = uuid.NewString()
+		copied.NoteID = note.ID
+		copiedFiles[a.ID] = copied.ID
+		copies = append(copies, &copied)
+	}
+	if !note.ContentEncrypted {
+		note.Content = rewriteLinks(note.Content, copiedNotes, copiedFiles)
+	}
+
+	insertNote(&note)
+	for _, a := range copies {
+		attachments[a.ID] = a
+	}
+	recordAudit(actorOf(c), audit.Create, note.ID, "copied from "+src.ID)
+	return c.JSON(http.StatusCreated, note)
+}
+
+// rewriteLinks points the links in content to notes and attachments that
+// were copied at their copies: notty://note/<id> and [[<id>]] by note ID,
+// /api/attachments/<id> by attachment ID. Links by title and by legacy
+// ID are left alone.
+func rewriteLinks(content string, copiedNotes, copiedFiles map[string]string) string {
+	var pairs []string
+	for _, l := range links.Parse(content) {
+		if to := copiedNotes[strings.ToLower(l.ID)]; to != "" {
+			pairs = append(pairs, "notty://note/"+l.ID, "notty://note/"+to, "[["+l.ID, "[["+to)
+		}
+	}
+	for from, to := range copiedFiles {
+		pairs = append(pairs, "/api/attachments/"+from, "/api/attachments/"+to)
+	}
+	return strings.NewReplacer(pairs...).Replace(content)
+}
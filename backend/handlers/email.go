@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/mail"
+	"note/backend/email"
+	"note/backend/notify"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// EmailTemplates render every email the server sends. setup loads them
+// from the config.
+var EmailTemplates *email.Templates
+
+// Email sends notifications by email; nil while SMTP isn't configured
+var Email *notify.EmailNotifier
+
+// sampleEmail renders an email of the given template about made-up notes
+func sampleEmail(name string) (email.Message, error) {
+	now := time.Now()
+	event := notify.Event{
+		Type:   notify.NoteShared,
+		NoteID: "01a13f0a-0000-7000-8000-000000000001",
+		Title:  "Weekly plan",
+		Detail: "Anyone with the link can read this note until it is revoked.",
+		At:     now,
+	}
+	switch name {
+	case "event":
+		return notify.EventEmail(EmailTemplates, event)
+	case "digest":
+		other := notify.Event{Type: notify.NoteUpdated, NoteID: "01a13f0a-0000-7000-8000-000000000002", Title: "Groceries", At: now}
+		return notify.DigestEmail(EmailTemplates, []notify.Event{event, other, other, {Type: notify.NoteCreated, NoteID: event.NoteID, Title: event.Title, At: now}})
+	}
+	return EmailTemplates.Render(name, nil)
+}
+
+// List the email templates and which of them come from the templates
+// directory
+func GetEmailTemplates(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]any{
+		"templates": email.Names,
+		"custom":    EmailTemplates.Custom(),
+	})
+}
+
+// Preview an email template rendered with sample notes: its subject, text
+// and HTML as JSON, or with ?format=html or text only that part
+func PreviewEmailTemplate(c echo.Context) error {
+	known := false
+	for _, name := range email.Names {
+		known = known || name == c.Param("name")
+	}
+	if !known {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Email template not found"})
+	}
+	msg, err := sampleEmail(c.Param("name"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	switch c.QueryParam("format") {
+	case "", "json":
+		return c.JSON(http.StatusOK, msg)
+	case "html":
+		return c.HTML(http.StatusOK, msg.HTML)
+	case "text":
+		return c.String(http.StatusOK, msg.Text)
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json, html or text"})
+}
+
+type testEmailRequest struct {
+	Template string   `json:"template"` // "test" by default
+	To       []string `json:"to"`       // the notification recipients by default
+}
+
+// Send an email rendered with sample notes over the configured SMTP
+// server, to check templates and delivery end to end
+func SendTestEmail(c echo.Context) error {
+	if Email == nil {
+		return c.JSON(http.StatusNotImplemented, map[string]string{"error": "Email is not configured"})
+	}
+	var req testEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Template == "" {
+		req.Template = "test"
+	}
+	for _, to := range req.To {
+		if addr, err := mail.ParseAddress(to); err != nil || addr.Address != to {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid address " + to})
+		}
+	}
+	msg, err := sampleEmail(req.Template)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := Email.Send(msg, req.To); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Sending failed: " + err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Test email sent"})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The embed page tells its parent how tall it is so the iframe can be
+// sized to fit without scrollbars. It posts
+//
+//	{"type": "notty:resize", "token": "<share token>", "height": <px>}
+//
+// to window.parent on load and whenever its size changes. A parent can
+// also send {"type": "notty:measure"} to ask for the current height.
+var embedPage = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html{{with .Language}} lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style nonce="{{.Nonce}}">
+  html, body { margin: 0; padding: 0; }
+  body { font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; color: #1f2937; }
+  article { padding: 16px; }
+  h1 { font-size: 1.25rem; margin: 0 0 12px; }
+  .content { white-space: pre-wrap; word-wrap: break-word; }
+</style>
+</head>
+<body>
+<article>
+  <h1>{{.Title}}</h1>
+  {{if .Encrypted}}<p><em>This note is end-to-end encrypted and can't be shown here.</em></p>
+  {{else}}<div class="content">{{.Content}}</div>{{end}}
+</article>
+<script nonce="{{.Nonce}}">
+(function () {
+  var token = {{.Token}};
+  function post() {
+    var height = document.documentElement.scrollHeight;
+    window.parent.postMessage({ type: "notty:resize", token: token, height: height }, "*");
+  }
+  window.addEventListener("load", post);
+  window.addEventListener("message", function (e) {
+    if (e.data && e.data.type === "notty:measure") post();
+  });
+  if (window.ResizeObserver) new ResizeObserver(post).observe(document.body);
+})();
+</script>
+</body>
+</html>
+`))
+
+// embedNonce stands in for the CSP nonce in cached embed pages, each
+// response getting a fresh one. It is random so notes can't contain it.
+var embedNonce = func() string {
+	nonce, err := newShareToken()
+	if err != nil {
+		panic(err)
+	}
+	return nonce
+}()
+
+// Serve a shared note as a small HTML page meant to be put in an iframe
+func EmbedNote(c echo.Context) error {
+	token := c.Param("token")
+	page, err := renderOnce("embed:"+token, func() (rendered, error) {
+		mu.Lock()
+		note, ok := sharedNote(token)
+		mu.Unlock()
+		if !ok {
+			return rendered{status: http.StatusNotFound, contentType: echo.MIMETextPlainCharsetUTF8, body: []byte("Note not found")}, nil
+		}
+		note = redacted(note)
+		var body bytes.Buffer
+		err := embedPage.Execute(&body, map[string]any{
+			"Title":     note.Title,
+			"Content":   note.Content,
+			"Encrypted": note.ContentEncrypted,
+			"Language":  note.Language,
+			"Token":     token,
+			"Nonce":     embedNonce,
+		})
+		return rendered{status: http.StatusOK, contentType: echo.MIMETextHTMLCharsetUTF8, body: body.Bytes()}, err
+	})
+	if err != nil {
+		return err
+	}
+	if page.status != http.StatusOK {
+		return sendRendered(c, page)
+	}
+
+	nonce, err := newShareToken()
+	if err != nil {
+		return err
+	}
+	header := c.Response().Header()
+	// Only our own inline script and style may run next to user content
+	header.Set("Content-Security-Policy", strings.Join([]string{
+		"default-src 'none'",
+		"script-src 'nonce-" + nonce + "'",
+		"style-src 'nonce-" + nonce + "'",
+		"img-src https: data:",
+		"frame-ancestors *",
+	}, "; "))
+	header.Set("X-Content-Type-Options", "nosniff")
+	return c.HTMLBlob(http.StatusOK, bytes.ReplaceAll(page.body, []byte(embedNonce), []byte(nonce)))
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// eventsHeartbeat keeps idle event streams from being cut by proxies
+const eventsHeartbeat = 30 * time.Second
+
+// Stream note changes as Server-Sent Events, for clients that can't use
+// the gRPC watch. Each event is a change named after its op, with its
+// sequence as ID, so a reconnecting EventSource resumes after the last
+// event it got through the Last-Event-ID header (or ?last_event_id=).
+// Without either the stream starts with the next change. When the log no
+// longer goes back that far, a reset event tells the client to sync from
+// scratch and the stream goes on from the latest change.
+func StreamEvents(c echo.Context) error {
+	mu.Lock()
+	since := lastSeq
+	mu.Unlock()
+	raw := c.Request().Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = c.QueryParam("last_event_id")
+	}
+	if raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 || n > since {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid Last-Event-ID"})
+		}
+		since = n
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no") // nginx would hold events back
+	res.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(res, "retry: 5000\n\n"); err != nil {
+		return nil
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	ctx := c.Request().Context()
+	for {
+		pending, next, err := storeOf(c).Watch(since)
+		if errors.Is(err, ErrCursorExpired) {
+			mu.Lock()
+			since = lastSeq
+			mu.Unlock()
+			if _, err := fmt.Fprintf(res, "id: %d\nevent: reset\ndata: {}\n\n", since); err != nil {
+				return nil
+			}
+			res.Flush()
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		for _, change := range pending {
+			since = change.Seq
+			data, err := json.Marshal(change)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", change.Seq, change.Op, data); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+
+		select {
+		case <-next:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"note/backend/export"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExportSigningKey signs the manifest of exports when set
+var ExportSigningKey ed25519.PrivateKey
+
+// maxVerifySize is the largest export POST /api/export/verify reads
+const maxVerifySize = 256 << 20
+
+// Export a single note as a Markdown bundle
+func ExportNote(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	var bundle export.Bundle
+	for _, note := range inWorkspace(c, notes) {
+		if note.ID == id {
+			bundle.Notes = append(bundle.Notes, note)
+		}
+	}
+	bundle.Assets = bundleAssets(bundle.Notes)
+	bundle.Signer, bundle.Key = actorOf(c), ExportSigningKey
+	mu.Unlock()
+	if len(bundle.Notes) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	return writeBundle(c, bundle, fmt.Sprintf("note-%s.zip", id))
+}
+
+// Export every note, or only one notebook with ?notebook=. Large exports
+// can run as a job with ?async=true, to be downloaded from the job's
+// output once done.
+func ExportNotes(c echo.Context) error {
+	notebook := c.QueryParam("notebook")
+	if c.QueryParam("async") == "true" {
+		return enqueueJob(c, jobExport, exportJob{Workspace: workspaceOf(c), Notebook: notebook, Signer: actorOf(c)})
+	}
+	return writeBundle(c, notebookBundle(workspaceOf(c), notebook, actorOf(c)), "notes.zip")
+}
+
+// notebookBundle collects every note of a workspace, or those of one
+// notebook, for signer to export
+func notebookBundle(workspace, notebook, signer string) export.Bundle {
+	bundle := export.Bundle{Notebook: notebook, Signer: signer, Key: ExportSigningKey}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, note := range notes {
+		if note.Workspace == workspace && (bundle.Notebook == "" || note.Notebook == bundle.Notebook) {
+			bundle.Notes = append(bundle.Notes, note)
+		}
+	}
+	bundle.Assets = bundleAssets(bundle.Notes)
+	return bundle
+}
+
+func writeBundle(c echo.Context, bundle export.Bundle, filename string) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	res.WriteHeader(http.StatusOK)
+	return bundle.WriteZip(res)
+}
+
+// Get the public key export manifests are signed with
+func GetExportSigningKey(c echo.Context) error {
+	if ExportSigningKey == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Exports aren't signed"})
+	}
+	public := ExportSigningKey.Public().(ed25519.PublicKey)
+	return c.JSON(http.StatusOK, map[string]string{
+		"algorithm":  "ed25519",
+		"key_id":     export.KeyID(public),
+		"public_key": base64.StdEncoding.EncodeToString(public),
+	})
+}
+
+// Check an export posted as the request body: that no file was changed,
+// added or removed since, and that this server signed it if it is signed
+func VerifyExport(c echo.Context) error {
+	data, err := io.ReadAll(io.LimitReader(c.Request().Body, maxVerifySize+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Could not read the export"})
+	}
+	if len(data) > maxVerifySize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Export is too large to verify"})
+	}
+	var public ed25519.PublicKey
+	if ExportSigningKey != nil {
+		public = ExportSigningKey.Public().(ed25519.PublicKey)
+	}
+	res, err := export.Verify(bytes.NewReader(data), int64(len(data)), public)
+	if errors.Is(err, export.ErrNoManifest) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "The archive has no manifest"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Not a valid export: " + err.Error()})
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"note/backend/auth"
+	"note/backend/feed"
+	"note/backend/models"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	feedEntries     = 50
+	feedSummarySize = 280
+)
+
+// cachedFeed is a rendered feed together with the notebook sequence it
+// was rendered at. Any change to the notebook moves the sequence on and
+// makes the cached copy stale.
+type cachedFeed struct {
+	seq     int64
+	baseURL string
+	body    []byte
+}
+
+// feedCache is keyed by feedKey and guarded by mu
+var feedCache = map[string]cachedFeed{}
+
+// feedKey tells apart the feeds of notebooks with the same name, which
+// tokens of other owners or workspaces see other notes of
+func feedKey(token auth.Token, name string) string {
+	return token.Owner + "\x00" + token.Workspace + "\x00" + name
+}
+
+// Atom feed of the published notes in a notebook, newest first
+func GetNotebookFeed(c echo.Context) error {
+	name := c.Param("notebook")
+	token, _ := auth.FromContext(c)
+	if token.Notebook != "" && token.Notebook != name {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Notebook not found"})
+	}
+	baseURL := c.Scheme() + "://" + c.Request().Host
+
+	mu.Lock()
+	defer mu.Unlock()
+	seq := notebookSeq[name]
+	key := feedKey(token, name)
+	cached, ok := feedCache[key]
+	if !ok || cached.seq != seq || cached.baseURL != baseURL {
+		body, found, err := renderNotebookFeed(token, name, baseURL)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Notebook not found"})
+		}
+		cached = cachedFeed{seq: seq, baseURL: baseURL, body: body}
+		feedCache[key] = cached
+	}
+	return c.Blob(http.StatusOK, "application/atom+xml; charset=utf-8", cached.body)
+}
+
+// renderNotebookFeed builds the feed from the notes the token sees.
+// Callers must hold mu.
+func renderNotebookFeed(token auth.Token, name, baseURL string) ([]byte, bool, error) {
+	var published []models.Note
+	for _, note := range notes {
+		if note.Notebook == name && visible(token, note) {
+			published = append(published, note)
+		}
+	}
+	if len(published) == 0 {
+		return nil, false, nil
+	}
+	published = newestFirst(published)
+
+	self := baseURL + "/api/public/notebooks/" + url.PathEscape(name) + "/feed.atom"
+	f := feed.New("urn:notty:notebook:"+name, "Notty – "+name, self, latestUpdate(published))
+	for _, note := range published {
+		id := PublicIDs.Encode(note.ID)
+		entry := feed.Entry{
+			ID:        feedEntryID(note.ID, id),
+			Title:     note.Title,
+			Updated:   feed.Time(note.UpdatedAt),
+			Published: feed.Time(publishedAt(note)),
+			Links:     []feed.Link{{Rel: "alternate", Type: "application/json", Href: baseURL + "/api/public/notes/" + id}},
+		}
+		if !note.ContentEncrypted {
+			entry.Summary = feed.Summary(redacted(note).Content, feedSummarySize)
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	body, err := f.Marshal()
+	return body, true, err
+}
+
+// feedEntryID keeps the UUID URNs entries had before public IDs could
+// differ from internal ones
+func feedEntryID(id, public string) string {
+	if public == id {
+		return "urn:uuid:" + id
+	}
+	return "urn:notty:note:" + public
+}
+
+func latestUpdate(list []models.Note) time.Time {
+	var latest time.Time
+	for _, note := range list {
+		if note.UpdatedAt.After(latest) {
+			latest = note.UpdatedAt
+		}
+	}
+	return latest
+}
+
+// publishedAt is when a note was published, or created for notes
+// published before that was kept
+func publishedAt(note models.Note) time.Time {
+	if note.PublishedAt != nil {
+		return *note.PublishedAt
+	}
+	return note.CreatedAt
+}
+
+// Atom feed of the token owner's recently changed notes, for feed readers.
+// Those can't send headers, so the read:feed token usually comes as ?token=.
+func GetRecentFeed(c echo.Context) error {
+	token, _ := auth.FromContext(c)
+	baseURL := c.Scheme() + "://" + c.Request().Host
+	mu.Lock()
+	var recent []models.Note
+	for _, note := range notes {
+		if ownNote(token, note) {
+			recent = append(recent, note)
+		}
+	}
+	mu.Unlock()
+	recent = newestFirst(recent)
+
+	self := baseURL + "/api/feed.atom"
+	f := feed.New("urn:notty:feed:"+token.ID, "Notty – recent notes", self, latestUpdate(recent))
+	for _, note := range recent {
+		entry := feed.Entry{
+			ID:        "urn:uuid:" + note.ID,
+			Title:     note.Title,
+			Updated:   feed.Time(note.UpdatedAt),
+			Published: feed.Time(note.CreatedAt),
+			Links:     []feed.Link{{Rel: "alternate", Type: "application/json", Href: baseURL + "/api/notes/" + note.ID}},
+		}
+		if !note.ContentEncrypted {
+			entry.Summary = feed.Summary(note.Content, feedSummarySize)
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	body, err := f.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, "application/atom+xml; charset=utf-8", body)
+}
+
+// Atom feed of a notebook shared by link, with the full text of its
+// notes minus their private sections
+func GetSharedNotebookFeed(c echo.Context) error {
+	token := c.Param("token")
+	baseURL := c.Scheme() + "://" + c.Request().Host
+	page, err := renderOnce("share-feed:"+token+":"+baseURL, func() (rendered, error) {
+		return renderSharedNotebookFeed(token, baseURL)
+	})
+	if err != nil {
+		return err
+	}
+	return sendRendered(c, page)
+}
+
+func renderSharedNotebookFeed(token, baseURL string) (rendered, error) {
+	mu.Lock()
+	share, list, ok := sharedNotebook(token)
+	for i, note := range list {
+		list[i] = redacted(note)
+	}
+	mu.Unlock()
+	if !ok {
+		return renderedJSON(http.StatusNotFound, map[string]string{"error": "Notebook not found"})
+	}
+	list = newestFirst(list)
+
+	self := baseURL + "/share/" + url.PathEscape(token) + "/feed.atom"
+	f := feed.New("urn:notty:share:"+token, "Notty – "+share.Notebook, self, latestUpdate(list))
+	for _, note := range list {
+		id := PublicIDs.Encode(note.ID)
+		entry := feed.Entry{
+			ID:        feedEntryID(note.ID, id),
+			Title:     note.Title,
+			Updated:   feed.Time(note.UpdatedAt),
+			Published: feed.Time(note.CreatedAt),
+		}
+		if note.ContentEncrypted {
+			entry.Content = &feed.Text{Type: "text", Body: "This note is end-to-end encrypted and can't be shown here."}
+		} else {
+			entry.Content = &feed.Text{Type: "text", Body: note.Content}
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	body, err := f.Marshal()
+	if err != nil {
+		return rendered{}, err
+	}
+	return rendered{status: http.StatusOK, contentType: "application/atom+xml; charset=utf-8", body: body}, nil
+}
+
+// newestFirst sorts notes by when they last changed and keeps the ones
+// that fit in a feed
+func newestFirst(list []models.Note) []models.Note {
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.After(list[j].UpdatedAt) })
+	if len(list) > feedEntries {
+		list = list[:feedEntries]
+	}
+	return list
+}
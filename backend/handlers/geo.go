@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/geo"
+	"note/backend/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultNearbyRadius = 1000 // meters
+	maxNearbyResults    = 200
+)
+
+// locations indexes the notes that have a location. It is kept up to
+// date by recordChange and guarded by mu.
+var locations = geo.NewIndex()
+
+// indexLocation updates the location of a note in the index after a
+// write; note is nil for deletes. Callers must hold mu.
+func indexLocation(id string, note *models.Note) {
+	if note == nil || note.Location == nil {
+		locations.Remove(id)
+		return
+	}
+	locations.Put(id, *note.Location)
+}
+
+// NearbyNote is a note found by its location
+type NearbyNote struct {
+	models.Note
+	Distance float64 `json:"distance"` // meters
+}
+
+// Find the notes within ?radius= meters of ?lat= and ?lng=, nearest
+// first, up to ?limit=
+func GetNearbyNotes(c echo.Context) error {
+	var center geo.Point
+	var err error
+	if center.Lat, err = strconv.ParseFloat(c.QueryParam("lat"), 64); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lat must be a number"})
+	}
+	if center.Lng, err = strconv.ParseFloat(c.QueryParam("lng"), 64); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lng must be a number"})
+	}
+	if !center.Valid() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lat must be -90 to 90 and lng -180 to 180"})
+	}
+	radius := float64(defaultNearbyRadius)
+	if v := c.QueryParam("radius"); v != "" {
+		radius, err = strconv.ParseFloat(v, 64)
+		if err != nil || !(radius > 0) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "radius must be a positive number of meters"})
+		}
+		radius = min(radius, geo.MaxRadius)
+	}
+	limit := 50
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxNearbyResults {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be 1 to 200"})
+		}
+		limit = n
+	}
+
+	results := storeOf(c).Nearby(center, radius)
+	total := len(results)
+	if total > limit {
+		results = results[:limit]
+	}
+	return c.JSON(http.StatusOK, map[string]any{"results": results, "total": total})
+}
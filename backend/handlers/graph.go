@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/export"
+	"note/backend/models"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Get the notes, their notebooks, the relations between them and the
+// links in their content as a graph, in ?format=json or graphml.
+// ?notebook= keeps only the notes of one notebook, ?relations= only the
+// relation types it lists, ?notebooks=false leaves out the notebook nodes
+// and ?links=false the links. Notebooks stand in for
+// tags, which notes don't have.
+func GetGraph(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "graphml" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json or graphml"})
+	}
+	notebook := c.QueryParam("notebook")
+	withNotebooks := c.QueryParam("notebooks") != "false"
+	withLinks := c.QueryParam("links") != "false"
+	var types map[string]bool
+	if v := c.QueryParam("relations"); v != "" {
+		types = map[string]bool{}
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !models.ValidRelationType(t) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown relation type " + t})
+			}
+			types[t] = true
+		}
+	}
+
+	mu.Lock()
+	g := export.Graph{Nodes: []export.Node{}, Edges: []export.Edge{}}
+	included := map[string]bool{}
+	notebooks := map[string]bool{}
+	for _, note := range notes {
+		if note.Workspace != workspaceOf(c) || (notebook != "" && note.Notebook != notebook) {
+			continue
+		}
+		included[note.ID] = true
+		g.Nodes = append(g.Nodes, export.Node{ID: note.ID, Kind: export.NodeNote, Label: note.Title, Notebook: note.Notebook})
+		if !withNotebooks || note.Notebook == "" {
+			continue
+		}
+		nbID := "notebook:" + note.Notebook
+		if !notebooks[note.Notebook] {
+			notebooks[note.Notebook] = true
+			g.Nodes = append(g.Nodes, export.Node{ID: nbID, Kind: export.NodeNotebook, Label: note.Notebook})
+		}
+		g.Edges = append(g.Edges, export.Edge{ID: note.ID + ":notebook", Kind: export.EdgeInNotebook, Source: note.ID, Target: nbID})
+	}
+	for _, r := range relations {
+		if included[r.From] && included[r.To] && (types == nil || types[r.Type]) {
+			g.Edges = append(g.Edges, export.Edge{
+				ID:         r.ID,
+				Kind:       r.Type,
+				Source:     r.From,
+				Target:     r.To,
+				Undirected: r.Type == models.RelationRelatedTo,
+			})
+		}
+	}
+	if withLinks {
+		r := newLinkResolver(inWorkspace(c, notes))
+		for _, note := range notes {
+			if !included[note.ID] {
+				continue
+			}
+			for _, target := range r.linksFrom(note.ID) {
+				if included[target] {
+					g.Edges = append(g.Edges, export.Edge{
+						ID:     note.ID + ":links:" + target,
+						Kind:   export.EdgeLinksTo,
+						Source: note.ID,
+						Target: target,
+					})
+				}
+			}
+		}
+	}
+	mu.Unlock()
+
+	if format == "graphml" {
+		c.Response().Header().Set(echo.HeaderContentType, "application/graphml+xml; charset=UTF-8")
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="notes.graphml"`)
+		c.Response().WriteHeader(http.StatusOK)
+		return export.WriteGraphML(c.Response(), g)
+	}
+	return c.JSON(http.StatusOK, g)
+}
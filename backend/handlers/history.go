@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/models"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// asOf reads the ?as_of= RFC 3339 time of a time-travel read. It reports
+// false when the parameter isn't set.
+func asOf(c echo.Context) (time.Time, bool, error) {
+	v := c.QueryParam("as_of")
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, true, err
+}
+
+// asOfError answers a read with an invalid ?as_of=
+func asOfError(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": "as_of must be an RFC 3339 time"})
+}
+
+// notesAsOf replays the change log up to t, returning the notes in the
+// order they were created. It reports false if t is before the log
+// begins, which is the last restart or restore or the oldest change the
+// log still keeps. Callers must hold mu.
+func notesAsOf(t time.Time) ([]models.Note, bool) {
+	if t.Before(historyStart) {
+		return nil, false
+	}
+	end := len(changes)
+	for i, change := range changes {
+		if change.At.After(t) {
+			end = i
+			break
+		}
+	}
+	return replay(historyBase, changes[:end]), true
+}
+
+// replay applies changes to a copy of base, keeping notes in the order
+// they were created
+func replay(base []models.Note, changes []models.Change) []models.Note {
+	list := append([]models.Note(nil), base...)
+	index := make(map[string]int, len(list))
+	for i, note := range list {
+		index[note.ID] = i
+	}
+	for _, change := range changes {
+		i, ok := index[change.NoteID]
+		switch {
+		case change.Note == nil:
+			if ok {
+				list[i].ID = "" // dropped below
+				delete(index, change.NoteID)
+			}
+		case ok:
+			list[i] = *change.Note
+		default:
+			index[change.NoteID] = len(list)
+			list = append(list, *change.Note)
+		}
+	}
+	kept := list[:0]
+	for _, note := range list {
+		if note.ID != "" {
+			kept = append(kept, note)
+		}
+	}
+	return kept
+}
+
+// historyError answers a time-travel read from before the change log
+func historyError(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, map[string]string{
+		"error": "History only goes back to " + historyStart.Format(time.RFC3339),
+	})
+}
+
+// getNoteAsOf answers GetNote with the note as it was at t
+func getNoteAsOf(c echo.Context, id string, t time.Time) error {
+	mu.Lock()
+	list, ok := notesAsOf(t)
+	mu.Unlock()
+	if !ok {
+		return historyError(c)
+	}
+	for _, note := range list {
+		if note.ID == id {
+			return c.JSON(http.StatusOK, note)
+		}
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+}
+
+// getNotesAsOf answers GetNotes with the notes as they were at t
+func getNotesAsOf(c echo.Context, t time.Time, openTasks bool, stream string, opts listOptions) error {
+	mu.Lock()
+	all, ok := notesAsOf(t)
+	mu.Unlock()
+	if !ok {
+		return historyError(c)
+	}
+	list := make([]models.Note, 0, len(all))
+	for _, note := range all {
+		if note.Workspace == workspaceOf(c) && (!openTasks || note.HasOpenItems()) {
+			list = append(list, note)
+		}
+	}
+	list = opts.apply(c, list)
+	if stream != streamOff {
+		return streamNotes(c, list, stream)
+	}
+	return c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// InboxNotebook is where notes created without a notebook are filed.
+// Notes stay unfiled while it is empty.
+var InboxNotebook = "Inbox"
+
+// List the notes waiting in the inbox
+func GetInbox(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	inbox := []models.Note{}
+	if InboxNotebook != "" {
+		for _, note := range notes {
+			if note.Notebook == InboxNotebook && note.Workspace == workspaceOf(c) {
+				inbox = append(inbox, note)
+			}
+		}
+	}
+	return c.JSON(http.StatusOK, inbox)
+}
+
+type triageRequest struct {
+	Moves []struct {
+		ID       string `json:"id"`
+		Notebook string `json:"notebook"`
+	} `json:"moves"`
+}
+
+// Move notes out of the inbox into other notebooks in one go. Either every
+// move is applied or, if any note is missing, none is.
+func TriageInbox(c echo.Context) error {
+	var req triageRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if len(req.Moves) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No moves given"})
+	}
+	targets := make(map[string]string, len(req.Moves))
+	for _, move := range req.Moves {
+		id, ok := models.ResolveNoteID(move.ID, AcceptLegacyIDs)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+		}
+		targets[id] = move.Notebook
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	found := 0
+	for _, note := range notes {
+		if _, ok := targets[note.ID]; ok && note.Workspace == workspaceOf(c) {
+			found++
+		}
+	}
+	if found != len(targets) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+
+	moved := []models.Note{}
+	now := time.Now()
+	for i := range notes {
+		notebook, ok := targets[notes[i].ID]
+		if !ok || notes[i].Notebook == notebook {
+			continue
+		}
+		from := notes[i].Notebook
+		notes[i].Notebook = notebook
+		notes[i].UpdatedAt = now
+		recordChange(models.ChangeUpdate, notes[i].ID, &notes[i])
+		recordAudit(actorOf(c), audit.Move, notes[i].ID, "from "+from+" to "+notebook)
+		touchNotebooks(from, notebook)
+		notifyNote(notify.NoteUpdated, notes[i])
+		moved = append(moved, notes[i])
+	}
+	return c.JSON(http.StatusOK, moved)
+}
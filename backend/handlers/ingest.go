@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/ingest"
+	"note/backend/models"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IngestDomain is the domain of the addresses notes can be emailed to. It
+// is set when the ingest server runs, and ingest can't be turned on
+// while it is empty.
+var IngestDomain string
+
+// mailAddress is the ingest address of one owner. Its token is the local
+// part; it is kept when ingest is turned off so the address stays the
+// same.
+type mailAddress struct {
+	Token   string
+	Enabled bool
+}
+
+// mailAddresses are keyed by owner, "" for the instance, and guarded by mu
+var mailAddresses = map[string]*mailAddress{}
+
+var lowerBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+func newMailToken() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return lowerBase32.EncodeToString(b), nil
+}
+
+// ingestSettings is the ingest setup of one owner as the API shows it
+type ingestSettings struct {
+	Available bool   `json:"available"` // whether the server takes mail at all
+	Enabled   bool   `json:"enabled"`
+	Address   string `json:"address,omitempty"`
+}
+
+// settingsOf returns the ingest setup of an owner. Callers must hold mu.
+func settingsOf(owner string) ingestSettings {
+	settings := ingestSettings{Available: IngestDomain != ""}
+	if addr := mailAddresses[owner]; addr != nil && settings.Available {
+		settings.Enabled = addr.Enabled
+		settings.Address = addr.Token + "@" + IngestDomain
+	}
+	return settings
+}
+
+// Get whether emails to the caller's ingest address become notes, and
+// the address
+func GetIngestSettings(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return c.JSON(http.StatusOK, settingsOf(ownerOf(c)))
+}
+
+// Turn email ingest on or off: {"enabled": true}. The address is created
+// the first time it is turned on.
+func UpdateIngestSettings(c echo.Context) error {
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Enabled && IngestDomain == "" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Email ingest isn't set up on this server"})
+	}
+	token, err := newMailToken()
+	if err != nil {
+		return err
+	}
+	owner := ownerOf(c)
+	mu.Lock()
+	defer mu.Unlock()
+	addr := mailAddresses[owner]
+	if addr == nil {
+		addr = &mailAddress{Token: token}
+		mailAddresses[owner] = addr
+	}
+	addr.Enabled = req.Enabled
+	return c.JSON(http.StatusOK, settingsOf(owner))
+}
+
+// Mailbox turns emails to enabled ingest addresses into notes of their
+// owner
+type Mailbox struct{}
+
+// lookup finds the owner of an enabled ingest address. Callers must hold mu.
+func (Mailbox) lookup(addr string) (string, bool) {
+	local, domain, ok := strings.Cut(strings.ToLower(addr), "@")
+	if !ok || domain != strings.ToLower(IngestDomain) {
+		return "", false
+	}
+	for owner, a := range mailAddresses {
+		if a.Token == local && a.Enabled {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+// Accepts reports whether addr is an enabled ingest address
+func (m Mailbox) Accepts(addr string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := m.lookup(addr)
+	return ok
+}
+
+// Deliver creates a note with the subject as title, the text as content
+// and the attachments of the email as its attachments. Attachments the
+// attachment policy refuses, whose content contradicts their type or that
+// are over the owner's quota are listed at the end of the content
+// instead.
+func (m Mailbox) Deliver(addr string, msg ingest.Message) error {
+	mu.Lock()
+	owner, ok := m.lookup(addr)
+	mu.Unlock()
+	if !ok {
+		return ingest.ErrUnknownRecipient
+	}
+	note := models.Note{Title: strings.TrimSpace(msg.Subject), Content: msg.Body, Owner: owner}
+	if note.Title == "" {
+		note.Title = "Email from " + msg.From
+	}
+	actor := owner
+	if actor == "" {
+		actor = audit.System
+	}
+	created, err := Store{Actor: actor}.Create(note)
+	if err != nil || len(msg.Attachments) == 0 {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Attachments are held to what an upload to the note would be
+	policy := attachmentPolicy(created.Workspace)
+	var skipped []string
+	for _, a := range msg.Attachments {
+		name := attachmentName(a.Filename)
+		contentType, data, err := policy.check(a.ContentType, a.Data, StripImageLocation)
+		quota := Limits.PerUser.MaxStorage
+		if err != nil || (owner != "" && quota > 0 && usageOf(owner).StorageBytes+len(data) > quota) {
+			skipped = append(skipped, name)
+			continue
+		}
+		addAttachment(created.ID, name, contentType, data)
+		recordAudit(actor, audit.Update, created.ID, "attached "+name)
+	}
+	if len(skipped) > 0 {
+		for i := range notes {
+			if notes[i].ID == created.ID {
+				notes[i].Content = Sanitization.Save.Apply("content", notes[i].Content+"\n\nAttachments not imported: "+strings.Join(skipped, ", "))
+				notes[i].UpdatedAt = time.Now()
+				recordChange(models.ChangeUpdate, created.ID, &notes[i])
+			}
+		}
+	}
+	return nil
+}
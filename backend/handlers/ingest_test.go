@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"note/backend/backup"
+	"note/backend/ingest"
+	"strings"
+	"testing"
+)
+
+func TestDeliverChecksAttachments(t *testing.T) {
+	mu.Lock()
+	restore(nil, backup.State{}, 0)
+	IngestDomain = "in.example.com"
+	mailAddresses[""] = &mailAddress{Token: "inbox", Enabled: true}
+	Limits.Attachments = AttachmentPolicy{AllowedTypes: []string{"image/*"}}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		IngestDomain = ""
+		delete(mailAddresses, "")
+		Limits.Attachments = AttachmentPolicy{}
+		mu.Unlock()
+	})
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	err := Mailbox{}.Deliver("inbox@in.example.com", ingest.Message{
+		Subject: "Scans",
+		Attachments: []ingest.Attachment{
+			{Filename: "scan.png", ContentType: "application/octet-stream", Data: img.Bytes()},
+			{Filename: "fake.jpg", ContentType: "image/jpeg", Data: img.Bytes()},
+			{Filename: "notes.txt", ContentType: "text/plain", Data: []byte("not an image")},
+			{Filename: `..\..\evil.png`, ContentType: "image/png", Data: img.Bytes()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, _ := Store{}.List(false)
+	if len(list) != 1 {
+		t.Fatalf("delivered %d notes, want 1", len(list))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var names []string
+	for _, a := range attachmentsOf(list[0].ID) {
+		names = append(names, a.Name+" "+a.ContentType)
+	}
+	if want := "scan.png image/png,evil.png image/png"; strings.Join(names, ",") != want {
+		t.Errorf("attached %q, want %q", names, want)
+	}
+	for _, skipped := range []string{"fake.jpg", "notes.txt"} {
+		if !strings.Contains(notes[0].Content, skipped) {
+			t.Errorf("content %q doesn't list %s as not imported", notes[0].Content, skipped)
+		}
+	}
+}
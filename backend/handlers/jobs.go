@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"note/backend/backup"
+	"note/backend/jobs"
+	"note/backend/notify"
+	"note/backend/webhook"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Jobs runs background work. main swaps in a Redis store when one is
+// configured, before starting the workers.
+var Jobs = jobs.New(jobs.NewMemoryStore())
+
+// Kinds of jobs
+const (
+	jobExport   = "export"
+	jobRestore  = "restore"
+	jobNotify   = "notify.dispatch"
+	jobDelivery = webhook.JobKind
+)
+
+type exportJob struct {
+	Workspace string `json:"workspace,omitempty"`
+	Notebook  string `json:"notebook,omitempty"`
+	Signer    string `json:"signer,omitempty"`
+}
+
+type restoreJob struct {
+	Force bool `json:"force"`
+}
+
+// RegisterJobs sets up the handlers of every kind of job and routes
+// webhook deliveries through the queue
+func RegisterJobs() {
+	Jobs.Handle(jobExport, runExport, jobs.Options{MaxAttempts: 1})
+	Jobs.Handle(jobRestore, runRestore, jobs.Options{MaxAttempts: 3})
+	Jobs.Handle(jobNotify, runNotify, jobs.Options{MaxAttempts: 1})
+	Jobs.Handle(jobDelivery, Webhooks.DeliverJob, jobs.Options{MaxAttempts: Webhooks.MaxAttempts, Backoff: Webhooks.Backoff})
+	Webhooks.Jobs = Jobs
+}
+
+func runExport(ctx context.Context, job jobs.Job) (jobs.Outcome, error) {
+	var req exportJob
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		return jobs.Outcome{}, jobs.Permanent(err)
+	}
+	bundle := notebookBundle(req.Workspace, req.Notebook, req.Signer)
+	var buf bytes.Buffer
+	if err := bundle.WriteZip(&buf); err != nil {
+		return jobs.Outcome{}, err
+	}
+	return jobs.Outcome{
+		Result:      map[string]int{"notes": len(bundle.Notes)},
+		Data:        buf.Bytes(),
+		ContentType: "application/zip",
+		Filename:    "notes.zip",
+	}, nil
+}
+
+func runRestore(ctx context.Context, job jobs.Job) (jobs.Outcome, error) {
+	var req restoreJob
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		return jobs.Outcome{}, jobs.Permanent(err)
+	}
+	if Backups == nil {
+		return jobs.Outcome{}, jobs.Permanent(errors.New("backups are not configured"))
+	}
+	result, err := restoreBackup(req.Force)
+	if errors.Is(err, backup.ErrNoBackup) || errors.Is(err, errHasNotes) {
+		return jobs.Outcome{}, jobs.Permanent(err)
+	}
+	return jobs.Outcome{Result: result}, err
+}
+
+func runNotify(ctx context.Context, job jobs.Job) (jobs.Outcome, error) {
+	var event notify.Event
+	if err := json.Unmarshal(job.Payload, &event); err != nil {
+		return jobs.Outcome{}, jobs.Permanent(err)
+	}
+	Notifications.Dispatch(event)
+	return jobs.Outcome{}, nil
+}
+
+// QueuedNotifications hands events to Notifications through the job
+// queue, so the scheduler that found them due doesn't wait on delivery
+type QueuedNotifications struct{}
+
+func (QueuedNotifications) Dispatch(e notify.Event) {
+	if _, err := Jobs.Enqueue(jobNotify, "", e); err != nil {
+		Notifications.Dispatch(e)
+	}
+}
+
+// enqueueJob queues a job for the caller and answers with where to poll it
+func enqueueJob(c echo.Context, kind string, payload any) error {
+	job, err := Jobs.Enqueue(kind, ownerOf(c), payload)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/jobs/"+job.ID)
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// callerJob returns a job if it was enqueued by the caller
+func callerJob(c echo.Context) (jobs.Job, bool) {
+	job, err := Jobs.Get(c.Param("id"))
+	if err != nil || job.Owner != ownerOf(c) {
+		return jobs.Job{}, false
+	}
+	return job, true
+}
+
+// Get the status of a background job
+func GetJob(c echo.Context) error {
+	job, ok := callerJob(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job not found"})
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// Download the file a finished job produced, like an export
+func GetJobOutput(c echo.Context) error {
+	job, ok := callerJob(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job not found"})
+	}
+	if job.Output == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job has no output"})
+	}
+	data, err := Jobs.Output(job.ID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job output expired"})
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", job.Output.Filename))
+	return c.Blob(http.StatusOK, job.Output.ContentType, data)
+}
+
+// deadJob shows admins what a dead job was run with and for whom
+type deadJob struct {
+	jobs.Job
+	Owner   string          `json:"owner,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// List the jobs in the dead-letter queue, oldest first, with how many
+// there are of each kind. ?kind= lists only those of one kind.
+func GetDeadJobs(c echo.Context) error {
+	dead, err := Jobs.Dead()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	kinds := map[string]int{}
+	list := []deadJob{}
+	for _, job := range dead {
+		kinds[job.Kind]++
+		if kind := c.QueryParam("kind"); kind == "" || job.Kind == kind {
+			list = append(list, deadJob{job, job.Owner, job.Payload})
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{"kinds": kinds, "jobs": list})
+}
+
+// deadJobsRequest picks dead jobs by ID, or with All every one of Kind,
+// or of every kind while Kind is empty
+type deadJobsRequest struct {
+	IDs  []string `json:"ids"`
+	All  bool     `json:"all"`
+	Kind string   `json:"kind"`
+}
+
+// Queue dead jobs again with all their attempts
+func RetryDeadJobs(c echo.Context) error {
+	return bulkDeadJobs(c, "retried", func(id string) error {
+		_, err := Jobs.Retry(id)
+		return err
+	})
+}
+
+// Drop dead jobs from the dead-letter queue
+func DiscardDeadJobs(c echo.Context) error {
+	return bulkDeadJobs(c, "discarded", Jobs.Discard)
+}
+
+// bulkDeadJobs runs action on the dead jobs a request picks and answers
+// with those it was done to under done, and the IDs that weren't dead
+func bulkDeadJobs(c echo.Context, done string, action func(id string) error) error {
+	var req deadJobsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	switch {
+	case req.All && len(req.IDs) > 0:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Pick jobs by ids or all, not both"})
+	case req.All:
+		dead, err := Jobs.Dead()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		for _, job := range dead {
+			if req.Kind == "" || job.Kind == req.Kind {
+				req.IDs = append(req.IDs, job.ID)
+			}
+		}
+	case len(req.IDs) == 0:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Pick jobs by ids, or all"})
+	}
+
+	res := map[string][]string{done: {}, "not_found": {}}
+	for _, id := range req.IDs {
+		err := action(id)
+		switch {
+		case errors.Is(err, jobs.ErrNotFound):
+			res["not_found"] = append(res["not_found"], id)
+		case err != nil:
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		default:
+			res[done] = append(res[done], id)
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
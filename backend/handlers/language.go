@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"note/backend/langdetect"
+	"note/backend/models"
+	"strings"
+)
+
+// detectLanguage sets the language of a note from its text unless the
+// client set one
+func detectLanguage(note *models.Note) {
+	if note.Language != "" && !note.LanguageDetected {
+		return
+	}
+	text := []string{note.Title}
+	if !note.ContentEncrypted {
+		text = append(text, note.Content)
+	}
+	for _, item := range note.Items {
+		text = append(text, item.Text)
+	}
+	note.Language = langdetect.Detect(strings.Join(text, "\n"))
+	note.LanguageDetected = note.Language != ""
+}
+
+// inLanguage reports whether a note is in lang or a regional variant of
+// it, so "en" takes notes in "en-GB" too
+func inLanguage(note models.Note, lang string) bool {
+	return note.Language == lang || strings.HasPrefix(note.Language, lang+"-")
+}
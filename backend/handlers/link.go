@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/links"
+	"note/backend/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// noteLinks holds the links found in the content of each note, by note
+// ID. It is kept up to date by recordChange and guarded by mu. Wiki links
+// are kept by title and resolved when read, so they start pointing at a
+// note once one with that title exists.
+var noteLinks = map[string][]links.Link{}
+
+// indexLinks updates the links of a note after a write; note is nil for
+// deletes. Callers must hold mu.
+func indexLinks(id string, note *models.Note) {
+	if note == nil || note.ContentEncrypted {
+		delete(noteLinks, id)
+		return
+	}
+	if found := links.Parse(note.Content); len(found) > 0 {
+		noteLinks[id] = found
+	} else {
+		delete(noteLinks, id)
+	}
+}
+
+// linkResolver resolves links to the IDs of the notes it was made of,
+// those of one workspace. A title names the note that first took it.
+// Callers must hold mu while using it.
+type linkResolver struct {
+	ids    map[string]bool
+	titles map[string]string
+}
+
+func newLinkResolver(list []models.Note) linkResolver {
+	r := linkResolver{ids: make(map[string]bool, len(list)), titles: make(map[string]string, len(list))}
+	for _, note := range list {
+		r.ids[note.ID] = true
+		title := links.NormalizeTitle(note.Title)
+		if _, taken := r.titles[title]; !taken {
+			r.titles[title] = note.ID
+		}
+	}
+	return r
+}
+
+func (r linkResolver) resolve(l links.Link) (string, bool) {
+	if l.Title != "" {
+		id, ok := r.titles[links.NormalizeTitle(l.Title)]
+		return id, ok
+	}
+	id, ok := models.ResolveNoteID(l.ID, AcceptLegacyIDs)
+	return id, ok && r.ids[id]
+}
+
+// linksFrom returns the IDs of the existing notes a note links to, each
+// once. Callers must hold mu.
+func (r linkResolver) linksFrom(id string) []string {
+	var targets []string
+	seen := map[string]bool{}
+	for _, l := range noteLinks[id] {
+		if target, ok := r.resolve(l); ok && target != id && !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// List the notes of the workspace that link to a note, with [[its
+// title]], [[its ID]] or notty://note/<its ID>
+func GetBacklinks(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !noteExists(id) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	scoped := inWorkspace(c, notes)
+	r := newLinkResolver(scoped)
+	backlinks := []models.Note{}
+	for _, note := range scoped {
+		for _, target := range r.linksFrom(note.ID) {
+			if target == id {
+				backlinks = append(backlinks, note)
+				break
+			}
+		}
+	}
+	return c.JSON(http.StatusOK, backlinks)
+}
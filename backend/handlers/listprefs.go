@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"note/backend/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers of note lists that are paged or grouped
+const (
+	HeaderTotalCount = "X-Total-Count"
+	HeaderGroup      = "X-Notty-Group"
+)
+
+// listPreferences are keyed by API key ("" without one) and guarded by mu
+var listPreferences = map[string]models.ListPreferences{}
+
+// listOptions are how GetNotes sorts, pages and groups a list: the
+// caller's preferences, overridden by ?sort=, ?order=, ?limit=, ?offset=
+// and ?group=. ?lang= only lists the notes in a language.
+type listOptions struct {
+	models.ListPreferences
+	Offset   int
+	Language string
+}
+
+func listOptionsOf(c echo.Context) (listOptions, error) {
+	mu.Lock()
+	opts := listOptions{ListPreferences: listPreferences[ownerOf(c)]}
+	mu.Unlock()
+	if v := c.QueryParam("sort"); v != "" {
+		// A sort of its own doesn't take the order of another
+		opts.Sort, opts.Order = v, ""
+	}
+	if v := c.QueryParam("order"); v != "" {
+		opts.Order = v
+	}
+	if v := c.QueryParam("group"); v != "" {
+		opts.Group = v
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > models.MaxPageSize {
+			return opts, fmt.Errorf("limit must be 0 to %d", models.MaxPageSize)
+		}
+		opts.PageSize = n
+	}
+	if v := c.QueryParam("lang"); v != "" {
+		if !models.ValidLanguage(v) {
+			return opts, fmt.Errorf("lang must be a language tag like en or pt-BR")
+		}
+		opts.Language = v
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("offset can't be negative")
+		}
+		opts.Offset = n
+	}
+	return opts, opts.Validate()
+}
+
+// plain reports whether the list comes as stored, in one piece. Only
+// those lists are cached.
+func (o listOptions) plain() bool {
+	return o.Sort == "" && o.PageSize == 0 && o.Offset == 0 && o.Language == "" && (o.Group == "" || o.Group == models.GroupNone)
+}
+
+// etag is the ETag of the list of a workspace as of seq in these options.
+// It starts like listETag, so Sync takes it as well.
+func (o listOptions) etag(workspace string, seq int64) string {
+	etag := listETag(workspace, seq)
+	if o.plain() {
+		return etag
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%t|%d|%d|%s|%s", o.Sort, o.Descending(), o.PageSize, o.Offset, o.Group, o.Language)
+	return fmt.Sprintf(`%s-%08x"`, strings.TrimSuffix(etag, `"`), h.Sum32())
+}
+
+// apply filters, sorts, groups and pages list in place and returns the
+// page. Paged lists say how many notes there are in all in a header,
+// grouped ones what they are grouped by.
+func (o listOptions) apply(c echo.Context, list []models.Note) []models.Note {
+	if o.Language != "" {
+		kept := list[:0]
+		for _, note := range list {
+			if inLanguage(note, o.Language) {
+				kept = append(kept, note)
+			}
+		}
+		list = kept
+	}
+	if o.Sort != "" {
+		less := func(a, b models.Note) bool { return a.CreatedAt.Before(b.CreatedAt) }
+		switch o.Sort {
+		case models.SortUpdated:
+			less = func(a, b models.Note) bool { return a.UpdatedAt.Before(b.UpdatedAt) }
+		case models.SortTitle:
+			less = func(a, b models.Note) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+		}
+		desc := o.Descending()
+		sort.SliceStable(list, func(i, j int) bool {
+			if desc {
+				return less(list[j], list[i])
+			}
+			return less(list[i], list[j])
+		})
+	}
+	if o.Group == models.GroupNotebook {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Notebook < list[j].Notebook })
+		c.Response().Header().Set(HeaderGroup, models.GroupNotebook)
+	}
+	if o.PageSize == 0 && o.Offset == 0 {
+		return list
+	}
+	c.Response().Header().Set(HeaderTotalCount, strconv.Itoa(len(list)))
+	start := min(o.Offset, len(list))
+	end := len(list)
+	if o.PageSize > 0 {
+		end = min(start+o.PageSize, len(list))
+	}
+	return list[start:end]
+}
+
+// Get how the caller's note lists are sorted, paged and grouped when a
+// request doesn't say
+func GetListPreferences(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return c.JSON(http.StatusOK, listPreferences[ownerOf(c)])
+}
+
+// Replace the caller's list preferences. Every web, CLI and TUI client
+// listing notes without parameters gets them.
+func UpdateListPreferences(c echo.Context) error {
+	var prefs models.ListPreferences
+	if err := c.Bind(&prefs); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if err := prefs.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if prefs == (models.ListPreferences{}) {
+		delete(listPreferences, ownerOf(c))
+	} else {
+		listPreferences[ownerOf(c)] = prefs
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
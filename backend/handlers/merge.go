@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/audit"
+	"note/backend/dedupe"
+	"note/backend/links"
+	"note/backend/models"
+	"note/backend/notify"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// List groups of notes that duplicate each other. ?threshold= sets how
+// similar (0-1) notes must be to count as near duplicates.
+func GetDuplicates(c echo.Context) error {
+	threshold := dedupe.DefaultThreshold
+	if v := c.QueryParam("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 || t > 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Threshold must be between 0 and 1"})
+		}
+		threshold = t
+	}
+	mu.Lock()
+	all := inWorkspace(c, notes)
+	mu.Unlock()
+	return c.JSON(http.StatusOK, map[string]any{"groups": dedupe.Find(all, threshold)})
+}
+
+type mergeRequest struct {
+	IDs  []string `json:"ids"`  // notes to merge, in the order their content is joined
+	Into string   `json:"into"` // note that is kept; the first of IDs if empty
+}
+
+// Merge notes into one. The kept note gets the content and checklist items
+// of the others appended and lists them in merged_from; the others go to
+// the trash, and their shares, attachments, relations and the links to
+// them move to the kept note.
+func MergeNotes(c echo.Context) error {
+	var req mergeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, raw := range req.IDs {
+		id, ok := models.ResolveNoteID(raw, AcceptLegacyIDs)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least two notes are needed"})
+	}
+	into := ids[0]
+	if req.Into != "" {
+		var ok bool
+		if into, ok = models.ResolveNoteID(req.Into, AcceptLegacyIDs); !ok || !seen[into] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "into must be one of ids"})
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	index := make(map[string]int, len(notes))
+	for i, note := range notes {
+		if note.Workspace == workspaceOf(c) {
+			index[note.ID] = i
+		}
+	}
+	for _, id := range ids {
+		i, ok := index[id]
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found: " + id})
+		}
+		if notes[i].ContentEncrypted {
+			// Encrypted content can only be combined by the client
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Encrypted notes can't be merged on the server"})
+		}
+	}
+
+	// Links are resolved before the absorbed notes are gone, so those
+	// naming them by title still find them
+	resolver := newLinkResolver(inWorkspace(c, notes))
+	repoint := func(l links.Link) (string, bool) {
+		id, ok := resolver.resolve(l)
+		return into, ok && id != into && seen[id]
+	}
+
+	merged := notes[index[into]]
+	contents := []string{merged.Content}
+	included := map[string]bool{dedupe.Normalize(merged.Content): true}
+	var absorbed []string
+	for _, id := range ids {
+		if id == into {
+			continue
+		}
+		absorbed = append(absorbed, id)
+		other := notes[index[id]]
+		if text := dedupe.Normalize(other.Content); text != "" && !included[text] {
+			included[text] = true
+			contents = append(contents, other.Content)
+		}
+		for _, item := range other.Items {
+			item.Position = len(merged.Items)
+			merged.Items = append(merged.Items, item)
+		}
+		if merged.RemindAt == nil && other.RemindAt != nil {
+			merged.RemindAt, merged.ReminderFiredAt = other.RemindAt, other.ReminderFiredAt
+			merged.RemindZone, merged.RemindLocal, merged.RemindRepeat = other.RemindZone, other.RemindLocal, other.RemindRepeat
+		}
+		merged.PrivateSections = append(merged.PrivateSections, other.PrivateSections...)
+		merged.MergedFrom = append(merged.MergedFrom, id)
+		merged.MergedFrom = append(merged.MergedFrom, other.MergedFrom...)
+	}
+	merged.Content = links.Replace(strings.Join(contents, "\n\n---\n\n"), repoint)
+	merged.Items = models.NormalizeItems(append([]models.TodoItem(nil), merged.Items...))
+	merged.UpdatedAt = time.Now()
+	if err := checkLimits(merged, into); err != nil {
+		return limitResponse(c, err)
+	}
+	notes[index[into]] = merged
+	recordChange(models.ChangeUpdate, merged.ID, &merged)
+	touchNotebooks(merged.Notebook)
+	notifyNote(notify.NoteUpdated, merged)
+	actor := actorOf(c)
+	recordAudit(actor, audit.Merge, into, "merged "+strings.Join(absorbed, ", "))
+
+	for _, id := range ids {
+		if id == into {
+			continue
+		}
+		for token, share := range shares {
+			if share.NoteID == id {
+				share.NoteID = into
+				shares[token] = share
+			}
+		}
+		for _, a := range attachmentsOf(id) {
+			a.NoteID = into
+		}
+		moveRelations(id, into)
+		for i, note := range notes {
+			if note.ID == id {
+				trashNote(i, into)
+				recordAudit(actor, audit.Trash, id, "merged into "+into)
+				break
+			}
+		}
+	}
+
+	for i, note := range notes {
+		if note.Workspace != workspaceOf(c) || note.ID == into || len(noteLinks[note.ID]) == 0 {
+			continue
+		}
+		content := links.Replace(note.Content, repoint)
+		if content == note.Content {
+			continue
+		}
+		note.Content, note.UpdatedAt = content, time.Now()
+		notes[i] = note
+		recordChange(models.ChangeUpdate, note.ID, &note)
+		touchNotebooks(note.Notebook)
+		notifyNote(notify.NoteUpdated, note)
+	}
+	return c.JSON(http.StatusOK, merged)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"note/backend/metering"
+	"note/backend/notify"
+	"note/backend/workspace"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Meter counts usage for the monthly reports and workspace quotas. The
+// default workspace is metered as metering.DefaultWorkspace.
+var Meter = new(metering.Meter)
+
+var monthPattern = regexp.MustCompile(`^\d{4}-(0[1-9]|1[0-2])$`)
+
+// MeterIdentity is the metering.Identify of the API
+func MeterIdentity(c echo.Context) (string, string) {
+	return meterWorkspace(workspaceOf(c)), ownerOf(c)
+}
+
+// RecordStorage records the bytes every workspace stores now
+func RecordStorage() {
+	mu.Lock()
+	storage := map[string]int{metering.DefaultWorkspace: 0}
+	workspaceOfNote := map[string]string{}
+	for _, note := range notes {
+		ws := meterWorkspace(note.Workspace)
+		storage[ws] += noteSize(note)
+		workspaceOfNote[note.ID] = ws
+	}
+	for _, a := range attachments {
+		storage[meterWorkspace(workspaceOfNote[a.NoteID])] += a.Size
+	}
+	mu.Unlock()
+	for ws, bytes := range storage {
+		Meter.Storage(ws, bytes)
+	}
+}
+
+// MeterStorage records storage every interval, so reports show the peak
+// of each month, until ctx is done
+func MeterStorage(ctx context.Context, interval time.Duration) {
+	for {
+		RecordStorage()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Get monthly usage reports per workspace for ?month= (like 2026-10; the
+// current month by default, "all" for every month kept), as JSON or with
+// ?format=csv as CSV
+func GetUsageReports(c echo.Context) error {
+	month := c.QueryParam("month")
+	switch {
+	case month == "":
+		month = metering.Month(time.Now())
+	case month == "all":
+		month = ""
+	case !monthPattern.MatchString(month):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "month must look like 2026-10"})
+	}
+	RecordStorage()
+	reports := Meter.Reports(month)
+
+	switch c.QueryParam("format") {
+	case "", "json":
+		return c.JSON(http.StatusOK, reports)
+	case "csv":
+		name := "usage-" + month + ".csv"
+		if month == "" {
+			name = "usage.csv"
+		}
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+		res.WriteHeader(http.StatusOK)
+		return metering.WriteCSV(res, reports)
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json or csv"})
+}
+
+// HeaderQuotaWarning names the feature a workspace is over a soft quota
+// of
+const HeaderQuotaWarning = "X-Notty-Quota-Warning"
+
+// workspaceQuotas are quotas admins set for single workspaces, by metering
+// workspace name, in place of Limits.PerWorkspace. Guarded by mu.
+var workspaceQuotas = map[string]metering.Quotas{}
+
+// meterWorkspace returns the name workspace id is metered under
+func meterWorkspace(id string) string {
+	if id == workspace.Default {
+		return metering.DefaultWorkspace
+	}
+	return id
+}
+
+// quotaOf returns the quota of a workspace on f. Callers must hold mu.
+func quotaOf(ws string, f metering.Feature) metering.Quota {
+	if quotas, ok := workspaceQuotas[ws]; ok {
+		return quotas[f]
+	}
+	return Limits.PerWorkspace[f]
+}
+
+// checkQuota decides whether ws may use f once more
+func checkQuota(ws string, f metering.Feature) metering.Decision {
+	mu.Lock()
+	q := quotaOf(ws, f)
+	mu.Unlock()
+	return Meter.Check(ws, f, q)
+}
+
+// WorkspaceQuotas refuses API requests of workspaces out of their hard
+// daily quota and warns those over a soft one. It runs after
+// WorkspaceScope; requests are counted by the metering middleware.
+func WorkspaceQuotas(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch checkQuota(meterWorkspace(workspaceOf(c)), metering.APIRequests) {
+		case metering.Deny:
+			wait := time.Until(metering.APIRequests.Resets(time.Now()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "API request quota exceeded", "code": codeQuotaExceeded})
+		case metering.Warn:
+			c.Response().Header().Set(HeaderQuotaWarning, string(metering.APIRequests))
+		}
+		return next(c)
+	}
+}
+
+// AdmitWebhookDelivery is the webhook.Manager Admit of the API: it counts
+// deliveries against the quota of the workspace of the note
+func AdmitWebhookDelivery(e notify.Event) bool {
+	ws := meterWorkspace(e.Workspace)
+	if checkQuota(ws, metering.WebhookDeliveries) == metering.Deny {
+		return false
+	}
+	Meter.Use(ws, metering.WebhookDeliveries)
+	return true
+}
+
+// featureUsage is the use of one feature by a workspace this period
+type featureUsage struct {
+	Feature  metering.Feature `json:"feature"`
+	Period   string           `json:"period"`
+	Used     int              `json:"used"`
+	Limit    int              `json:"limit"`
+	Hard     bool             `json:"hard"`
+	ResetsAt time.Time        `json:"resets_at"`
+}
+
+// workspaceUsage returns what ws used of each feature this period
+func workspaceUsage(ws string) []featureUsage {
+	mu.Lock()
+	quotas := map[metering.Feature]metering.Quota{}
+	for _, f := range metering.Features {
+		quotas[f] = quotaOf(ws, f)
+	}
+	mu.Unlock()
+	now := time.Now()
+	usage := make([]featureUsage, 0, len(metering.Features))
+	for _, f := range metering.Features {
+		usage = append(usage, featureUsage{
+			Feature:  f,
+			Period:   f.Period(),
+			Used:     Meter.Used(ws, f),
+			Limit:    quotas[f].Limit,
+			Hard:     quotas[f].Hard,
+			ResetsAt: f.Resets(now),
+		})
+	}
+	return usage
+}
+
+// Get what a workspace used of its quotas, for its members
+func GetWorkspaceUsage(c echo.Context) error {
+	if _, ok, err := requireWorkspaceRole(c, workspace.Viewer); !ok {
+		return err
+	}
+	return c.JSON(http.StatusOK, workspaceUsage(c.Param("workspace")))
+}
+
+// quotaWorkspace reads the :workspace parameter of the admin quota routes,
+// where "default" is the default workspace
+func quotaWorkspace(c echo.Context) (string, bool) {
+	ws := c.Param("workspace")
+	if ws == metering.DefaultWorkspace {
+		return ws, true
+	}
+	_, err := Workspaces.Get(ws)
+	return ws, err == nil
+}
+
+// Get the quotas of a workspace and what it used of them
+func GetWorkspaceQuotas(c echo.Context) error {
+	ws, ok := quotaWorkspace(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+	}
+	mu.Lock()
+	quotas, own := workspaceQuotas[ws]
+	if !own {
+		quotas = Limits.PerWorkspace
+	}
+	mu.Unlock()
+	return c.JSON(http.StatusOK, map[string]any{
+		"workspace": ws,
+		"own":       own, // false when on the instance-wide quotas
+		"quotas":    quotas,
+		"usage":     workspaceUsage(ws),
+	})
+}
+
+// Replace the quotas of a workspace. A null body puts it back on the
+// instance-wide quotas.
+func UpdateWorkspaceQuotas(c echo.Context) error {
+	ws, ok := quotaWorkspace(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+	}
+	var quotas metering.Quotas
+	if err := c.Bind(&quotas); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if err := quotas.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	mu.Lock()
+	if quotas == nil {
+		delete(workspaceQuotas, ws)
+	} else {
+		workspaceQuotas[ws] = quotas
+	}
+	mu.Unlock()
+	return GetWorkspaceQuotas(c)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const maxReportDetails = 2000
+
+// Moderator actions on a report
+const (
+	actionDismiss   = "dismiss"
+	actionUnpublish = "unpublish"
+	actionDelete    = "delete"
+)
+
+// reports is the moderation queue, guarded by mu
+var reports []models.Report
+
+type reportRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// Report a shared note to the moderators
+func ReportShare(c echo.Context) error {
+	req := new(reportRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	switch req.Reason {
+	case models.ReportSpam, models.ReportAbuse, models.ReportIllegal, models.ReportOther:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Reason must be spam, abuse, illegal or other"})
+	}
+	if len(req.Details) > maxReportDetails {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Details are too long"})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	note, ok := sharedNote(c.Param("token"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	report := models.Report{
+		ID:         uuid.NewString(),
+		NoteID:     note.ID,
+		ShareToken: c.Param("token"),
+		Reason:     req.Reason,
+		Details:    req.Details,
+		Status:     models.ReportOpen,
+		CreatedAt:  time.Now(),
+	}
+	reports = append(reports, report)
+	return c.JSON(http.StatusCreated, map[string]string{"message": "Thanks, a moderator will look at this note"})
+}
+
+// reportView is a report together with the note as it is now
+type reportView struct {
+	models.Report
+	Note *models.Note `json:"note,omitempty"`
+}
+
+// List reports for moderators, open ones unless ?status= says otherwise
+func GetReports(c echo.Context) error {
+	status := c.QueryParam("status")
+	if status == "" {
+		status = models.ReportOpen
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	list := []reportView{}
+	for _, report := range reports {
+		if status != "all" && report.Status != status {
+			continue
+		}
+		view := reportView{Report: report}
+		for _, note := range notes {
+			if note.ID == report.NoteID {
+				copied := note
+				view.Note = &copied
+			}
+		}
+		list = append(list, view)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+type resolveRequest struct {
+	Action string `json:"action"`
+}
+
+// Resolve a report by dismissing it, unpublishing the note or deleting it.
+// Unpublishing or deleting closes every open report on the same note.
+func ResolveReport(c echo.Context) error {
+	req := new(resolveRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Action != actionDismiss && req.Action != actionUnpublish && req.Action != actionDelete {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Action must be dismiss, unpublish or delete"})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	index := -1
+	for i, report := range reports {
+		if report.ID == c.Param("id") {
+			index = i
+		}
+	}
+	if index < 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Report not found"})
+	}
+	if reports[index].Status != models.ReportOpen {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Report is already closed"})
+	}
+
+	now := time.Now()
+	noteID := reports[index].NoteID
+	if req.Action == actionDismiss {
+		reports[index].Status = models.ReportDismissed
+		reports[index].Action = req.Action
+		reports[index].ResolvedAt = &now
+		return c.JSON(http.StatusOK, reports[index])
+	}
+
+	for i, note := range notes {
+		if note.ID != noteID {
+			continue
+		}
+		detail := "unpublished by a moderator after a report for " + reports[index].Reason
+		if req.Action == actionDelete {
+			detail = "deleted by a moderator after a report for " + reports[index].Reason
+			removeNote(i)
+		} else {
+			note.Published = false
+			note.PublishAt = nil // or the scheduler publishes it again
+			note.PublishedAt = nil
+			note.UpdatedAt = now
+			notes[i] = note
+			deleteShares(note.ID)
+			recordChange(models.ChangeUpdate, note.ID, &note)
+			touchNotebooks(note.Notebook)
+		}
+		notifyNoteDetail(notify.NoteModerated, note, detail)
+		recordAudit(actorOf(c), audit.Moderate, note.ID, detail)
+		break
+	}
+	for i := range reports {
+		if reports[i].NoteID == noteID && reports[i].Status == models.ReportOpen {
+			reports[i].Status = models.ReportResolved
+			reports[i].Action = req.Action
+			reports[i].ResolvedAt = &now
+		}
+	}
+	return c.JSON(http.StatusOK, reports[index])
+}
@@ -1,20 +1,90 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"      // Standard library for formatted I/O
 	"net/http" // Standard library for HTTP client and server functionality
 	"note/backend/models"
-	"strconv" // Standard library for string conversions (string to int, float, etc.)
-	"time"    // Standard library for time-related operations and formatting
+	"note/backend/notify"
+	"time" // Standard library for time-related operations and formatting
 
 	"github.com/labstack/echo/v4" // Echo web framework for building REST APIs
 )
 
 var notes []models.Note
-var nextID int = 1
 
-// c.Json send the notes to the client
+// c.Json send the notes to the client, sorted, paged and grouped as the
+// caller prefers or the request says
 func GetNotes(c echo.Context) error {
-	return c.JSON(http.StatusOK, notes)
+	stream, ok := streamMode(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid stream mode"})
+	}
+	opts, err := listOptionsOf(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	// ?open_tasks=true only lists notes with unfinished checklist items
+	openTasks := c.QueryParam("open_tasks") == "true"
+	// ?as_of= lists the notes as they were at that time
+	t, past, err := asOf(c)
+	if past {
+		if err != nil {
+			return asOfError(c)
+		}
+		return getNotesAsOf(c, t, openTasks, stream, opts)
+	}
+	list, seq := storeOf(c).List(openTasks)
+	// ?include=relations adds the relations of each note. Relations aren't
+	// part of the change sequence, so these lists skip the ETag and cache.
+	if includeRelations(c) {
+		if stream != streamOff {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "include=relations can't be streamed"})
+		}
+		list = opts.apply(c, list)
+		mu.Lock()
+		defer mu.Unlock()
+		return c.JSON(http.StatusOK, withRelations(list))
+	}
+	// The change sequence moves on every create, update and delete, so it
+	// identifies this exact version of the list
+	ws := workspaceOf(c)
+	if notModified(c, opts.etag(ws, seq), lastWrite()) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	cacheKey := fmt.Sprintf("workspace=%s&open_tasks=%t", ws, openTasks)
+	if stream == streamOff && opts.plain() {
+		if cached, ok := listCache.Get(cacheKey); ok && cached.seq == seq {
+			return c.JSONBlob(http.StatusOK, cached.body)
+		}
+	}
+	list = opts.apply(c, list)
+
+	// ?stream=true or ?stream=jsonl writes the list note by note
+	if stream != streamOff {
+		return streamNotes(c, list, stream)
+	}
+	body, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	// The list may be stale by now; the sequence keeps it from being served
+	// once it is
+	if opts.plain() {
+		listCache.Add(cacheKey, cachedList{body, seq})
+	}
+	return c.JSONBlob(http.StatusOK, body)
+}
+
+// AcceptLegacyIDs keeps integer IDs from before the move to UUIDs working
+// in URLs. Turn it off once clients have migrated.
+var AcceptLegacyIDs = true
+
+// noteID reads the :id route parameter as a note UUID. Legacy integer IDs
+// resolve to the UUID their note was migrated to.
+func noteID(c echo.Context) (string, bool) {
+	return models.ResolveNoteID(c.Param("id"), AcceptLegacyIDs)
 }
 
 // Create the notes
@@ -23,78 +93,175 @@ func CreateNote(c echo.Context) error {
 	if err := c.Bind(note); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
 	}
-	
-	// Validate required fields
-	if note.Title == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Title is required"})
+
+	note.Owner = ownerOf(c)
+	created, err := storeOf(c).Create(*note)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusCreated, created)
+}
+
+// createNote sets the server-generated fields of note and stores it.
+// note.Owner is kept, callers set it. Callers must hold mu.
+func createNote(note *models.Note) {
+	note.ID = models.NewNoteID()
+	insertNote(note)
+}
+
+// insertNote is createNote for a note the caller gave a new ID. Callers
+// must hold mu.
+func insertNote(note *models.Note) {
+	note.LegacyID = 0
+	note.MergedFrom = nil
+	note.ReminderFiredAt = nil
+	note.Items = models.NormalizeItems(note.Items)
+	detectLanguage(note)
+	if note.Notebook == "" {
+		note.Notebook = InboxNotebook
 	}
-	
-	// Set server-generated fields
-	note.ID = nextID
-	nextID++
 	note.CreatedAt = time.Now()
-	
+	note.UpdatedAt = note.CreatedAt
+	note.SetPublished(nil, note.CreatedAt)
+
 	notes = append(notes, *note)
-	return c.JSON(http.StatusCreated, note)
+	Meter.NoteCreated(meterWorkspace(note.Workspace))
+	recordChange(models.ChangeCreate, note.ID, note)
+	touchNotebooks(note.Notebook)
+	notifyNote(notify.NoteCreated, *note)
 }
 
-// Get a specific note by ID
+// Get a specific note by ID, with where the caller left off reading it if
+// they saved that
 func GetNote(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
+	id, ok := noteID(c)
+	if !ok {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
 	}
-	for _, note := range notes {
-		if note.ID == id {
-			return c.JSON(http.StatusOK, note)
+	// ?as_of= returns the note as it was at that time
+	if t, past, err := asOf(c); past {
+		if err != nil {
+			return asOfError(c)
+		}
+		return getNoteAsOf(c, id, t)
+	}
+	note, err := storeOf(c).Get(id)
+	if err != nil {
+		return storeError(c, err)
+	}
+	// ?include=relations adds the relations of the note, uncached
+	if includeRelations(c) {
+		mu.Lock()
+		defer mu.Unlock()
+		return c.JSON(http.StatusOK, withRelations([]models.Note{note})[0])
+	}
+	mu.Lock()
+	pos, ok := positions[id][ownerOf(c)]
+	mu.Unlock()
+	if ok {
+		return getNoteWithPosition(c, note, pos)
+	}
+	// A body cached from an older version of the note is made again
+	cached, ok := noteCache.Get(id)
+	if !ok || cached.etag != noteETag(note) {
+		body, err := json.Marshal(note)
+		if err != nil {
+			return err
 		}
+		cached = cachedNote{body, noteETag(note), note.UpdatedAt}
+		noteCache.Add(id, cached)
+	}
+	if notModified(c, cached.etag, cached.modified) {
+		return c.NoContent(http.StatusNotModified)
 	}
-	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	return c.JSONBlob(http.StatusOK, cached.body)
 }
 
-// Update a specific note by ID
+// Update a specific note by ID. With an If-Match of the ETag the client
+// read, a note written since isn't overwritten: the answer is 409 with
+// the note as it is now.
 func UpdateNote(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
+	id, ok := noteID(c)
+	if !ok {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
 	}
-	
+
 	// Parse JSON from request
 	updatedNote := new(models.Note)
 	if err := c.Bind(updatedNote); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
 	}
-	
-	// Validate required fields
-	if updatedNote.Title == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Title is required"})
+
+	updated, err := storeOf(c).UpdateIfMatch(id, *updatedNote, c.Request().Header.Get("If-Match"))
+	if errors.Is(err, ErrConflict) {
+		// The client gets the note as it is now to merge its edit with
+		c.Response().Header().Set("ETag", noteETag(updated))
+		return c.JSON(http.StatusConflict, map[string]any{
+			"error": "The note was changed since; merge with POST /api/notes/:id/merge-preview",
+			"note":  updated,
+		})
+	}
+	if err != nil {
+		return storeError(c, err)
 	}
-	
-	// Find and update the note
+	c.Response().Header().Set("ETag", noteETag(updated))
+	return c.JSON(http.StatusOK, updated)
+}
+
+// updateNote replaces the note with the given ID, keeping the fields
+// clients can't change. It reports false if there is no such note.
+// Callers must hold mu.
+func updateNote(id string, updatedNote *models.Note) bool {
 	for i, note := range notes {
 		if note.ID == id {
-			updatedNote.ID = id // Preserve the ID
+			updatedNote.ID = id                    // Preserve the ID
 			updatedNote.CreatedAt = note.CreatedAt // Preserve creation time
+			updatedNote.LegacyID = note.LegacyID
+			updatedNote.MergedFrom = note.MergedFrom
+			updatedNote.CopiedFrom = note.CopiedFrom
+			updatedNote.Owner = note.Owner
+			updatedNote.Workspace = note.Workspace
+			updatedNote.UpdatedAt = time.Now()
+			updatedNote.SetPublished(&note, updatedNote.UpdatedAt)
+			updatedNote.Items = models.NormalizeItems(updatedNote.Items)
+			detectLanguage(updatedNote)
+			updatedNote.ReminderFiredAt = nil
+			if updatedNote.SameReminder(note) {
+				updatedNote.ReminderFiredAt = note.ReminderFiredAt // don't fire it again
+			}
 			notes[i] = *updatedNote
-			return c.JSON(http.StatusOK, updatedNote)
+			recordChange(models.ChangeUpdate, id, updatedNote)
+			touchNotebooks(note.Notebook, updatedNote.Notebook)
+			notifyNote(notify.NoteUpdated, *updatedNote)
+			return true
 		}
 	}
-	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	return false
 }
 
 // Delete a specific note by ID
 func DeleteNote(c echo.Context) error {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
+	id, ok := noteID(c)
+	if !ok {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
 	}
-	for i, note := range notes {
-		if note.ID == id {
-			notes = append(notes[:i], notes[i+1:]...)
-			return c.JSON(http.StatusOK, map[string]string{"message": "Note deleted successfully"})
-		}
+	if err := storeOf(c).Delete(id); err != nil {
+		return storeError(c, err)
 	}
-	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	return c.JSON(http.StatusOK, map[string]string{"message": "Note deleted successfully"})
 }
 
-
+// removeNote deletes the note at index i together with everything that
+// hangs off it. Callers must hold mu.
+func removeNote(i int) {
+	note := notes[i]
+	notes = append(notes[:i], notes[i+1:]...)
+	recordChange(models.ChangeDelete, note.ID, nil)
+	touchNotebooks(note.Notebook)
+	deleteShares(note.ID)
+	deleteRelations(note.ID)
+	forgetReview(note.ID)
+	delete(positions, note.ID)
+	deleteAttachments(note.ID)
+	notifyNote(notify.NoteDeleted, note)
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"note/backend/backup"
+	"note/backend/geo"
+	"note/backend/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// These tests hammer the note routes from many goroutines. Run them with
+// -race to check the handlers' locking as well as the results.
+
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	mu.Lock()
+	restore(nil, backup.State{}, 0)
+	mu.Unlock()
+	e := echo.New()
+	e.Use(WorkspaceScope)
+	e.GET("/api/notes", GetNotes)
+	e.POST("/api/notes", CreateNote)
+	e.GET("/api/notes/:id", GetNote)
+	e.PUT("/api/notes/:id", UpdateNote)
+	e.DELETE("/api/notes/:id", DeleteNote)
+	e.PATCH("/api/notes/:id/items/:itemId", UpdateItem)
+	return e
+}
+
+func do(e *echo.Echo, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// parallel runs f(worker, i) for n iterations in each of workers goroutines
+func parallel(workers, n int, f func(worker, i int)) {
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				f(w, i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	e := newTestServer(t)
+	const workers, perWorker = 16, 25
+
+	parallel(workers, perWorker, func(w, i int) {
+		body := fmt.Sprintf(`{"title":"note %d-%d"}`, w, i)
+		if rec := do(e, http.MethodPost, "/api/notes", body); rec.Code != http.StatusCreated {
+			t.Errorf("create: %d %s", rec.Code, rec.Body)
+		}
+		// Reads in between must never see a half-written list
+		if rec := do(e, http.MethodGet, "/api/notes", ""); rec.Code != http.StatusOK {
+			t.Errorf("list: %d %s", rec.Code, rec.Body)
+		}
+	})
+
+	var list []models.Note
+	if err := json.Unmarshal(do(e, http.MethodGet, "/api/notes", "").Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != workers*perWorker {
+		t.Fatalf("got %d notes, want %d", len(list), workers*perWorker)
+	}
+	ids, titles := map[string]bool{}, map[string]bool{}
+	for _, note := range list {
+		if ids[note.ID] {
+			t.Errorf("duplicate ID %s", note.ID)
+		}
+		ids[note.ID] = true
+		titles[note.Title] = true
+	}
+	if len(titles) != workers*perWorker {
+		t.Errorf("got %d distinct titles, want %d", len(titles), workers*perWorker)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if lastSeq != int64(workers*perWorker) || len(changes) != workers*perWorker {
+		t.Errorf("change log has seq %d and %d changes, want %d", lastSeq, len(changes), workers*perWorker)
+	}
+	for i, change := range changes {
+		if change.Seq != int64(i+1) {
+			t.Fatalf("change %d has seq %d", i, change.Seq)
+		}
+	}
+}
+
+func TestConcurrentUpdateAndDelete(t *testing.T) {
+	e := newTestServer(t)
+	const count = 40
+	ids := make([]string, count)
+	for i := range ids {
+		rec := do(e, http.MethodPost, "/api/notes", fmt.Sprintf(`{"title":"note %d"}`, i))
+		var note models.Note
+		if err := json.Unmarshal(rec.Body.Bytes(), &note); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = note.ID
+	}
+
+	// Even workers update every note, odd workers delete the odd notes
+	// and read the even ones
+	const workers = 8
+	parallel(workers, count, func(w, i int) {
+		path := "/api/notes/" + ids[i]
+		switch {
+		case w%2 == 0:
+			rec := do(e, http.MethodPut, path, fmt.Sprintf(`{"title":"note %d by %d"}`, i, w))
+			if rec.Code != http.StatusOK && !(i%2 == 1 && rec.Code == http.StatusNotFound) {
+				t.Errorf("update %d: %d %s", i, rec.Code, rec.Body)
+			}
+		case i%2 == 1:
+			rec := do(e, http.MethodDelete, path, "")
+			if rec.Code != http.StatusOK && rec.Code != http.StatusNotFound {
+				t.Errorf("delete %d: %d %s", i, rec.Code, rec.Body)
+			}
+		default:
+			if rec := do(e, http.MethodGet, path, ""); rec.Code != http.StatusOK {
+				t.Errorf("get %d: %d %s", i, rec.Code, rec.Body)
+			}
+		}
+	})
+
+	var list []models.Note
+	if err := json.Unmarshal(do(e, http.MethodGet, "/api/notes", "").Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != count/2 {
+		t.Fatalf("got %d notes, want %d", len(list), count/2)
+	}
+	for _, note := range list {
+		var i, by int
+		if _, err := fmt.Sscanf(note.Title, "note %d by %d", &i, &by); err != nil || ids[i] != note.ID || i%2 != 0 {
+			t.Errorf("unexpected note %s %q", note.ID, note.Title)
+		}
+		// The single-note cache must agree with the list
+		var got models.Note
+		if err := json.Unmarshal(do(e, http.MethodGet, "/api/notes/"+note.ID, "").Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != note.Title || !got.UpdatedAt.Equal(note.UpdatedAt) {
+			t.Errorf("GET %s = %q, list has %q", note.ID, got.Title, note.Title)
+		}
+	}
+}
+
+func TestConcurrentItemToggles(t *testing.T) {
+	e := newTestServer(t)
+	const items = 20
+	var texts []string
+	for i := 0; i < items; i++ {
+		texts = append(texts, fmt.Sprintf(`{"text":"item %d"}`, i))
+	}
+	rec := do(e, http.MethodPost, "/api/notes", `{"title":"checklist","items":[`+strings.Join(texts, ",")+`]}`)
+	var note models.Note
+	if err := json.Unmarshal(rec.Body.Bytes(), &note); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every worker ticks off its own items; none of the ticks may be lost
+	parallel(items, 1, func(w, _ int) {
+		path := "/api/notes/" + note.ID + "/items/" + note.Items[w].ID
+		if rec := do(e, http.MethodPatch, path, `{"done":true}`); rec.Code != http.StatusOK {
+			t.Errorf("toggle %d: %d %s", w, rec.Code, rec.Body)
+		}
+	})
+
+	var got models.Note
+	if err := json.Unmarshal(do(e, http.MethodGet, "/api/notes/"+note.ID, "").Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range got.Items {
+		if !item.Done {
+			t.Errorf("item %q lost its update", item.Text)
+		}
+	}
+}
+
+func TestChangeLogCap(t *testing.T) {
+	e := newTestServer(t)
+	e.GET("/api/sync", Sync)
+	defer func(n int) { maxChanges = n }(maxChanges)
+	maxChanges = 10
+
+	var first models.Note
+	for i := 0; i < 25; i++ {
+		rec := do(e, http.MethodPost, "/api/notes", fmt.Sprintf(`{"title":"note %d"}`, i))
+		if i == 0 {
+			json.Unmarshal(rec.Body.Bytes(), &first)
+		}
+	}
+	do(e, http.MethodDelete, "/api/notes/"+first.ID, "")
+
+	mu.Lock()
+	if len(changes) > maxChanges || changes[len(changes)-1].Seq != lastSeq {
+		t.Errorf("change log keeps %d changes up to %d, want at most %d up to %d", len(changes), changes[len(changes)-1].Seq, maxChanges, lastSeq)
+	}
+	// What was folded into the base still replays to the notes
+	current, ok := notesAsOf(time.Now())
+	if !ok || len(current) != len(notes) || len(current) != 24 {
+		t.Errorf("notes as of now = %d, %v; there are %d", len(current), ok, len(notes))
+	}
+	mu.Unlock()
+
+	var res syncResponse
+	json.Unmarshal(do(e, http.MethodGet, "/api/sync?since=1", "").Body.Bytes(), &res)
+	if !res.Reset || len(res.Notes) != 24 {
+		t.Errorf("sync from a dropped cursor = reset %v with %d notes, want a reset with 24", res.Reset, len(res.Notes))
+	}
+}
+
+func TestTransferLimits(t *testing.T) {
+	newTestServer(t)
+	defer func(l InstanceLimits) { Limits = l }(Limits)
+	mu.Lock()
+	defer mu.Unlock()
+	notes = []models.Note{{ID: models.NewNoteID(), Title: "too long by now", Owner: "alice"}}
+
+	// Moving to another workspace keeps the owner but not the limits
+	Limits = InstanceLimits{MaxNoteSize: 5}
+	if err := checkTransferLimits("", []int{0}); err != ErrNoteTooLarge {
+		t.Errorf("moving a note over the instance's size limit = %v", err)
+	}
+	Limits = InstanceLimits{PerUser: Quota{MaxNoteSize: 5}}
+	if err := checkTransferLimits("", []int{0}); err != ErrNoteTooLarge {
+		t.Errorf("moving a note over its owner's size limit = %v", err)
+	}
+	Limits = InstanceLimits{PerUser: Quota{MaxNotes: 1}}
+	if err := checkTransferLimits("", []int{0}); err != nil {
+		t.Errorf("moving a note within its owner's quota = %v", err)
+	}
+	notes = append(notes, models.Note{ID: models.NewNoteID(), Owner: "bob"})
+	if err := checkTransferLimits("bob", []int{0}); err != ErrNoteLimit {
+		t.Errorf("giving a note to a user at their limit = %v", err)
+	}
+}
+
+func TestMergeAndRestoreLimits(t *testing.T) {
+	e := newTestServer(t)
+	e.POST("/api/notes/merge", MergeNotes)
+	e.POST("/api/trash/:id/restore", RestoreNote)
+	defer func(l InstanceLimits) { Limits = l }(Limits)
+
+	var ids []string
+	for _, content := range []string{"first half", "second half"} {
+		var note models.Note
+		rec := do(e, http.MethodPost, "/api/notes", `{"title":"half","content":"`+content+`"}`)
+		if err := json.Unmarshal(rec.Body.Bytes(), &note); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, note.ID)
+	}
+	mu.Lock()
+	Limits = InstanceLimits{MaxNoteSize: noteSize(notes[0]) + 5}
+	mu.Unlock()
+	merge := `{"ids":["` + ids[0] + `","` + ids[1] + `"]}`
+	if rec := do(e, http.MethodPost, "/api/notes/merge", merge); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("merging notes into one over the size limit = %d %s", rec.Code, rec.Body)
+	}
+
+	Limits = InstanceLimits{}
+	if rec := do(e, http.MethodPost, "/api/notes/merge", merge); rec.Code != http.StatusOK {
+		t.Fatalf("merge = %d %s", rec.Code, rec.Body)
+	}
+	Limits = InstanceLimits{MaxNotes: 1}
+	if rec := do(e, http.MethodPost, "/api/trash/"+ids[1]+"/restore", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("restoring a note past the note limit = %d %s", rec.Code, rec.Body)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(notes) != 1 || len(trash) != 1 {
+		t.Errorf("%d notes and %d in the trash after the refused restore", len(notes), len(trash))
+	}
+}
+
+// mapRepository keeps notes in a map of its own, to check the note routes
+// only go through the repository
+type mapRepository struct {
+	mu    *sync.Mutex
+	notes map[string]models.Note
+}
+
+func (r mapRepository) List(bool) ([]models.Note, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := []models.Note{}
+	for _, note := range r.notes {
+		list = append(list, note)
+	}
+	return list, int64(len(r.notes))
+}
+
+func (r mapRepository) Get(id string) (models.Note, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	note, ok := r.notes[id]
+	if !ok {
+		return models.Note{}, ErrNotFound
+	}
+	return note, nil
+}
+
+func (r mapRepository) Create(note models.Note) (models.Note, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	note.ID = uuid.NewString()
+	note.UpdatedAt = time.Now()
+	r.notes[note.ID] = note
+	return note, nil
+}
+
+func (r mapRepository) Update(id string, note models.Note) (models.Note, error) {
+	return r.UpdateIfMatch(id, note, "")
+}
+
+func (r mapRepository) UpdateIfMatch(id string, note models.Note, _ string) (models.Note, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.notes[id]; !ok {
+		return models.Note{}, ErrNotFound
+	}
+	note.ID, note.UpdatedAt = id, time.Now()
+	r.notes[id] = note
+	return note, nil
+}
+
+func (r mapRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.notes[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.notes, id)
+	return nil
+}
+
+func (r mapRepository) Watch(int64) ([]models.Change, <-chan struct{}, error) {
+	return nil, nil, nil
+}
+
+func (r mapRepository) Nearby(geo.Point, float64) []NearbyNote {
+	return nil
+}
+
+func TestInjectedRepository(t *testing.T) {
+	e := newTestServer(t)
+	repo := mapRepository{&sync.Mutex{}, map[string]models.Note{}}
+	Repositories = func(Scope) Repository { return repo }
+	t.Cleanup(func() { Repositories = MemoryRepository })
+
+	parallel(4, 25, func(worker, i int) {
+		if rec := do(e, http.MethodPost, "/api/notes", fmt.Sprintf(`{"title":"w%d-%d"}`, worker, i)); rec.Code != http.StatusCreated {
+			t.Errorf("create: %d %s", rec.Code, rec.Body)
+		}
+		do(e, http.MethodGet, "/api/notes", "")
+	})
+	if len(repo.notes) != 100 {
+		t.Fatalf("repository has %d notes, want 100", len(repo.notes))
+	}
+	mu.Lock()
+	kept := len(notes)
+	mu.Unlock()
+	if kept != 0 {
+		t.Errorf("%d notes went into package state instead of the repository", kept)
+	}
+
+	var list []models.Note
+	if err := json.Unmarshal(do(e, http.MethodGet, "/api/notes", "").Body.Bytes(), &list); err != nil || len(list) != 100 {
+		t.Fatalf("listed %d notes, %v", len(list), err)
+	}
+	id := list[0].ID
+	if rec := do(e, http.MethodGet, "/api/notes/"+id, ""); rec.Code != http.StatusOK {
+		t.Errorf("get: %d", rec.Code)
+	}
+	if rec := do(e, http.MethodPut, "/api/notes/"+id, `{"title":"renamed"}`); rec.Code != http.StatusOK || repo.notes[id].Title != "renamed" {
+		t.Errorf("update: %d, title %q", rec.Code, repo.notes[id].Title)
+	}
+	if rec := do(e, http.MethodDelete, "/api/notes/"+id, ""); rec.Code != http.StatusOK {
+		t.Errorf("delete: %d", rec.Code)
+	}
+	if _, ok := repo.notes[id]; ok {
+		t.Error("the deleted note is still in the repository")
+	}
+}
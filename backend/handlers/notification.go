@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/models"
+	"note/backend/notify"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Notifications routes note events to the channels users asked for
+var Notifications = notify.NewDispatcher()
+
+// Inbox is the in-app notification channel
+var Inbox = notify.NewInbox(200)
+
+// notifyNote hands an event about a note to the dispatcher without making
+// the request wait for slow channels
+func notifyNote(t notify.EventType, note models.Note) {
+	notifyNoteDetail(t, note, "")
+}
+
+// notifyNoteDetail is notifyNote with a human readable explanation
+func notifyNoteDetail(t notify.EventType, note models.Note, detail string) {
+	// Sandboxes are for trying the API, not for telling anyone about it
+	if isSandbox(note.Workspace) {
+		return
+	}
+	event := notify.Event{
+		Type:      t,
+		NoteID:    note.ID,
+		Title:     note.Title,
+		Notebook:  note.Notebook,
+		Workspace: note.Workspace,
+		Detail:    detail,
+		At:        time.Now(),
+	}
+	if t != notify.NoteDeleted {
+		event.Note = &note
+	}
+	go Notifications.Dispatch(event)
+}
+
+// List the in-app notifications about the workspace, newest first
+func GetNotifications(c echo.Context) error {
+	return c.JSON(http.StatusOK, Inbox.List(workspaceOf(c)))
+}
+
+// Mark an in-app notification as read
+func ReadNotification(c echo.Context) error {
+	if !Inbox.MarkRead(c.Param("id"), workspaceOf(c)) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Notification marked as read"})
+}
+
+// Get the notification preferences of the workspace
+func GetNotificationPreferences(c echo.Context) error {
+	return c.JSON(http.StatusOK, Notifications.Preferences(workspaceOf(c)))
+}
+
+// Replace the notification preferences of the workspace. They decide for
+// every member, so they take its admin role, or the instance's admin role
+// in the default workspace, which has no members.
+func UpdateNotificationPreferences(c echo.Context) error {
+	if !workspaceAdmin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Notification preferences are changed by workspace admins"})
+	}
+	prefs := new(notify.Preferences)
+	if err := c.Bind(prefs); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if err := Notifications.SetPreferences(workspaceOf(c), *prefs); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
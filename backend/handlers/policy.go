@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"note/backend/imaging"
+	"note/backend/ink"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AttachmentPolicy restricts the files attached to notes
+type AttachmentPolicy struct {
+	// AllowedTypes are the media types that may be attached, like
+	// "application/pdf", or whole kinds like "image/*". Any type may be
+	// attached while it is empty.
+	AllowedTypes []string `json:"allowed_types,omitempty"`
+	// MaxSize is the most bytes an attachment may have, up to the 10 MiB
+	// every attachment is held to; zero means that limit.
+	MaxSize int `json:"max_size,omitempty"`
+}
+
+// Validate reports what is wrong with a policy, if anything
+func (p AttachmentPolicy) Validate() error {
+	if p.MaxSize < 0 || p.MaxSize > maxAttachmentSize {
+		return fmt.Errorf("attachment max_size must be 0 to %d bytes", maxAttachmentSize)
+	}
+	for _, t := range p.AllowedTypes {
+		kind, sub, ok := strings.Cut(t, "/")
+		if _, _, err := mime.ParseMediaType(t); err != nil || !ok || kind == "*" || kind == "" || sub == "" {
+			return fmt.Errorf("allowed attachment type %q must look like image/png or image/*", t)
+		}
+	}
+	return nil
+}
+
+// The ways check refuses a file; a file of a type that contradicts its
+// content is refused with the error of imaging.Sniff
+var (
+	errAttachmentTooLarge = errors.New("attachment is too large")
+	errAttachmentType     = errors.New("attachment type is not allowed")
+	errInvalidInk         = errors.New("invalid ink drawing")
+)
+
+// check checks a file to attach under the policy, uploaded or from
+// anywhere else: its size, its type as sniffed from the content, which
+// must agree with the declared one, and that ink drawings are valid. It
+// returns the type and the file, without location if stripLocation is
+// set and it is a photo. When the type isn't allowed it is returned with
+// errAttachmentType.
+func (p AttachmentPolicy) check(declared string, data []byte, stripLocation bool) (string, []byte, error) {
+	if len(data) > p.maxSize() {
+		return "", nil, errAttachmentTooLarge
+	}
+	contentType, err := imaging.Sniff(declared, data)
+	if err != nil {
+		return "", nil, err
+	}
+	if !p.allows(contentType) {
+		return contentType, nil, errAttachmentType
+	}
+	if contentType == ink.ContentType {
+		if _, err := ink.Parse(data); err != nil {
+			return "", nil, fmt.Errorf("%w: %w", errInvalidInk, err)
+		}
+	}
+	if stripLocation && contentType == "image/jpeg" {
+		data, _ = imaging.StripLocation(data)
+	}
+	return contentType, data, nil
+}
+
+// maxSize is the most bytes an attachment may have under the policy
+func (p AttachmentPolicy) maxSize() int {
+	if p.MaxSize > 0 {
+		return p.MaxSize
+	}
+	return maxAttachmentSize
+}
+
+// allows reports whether files of a media type may be attached
+func (p AttachmentPolicy) allows(contentType string) bool {
+	if len(p.AllowedTypes) == 0 {
+		return true
+	}
+	kind, _, _ := strings.Cut(contentType, "/")
+	for _, t := range p.AllowedTypes {
+		if strings.EqualFold(t, contentType) || strings.EqualFold(t, kind+"/*") {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceAttachments are the attachment policies admins set for single
+// workspaces, by workspace ID. Guarded by mu.
+var workspaceAttachments = map[string]AttachmentPolicy{}
+
+// attachmentPolicy returns the attachment policy of a workspace: its
+// own, narrowed to what the instance allows, or Limits.Attachments.
+// Callers must hold mu.
+func attachmentPolicy(ws string) AttachmentPolicy {
+	instance := Limits.Attachments
+	p, ok := workspaceAttachments[ws]
+	if !ok {
+		return instance
+	}
+	if p.MaxSize == 0 || p.MaxSize > instance.maxSize() {
+		p.MaxSize = instance.MaxSize
+	}
+	if len(instance.AllowedTypes) == 0 {
+		return p
+	}
+	var allowed []string
+	for _, t := range p.AllowedTypes {
+		for _, u := range instance.AllowedTypes {
+			if both := narrower(t, u); both != "" && !slices.Contains(allowed, both) {
+				allowed = append(allowed, both)
+			}
+		}
+	}
+	// None left when the instance stopped allowing all of them since
+	if len(allowed) == 0 {
+		allowed = instance.AllowedTypes
+	}
+	p.AllowedTypes = allowed
+	return p
+}
+
+// narrower returns the one of two allowed types the other covers too,
+// like image/png of image/png and image/*, or "" if they don't overlap
+func narrower(a, b string) string {
+	kindA, subA, _ := strings.Cut(a, "/")
+	kindB, subB, _ := strings.Cut(b, "/")
+	switch {
+	case !strings.EqualFold(kindA, kindB):
+		return ""
+	case strings.EqualFold(subA, subB), subB == "*":
+		return a
+	case subA == "*":
+		return b
+	}
+	return ""
+}
+
+type attachmentCapabilities struct {
+	MaxSize      int      `json:"max_size"`
+	AllowedTypes []string `json:"allowed_types"` // empty when any type may be attached
+	Thumbnails   []string `json:"thumbnail_types"`
+	MaxThumbnail int      `json:"max_thumbnail_width"`
+	Formats      []string `json:"convert_formats"` // what thumbnails can be converted to
+}
+
+type noteCapabilities struct {
+	MaxNoteSize int `json:"max_note_size,omitempty"`
+}
+
+// Get what the caller may store in the workspace, so clients can check
+// files and notes before uploading them
+func GetCapabilities(c echo.Context) error {
+	mu.Lock()
+	limits := Limits
+	policy := attachmentPolicy(workspaceOf(c))
+	mu.Unlock()
+	allowed := policy.AllowedTypes
+	if allowed == nil {
+		allowed = []string{}
+	}
+	maxNoteSize := limits.MaxNoteSize
+	if q := limits.PerUser.MaxNoteSize; ownerOf(c) != "" && q > 0 && (maxNoteSize == 0 || q < maxNoteSize) {
+		maxNoteSize = q
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"attachments": attachmentCapabilities{
+			MaxSize:      policy.maxSize(),
+			AllowedTypes: allowed,
+			Thumbnails:   imaging.Types,
+			MaxThumbnail: maxPreviewSize,
+			Formats:      []string{"jpeg", "png", "webp"},
+		},
+		"notes": noteCapabilities{MaxNoteSize: maxNoteSize},
+	})
+}
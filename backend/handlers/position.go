@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"note/backend/models"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// positions are the reading positions of notes by note and then API key
+// ("" without one), guarded by mu
+var positions = map[string]map[string]models.ReadingPosition{}
+
+const maxAnchorLength = 200
+
+// noteWithPosition is a note as GetNote returns it to a caller who has
+// read it before
+type noteWithPosition struct {
+	models.Note
+	Position models.ReadingPosition `json:"position"`
+}
+
+// Save where the caller left off reading a note
+func UpdateReadingPosition(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	var pos models.ReadingPosition
+	if err := c.Bind(&pos); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	pos.Anchor, pos.Device = strings.TrimSpace(pos.Anchor), strings.TrimSpace(pos.Device)
+	switch {
+	case pos.Offset < 0:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset can't be negative"})
+	case pos.Progress < 0 || pos.Progress > 1:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "progress must be 0 to 1"})
+	case len(pos.Anchor) > maxAnchorLength || len(pos.Device) > maxAnchorLength:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("anchor and device can have at most %d bytes", maxAnchorLength)})
+	}
+	pos.UpdatedAt = time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, note := range notes {
+		if note.ID != id {
+			continue
+		}
+		// Content may have shrunk since the client loaded it
+		pos.Offset = min(pos.Offset, len(note.Content))
+		if positions[id] == nil {
+			positions[id] = map[string]models.ReadingPosition{}
+		}
+		positions[id][ownerOf(c)] = pos
+		return c.JSON(http.StatusOK, pos)
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+}
+
+// Get where the caller left off reading a note
+func GetReadingPosition(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	pos, ok := positions[id][ownerOf(c)]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No reading position"})
+	}
+	return c.JSON(http.StatusOK, pos)
+}
+
+// Forget where the caller left off reading a note, like once they finished
+func DeleteReadingPosition(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := positions[id][ownerOf(c)]; !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No reading position"})
+	}
+	delete(positions[id], ownerOf(c))
+	if len(positions[id]) == 0 {
+		delete(positions, id)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Reading position deleted"})
+}
+
+// getNoteWithPosition answers GetNote for a caller with a reading position
+// in the note. The response is theirs alone, so it isn't cached, and its
+// ETag changes with the position too.
+func getNoteWithPosition(c echo.Context, note models.Note, pos models.ReadingPosition) error {
+	etag := fmt.Sprintf(`"%s-%d-%d"`, note.ID, note.UpdatedAt.UnixNano(), pos.UpdatedAt.UnixNano())
+	modified := note.UpdatedAt
+	if pos.UpdatedAt.After(modified) {
+		modified = pos.UpdatedAt
+	}
+	if notModified(c, etag, modified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSON(http.StatusOK, noteWithPosition{note, pos})
+}
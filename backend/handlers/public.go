@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/auth"
+	"note/backend/idcodec"
+	"note/backend/models"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PublicIDs maps note IDs to the IDs the public API and feeds show
+var PublicIDs idcodec.Codec = idcodec.Plain{}
+
+// publicNote returns note as the public API shows it: under its public ID,
+// without who owns it and without its private sections
+func publicNote(note models.Note) models.Note {
+	note = redacted(note)
+	note.ID = PublicIDs.Encode(note.ID)
+	note.Owner = ""
+	if note.MergedFrom != nil {
+		merged := make([]string, len(note.MergedFrom))
+		for i, id := range note.MergedFrom {
+			merged[i] = PublicIDs.Encode(id)
+		}
+		note.MergedFrom = merged
+	}
+	return note
+}
+
+// publicNoteID reads the :id route parameter as a public note ID
+func publicNoteID(c echo.Context) (string, bool) {
+	id, ok := PublicIDs.Decode(c.Param("id"))
+	if !ok {
+		return "", false
+	}
+	return models.ResolveNoteID(id, AcceptLegacyIDs)
+}
+
+// visible reports whether a read-only token may see a note: a published
+// one its owner has in its workspace
+func visible(token auth.Token, note models.Note) bool {
+	return note.Published && note.Owner == token.Owner && note.Workspace == token.Workspace &&
+		(token.Notebook == "" || note.Notebook == token.Notebook)
+}
+
+// readerKey tells apart the readers pages are cached for: tokens see the
+// notes of their owner and workspace, maybe of one notebook only
+func readerKey(token auth.Token) string {
+	return strings.Join([]string{token.Owner, token.Workspace, token.Notebook}, "\x00")
+}
+
+// ownNote reports whether a token for the calendar or feed of its owner's
+// notes covers a note: one of the owner's in the token's workspace
+func ownNote(token auth.Token, note models.Note) bool {
+	return note.Owner == token.Owner && note.Workspace == token.Workspace &&
+		(token.Notebook == "" || note.Notebook == token.Notebook)
+}
+
+// List the published notes the token has access to
+func GetPublicNotes(c echo.Context) error {
+	stream, ok := streamMode(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid stream mode"})
+	}
+	token, _ := auth.FromContext(c)
+	if stream != streamOff {
+		return streamNotes(c, publishedNotes(token), stream)
+	}
+	page, err := renderOnce("public-notes:"+readerKey(token), func() (rendered, error) {
+		return renderedJSON(http.StatusOK, publishedNotes(token))
+	})
+	if err != nil {
+		return err
+	}
+	return sendRendered(c, page)
+}
+
+// publishedNotes returns the published notes a token has access to as the
+// public see them
+func publishedNotes(token auth.Token) []models.Note {
+	mu.Lock()
+	defer mu.Unlock()
+	published := []models.Note{}
+	for _, note := range notes {
+		if visible(token, note) {
+			published = append(published, publicNote(note))
+		}
+	}
+	return published
+}
+
+// Get a single published note. Unpublished notes look like missing ones
+// so a token can't be used to probe for private IDs.
+func GetPublicNote(c echo.Context) error {
+	id, ok := publicNoteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	token, _ := auth.FromContext(c)
+	page, err := renderOnce("public-note:"+id+":"+readerKey(token), func() (rendered, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, note := range notes {
+			if note.ID == id && visible(token, note) {
+				public := publicNote(note)
+				page, err := renderedJSON(http.StatusOK, public)
+				page.etag, page.modified = noteETag(public), note.UpdatedAt
+				return page, err
+			}
+		}
+		return renderedJSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	})
+	if err != nil {
+		return err
+	}
+	return sendRendered(c, page)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"note/backend/audit"
+	"note/backend/models"
+	"time"
+)
+
+// Publications hands notes whose publish_at came to the publishing
+// scheduler
+type Publications struct{}
+
+// Due publishes every note scheduled for now or earlier and returns them
+func (Publications) Due(now time.Time) []models.Note {
+	mu.Lock()
+	defer mu.Unlock()
+	var due []models.Note
+	for i := range notes {
+		note := &notes[i]
+		if note.PublishAt == nil || note.Published || note.PublishAt.After(now) {
+			continue
+		}
+		// The scheduled time is what readers of a changelog expect, even
+		// if the poll came a little later
+		published := *note.PublishAt
+		note.Published = true
+		note.PublishAt = nil
+		note.PublishedAt = &published
+		note.UpdatedAt = now
+		recordChange(models.ChangeUpdate, note.ID, note)
+		recordAudit(audit.System, audit.Update, note.ID, "published as scheduled")
+		touchNotebooks(note.Notebook)
+		due = append(due, *note)
+	}
+	return due
+}
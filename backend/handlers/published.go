@@ -0,0 +1,36 @@
+package handlers
+
+import "note/backend/models"
+
+// PublishedChanges is the change log as the event sink publishes it:
+// changes to notes in a sandbox are left out. A deleted note is gone
+// from the log by then, so its delete goes out either way.
+type PublishedChanges struct{}
+
+// Watch is Store.Watch of every workspace but sandboxes. When every change after
+// since was in a sandbox, it waits for the next one as if there were none.
+func (PublishedChanges) Watch(since int64) ([]models.Change, <-chan struct{}, error) {
+	for {
+		pending, changed, err := watchChanges(since)
+		if err != nil || len(pending) == 0 {
+			return pending, changed, err
+		}
+		var kept []models.Change
+		for _, change := range pending {
+			if change.Note == nil || !isSandbox(change.Note.Workspace) {
+				kept = append(kept, change)
+			}
+		}
+		if len(kept) > 0 {
+			return kept, changed, nil
+		}
+		since = pending[len(pending)-1].Seq
+	}
+}
+
+// Latest returns the sequence of the last change
+func (PublishedChanges) Latest() int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return lastSeq
+}
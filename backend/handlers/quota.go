@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note/backend/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Quota caps what a single user stores. Zero means no limit.
+type Quota struct {
+	MaxNotes    int `json:"max_notes"`
+	MaxNoteSize int `json:"max_note_size"` // bytes of title, content and items
+	MaxStorage  int `json:"max_storage"`   // bytes of all notes and attachments together
+}
+
+// Usage is what a user currently stores
+type Usage struct {
+	Notes        int `json:"notes"`
+	StorageBytes int `json:"storage_bytes"`
+}
+
+// Error codes clients can tell refusals apart by
+const (
+	codeNoteLimit    = "note_limit"
+	codeNoteTooLarge = "note_too_large"
+	codeStorageLimit = "storage_limit"
+
+	codeAttachmentType     = "attachment_type"
+	codeAttachmentTooLarge = "attachment_too_large"
+
+	codeQuotaExceeded = "quota_exceeded"
+)
+
+// noteSize is what a note counts against size limits and storage usage
+func noteSize(note models.Note) int {
+	size := len(note.Title) + len(note.Content)
+	for _, item := range note.Items {
+		size += len(item.Text)
+	}
+	return size
+}
+
+// usageOf sums up the notes owner owns. Callers must hold mu.
+func usageOf(owner string) Usage {
+	var usage Usage
+	for _, note := range notes {
+		if note.Owner == owner {
+			usage.Notes++
+			usage.StorageBytes += noteSize(note) + attachmentBytes(note.ID)
+		}
+	}
+	return usage
+}
+
+// checkLimits reports whether note may be stored under the instance
+// limits and the quota of its owner. id is the note it replaces, or ""
+// for a new note owned by note.Owner. Callers must hold mu.
+func checkLimits(note models.Note, id string) error {
+	size := noteSize(note)
+	owner, oldSize := note.Owner, 0
+	if id != "" {
+		for _, old := range notes {
+			if old.ID == id {
+				owner, oldSize = old.Owner, noteSize(old)
+			}
+		}
+	}
+	if id == "" && Limits.MaxNotes > 0 && len(notes) >= Limits.MaxNotes {
+		return ErrNoteLimit
+	}
+	if Limits.MaxNoteSize > 0 && size > Limits.MaxNoteSize {
+		return ErrNoteTooLarge
+	}
+	// Notes without an owner belong to the instance and only count
+	// against its limits
+	quota := Limits.PerUser
+	if owner == "" || quota == (Quota{}) {
+		return nil
+	}
+	usage := usageOf(owner)
+	switch {
+	case id == "" && quota.MaxNotes > 0 && usage.Notes >= quota.MaxNotes:
+		return ErrNoteLimit
+	case quota.MaxNoteSize > 0 && size > quota.MaxNoteSize:
+		return ErrNoteTooLarge
+	case quota.MaxStorage > 0 && size > oldSize && usage.StorageBytes-oldSize+size > quota.MaxStorage:
+		return ErrStorageLimit
+	}
+	return nil
+}
+
+// limitResponse answers a request refused by checkLimits
+func limitResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrNoteTooLarge):
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Note is too large", "code": codeNoteTooLarge})
+	case errors.Is(err, ErrStorageLimit):
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Storage quota exceeded", "code": codeStorageLimit})
+	}
+	return c.JSON(http.StatusForbidden, map[string]string{"error": "Note limit reached", "code": codeNoteLimit})
+}
+
+// Get what the caller stores and the quota it is held to
+func GetUsage(c echo.Context) error {
+	owner := ownerOf(c)
+	mu.Lock()
+	defer mu.Unlock()
+	res := map[string]any{"usage": usageOf(owner)}
+	if owner != "" {
+		res["user"] = owner
+		res["quota"] = Limits.PerUser
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"net/http"
+	"note/backend/models"
+	"note/backend/related"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Embeddings embeds note content for related notes; nil leaves embedding
+// similarity out
+var Embeddings related.Embedder
+
+// embeddingBatch is how many notes EmbedNotes sends the embedder at once
+const embeddingBatch = 32
+
+const maxRelatedResults = 50
+
+// embedding is the vector of a note's content, with the hash of the
+// content it was made from
+type embedding struct {
+	hash   [32]byte
+	vector []float32
+}
+
+// embeddings are the note embeddings by note ID, guarded by mu. Those of
+// notes changed since are left for EmbedNotes to replace.
+var embeddings = map[string]embedding{}
+
+func embeddingHash(note models.Note) [32]byte {
+	return sha256.Sum256([]byte(note.Title + "\n" + note.Content))
+}
+
+// forgetEmbedding drops the embedding of a deleted or encrypted note.
+// Callers must hold mu.
+func forgetEmbedding(id string, note *models.Note) {
+	if note == nil || note.ContentEncrypted {
+		delete(embeddings, id)
+	}
+}
+
+// vectorOf returns the embedding of a note if it is up to date. Callers
+// must hold mu.
+func vectorOf(note models.Note) []float32 {
+	if e, ok := embeddings[note.ID]; ok && e.hash == embeddingHash(note) {
+		return e.vector
+	}
+	return nil
+}
+
+// EmbedNotes embeds the notes that are new or changed every interval,
+// until ctx is done
+func EmbedNotes(ctx context.Context, interval time.Duration) {
+	for {
+		if err := embedChanged(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("embedding notes: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func embedChanged(ctx context.Context) error {
+	mu.Lock()
+	var stale []models.Note
+	for _, note := range notes {
+		if !note.ContentEncrypted && vectorOf(note) == nil {
+			stale = append(stale, note)
+		}
+	}
+	mu.Unlock()
+
+	for start := 0; start < len(stale); start += embeddingBatch {
+		batch := stale[start:min(start+embeddingBatch, len(stale))]
+		texts := make([]string, len(batch))
+		for i, note := range batch {
+			texts[i] = note.Title + "\n" + note.Content
+		}
+		vectors, err := Embeddings.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		for i, note := range batch {
+			embeddings[note.ID] = embedding{hash: embeddingHash(note), vector: vectors[i]}
+		}
+		mu.Unlock()
+	}
+	return nil
+}
+
+// relatedNote is a recommended note with what it is recommended for
+type relatedNote struct {
+	related.Result
+	Title     string    `json:"title"`
+	Notebook  string    `json:"notebook,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// List the notes of the workspace most like a note, by the hashtags they
+// share, how close they are through links and relations and, with
+// embeddings on, how alike their content is. ?strategy= picks how these
+// are weighed (weighted by default, or strongest) and ?limit= how many
+// notes are returned, 10 by default.
+func GetRelatedNotes(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	name := c.QueryParam("strategy")
+	if name == "" {
+		name = related.DefaultStrategy
+	}
+	strategy, ok := related.Lookup(name)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown strategy " + name})
+	}
+	limit := 10
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRelatedResults {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be 1 to 50"})
+		}
+		limit = n
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	scoped := inWorkspace(c, notes)
+	var of related.Note
+	found := false
+	candidates := make([]related.Note, 0, len(scoped))
+	byID := make(map[string]models.Note, len(scoped))
+	for _, note := range scoped {
+		n := related.Note{ID: note.ID, Tags: NoteTags(note), Vector: vectorOf(note)}
+		if note.ID == id {
+			of, found = n, true
+		}
+		candidates = append(candidates, n)
+		byID[note.ID] = note
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	g := related.Graph{}
+	r := newLinkResolver(scoped)
+	for _, note := range scoped {
+		for _, target := range r.linksFrom(note.ID) {
+			if _, ok := byID[target]; ok {
+				g.Connect(note.ID, target)
+			}
+		}
+	}
+	for _, rel := range relations {
+		_, from := byID[rel.From]
+		_, to := byID[rel.To]
+		if from && to {
+			g.Connect(rel.From, rel.To)
+		}
+	}
+
+	list := []relatedNote{}
+	for _, result := range related.Find(of, candidates, g, strategy, limit) {
+		note := byID[result.ID]
+		list = append(list, relatedNote{Result: result, Title: note.Title, Notebook: note.Notebook, UpdatedAt: note.UpdatedAt})
+	}
+	return c.JSON(http.StatusOK, list)
+}
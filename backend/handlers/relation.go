@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// relations are guarded by mu like the notes they link, in the order they
+// were created
+var relations []models.Relation
+
+// noteExists reports whether there is a note with the given ID. Callers
+// must hold mu.
+func noteExists(id string) bool {
+	for _, note := range notes {
+		if note.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// noteIn reports whether a note with the given ID is in a workspace.
+// Callers must hold mu.
+func noteIn(id, workspace string) bool {
+	for _, note := range notes {
+		if note.ID == id {
+			return note.Workspace == workspace
+		}
+	}
+	return false
+}
+
+// relationsOf returns the relations from or to a note, or only those in
+// one direction ("out" or "in") and of one type. Callers must hold mu.
+func relationsOf(id, direction, relType string) []models.Relation {
+	list := []models.Relation{}
+	for _, r := range relations {
+		out := r.From == id && direction != "in"
+		in := r.To == id && direction != "out"
+		if (out || in) && (relType == "" || r.Type == relType) {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// alreadyRelated reports whether a note is related to another that way.
+// Related-to relations count in both directions. Callers must hold mu.
+func alreadyRelated(from, to, relType string) bool {
+	for _, r := range relations {
+		same := r.From == from && r.To == to
+		if r.Type == models.RelationRelatedTo {
+			same = same || r.From == to && r.To == from
+		}
+		if r.Type == relType && same {
+			return true
+		}
+	}
+	return false
+}
+
+// reaches reports whether there is a path of relations of a type from one
+// note to another. Callers must hold mu.
+func reaches(from, to, relType string) bool {
+	seen := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			return true
+		}
+		for _, r := range relations {
+			if r.Type == relType && r.From == id && !seen[r.To] {
+				seen[r.To] = true
+				queue = append(queue, r.To)
+			}
+		}
+	}
+	return false
+}
+
+// List the relations of a note in both directions, or only ?direction=out
+// or in, and only those of ?type=
+func GetRelations(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	direction := c.QueryParam("direction")
+	if direction != "" && direction != "both" && direction != "out" && direction != "in" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "direction must be both, out or in"})
+	}
+	relType := c.QueryParam("type")
+	if relType != "" && !models.ValidRelationType(relType) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown relation type " + relType})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !noteExists(id) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	return c.JSON(http.StatusOK, relationsOf(id, direction, relType))
+}
+
+// Relate a note to another: {"type": "blocks", "to": "<note ID>"}. Blocks
+// and parent-of relations can't form a cycle.
+func CreateRelation(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	var req struct {
+		Type string `json:"type"`
+		To   string `json:"to"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if !models.ValidRelationType(req.Type) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be blocks, related-to or parent-of"})
+	}
+	to, ok := models.ResolveNoteID(req.To, AcceptLegacyIDs)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID in to"})
+	}
+	if to == id {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "A note can't be related to itself"})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !noteExists(id) || !noteIn(to, workspaceOf(c)) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+	if alreadyRelated(id, to, req.Type) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "The notes are already related that way"})
+	}
+	if req.Type != models.RelationRelatedTo && reaches(to, id, req.Type) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "The relation would form a cycle"})
+	}
+	relation := models.Relation{ID: uuid.NewString(), Type: req.Type, From: id, To: to, CreatedAt: time.Now()}
+	relations = append(relations, relation)
+	recordAudit(actorOf(c), audit.Relate, id, req.Type+" "+to)
+	return c.JSON(http.StatusCreated, relation)
+}
+
+// Remove a relation from or to a note
+func DeleteRelation(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, r := range relations {
+		if r.ID == c.Param("relationId") && (r.From == id || r.To == id) {
+			relations = append(relations[:i], relations[i+1:]...)
+			recordAudit(actorOf(c), audit.Unrelate, r.From, r.Type+" "+r.To)
+			return c.JSON(http.StatusOK, map[string]string{"message": "Relation deleted successfully"})
+		}
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Relation not found"})
+}
+
+// deleteRelations drops the relations from and to a deleted note. Callers
+// must hold mu.
+func deleteRelations(id string) {
+	kept := relations[:0]
+	for _, r := range relations {
+		if r.From != id && r.To != id {
+			kept = append(kept, r)
+		}
+	}
+	relations = kept
+}
+
+// moveRelations points the relations from and to a note at another one
+// instead. Those that would relate the note to itself, repeat a relation
+// it has or form a cycle are dropped. Callers must hold mu.
+func moveRelations(id, into string) {
+	moved := relationsOf(id, "", "")
+	deleteRelations(id)
+	for _, r := range moved {
+		if r.From == id {
+			r.From = into
+		}
+		if r.To == id {
+			r.To = into
+		}
+		if r.From == r.To || alreadyRelated(r.From, r.To, r.Type) {
+			continue
+		}
+		if r.Type != models.RelationRelatedTo && reaches(r.To, r.From, r.Type) {
+			continue
+		}
+		relations = append(relations, r)
+	}
+}
+
+// noteWithRelations is a note payload with ?include=relations
+type noteWithRelations struct {
+	models.Note
+	Relations []models.Relation `json:"relations"`
+}
+
+// includeRelations reports whether a request asked for ?include=relations
+func includeRelations(c echo.Context) bool {
+	return c.QueryParam("include") == "relations"
+}
+
+// withRelations adds their relations to notes. Callers must hold mu.
+func withRelations(list []models.Note) []noteWithRelations {
+	out := make([]noteWithRelations, len(list))
+	for i, note := range list {
+		out[i] = noteWithRelations{note, relationsOf(note.ID, "", "")}
+	}
+	return out
+}
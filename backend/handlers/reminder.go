@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/reminder"
+	"time"
+)
+
+// scheduleReminder checks the reminder schedule of a note and derives
+// RemindAt from its wall-clock time, or that from RemindAt. A repeating
+// reminder starts at its first firing after now.
+func scheduleReminder(note *models.Note, now time.Time) error {
+	if note.RemindZone == "" {
+		if note.RemindLocal != "" || note.RemindRepeat != "" {
+			return fmt.Errorf("%w: remind_local and remind_repeat need a remind_zone", ErrBadReminder)
+		}
+		return nil
+	}
+	if note.RemindLocal == "" {
+		if note.RemindAt == nil {
+			return fmt.Errorf("%w: remind_zone needs remind_local or remind_at", ErrBadReminder)
+		}
+		local, err := reminder.Local(*note.RemindAt, note.RemindZone)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrBadReminder, err)
+		}
+		note.RemindLocal = local
+	}
+	s := reminder.Schedule{Zone: note.RemindZone, Local: note.RemindLocal, Repeat: note.RemindRepeat}
+	at, _, err := s.Next(now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadReminder, err)
+	}
+	note.RemindAt = &at
+	return nil
+}
+
+// Reminders hands due reminders to the reminder scheduler
+type Reminders struct{}
+
+// Due marks every reminder that is due at now as fired and returns the
+// notes they belong to. Repeating reminders move on to their next time.
+func (Reminders) Due(now time.Time) []models.Note {
+	mu.Lock()
+	defer mu.Unlock()
+	var due []models.Note
+	for i := range notes {
+		note := &notes[i]
+		if note.RemindAt == nil || note.RemindAt.After(now) ||
+			(note.ReminderFiredAt != nil && !note.ReminderFiredAt.Before(*note.RemindAt)) {
+			continue
+		}
+		fired := now
+		note.ReminderFiredAt = &fired
+		note.UpdatedAt = now
+		due = append(due, *note)
+		if note.RemindRepeat != "" {
+			s := reminder.Schedule{Zone: note.RemindZone, Local: note.RemindLocal, Repeat: note.RemindRepeat}
+			if next, ok, err := s.Next(now); err == nil && ok {
+				note.RemindAt = &next
+			}
+		}
+		recordChange(models.ChangeUpdate, note.ID, note)
+		recordAudit(audit.System, audit.Update, note.ID, "reminder sent")
+		touchNotebooks(note.Notebook)
+	}
+	return due
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"note/backend/models"
+	"testing"
+	"time"
+)
+
+func TestRepeatingReminderAcrossDST(t *testing.T) {
+	e := newTestServer(t)
+	rec := do(e, http.MethodPost, "/api/notes", `{"title":"Standup","remind_zone":"Europe/Berlin","remind_local":"2099-03-26T09:30:00","remind_repeat":"daily"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	var note models.Note
+	if err := json.Unmarshal(rec.Body.Bytes(), &note); err != nil {
+		t.Fatal(err)
+	}
+
+	// Berlin moves to summer time on March 29th, 2099
+	want := []string{
+		"2099-03-26T08:30:00Z",
+		"2099-03-27T08:30:00Z",
+		"2099-03-28T08:30:00Z",
+		"2099-03-29T07:30:00Z",
+		"2099-03-30T07:30:00Z",
+	}
+	reminders := Reminders{}
+	for i, at := range want {
+		if note.RemindAt == nil || note.RemindAt.UTC().Format(time.RFC3339) != at {
+			t.Fatalf("reminder %d at %v, want %s", i, note.RemindAt, at)
+		}
+		if due := reminders.Due(note.RemindAt.Add(-time.Second)); len(due) != 0 {
+			t.Fatalf("reminder %d fired early", i)
+		}
+		due := reminders.Due(*note.RemindAt)
+		if len(due) != 1 || !due[0].RemindAt.Equal(*note.RemindAt) {
+			t.Fatalf("reminder %d: due %v", i, due)
+		}
+		if again := reminders.Due(*note.RemindAt); len(again) != 0 {
+			t.Fatalf("reminder %d fired twice", i)
+		}
+		note, _ = Store{}.Get(note.ID)
+	}
+}
+
+func TestReminderScheduleValidation(t *testing.T) {
+	e := newTestServer(t)
+	for _, body := range []string{
+		`{"title":"a","remind_zone":"Nowhere/Special","remind_local":"2099-01-01T09:00:00"}`,
+		`{"title":"a","remind_zone":"UTC","remind_local":"tomorrow"}`,
+		`{"title":"a","remind_zone":"UTC","remind_local":"2099-01-01T09:00:00","remind_repeat":"hourly"}`,
+		`{"title":"a","remind_local":"2099-01-01T09:00:00"}`,
+		`{"title":"a","remind_zone":"UTC"}`,
+	} {
+		if rec := do(e, http.MethodPost, "/api/notes", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", body, rec.Code)
+		}
+	}
+
+	// A zone with remind_at fills in the wall-clock time
+	rec := do(e, http.MethodPost, "/api/notes", `{"title":"a","remind_zone":"Asia/Kolkata","remind_at":"2099-01-01T03:30:00Z"}`)
+	var note models.Note
+	if err := json.Unmarshal(rec.Body.Bytes(), &note); err != nil {
+		t.Fatal(err)
+	}
+	if note.RemindLocal != "2099-01-01T09:00:00" {
+		t.Errorf("remind_local = %q", note.RemindLocal)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"note/backend/textdiff"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Limits that keep a single replace from running away
+const (
+	maxReplacePattern  = 1000    // characters in find
+	maxReplacedContent = 1 << 20 // bytes a note may grow to
+	maxReplaceDuration = 30 * time.Second
+	maxReplacePreviews = 50  // notes with diffs in a dry run
+	maxReplaceJobs     = 100 // jobs kept for status lookups
+)
+
+type replaceRequest struct {
+	Find          string   `json:"find"`
+	Replace       string   `json:"replace"`
+	Regex         bool     `json:"regex"` // replace may then use $1 etc.
+	CaseSensitive bool     `json:"case_sensitive"`
+	Fields        []string `json:"fields"` // "title" and/or "content"; content if empty
+	Notebook      string   `json:"notebook"`
+	IDs           []string `json:"ids"`
+	DryRun        bool     `json:"dry_run"`
+}
+
+type replacePreview struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	Replacements int    `json:"replacements"`
+	Diff         string `json:"diff"`
+}
+
+// replaceJob tracks a replace running in the background. It is guarded by mu.
+type replaceJob struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"` // running, done or failed
+	NotesChanged int        `json:"notes_changed"`
+	Replacements int        `json:"replacements"`
+	Skipped      []string   `json:"skipped,omitempty"` // notes left too large or without a title
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+var replaceJobs = map[string]*replaceJob{}
+var replaceJobOrder []string
+
+// replacer applies one find-and-replace to a note
+type replacer struct {
+	pattern *regexp.Regexp
+	replace string
+	literal bool
+	title   bool
+	content bool
+}
+
+func (r replacer) apply(note models.Note) (models.Note, int) {
+	count := 0
+	if r.title {
+		count += len(r.pattern.FindAllStringIndex(note.Title, -1))
+		note.Title = r.replaceIn(note.Title)
+	}
+	// Encrypted content is opaque to the server
+	if r.content && !note.ContentEncrypted {
+		count += len(r.pattern.FindAllStringIndex(note.Content, -1))
+		note.Content = r.replaceIn(note.Content)
+	}
+	return note, count
+}
+
+func (r replacer) replaceIn(s string) string {
+	if r.literal {
+		return r.pattern.ReplaceAllLiteralString(s, r.replace)
+	}
+	return r.pattern.ReplaceAllString(s, r.replace)
+}
+
+// Find and replace text across notes, all of them or only those of a
+// notebook or of a list of IDs. A dry run returns the affected notes with
+// diffs; otherwise the replace runs in the background and its progress is
+// at GET /api/notes/replace/:id.
+func ReplaceNotes(c echo.Context) error {
+	var req replaceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Find == "" || len(req.Find) > maxReplacePattern {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "find must be 1 to 1000 characters"})
+	}
+	r := replacer{replace: req.Replace, literal: !req.Regex}
+	expr := req.Find
+	if !req.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !req.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	var err error
+	if r.pattern, err = regexp.Compile(expr); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid regex: " + err.Error()})
+	}
+	if len(req.Fields) == 0 {
+		req.Fields = []string{"content"}
+	}
+	for _, field := range req.Fields {
+		switch field {
+		case "title":
+			r.title = true
+		case "content":
+			r.content = true
+		default:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown field " + field})
+		}
+	}
+	ids := map[string]bool{}
+	for _, raw := range req.IDs {
+		id, ok := models.ResolveNoteID(raw, AcceptLegacyIDs)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+		}
+		ids[id] = true
+	}
+
+	mu.Lock()
+	var targets []models.Note
+	for _, note := range notes {
+		if note.Workspace == workspaceOf(c) && (req.Notebook == "" || note.Notebook == req.Notebook) && (len(ids) == 0 || ids[note.ID]) {
+			targets = append(targets, note)
+		}
+	}
+	if req.DryRun {
+		mu.Unlock()
+		return c.JSON(http.StatusOK, previewReplace(r, targets))
+	}
+	job := &replaceJob{ID: uuid.NewString(), Status: "running", CreatedAt: time.Now()}
+	replaceJobs[job.ID] = job
+	replaceJobOrder = append(replaceJobOrder, job.ID)
+	if len(replaceJobOrder) > maxReplaceJobs {
+		delete(replaceJobs, replaceJobOrder[0])
+		replaceJobOrder = replaceJobOrder[1:]
+	}
+	view := *job
+	mu.Unlock()
+
+	go runReplace(job, actorOf(c), r, targets)
+	return c.JSON(http.StatusAccepted, view)
+}
+
+func previewReplace(r replacer, targets []models.Note) map[string]any {
+	previews := []replacePreview{}
+	affected, total := 0, 0
+	for _, note := range targets {
+		replaced, count := r.apply(note)
+		if count == 0 {
+			continue
+		}
+		affected++
+		total += count
+		if len(previews) < maxReplacePreviews {
+			diff := ""
+			if replaced.Title != note.Title {
+				diff += textdiff.Unified(note.Title, replaced.Title, 0)
+			}
+			diff += textdiff.Unified(note.Content, replaced.Content, 2)
+			previews = append(previews, replacePreview{ID: note.ID, Title: note.Title, Replacements: count, Diff: diff})
+		}
+	}
+	return map[string]any{"notes_affected": affected, "replacements": total, "previews": previews}
+}
+
+// runReplace rewrites one note at a time so other writes aren't held up.
+// Notes edited since the request was made are replaced in their new state.
+func runReplace(job *replaceJob, actor string, r replacer, targets []models.Note) {
+	deadline := time.Now().Add(maxReplaceDuration)
+	finish := func(status, msg string) {
+		now := time.Now()
+		job.Status, job.Error, job.FinishedAt = status, msg, &now
+	}
+	for _, target := range targets {
+		mu.Lock()
+		if time.Now().After(deadline) {
+			finish("failed", "Stopped after 30s; run it again to continue")
+			mu.Unlock()
+			return
+		}
+		for i := range notes {
+			if notes[i].ID != target.ID {
+				continue
+			}
+			replaced, count := r.apply(notes[i])
+			if count == 0 {
+				break
+			}
+			replaced = sanitized(replaced, Sanitization.Save)
+			if replaced.Title == "" || len(replaced.Title)+len(replaced.Content) > maxReplacedContent {
+				job.Skipped = append(job.Skipped, replaced.ID)
+				break
+			}
+			replaced.UpdatedAt = time.Now()
+			notes[i] = replaced
+			recordChange(models.ChangeUpdate, replaced.ID, &replaced)
+			recordAudit(actor, audit.Replace, replaced.ID, fmt.Sprintf("%d replacements by job %s", count, job.ID))
+			touchNotebooks(replaced.Notebook)
+			notifyNote(notify.NoteUpdated, replaced)
+			job.NotesChanged++
+			job.Replacements += count
+			break
+		}
+		mu.Unlock()
+	}
+	mu.Lock()
+	finish("done", "")
+	mu.Unlock()
+}
+
+// Get the progress of a background replace
+func GetReplaceJob(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	job, ok := replaceJobs[c.Param("id")]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job not found"})
+	}
+	return c.JSON(http.StatusOK, job)
+}
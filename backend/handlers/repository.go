@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"note/backend/geo"
+	"note/backend/models"
+)
+
+// Repository is what the note CRUD routes (GET, POST, PUT and DELETE on
+// /api/notes), the merge preview, /api/events, /api/notes/nearby,
+// GraphQL and gRPC read and write notes through, scoped to one workspace.
+// Store keeps them in memory; another backend can be injected with
+// App.UseRepositories. Every other route, like search, export, sharing,
+// the public API, feeds, merges and transfers, works on the notes in
+// memory, so with another backend those only see what the app itself
+// wrote. Methods must be safe for concurrent use.
+type Repository interface {
+	List(openTasks bool) ([]models.Note, int64)
+	Get(id string) (models.Note, error)
+	Create(note models.Note) (models.Note, error)
+	Update(id string, note models.Note) (models.Note, error)
+	UpdateIfMatch(id string, note models.Note, ifMatch string) (models.Note, error)
+	Delete(id string) error
+	Watch(since int64) ([]models.Change, <-chan struct{}, error)
+	Nearby(center geo.Point, radius float64) []NearbyNote
+}
+
+// Scope is who a repository acts for and what it lets them see and do,
+// with the fields of Store
+type Scope struct {
+	Actor     string
+	Workspace string
+	ReadOnly  bool
+}
+
+// Repositories opens the repository of a request's scope. It is set
+// before the app starts and not changed after.
+var Repositories = MemoryRepository
+
+// MemoryRepository is the Store of a scope, which keeps notes in memory
+func MemoryRepository(s Scope) Repository {
+	return Store(s)
+}
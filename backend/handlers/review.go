@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Actions on a note in the review queue
+const (
+	reviewKeep    = "reviewed"
+	reviewArchive = "archive"
+	reviewDelete  = "delete"
+)
+
+// ReviewSettings decide which notes resurface for review
+type ReviewSettings struct {
+	// After is how long a note must go unedited and unreviewed to resurface
+	After time.Duration
+	// Batch is how many notes the queue is filled up to
+	Batch int
+	// ArchiveNotebook is where archived notes are moved. An empty name
+	// turns archiving off.
+	ArchiveNotebook string
+}
+
+// Review is set from the config on start and guarded by mu
+var Review = ReviewSettings{After: 180 * 24 * time.Hour, Batch: 10, ArchiveNotebook: "Archive"}
+
+// queuedReview is a note waiting for review
+type queuedReview struct {
+	NoteID   string
+	QueuedAt time.Time
+}
+
+// reviewQueue and reviewedAt are guarded by mu
+var reviewQueue []queuedReview
+var reviewedAt = map[string]time.Time{}
+
+// ResurfaceNotes fills the review queue every interval until ctx is done
+func ResurfaceNotes(ctx context.Context, interval time.Duration) {
+	for {
+		mu.Lock()
+		resurface(time.Now())
+		mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// resurface fills the review queue up to the batch size with the notes
+// left alone the longest, leaving out archived ones. Callers must hold mu.
+func resurface(now time.Time) {
+	queued := make(map[string]bool, len(reviewQueue))
+	for _, q := range reviewQueue {
+		queued[q.NoteID] = true
+	}
+	cutoff := now.Add(-Review.After)
+	type candidate struct {
+		id      string
+		touched time.Time
+	}
+	var candidates []candidate
+	for _, note := range notes {
+		if queued[note.ID] || (Review.ArchiveNotebook != "" && note.Notebook == Review.ArchiveNotebook) {
+			continue
+		}
+		touched := note.UpdatedAt
+		if reviewed := reviewedAt[note.ID]; reviewed.After(touched) {
+			touched = reviewed
+		}
+		if touched.Before(cutoff) {
+			candidates = append(candidates, candidate{note.ID, touched})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].touched.Before(candidates[j].touched) })
+	for _, c := range candidates {
+		if len(reviewQueue) >= Review.Batch {
+			break
+		}
+		reviewQueue = append(reviewQueue, queuedReview{c.id, now})
+	}
+}
+
+// dequeueReview takes a note off the review queue. Callers must hold mu.
+func dequeueReview(id string) bool {
+	for i, q := range reviewQueue {
+		if q.NoteID == id {
+			reviewQueue = append(reviewQueue[:i], reviewQueue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Get the notes waiting for review, oldest in the queue first
+func GetReviewQueue(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	byID := make(map[string]models.Note, len(notes))
+	for _, note := range inWorkspace(c, notes) {
+		byID[note.ID] = note
+	}
+	type entry struct {
+		Note     models.Note `json:"note"`
+		QueuedAt time.Time   `json:"queued_at"`
+	}
+	list := []entry{}
+	for _, q := range reviewQueue {
+		if note, ok := byID[q.NoteID]; ok {
+			list = append(list, entry{note, q.QueuedAt})
+		}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// Act on a note in the review queue: {"action": "reviewed"} keeps it as
+// it is, "archive" moves it to the archive notebook and "delete" deletes
+// it. Either way it leaves the queue.
+func ReviewNote(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	var req struct {
+		Action string `json:"action"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Action != reviewKeep && req.Action != reviewArchive && req.Action != reviewDelete {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "action must be reviewed, archive or delete"})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if req.Action == reviewArchive && Review.ArchiveNotebook == "" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Archiving is turned off"})
+	}
+	index := -1
+	for i := range notes {
+		if notes[i].ID == id {
+			index = i
+		}
+	}
+	if index < 0 || !dequeueReview(id) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note is not queued for review"})
+	}
+	now := time.Now()
+	reviewedAt[id] = now
+
+	switch req.Action {
+	case reviewArchive:
+		note := &notes[index]
+		from := note.Notebook
+		note.Notebook = Review.ArchiveNotebook
+		note.UpdatedAt = now
+		recordChange(models.ChangeUpdate, id, note)
+		recordAudit(actorOf(c), audit.Move, id, "archived from "+from)
+		touchNotebooks(from, note.Notebook)
+		notifyNote(notify.NoteUpdated, *note)
+		return c.JSON(http.StatusOK, *note)
+	case reviewDelete:
+		removeNote(index)
+		recordAudit(actorOf(c), audit.Delete, id, "after review")
+		return c.JSON(http.StatusOK, map[string]string{"message": "Note deleted successfully"})
+	}
+	return c.JSON(http.StatusOK, notes[index])
+}
+
+// forgetReview drops the review state of a deleted note. Callers must
+// hold mu.
+func forgetReview(id string) {
+	dequeueReview(id)
+	delete(reviewedAt, id)
+}
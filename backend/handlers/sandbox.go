@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"note/backend/backup"
+	"note/backend/models"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderSandbox set to "true" moves a request into the sandbox of its API
+// key, as does ?sandbox=true
+const HeaderSandbox = "X-Notty-Sandbox"
+
+// sandboxPrefix starts the ID of every sandbox workspace. Sandboxes aren't
+// in Workspaces, so they can't be picked, joined or transferred to.
+const sandboxPrefix = "sandbox:"
+
+// SandboxEnabled lets API keys into their sandbox
+var SandboxEnabled bool
+
+var (
+	// sandboxes holds the sandboxes seeded since they were last reset,
+	// and nextSandboxReset when they are reset next. Both are guarded by
+	// mu.
+	sandboxes        = map[string]bool{}
+	nextSandboxReset time.Time
+)
+
+// sandboxRoutes are the routes open in a sandbox: those that only see the
+// notes of the request's workspace. Sharing and transferring notes would
+// reach out of it, so they stay closed.
+var sandboxRoutes = []string{
+	"/api/notes", "/api/notebooks", "/api/attachments", "/api/export",
+	"/api/stats", "/api/sync", "/api/events", "/api/graph", "/api/search",
+	"/api/inbox", "/api/review", "/api/capabilities", "/api/jobs",
+}
+
+func sandboxOf(owner string) string { return sandboxPrefix + owner }
+
+func isSandbox(ws string) bool { return strings.HasPrefix(ws, sandboxPrefix) }
+
+func wantsSandbox(c echo.Context) bool {
+	return c.Request().Header.Get(HeaderSandbox) == "true" || c.QueryParam("sandbox") == "true"
+}
+
+func sandboxAllows(path string) bool {
+	if strings.Contains(path, "/shares") || strings.Contains(path, "/transfer") {
+		return false
+	}
+	for _, prefix := range sandboxRoutes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxOwner returns the API key the request was made with, if it may
+// have a sandbox
+func sandboxOwner(c echo.Context) (string, bool, error) {
+	owner := ownerOf(c)
+	if !SandboxEnabled {
+		return "", false, c.JSON(http.StatusNotFound, map[string]string{"error": "The sandbox is not enabled"})
+	}
+	if owner == "" {
+		return "", false, c.JSON(http.StatusUnauthorized, map[string]string{"error": "The sandbox needs an API key"})
+	}
+	return owner, true, nil
+}
+
+// enterSandbox returns the sandbox of the caller's API key for the request
+// to work in, seeded with sample notes when it is new
+func enterSandbox(c echo.Context) (string, bool, error) {
+	owner, ok, err := sandboxOwner(c)
+	switch {
+	case !ok:
+		return "", false, err
+	case c.Request().Header.Get(HeaderWorkspace) != "" || c.QueryParam("workspace") != "":
+		return "", false, c.JSON(http.StatusBadRequest, map[string]string{"error": "Pick either the sandbox or a workspace"})
+	case !sandboxAllows(c.Path()):
+		return "", false, c.JSON(http.StatusForbidden, map[string]string{"error": "Not available in the sandbox"})
+	}
+	id := sandboxOf(owner)
+	mu.Lock()
+	defer mu.Unlock()
+	if !sandboxes[id] {
+		seedSandbox(id, owner)
+	}
+	return id, true, nil
+}
+
+// seedSandbox fills a sandbox with a few notes to try the API on. Callers
+// must hold mu.
+func seedSandbox(id, owner string) {
+	seed := []models.Note{
+		{
+			Title:   "Welcome to the sandbox",
+			Content: "Notes here are yours to change and delete. The sandbox is emptied every night, and these notes come back. #sandbox",
+		},
+		{
+			Title:    "Groceries",
+			Notebook: "Personal",
+			Items:    []models.TodoItem{{Text: "Milk"}, {Text: "Bread", Done: true}, {Text: "Coffee"}},
+		},
+		{
+			Title:    "Weekly sync",
+			Notebook: "Work",
+			Content:  "# Agenda\n\n- Roadmap\n- Hiring\n\nSee [[Welcome to the sandbox]]. #meetings",
+		},
+	}
+	for _, note := range seed {
+		note.Owner, note.Workspace = owner, id
+		createNote(&note)
+	}
+	sandboxes[id] = true
+}
+
+// resetSandbox deletes the notes of a sandbox, or of every sandbox for
+// "", and returns how many. Callers must hold mu.
+func resetSandbox(id string) int {
+	deleted := 0
+	for i := len(notes) - 1; i >= 0; i-- {
+		if ws := notes[i].Workspace; isSandbox(ws) && (id == "" || ws == id) {
+			removeNote(i)
+			deleted++
+		}
+	}
+	if id == "" {
+		sandboxes = map[string]bool{}
+	}
+	delete(sandboxes, id)
+	return deleted
+}
+
+// ResetSandboxes empties every sandbox at the times schedule names until
+// ctx is done
+func ResetSandboxes(ctx context.Context, schedule backup.Schedule) {
+	for {
+		next := schedule.Next(time.Now())
+		mu.Lock()
+		nextSandboxReset = next
+		mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		mu.Lock()
+		resetSandbox("")
+		mu.Unlock()
+	}
+}
+
+// Get the sandbox of the caller's API key: its workspace ID, how many
+// notes it has and when it is reset next
+func GetSandbox(c echo.Context) error {
+	owner, ok, err := sandboxOwner(c)
+	if !ok {
+		return err
+	}
+	id := sandboxOf(owner)
+	mu.Lock()
+	defer mu.Unlock()
+	count := 0
+	for _, note := range notes {
+		if note.Workspace == id {
+			count++
+		}
+	}
+	res := map[string]any{"workspace": id, "notes": count, "seeded": sandboxes[id]}
+	if !nextSandboxReset.IsZero() {
+		res["next_reset"] = nextSandboxReset
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Empty the sandbox of the caller's API key now. The sample notes are back
+// with the next request into it.
+func ResetSandbox(c echo.Context) error {
+	owner, ok, err := sandboxOwner(c)
+	if !ok {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return c.JSON(http.StatusOK, map[string]int{"deleted": resetSandbox(sandboxOf(owner))})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"note/backend/models"
+	"note/backend/sanitize"
+)
+
+// Sanitization says how notes are cleaned of markup that could run
+// scripts, when they are saved and when others see them
+var Sanitization = sanitize.DefaultConfig()
+
+// sanitized returns note with its fields cleaned as policy says.
+// Encrypted content is left alone, there is no markup to see in it.
+func sanitized(note models.Note, policy sanitize.Policy) models.Note {
+	note.Title = policy.Apply("title", note.Title)
+	if !note.ContentEncrypted {
+		note.Content = policy.Apply("content", note.Content)
+	}
+	if len(note.Items) > 0 && policy.Mode("items") != sanitize.None {
+		// A copy, the change log may still reference the items
+		items := make([]models.TodoItem, len(note.Items))
+		for i, item := range note.Items {
+			item.Text = policy.Apply("items", item.Text)
+			items[i] = item
+		}
+		note.Items = items
+	}
+	return note
+}
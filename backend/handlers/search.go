@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"note/backend/models"
+	"note/backend/search"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxSearchResults = 200
+
+// SearchIndex is kept up to date by recordChange
+var SearchIndex = search.NewIndex(search.English)
+
+// RebuildSearch rebuilds the search index from the current notes.
+// Searches are degraded until it is done.
+func RebuildSearch() {
+	mu.Lock()
+	snapshot := append([]models.Note(nil), notes...)
+	SearchIndex.StartRebuild()
+	mu.Unlock()
+	finishSearchRebuild(snapshot)
+}
+
+func finishSearchRebuild(snapshot []models.Note) {
+	if err := SearchIndex.FinishRebuild(snapshot); err != nil {
+		log.Print(err)
+	}
+}
+
+// Search notes for every word of ?q=, best matches first, up to ?limit=,
+// only in notes in the language ?lang= when given.
+// While the index is rebuilding or down, notes containing q as typed are
+// returned instead, newest first, and the response says it is degraded.
+func SearchNotes(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "q is required"})
+	}
+	limit := 50
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchResults {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be 1 to 200"})
+		}
+		limit = n
+	}
+	lang := c.QueryParam("lang")
+	if !models.ValidLanguage(lang) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lang must be a language tag like en or pt-BR"})
+	}
+
+	hits, err := SearchIndex.Search(query)
+	degraded := err != nil
+
+	mu.Lock()
+	var results []models.Note
+	if degraded {
+		results = inWorkspace(c, substringSearch(query))
+	} else {
+		byID := make(map[string]models.Note, len(notes))
+		for _, note := range inWorkspace(c, notes) {
+			byID[note.ID] = note
+		}
+		for _, hit := range hits {
+			if note, ok := byID[hit.ID]; ok {
+				results = append(results, note)
+			}
+		}
+	}
+	mu.Unlock()
+	if lang != "" {
+		kept := results[:0]
+		for _, note := range results {
+			if inLanguage(note, lang) {
+				kept = append(kept, note)
+			}
+		}
+		results = kept
+	}
+
+	total := len(results)
+	if total > limit {
+		results = results[:limit]
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"results":  append([]models.Note{}, results...),
+		"total":    total,
+		"degraded": degraded,
+	})
+}
+
+// substringSearch is the fallback of SearchNotes. Callers must hold mu.
+func substringSearch(query string) []models.Note {
+	query = strings.ToLower(query)
+	var results []models.Note
+	for _, note := range notes {
+		text := note.Title
+		if !note.ContentEncrypted {
+			text += "\n" + note.Content
+		}
+		if strings.Contains(strings.ToLower(text), query) {
+			results = append(results, note)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].UpdatedAt.After(results[j].UpdatedAt) })
+	return results
+}
+
+// Get the state of the search index; searches are degraded unless it is
+// ready
+func GetSearchStatus(c echo.Context) error {
+	status := SearchIndex.Status()
+	return c.JSON(http.StatusOK, map[string]any{
+		"index":    status,
+		"degraded": status.State != search.Ready,
+	})
+}
+
+// Rebuild the search index in the background
+func RebuildSearchIndex(c echo.Context) error {
+	go RebuildSearch()
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "Search index rebuild started"})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Log a browser in with the API key or admin token of the request. The
+// session cookie it gets stands in for the key until it logs out; its
+// state-changing requests then need the CSRF token as well.
+func CreateSession(c echo.Context) error {
+	key, ok := auth.FromContext(c)
+	if !ok || auth.BearerToken(c.Request()) == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Log in with an API key as bearer token"})
+	}
+	cookie, err := APIKeys.Sessions.Start(key)
+	if err != nil {
+		return err
+	}
+	c.SetCookie(cookie)
+	return c.JSON(http.StatusCreated, key)
+}
+
+// Log the browser out by ending its session
+func DeleteSession(c echo.Context) error {
+	c.SetCookie(APIKeys.Sessions.End(c.Request()))
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out"})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"note/backend/redact"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// shares are keyed by token and guarded by mu like the notes they point to
+var shares = map[string]models.Share{}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sharedNote finds the note a share token points to. Callers must hold mu.
+func sharedNote(token string) (models.Note, bool) {
+	share, ok := shares[token]
+	if !ok {
+		return models.Note{}, false
+	}
+	for _, note := range notes {
+		if note.ID == share.NoteID {
+			return note, true
+		}
+	}
+	return models.Note{}, false
+}
+
+// redacted returns note as others see it through a share link, the
+// public API or a feed: without the sections its owner marked private
+// and sanitized for rendering
+func redacted(note models.Note) models.Note {
+	if !note.ContentEncrypted {
+		note.Content = redact.Content(note.Content, note.PrivateSections)
+	}
+	note.PrivateSections = nil
+	return sanitized(note, Sanitization.Render)
+}
+
+// Create a share link for a note
+func CreateShare(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	token, err := newShareToken()
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, note := range notes {
+		if note.ID == id {
+			share := models.Share{Token: token, NoteID: id, CreatedAt: time.Now()}
+			shares[token] = share
+			recordAudit(actorOf(c), audit.Share, id, "")
+			notifyNote(notify.NoteShared, note)
+			return c.JSON(http.StatusCreated, share)
+		}
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+}
+
+// Create a share link for the caller's notes in a notebook of the
+// workspace. Its feed at /share/:token/feed.atom lets anyone follow the
+// notebook. Only API keys own notes to share this way.
+func CreateNotebookShare(c echo.Context) error {
+	owner := ownerOf(c)
+	if owner == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Notebooks are shared with an API key"})
+	}
+	token, err := newShareToken()
+	if err != nil {
+		return err
+	}
+	name := c.Param("notebook")
+	mu.Lock()
+	defer mu.Unlock()
+	for _, note := range notes {
+		if note.Notebook == name && note.Owner == owner && note.Workspace == workspaceOf(c) {
+			share := models.Share{Token: token, Notebook: name, Owner: owner, Workspace: workspaceOf(c), CreatedAt: time.Now()}
+			shares[token] = share
+			recordAudit(actorOf(c), audit.Share, "", "notebook "+name)
+			return c.JSON(http.StatusCreated, share)
+		}
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Notebook not found"})
+}
+
+// List the share links of a notebook
+func GetNotebookShares(c echo.Context) error {
+	name := c.Param("notebook")
+	owner := ownerOf(c)
+	mu.Lock()
+	defer mu.Unlock()
+	list := []models.Share{}
+	for _, share := range shares {
+		if share.NoteID == "" && share.Notebook == name && share.Owner == owner && share.Workspace == workspaceOf(c) {
+			list = append(list, share)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return c.JSON(http.StatusOK, list)
+}
+
+// sharedNotebook returns the notes a notebook share link gives access to,
+// or false if the token isn't one. Callers must hold mu.
+func sharedNotebook(token string) (models.Share, []models.Note, bool) {
+	share, ok := shares[token]
+	if !ok || share.NoteID != "" {
+		return models.Share{}, nil, false
+	}
+	var list []models.Note
+	for _, note := range notes {
+		if note.Notebook == share.Notebook && note.Owner == share.Owner && note.Workspace == share.Workspace {
+			list = append(list, note)
+		}
+	}
+	return share, list, true
+}
+
+// List the share links of a note
+func GetShares(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	list := []models.Share{}
+	for _, share := range shares {
+		if share.NoteID == id {
+			list = append(list, share)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return c.JSON(http.StatusOK, list)
+}
+
+// Revoke a share link of the workspace. Only the owner of the shared note
+// or notebook and the workspace's admins can.
+func DeleteShare(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	share, ok := shares[c.Param("token")]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Share not found"})
+	}
+	ws, owner := share.Workspace, share.Owner
+	if share.NoteID != "" {
+		note, _ := sharedNote(c.Param("token"))
+		ws, owner = note.Workspace, note.Owner
+	}
+	if ws != workspaceOf(c) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Share not found"})
+	}
+	if owner != ownerOf(c) && !workspaceAdmin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the owner of what is shared can revoke the share"})
+	}
+	delete(shares, c.Param("token"))
+	revokedShares++
+	detail := ""
+	if share.NoteID == "" {
+		detail = "notebook " + share.Notebook
+	}
+	recordAudit(actorOf(c), audit.Unshare, share.NoteID, detail)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Share revoked successfully"})
+}
+
+// deleteShares drops the share links of a deleted note. Callers must hold mu.
+func deleteShares(id string) {
+	for token, share := range shares {
+		if share.NoteID == id {
+			delete(shares, token)
+		}
+	}
+}
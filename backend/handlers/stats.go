@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"note/backend/models"
+	"note/backend/stats"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultActivityDays = 365
+	maxActivityDays     = 3 * 366
+)
+
+// noteCounts counts the words of a note: its title, content and checklist
+// items. Encrypted content can't be read, so it doesn't count.
+func noteCounts(note models.Note) stats.Counts {
+	counts := stats.Text(note.Title)
+	if !note.ContentEncrypted {
+		counts = counts.Add(stats.Text(note.Content))
+	}
+	for _, item := range note.Items {
+		counts = counts.Add(stats.Text(item.Text))
+	}
+	return counts
+}
+
+// NoteTags returns the hashtags of a note, only those of its title when
+// its content is encrypted
+func NoteTags(note models.Note) []string {
+	if note.ContentEncrypted {
+		return stats.Tags(note.Title)
+	}
+	return stats.Tags(note.Title + "\n" + note.Content)
+}
+
+type noteStats struct {
+	ID string `json:"id"`
+	stats.Counts
+	Items     int `json:"items"`
+	OpenItems int `json:"open_items"`
+	// Revisions is how many versions of the note the change log has, at
+	// least 1
+	Revisions        int       `json:"revisions"`
+	Tags             []string  `json:"tags"`
+	ContentEncrypted bool      `json:"content_encrypted,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Get the word and character count, reading time and revisions of a note
+func GetNoteStats(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, note := range notes {
+		if note.ID != id {
+			continue
+		}
+		res := noteStats{
+			ID:               id,
+			Counts:           noteCounts(note),
+			Items:            len(note.Items),
+			Tags:             NoteTags(note),
+			ContentEncrypted: note.ContentEncrypted,
+			CreatedAt:        note.CreatedAt,
+			UpdatedAt:        note.UpdatedAt,
+		}
+		for _, item := range note.Items {
+			if !item.Done {
+				res.OpenItems++
+			}
+		}
+		for _, change := range changes {
+			if change.NoteID == id && change.Op != models.ChangeDelete {
+				res.Revisions++
+			}
+		}
+		res.Revisions = max(res.Revisions, 1) // e.g. restored from a backup
+		if res.Tags == nil {
+			res.Tags = []string{}
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+}
+
+type notebookCounts struct {
+	Name  string `json:"name"`
+	Notes int    `json:"notes"`
+	Words int    `json:"words"`
+}
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Notes int    `json:"notes"`
+}
+
+// Get statistics of the notes of the workspace: their words, the notes
+// and words per notebook, the notes per hashtag, and a series of notes
+// created per day for a heatmap, over the last ?days= days (365 by
+// default) in the time zone ?tz= (UTC by default)
+func GetStats(c echo.Context) error {
+	days := defaultActivityDays
+	if v := c.QueryParam("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxActivityDays {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("days must be 1 to %d", maxActivityDays)})
+		}
+		days = n
+	}
+	loc := time.UTC
+	if tz := c.QueryParam("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown time zone " + tz})
+		}
+	}
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	ws := workspaceOf(c)
+	// The series moves on at midnight as well as with every change
+	etag := fmt.Sprintf(`"stats-%s-%d-%s-%d-%s"`, ws, lastSeq, now.In(loc).Format(time.DateOnly), days, loc)
+	if notModified(c, etag, time.Time{}) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	var total stats.Counts
+	count := 0
+	byNotebook := map[string]*notebookCounts{}
+	byTag := map[string]int{}
+	var created []time.Time
+	for _, note := range notes {
+		if note.Workspace != ws {
+			continue
+		}
+		count++
+		counts := noteCounts(note)
+		total = total.Add(counts)
+		nb := byNotebook[note.Notebook]
+		if nb == nil {
+			nb = &notebookCounts{Name: note.Notebook}
+			byNotebook[note.Notebook] = nb
+		}
+		nb.Notes++
+		nb.Words += counts.Words
+		for _, tag := range NoteTags(note) {
+			byTag[tag]++
+		}
+		created = append(created, note.CreatedAt)
+	}
+
+	notebooks := make([]notebookCounts, 0, len(byNotebook))
+	for _, nb := range byNotebook {
+		notebooks = append(notebooks, *nb)
+	}
+	sort.Slice(notebooks, func(i, j int) bool { return notebooks[i].Name < notebooks[j].Name })
+	tags := make([]tagCount, 0, len(byTag))
+	for tag, n := range byTag {
+		tags = append(tags, tagCount{tag, n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Notes != tags[j].Notes {
+			return tags[i].Notes > tags[j].Notes
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"notes":           count,
+		"words":           total.Words,
+		"characters":      total.Characters,
+		"reading_minutes": total.ReadingMinutes,
+		"notebooks":       notebooks,
+		"tags":            tags,
+		"activity":        stats.Activity(created, now, days, loc),
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"note/backend/status"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Health reports the health of the instance for its status page
+var Health = func(context.Context) status.Health { return status.Health{Components: []status.Component{}} }
+
+// StatusTitle heads the status page
+var StatusTitle = "Notty status"
+
+const maxIncidentTitle = 200
+
+// incidents are those posted by admins, guarded by mu
+var incidents []status.Incident
+
+// statusPage puts the status page together
+func statusPage(c echo.Context) status.Page {
+	health := Health(c.Request().Context())
+	mu.Lock()
+	list := append([]status.Incident(nil), incidents...)
+	mu.Unlock()
+	return status.NewPage(StatusTitle, health, list, time.Now())
+}
+
+// Serve the status page: uptime, component health and recent incidents
+func GetStatusPage(c echo.Context) error {
+	nonce, err := newShareToken()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if err := status.Render(&body, statusPage(c), nonce); err != nil {
+		return err
+	}
+	header := c.Response().Header()
+	header.Set("Content-Security-Policy", "default-src 'none'; style-src 'nonce-"+nonce+"'; frame-ancestors 'none'")
+	header.Set("Cache-Control", "no-store")
+	return c.HTMLBlob(http.StatusOK, body.Bytes())
+}
+
+// Serve the status page as JSON
+func GetStatusJSON(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, statusPage(c))
+}
+
+// List the incidents, newest first, resolved ones included
+func GetIncidents(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	list := []status.Incident{}
+	for i := len(incidents) - 1; i >= 0; i-- {
+		list = append(list, incidents[i])
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+type incidentRequest struct {
+	Title      *string    `json:"title"`
+	Message    *string    `json:"message"`
+	Impact     *string    `json:"impact"`
+	Components []string   `json:"components"`
+	StartedAt  *time.Time `json:"started_at"`
+	Resolved   *bool      `json:"resolved"`
+}
+
+// apply sets the fields the request has on inc and checks the result
+func (req incidentRequest) apply(inc *status.Incident) string {
+	if req.Title != nil {
+		inc.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Message != nil {
+		inc.Message = *req.Message
+	}
+	if req.Impact != nil {
+		inc.Impact = *req.Impact
+	}
+	if req.Components != nil {
+		inc.Components = req.Components
+	}
+	if req.StartedAt != nil {
+		inc.StartedAt = *req.StartedAt
+	}
+	if req.Resolved != nil && *req.Resolved != !inc.Open() {
+		inc.ResolvedAt = nil
+		if *req.Resolved {
+			now := time.Now()
+			inc.ResolvedAt = &now
+		}
+	}
+	switch {
+	case inc.Title == "":
+		return "title is required"
+	case len(inc.Title) > maxIncidentTitle:
+		return "title is too long"
+	case !status.ValidImpact(inc.Impact):
+		return "impact must be minor, major or maintenance"
+	}
+	return ""
+}
+
+// Post an incident to the status page. It is open until resolved with
+// {"resolved": true}; started_at defaults to now.
+func CreateIncident(c echo.Context) error {
+	var req incidentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	inc := status.Incident{ID: uuid.NewString(), StartedAt: time.Now()}
+	if msg := req.apply(&inc); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	mu.Lock()
+	incidents = append(incidents, inc)
+	mu.Unlock()
+	return c.JSON(http.StatusCreated, inc)
+}
+
+// Change an incident, e.g. to post an update in its message or resolve
+// it. Fields left out stay as they are.
+func UpdateIncident(c echo.Context) error {
+	var req incidentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, inc := range incidents {
+		if inc.ID != c.Param("id") {
+			continue
+		}
+		if msg := req.apply(&inc); msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+		}
+		incidents[i] = inc
+		return c.JSON(http.StatusOK, inc)
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Incident not found"})
+}
+
+// Take an incident off the status page
+func DeleteIncident(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, inc := range incidents {
+		if inc.ID == c.Param("id") {
+			incidents = append(incidents[:i], incidents[i+1:]...)
+			return c.NoContent(http.StatusNoContent)
+		}
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Incident not found"})
+}
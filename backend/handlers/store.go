@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/auth"
+	"note/backend/geo"
+	"note/backend/models"
+	"note/backend/workspace"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrNotFound      = errors.New("note not found")
+	ErrTitleRequired = errors.New("title is required")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor is older than the change log")
+	ErrNoteLimit     = errors.New("note limit reached")
+	ErrNoteTooLarge  = errors.New("note is too large")
+	ErrStorageLimit  = errors.New("storage quota exceeded")
+	ErrBadLocation   = errors.New("location is not on the earth")
+	ErrBadLanguage   = errors.New("language is not a language tag")
+	ErrBadReminder   = errors.New("reminder schedule is invalid")
+	ErrConflict      = errors.New("note was changed since the version given")
+	ErrReadOnly      = errors.New("notes can only be read here")
+)
+
+// Store is the Repository that keeps notes in package state, so the REST
+// handlers and other APIs like gRPC all follow the same rules. Every
+// method holds mu for its whole duration, which makes concurrent calls
+// safe.
+type Store struct {
+	// Actor is who writes go on record as in the audit log, e.g. the
+	// API key of a request. It is audit.System when empty.
+	Actor string
+	// Workspace is the only workspace the store sees notes of, and the
+	// one it creates notes in. Empty is the default workspace.
+	Workspace string
+	// ReadOnly refuses writes with ErrReadOnly, for viewers and read keys
+	ReadOnly bool
+}
+
+func (s Store) actor() string {
+	if s.Actor == "" {
+		return audit.System
+	}
+	return s.Actor
+}
+
+// List returns every note of the workspace, or only those with open
+// checklist items, and the change sequence the list reflects
+func (s Store) List(openTasks bool) ([]models.Note, int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	list := []models.Note{}
+	for _, note := range notes {
+		if note.Workspace == s.Workspace && (!openTasks || note.HasOpenItems()) {
+			list = append(list, note)
+		}
+	}
+	return list, lastSeq
+}
+
+// Get returns the note with the given ID
+func (s Store) Get(id string) (models.Note, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, note := range notes {
+		if note.ID == id && note.Workspace == s.Workspace {
+			return note, nil
+		}
+	}
+	return models.Note{}, ErrNotFound
+}
+
+// storeError answers a request the store refused
+func storeError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	case errors.Is(err, ErrTitleRequired):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Title is required"})
+	case errors.Is(err, ErrBadLocation):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Location needs a lat of -90 to 90 and a lng of -180 to 180"})
+	case errors.Is(err, ErrBadLanguage):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Language must be a language tag like en or pt-BR"})
+	case errors.Is(err, ErrBadReminder):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrReadOnly):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Viewers can't make changes in this workspace"})
+	case errors.Is(err, ErrConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "The note was changed since"})
+	case errors.Is(err, ErrNoteLimit), errors.Is(err, ErrNoteTooLarge), errors.Is(err, ErrStorageLimit):
+		return limitResponse(c, err)
+	}
+	return err
+}
+
+// Create stores a new note and returns it with its server-generated fields
+func (s Store) Create(note models.Note) (models.Note, error) {
+	if s.ReadOnly {
+		return models.Note{}, ErrReadOnly
+	}
+	note.Workspace = s.Workspace
+	// Sanitized first, a title of nothing but a script is no title
+	note = sanitized(note, Sanitization.Save)
+	if note.Title == "" {
+		return models.Note{}, ErrTitleRequired
+	}
+	if note.Location != nil && !note.Location.Valid() {
+		return models.Note{}, ErrBadLocation
+	}
+	if !models.ValidLanguage(note.Language) {
+		return models.Note{}, ErrBadLanguage
+	}
+	if err := scheduleReminder(&note, time.Now()); err != nil {
+		return models.Note{}, err
+	}
+	note.CopiedFrom = ""
+	mu.Lock()
+	defer mu.Unlock()
+	if err := checkLimits(note, ""); err != nil {
+		return models.Note{}, err
+	}
+	createNote(&note)
+	recordAudit(s.actor(), audit.Create, note.ID, "")
+	return note, nil
+}
+
+// Update replaces the note with the given ID
+func (s Store) Update(id string, note models.Note) (models.Note, error) {
+	return s.UpdateIfMatch(id, note, "")
+}
+
+// UpdateIfMatch is Update for a client that read the note with one of the
+// ETags in ifMatch, an If-Match header. If the note was written since,
+// it is left alone and returned as it is now with ErrConflict. An empty
+// ifMatch matches any version.
+func (s Store) UpdateIfMatch(id string, note models.Note, ifMatch string) (models.Note, error) {
+	if s.ReadOnly {
+		return models.Note{}, ErrReadOnly
+	}
+	note = sanitized(note, Sanitization.Save)
+	if note.Title == "" {
+		return models.Note{}, ErrTitleRequired
+	}
+	if note.Location != nil && !note.Location.Valid() {
+		return models.Note{}, ErrBadLocation
+	}
+	if !models.ValidLanguage(note.Language) {
+		return models.Note{}, ErrBadLanguage
+	}
+	if err := scheduleReminder(&note, time.Now()); err != nil {
+		return models.Note{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !s.has(id) {
+		return models.Note{}, ErrNotFound
+	}
+	if ifMatch != "" {
+		for _, current := range notes {
+			if current.ID == id && !matchesNote(ifMatch, current) {
+				return current, ErrConflict
+			}
+		}
+	}
+	if err := checkLimits(note, id); err != nil {
+		return models.Note{}, err
+	}
+	if !updateNote(id, &note) {
+		return models.Note{}, ErrNotFound
+	}
+	recordAudit(s.actor(), audit.Update, id, "")
+	return note, nil
+}
+
+// Delete removes the note with the given ID
+func (s Store) Delete(id string) error {
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, note := range notes {
+		if note.ID == id && note.Workspace == s.Workspace {
+			removeNote(i)
+			recordAudit(s.actor(), audit.Delete, id, "")
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// has reports whether the workspace has a note with the given ID.
+// Callers must hold mu.
+func (s Store) has(id string) bool {
+	for _, note := range notes {
+		if note.ID == id {
+			return note.Workspace == s.Workspace
+		}
+	}
+	return false
+}
+
+// Watch returns the changes to notes of the workspace after since and a
+// channel that is closed on the next change. Deletes don't say which
+// workspace the note was in, so every delete is among them. Once since
+// falls out of the change log, e.g. after a restore, it fails with
+// ErrCursorExpired.
+func (s Store) Watch(since int64) ([]models.Change, <-chan struct{}, error) {
+	pending, changed, err := watchChanges(since)
+	kept := pending[:0]
+	for _, change := range pending {
+		if change, ok := change.In(s.Workspace); ok {
+			kept = append(kept, change)
+		}
+	}
+	return kept, changed, err
+}
+
+// watchChanges is Watch for changes in every workspace
+func watchChanges(since int64) ([]models.Change, <-chan struct{}, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	firstSeq := lastSeq + 1
+	if len(changes) > 0 {
+		firstSeq = changes[0].Seq
+	}
+	if since < 0 || since > lastSeq {
+		return nil, nil, ErrInvalidCursor
+	}
+	if since < firstSeq-1 {
+		return nil, nil, ErrCursorExpired
+	}
+	pending := append([]models.Change(nil), changes[since-firstSeq+1:]...)
+	return pending, changed, nil
+}
+
+// Nearby returns the notes of the workspace with a location within
+// radius meters of center, nearest first
+func (s Store) Nearby(center geo.Point, radius float64) []NearbyNote {
+	mu.Lock()
+	defer mu.Unlock()
+	hits := locations.Near(center, radius)
+	byID := make(map[string]int, len(notes))
+	for i, note := range notes {
+		if note.Workspace == s.Workspace {
+			byID[note.ID] = i
+		}
+	}
+	nearby := make([]NearbyNote, 0, len(hits))
+	for _, hit := range hits {
+		if i, ok := byID[hit.ID]; ok {
+			nearby = append(nearby, NearbyNote{notes[i], hit.Distance})
+		}
+	}
+	return nearby
+}
+
+// storeOf returns the repository of the workspace WorkspaceScope let the
+// request into, read-only unless the caller may change notes there
+func storeOf(c echo.Context) Repository {
+	role, _ := c.Get(roleContextKey).(workspace.Role)
+	key, ok := auth.FromContext(c)
+	return Repositories(Scope{
+		Actor:     actorOf(c),
+		Workspace: workspaceOf(c),
+		ReadOnly:  !role.Grants(workspace.Editor) || (ok && !key.HasRole(auth.ScopeReadWrite)),
+	})
+}
+
+type storeContextKey struct{}
+
+// errUnscoped is returned for a request that didn't come through ServeScoped
+var errUnscoped = errors.New("request is not scoped to a workspace")
+
+// ServeScoped serves h with the repository of the request's workspace in
+// the request context, for APIs like GraphQL that StoreFrom it there
+func ServeScoped(h http.Handler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := c.Request()
+		h.ServeHTTP(c.Response(), r.WithContext(context.WithValue(r.Context(), storeContextKey{}, storeOf(c))))
+		return nil
+	}
+}
+
+// StoreFrom returns the repository ServeScoped put in ctx
+func StoreFrom(ctx context.Context) (Repository, error) {
+	s, ok := ctx.Value(storeContextKey{}).(Repository)
+	if !ok {
+		return nil, errUnscoped
+	}
+	return s, nil
+}
+
+// StoreFor returns the repository of an API key's secret in a workspace, for
+// APIs outside of HTTP like gRPC, with the rules RequireAPIKey and
+// WorkspaceScope apply to HTTP requests. An empty secret is let in
+// unless keys are required. It fails with auth.ErrInvalidToken,
+// auth.ErrDisabledToken or workspace.ErrNotFound.
+func StoreFor(secret, id string, required bool, adminSecret, actor string) (Repository, error) {
+	var key auth.Token
+	if secret != "" || required {
+		var err error
+		if key, err = auth.Authenticate(APIKeys, adminSecret, secret); err != nil {
+			return nil, err
+		}
+		actor = key.ID
+	}
+	role, ok := roleOf(key, id)
+	if !ok {
+		return nil, workspace.ErrNotFound
+	}
+	readOnly := !role.Grants(workspace.Editor) || (key.ID != "" && !key.HasRole(auth.ScopeReadWrite))
+	return Repositories(Scope{Actor: actor, Workspace: id, ReadOnly: readOnly}), nil
+}
@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"errors"
+	"fmt"
+	"note/backend/backup"
+	"note/backend/handlers"
+	"note/backend/models"
+	"note/backend/storetest"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		handlers.ChangeLog{}.Restore(nil, backup.State{}, 0)
+		return handlers.MemoryRepository(handlers.Scope{Actor: "test"})
+	})
+}
+
+func TestStoreWorkspaces(t *testing.T) {
+	handlers.ChangeLog{}.Restore(nil, backup.State{}, 0)
+	team, other := handlers.Store{Workspace: "team"}, handlers.Store{Workspace: "other"}
+	_, since := team.List(false)
+	note, err := team.Create(models.Note{Title: "Plans", Workspace: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Workspace != "team" {
+		t.Errorf("note created in workspace %q, want the store's", note.Workspace)
+	}
+	if list, _ := other.List(false); len(list) != 0 {
+		t.Errorf("another workspace lists %+v", list)
+	}
+	if _, err := other.Get(note.ID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get from another workspace: err = %v, want ErrNotFound", err)
+	}
+	if _, err := other.Update(note.ID, models.Note{Title: "Taken"}); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Update from another workspace: err = %v, want ErrNotFound", err)
+	}
+	if err := other.Delete(note.ID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Delete from another workspace: err = %v, want ErrNotFound", err)
+	}
+	if pending, _, err := other.Watch(since); err != nil || len(pending) != 0 {
+		t.Errorf("another workspace watched %+v, %v", pending, err)
+	}
+	if pending, _, err := team.Watch(since); err != nil || len(pending) != 1 {
+		t.Errorf("the workspace watched %+v, %v; want the create", pending, err)
+	}
+	if got, err := team.Get(note.ID); err != nil || got.Title != "Plans" {
+		t.Errorf("Get = %+v, %v; want the note untouched", got, err)
+	}
+}
+
+func TestStoreReadOnly(t *testing.T) {
+	handlers.ChangeLog{}.Restore(nil, backup.State{}, 0)
+	note, err := handlers.Store{}.Create(models.Note{Title: "Shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewer := handlers.Store{ReadOnly: true}
+	if _, err := viewer.Get(note.ID); err != nil {
+		t.Errorf("Get: %v", err)
+	}
+	if _, err := viewer.Create(models.Note{Title: "Mine"}); !errors.Is(err, handlers.ErrReadOnly) {
+		t.Errorf("Create: err = %v, want ErrReadOnly", err)
+	}
+	if _, err := viewer.Update(note.ID, models.Note{Title: "Changed"}); !errors.Is(err, handlers.ErrReadOnly) {
+		t.Errorf("Update: err = %v, want ErrReadOnly", err)
+	}
+	if err := viewer.Delete(note.ID); !errors.Is(err, handlers.ErrReadOnly) {
+		t.Errorf("Delete: err = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestStoreUpdateIfMatch(t *testing.T) {
+	handlers.ChangeLog{}.Restore(nil, backup.State{}, 0)
+	s := handlers.Store{}
+	note, err := s.Create(models.Note{Title: "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := s.Update(note.ID, models.Note{Title: "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.UpdateIfMatch(note.ID, models.Note{Title: "v3"}, etagOf(note))
+	if !errors.Is(err, handlers.ErrConflict) || got.Title != "v2" {
+		t.Errorf("UpdateIfMatch(stale) = %q, %v; want the current note and ErrConflict", got.Title, err)
+	}
+	if _, err := s.UpdateIfMatch(note.ID, models.Note{Title: "v3"}, etagOf(current)); err != nil {
+		t.Errorf("UpdateIfMatch(current): %v", err)
+	}
+}
+
+// etagOf is the ETag GetNote sends for a version of a note
+func etagOf(note models.Note) string {
+	return fmt.Sprintf(`"%s-%d"`, note.ID, note.UpdatedAt.UnixNano())
+}
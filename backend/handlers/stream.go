@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"note/backend/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const streamFlushEvery = 100
+
+// Ways ?stream= can ask for a listing to be written
+const (
+	streamOff   = ""
+	streamArray = "true"  // a JSON array, written note by note
+	streamLines = "jsonl" // one JSON note per line
+)
+
+// streamMode reads ?stream=. It reports false for values it doesn't know.
+func streamMode(c echo.Context) (string, bool) {
+	switch mode := c.QueryParam("stream"); mode {
+	case streamOff, "false":
+		return streamOff, true
+	case streamArray, streamLines:
+		return mode, true
+	}
+	return "", false
+}
+
+// streamNotes encodes one note at a time and flushes every
+// streamFlushEvery notes, so large listings never sit in memory as a
+// whole response. Callers must not hold mu; a slow client would block
+// every write.
+func streamNotes(c echo.Context, list []models.Note, mode string) error {
+	res := c.Response()
+	if mode == streamLines {
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	} else {
+		res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	res.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(res)
+	if mode == streamArray {
+		if _, err := res.Write([]byte("[")); err != nil {
+			return err
+		}
+	}
+	for i, note := range list {
+		if i > 0 && mode == streamArray {
+			if _, err := res.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(note); err != nil {
+			return err
+		}
+		if (i+1)%streamFlushEvery == 0 {
+			res.Flush()
+		}
+	}
+	if mode == streamArray {
+		if _, err := res.Write([]byte("]\n")); err != nil {
+			return err
+		}
+	}
+	res.Flush()
+	return nil
+}
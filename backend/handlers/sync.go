@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"note/backend/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultSyncLimit = 500
+
+// syncResponse tells a client how to bring its copy up to Cursor. When
+// Reset is set the client must drop everything it has and take Notes as
+// the complete set.
+type syncResponse struct {
+	Cursor  int64         `json:"cursor"`
+	Reset   bool          `json:"reset,omitempty"`
+	Notes   []models.Note `json:"notes"`
+	Deleted []string      `json:"deleted"`
+	HasMore bool          `json:"has_more"`
+}
+
+// Sync returns what changed after the ?since= cursor. Pass the returned
+// cursor on the next call; keep calling while has_more is true.
+func Sync(c echo.Context) error {
+	var since int64
+	if v := c.QueryParam("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseInt(v, 10, 64); err != nil || since < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cursor"})
+		}
+	}
+	limit := defaultSyncLimit
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+		}
+		limit = min(n, defaultSyncLimit)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The change log only goes back to the last restart or restore. A
+	// cursor from before that can't be served incrementally, nor can one
+	// past the end, which a client kept from before a restore took the
+	// sequence back.
+	firstSeq := lastSeq + 1
+	if len(changes) > 0 {
+		firstSeq = changes[0].Seq
+	}
+	if since == 0 || since > lastSeq || since < firstSeq-1 {
+		return c.JSON(http.StatusOK, syncResponse{
+			Cursor:  lastSeq,
+			Reset:   true,
+			Notes:   inWorkspace(c, notes),
+			Deleted: []string{},
+		})
+	}
+
+	pending := changes[since-firstSeq+1:]
+	res := syncResponse{Cursor: lastSeq, Notes: []models.Note{}, Deleted: []string{}}
+	if len(pending) > limit {
+		pending = pending[:limit]
+		res.Cursor = pending[len(pending)-1].Seq
+		res.HasMore = true
+	}
+
+	// Only the latest state of each note in the workspace matters to the
+	// client
+	latest := make(map[string]models.Change)
+	var order []string
+	for _, change := range pending {
+		change, ok := change.In(workspaceOf(c))
+		if !ok {
+			continue
+		}
+		if _, seen := latest[change.NoteID]; !seen {
+			order = append(order, change.NoteID)
+		}
+		latest[change.NoteID] = change
+	}
+	for _, id := range order {
+		// Clients ignore the IDs of deleted notes they don't have
+		if change := latest[id]; change.Op == models.ChangeDelete {
+			res.Deleted = append(res.Deleted, id)
+		} else {
+			res.Notes = append(res.Notes, *change.Note)
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// listETag is the ETag of the note list of a workspace at change seq.
+// Sequences start over when the process does and go back on a restore,
+// so the epoch of the change log keeps an old ETag from matching a list
+// that merely has the same sequence.
+func listETag(workspace string, seq int64) string {
+	if workspace == "" {
+		return fmt.Sprintf(`"notes-%s-%d"`, epoch, seq)
+	}
+	return fmt.Sprintf(`"notes-%s-%s-%d"`, epoch, workspace, seq)
+}
+
+// parseListETag returns the change sequence of an ETag listETag made for
+// the workspace, or of a sorted or paged list of it. An ETag of an
+// earlier epoch gives 0, which nothing is newer than.
+func parseListETag(etag, workspace string) (int64, bool) {
+	etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+	rest, ok := strings.CutPrefix(etag, "notes-")
+	if !ok {
+		return 0, false
+	}
+	from, rest, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	if workspace != "" {
+		if rest, ok = strings.CutPrefix(rest, workspace+"-"); !ok {
+			return 0, false
+		}
+	}
+	rest, _, _ = strings.Cut(rest, "-")
+	seq, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false
+	}
+	if from != epoch {
+		return 0, true
+	}
+	return seq, true
+}
+
+// diffResponse lists the IDs of the notes that changed since an ETag of
+// the note list. When Reset is set the log doesn't go back that far and
+// Changed holds every note.
+type diffResponse struct {
+	ETag    string   `json:"etag"`
+	Reset   bool     `json:"reset,omitempty"`
+	Changed []string `json:"changed"`
+	Deleted []string `json:"deleted"`
+}
+
+// GetNotesDiff returns the IDs of the notes created, updated or deleted
+// since the ?etag= of the note list, from GetNotes or an earlier diff,
+// and the ETag to pass next time. Polling clients fetch only the notes
+// that changed; when nothing did the answer is a few bytes.
+func GetNotesDiff(c echo.Context) error {
+	ws := workspaceOf(c)
+	var since int64
+	if v := c.QueryParam("etag"); v != "" {
+		var ok bool
+		if since, ok = parseListETag(v, ws); !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid etag"})
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if since > lastSeq {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid etag"})
+	}
+	res := diffResponse{ETag: listETag(ws, lastSeq), Changed: []string{}, Deleted: []string{}}
+	c.Response().Header().Set("ETag", res.ETag)
+
+	firstSeq := lastSeq + 1
+	if len(changes) > 0 {
+		firstSeq = changes[0].Seq
+	}
+	if since == 0 || since < firstSeq-1 {
+		res.Reset = true
+		for _, note := range notes {
+			if note.Workspace == ws {
+				res.Changed = append(res.Changed, note.ID)
+			}
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+
+	latest := make(map[string]models.Change)
+	var order []string
+	for _, change := range changes[since-firstSeq+1:] {
+		change, ok := change.In(ws)
+		if !ok {
+			continue
+		}
+		if _, seen := latest[change.NoteID]; !seen {
+			order = append(order, change.NoteID)
+		}
+		latest[change.NoteID] = change
+	}
+	for _, id := range order {
+		if latest[id].Op == models.ChangeDelete {
+			res.Deleted = append(res.Deleted, id)
+		} else {
+			res.Changed = append(res.Changed, id)
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"note/backend/tasks"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// noteTask is a task line with the note it is in
+type noteTask struct {
+	tasks.Task
+	NoteID    string `json:"note_id"`
+	NoteTitle string `json:"note_title"`
+	Notebook  string `json:"notebook,omitempty"`
+}
+
+// List the "- [ ]" task lines in the notes of the workspace, those due
+// soonest first. ?done=true or false picks finished or open tasks.
+// ?due=overdue, today, week (the next seven days), none or any picks by
+// due date, as does a YYYY-MM-DD date for the tasks due by then; today is
+// in the time zone ?tz= (UTC by default).
+func GetTasks(c echo.Context) error {
+	var done *bool
+	switch c.QueryParam("done") {
+	case "":
+	case "true", "false":
+		v := c.QueryParam("done") == "true"
+		done = &v
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "done must be true or false"})
+	}
+	loc := time.UTC
+	if tz := c.QueryParam("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown time zone " + tz})
+		}
+	}
+	now := time.Now().In(loc)
+	today, week := now.Format(time.DateOnly), now.AddDate(0, 0, 7).Format(time.DateOnly)
+	var due func(tasks.Task) bool
+	switch param := c.QueryParam("due"); param {
+	case "":
+	case "overdue":
+		due = func(t tasks.Task) bool { return t.Due != "" && t.Due < today }
+	case "today":
+		due = func(t tasks.Task) bool { return t.Due == today }
+	case "week":
+		due = func(t tasks.Task) bool { return t.Due >= today && t.Due < week }
+	case "none":
+		due = func(t tasks.Task) bool { return t.Due == "" }
+	case "any":
+		due = func(t tasks.Task) bool { return t.Due != "" }
+	default:
+		if _, err := time.Parse(time.DateOnly, param); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "due must be overdue, today, week, none, any or a YYYY-MM-DD date"})
+		}
+		due = func(t tasks.Task) bool { return t.Due != "" && t.Due <= param }
+	}
+
+	mu.Lock()
+	list := []noteTask{}
+	for _, note := range inWorkspace(c, notes) {
+		if note.ContentEncrypted {
+			continue
+		}
+		for _, t := range tasks.Parse(note.Content) {
+			if (done == nil || t.Done == *done) && (due == nil || due(t)) {
+				list = append(list, noteTask{Task: t, NoteID: note.ID, NoteTitle: note.Title, Notebook: note.Notebook})
+			}
+		}
+	}
+	mu.Unlock()
+	// Tasks without a due date go last, the others by it; those due the
+	// same day keep the order of their notes and lines
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].Due, list[j].Due
+		return a != b && (b == "" || (a != "" && a < b))
+	})
+	return c.JSON(http.StatusOK, list)
+}
+
+type updateTaskRequest struct {
+	Done *bool `json:"done"`
+}
+
+// Check a task line of a note off, or back on, with {"done": true|false};
+// without done it is toggled. The note's content is changed in place. A
+// task whose text was edited meanwhile is no longer found by its ID.
+func UpdateTask(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	var req updateTaskRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, note := range notes {
+		if note.ID != id {
+			continue
+		}
+		if note.ContentEncrypted {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "The tasks of encrypted notes can't be changed on the server"})
+		}
+		var task tasks.Task
+		for _, t := range tasks.Parse(note.Content) {
+			if t.ID == c.Param("taskId") {
+				task = t
+			}
+		}
+		done := !task.Done
+		if req.Done != nil {
+			done = *req.Done
+		}
+		content, task, err := tasks.SetDone(note.Content, c.Param("taskId"), done)
+		if errors.Is(err, tasks.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Task not found"})
+		}
+		if content != note.Content {
+			note.Content = content
+			note.UpdatedAt = time.Now()
+			notes[i] = note
+			recordChange(models.ChangeUpdate, id, &note)
+			recordAudit(actorOf(c), audit.Update, id, "task "+task.ID)
+			touchNotebooks(note.Notebook)
+			notifyNote(notify.NoteUpdated, note)
+		}
+		return c.JSON(http.StatusOK, noteTask{Task: task, NoteID: note.ID, NoteTitle: note.Title, Notebook: note.Notebook})
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+}
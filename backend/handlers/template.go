@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/templates"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// noteTemplates is guarded by mu. Names are unique.
+var noteTemplates []models.Template
+
+// templateIndex returns the index of the template with the given name or
+// ID, or -1. Callers must hold mu.
+func templateIndex(match func(models.Template) bool) int {
+	for i, t := range noteTemplates {
+		if match(t) {
+			return i
+		}
+	}
+	return -1
+}
+
+// List every template
+func GetTemplates(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return c.JSON(http.StatusOK, append([]models.Template{}, noteTemplates...))
+}
+
+// Create a template
+func CreateTemplate(c echo.Context) error {
+	t := new(models.Template)
+	if err := c.Bind(t); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if t.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Name is required"})
+	}
+	t.ID = uuid.NewString()
+	t.Pack = ""
+	t.Items = models.NormalizeItems(t.Items)
+	t.CreatedAt = time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if templateIndex(func(other models.Template) bool { return other.Name == t.Name }) >= 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "A template with this name exists"})
+	}
+	noteTemplates = append(noteTemplates, *t)
+	return c.JSON(http.StatusCreated, t)
+}
+
+// Delete a template by ID
+func DeleteTemplate(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	i := templateIndex(func(t models.Template) bool { return t.ID == c.Param("id") })
+	if i < 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Template not found"})
+	}
+	noteTemplates = append(noteTemplates[:i], noteTemplates[i+1:]...)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Template deleted successfully"})
+}
+
+// Create a note from a template
+func CreateNoteFromTemplate(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	i := templateIndex(func(t models.Template) bool { return t.ID == c.Param("id") })
+	if i < 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Template not found"})
+	}
+	t := noteTemplates[i]
+	note := &models.Note{Title: t.Title, Content: t.Content, Notebook: t.Notebook, Owner: ownerOf(c), Workspace: workspaceOf(c)}
+	for _, item := range t.Items {
+		note.Items = append(note.Items, models.TodoItem{Text: item.Text, Position: item.Position})
+	}
+	*note = sanitized(*note, Sanitization.Save)
+	if note.Title == "" {
+		note.Title = Sanitization.Save.Apply("title", t.Name)
+	}
+	if err := checkLimits(*note, ""); err != nil {
+		return limitResponse(c, err)
+	}
+	createNote(note)
+	recordAudit(actorOf(c), audit.Create, note.ID, "from template "+t.Name)
+	return c.JSON(http.StatusCreated, note)
+}
+
+// Export templates as a template pack, all of them or those listed in
+// ?ids=, named by ?name=
+func ExportTemplates(c echo.Context) error {
+	name := c.QueryParam("name")
+	if name == "" {
+		name = "Notty templates"
+	}
+	var ids map[string]bool
+	if param := c.QueryParam("ids"); param != "" {
+		ids = map[string]bool{}
+		for _, id := range strings.Split(param, ",") {
+			ids[id] = true
+		}
+	}
+
+	mu.Lock()
+	var list []models.Template
+	for _, t := range noteTemplates {
+		if ids == nil || ids[t.ID] {
+			list = append(list, t)
+		}
+	}
+	mu.Unlock()
+	if len(list) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No templates to export"})
+	}
+	pack := templates.New(name, list)
+	pack.Author = c.QueryParam("author")
+	pack.Description = c.QueryParam("description")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "templates.json"))
+	return c.JSON(http.StatusOK, pack)
+}
+
+// Import a template pack. Templates whose name is taken are skipped, or
+// with ?conflict=replace replace the existing one, or with
+// ?conflict=rename are imported under a new name.
+func ImportTemplates(c echo.Context) error {
+	conflict := c.QueryParam("conflict")
+	switch conflict {
+	case "":
+		conflict = "skip"
+	case "skip", "replace", "rename":
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "conflict must be skip, replace or rename"})
+	}
+	pack, err := templates.Decode(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid template pack: " + err.Error()})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	imported := []models.Template{}
+	skipped := []string{}
+	for _, pt := range pack.Templates {
+		t := pt.Model(pack.Name)
+		t.ID = uuid.NewString()
+		t.Items = models.NormalizeItems(t.Items)
+		t.CreatedAt = time.Now()
+		i := templateIndex(func(other models.Template) bool { return other.Name == t.Name })
+		switch {
+		case i < 0:
+			noteTemplates = append(noteTemplates, t)
+		case conflict == "replace":
+			t.ID = noteTemplates[i].ID
+			noteTemplates[i] = t
+		case conflict == "rename":
+			t.Name = freeTemplateName(t.Name)
+			noteTemplates = append(noteTemplates, t)
+		default:
+			skipped = append(skipped, t.Name)
+			continue
+		}
+		imported = append(imported, t)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"imported": imported, "skipped": skipped})
+}
+
+// freeTemplateName returns name with the lowest suffix " (2)", " (3)"...
+// no template has. Callers must hold mu.
+func freeTemplateName(name string) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		if templateIndex(func(t models.Template) bool { return t.Name == candidate }) < 0 {
+			return candidate
+		}
+	}
+}
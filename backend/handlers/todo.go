@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// updateItemRequest changes only the fields that are set
+type updateItemRequest struct {
+	Text     *string `json:"text"`
+	Done     *bool   `json:"done"`
+	Position *int    `json:"position"`
+}
+
+// Toggle, rename or move a single checklist item
+func UpdateItem(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	req := new(updateItemRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, note := range notes {
+		if note.ID != id {
+			continue
+		}
+		// Work on a copy, the change log still references the old items
+		items := append([]models.TodoItem(nil), note.Items...)
+		index := -1
+		for j, item := range items {
+			if item.ID == c.Param("itemId") {
+				index = j
+			}
+		}
+		if index < 0 {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Item not found"})
+		}
+
+		if req.Text != nil {
+			items[index].Text = Sanitization.Save.Apply("items", *req.Text)
+		}
+		if req.Done != nil {
+			items[index].Done = *req.Done
+		}
+		if req.Position != nil {
+			if *req.Position < 0 || *req.Position >= len(items) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid position"})
+			}
+			items = models.MoveItem(items, index, *req.Position)
+		}
+
+		note.Items = items
+		note.UpdatedAt = time.Now()
+		notes[i] = note
+		recordChange(models.ChangeUpdate, id, &note)
+		recordAudit(actorOf(c), audit.Update, id, "item "+items[index].ID)
+		touchNotebooks(note.Notebook)
+		notifyNote(notify.NoteUpdated, note)
+		return c.JSON(http.StatusOK, note)
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+}
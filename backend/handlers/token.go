@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Tokens holds the API tokens handed out by CreateToken
+var Tokens = auth.NewTokenStore()
+
+type createTokenRequest struct {
+	Name     string `json:"name"`
+	Notebook string `json:"notebook"`
+	Scope    string `json:"scope"` // read:published if empty, read:calendar or read:feed
+}
+
+// Create a read-only token for published notes, or for the calendar or
+// Atom feed of the caller's notes. Tokens are made with an API key, which
+// owns them. The secret is only returned in this response.
+func CreateToken(c echo.Context) error {
+	if _, ok, err := keyManager(c); !ok {
+		return err
+	}
+	req := new(createTokenRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Name is required"})
+	}
+	switch req.Scope {
+	case "":
+		req.Scope = auth.ScopeReadPublished
+	case auth.ScopeReadPublished, auth.ScopeReadCalendar, auth.ScopeReadFeed:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Scope must be read:published, read:calendar or read:feed"})
+	}
+	token, secret, err := Tokens.Create(req.Name, req.Scope, req.Notebook, ownerOf(c), workspaceOf(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"token": secret, "info": token})
+}
+
+// List the tokens the caller owns, or every token for admins, without
+// their secrets
+func GetTokens(c echo.Context) error {
+	key, ok, err := keyManager(c)
+	if !ok {
+		return err
+	}
+	list := []auth.Token{}
+	for _, token := range Tokens.List() {
+		if manages(key, token) {
+			list = append(list, token)
+		}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// Revoke a token the caller owns by ID
+func DeleteToken(c echo.Context) error {
+	key, ok, err := keyManager(c)
+	if !ok {
+		return err
+	}
+	owned := false
+	for _, token := range Tokens.List() {
+		if token.ID == c.Param("id") {
+			owned = manages(key, token)
+		}
+	}
+	if !owned {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Token not found"})
+	}
+	ok, err = Tokens.Revoke(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Token not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Token revoked successfully"})
+}
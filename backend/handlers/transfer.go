@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"note/backend/workspace"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// transferTTL is how long a transfer waits for its recipient
+const transferTTL = 7 * 24 * time.Hour
+
+// transfers are keyed by ID and guarded by mu
+var transfers = map[string]*models.Transfer{}
+
+type transferRequest struct {
+	ToUser      string `json:"to_user"`
+	ToWorkspace string `json:"to_workspace"`
+}
+
+// Offer a note to another user or workspace. It moves once the recipient
+// accepts, right away when the caller may accept for them.
+func CreateTransfer(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	return createTransfer(c, func(note models.Note) bool { return note.ID == id }, "")
+}
+
+// Offer the caller's notes in a notebook to another user or workspace
+func CreateNotebookTransfer(c echo.Context) error {
+	name, owner := c.Param("notebook"), ownerOf(c)
+	return createTransfer(c, func(note models.Note) bool { return note.Notebook == name && note.Owner == owner }, name)
+}
+
+func createTransfer(c echo.Context, picks func(models.Note) bool, notebook string) error {
+	var req transferRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.ToUser == "" && req.ToWorkspace == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Transfer to_user, to_workspace or both"})
+	}
+	if req.ToUser != "" && !apiKeyExists(req.ToUser) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+	}
+	if req.ToWorkspace != "" {
+		if _, err := Workspaces.Get(req.ToWorkspace); err != nil || req.ToWorkspace == workspaceOf(c) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "to_workspace must be another workspace"})
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	t := &models.Transfer{
+		ID:            uuid.NewString(),
+		Notebook:      notebook,
+		FromWorkspace: workspaceOf(c),
+		ToUser:        req.ToUser,
+		ToWorkspace:   req.ToWorkspace,
+		Status:        models.TransferPending,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(transferTTL),
+	}
+	for _, note := range notes {
+		if note.Workspace != t.FromWorkspace || !picks(note) {
+			continue
+		}
+		if !mayTransfer(c, note) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the owner of a note can transfer it"})
+		}
+		if len(t.NoteIDs) > 0 && note.Owner != t.From {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Notes of different owners are transferred separately"})
+		}
+		t.From = note.Owner
+		t.NoteIDs = append(t.NoteIDs, note.ID)
+	}
+	switch {
+	case len(t.NoteIDs) == 0 && notebook != "":
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Notebook not found"})
+	case len(t.NoteIDs) == 0:
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	case (req.ToUser == "" || req.ToUser == t.From) && req.ToWorkspace == "":
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The notes already belong to that user"})
+	}
+
+	pruneTransfers(now)
+	if mayAccept(c, t) {
+		if err := acceptTransfer(c, t); err != nil {
+			return transferError(c, err)
+		}
+		transfers[t.ID] = t
+		return c.JSON(http.StatusOK, t)
+	}
+	transfers[t.ID] = t
+	return c.JSON(http.StatusCreated, t)
+}
+
+// pruneTransfers forgets transfers decided or expired more than
+// transferTTL ago. Callers must hold mu.
+func pruneTransfers(now time.Time) {
+	for id, t := range transfers {
+		end := t.ExpiresAt
+		if t.DecidedAt != nil {
+			end = *t.DecidedAt
+		}
+		if now.Sub(end) > transferTTL {
+			delete(transfers, id)
+		}
+	}
+}
+
+// transferError answers a request whose transfer acceptTransfer refused
+func transferError(c echo.Context, err error) error {
+	if errors.Is(err, errTransferNotMember) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "The recipient has to be an editor of the workspace first"})
+	}
+	return limitResponse(c, err)
+}
+
+// mayTransfer reports whether the caller may give a note away: it is
+// theirs, or they run its workspace or the instance
+func mayTransfer(c echo.Context, note models.Note) bool {
+	if note.Owner == ownerOf(c) || isAdmin(c) {
+		return true
+	}
+	role, ok := workspaceRole(c, note.Workspace)
+	return ok && note.Workspace != workspace.Default && role.Grants(workspace.Admin)
+}
+
+// mayAccept reports whether the caller may accept a transfer: it is to
+// them, or to a workspace they may create notes in
+func mayAccept(c echo.Context, t *models.Transfer) bool {
+	if t.ToUser != "" {
+		return t.ToUser == ownerOf(c)
+	}
+	role, ok := workspaceRole(c, t.ToWorkspace)
+	return ok && role.Grants(workspace.Editor)
+}
+
+// acceptTransfer moves the notes of a transfer that are still where they
+// were offered from. Their IDs, history and attachments stay the same;
+// their share links are revoked, since the new owner didn't make them.
+// Callers must hold mu.
+func acceptTransfer(c echo.Context, t *models.Transfer) error {
+	if t.ToUser != "" && t.ToWorkspace != "" {
+		if role, ok := Workspaces.Role(t.ToWorkspace, t.ToUser); !ok || !role.Grants(workspace.Editor) {
+			return errTransferNotMember
+		}
+	}
+	moving := map[string]bool{}
+	for _, id := range t.NoteIDs {
+		moving[id] = true
+	}
+	var moved []int
+	for i, note := range notes {
+		if moving[note.ID] && note.Owner == t.From && note.Workspace == t.FromWorkspace {
+			moved = append(moved, i)
+		}
+	}
+	if err := checkTransferLimits(t.ToUser, moved); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	detail := "to user " + t.ToUser
+	if t.ToWorkspace != "" {
+		detail = "to workspace " + t.ToWorkspace
+	}
+	for _, i := range moved {
+		note := &notes[i]
+		if t.ToUser != "" {
+			note.Owner = t.ToUser
+		}
+		note.UpdatedAt = now
+		if t.ToWorkspace != "" && t.ToWorkspace != note.Workspace {
+			from := note.Workspace
+			note.Workspace = t.ToWorkspace
+			recordMove(note, from)
+		} else {
+			recordChange(models.ChangeUpdate, note.ID, note)
+		}
+		touchNotebooks(note.Notebook)
+		for token, share := range shares {
+			if share.NoteID == note.ID {
+				delete(shares, token)
+				revokedShares++
+			}
+		}
+		recordAudit(actorOf(c), audit.Transfer, note.ID, detail)
+		notifyNote(notify.NoteUpdated, *note)
+		t.Moved = append(t.Moved, note.ID)
+	}
+	t.Status, t.DecidedAt = models.TransferAccepted, &now
+	return nil
+}
+
+var errTransferNotMember = errors.New("the recipient isn't an editor of the workspace")
+
+// checkTransferLimits reports whether the notes at the given indexes fit
+// under the instance limits and the quota of the user they go to, who is
+// their owner already when they only move to another workspace. Callers
+// must hold mu.
+func checkTransferLimits(to string, indexes []int) error {
+	quota := Limits.PerUser
+	for _, i := range indexes {
+		size, owner := noteSize(notes[i]), to
+		if owner == "" {
+			owner = notes[i].Owner
+		}
+		if Limits.MaxNoteSize > 0 && size > Limits.MaxNoteSize || owner != "" && quota.MaxNoteSize > 0 && size > quota.MaxNoteSize {
+			return ErrNoteTooLarge
+		}
+	}
+	if to == "" || quota == (Quota{}) {
+		return nil
+	}
+	usage := usageOf(to)
+	for _, i := range indexes {
+		if notes[i].Owner == to {
+			continue
+		}
+		usage.Notes++
+		usage.StorageBytes += noteSize(notes[i]) + attachmentBytes(notes[i].ID)
+	}
+	switch {
+	case quota.MaxNotes > 0 && usage.Notes > quota.MaxNotes:
+		return ErrNoteLimit
+	case quota.MaxStorage > 0 && usage.StorageBytes > quota.MaxStorage:
+		return ErrStorageLimit
+	}
+	return nil
+}
+
+// expire marks a pending transfer past its time as expired. Callers must
+// hold mu.
+func expire(t *models.Transfer, now time.Time) {
+	if t.Status == models.TransferPending && now.After(t.ExpiresAt) {
+		t.Status = models.TransferExpired
+	}
+}
+
+// List the transfers the caller sent and those waiting for them to accept
+func GetTransfers(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	incoming, outgoing := []models.Transfer{}, []models.Transfer{}
+	for _, t := range transfers {
+		expire(t, now)
+		if t.From == ownerOf(c) {
+			outgoing = append(outgoing, *t)
+		}
+		if t.Status == models.TransferPending && mayAccept(c, t) {
+			incoming = append(incoming, *t)
+		}
+	}
+	for _, list := range [][]models.Transfer{incoming, outgoing} {
+		sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	}
+	return c.JSON(http.StatusOK, map[string][]models.Transfer{"incoming": incoming, "outgoing": outgoing})
+}
+
+// pendingTransfer returns the transfer of the :transferId parameter if it
+// is still pending. Callers must hold mu.
+func pendingTransfer(c echo.Context) (*models.Transfer, bool, error) {
+	t, ok := transfers[c.Param("transferId")]
+	if !ok {
+		return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "Transfer not found"})
+	}
+	expire(t, time.Now())
+	if t.Status != models.TransferPending {
+		return nil, false, c.JSON(http.StatusConflict, map[string]string{"error": "Transfer is " + t.Status})
+	}
+	return t, true, nil
+}
+
+// Accept a transfer to the caller or a workspace they edit
+func AcceptTransfer(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	t, ok, err := pendingTransfer(c)
+	if !ok {
+		return err
+	}
+	if !mayAccept(c, t) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the recipient can accept a transfer"})
+	}
+	if err := acceptTransfer(c, t); err != nil {
+		return transferError(c, err)
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+// Decline a transfer to the caller
+func DeclineTransfer(c echo.Context) error {
+	return decideTransfer(c, models.TransferDeclined, mayAccept, "Only the recipient can decline a transfer")
+}
+
+// Cancel a transfer the caller sent
+func CancelTransfer(c echo.Context) error {
+	sender := func(c echo.Context, t *models.Transfer) bool { return t.From == ownerOf(c) || isAdmin(c) }
+	return decideTransfer(c, models.TransferCanceled, sender, "Only the sender can cancel a transfer")
+}
+
+func decideTransfer(c echo.Context, status string, may func(echo.Context, *models.Transfer) bool, forbidden string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	t, ok, err := pendingTransfer(c)
+	if !ok {
+		return err
+	}
+	if !may(c, t) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": forbidden})
+	}
+	now := time.Now()
+	t.Status, t.DecidedAt = status, &now
+	return c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"note/backend/audit"
+	"note/backend/models"
+	"note/backend/notify"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// trash holds the notes merged into others, in the order they were
+// trashed, until they are restored or purged. It is guarded by mu.
+var trash []trashedNote
+
+type trashedNote struct {
+	models.Note
+	TrashedAt  time.Time `json:"trashed_at"`
+	MergedInto string    `json:"merged_into,omitempty"`
+}
+
+// trashNote moves the note at index i to the trash. What hangs off it
+// goes like on a delete, so callers move what should outlive the note
+// first. Callers must hold mu.
+func trashNote(i int, mergedInto string) {
+	trash = append(trash, trashedNote{Note: notes[i], TrashedAt: time.Now(), MergedInto: mergedInto})
+	removeNote(i)
+}
+
+// trashed returns the index of a note in the trash of a workspace, or -1.
+// Callers must hold mu.
+func trashed(id, workspace string) int {
+	for i, t := range trash {
+		if t.ID == id && t.Workspace == workspace {
+			return i
+		}
+	}
+	return -1
+}
+
+// List the notes in the trash, most recently trashed first
+func GetTrash(c echo.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	list := []trashedNote{}
+	for i := len(trash) - 1; i >= 0; i-- {
+		if trash[i].Workspace == workspaceOf(c) {
+			list = append(list, trash[i])
+		}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// Restore a note from the trash as it was when it was trashed. Content it
+// was merged into stays in the other note.
+func RestoreNote(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	i := trashed(id, workspaceOf(c))
+	if i < 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found in the trash"})
+	}
+	note := trash[i].Note
+	if err := checkLimits(note, ""); err != nil {
+		return limitResponse(c, err)
+	}
+	trash = append(trash[:i], trash[i+1:]...)
+	note.UpdatedAt = time.Now()
+	notes = append(notes, note)
+	recordChange(models.ChangeCreate, note.ID, &note)
+	touchNotebooks(note.Notebook)
+	notifyNote(notify.NoteCreated, note)
+	recordAudit(actorOf(c), audit.Restore, note.ID, "from the trash")
+	return c.JSON(http.StatusOK, note)
+}
+
+// Delete a note in the trash for good
+func PurgeNote(c echo.Context) error {
+	id, ok := noteID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	i := trashed(id, workspaceOf(c))
+	if i < 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found in the trash"})
+	}
+	trash = append(trash[:i], trash[i+1:]...)
+	recordAudit(actorOf(c), audit.Delete, id, "from the trash")
+	return c.JSON(http.StatusOK, map[string]string{"message": "Note deleted successfully"})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note/backend/notify"
+	"note/backend/webhook"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Webhooks delivers note events to registered URLs
+var Webhooks = webhook.NewManager()
+
+type createWebhookRequest struct {
+	URL    string             `json:"url"`
+	Events []notify.EventType `json:"events"`
+}
+
+// Register a webhook for the note events of the workspace. The signing
+// secret is only returned in this response.
+func CreateWebhook(c echo.Context) error {
+	req := new(createWebhookRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	hook, err := Webhooks.Register(req.URL, req.Events, workspaceOf(c))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, hook)
+}
+
+// List registered webhooks
+func GetWebhooks(c echo.Context) error {
+	return c.JSON(http.StatusOK, Webhooks.List(workspaceOf(c)))
+}
+
+// Remove a webhook
+func DeleteWebhook(c echo.Context) error {
+	if err := Webhooks.Delete(c.Param("id"), workspaceOf(c)); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook deleted successfully"})
+}
+
+// Show the latest delivery attempts of a webhook
+func GetWebhookDeliveries(c echo.Context) error {
+	deliveries, err := Webhooks.Deliveries(c.Param("id"), workspaceOf(c))
+	if errors.Is(err, webhook.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
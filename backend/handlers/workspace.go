@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note/backend/auth"
+	"note/backend/models"
+	"note/backend/workspace"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Workspaces keeps the workspaces teams share the instance in
+var Workspaces = workspace.NewStore()
+
+// HeaderWorkspace picks the workspace a request works in, as does
+// ?workspace=. Without either it is the default workspace.
+const HeaderWorkspace = "X-Notty-Workspace"
+
+const (
+	workspaceContextKey = "workspace"
+	roleContextKey      = "workspace.role"
+	defaultInviteTTL    = 7 * 24 * time.Hour
+	maxInviteTTL        = 30 * 24 * time.Hour
+)
+
+// workspaceOf returns the workspace WorkspaceScope let the request into
+func workspaceOf(c echo.Context) string {
+	id, _ := c.Get(workspaceContextKey).(string)
+	return id
+}
+
+// workspaceRole returns the role of the caller in a workspace
+func workspaceRole(c echo.Context, id string) (workspace.Role, bool) {
+	key, _ := auth.FromContext(c)
+	return roleOf(key, id)
+}
+
+// roleOf returns the role of an API key in a workspace, with the zero
+// Token for callers without one. Instance admins own every workspace.
+func roleOf(key auth.Token, id string) (workspace.Role, bool) {
+	if id != workspace.Default && key.HasRole(auth.ScopeAdmin) {
+		_, err := Workspaces.Get(id)
+		return workspace.Owner, err == nil
+	}
+	owner := key.ID
+	if owner == auth.AdminTokenID {
+		owner = ""
+	}
+	return Workspaces.Role(id, owner)
+}
+
+// WorkspaceScope lets requests into the workspace they pick if the caller
+// is a member, with viewers only reading. Notes and attachments of other
+// workspaces are then not found by their ID. Managing workspaces,
+// accepting invitations, deciding on transfers and managing the sandbox
+// happens outside of any, whatever is picked. Sandbox requests work in
+// the sandbox of their API key. Copies to another workspace name it with
+// ?workspace=, so only the header picks theirs.
+func WorkspaceScope(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		for _, prefix := range []string{"/api/workspaces", "/api/invitations", "/api/transfers", "/api/sandbox"} {
+			if strings.HasPrefix(c.Path(), prefix) {
+				return next(c)
+			}
+		}
+		var id string
+		role := workspace.Owner
+		if wantsSandbox(c) {
+			var ok bool
+			var err error
+			if id, ok, err = enterSandbox(c); !ok {
+				return err
+			}
+		} else {
+			id = c.Request().Header.Get(HeaderWorkspace)
+			if id == "" && c.Path() != copyToPath {
+				id = c.QueryParam("workspace")
+			}
+			var ok bool
+			if role, ok = workspaceRole(c, id); !ok {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+			}
+		}
+		if !role.Grants(workspace.Editor) && !safeMethod(c.Request().Method) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Viewers can't make changes in this workspace"})
+		}
+		c.Set(workspaceContextKey, id)
+		c.Set(roleContextKey, role)
+
+		mu.Lock()
+		owner, found := "", false
+		switch {
+		case strings.HasPrefix(c.Path(), "/api/notes/:id"):
+			if noteID, ok := noteID(c); ok {
+				for _, note := range notes {
+					if note.ID == noteID {
+						owner, found = note.Workspace, true
+					}
+				}
+			}
+		case strings.HasPrefix(c.Path(), "/api/attachments/:attachmentId"):
+			if a, ok := attachment(c); ok {
+				for _, note := range notes {
+					if note.ID == a.NoteID {
+						owner, found = note.Workspace, true
+					}
+				}
+			}
+		}
+		mu.Unlock()
+		if found && owner != id {
+			if strings.HasPrefix(c.Path(), "/api/attachments/") {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Attachment not found"})
+			}
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+		}
+		return next(c)
+	}
+}
+
+// workspaceAdmin reports whether the caller administers the workspace
+// WorkspaceScope let the request into. Instance admins administer the
+// default one.
+func workspaceAdmin(c echo.Context) bool {
+	if workspaceOf(c) == workspace.Default {
+		return isAdmin(c)
+	}
+	role, _ := c.Get(roleContextKey).(workspace.Role)
+	return role.Grants(workspace.Admin)
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// inWorkspace returns the notes of list in the request's workspace
+func inWorkspace(c echo.Context, list []models.Note) []models.Note {
+	id := workspaceOf(c)
+	scoped := list[:0:0]
+	for _, note := range list {
+		if note.Workspace == id {
+			scoped = append(scoped, note)
+		}
+	}
+	return scoped
+}
+
+// workspaceError answers a request the workspace store refused
+func workspaceError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, workspace.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+	case errors.Is(err, workspace.ErrInviteNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Invitation not found"})
+	case errors.Is(err, workspace.ErrNotMember):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Member not found"})
+	case errors.Is(err, workspace.ErrLastOwner):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "A workspace needs an owner; make someone else owner first"})
+	case errors.Is(err, workspace.ErrNameRequired), errors.Is(err, workspace.ErrBadRole), errors.Is(err, workspace.ErrBadInvitation):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return err
+}
+
+// requireWorkspaceRole looks up the :workspace route parameter and checks
+// the caller has at least role in it. It reports false once it answered
+// the request.
+func requireWorkspaceRole(c echo.Context, role workspace.Role) (workspace.Role, bool, error) {
+	have, ok := workspaceRole(c, c.Param("workspace"))
+	if !ok || c.Param("workspace") == workspace.Default {
+		return "", false, c.JSON(http.StatusNotFound, map[string]string{"error": "Workspace not found"})
+	}
+	if !have.Grants(role) {
+		return "", false, c.JSON(http.StatusForbidden, map[string]string{"error": "This takes the " + string(role) + " role in the workspace"})
+	}
+	return have, true, nil
+}
+
+type workspaceRequest struct {
+	Name string `json:"name"`
+	// Attachments restricts what may be attached in the workspace, on top
+	// of the instance's policy; an empty policy leaves just that
+	Attachments *AttachmentPolicy `json:"attachments,omitempty"`
+}
+
+// workspaceResponse is a workspace with, for its admins, its own
+// attachment policy
+type workspaceResponse struct {
+	workspace.Workspace
+	Attachments *AttachmentPolicy `json:"attachments,omitempty"`
+}
+
+func workspaceResponseOf(ws workspace.Workspace, role workspace.Role) workspaceResponse {
+	res := workspaceResponse{Workspace: ws}
+	if role.Grants(workspace.Admin) {
+		mu.Lock()
+		policy := workspaceAttachments[ws.ID]
+		mu.Unlock()
+		res.Attachments = &policy
+	}
+	return res
+}
+
+// Create a workspace, owned by the API key creating it
+func CreateWorkspace(c echo.Context) error {
+	var req workspaceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	user := ownerOf(c)
+	if user == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Workspaces are created with an API key, which becomes their owner"})
+	}
+	ws, err := Workspaces.Create(req.Name, user)
+	if err != nil {
+		return workspaceError(c, err)
+	}
+	return c.JSON(http.StatusCreated, ws)
+}
+
+// List the workspaces of the caller; admins see all of them
+func GetWorkspaces(c echo.Context) error {
+	if isAdmin(c) {
+		return c.JSON(http.StatusOK, Workspaces.List(""))
+	}
+	user := ownerOf(c)
+	if user == "" {
+		return c.JSON(http.StatusOK, []workspace.Workspace{})
+	}
+	return c.JSON(http.StatusOK, Workspaces.List(user))
+}
+
+// Get a workspace the caller is a member of
+func GetWorkspace(c echo.Context) error {
+	role, ok, err := requireWorkspaceRole(c, workspace.Viewer)
+	if !ok {
+		return err
+	}
+	ws, err := Workspaces.Get(c.Param("workspace"))
+	if err != nil {
+		return workspaceError(c, err)
+	}
+	return c.JSON(http.StatusOK, workspaceResponseOf(ws, role))
+}
+
+// Rename a workspace or set its attachment policy
+func UpdateWorkspace(c echo.Context) error {
+	role, ok, err := requireWorkspaceRole(c, workspace.Admin)
+	if !ok {
+		return err
+	}
+	var req workspaceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	id := c.Param("workspace")
+	if req.Attachments != nil {
+		if err := req.Attachments.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	var ws workspace.Workspace
+	if req.Name != "" || req.Attachments == nil {
+		ws, err = Workspaces.Rename(id, req.Name)
+	} else {
+		ws, err = Workspaces.Get(id)
+	}
+	if err != nil {
+		return workspaceError(c, err)
+	}
+	if req.Attachments != nil {
+		mu.Lock()
+		if len(req.Attachments.AllowedTypes) == 0 && req.Attachments.MaxSize == 0 {
+			delete(workspaceAttachments, id)
+		} else {
+			workspaceAttachments[id] = *req.Attachments
+		}
+		mu.Unlock()
+	}
+	return c.JSON(http.StatusOK, workspaceResponseOf(ws, role))
+}
+
+// Delete a workspace. Its notes have to be deleted first.
+func DeleteWorkspace(c echo.Context) error {
+	_, ok, err := requireWorkspaceRole(c, workspace.Owner)
+	if !ok {
+		return err
+	}
+	id := c.Param("workspace")
+	mu.Lock()
+	defer mu.Unlock()
+	for _, note := range notes {
+		if note.Workspace == id {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Workspace still has notes"})
+		}
+	}
+	if err := Workspaces.Delete(id); err != nil {
+		return workspaceError(c, err)
+	}
+	delete(workspaceAttachments, id)
+	kept := trash[:0]
+	for _, t := range trash {
+		if t.Workspace != id {
+			kept = append(kept, t)
+		}
+	}
+	trash = kept
+	return c.JSON(http.StatusOK, map[string]string{"message": "Workspace deleted successfully"})
+}
+
+type memberRequest struct {
+	Role workspace.Role `json:"role"`
+}
+
+// Add an API key to a workspace or change its role. Only owners make or
+// unmake owners.
+func SetWorkspaceMember(c echo.Context) error {
+	have, ok, err := requireWorkspaceRole(c, workspace.Admin)
+	if !ok {
+		return err
+	}
+	var req memberRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	id, user := c.Param("workspace"), c.Param("user")
+	current, _ := Workspaces.Role(id, user)
+	if (req.Role == workspace.Owner || current == workspace.Owner) && have != workspace.Owner {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only owners can change owners"})
+	}
+	if !apiKeyExists(user) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+	}
+	ws, err := Workspaces.SetRole(id, user, req.Role)
+	if err != nil {
+		return workspaceError(c, err)
+	}
+	return c.JSON(http.StatusOK, ws)
+}
+
+// Remove a member from a workspace. Members may always leave.
+func RemoveWorkspaceMember(c echo.Context) error {
+	id, user := c.Param("workspace"), c.Param("user")
+	if user != ownerOf(c) || user == "" {
+		have, ok, err := requireWorkspaceRole(c, workspace.Admin)
+		if !ok {
+			return err
+		}
+		if current, _ := Workspaces.Role(id, user); current == workspace.Owner && have != workspace.Owner {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Only owners can change owners"})
+		}
+	}
+	ws, err := Workspaces.RemoveMember(id, user)
+	if err != nil {
+		return workspaceError(c, err)
+	}
+	return c.JSON(http.StatusOK, ws)
+}
+
+type invitationRequest struct {
+	Role      workspace.Role `json:"role"`
+	ExpiresIn string         `json:"expires_in"` // like 48h; a week if empty
+}
+
+// Invite someone to a workspace. The code to accept it with is only
+// returned in this response.
+func CreateInvitation(c echo.Context) error {
+	have, ok, err := requireWorkspaceRole(c, workspace.Admin)
+	if !ok {
+		return err
+	}
+	var req invitationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON"})
+	}
+	if req.Role == "" {
+		req.Role = workspace.Editor
+	}
+	if req.Role == workspace.Owner && have != workspace.Owner {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only owners can invite owners"})
+	}
+	ttl := defaultInviteTTL
+	if req.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 || ttl > maxInviteTTL {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in must be a duration up to 720h"})
+		}
+	}
+	inv, code, err := Workspaces.Invite(c.Param("workspace"), req.Role, ownerOf(c), ttl)
+	if err != nil {
+		return workspaceError(c, err)
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"code": code, "invitation": inv})
+}
+
+// List the open invitations to a workspace
+func GetInvitations(c echo.Context) error {
+	_, ok, err := requireWorkspaceRole(c, workspace.Admin)
+	if !ok {
+		return err
+	}
+	return c.JSON(http.StatusOK, Workspaces.Invitations(c.Param("workspace")))
+}
+
+// Withdraw an invitation
+func DeleteInvitation(c echo.Context) error {
+	_, ok, err := requireWorkspaceRole(c, workspace.Admin)
+	if !ok {
+		return err
+	}
+	if err := Workspaces.Revoke(c.Param("workspace"), c.Param("invitationId")); err != nil {
+		return workspaceError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Invitation revoked successfully"})
+}
+
+// Join the workspace of an invitation with the caller's API key
+func AcceptInvitation(c echo.Context) error {
+	user := ownerOf(c)
+	if user == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Invitations are accepted with an API key"})
+	}
+	ws, err := Workspaces.Accept(c.Param("code"), user)
+	if err != nil {
+		return workspaceError(c, err)
+	}
+	return c.JSON(http.StatusOK, ws)
+}
+
+func apiKeyExists(id string) bool {
+	for _, key := range APIKeys.List() {
+		if key.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can
+// subscribe to
+package ical
+
+import (
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar is a feed of events
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Event is a point in time with a reminder at its start
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Start       time.Time
+	Duration    time.Duration
+	Modified    time.Time
+}
+
+const stampFormat = "20060102T150405Z"
+
+// Write writes the calendar with CRLF line endings and long lines folded
+func (c Calendar) Write(w io.Writer) error {
+	var b strings.Builder
+	line := func(name, value string) {
+		b.WriteString(fold(name + ":" + value))
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Notty//Notes//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", e.Modified.UTC().Format(stampFormat))
+		line("LAST-MODIFIED", e.Modified.UTC().Format(stampFormat))
+		line("DTSTART", e.Start.UTC().Format(stampFormat))
+		line("DTEND", e.Start.Add(e.Duration).UTC().Format(stampFormat))
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		line("BEGIN", "VALARM")
+		line("ACTION", "DISPLAY")
+		line("DESCRIPTION", escape(e.Summary))
+		line("TRIGGER", "PT0M")
+		line("END", "VALARM")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escape quotes the characters that are special in TEXT values
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// fold ends a content line, continuing lines longer than 75 octets on
+// the next line after a space, without splitting UTF-8 characters
+func fold(line string) string {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,81 @@
+// Package idcodec maps internal note IDs to the IDs shown in public URLs
+// and back. Share links don't need it: their tokens are random already.
+package idcodec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Codec turns internal IDs into public ones and back. Decode reports
+// false for strings Encode can't have returned.
+type Codec interface {
+	Encode(id string) string
+	Decode(public string) (string, bool)
+}
+
+// Plain shows internal IDs as they are
+type Plain struct{}
+
+func (Plain) Encode(id string) string { return id }
+
+func (Plain) Decode(public string) (string, bool) { return public, public != "" }
+
+const alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ" // as math/big writes base 62
+
+// encodedLen is how many base62 digits a 128-bit number takes
+const encodedLen = 22
+
+// Hashid hides UUIDs behind short opaque strings. Each UUID is encrypted
+// as one AES block under a key derived from a secret, so public IDs
+// reveal neither the UUID nor, for time-ordered UUIDs, when the note was
+// made, and nothing needs to be stored to map them back. Changing the
+// secret changes every public ID.
+type Hashid struct {
+	block cipher.Block
+}
+
+func NewHashid(secret string) (*Hashid, error) {
+	if secret == "" {
+		return nil, errors.New("public ID secret is empty")
+	}
+	key := sha256.Sum256([]byte("notty public ids\x00" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return &Hashid{block: block}, nil
+}
+
+// Encode returns a 22 character base62 ID. IDs that aren't UUIDs are
+// returned unchanged.
+func (h *Hashid) Encode(id string) string {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return id
+	}
+	var sealed [16]byte
+	h.block.Encrypt(sealed[:], u[:])
+	digits := new(big.Int).SetBytes(sealed[:]).Text(62)
+	return strings.Repeat("0", encodedLen-len(digits)) + digits
+}
+
+func (h *Hashid) Decode(public string) (string, bool) {
+	if len(public) != encodedLen || strings.Trim(public, alphabet) != "" {
+		return "", false
+	}
+	n, ok := new(big.Int).SetString(public, 62)
+	if !ok || n.BitLen() > 128 {
+		return "", false
+	}
+	var sealed, u uuid.UUID
+	n.FillBytes(sealed[:])
+	h.block.Decrypt(u[:], sealed[:])
+	return u.String(), true
+}
@@ -0,0 +1,108 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// gpsIFD is the EXIF tag pointing at the GPS fields
+const gpsIFD = 0x8825
+
+// typeSizes are the byte sizes of the EXIF field types by their number
+var typeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// StripLocation removes where a JPEG was taken from its metadata: the GPS
+// fields of its EXIF data, and XMP data that mentions GPS. Everything else,
+// like the orientation, is kept. It reports whether there was anything to
+// remove; data that isn't a JPEG is returned as is.
+func StripLocation(data []byte) ([]byte, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data, false
+	}
+	out := append([]byte(nil), data[:2]...)
+	stripped := false
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		if marker == 0xDA { // start of scan: the image data follows
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + n
+		if n < 2 || end > len(data) {
+			return data, false
+		}
+		segment := data[i:end]
+		if marker == 0xE1 {
+			payload := segment[4:]
+			switch {
+			case bytes.HasPrefix(payload, []byte("Exif\x00\x00")):
+				tiff := append([]byte(nil), payload[6:]...)
+				if clearGPS(tiff) {
+					segment = append(append([]byte(nil), segment[:10]...), tiff...)
+					stripped = true
+				}
+			case bytes.HasPrefix(payload, []byte("http://ns.adobe.com/xap/1.0/")) && bytes.Contains(payload, []byte("GPS")):
+				i, stripped = end, true
+				continue
+			}
+		}
+		out = append(out, segment...)
+		i = end
+	}
+	if !stripped {
+		return data, false
+	}
+	return append(out, data[i:]...), true
+}
+
+// clearGPS empties the GPS directory of EXIF data in place, zeroing its
+// fields and the values they point to. It reports whether it had one.
+func clearGPS(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+	entries := func(offset int) (int, bool) {
+		if offset < 8 || offset+2 > len(tiff) {
+			return 0, false
+		}
+		n := int(order.Uint16(tiff[offset:]))
+		return n, offset+2+n*12 <= len(tiff)
+	}
+
+	ifd0 := int(order.Uint32(tiff[4:]))
+	n, ok := entries(ifd0)
+	if !ok {
+		return false
+	}
+	gps := -1
+	for e := ifd0 + 2; e < ifd0+2+n*12; e += 12 {
+		if order.Uint16(tiff[e:]) == gpsIFD {
+			gps = int(order.Uint32(tiff[e+8:]))
+		}
+	}
+	count, ok := entries(gps)
+	if !ok {
+		return false
+	}
+	for e := gps + 2; e < gps+2+count*12; e += 12 {
+		size := typeSizes[order.Uint16(tiff[e+2:])] * int(order.Uint32(tiff[e+4:]))
+		if size > 4 {
+			if off := int(order.Uint32(tiff[e+8:])); off >= 0 && off+size <= len(tiff) {
+				clear(tiff[off : off+size])
+			}
+		}
+		clear(tiff[e : e+12])
+	}
+	order.PutUint16(tiff[gps:], 0)
+	return true
+}
@@ -0,0 +1,200 @@
+// Package imaging checks uploaded images, scales them down into
+// thumbnails and converts them. JPEG, PNG, GIF and WebP are decoded; they
+// are encoded as JPEG, PNG or lossless WebP.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // so image.Decode reads GIFs
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	_ "golang.org/x/image/webp" // so image.Decode reads WebPs
+)
+
+// MaxPixels is the largest image decoded for a thumbnail, so a small file
+// claiming huge dimensions can't take all memory
+const MaxPixels = 50_000_000
+
+var (
+	// ErrMismatch is returned when a file isn't of the type it claims
+	ErrMismatch = errors.New("content doesn't match its type")
+	// ErrUnsupported is returned for images that can't be thumbnailed
+	ErrUnsupported = errors.New("image type not supported")
+	// ErrTooLarge is returned for images above MaxPixels
+	ErrTooLarge = errors.New("image has too many pixels")
+)
+
+// Types are the content types thumbnails can be made of
+var Types = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// Decodable reports whether thumbnails can be made of a content type
+func Decodable(contentType string) bool {
+	return slices.Contains(Types, contentType)
+}
+
+// Formats are the content types images can be converted to, by the names
+// they are asked for with
+var Formats = map[string]string{
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+}
+
+// Extension returns the file extension of images of a content type
+// images can be converted to
+func Extension(contentType string) string {
+	if contentType == "image/jpeg" {
+		return ".jpg"
+	}
+	return "." + strings.TrimPrefix(contentType, "image/")
+}
+
+// Encodable reports whether images can be converted to a content type
+func Encodable(contentType string) bool {
+	for _, t := range Formats {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sniff returns the content type of data. A declared type is kept unless
+// the content contradicts it: files declared as images must be that kind
+// of image, and files that are images must not be declared as something
+// else. Without a declared type, or with one that says nothing about the
+// file like application/octet-stream, the sniffed one is used.
+func Sniff(declared string, data []byte) (string, error) {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	switch {
+	case declared == "" || declared == "application/octet-stream" || declared == "application/x-www-form-urlencoded":
+		return sniffed, nil
+	case strings.HasPrefix(declared, "image/") && sniffable(declared) && declared != sniffed:
+		return "", fmt.Errorf("%w: not %s", ErrMismatch, declared)
+	case strings.HasPrefix(sniffed, "image/") && declared != sniffed:
+		return "", fmt.Errorf("%w: %s, not %s", ErrMismatch, sniffed, declared)
+	}
+	return declared, nil
+}
+
+// sniffable reports whether http.DetectContentType recognizes an image
+// type, so a mismatch with it means something
+func sniffable(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp", "image/x-icon":
+		return true
+	}
+	return false
+}
+
+// Size returns the dimensions of an image without decoding it
+func Size(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Convert scales an image down to width pixels, keeping its aspect ratio,
+// and encodes it as the content type to, one of Encodable. Without a
+// width it keeps its size. Without a type JPEGs stay JPEGs and other
+// images become PNGs. JPEGs asked for as WebP stay JPEGs too: a lossless
+// WebP of a photo is several times its size. Images that need neither
+// are returned as they are.
+func Convert(data []byte, contentType string, width int, to string) ([]byte, string, error) {
+	if !Decodable(contentType) || (to != "" && !Encodable(to)) {
+		return nil, "", ErrUnsupported
+	}
+	if to == "image/webp" && contentType == "image/jpeg" {
+		to = contentType
+	}
+	w, h, err := Size(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if w*h > MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+	if width <= 0 || width > w {
+		width = w
+	}
+	if width == w && (to == "" || to == contentType) {
+		return data, contentType, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if width < w {
+		img = scale(img, width, max(1, (h*width+w/2)/w))
+	}
+
+	switch {
+	case to != "":
+		contentType = to
+	case contentType != "image/jpeg":
+		contentType = "image/png"
+	}
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case "image/webp":
+		err = EncodeWebP(&buf, img)
+	default:
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), contentType, nil
+}
+
+// scale shrinks src to w by h pixels, averaging the pixels each one
+// covers. Colors are averaged premultiplied, so transparent pixels don't
+// darken their neighbours.
+func scale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := range w {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					o := rgba.PixOffset(b.Min.X+sx, b.Min.Y+sy)
+					p := rgba.Pix[o : o+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					bl += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,300 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"slices"
+)
+
+// webpMaxSize is the widest and highest a WebP image can be
+const webpMaxSize = 16384
+
+// Alphabet sizes of the five prefix codes of VP8L: green with the length
+// prefixes of backward references, red, blue, alpha and distance
+var webpAlphabets = [5]int{256 + 24, 256, 256, 256, 40}
+
+// codeLengthOrder is the order the lengths of the code length code are
+// written in
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes img as a lossless WebP (VP8L). Pixels are predicted
+// from their left neighbour after subtracting green from red and blue,
+// and the residuals are Huffman coded. There are no backward references
+// or color cache, which keeps the encoder small at some cost in size.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > webpMaxSize || height > webpMaxSize {
+		return fmt.Errorf("webp: can't encode %dx%d images", width, height)
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	// ARGB pixels with green subtracted from red and blue
+	pix := make([]uint32, width*height)
+	opaque := true
+	for i := range pix {
+		p := nrgba.Pix[4*i : 4*i+4]
+		r, g, bl, a := p[0]-p[1], p[1], p[2]-p[1], p[3]
+		opaque = opaque && a == 0xff
+		pix[i] = uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(bl)
+	}
+	// Residuals of the prediction: the first pixel from opaque black, the
+	// rest of the first row from the left and the first column from above
+	residuals := make([]uint32, len(pix))
+	for i := range pix {
+		pred := uint32(0xff000000)
+		switch {
+		case i%width > 0:
+			pred = pix[i-1]
+		case i > 0:
+			pred = pix[i-width]
+		}
+		residuals[i] = subPixels(pix[i], pred)
+	}
+
+	var bw bitWriter
+	bw.write(0x2f, 8) // signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // version
+
+	bw.write(1, 1) // a transform:
+	bw.write(2, 2) // subtract green
+	bw.write(1, 1) // a transform:
+	bw.write(0, 2) // predictor
+	bw.write(7, 3) // in blocks of 2^9 pixels, all predicted from the left
+	blocks := ((width + 511) >> 9) * ((height + 511) >> 9)
+	modes := make([]uint32, blocks)
+	for i := range modes {
+		modes[i] = 1 << 8 // the mode is in green
+	}
+	writePixels(&bw, modes, false)
+	bw.write(0, 1) // no more transforms
+
+	writePixels(&bw, residuals, true)
+	bw.flush()
+
+	data := bw.buf
+	if len(data)%2 == 1 {
+		data = append(data, 0) // chunks are padded to an even size
+	}
+	header := make([]byte, 0, 20)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(4+8+len(data)))
+	header = append(header, "WEBPVP8L"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(bw.buf)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// subPixels subtracts the channels of b from those of a, modulo 256
+func subPixels(a, b uint32) uint32 {
+	var d uint32
+	for shift := 0; shift < 32; shift += 8 {
+		d |= ((a>>shift - b>>shift) & 0xff) << shift
+	}
+	return d
+}
+
+// writePixels writes an entropy-coded image of literal ARGB pixels: no
+// color cache, a single set of prefix codes and the pixels in them. Only
+// the main image says it has no meta prefix codes.
+func writePixels(bw *bitWriter, pix []uint32, main bool) {
+	bw.write(0, 1) // no color cache
+	if main {
+		bw.write(0, 1) // no meta prefix codes
+	}
+	var counts [5][]int
+	for i, size := range webpAlphabets {
+		counts[i] = make([]int, size)
+	}
+	for _, p := range pix {
+		counts[0][p>>8&0xff]++
+		counts[1][p>>16&0xff]++
+		counts[2][p&0xff]++
+		counts[3][p>>24]++
+	}
+	var codes [5]prefixCode
+	for i := range codes {
+		codes[i] = writePrefixCode(bw, counts[i])
+	}
+	for _, p := range pix {
+		codes[0].put(bw, int(p>>8&0xff))
+		codes[1].put(bw, int(p>>16&0xff))
+		codes[2].put(bw, int(p&0xff))
+		codes[3].put(bw, int(p>>24))
+	}
+}
+
+// prefixCode is a canonical Huffman code: the length of the code of each
+// symbol and the code itself, bit reversed to be written LSB first
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (c prefixCode) put(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writePrefixCode writes a code for symbols occurring counts times and
+// returns it. Codes of one or two symbols below 256 are written as simple
+// codes, others as the lengths of their codes.
+func writePrefixCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for symbol, n := range counts {
+		if n > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		bw.write(1, 1) // simple code
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		lengths := make([]uint8, len(counts))
+		if len(used) == 2 {
+			// One bit each; a single symbol takes none
+			bw.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return canonicalCode(lengths)
+	}
+
+	code := canonicalCode(huffmanLengths(counts, 15))
+	bw.write(0, 1) // normal code
+	// The lengths are Huffman coded themselves. When every symbol is used
+	// they may all be the same, and a code of one symbol can't be written
+	// as lengths, so zero is always in it.
+	lengthCounts := make([]int, len(codeLengthOrder))
+	for _, l := range code.lengths {
+		lengthCounts[l]++
+	}
+	lengthCounts[0] = max(lengthCounts[0], 1)
+	lengthCode := canonicalCode(huffmanLengths(lengthCounts, 7))
+	n := len(codeLengthOrder)
+	for n > 4 && lengthCode.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(uint32(n-4), 4)
+	for _, symbol := range codeLengthOrder[:n] {
+		bw.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	bw.write(0, 1) // lengths follow for the whole alphabet
+	for _, l := range code.lengths {
+		lengthCode.put(bw, int(l))
+	}
+	return code
+}
+
+// huffmanLengths returns the lengths of a Huffman code for symbols
+// occurring counts times, at most maxLength bits long. Codes that come out
+// longer are made again with rare symbols counted as more common, which
+// flattens the tree until it fits.
+func huffmanLengths(counts []int, maxLength int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	for floor := 1; ; floor *= 2 {
+		type node struct{ weight, parent int }
+		var nodes []node
+		var symbols, active []int
+		for symbol, n := range counts {
+			if n > 0 {
+				active = append(active, len(nodes))
+				nodes = append(nodes, node{max(n, floor), -1})
+				symbols = append(symbols, symbol)
+			}
+		}
+		for len(active) > 1 {
+			slices.SortStableFunc(active, func(a, b int) int { return nodes[a].weight - nodes[b].weight })
+			nodes = append(nodes, node{nodes[active[0]].weight + nodes[active[1]].weight, -1})
+			parent := len(nodes) - 1
+			nodes[active[0]].parent, nodes[active[1]].parent = parent, parent
+			active = append(active[2:], parent)
+		}
+		longest := 0
+		for i, symbol := range symbols {
+			depth := 0
+			for n := i; nodes[n].parent >= 0; n = nodes[n].parent {
+				depth++
+			}
+			lengths[symbol] = uint8(depth)
+			longest = max(longest, depth)
+		}
+		if longest <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// canonicalCode assigns the codes of a canonical Huffman code with the
+// given lengths: shorter codes first, and in order of their symbols
+func canonicalCode(lengths []uint8) prefixCode {
+	var count [16]uint32
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	var next [16]uint32
+	for bits, code := 1, uint32(0); bits < 16; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		code := next[l]
+		next[l]++
+		for i := uint8(0); i < l; i++ {
+			codes[symbol] = codes[symbol]<<1 | code>>i&1
+		}
+	}
+	return prefixCode{lengths: lengths, codes: codes}
+}
+
+// bitWriter packs bits LSB first, as VP8L reads them
+type bitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+func (w *bitWriter) write(bits uint32, n uint) {
+	w.bits |= uint64(bits) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.n -= 8
+	}
+}
+
+// flush writes out the last bits, padded to a byte
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.n = 0, 0
+	}
+}
@@ -0,0 +1,120 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// nrgba returns the pixels of img
+func nrgba(img image.Image) []byte {
+	dst := image.NewNRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	return dst.Pix
+}
+
+func TestEncodeWebP(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := map[string]func(x, y int) color.NRGBA{
+		"solid":    func(x, y int) color.NRGBA { return color.NRGBA{10, 20, 30, 255} },
+		"gradient": func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), uint8(y), uint8(x + y), uint8(255 - y)} },
+		"noise": func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255}
+		},
+		"sparse": func(x, y int) color.NRGBA {
+			v := uint8(0)
+			if rnd.Intn(1000) == 0 {
+				v = uint8(rnd.Intn(256))
+			}
+			return color.NRGBA{v, v, v, 255}
+		},
+	}
+	for name, pixel := range tests {
+		for _, size := range [][2]int{{1, 1}, {3, 2}, {600, 530}} {
+			src := image.NewNRGBA(image.Rect(0, 0, size[0], size[1]))
+			for y := range size[1] {
+				for x := range size[0] {
+					src.SetNRGBA(x, y, pixel(x, y))
+				}
+			}
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, src); err != nil {
+				t.Fatalf("%s %v: %v", name, size, err)
+			}
+			got, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("%s %v: %v", name, size, err)
+			}
+			if !bytes.Equal(nrgba(got), src.Pix) {
+				t.Errorf("%s %v: pixels differ after decoding", name, size)
+			}
+		}
+	}
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	// Fibonacci counts make the deepest Huffman trees
+	counts := []int{1, 1}
+	for len(counts) < 30 {
+		counts = append(counts, counts[len(counts)-1]+counts[len(counts)-2])
+	}
+	lengths := huffmanLengths(counts, 15)
+	kraft := 0.0
+	for _, l := range lengths {
+		if l < 1 || l > 15 {
+			t.Fatalf("code length %d", l)
+		}
+		kraft += 1 / float64(uint(1)<<l)
+	}
+	if kraft != 1 {
+		t.Errorf("code is not complete: %v", kraft)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	var data bytes.Buffer
+	if err := png.Encode(&data, src); err != nil {
+		t.Fatal(err)
+	}
+	out, contentType, err := Convert(data.Bytes(), "image/png", 10, "image/webp")
+	if err != nil || contentType != "image/webp" {
+		t.Fatalf("converted to %s: %v", contentType, err)
+	}
+	img, err := webp.Decode(bytes.NewReader(out))
+	if err != nil || img.Bounds().Dx() != 10 || img.Bounds().Dy() != 5 {
+		t.Fatalf("converted image is %v (%v), want 10x5", img, err)
+	}
+	// WebPs are read like the other types
+	out, contentType, err = Convert(out, "image/webp", 5, "image/png")
+	if cfg, err2 := png.DecodeConfig(bytes.NewReader(out)); err != nil || err2 != nil || cfg.Width != 5 || contentType != "image/png" {
+		t.Errorf("WebP converted to %s %+v: %v, %v", contentType, cfg, err, err2)
+	}
+
+	// Neither scaled nor converted
+	out, contentType, _ = Convert(data.Bytes(), "image/png", 80, "image/png")
+	if contentType != "image/png" || !bytes.Equal(out, data.Bytes()) {
+		t.Error("image was converted to its own type")
+	}
+	out, contentType, _ = Convert(data.Bytes(), "image/png", 0, "image/jpeg")
+	if _, err := jpeg.DecodeConfig(bytes.NewReader(out)); err != nil || contentType != "image/jpeg" {
+		t.Errorf("converted to %s: %v", contentType, err)
+	}
+	// Photos stay JPEGs rather than become much larger lossless WebPs
+	photo := out
+	out, contentType, _ = Convert(photo, "image/jpeg", 20, "image/webp")
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(out)); err != nil || contentType != "image/jpeg" || cfg.Width != 20 {
+		t.Errorf("JPEG asked for as WebP came as %s %+v: %v", contentType, cfg, err)
+	}
+	if _, _, err := Convert(data.Bytes(), "image/png", 0, "image/avif"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("converting to AVIF: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package ingest turns emails into notes. It runs a small SMTP server
+// that accepts mail for known addresses and hands each message over
+// parsed into its subject, text body and attachments.
+package ingest
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+)
+
+// maxParts bounds how many MIME parts a message may nest
+const maxParts = 100
+
+// Message is an email as it becomes a note
+type Message struct {
+	From        string
+	Subject     string
+	Body        string // the text/plain part, or text/html when there is none
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Parse reads a message in RFC 5322 format
+func Parse(r io.Reader) (Message, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return Message{}, err
+	}
+	dec := new(mime.WordDecoder)
+	msg := Message{From: m.Header.Get("From")}
+	if msg.Subject, err = dec.DecodeHeader(m.Header.Get("Subject")); err != nil {
+		msg.Subject = m.Header.Get("Subject")
+	}
+	if addr, err := mail.ParseAddress(msg.From); err == nil {
+		msg.From = addr.Address
+	}
+
+	var plain, html string
+	parts := 0
+	var walk func(header textHeader, body io.Reader) error
+	walk = func(header textHeader, body io.Reader) error {
+		if parts++; parts > maxParts {
+			return errors.New("too many MIME parts")
+		}
+		mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+		if err != nil {
+			mediaType, params = "text/plain", map[string]string{}
+		}
+		if strings.HasPrefix(mediaType, "multipart/") {
+			mr := multipart.NewReader(body, params["boundary"])
+			for {
+				part, err := mr.NextRawPart()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := walk(part.Header, part); err != nil {
+					return err
+				}
+			}
+		}
+		data, err := io.ReadAll(decode(header.Get("Content-Transfer-Encoding"), body))
+		if err != nil {
+			return fmt.Errorf("decoding %s part: %w", mediaType, err)
+		}
+		disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+		filename := dparams["filename"]
+		if filename == "" {
+			filename = params["name"]
+		}
+		switch {
+		case disposition == "attachment" || filename != "" || !strings.HasPrefix(mediaType, "text/"):
+			msg.Attachments = append(msg.Attachments, Attachment{Filename: filename, ContentType: mediaType, Data: data})
+		case mediaType == "text/plain" && plain == "":
+			plain = string(data)
+		case mediaType == "text/html" && html == "":
+			html = string(data)
+		}
+		return nil
+	}
+	if err := walk(m.Header, m.Body); err != nil {
+		return Message{}, err
+	}
+	msg.Body = plain
+	if msg.Body == "" {
+		msg.Body = html
+	}
+	msg.Body = strings.TrimSpace(strings.ReplaceAll(msg.Body, "\r\n", "\n"))
+	return msg, nil
+}
+
+// textHeader is the part of a MIME header Parse reads, which both
+// mail.Header and textproto.MIMEHeader have
+type textHeader interface {
+	Get(key string) string
+}
+
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r) // skips line breaks
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
@@ -0,0 +1,175 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxMessageSize is the largest message accepted, in bytes
+	MaxMessageSize = 10 << 20
+	maxRecipients  = 20
+	commandTimeout = 5 * time.Minute
+)
+
+// ErrUnknownRecipient is returned by Deliver for addresses it doesn't know
+var ErrUnknownRecipient = errors.New("unknown recipient")
+
+// Mailbox is where received messages go
+type Mailbox interface {
+	// Accepts reports whether mail to the address is taken
+	Accepts(addr string) bool
+	// Deliver stores a message sent to the address
+	Deliver(addr string, msg Message) error
+}
+
+// Server receives mail over SMTP. It takes plain-text connections only,
+// so run it behind the MX relay or a TLS-terminating proxy.
+type Server struct {
+	Domain  string // announced in the greeting
+	Mailbox Mailbox
+}
+
+// Serve accepts connections on l until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// session is the state of one SMTP conversation
+type session struct {
+	from       string
+	recipients []string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(code int, msg string) error {
+		conn.SetWriteDeadline(time.Now().Add(commandTimeout))
+		return tp.PrintfLine("%d %s", code, msg)
+	}
+	if reply(220, s.Domain+" ESMTP Notty") != nil {
+		return
+	}
+	var sess session
+	for {
+		conn.SetReadDeadline(time.Now().Add(commandTimeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			err = reply(250, s.Domain)
+		case "EHLO":
+			err = tp.PrintfLine("250-%s\r\n250-8BITMIME\r\n250 SIZE %d", s.Domain, MaxMessageSize)
+		case "MAIL":
+			addr, ok := pathArg(arg, "FROM:")
+			if !ok {
+				err = reply(501, "Syntax: MAIL FROM:<address>")
+				break
+			}
+			sess = session{from: addr}
+			err = reply(250, "OK")
+		case "RCPT":
+			addr, ok := pathArg(arg, "TO:")
+			switch {
+			case !ok:
+				err = reply(501, "Syntax: RCPT TO:<address>")
+			case len(sess.recipients) >= maxRecipients:
+				err = reply(452, "Too many recipients")
+			case !s.Mailbox.Accepts(addr):
+				err = reply(550, "No such mailbox")
+			default:
+				sess.recipients = append(sess.recipients, addr)
+				err = reply(250, "OK")
+			}
+		case "DATA":
+			if len(sess.recipients) == 0 {
+				err = reply(503, "Need RCPT first")
+				break
+			}
+			if err = reply(354, "End data with <CR><LF>.<CR><LF>"); err != nil {
+				break
+			}
+			err = s.receive(tp, sess, reply)
+			sess = session{}
+		case "RSET":
+			sess = session{}
+			err = reply(250, "OK")
+		case "NOOP":
+			err = reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			err = reply(502, "Command not implemented")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// receive reads the message after DATA and delivers it to every recipient
+func (s *Server) receive(tp *textproto.Conn, sess session, reply func(int, string) error) error {
+	r := io.LimitReader(tp.DotReader(), MaxMessageSize+1)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxMessageSize {
+		io.Copy(io.Discard, tp.DotReader())
+		return reply(552, "Message too large")
+	}
+	msg, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return reply(550, "Malformed message")
+	}
+	delivered := 0
+	for _, rcpt := range sess.recipients {
+		if err := s.Mailbox.Deliver(rcpt, msg); err != nil {
+			log.Printf("ingesting mail from %s to %s: %v", sess.from, rcpt, err)
+			continue
+		}
+		delivered++
+	}
+	if delivered == 0 {
+		return reply(554, "Message could not be delivered")
+	}
+	return reply(250, fmt.Sprintf("OK, delivered to %d of %d recipients", delivered, len(sess.recipients)))
+}
+
+// pathArg reads the address of "FROM:<a@b>" and "TO:<a@b>" arguments,
+// ignoring parameters like SIZE= after it
+func pathArg(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	path, _, _ = strings.Cut(path, " ")
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "<"), ">")
+	if path == "" {
+		return "", true // the null sender of bounces
+	}
+	addr, err := mail.ParseAddress(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
@@ -0,0 +1,131 @@
+// Package ink reads handwriting and sketches drawn with a stylus, stored
+// as strokes in JSON, and renders them to SVG and PNG for previews
+package ink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// ContentType identifies ink attachments
+const ContentType = "application/vnd.notty.ink+json"
+
+// Limits that keep a drawing cheap to store and render
+const (
+	MaxCanvas  = 10000 // width and height
+	MaxStrokes = 10000
+	MaxPoints  = 200000 // over all strokes
+	MaxWidth   = 100    // of a stroke
+	// MaxInk caps the pixels rendering the drawing at its own size
+	// stamps, as estimated by cost
+	MaxInk = 20000000
+)
+
+// Drawing is a canvas with the strokes drawn on it, oldest first
+type Drawing struct {
+	Width      float64  `json:"width"`
+	Height     float64  `json:"height"`
+	Background string   `json:"background,omitempty"` // transparent if empty
+	Strokes    []Stroke `json:"strokes"`
+}
+
+// Stroke is one line drawn without lifting the pen. Each point is [x, y]
+// or [x, y, pressure], with pressure from 0 to 1 scaling the width.
+type Stroke struct {
+	Color  string      `json:"color"`
+	Width  float64     `json:"width"`
+	Points [][]float64 `json:"points"`
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Parse reads and validates a drawing
+func Parse(data []byte) (Drawing, error) {
+	var d Drawing
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Drawing{}, fmt.Errorf("invalid ink JSON: %w", err)
+	}
+	return d, d.Validate()
+}
+
+// Validate checks a drawing against the format and the limits
+func (d Drawing) Validate() error {
+	if !(d.Width > 0 && d.Width <= MaxCanvas && d.Height > 0 && d.Height <= MaxCanvas) {
+		return fmt.Errorf("width and height must be 1 to %d", MaxCanvas)
+	}
+	if d.Background != "" && !hexColor.MatchString(d.Background) {
+		return errors.New("background must be a #rgb or #rrggbb color")
+	}
+	if len(d.Strokes) > MaxStrokes {
+		return fmt.Errorf("a drawing can have at most %d strokes", MaxStrokes)
+	}
+	points, ink := 0, 0.0
+	for i, s := range d.Strokes {
+		if !hexColor.MatchString(s.Color) {
+			return fmt.Errorf("stroke %d: color must be #rgb or #rrggbb", i)
+		}
+		if !(s.Width > 0 && s.Width <= MaxWidth) {
+			return fmt.Errorf("stroke %d: width must be above 0 and at most %d", i, MaxWidth)
+		}
+		if len(s.Points) == 0 {
+			return fmt.Errorf("stroke %d has no points", i)
+		}
+		for _, p := range s.Points {
+			if len(p) != 2 && len(p) != 3 {
+				return fmt.Errorf("stroke %d: points must be [x, y] or [x, y, pressure]", i)
+			}
+			if len(p) == 3 && !(p[2] >= 0 && p[2] <= 1) {
+				return fmt.Errorf("stroke %d: pressure must be 0 to 1", i)
+			}
+			if !(p[0] >= 0 && p[0] <= d.Width && p[1] >= 0 && p[1] <= d.Height) {
+				return fmt.Errorf("stroke %d: point outside the canvas", i)
+			}
+		}
+		if points += len(s.Points); points > MaxPoints {
+			return fmt.Errorf("a drawing can have at most %d points", MaxPoints)
+		}
+		// Pressure only ever thins a stroke, so its full width bounds
+		// what each segment costs
+		for j, p := range s.Points {
+			prev := s.Points[max(j-1, 0)]
+			ink += cost(math.Hypot(p[0]-prev[0], p[1]-prev[1]), s.Width)
+		}
+		if ink > MaxInk {
+			return errors.New("the drawing has too much ink to render; use fewer, shorter or thinner strokes")
+		}
+	}
+	return nil
+}
+
+// pressure of a point, 1 when the client didn't record any
+func pressure(p []float64) float64 {
+	if len(p) == 3 {
+		return p[2]
+	}
+	return 1
+}
+
+// hasPressure reports whether any point of a stroke records pressure
+func (s Stroke) hasPressure() bool {
+	for _, p := range s.Points {
+		if len(p) == 3 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseColor reads a color that passed Validate
+func parseColor(s string) color.NRGBA {
+	hex := s[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, _ := strconv.ParseUint(hex, 16, 32)
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+}
@@ -0,0 +1,98 @@
+package ink
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+// SVG writes the drawing as an SVG image
+func (d Drawing) SVG(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s">`+"\n",
+		num(d.Width), num(d.Height), num(d.Width), num(d.Height))
+	if d.Background != "" {
+		fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", d.Background)
+	}
+	for _, s := range d.Strokes {
+		if len(s.Points) == 1 || s.hasPressure() {
+			// Widths vary along the stroke, so each segment is its own line
+			start := min(1, len(s.Points)-1) // a single point is a dot
+			for i := start; i < len(s.Points); i++ {
+				prev, p := s.Points[max(i-1, 0)], s.Points[i]
+				width := s.Width * (pressure(prev) + pressure(p)) / 2
+				fmt.Fprintf(&b, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="%s" stroke-linecap="round"/>`+"\n",
+					num(prev[0]), num(prev[1]), num(p[0]), num(p[1]), s.Color, num(width))
+			}
+			continue
+		}
+		points := make([]string, len(s.Points))
+		for i, p := range s.Points {
+			points[i] = num(p[0]) + "," + num(p[1])
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%s" stroke-linecap="round" stroke-linejoin="round"/>`+"\n",
+			strings.Join(points, " "), s.Color, num(s.Width))
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func num(f float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
+
+// PNG writes the drawing as a PNG image scaled to fit in maxSize pixels
+// on its longer side, or at its own size if that is smaller
+func (d Drawing) PNG(w io.Writer, maxSize int) error {
+	scale := math.Min(1, float64(maxSize)/math.Max(d.Width, d.Height))
+	img := image.NewNRGBA(image.Rect(0, 0, max(1, int(math.Ceil(d.Width*scale))), max(1, int(math.Ceil(d.Height*scale)))))
+	if d.Background != "" {
+		draw.Draw(img, img.Bounds(), image.NewUniform(parseColor(d.Background)), image.Point{}, draw.Src)
+	}
+	for _, s := range d.Strokes {
+		c := parseColor(s.Color)
+		for i := range s.Points {
+			prev := s.Points[max(i-1, 0)]
+			p := s.Points[i]
+			width := s.Width * scale * (pressure(prev) + pressure(p)) / 2
+			segment(img, prev[0]*scale, prev[1]*scale, p[0]*scale, p[1]*scale, width, c)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// segment draws a line with round ends by stamping discs along it
+func segment(img *image.NRGBA, x1, y1, x2, y2, width float64, c color.NRGBA) {
+	r := math.Max(width/2, 0.5)
+	steps := int(math.Ceil(math.Hypot(x2-x1, y2-y1)/math.Max(r/2, 0.5))) + 1
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		disc(img, x1+(x2-x1)*t, y1+(y2-y1)*t, r, c)
+	}
+}
+
+// cost estimates the pixels segment stamps for a line of a length and
+// width: a disc of about width² pixels every quarter width along it.
+// Rendering scaled down costs no more.
+func cost(length, width float64) float64 {
+	width = math.Max(width, 1)
+	return width * (4*length + 2*width)
+}
+
+func disc(img *image.NRGBA, cx, cy, r float64, c color.NRGBA) {
+	b := img.Bounds()
+	for y := max(int(cy-r), b.Min.Y); y <= min(int(cy+r), b.Max.Y-1); y++ {
+		for x := max(int(cx-r), b.Min.X); x <= min(int(cx+r), b.Max.X-1); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy <= r*r {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Package jobs runs slow work like exports and webhook deliveries in the
+// background, so requests don't wait for it. Jobs are kept in a Store, in
+// memory or in Redis, and taken off its queue by a pool of workers.
+// Callers poll a job by ID until it is done or failed. Failed jobs land in
+// a dead-letter queue, where they are kept until retried or discarded.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status of a job
+type Status string
+
+const (
+	Queued  Status = "queued"
+	Running Status = "running"
+	Done    Status = "done"
+	Failed  Status = "failed"
+)
+
+// Keep is how long finished jobs and their output are kept
+const Keep = 24 * time.Hour
+
+var (
+	// ErrNotFound is returned for unknown job IDs, and for output of jobs
+	// that have none
+	ErrNotFound = errors.New("job not found")
+	// ErrUnknownKind is returned when enqueuing a job nobody handles
+	ErrUnknownKind = errors.New("unknown job kind")
+)
+
+// Job is a unit of background work
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Status      Status          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Error       string          `json:"error,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Output      *Output         `json:"output,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+
+	// Owner is who enqueued the job; only they may see it
+	Owner string `json:"-"`
+	// Payload is the input of the job as JSON
+	Payload json.RawMessage `json:"-"`
+}
+
+// Output describes a file a job produced, like an export
+type Output struct {
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename"`
+	Size        int    `json:"size"`
+}
+
+// Outcome is what a handler produced. Result is shown in the job as JSON,
+// Data is stored as its downloadable output when set.
+type Outcome struct {
+	Result      any
+	Data        []byte
+	ContentType string
+	Filename    string
+}
+
+// Handler does the work of a job. Returning an error retries the job
+// unless it is Permanent or the job is out of attempts.
+type Handler func(ctx context.Context, job Job) (Outcome, error)
+
+// Options control how a kind of job is retried. Attempt n waits Backoff *
+// 2^(n-2) before it is made.
+type Options struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+type permanent struct{ err error }
+
+func (p permanent) Error() string { return p.err.Error() }
+func (p permanent) Unwrap() error { return p.err }
+
+// Permanent marks an error retrying won't fix
+func Permanent(err error) error {
+	return permanent{err}
+}
+
+// Store keeps jobs and queues their IDs for the workers
+type Store interface {
+	Save(job Job) error
+	Get(id string) (Job, error)
+	Push(id string) error
+	// Pop blocks until a job is queued or ctx is done
+	Pop(ctx context.Context) (string, error)
+	// Ack tells the store a popped job ran, whatever came of it. A store
+	// that outlives the process may queue jobs popped but not acked again.
+	Ack(id string) error
+	SaveOutput(id string, data []byte) error
+	Output(id string) ([]byte, error)
+
+	// Bury puts a failed job in the dead-letter queue, which keeps it past
+	// Keep
+	Bury(id string, at time.Time) error
+	// Unbury takes a job out of the dead-letter queue, reporting false if
+	// it wasn't in it. It is forgotten Keep after it finished again.
+	Unbury(id string) (bool, error)
+	// Dead lists the jobs in the dead-letter queue, oldest first
+	Dead() ([]string, error)
+}
+
+type kind struct {
+	handler Handler
+	options Options
+}
+
+// Queue hands jobs to the handler registered for their kind
+type Queue struct {
+	store Store
+
+	mu      sync.RWMutex
+	kinds   map[string]kind
+	workers sync.WaitGroup
+}
+
+// New returns a queue backed by store. Jobs only run once Run is called.
+func New(store Store) *Queue {
+	return &Queue{store: store, kinds: map[string]kind{}}
+}
+
+// Handle registers the handler of a kind of job
+func (q *Queue) Handle(name string, h Handler, opts Options) {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.kinds[name] = kind{h, opts}
+}
+
+// Enqueue queues a job of a kind with payload as its JSON input
+func (q *Queue) Enqueue(name, owner string, payload any) (Job, error) {
+	q.mu.RLock()
+	k, ok := q.kinds[name]
+	q.mu.RUnlock()
+	if !ok {
+		return Job{}, fmt.Errorf("%w %q", ErrUnknownKind, name)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	job := Job{
+		ID:          uuid.NewString(),
+		Kind:        name,
+		Status:      Queued,
+		MaxAttempts: k.options.MaxAttempts,
+		CreatedAt:   time.Now(),
+		Owner:       owner,
+		Payload:     data,
+	}
+	if err := q.store.Save(job); err != nil {
+		return Job{}, err
+	}
+	return job, q.store.Push(job.ID)
+}
+
+// Get returns a job by ID
+func (q *Queue) Get(id string) (Job, error) {
+	return q.store.Get(id)
+}
+
+// Output returns the file a job produced
+func (q *Queue) Output(id string) ([]byte, error) {
+	return q.store.Output(id)
+}
+
+// Dead returns the jobs in the dead-letter queue, oldest first
+func (q *Queue) Dead() ([]Job, error) {
+	ids, err := q.store.Dead()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := q.store.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			q.store.Unbury(id) // expired before it was buried
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, job)
+	}
+	return list, nil
+}
+
+// Retry takes a job out of the dead-letter queue and queues it again with
+// all its attempts. It returns ErrNotFound for jobs that aren't dead.
+func (q *Queue) Retry(id string) (Job, error) {
+	buried, err := q.store.Unbury(id)
+	if err != nil {
+		return Job{}, err
+	}
+	if !buried {
+		return Job{}, ErrNotFound
+	}
+	job, err := q.store.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	job.Status, job.Attempts, job.Error = Queued, 0, ""
+	job.StartedAt, job.FinishedAt = nil, nil
+	if err := q.store.Save(job); err != nil {
+		return Job{}, err
+	}
+	return job, q.store.Push(job.ID)
+}
+
+// Discard takes a job out of the dead-letter queue, to be forgotten like
+// other failed jobs. It returns ErrNotFound for jobs that aren't dead.
+func (q *Queue) Discard(id string) error {
+	buried, err := q.store.Unbury(id)
+	if err == nil && !buried {
+		err = ErrNotFound
+	}
+	return err
+}
+
+// Run starts workers that run queued jobs until ctx is done
+func (q *Queue) Run(ctx context.Context, workers int) {
+	for range workers {
+		q.workers.Add(1)
+		go func() {
+			defer q.workers.Done()
+			q.work(ctx)
+		}()
+	}
+}
+
+// Wait blocks until the workers stopped after ctx of Run is done
+func (q *Queue) Wait() {
+	q.workers.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		id, err := q.store.Pop(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Print("Job queue: ", err)
+			time.Sleep(time.Second) // e.g. Redis is down; don't spin
+			continue
+		}
+		q.run(ctx, id)
+		if err := q.store.Ack(id); err != nil {
+			log.Printf("Job %s: %v", id, err)
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, id string) {
+	job, err := q.store.Get(id)
+	if err != nil {
+		log.Printf("Job %s: %v", id, err)
+		return
+	}
+	q.mu.RLock()
+	k, ok := q.kinds[job.Kind]
+	q.mu.RUnlock()
+
+	now := time.Now()
+	job.Status, job.StartedAt = Running, &now
+	job.Attempts++
+	if err := q.store.Save(job); err != nil {
+		log.Printf("Job %s: %v", id, err)
+	}
+
+	var outcome Outcome
+	if ok {
+		outcome, err = safely(ctx, k.handler, job)
+	} else {
+		err = Permanent(fmt.Errorf("%w %q", ErrUnknownKind, job.Kind))
+	}
+	if err == nil {
+		err = q.finish(&job, outcome)
+	}
+	if err != nil {
+		job.Error = err.Error()
+		var p permanent
+		if job.Attempts < job.MaxAttempts && !errors.As(err, &p) {
+			job.Status = Queued
+			if err := q.store.Save(job); err != nil {
+				log.Printf("Job %s: %v", id, err)
+			}
+			time.AfterFunc(k.options.Backoff<<(job.Attempts-1), func() {
+				if err := q.store.Push(job.ID); err != nil {
+					log.Printf("Job %s: %v", id, err)
+				}
+			})
+			return
+		}
+		job.Status = Failed
+	}
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err := q.store.Save(job); err != nil {
+		log.Printf("Job %s: %v", id, err)
+	}
+	if job.Status == Failed {
+		log.Printf("Job %s (%s) failed after %d attempts: %s", id, job.Kind, job.Attempts, job.Error)
+		if err := q.store.Bury(id, finished); err != nil {
+			log.Printf("Job %s: %v", id, err)
+		}
+	}
+}
+
+// finish stores what the handler produced in the job
+func (q *Queue) finish(job *Job, outcome Outcome) error {
+	job.Status, job.Error = Done, ""
+	if outcome.Result != nil {
+		result, err := json.Marshal(outcome.Result)
+		if err != nil {
+			return Permanent(err)
+		}
+		job.Result = result
+	}
+	if outcome.Data != nil {
+		if err := q.store.SaveOutput(job.ID, outcome.Data); err != nil {
+			return err
+		}
+		job.Output = &Output{ContentType: outcome.ContentType, Filename: outcome.Filename, Size: len(outcome.Data)}
+	}
+	return nil
+}
+
+// safely runs a handler, failing the job rather than the server when it
+// panics
+func safely(ctx context.Context, h Handler, job Job) (outcome Outcome, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	return h(ctx, job)
+}
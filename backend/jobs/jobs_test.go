@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls the job until it has status, failing the test after a
+// while
+func waitFor(t *testing.T, q *Queue, id string, status Status) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := q.Get(id)
+		if err == nil && job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", id, job.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := New(NewMemoryStore())
+	var broken atomic.Bool
+	broken.Store(true)
+	q.Handle("flaky", func(ctx context.Context, job Job) (Outcome, error) {
+		if broken.Load() {
+			return Outcome{}, errors.New("still broken")
+		}
+		return Outcome{Result: "ok"}, nil
+	}, Options{MaxAttempts: 2, Backoff: time.Millisecond})
+	q.Run(ctx, 1)
+
+	first, _ := q.Enqueue("flaky", "owner", nil)
+	second, _ := q.Enqueue("flaky", "owner", nil)
+	waitFor(t, q, first.ID, Failed)
+	waitFor(t, q, second.ID, Failed)
+	dead, err := q.Dead()
+	if err != nil || len(dead) != 2 || dead[0].Attempts != 2 || dead[0].Error != "still broken" {
+		t.Fatalf("Dead() = %+v, %v", dead, err)
+	}
+
+	broken.Store(false)
+	retried, err := q.Retry(first.ID)
+	if err != nil || retried.Status != Queued || retried.Attempts != 0 {
+		t.Fatalf("Retry() = %+v, %v", retried, err)
+	}
+	if job := waitFor(t, q, first.ID, Done); job.Attempts != 1 || job.Error != "" {
+		t.Errorf("retried job = %+v", job)
+	}
+	if _, err := q.Retry(first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("retrying a job that isn't dead: err = %v", err)
+	}
+
+	if err := q.Discard(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Discard(second.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("discarding twice: err = %v", err)
+	}
+	if dead, _ := q.Dead(); len(dead) != 0 {
+		t.Errorf("Dead() after retry and discard = %+v", dead)
+	}
+	if job, err := q.Get(second.ID); err != nil || job.Status != Failed {
+		t.Errorf("discarded job = %+v, %v; want it kept as failed until it expires", job, err)
+	}
+}
+
+func TestPruneKeepsDeadJobs(t *testing.T) {
+	s := NewMemoryStore()
+	old := time.Now().Add(-2 * Keep)
+	s.Bury("dead", old)
+	s.Save(Job{ID: "dead", Status: Failed, FinishedAt: &old})
+	s.Save(Job{ID: "done", Status: Done, FinishedAt: &old})
+	s.Save(Job{ID: "new", Status: Queued})
+	if _, err := s.Get("done"); !errors.Is(err, ErrNotFound) {
+		t.Error("an old finished job wasn't pruned")
+	}
+	if _, err := s.Get("dead"); err != nil {
+		t.Error("an old dead job was pruned")
+	}
+}
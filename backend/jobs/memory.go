@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps jobs in memory, so they are lost on restart
+type MemoryStore struct {
+	mu      sync.Mutex
+	jobs    map[string]Job
+	outputs map[string][]byte
+	queue   []string
+	dead    map[string]time.Time // when buried
+	ready   chan struct{}        // closed and replaced whenever a job is pushed
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:    map[string]Job{},
+		outputs: map[string][]byte{},
+		dead:    map[string]time.Time{},
+		ready:   make(chan struct{}),
+	}
+}
+
+func (s *MemoryStore) Save(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	s.prune(time.Now())
+	return nil
+}
+
+// prune forgets jobs that finished more than Keep ago, except dead ones.
+// Callers must hold mu.
+func (s *MemoryStore) prune(now time.Time) {
+	for id, job := range s.jobs {
+		if _, dead := s.dead[id]; dead {
+			continue
+		}
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > Keep {
+			delete(s.jobs, id)
+			delete(s.outputs, id)
+		}
+	}
+}
+
+func (s *MemoryStore) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) Push(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, id)
+	close(s.ready)
+	s.ready = make(chan struct{})
+	return nil
+}
+
+func (s *MemoryStore) Pop(ctx context.Context) (string, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			id := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return id, nil
+		}
+		ready := s.ready
+		s.mu.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Ack does nothing: jobs in memory don't outlive the process
+func (s *MemoryStore) Ack(id string) error {
+	return nil
+}
+
+func (s *MemoryStore) SaveOutput(id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputs[id] = data
+	return nil
+}
+
+func (s *MemoryStore) Output(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.outputs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *MemoryStore) Bury(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead[id] = at
+	return nil
+}
+
+func (s *MemoryStore) Unbury(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.dead[id]
+	delete(s.dead, id)
+	return ok, nil
+}
+
+func (s *MemoryStore) Dead() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.dead))
+	for id := range s.dead {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if !s.dead[ids[i]].Equal(s.dead[ids[j]]) {
+			return s.dead[ids[i]].Before(s.dead[ids[j]])
+		}
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps jobs in Redis, so queued jobs survive a restart. Jobs
+// are JSON strings under <prefix>job:<id> that expire Keep after they were
+// last saved, and the queue is the list <prefix>queue. Pop moves a job to
+// the list <prefix>processing until it is acked, and jobs a stopped
+// process left there are queued again when the next one connects. The
+// dead-letter queue is the sorted set <prefix>dead, scored by when jobs
+// were buried; its jobs don't expire. It needs Redis 6.2 or later.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore connects to a URL like redis://:password@host:6379/0
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis url must look like redis://[:password@]host:port[/db]: %w", err)
+	}
+	s := &RedisStore{client: redis.NewClient(opts), prefix: "notty:jobs:"}
+	if err := s.requeue(context.Background()); err != nil {
+		s.client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// requeue queues the jobs that were popped but never acked again, at the
+// front in the order they were popped
+func (s *RedisStore) requeue(ctx context.Context) error {
+	for {
+		err := s.client.LMove(ctx, s.prefix+"processing", s.prefix+"queue", "LEFT", "RIGHT").Err()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// storedJob keeps the fields of a job the API doesn't show
+type storedJob struct {
+	Job
+	Owner   string          `json:"owner,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func (s *RedisStore) Save(job Job) error {
+	data, err := json.Marshal(storedJob{Job: job, Owner: job.Owner, Payload: job.Payload})
+	if err != nil {
+		return err
+	}
+	return s.client.Set(context.Background(), s.prefix+"job:"+job.ID, data, Keep).Err()
+}
+
+func (s *RedisStore) Get(id string) (Job, error) {
+	data, err := s.client.Get(context.Background(), s.prefix+"job:"+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var stored storedJob
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Job{}, err
+	}
+	job := stored.Job
+	job.Owner, job.Payload = stored.Owner, stored.Payload
+	return job, nil
+}
+
+func (s *RedisStore) Push(id string) error {
+	return s.client.LPush(context.Background(), s.prefix+"queue", id).Err()
+}
+
+// Pop waits a second at a time so it notices ctx being done
+func (s *RedisStore) Pop(ctx context.Context) (string, error) {
+	for ctx.Err() == nil {
+		id, err := s.client.BLMove(ctx, s.prefix+"queue", s.prefix+"processing", "RIGHT", "LEFT", time.Second).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return id, nil
+	}
+	return "", ctx.Err()
+}
+
+func (s *RedisStore) Ack(id string) error {
+	return s.client.LRem(context.Background(), s.prefix+"processing", 1, id).Err()
+}
+
+func (s *RedisStore) SaveOutput(id string, data []byte) error {
+	return s.client.Set(context.Background(), s.prefix+"output:"+id, data, Keep).Err()
+}
+
+func (s *RedisStore) Output(id string) ([]byte, error) {
+	data, err := s.client.Get(context.Background(), s.prefix+"output:"+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *RedisStore) Bury(id string, at time.Time) error {
+	ctx := context.Background()
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, s.prefix+"dead", redis.Z{Score: float64(at.UnixMilli()), Member: id})
+		p.Persist(ctx, s.prefix+"job:"+id)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Unbury(id string) (bool, error) {
+	ctx := context.Background()
+	n, err := s.client.ZRem(ctx, s.prefix+"dead", id).Result()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, s.client.Expire(ctx, s.prefix+"job:"+id, Keep).Err()
+}
+
+func (s *RedisStore) Dead() ([]string, error) {
+	return s.client.ZRange(context.Background(), s.prefix+"dead", 0, -1).Result()
+}
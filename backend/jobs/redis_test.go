@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mr := miniredis.RunT(t)
+	s, err := NewRedisStore("redis://" + mr.Addr() + "/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := New(s)
+	q.Handle("echo", func(ctx context.Context, job Job) (Outcome, error) {
+		return Outcome{Result: "ok", Data: job.Payload, Filename: "out.json"}, nil
+	}, Options{})
+	q.Run(ctx, 1)
+
+	job, err := q.Enqueue("echo", "owner", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done := waitFor(t, q, job.ID, Done); done.Owner != "owner" || string(done.Payload) != `{"n":1}` {
+		t.Errorf("job read back = %+v", done)
+	}
+	if out, err := q.Output(job.ID); err != nil || string(out) != `{"n":1}` {
+		t.Errorf("output = %q, %v", out, err)
+	}
+	cancel()
+	q.Wait()
+	if ids, _ := mr.List("notty:jobs:processing"); len(ids) != 0 {
+		t.Errorf("processing list after the job ran = %v", ids)
+	}
+
+	// A job popped by a process that stopped before it ran is queued again
+	// by the next one
+	s.Push("lost")
+	if id, err := s.Pop(context.Background()); err != nil || id != "lost" {
+		t.Fatalf("Pop() = %q, %v", id, err)
+	}
+	if _, err := NewRedisStore("redis://" + mr.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := mr.List("notty:jobs:queue"); len(ids) != 1 || ids[0] != "lost" {
+		t.Errorf("queue after reconnecting = %v, want the lost job", ids)
+	}
+}
@@ -0,0 +1,167 @@
+// Package langdetect guesses the language of a text from its script and,
+// for text in Latin letters, from the short common words it uses. It is
+// meant for notes, which are often short and mixed, so it would rather
+// say nothing than guess on too little text.
+package langdetect
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Detect returns the language text is most likely written in as a tag
+// like "en" or "ja", or "" when there is too little of it to tell
+func Detect(text string) string {
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scriptTables {
+			if unicode.Is(s.table, r) {
+				scripts[s.name]++
+				break
+			}
+		}
+	}
+	if letters < minLetters {
+		return ""
+	}
+	script, most := "Latin", 0
+	for _, s := range scriptTables {
+		if n := scripts[s.name]; n > most {
+			script, most = s.name, n
+		}
+	}
+	switch script {
+	case "Latin":
+		return latin(text)
+	case "Han":
+		// Japanese mixes kana into its kanji; a little is enough to tell
+		if kana := scripts["Hiragana"] + scripts["Katakana"]; kana*10 >= most {
+			return "ja"
+		}
+		return "zh"
+	case "Hiragana", "Katakana":
+		return "ja"
+	case "Cyrillic":
+		if strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			return "uk"
+		}
+		return "ru"
+	}
+	return scriptLanguages[script]
+}
+
+// minLetters is the fewest letters a language is detected in
+const minLetters = 12
+
+// scriptTables are the scripts told apart, in the order they are checked
+var scriptTables = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Thai", unicode.Thai},
+	{"Devanagari", unicode.Devanagari},
+}
+
+// scriptLanguages are the languages of scripts mostly used for one
+var scriptLanguages = map[string]string{
+	"Hangul":     "ko",
+	"Greek":      "el",
+	"Arabic":     "ar",
+	"Hebrew":     "he",
+	"Thai":       "th",
+	"Devanagari": "hi",
+}
+
+// minWords is the fewest common words text in Latin letters must have,
+// and the margin the best language must have over the next
+const (
+	minWords  = 2
+	minMargin = 1
+)
+
+// latin picks the language whose common words text uses most. Letters
+// only some of them have, like ß or ñ, count as words too.
+func latin(text string) string {
+	lower := strings.ToLower(text)
+	scores := map[string]int{}
+	for _, word := range strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) && r != '\'' }) {
+		for _, lang := range commonWords[word] {
+			scores[lang]++
+		}
+	}
+	for _, hint := range letterHints {
+		if n := strings.Count(lower, hint.letters); n > 0 {
+			scores[hint.lang] += min(n, 3)
+		}
+	}
+	best, bestScore, second := "", 0, 0
+	for lang, score := range scores {
+		if score > bestScore {
+			best, bestScore, second = lang, score, bestScore
+		} else if score > second {
+			second = score
+		}
+	}
+	// A tie says nothing
+	if bestScore < minWords || bestScore-second < minMargin {
+		return ""
+	}
+	return best
+}
+
+// letterHints are letters, or pairs of them, that are common in one of
+// the languages and rare in the others
+var letterHints = []struct{ letters, lang string }{
+	{"ß", "de"}, {"ä", "de"}, {"ö", "de"}, {"ü", "de"},
+	{"ñ", "es"}, {"¿", "es"}, {"¡", "es"},
+	{"ç", "fr"}, {"œ", "fr"}, {"ê", "fr"},
+	{"ã", "pt"}, {"õ", "pt"}, {"ção", "pt"},
+	{"ij", "nl"},
+	{"ò", "it"}, {"ì", "it"},
+}
+
+// commonWords maps the most frequent short words of each language to the
+// languages they are frequent in
+var commonWords = func() map[string][]string {
+	words := map[string][]string{}
+	for lang, list := range map[string]string{
+		"en": `the and of to is in that it was for on are with as be this have not
+			at by from or you but they his her we an will would there their what
+			which can if has had been i my me do don't it's`,
+		"de": `der die das und ist nicht ein eine zu den mit von sich des auf für im
+			dem auch es sind wir ich sie er nach bei aus wie oder wenn noch nur
+			ist hat haben werden wird`,
+		"es": `el la los las de que y en un una por con para es del se no al lo como
+			más pero sus le ya o este está son muy también hay`,
+		"fr": `le la les de des et est un une du en que qui pour pas dans sur au avec
+			ce il elle nous vous sont par plus mais ou cette être je`,
+		"it": `il la le di che e un una per non del della sono con si lo gli nel
+			alla al anche come ma più questo è ho ha mia mio ci dei nella`,
+		"pt": `o a os as de que e do da em um uma para com não no na por mais se dos
+			das foi mas ao ele ela são também é`,
+		"nl": `de het een en van is dat die in te niet op zijn met voor er maar ook
+			als aan bij dit wordt naar zij ik we`,
+	} {
+		for _, word := range strings.Fields(list) {
+			if !slices.Contains(words[word], lang) {
+				words[word] = append(words[word], lang)
+			}
+		}
+	}
+	return words
+}()
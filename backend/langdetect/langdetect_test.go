@@ -0,0 +1,30 @@
+package langdetect
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := map[string]string{
+		"Meeting notes: we talked about the roadmap and what the team will do next":  "en",
+		"Einkaufsliste für das Wochenende: Brot, Käse und die Äpfel nicht vergessen": "de",
+		"Ideas para el viaje: visitar la playa y comer en un restaurante del puerto": "es",
+		"Il faut appeler le plombier pour la fuite dans la cuisine avant vendredi":   "fr",
+		"Domani vado al mercato con la mia amica, è una bella giornata":              "it",
+		"A reunião foi adiada para a próxima semana por causa da votação":            "pt",
+		"Morgen gaan we met de trein naar het strand, als het niet regent":           "nl",
+		"今天下午和团队讨论了新产品的发布计划":                                                         "zh",
+		"明日の会議は午後三時からです。資料を準備してください":                                                 "ja",
+		"내일 회의는 오후 세 시에 시작합니다":                                                       "ko",
+		"Завтра встреча с командой в три часа":                                       "ru",
+		"Завтра зустріч з командою о третій годині, і все":                           "uk",
+		"Αύριο η συνάντηση είναι στις τρεις":                                         "el",
+		"Groceries":                     "",
+		"TODO: 1234 5678":               "",
+		"xkcd qwrtz plmnb vrrp hjkl":    "",
+		"https://example.com/path/to/x": "",
+	}
+	for text, want := range tests {
+		if got := Detect(text); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
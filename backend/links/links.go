@@ -0,0 +1,94 @@
+// Package links finds the links from one note to others in its content
+package links
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NoteURL matches internal references to other notes, including ones
+// still using integer IDs. The first group is the ID.
+var NoteURL = regexp.MustCompile(`notty://note/([0-9a-fA-F]{8}-[0-9a-fA-F-]{27}|\d+)`)
+
+// wikiLink matches [[Target]] and [[Target|shown text]]
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|[^\[\]\n]*)?\]\]`)
+
+// uuid matches a note ID written as a wiki link target
+var uuid = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Link is a reference to a note by ID, or by title for wiki links that
+// name one
+type Link struct {
+	ID    string
+	Title string
+}
+
+// Parse returns the links in content, each once, in the order they first
+// appear
+func Parse(content string) []Link {
+	type found struct {
+		at   int
+		link Link
+	}
+	var all []found
+	for _, m := range NoteURL.FindAllStringSubmatchIndex(content, -1) {
+		all = append(all, found{m[0], Link{ID: content[m[2]:m[3]]}})
+	}
+	for _, m := range wikiLink.FindAllStringSubmatchIndex(content, -1) {
+		target := strings.TrimSpace(content[m[2]:m[3]])
+		switch {
+		case target == "":
+			continue
+		case uuid.MatchString(target):
+			all = append(all, found{m[0], Link{ID: strings.ToLower(target)}})
+		default:
+			all = append(all, found{m[0], Link{Title: target}})
+		}
+	}
+	// Both kinds were collected apart; put them back in reading order
+	sort.Slice(all, func(i, j int) bool { return all[i].at < all[j].at })
+	var list []Link
+	seen := map[Link]bool{}
+	for _, f := range all {
+		key := Link{ID: f.link.ID, Title: NormalizeTitle(f.link.Title)}
+		if !seen[key] {
+			seen[key] = true
+			list = append(list, f.link)
+		}
+	}
+	return list
+}
+
+// NormalizeTitle returns the form titles are matched in: without regard
+// to case or runs of spaces
+func NormalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// Replace points the links in content that to returns a note ID for at
+// that note instead. Wiki links keep the text they show.
+func Replace(content string, to func(Link) (string, bool)) string {
+	content = NoteURL.ReplaceAllStringFunc(content, func(m string) string {
+		if id, ok := to(Link{ID: NoteURL.FindStringSubmatch(m)[1]}); ok {
+			return "notty://note/" + id
+		}
+		return m
+	})
+	return wikiLink.ReplaceAllStringFunc(content, func(m string) string {
+		sub := wikiLink.FindStringSubmatchIndex(m)
+		target := strings.TrimSpace(m[sub[2]:sub[3]])
+		link := Link{Title: target}
+		if uuid.MatchString(target) {
+			link = Link{ID: strings.ToLower(target)}
+		}
+		id, ok := to(link)
+		if !ok || target == "" {
+			return m
+		}
+		if rest := m[sub[3]:]; rest != "]]" || link.ID != "" {
+			return "[[" + id + rest
+		}
+		return "[[" + id + "|" + target + "]]"
+	})
+}
@@ -1,28 +1,33 @@
 package main
 
 import (
-    "github.com/labstack/echo/v4"
-    "github.com/labstack/echo/v4/middleware"
-    "note/backend/handlers"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"note/backend/app"
+	"note/backend/config"
 )
 
 func main() {
-	// Create Echo instance
-	e := echo.New()
-
-	// Middleware
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
-
-	// Routes
-	e.GET("/api/notes", handlers.GetNotes)
-	e.POST("/api/notes", handlers.CreateNote)
-	e.GET("/api/notes/:id", handlers.GetNote)
-	e.PUT("/api/notes/:id", handlers.UpdateNote)
-	e.DELETE("/api/notes/:id", handlers.DeleteNote)
-
-	// Start server. If it fails to start, it will log the error and exit the program
-	e.Logger.Fatal(e.Start(":8080"))
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load config: ", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
+	a, err := app.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-}
\ No newline at end of file
+	// Run until interrupted, then let requests and jobs in progress finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := a.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package metering counts usage per workspace and calendar month for
+// chargeback and capacity planning, and holds workspaces to quotas on
+// what they use. Counts are kept in memory.
+package metering
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultWorkspace is the workspace everything is counted in while an
+// instance has no others
+const DefaultWorkspace = "default"
+
+// keepMonths is how many months of counts are kept, the current one
+// included
+const keepMonths = 24
+
+// Report is the usage of one workspace in one month (like "2026-10",
+// in UTC)
+type Report struct {
+	Month        string `json:"month"`
+	Workspace    string `json:"workspace"`
+	ActiveUsers  int    `json:"active_users"`
+	NotesCreated int    `json:"notes_created"`
+	StorageBytes int    `json:"storage_bytes"` // the most observed during the month
+	APICalls     int    `json:"api_calls"`
+
+	AICalls           int `json:"ai_calls"`
+	WebhookDeliveries int `json:"webhook_deliveries"`
+}
+
+type counts struct {
+	users             map[string]bool
+	notesCreated      int
+	storage           int
+	apiCalls          int
+	aiCalls           int
+	webhookDeliveries int
+}
+
+type key struct {
+	month     string
+	workspace string
+}
+
+// Meter collects the counts. The zero value is ready to use.
+type Meter struct {
+	mu     sync.Mutex
+	counts map[key]*counts
+	daily  map[key]int // API calls by day (like "2026-10-15") and workspace
+}
+
+// Month returns the month t falls in, as reports name it
+func Month(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// Day returns the day t falls in, in UTC like months
+func Day(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// get returns the counts of workspace this month. Callers must hold mu.
+func (m *Meter) get(workspace string) *counts {
+	now := time.Now()
+	k := key{Month(now), workspace}
+	c := m.counts[k]
+	if c == nil {
+		if m.counts == nil {
+			m.counts = map[key]*counts{}
+		}
+		c = &counts{users: map[string]bool{}}
+		m.counts[k] = c
+		m.prune(now)
+	}
+	return c
+}
+
+// prune drops months older than keepMonths. Callers must hold mu.
+func (m *Meter) prune(now time.Time) {
+	oldest := Month(now.UTC().AddDate(0, 1-keepMonths, 0))
+	for k := range m.counts {
+		if k.month < oldest {
+			delete(m.counts, k)
+		}
+	}
+}
+
+// APICall counts a request by user, who is active this month from then
+// on. An empty user is an anonymous request.
+func (m *Meter) APICall(workspace, user string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.get(workspace)
+	c.apiCalls++
+	if user != "" {
+		c.users[user] = true
+	}
+
+	k := key{Day(time.Now()), workspace}
+	if _, ok := m.daily[k]; !ok {
+		// Only today's counts are needed for quotas
+		for old := range m.daily {
+			if old.month != k.month {
+				delete(m.daily, old)
+			}
+		}
+		if m.daily == nil {
+			m.daily = map[key]int{}
+		}
+	}
+	m.daily[k]++
+}
+
+// NoteCreated counts a new note
+func (m *Meter) NoteCreated(workspace string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(workspace).notesCreated++
+}
+
+// Storage records the bytes workspace stores now
+func (m *Meter) Storage(workspace string, bytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.get(workspace)
+	c.storage = max(c.storage, bytes)
+}
+
+// Reports returns the usage of every workspace in month, or in every
+// month kept if month is empty, ordered by month and workspace
+func (m *Meter) Reports(month string) []Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reports := []Report{}
+	for k, c := range m.counts {
+		if month != "" && k.month != month {
+			continue
+		}
+		reports = append(reports, Report{
+			Month:        k.month,
+			Workspace:    k.workspace,
+			ActiveUsers:  len(c.users),
+			NotesCreated: c.notesCreated,
+			StorageBytes: c.storage,
+			APICalls:     c.apiCalls,
+
+			AICalls:           c.aiCalls,
+			WebhookDeliveries: c.webhookDeliveries,
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Month != reports[j].Month {
+			return reports[i].Month < reports[j].Month
+		}
+		return reports[i].Workspace < reports[j].Workspace
+	})
+	return reports
+}
+
+// WriteCSV writes reports as CSV with a header row
+func WriteCSV(w io.Writer, reports []Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"month", "workspace", "active_users", "notes_created", "storage_bytes", "api_calls", "ai_calls", "webhook_deliveries"})
+	for _, r := range reports {
+		cw.Write([]string{
+			r.Month,
+			r.Workspace,
+			strconv.Itoa(r.ActiveUsers),
+			strconv.Itoa(r.NotesCreated),
+			strconv.Itoa(r.StorageBytes),
+			strconv.Itoa(r.APICalls),
+			strconv.Itoa(r.AICalls),
+			strconv.Itoa(r.WebhookDeliveries),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,25 @@
+package metering
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Identify tells which workspace and user a request counts for. It runs
+// after the handler, so it sees what authentication stored in the context.
+type Identify func(c echo.Context) (workspace, user string)
+
+// Middleware counts every request to the API
+func Middleware(m *Meter, identify Identify) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if strings.HasPrefix(c.Request().URL.Path, "/api/") {
+				workspace, user := identify(c)
+				m.APICall(workspace, user)
+			}
+			return err
+		}
+	}
+}
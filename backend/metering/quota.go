@@ -0,0 +1,117 @@
+package metering
+
+import (
+	"fmt"
+	"time"
+)
+
+// Feature is something workspaces use that a quota can cap
+type Feature string
+
+const (
+	APIRequests       Feature = "api_requests"       // per day
+	AICalls           Feature = "ai_calls"           // per month
+	WebhookDeliveries Feature = "webhook_deliveries" // per month
+)
+
+// Features lists every feature with a quota
+var Features = []Feature{APIRequests, AICalls, WebhookDeliveries}
+
+// Period returns "day" or "month", what the use of f is counted over
+func (f Feature) Period() string {
+	if f == APIRequests {
+		return "day"
+	}
+	return "month"
+}
+
+// Resets returns when the period of f that t falls in ends
+func (f Feature) Resets(t time.Time) time.Time {
+	t = t.UTC()
+	if f.Period() == "day" {
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Quota caps the use of a feature per period; zero means no limit. Going
+// over a soft quota is allowed and only warned about, a hard one is
+// refused.
+type Quota struct {
+	Limit int  `json:"limit"`
+	Hard  bool `json:"hard"`
+}
+
+// Quotas are the quotas of a workspace by feature. Features without one
+// aren't limited.
+type Quotas map[Feature]Quota
+
+// Validate checks q only has known features and no negative limits
+func (q Quotas) Validate() error {
+	for f, quota := range q {
+		known := false
+		for _, feature := range Features {
+			known = known || f == feature
+		}
+		if !known {
+			return fmt.Errorf("unknown quota %q", f)
+		}
+		if quota.Limit < 0 {
+			return fmt.Errorf("quota of %s can't be negative", f)
+		}
+	}
+	return nil
+}
+
+// Decision is what a quota says about one more use of a feature
+type Decision int
+
+const (
+	Allow Decision = iota
+	Warn           // over a soft quota
+	Deny           // over a hard quota
+)
+
+// Used returns how much workspace used f in the current period
+func (m *Meter) Used(workspace string, f Feature) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f == APIRequests {
+		return m.daily[key{Day(time.Now()), workspace}]
+	}
+	c := m.counts[key{Month(time.Now()), workspace}]
+	switch {
+	case c == nil:
+		return 0
+	case f == AICalls:
+		return c.aiCalls
+	case f == WebhookDeliveries:
+		return c.webhookDeliveries
+	}
+	return 0
+}
+
+// Use counts one use of f by workspace. API requests are counted by
+// APICall.
+func (m *Meter) Use(workspace string, f Feature) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.get(workspace)
+	switch f {
+	case AICalls:
+		c.aiCalls++
+	case WebhookDeliveries:
+		c.webhookDeliveries++
+	}
+}
+
+// Check decides whether workspace may use f once more under q
+func (m *Meter) Check(workspace string, f Feature, q Quota) Decision {
+	if q.Limit == 0 || m.Used(workspace, f) < q.Limit {
+		return Allow
+	}
+	if q.Hard {
+		return Deny
+	}
+	return Warn
+}
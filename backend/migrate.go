@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"note/backend/config"
+	"note/backend/migrate"
+)
+
+const migrateUsage = `usage: notty migrate <command>
+
+commands:
+  up        apply the migrations not applied yet
+  down [N]  undo the last N migrations applied, 1 by default
+  status    list the migrations and when they were applied, and how far
+            background migrations got
+  background
+            run the background migrations the server would run, until
+            they are done
+
+The database is the one configured in database.driver and database.url,
+or NOTTY_DATABASE_DRIVER and NOTTY_DATABASE_URL.
+`
+
+// runMigrate runs the migrate subcommand and returns its exit code
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[0] != "down") {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	steps := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "notty migrate: invalid number of migrations %q\n", args[1])
+			return 2
+		}
+		steps = n
+	}
+	if cfg.Database.URL == "" {
+		fmt.Fprintln(os.Stderr, "notty migrate: no database configured")
+		return 1
+	}
+
+	m, err := migrate.Open(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "notty migrate:", err)
+		return 1
+	}
+	defer m.Close()
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		var done []migrate.Migration
+		done, err = m.Up(ctx)
+		report("applied", done)
+	case "down":
+		var done []migrate.Migration
+		done, err = m.Down(ctx, steps)
+		report("undid", done)
+	case "status":
+		err = printStatus(m)
+	case "background":
+		err = m.RunBackground(ctx, migrate.DefaultBatch, func(p migrate.Progress) {
+			fmt.Printf("\r%s: %.1f%% (%d of %d rows)", p.Name, p.Percent(), p.Done, p.Total)
+			if !p.FinishedAt.IsZero() {
+				fmt.Println()
+			}
+		})
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "notty migrate:", err)
+		return 1
+	}
+	return 0
+}
+
+func report(verb string, done []migrate.Migration) {
+	if len(done) == 0 {
+		fmt.Println("nothing to do")
+	}
+	for _, migration := range done {
+		fmt.Println(verb, migration)
+	}
+}
+
+func printStatus(m *migrate.Migrator) error {
+	list, err := m.Status(context.Background())
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tAPPLIED")
+	for _, s := range list {
+		applied := "pending"
+		if !s.AppliedAt.IsZero() {
+			applied = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", s.Migration, applied)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	background, err := m.BackgroundStatus(context.Background())
+	if err != nil || len(background) == 0 {
+		return err
+	}
+	fmt.Fprintln(w, "\nBACKGROUND MIGRATION\tPROGRESS")
+	for _, p := range background {
+		progress := "pending"
+		switch {
+		case !p.FinishedAt.IsZero():
+			progress = "finished " + p.FinishedAt.UTC().Format(time.RFC3339)
+		case !p.StartedAt.IsZero():
+			progress = fmt.Sprintf("%.1f%% (%d of %d rows)", p.Percent(), p.Done, p.Total)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", p.Name, progress)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,283 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"note/backend/sqlq"
+)
+
+// Background is a data migration that rewrites rows in batches while the
+// server runs, instead of holding up startup for as long as a schema
+// migration rewriting every row would. It runs once the schema has the
+// migration Requires, and readers must accept rows from before and after
+// it until it is done.
+type Background struct {
+	Name     string
+	Requires int
+
+	// Count returns how many rows there are to go over, for progress
+	Count func(ctx context.Context, db *sql.DB) (int64, error)
+	// Step migrates up to limit rows after cursor, "" for the first, in
+	// tx. It returns the cursor of the last row and how many it went
+	// over; fewer than limit means there are no more.
+	Step func(ctx context.Context, tx *sql.Tx, dialect sqlq.Dialect, cursor string, limit int) (string, int, error)
+}
+
+// Progress is how far a background migration got. A migration that
+// stopped, with the server, carries on from Cursor.
+type Progress struct {
+	Name       string    `json:"name"`
+	Cursor     string    `json:"cursor"`
+	Done       int64     `json:"done"`
+	Total      int64     `json:"total"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Percent is the share of rows gone over, 100 once finished
+func (p Progress) Percent() float64 {
+	if !p.FinishedAt.IsZero() || p.Total == 0 {
+		return 100
+	}
+	return min(100, 100*float64(p.Done)/float64(p.Total))
+}
+
+// DefaultBatch is how many rows background migrations rewrite per
+// transaction: few enough not to hold locks for long
+const DefaultBatch = 1000
+
+// ErrBackgroundRunning means another instance migrated the batch this
+// one was about to
+var ErrBackgroundRunning = errors.New("background migration is run by another instance")
+
+// backgroundMigrations are the data migrations built into the binary
+var backgroundMigrations = []Background{
+	{
+		Name:     "compress_content",
+		Requires: 2,
+		Count:    countNotes,
+		Step:     compressContent,
+	},
+}
+
+// BackgroundStatus lists the background migrations and how far each got.
+// Those not started have no StartedAt.
+func (m *Migrator) BackgroundStatus(ctx context.Context) ([]Progress, error) {
+	progress, err := m.progress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Progress, len(m.background))
+	for i, b := range m.background {
+		list[i] = progress[b.Name]
+		list[i].Name = b.Name
+	}
+	return list, nil
+}
+
+// RunBackground runs the background migrations the schema is ready for
+// until they are done or ctx ends, limit rows per transaction, and calls
+// report after every batch. Progress is kept in the database, so a
+// migration interrupted carries on where it stopped when run again.
+func (m *Migrator) RunBackground(ctx context.Context, limit int, report func(Progress)) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	progress, err := m.progress(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range m.background {
+		if _, ok := applied[b.Requires]; !ok {
+			continue
+		}
+		p, started := progress[b.Name]
+		if started && !p.FinishedAt.IsZero() {
+			continue
+		}
+		if !started {
+			if p, err = m.startBackground(ctx, b); err != nil {
+				return fmt.Errorf("background migration %s: %w", b.Name, err)
+			}
+		}
+		for p.FinishedAt.IsZero() {
+			if err := m.step(ctx, b, &p, limit); err != nil {
+				return fmt.Errorf("background migration %s: %w", b.Name, err)
+			}
+			if report != nil {
+				report(p)
+			}
+		}
+	}
+	return nil
+}
+
+// startBackground records that a background migration started, with the
+// rows it has to go over
+func (m *Migrator) startBackground(ctx context.Context, b Background) (Progress, error) {
+	total, err := b.Count(ctx, m.db)
+	if err != nil {
+		return Progress{}, err
+	}
+	p := Progress{Name: b.Name, Total: total, StartedAt: time.Now()}
+	_, err = m.db.ExecContext(ctx, "INSERT INTO background_migrations (name, cursor_at, rows_done, rows_total, started_at, finished_at) VALUES ("+
+		m.arg(1)+", "+m.arg(2)+", "+m.arg(3)+", "+m.arg(4)+", "+m.arg(5)+", "+m.arg(6)+")",
+		b.Name, "", int64(0), total, p.StartedAt.Unix(), int64(0))
+	return p, err
+}
+
+// step migrates one batch in a transaction, together with its progress.
+// The progress only moves on from the cursor the batch started at, so of
+// two instances running a migration only one commits each batch.
+func (m *Migrator) step(ctx context.Context, b Background, p *Progress, limit int) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	cursor, n, err := b.Step(ctx, tx, m.dialect, p.Cursor, limit)
+	if err != nil {
+		return err
+	}
+	var finished time.Time
+	if n < limit {
+		finished = time.Now()
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE background_migrations SET cursor_at = "+m.arg(1)+", rows_done = rows_done + "+m.arg(2)+
+		", finished_at = "+m.arg(3)+" WHERE name = "+m.arg(4)+" AND cursor_at = "+m.arg(5),
+		cursor, int64(n), unix(finished), b.Name, p.Cursor)
+	if err != nil {
+		return fmt.Errorf("recording progress: %w", err)
+	}
+	if updated, err := res.RowsAffected(); err != nil || updated != 1 {
+		return ErrBackgroundRunning
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	p.Cursor, p.Done, p.FinishedAt = cursor, p.Done+int64(n), finished
+	return nil
+}
+
+// progress creates the progress table if needed and returns the progress
+// of every background migration started, by name
+func (m *Migrator) progress(ctx context.Context) (map[string]Progress, error) {
+	if _, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS background_migrations (
+    name VARCHAR(255) PRIMARY KEY,
+    cursor_at VARCHAR(255) NOT NULL,
+    rows_done BIGINT NOT NULL,
+    rows_total BIGINT NOT NULL,
+    started_at BIGINT NOT NULL,
+    finished_at BIGINT NOT NULL
+)`); err != nil {
+		return nil, fmt.Errorf("creating background_migrations: %w", err)
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT name, cursor_at, rows_done, rows_total, started_at, finished_at FROM background_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	progress := map[string]Progress{}
+	for rows.Next() {
+		var p Progress
+		var started, finished int64
+		if err := rows.Scan(&p.Name, &p.Cursor, &p.Done, &p.Total, &started, &finished); err != nil {
+			return nil, err
+		}
+		p.StartedAt = time.Unix(started, 0)
+		if finished != 0 {
+			p.FinishedAt = time.Unix(finished, 0)
+		}
+		progress[p.Name] = p
+	}
+	return progress, rows.Err()
+}
+
+// checkUndoable fails if a background migration rewrote rows for the
+// schema of version, since its down migration can't rewrite them back
+func (m *Migrator) checkUndoable(ctx context.Context, version int) error {
+	if len(m.background) == 0 {
+		return nil
+	}
+	progress, err := m.progress(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range m.background {
+		if _, started := progress[b.Name]; started && b.Requires == version {
+			return fmt.Errorf("background migration %s already rewrote rows for version %d", b.Name, version)
+		}
+	}
+	return nil
+}
+
+// unix is t in seconds, 0 for the zero time
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func countNotes(ctx context.Context, db *sql.DB) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes").Scan(&n)
+	return n, err
+}
+
+// compressContent moves the content of notes stored plain to
+// content_compressed, gzipped, where that makes it smaller. Notes written
+// meanwhile may be stored either way, as DecodeContent reads both.
+func compressContent(ctx context.Context, tx *sql.Tx, dialect sqlq.Dialect, cursor string, limit int) (string, int, error) {
+	query, args := sqlq.From(sqlq.Notes).
+		Columns(sqlq.NoteID, sqlq.Content, sqlq.ContentEncoding).
+		Where(sqlq.Gt(sqlq.NoteID, cursor)).
+		OrderBy(sqlq.NoteID, false).
+		Limit(limit).
+		Build(dialect)
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return cursor, 0, err
+	}
+	type row struct{ id, content, encoding string }
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.content, &r.encoding); err != nil {
+			rows.Close()
+			return cursor, 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return cursor, 0, err
+	}
+
+	for _, r := range batch {
+		cursor = r.id
+		if r.encoding != sqlq.EncodingPlain {
+			continue
+		}
+		compressed, encoding := sqlq.EncodeContent(r.content)
+		if encoding == sqlq.EncodingPlain {
+			continue
+		}
+		update, args := sqlq.UpdateOf(sqlq.Notes).
+			Set(sqlq.Content, "").
+			Set(sqlq.ContentCompressed, compressed).
+			Set(sqlq.ContentEncoding, encoding).
+			Where(sqlq.Eq(sqlq.NoteID, r.id)).
+			Where(sqlq.Eq(sqlq.ContentEncoding, sqlq.EncodingPlain)).
+			Build(dialect)
+		if _, err := tx.ExecContext(ctx, update, args...); err != nil {
+			return cursor, 0, err
+		}
+	}
+	return cursor, len(batch), nil
+}
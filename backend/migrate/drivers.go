@@ -0,0 +1,8 @@
+package migrate
+
+// The database/sql drivers built into the binary: "pgx" for PostgreSQL
+// and "sqlite" for SQLite, which needs no cgo
+import (
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
@@ -0,0 +1,316 @@
+// Package migrate brings the schema of a SQL database up to date with the
+// binary. The migrations are SQL files embedded from migrations/, named
+// like 0001_create_notes.up.sql and 0001_create_notes.down.sql, and the
+// versions applied are recorded in the schema_migrations table. Each
+// statement in a file ends with a semicolon at the end of a line.
+//
+// Rewriting every row of a large table would hold up startup for hours,
+// so such data migrations run in the background instead, in batches,
+// once the schema migration they need is applied; see Background.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"note/backend/sqlq"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+// Migration is a schema change and how to undo it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, zero while it wasn't
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// ErrUnknownVersion means the database was migrated by a newer binary
+var ErrUnknownVersion = errors.New("database has migrations this binary doesn't know")
+
+// Embedded returns the migrations built into the binary
+func Embedded() ([]Migration, error) {
+	sub, err := fs.Sub(files, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// Load reads the migrations in the top directory of fsys, oldest first.
+// Every version needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, name := range names {
+		base, direction := strings.TrimSuffix(name, ".sql"), ""
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			base, direction = strings.TrimSuffix(base, ".up"), "up"
+		case strings.HasSuffix(base, ".down"):
+			base, direction = strings.TrimSuffix(base, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", name)
+		}
+		prefix, title, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 || title == "" {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_title.%s.sql", name, direction)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %s needs an up and a down file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sql.DB
+	dialect    sqlq.Dialect
+	migrations []Migration
+	background []Background
+}
+
+// New returns a migrator applying migrations to db
+func New(db *sql.DB, dialect sqlq.Dialect, migrations []Migration) *Migrator {
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}
+}
+
+// Open connects to the database at url through driver, "pgx" or
+// "sqlite", to apply the embedded migrations
+func Open(driver, url string) (*Migrator, error) {
+	migrations, err := Embedded()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver, url)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	m := New(db, DialectOf(driver), migrations)
+	m.background = backgroundMigrations
+	return m, nil
+}
+
+// DialectOf returns the placeholder style of a database/sql driver
+func DialectOf(driver string) sqlq.Dialect {
+	switch driver {
+	case "postgres", "pgx":
+		return sqlq.Dollar
+	}
+	return sqlq.Question
+}
+
+// Close closes the database
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Status lists the migrations and which of them were applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		list[i] = Status{Migration: migration, AppliedAt: applied[migration.Version]}
+	}
+	return list, nil
+}
+
+// Up applies the migrations not applied yet, oldest first, and returns
+// them. It refuses to touch a database a newer binary migrated.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkKnown(applied); err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.apply(ctx, migration, true); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down undoes the last steps migrations applied, newest first, and
+// returns them. Migrations a background migration rewrote rows for can't
+// be undone.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkKnown(applied); err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := m.checkUndoable(ctx, migration.Version); err != nil {
+			return done, err
+		}
+		if err := m.apply(ctx, migration, false); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// applied creates the version table if needed and returns when each
+// version in it was applied
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	if _, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at BIGINT NOT NULL
+)`); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version, at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[int(version)] = time.Unix(at, 0)
+	}
+	return applied, rows.Err()
+}
+
+// checkKnown fails if a version was applied that isn't among the
+// migrations, since their SQL may not fit the schema the database has
+func (m *Migrator) checkKnown(applied map[int]time.Time) error {
+	known := map[int]bool{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+	}
+	return nil
+}
+
+// apply runs a migration up or down in a transaction, together with the
+// change to the version table. A second instance migrating at the same
+// time fails on the version table instead of applying it twice.
+func (m *Migrator) apply(ctx context.Context, migration Migration, up bool) error {
+	script, record := migration.Down, "DELETE FROM schema_migrations WHERE version = "+m.arg(1)
+	args := []any{migration.Version}
+	if up {
+		script = migration.Up
+		record = "INSERT INTO schema_migrations (version, name, applied_at) VALUES (" + m.arg(1) + ", " + m.arg(2) + ", " + m.arg(3) + ")"
+		args = append(args, migration.Name, time.Now().Unix())
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range statements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %s: %w", migration, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("migration %s: recording version: %w", migration, err)
+	}
+	return tx.Commit()
+}
+
+// statements splits a script at the semicolons that end lines, since not
+// every driver runs several statements in one Exec
+func statements(script string) []string {
+	var list []string
+	var stmt strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		stmt.WriteString(line)
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if s := strings.TrimSpace(stmt.String()); s != ";" {
+				list = append(list, strings.TrimSuffix(s, ";"))
+			}
+			stmt.Reset()
+		}
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		list = append(list, s)
+	}
+	return list
+}
+
+// arg is the nth placeholder of a statement
+func (m *Migrator) arg(n int) string {
+	if m.dialect == sqlq.Dollar {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// String returns the name of a migration's files, like 0001_create_notes
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
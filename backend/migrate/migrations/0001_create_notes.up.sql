@@ -0,0 +1,34 @@
+-- items, private_sections and merged_from hold JSON arrays; location is
+-- split into location_lat and location_lng
+CREATE TABLE notes (
+    id VARCHAR(36) PRIMARY KEY,
+    legacy_id BIGINT NOT NULL DEFAULT 0,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    notebook VARCHAR(255) NOT NULL DEFAULT '',
+    published BOOLEAN NOT NULL DEFAULT FALSE,
+    items TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    remind_at TIMESTAMP NULL,
+    reminder_fired_at TIMESTAMP NULL,
+    remind_zone VARCHAR(64) NOT NULL DEFAULT '',
+    remind_local VARCHAR(32) NOT NULL DEFAULT '',
+    remind_repeat VARCHAR(16) NOT NULL DEFAULT '',
+    publish_at TIMESTAMP NULL,
+    published_at TIMESTAMP NULL,
+    content_encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    private_sections TEXT NOT NULL,
+    language VARCHAR(35) NOT NULL DEFAULT '',
+    language_detected BOOLEAN NOT NULL DEFAULT FALSE,
+    location_lat DOUBLE PRECISION NULL,
+    location_lng DOUBLE PRECISION NULL,
+    workspace VARCHAR(36) NOT NULL DEFAULT '',
+    owner VARCHAR(64) NOT NULL DEFAULT '',
+    merged_from TEXT NOT NULL,
+    copied_from VARCHAR(36) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX notes_notebook ON notes (notebook);
+CREATE INDEX notes_updated_at ON notes (updated_at);
+CREATE INDEX notes_workspace ON notes (workspace);
@@ -0,0 +1,2 @@
+ALTER TABLE notes DROP COLUMN content_compressed;
+ALTER TABLE notes DROP COLUMN content_encoding;
@@ -0,0 +1,4 @@
+-- Compressed content goes in content_compressed, leaving content empty,
+-- and content_encoding says how it is compressed
+ALTER TABLE notes ADD content_encoding VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE notes ADD content_compressed TEXT NULL;
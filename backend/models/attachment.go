@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Attachment describes a file stored with a note. The file itself is
+// served separately.
+type Attachment struct {
+	ID          string    `json:"id"`
+	NoteID      string    `json:"note_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	Width       int       `json:"width,omitempty"` // of images, in pixels
+	Height      int       `json:"height,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Operations recorded in the change log
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change is one entry of the change sequence log. Seq grows by one on
+// every write, so anything that consumed the log up to some Seq only
+// needs the entries after it to catch up.
+type Change struct {
+	Seq    int64     `json:"seq"`
+	Op     string    `json:"op"`
+	NoteID string    `json:"note_id"`
+	Note   *Note     `json:"note,omitempty"` // nil for deletes
+	At     time.Time `json:"at"`
+
+	// LeftWorkspace is the workspace an update moved the note out of
+	LeftWorkspace string `json:"left_workspace,omitempty"`
+}
+
+// In returns the change as a workspace sees it, or false if it is about
+// a note of another one. A note moving out of the workspace is deleted
+// there. Deletes don't say which workspace the note was in, so every
+// workspace sees them.
+func (c Change) In(workspace string) (Change, bool) {
+	switch {
+	case c.Op == ChangeDelete || c.Note.Workspace == workspace:
+		return c, true
+	case c.LeftWorkspace == workspace:
+		return Change{Seq: c.Seq, Op: ChangeDelete, NoteID: c.NoteID, At: c.At}, true
+	}
+	return Change{}, false
+}
+
+// UnmarshalJSON also accepts integer note IDs from before UUIDs
+func (c *Change) UnmarshalJSON(data []byte) error {
+	type plain Change
+	aux := struct {
+		*plain
+		NoteID json.RawMessage `json:"note_id"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	id, _, err := parseID(aux.NoteID)
+	c.NoteID = id
+	return err
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// legacyNamespace seeds the UUIDs of notes that were created with
+// sequential integer IDs
+var legacyNamespace = uuid.MustParse("6f0c8a52-3b57-4a4e-9d0e-3c1f6a1d2b7e")
+
+// NewNoteID returns a UUIDv7, which sorts by creation time like the old
+// integer IDs did.
+func NewNoteID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// NewItemID returns an ID for a checklist item
+func NewItemID() string {
+	return uuid.NewString()
+}
+
+// LegacyNoteID is the UUID a note with an integer ID migrates to. It is
+// derived from the integer, so old backups, change log entries and links
+// that refer to the same note all agree on it.
+func LegacyNoteID(n int) string {
+	return uuid.NewSHA1(legacyNamespace, []byte(strconv.Itoa(n))).String()
+}
+
+// ValidNoteID reports whether s is a well-formed note UUID
+func ValidNoteID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil && len(s) == 36
+}
+
+// ResolveNoteID reads a note ID from a URL or request. Integer IDs
+// resolve to the UUID their note was migrated to while acceptLegacy is set.
+func ResolveNoteID(s string, acceptLegacy bool) (string, bool) {
+	if ValidNoteID(s) {
+		return s, true
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 && acceptLegacy {
+		return LegacyNoteID(n), true
+	}
+	return "", false
+}
+
+// parseID reads an ID that is either a JSON string or, in data written
+// before the move to UUIDs, a JSON number. Legacy numbers are returned
+// as well so they can be kept for reference.
+func parseID(raw json.RawMessage) (id string, legacy int, err error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", 0, nil
+	}
+	if raw[0] == '"' {
+		err = json.Unmarshal(raw, &id)
+		return id, 0, err
+	}
+	if err = json.Unmarshal(raw, &legacy); err != nil {
+		return "", 0, err
+	}
+	return LegacyNoteID(legacy), legacy, nil
+}
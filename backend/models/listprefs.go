@@ -0,0 +1,50 @@
+package models
+
+import "fmt"
+
+// Fields note lists can be sorted by, and the ways they can be grouped
+const (
+	SortCreated = "created_at"
+	SortUpdated = "updated_at"
+	SortTitle   = "title"
+
+	GroupNone     = "none"
+	GroupNotebook = "notebook"
+)
+
+// MaxPageSize is the most notes a page of a list can have
+const MaxPageSize = 500
+
+// ListPreferences are how a user likes note lists when a request doesn't
+// say. Without a Sort notes come in the order they are stored; dates sort
+// newest first and titles A to Z unless Order says otherwise. A PageSize
+// of 0 lists every note.
+type ListPreferences struct {
+	Sort     string `json:"sort,omitempty"`
+	Order    string `json:"order,omitempty"` // asc or desc
+	PageSize int    `json:"page_size,omitempty"`
+	Group    string `json:"group,omitempty"`
+}
+
+// Validate reports the first setting that isn't one of the known ones
+func (p ListPreferences) Validate() error {
+	switch {
+	case p.Sort != "" && p.Sort != SortCreated && p.Sort != SortUpdated && p.Sort != SortTitle:
+		return fmt.Errorf("sort must be %s, %s or %s", SortCreated, SortUpdated, SortTitle)
+	case p.Order != "" && p.Order != "asc" && p.Order != "desc":
+		return fmt.Errorf("order must be asc or desc")
+	case p.PageSize < 0 || p.PageSize > MaxPageSize:
+		return fmt.Errorf("page_size must be 0 to %d", MaxPageSize)
+	case p.Group != "" && p.Group != GroupNone && p.Group != GroupNotebook:
+		return fmt.Errorf("group must be %s or %s", GroupNone, GroupNotebook)
+	}
+	return nil
+}
+
+// Descending reports whether lists are sorted in descending order
+func (p ListPreferences) Descending() bool {
+	if p.Order != "" {
+		return p.Order == "desc"
+	}
+	return p.Sort == SortCreated || p.Sort == SortUpdated
+}
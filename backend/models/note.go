@@ -1,11 +1,129 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"note/backend/geo"
+	"regexp"
+	"time"
+)
 
 type Note struct {
-	ID int `json:"id"`
-	Title string `json:"title"`
-	Content string `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        string     `json:"id"`
+	LegacyID  int        `json:"legacy_id,omitempty"` // integer ID the note had before UUIDs
+	Title     string     `json:"title"`
+	Content   string     `json:"content"`
+	Notebook  string     `json:"notebook,omitempty"`
+	Published bool       `json:"published"`
+	Items     []TodoItem `json:"items,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// RemindAt is when the owner wants to be reminded of the note.
+	// ReminderFiredAt is set by the server once that reminder went out.
+	RemindAt        *time.Time `json:"remind_at,omitempty"`
+	ReminderFiredAt *time.Time `json:"reminder_fired_at,omitempty"`
+
+	// RemindZone is the IANA time zone the reminder was set in, like
+	// "Europe/Berlin", and RemindLocal its wall-clock time there, like
+	// "2026-03-29T09:00:00". With both, the server derives RemindAt from
+	// them. RemindRepeat fires the reminder again daily, weekly, monthly or
+	// yearly at the same wall-clock time, moving RemindAt to the next time.
+	RemindZone   string `json:"remind_zone,omitempty"`
+	RemindLocal  string `json:"remind_local,omitempty"`
+	RemindRepeat string `json:"remind_repeat,omitempty"`
+
+	// PublishAt schedules an unpublished note to be published. Once it is,
+	// the server clears PublishAt and sets PublishedAt, which it also sets
+	// when a note is published right away.
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+
+	// ContentEncrypted marks Content as a blob the client encrypted. The
+	// server stores and returns it as is and never tries to read it.
+	ContentEncrypted bool `json:"content_encrypted,omitempty"`
+
+	// PrivateSections names the headings whose sections are stripped when
+	// the note is shared, published or embedded, on top of any blocks
+	// between <!-- private --> and <!-- /private -->
+	PrivateSections []string `json:"private_sections,omitempty"`
+
+	// Language is the language the note is written in, like "de" or
+	// "pt-BR". Search analyzes notes without one, or in a language it has
+	// no analyzer for, in the instance's default language.
+	Language string `json:"language,omitempty"`
+
+	// LanguageDetected marks Language as detected from the text when the
+	// note was saved rather than set by the client. Detected languages are
+	// detected again on every save; set ones are kept.
+	LanguageDetected bool `json:"language_detected,omitempty"`
+
+	// Location is where the note was written or what place it is about
+	Location *geo.Point `json:"location,omitempty"`
+
+	// Workspace is the workspace the note belongs to; empty for the
+	// default one. It is set when the note is created and only changes
+	// when the note is transferred to another workspace.
+	Workspace string `json:"workspace,omitempty"`
+
+	// Owner is the ID of the API key that created the note. Notes created
+	// without one belong to the instance.
+	Owner string `json:"owner,omitempty"`
+
+	// MergedFrom lists the notes that were merged into this one
+	MergedFrom []string `json:"merged_from,omitempty"`
+
+	// CopiedFrom is the note in another workspace this one is a copy of
+	CopiedFrom string `json:"copied_from,omitempty"`
+}
+
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ValidLanguage reports whether lang looks like a language tag such as
+// "en" or "zh-Hant"; the empty string stands for none
+func ValidLanguage(lang string) bool {
+	return lang == "" || languageTag.MatchString(lang)
 }
 
+// UnmarshalJSON also accepts notes with an integer ID, as found in
+// backups taken before the move to UUIDs
+func (n *Note) UnmarshalJSON(data []byte) error {
+	type plain Note
+	aux := struct {
+		*plain
+		ID json.RawMessage `json:"id"`
+	}{plain: (*plain)(n)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	id, legacy, err := parseID(aux.ID)
+	if err != nil {
+		return err
+	}
+	n.ID = id
+	if legacy != 0 {
+		n.LegacyID = legacy
+	}
+	return nil
+}
+
+// SetPublished keeps PublishAt and PublishedAt in line with Published
+// after a write; prev is the note before it, nil for new notes
+func (n *Note) SetPublished(prev *Note, now time.Time) {
+	if !n.Published {
+		n.PublishedAt = nil
+		return
+	}
+	n.PublishAt = nil
+	n.PublishedAt = &now
+	if prev != nil && prev.Published && prev.PublishedAt != nil {
+		n.PublishedAt = prev.PublishedAt
+	}
+}
+
+// SameReminder reports whether two notes have the same reminder time
+func (n Note) SameReminder(other Note) bool {
+	if n.RemindAt == nil || other.RemindAt == nil {
+		return n.RemindAt == other.RemindAt
+	}
+	return n.RemindAt.Equal(*other.RemindAt)
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ReadingPosition is where a user left off reading a note. Offset is a
+// byte offset into the content, Progress how far down the note that is
+// from 0 to 1; Anchor can name a heading or item to scroll to instead.
+type ReadingPosition struct {
+	Offset    int       `json:"offset"`
+	Progress  float64   `json:"progress"`
+	Anchor    string    `json:"anchor,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Types of relations between notes. Each reads from From to To, e.g. From
+// blocks To; related-to goes both ways.
+const (
+	RelationBlocks    = "blocks"
+	RelationRelatedTo = "related-to"
+	RelationParentOf  = "parent-of"
+)
+
+// ValidRelationType reports whether t is one of the relation types
+func ValidRelationType(t string) bool {
+	return t == RelationBlocks || t == RelationRelatedTo || t == RelationParentOf
+}
+
+// Relation is a typed link from one note to another
+type Relation struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	CreatedAt time.Time `json:"created_at"`
+}
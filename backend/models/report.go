@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Reasons a note can be reported for
+const (
+	ReportSpam    = "spam"
+	ReportAbuse   = "abuse"
+	ReportIllegal = "illegal"
+	ReportOther   = "other"
+)
+
+// Report states. A report is open until a moderator resolves it.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportResolved  = "resolved"
+)
+
+// Report is a complaint about a publicly shared note
+type Report struct {
+	ID         string     `json:"id"`
+	NoteID     string     `json:"note_id"`
+	ShareToken string     `json:"share_token"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"`
+	Action     string     `json:"action,omitempty"` // what the moderator did
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Share is a link that gives anyone holding Token read access to one
+// note, or to the notes its owner keeps in a notebook
+type Share struct {
+	Token     string    `json:"token"`
+	NoteID    string    `json:"note_id,omitempty"`
+	Notebook  string    `json:"notebook,omitempty"`
+	Owner     string    `json:"-"`
+	Workspace string    `json:"-"` // of the notes a notebook share gives access to
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Template is a starting point for new notes
+type Template struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	Notebook    string     `json:"notebook,omitempty"` // where notes made from it go
+	Items       []TodoItem `json:"items,omitempty"`
+	Pack        string     `json:"pack,omitempty"` // name of the pack it was imported from
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "sort"
+
+// TodoItem is one entry of a note's checklist
+type TodoItem struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	Done     bool   `json:"done"`
+	Position int    `json:"position"`
+}
+
+// NormalizeItems gives new items an ID and renumbers positions 0..n-1 in
+// the order the client asked for. Ties keep the order they came in.
+func NormalizeItems(items []TodoItem) []TodoItem {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Position < items[j].Position })
+	for i := range items {
+		if items[i].ID == "" {
+			items[i].ID = NewItemID()
+		}
+		items[i].Position = i
+	}
+	return items
+}
+
+// MoveItem moves the item at index from to index to and renumbers
+func MoveItem(items []TodoItem, from, to int) []TodoItem {
+	item := items[from]
+	items = append(items[:from], items[from+1:]...)
+	items = append(items[:to], append([]TodoItem{item}, items[to:]...)...)
+	for i := range items {
+		items[i].Position = i
+	}
+	return items
+}
+
+// HasOpenItems reports whether any checklist item is still to do
+func (n Note) HasOpenItems() bool {
+	for _, item := range n.Items {
+		if !item.Done {
+			return true
+		}
+	}
+	return false
+}
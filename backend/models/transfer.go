@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Transfer states. A transfer is pending until its recipient accepts or
+// declines it, its sender cancels it or it expires.
+const (
+	TransferPending  = "pending"
+	TransferAccepted = "accepted"
+	TransferDeclined = "declined"
+	TransferCanceled = "canceled"
+	TransferExpired  = "expired"
+)
+
+// Transfer hands notes over to another user, another workspace or both,
+// once the recipient consents
+type Transfer struct {
+	ID            string     `json:"id"`
+	NoteIDs       []string   `json:"note_ids"`
+	Notebook      string     `json:"notebook,omitempty"` // set for notebook transfers
+	From          string     `json:"from"`               // API key the notes belong to
+	FromWorkspace string     `json:"from_workspace,omitempty"`
+	ToUser        string     `json:"to_user,omitempty"`
+	ToWorkspace   string     `json:"to_workspace,omitempty"`
+	Status        string     `json:"status"`
+	Moved         []string   `json:"moved,omitempty"` // notes moved once accepted
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+}
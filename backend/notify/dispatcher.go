@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Notifier delivers events on one channel
+type Notifier interface {
+	Notify(Event) error
+}
+
+// Sink takes events to dispatch, like a Dispatcher or a queue feeding
+// one
+type Sink interface {
+	Dispatch(Event)
+}
+
+// DigestNotifier is implemented by notifiers that can deliver a batch of
+// events as a single message. Notifiers without it get the batched events
+// one by one when the digest is flushed.
+type DigestNotifier interface {
+	NotifyDigest([]Event) error
+}
+
+// Dispatcher sends events to the notifiers of every channel the
+// preferences of their workspace allow for them
+type Dispatcher struct {
+	mu        sync.RWMutex
+	prefs     map[string]Preferences // by workspace
+	notifiers map[Channel][]Notifier
+
+	// pending holds the events batched per workspace and channel for the
+	// next digest
+	pendingMu sync.Mutex
+	pending   map[digest][]Event
+}
+
+// digest is a batch of events: those of one workspace on one channel
+type digest struct {
+	workspace string
+	channel   Channel
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		prefs:     make(map[string]Preferences),
+		notifiers: make(map[Channel][]Notifier),
+		pending:   make(map[digest][]Event),
+	}
+}
+
+// Register adds a notifier for a channel
+func (d *Dispatcher) Register(ch Channel, n Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers[ch] = append(d.notifiers[ch], n)
+}
+
+// Preferences returns the current preferences of a workspace
+func (d *Dispatcher) Preferences(workspace string) Preferences {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.prefs[workspace]
+}
+
+// SetPreferences replaces the preferences of a workspace after validating
+// them
+func (d *Dispatcher) SetPreferences(workspace string, p Preferences) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prefs[workspace] = p
+	return nil
+}
+
+// Dispatch delivers an event, or queues it for the channel's next digest
+// when the preferences batch that channel. Reminders are never batched.
+// A failing notifier is logged and doesn't stop delivery elsewhere.
+func (d *Dispatcher) Dispatch(e Event) {
+	d.mu.RLock()
+	prefs := d.prefs[e.Workspace]
+	var now []Notifier
+	for _, ch := range Channels {
+		if !prefs.Enabled(e.Type, e.Notebook, ch) || len(d.notifiers[ch]) == 0 {
+			continue
+		}
+		if window := prefs.Digest[ch]; window > 0 && e.Type != ReminderDue {
+			d.enqueue(digest{e.Workspace, ch}, e, time.Duration(window))
+			continue
+		}
+		now = append(now, d.notifiers[ch]...)
+	}
+	d.mu.RUnlock()
+
+	for _, n := range now {
+		if err := n.Notify(e); err != nil {
+			log.Printf("notify %s for note %s: %v", e.Type, e.NoteID, err)
+		}
+	}
+}
+
+// enqueue adds an event to a digest. The first event of a batch starts the
+// window; everything arriving before it closes goes out with it.
+func (d *Dispatcher) enqueue(batch digest, e Event, window time.Duration) {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	if len(d.pending[batch]) == 0 {
+		time.AfterFunc(window, func() { d.flush(batch) })
+	}
+	d.pending[batch] = append(d.pending[batch], e)
+}
+
+// Flush delivers every pending digest right away, e.g. before shutdown
+func (d *Dispatcher) Flush() {
+	d.pendingMu.Lock()
+	batches := make([]digest, 0, len(d.pending))
+	for batch := range d.pending {
+		batches = append(batches, batch)
+	}
+	d.pendingMu.Unlock()
+	for _, batch := range batches {
+		d.flush(batch)
+	}
+}
+
+func (d *Dispatcher) flush(batch digest) {
+	d.pendingMu.Lock()
+	events := d.pending[batch]
+	delete(d.pending, batch)
+	d.pendingMu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+
+	ch := batch.channel
+	d.mu.RLock()
+	notifiers := d.notifiers[ch]
+	d.mu.RUnlock()
+	for _, n := range notifiers {
+		if dn, ok := n.(DigestNotifier); ok {
+			if err := dn.NotifyDigest(events); err != nil {
+				log.Printf("notify digest of %d events on %s: %v", len(events), ch, err)
+			}
+			continue
+		}
+		for _, e := range events {
+			if err := n.Notify(e); err != nil {
+				log.Printf("notify %s for note %s: %v", e.Type, e.NoteID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"note/backend/email"
+	"strings"
+)
+
+// EmailNotifier sends every event as an email over SMTP, rendered from
+// Templates
+type EmailNotifier struct {
+	Addr      string // host:port of the SMTP server
+	Username  string // no authentication when empty
+	Password  string
+	From      string
+	To        []string
+	Templates *email.Templates
+}
+
+func (m *EmailNotifier) Notify(e Event) error {
+	msg, err := EventEmail(m.Templates, e)
+	if err != nil {
+		return err
+	}
+	return m.Send(msg, nil)
+}
+
+// NotifyDigest sends one email summing up a batch of events, with all
+// events on the same note folded into a single line
+func (m *EmailNotifier) NotifyDigest(events []Event) error {
+	msg, err := DigestEmail(m.Templates, events)
+	if err != nil {
+		return err
+	}
+	return m.Send(msg, nil)
+}
+
+// Send sends a message to the addresses in to, or to m.To when it is empty
+func (m *EmailNotifier) Send(msg email.Message, to []string) error {
+	if len(to) == 0 {
+		to = m.To
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, to, msg.Bytes(m.From, to))
+}
+
+// EventEmail renders the email about one event
+func EventEmail(t *email.Templates, e Event) (email.Message, error) {
+	return t.Render("event", email.Data{"Summary": summary(e), "Event": e})
+}
+
+// digestLine is what happened to one note in a digest
+type digestLine struct {
+	Title   string
+	Changes string
+}
+
+// DigestEmail renders the email summing up a batch of events
+func DigestEmail(t *email.Templates, events []Event) (email.Message, error) {
+	type noteSummary struct {
+		title  string
+		counts map[EventType]int
+		order  []EventType
+	}
+	var order []string
+	notes := make(map[string]*noteSummary)
+	for _, e := range events {
+		s, ok := notes[e.NoteID]
+		if !ok {
+			s = &noteSummary{counts: make(map[EventType]int)}
+			notes[e.NoteID] = s
+			order = append(order, e.NoteID)
+		}
+		s.title = e.Title // latest title wins
+		if s.counts[e.Type] == 0 {
+			s.order = append(s.order, e.Type)
+		}
+		s.counts[e.Type]++
+	}
+
+	lines := make([]digestLine, 0, len(order))
+	for _, id := range order {
+		s := notes[id]
+		var parts []string
+		for _, t := range s.order {
+			part := verb(t)
+			if n := s.counts[t]; n > 1 {
+				part += fmt.Sprintf(" %d times", n)
+			}
+			parts = append(parts, part)
+		}
+		lines = append(lines, digestLine{oneLine(s.title), strings.Join(parts, ", ")})
+	}
+	return t.Render("digest", email.Data{"Notes": lines, "Events": events})
+}
+
+// summary describes an event in a line, the default subject of its email
+func summary(e Event) string {
+	title := oneLine(e.Title)
+	switch e.Type {
+	case ReminderDue:
+		return "Reminder: " + title
+	case NoteCreated:
+		return "Note created: " + title
+	case NoteUpdated:
+		return "Note updated: " + title
+	case NoteDeleted:
+		return "Note deleted: " + title
+	case NoteShared:
+		return "Note shared: " + title
+	case NotePublished:
+		return "Note published: " + title
+	case NoteModerated:
+		return "Moderation notice: " + title
+	}
+	return string(e.Type) + ": " + title
+}
+
+// verb describes an event type in a digest line
+func verb(t EventType) string {
+	switch t {
+	case NoteCreated:
+		return "created"
+	case NoteUpdated:
+		return "updated"
+	case NoteDeleted:
+		return "deleted"
+	case NoteShared:
+		return "shared"
+	case ReminderDue:
+		return "reminder due"
+	case NotePublished:
+		return "published"
+	case NoteModerated:
+		return "moderated"
+	}
+	return string(t)
+}
+
+// oneLine keeps user input from breaking out of a header or list line
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
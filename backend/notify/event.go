@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"note/backend/models"
+	"time"
+)
+
+// EventType is something that happened that users may want to hear about
+type EventType string
+
+const (
+	NoteCreated EventType = "note.created"
+	NoteUpdated EventType = "note.updated"
+	NoteDeleted EventType = "note.deleted"
+	NoteShared  EventType = "note.shared"
+	ReminderDue EventType = "reminder.due"
+
+	// NotePublished is sent when a note scheduled for publishing goes out
+	NotePublished EventType = "note.published"
+
+	// NoteModerated tells the owner a moderator acted on their note
+	NoteModerated EventType = "note.moderated"
+)
+
+// EventTypes lists every known event type
+var EventTypes = []EventType{NoteCreated, NoteUpdated, NoteDeleted, NoteShared, ReminderDue, NotePublished, NoteModerated}
+
+// Channel is a way of delivering a notification
+type Channel string
+
+const (
+	ChannelInApp Channel = "in_app"
+	ChannelEmail Channel = "email"
+	ChannelPush  Channel = "push"
+	// ChannelWebhook is the instance's own webhook URL
+	ChannelWebhook Channel = "webhook"
+	// ChannelSubscriptions are the webhooks registered through the API,
+	// each for the events it picked
+	ChannelSubscriptions Channel = "subscriptions"
+)
+
+// Channels lists every known channel
+var Channels = []Channel{ChannelInApp, ChannelEmail, ChannelPush, ChannelWebhook, ChannelSubscriptions}
+
+// Event is handed to the dispatcher whenever something notifiable happens
+type Event struct {
+	Type      EventType `json:"type"`
+	NoteID    string    `json:"note_id"`
+	Title     string    `json:"title"`
+	Notebook  string    `json:"notebook,omitempty"`
+	Workspace string    `json:"workspace,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	At        time.Time `json:"at"`
+
+	// Note is the note after the change; nil for deletes
+	Note *models.Note `json:"note,omitempty"`
+}
+
+func validEventType(t EventType) bool {
+	for _, known := range EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+func validChannel(ch Channel) bool {
+	for _, known := range Channels {
+		if ch == known {
+			return true
+		}
+	}
+	return false
+}
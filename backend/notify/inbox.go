@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Notification is an event as shown in the in-app notification list
+type Notification struct {
+	ID    string `json:"id"`
+	Event Event  `json:"event"`
+	Read  bool   `json:"read"`
+}
+
+// Inbox is the in-app channel. It keeps the most recent notifications.
+type Inbox struct {
+	mu     sync.Mutex
+	size   int
+	nextID int
+	items  []Notification
+}
+
+func NewInbox(size int) *Inbox {
+	return &Inbox{size: size}
+}
+
+// Notify stores an event, dropping the oldest one when the inbox is full
+func (in *Inbox) Notify(e Event) error {
+	e.Note = nil // the list only needs to point at the note
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.nextID++
+	in.items = append(in.items, Notification{ID: strconv.Itoa(in.nextID), Event: e})
+	if len(in.items) > in.size {
+		in.items = in.items[len(in.items)-in.size:]
+	}
+	return nil
+}
+
+// List returns the notifications about a workspace, newest first
+func (in *Inbox) List(workspace string) []Notification {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	list := []Notification{}
+	for i := len(in.items) - 1; i >= 0; i-- {
+		if in.items[i].Event.Workspace == workspace {
+			list = append(list, in.items[i])
+		}
+	}
+	return list
+}
+
+// MarkRead marks a notification about a workspace as read and reports
+// whether it exists
+func (in *Inbox) MarkRead(id, workspace string) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for i := range in.items {
+		if in.items[i].ID == id && in.items[i].Event.Workspace == workspace {
+			in.items[i].Read = true
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Matrix switches channels on or off per event type. Missing entries
+// fall through to the next, less specific level.
+type Matrix map[EventType]map[Channel]bool
+
+// Preferences decide which channels the events of a workspace go out on.
+// Defaults apply to the whole workspace; notebook overrides win over them
+// for events on notes in that notebook.
+//
+// Digest batches a channel: instead of one message per event, everything
+// that happens within the window goes out as a single digest.
+type Preferences struct {
+	Defaults  Matrix             `json:"defaults"`
+	Notebooks map[string]Matrix  `json:"notebooks"`
+	Digest    map[Channel]Window `json:"digest,omitempty"`
+}
+
+// maxDigestWindow keeps digests from holding notifications back for days
+const maxDigestWindow = 24 * time.Hour
+
+// Window is a digest batching window, written as a duration like "15m"
+type Window time.Duration
+
+func (w Window) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(w).String())
+}
+
+func (w *Window) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*w = Window(d)
+	return nil
+}
+
+// builtin is used where neither an override nor a default is set: only
+// in-app notifications and webhook subscriptions, which pick their own
+// events when they are registered, are on until someone configures more. Reminders
+// and scheduled publishing, which users asked for explicitly, and
+// moderation notices, which owners must not miss, go out everywhere.
+func builtin(t EventType, ch Channel) bool {
+	return ch == ChannelInApp || ch == ChannelSubscriptions || t == ReminderDue || t == NotePublished || t == NoteModerated
+}
+
+// Enabled resolves whether an event of type t in notebook should be sent
+// on channel ch
+func (p Preferences) Enabled(t EventType, notebook string, ch Channel) bool {
+	if on, ok := p.Notebooks[notebook][t][ch]; ok && notebook != "" {
+		return on
+	}
+	if on, ok := p.Defaults[t][ch]; ok {
+		return on
+	}
+	return builtin(t, ch)
+}
+
+// Validate rejects unknown event types and channels
+func (p Preferences) Validate() error {
+	check := func(m Matrix) error {
+		for t, channels := range m {
+			if !validEventType(t) {
+				return fmt.Errorf("unknown event type %q", t)
+			}
+			for ch := range channels {
+				if !validChannel(ch) {
+					return fmt.Errorf("unknown channel %q", ch)
+				}
+			}
+		}
+		return nil
+	}
+	if err := check(p.Defaults); err != nil {
+		return err
+	}
+	for ch, window := range p.Digest {
+		if !validChannel(ch) {
+			return fmt.Errorf("unknown channel %q", ch)
+		}
+		if window < 0 || time.Duration(window) > maxDigestWindow {
+			return fmt.Errorf("digest window for %s must be between 0 and %s", ch, maxDigestWindow)
+		}
+	}
+	for notebook, m := range p.Notebooks {
+		if notebook == "" {
+			return fmt.Errorf("notebook override without a notebook name")
+		}
+		if err := check(m); err != nil {
+			return fmt.Errorf("notebook %s: %w", notebook, err)
+		}
+	}
+	return nil
+}
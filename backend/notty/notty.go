@@ -0,0 +1,87 @@
+// Package notty embeds Notty in other Go programs. New returns the notes
+// API as an http.Handler to mount under the program's own router, and
+// Start and Stop run the background workers (jobs, reminders, publishing,
+// backups) within the program's lifecycle:
+//
+//	n, err := notty.New(notty.DefaultConfig())
+//	...
+//	mux.Handle("/notes/", http.StripPrefix("/notes", n.Handler()))
+//	if err := n.Start(ctx); err != nil { ... }
+//	defer n.Stop(shutdownCtx)
+//
+// Notes are kept in package state, so a program embeds one instance.
+package notty
+
+import (
+	"context"
+	"net/http"
+
+	"note/backend/app"
+	"note/backend/config"
+)
+
+// Config configures an instance; see the config package for the fields
+type Config = config.Config
+
+// Component is something run along with the background workers
+type Component = app.Component
+
+// DefaultConfig returns the configuration Notty runs with when nothing is
+// set, to change before calling New
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// LoadConfig reads the configuration like the notty server does, from the
+// file at NOTTY_CONFIG and the NOTTY_* environment variables
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// Notty is an embedded instance
+type Notty struct {
+	app *app.App
+}
+
+// New sets up an instance. Its Addr and TLS settings are ignored; the
+// gRPC and mail servers still listen on their own addresses once set.
+// A process has one instance: New fails with app.ErrExists after the
+// first.
+func New(cfg *Config) (*Notty, error) {
+	a, err := app.Embedded(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Notty{app: a}, nil
+}
+
+// Handler serves the API under /api/ and the web app, when it was built
+// in, everywhere else. Mounted under a prefix, strip it first.
+func (n *Notty) Handler() http.Handler {
+	return n.app.Echo()
+}
+
+// Register adds a component to start after the background workers and
+// stop before them. The gRPC and mail servers only start listening once
+// it started.
+func (n *Notty) Register(c Component) {
+	n.app.Register(c)
+}
+
+// Start restores backups, if configured, and starts the background
+// workers. The handler may be served before, but reminders, published
+// notes and queued jobs wait for Start.
+func (n *Notty) Start(ctx context.Context) error {
+	return n.app.Start(ctx)
+}
+
+// Stop stops the background workers, letting jobs in progress finish
+// until ctx is done
+func (n *Notty) Stop(ctx context.Context) error {
+	return n.app.Stop(ctx)
+}
+
+// Failed reports the first worker or server that broke down after Start
+func (n *Notty) Failed() <-chan error {
+	return n.app.Failed()
+}
@@ -0,0 +1,40 @@
+// Package publish publishes notes whose scheduled publishing time came
+package publish
+
+import (
+	"context"
+	"note/backend/models"
+	"note/backend/notify"
+	"time"
+)
+
+// Source hands out notes that are due to be published. It must publish
+// them so the next poll doesn't return them again.
+type Source interface {
+	Due(now time.Time) []models.Note
+}
+
+// Run polls src every interval and dispatches a NotePublished event for
+// every note it published, until ctx is done.
+func Run(ctx context.Context, src Source, d notify.Sink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		for _, note := range src.Due(now) {
+			d.Dispatch(notify.Event{
+				Type:     notify.NotePublished,
+				NoteID:   note.ID,
+				Title:    note.Title,
+				Notebook: note.Notebook,
+				At:       *note.PublishedAt,
+				Note:     &note,
+			})
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"crypto/subtle"
+	"note/backend/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ByToken puts requests with the admin token in the admin tier, requests
+// with a token valid in any of stores in the authenticated tier, and
+// everything else in the anonymous tier, limited by client IP
+func ByToken(adminSecret string, stores ...*auth.TokenStore) Identify {
+	return func(c echo.Context) (Tier, string) {
+		secret := auth.BearerToken(c.Request())
+		if secret == "" {
+			secret = c.QueryParam("token")
+		}
+		if secret != "" {
+			if adminSecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(adminSecret)) == 1 {
+				return Admin, "admin"
+			}
+			for _, store := range stores {
+				if token, err := store.Lookup(secret); err == nil {
+					return Authenticated, token.ID
+				}
+			}
+		}
+		return Anonymous, c.RealIP()
+	}
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// Tier is the class of traffic a request is limited as
+type Tier string
+
+const (
+	Anonymous     Tier = "anonymous"
+	Authenticated Tier = "authenticated"
+	Admin         Tier = "admin"
+)
+
+// Limit allows PerSecond requests on average with bursts of up to Burst.
+// A PerSecond of zero means no limit.
+type Limit struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+// Policy holds the limit of every tier and per-route overrides. Routes
+// are keyed by their pattern, e.g. "/api/notes/:id/export", and only
+// override the tiers they list. An overridden route is counted apart from
+// all other traffic.
+type Policy struct {
+	Tiers  map[Tier]Limit            `json:"tiers"`
+	Routes map[string]map[Tier]Limit `json:"routes"`
+}
+
+// DefaultPolicy is generous enough for the web app and stops scrapers.
+// Exports build whole zip files, so they get a much tighter budget.
+func DefaultPolicy() Policy {
+	return Policy{
+		Tiers: map[Tier]Limit{
+			Anonymous:     {PerSecond: 5, Burst: 20},
+			Authenticated: {PerSecond: 20, Burst: 60},
+			Admin:         {},
+		},
+		Routes: map[string]map[Tier]Limit{
+			"/api/export": {
+				Anonymous:     {PerSecond: 0.1, Burst: 2},
+				Authenticated: {PerSecond: 0.5, Burst: 5},
+			},
+			"/api/notes/:id/export": {
+				Anonymous:     {PerSecond: 0.5, Burst: 5},
+				Authenticated: {PerSecond: 2, Burst: 10},
+			},
+		},
+	}
+}
+
+// Merge returns p with the tiers and routes in overrides replacing its own
+func (p Policy) Merge(overrides Policy) Policy {
+	merged := Policy{Tiers: map[Tier]Limit{}, Routes: map[string]map[Tier]Limit{}}
+	for _, src := range []Policy{p, overrides} {
+		for tier, limit := range src.Tiers {
+			merged.Tiers[tier] = limit
+		}
+		for route, limits := range src.Routes {
+			merged.Routes[route] = limits
+		}
+	}
+	return merged
+}
+
+// limit returns the limit for a tier on a route and whether the route
+// has its own budget
+func (p Policy) limit(route string, tier Tier) (Limit, bool) {
+	if limits, ok := p.Routes[route]; ok {
+		if limit, ok := limits[tier]; ok {
+			return limit, true
+		}
+	}
+	return p.Tiers[tier], false
+}
+
+// Identify tells which tier a request belongs to and who made it, e.g. a
+// client IP or a token ID. Each client has its own budget.
+type Identify func(c echo.Context) (tier Tier, client string)
+
+// Middleware enforces policy on every request and answers 429 with a
+// Retry-After header once a client is out of budget
+func Middleware(policy Policy, identify Identify) echo.MiddlewareFunc {
+	l := &limiters{buckets: make(map[string]*bucket)}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tier, client := identify(c)
+			limit, own := policy.limit(c.Path(), tier)
+			if limit.PerSecond <= 0 {
+				return next(c)
+			}
+			key := string(tier) + "|" + client
+			if own {
+				key += "|" + c.Path()
+			}
+			reservation := l.get(key, limit).Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				reservation.Cancel()
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many requests"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// idleAfter is how long a client's budget is kept after its last request.
+// By then it has refilled, so dropping it changes nothing.
+const idleAfter = 10 * time.Minute
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type limiters struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func (l *limiters) get(key string, limit Limit) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) > idleAfter {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleAfter {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.PerSecond), max(limit.Burst, 1))}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
@@ -0,0 +1,92 @@
+// Package redact strips the parts of a note its owner marked private
+// before the note is shown to anyone else
+package redact
+
+import "strings"
+
+// Lines that open and close a private block anywhere in a note
+const (
+	Open  = "<!-- private -->"
+	Close = "<!-- /private -->"
+)
+
+// Content removes from Markdown content every block between Open and
+// Close and every section under one of the given headings, down to the
+// next heading of the same or a higher level. Headings match without
+// regard to case. A block that is never closed runs to the end, so a
+// missing Close hides too much rather than too little.
+func Content(content string, headings []string) string {
+	private := make(map[string]bool, len(headings))
+	for _, h := range headings {
+		if h = normalize(h); h != "" {
+			private[h] = true
+		}
+	}
+	var kept []string
+	inBlock := false  // between Open and Close
+	sectionLevel := 0 // level of the private heading being skipped, 0 if none
+	fence := ""       // marker of the code block we are in, if any
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inBlock:
+			if strings.EqualFold(trimmed, Close) {
+				inBlock = false
+			}
+			continue
+		case fence == "" && strings.EqualFold(trimmed, Open):
+			inBlock = true
+			continue
+		}
+		if marker := fenceMarker(trimmed); marker != "" {
+			if fence == "" {
+				fence = marker
+			} else if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		} else if level, text := heading(trimmed); fence == "" && level > 0 {
+			if sectionLevel > 0 && level <= sectionLevel {
+				sectionLevel = 0
+			}
+			if sectionLevel == 0 && private[normalize(text)] {
+				sectionLevel = level
+			}
+		}
+		if sectionLevel == 0 {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// heading returns the level and text of an ATX heading like "## Plans",
+// or 0 if the line isn't one
+func heading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	text := strings.TrimSpace(line[level:])
+	// A closing sequence of #s isn't part of the text
+	if stripped := strings.TrimRight(text, "#"); stripped == "" || strings.HasSuffix(stripped, " ") {
+		text = strings.TrimSpace(stripped)
+	}
+	return level, text
+}
+
+// fenceMarker returns the ``` or ~~~ that opens or closes a code block
+func fenceMarker(line string) string {
+	for _, c := range []string{"```", "~~~"} {
+		if strings.HasPrefix(line, c) {
+			return c
+		}
+	}
+	return ""
+}
+
+func normalize(heading string) string {
+	return strings.ToLower(strings.Join(strings.Fields(heading), " "))
+}
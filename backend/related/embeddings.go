@@ -0,0 +1,73 @@
+package related
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Embedder turns texts into embedding vectors, one per text
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HTTPEmbedder gets embeddings from a service speaking the OpenAI
+// embeddings API, which most hosted and local model servers do
+type HTTPEmbedder struct {
+	URL    string // like https://api.openai.com/v1/embeddings
+	Model  string
+	APIKey string // sent as a bearer token when set
+	Client *http.Client
+}
+
+func NewHTTPEmbedder(url, model, apiKey string) *HTTPEmbedder {
+	return &HTTPEmbedder{URL: url, Model: model, APIKey: apiKey, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": e.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+	res, err := e.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("embeddings service answered %s", res.Status)
+	}
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding embeddings: %w", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding for input %d of %d", d.Index, len(texts))
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,207 @@
+// Package related recommends notes like a given one: by the hashtags they
+// share, by how close they are in the graph of links and relations and,
+// with an embedding model, by how close their content is in meaning.
+package related
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Note is what recommendations compare of a note
+type Note struct {
+	ID     string
+	Tags   []string
+	Vector []float32 // the embedding of its content, if there is one
+}
+
+// Graph lists the notes each note is linked or related to, either way
+type Graph map[string][]string
+
+// Connect adds an edge between two notes
+func (g Graph) Connect(a, b string) {
+	if a != b {
+		g[a] = append(g[a], b)
+		g[b] = append(g[b], a)
+	}
+}
+
+// MaxHops is how far apart in the graph notes still count as close
+const MaxHops = 3
+
+// hops returns how many edges away from id each note within MaxHops is
+func (g Graph) hops(id string) map[string]int {
+	dist := map[string]int{id: 0}
+	queue := []string{id}
+	for len(queue) > 0 {
+		at := queue[0]
+		queue = queue[1:]
+		if dist[at] == MaxHops {
+			continue
+		}
+		for _, next := range g[at] {
+			if _, seen := dist[next]; !seen {
+				dist[next] = dist[at] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return dist
+}
+
+// Signals are how alike two notes are, each from 0 to 1
+type Signals struct {
+	Tags  float64 `json:"tags"`  // shared hashtags over all their hashtags
+	Links float64 `json:"links"` // 1 for linked notes, 1/2 two hops apart and so on
+	// Embedding is the cosine similarity of the notes' embeddings, when
+	// both have one
+	Embedding *float64 `json:"embedding,omitempty"`
+}
+
+// Strategy ranks notes by their signals; higher scores rank first and
+// notes scoring 0 are left out
+type Strategy interface {
+	Score(s Signals) float64
+}
+
+// StrategyFunc is a Strategy as a function
+type StrategyFunc func(s Signals) float64
+
+func (f StrategyFunc) Score(s Signals) float64 { return f(s) }
+
+// Weighted scores notes by the weighted mean of their signals. Without an
+// embedding its weight is left out, so scores stay comparable.
+type Weighted struct {
+	Tags, Links, Embedding float64
+}
+
+func (w Weighted) Score(s Signals) float64 {
+	sum, weights := w.Tags*s.Tags+w.Links*s.Links, w.Tags+w.Links
+	if s.Embedding != nil {
+		sum += w.Embedding * max(*s.Embedding, 0)
+		weights += w.Embedding
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// Strongest scores notes by their strongest signal
+var Strongest = StrategyFunc(func(s Signals) float64 {
+	score := max(s.Tags, s.Links)
+	if s.Embedding != nil {
+		score = max(score, *s.Embedding)
+	}
+	return score
+})
+
+// DefaultStrategy is the strategy of Find without another
+const DefaultStrategy = "weighted"
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]Strategy{
+		DefaultStrategy: Weighted{Tags: 1, Links: 1, Embedding: 2},
+		"strongest":     Strongest,
+	}
+)
+
+// Register makes a strategy available under name, replacing any there was
+func Register(name string, s Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	strategies[name] = s
+}
+
+// Lookup returns the strategy registered under name
+func Lookup(name string) (Strategy, bool) {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	s, ok := strategies[name]
+	return s, ok
+}
+
+// Result is a note recommended and why
+type Result struct {
+	ID      string  `json:"id"`
+	Score   float64 `json:"score"`
+	Signals Signals `json:"signals"`
+}
+
+// Find ranks the candidates by how like note they are, best first and by
+// ID among equals, and returns up to limit of them. note itself and
+// candidates scoring 0 are left out.
+func Find(note Note, candidates []Note, g Graph, s Strategy, limit int) []Result {
+	dist := g.hops(note.ID)
+	tags := set(note.Tags)
+	list := []Result{}
+	for _, c := range candidates {
+		if c.ID == note.ID {
+			continue
+		}
+		var signals Signals
+		signals.Tags = jaccard(tags, set(c.Tags))
+		if d, ok := dist[c.ID]; ok {
+			signals.Links = 1 / float64(d)
+		}
+		if note.Vector != nil && c.Vector != nil {
+			if sim, ok := cosine(note.Vector, c.Vector); ok {
+				signals.Embedding = &sim
+			}
+		}
+		if score := s.Score(signals); score > 0 {
+			list = append(list, Result{ID: c.ID, Score: score, Signals: signals})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].ID < list[j].ID
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+func set(list []string) map[string]bool {
+	s := make(map[string]bool, len(list))
+	for _, v := range list {
+		s[v] = true
+	}
+	return s
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	shared := 0
+	for v := range a {
+		if b[v] {
+			shared++
+		}
+	}
+	if all := len(a) + len(b) - shared; all > 0 {
+		return float64(shared) / float64(all)
+	}
+	return 0
+}
+
+// cosine returns the cosine similarity of two vectors of the same length
+// that aren't zero
+func cosine(a, b []float32) (float64, bool) {
+	if len(a) != len(b) {
+		return 0, false
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0, false
+	}
+	return dot / math.Sqrt(na*nb), true
+}
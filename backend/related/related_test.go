@@ -0,0 +1,101 @@
+package related
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	g := Graph{}
+	g.Connect("a", "b")
+	g.Connect("b", "c")
+	g.Connect("c", "d")
+	g.Connect("d", "e") // four hops from a: too far
+	notes := []Note{
+		{ID: "a", Tags: []string{"go", "db"}},
+		{ID: "b"},
+		{ID: "c", Tags: []string{"go", "db"}},
+		{ID: "d"},
+		{ID: "e", Tags: []string{"go", "web", "css"}},
+		{ID: "f"},
+	}
+
+	got := Find(notes[0], notes, g, Weighted{Tags: 1, Links: 1}, 10)
+	want := map[string]float64{"c": 0.75, "b": 0.5, "d": 1.0 / 6, "e": 0.125}
+	order := []string{"c", "b", "d", "e"}
+	if len(got) != len(order) {
+		t.Fatalf("Find = %+v, want %v", got, order)
+	}
+	for i, r := range got {
+		if r.ID != order[i] || r.Score != want[r.ID] {
+			t.Errorf("result %d = %s scoring %v, want %s scoring %v", i, r.ID, r.Score, order[i], want[order[i]])
+		}
+	}
+	if got := Find(notes[0], notes, g, Weighted{Tags: 1, Links: 1}, 2); len(got) != 2 {
+		t.Errorf("limit 2 found %d", len(got))
+	}
+	// b is linked, c has the same tags: equals go by ID
+	if got := Find(notes[0], notes, g, Strongest, 2); got[0].ID != "b" || got[1].ID != "c" || got[1].Score != 1 {
+		t.Errorf("strongest = %+v, want b and c scoring 1", got)
+	}
+}
+
+func TestEmbeddingSignal(t *testing.T) {
+	of := Note{ID: "a", Vector: []float32{1, 0}}
+	candidates := []Note{
+		{ID: "same", Vector: []float32{2, 0}},
+		{ID: "opposite", Vector: []float32{-1, 0}},
+		{ID: "unembedded", Tags: nil},
+	}
+	got := Find(of, candidates, Graph{}, Weighted{Tags: 1, Links: 1, Embedding: 2}, 10)
+	if len(got) != 1 || got[0].ID != "same" || got[0].Score != 0.5 || *got[0].Signals.Embedding != 1 {
+		t.Errorf("Find = %+v, want only the note with the same direction, scoring 0.5", got)
+	}
+
+	// Without embeddings their weight doesn't dilute the other signals
+	if score := (Weighted{Tags: 1, Links: 1, Embedding: 2}).Score(Signals{Tags: 1, Links: 1}); score != 1 {
+		t.Errorf("score without embedding = %v, want 1", score)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if _, ok := Lookup("newest"); ok {
+		t.Fatal("found a strategy before registering it")
+	}
+	Register("newest", StrategyFunc(func(s Signals) float64 { return s.Links }))
+	if s, ok := Lookup("newest"); !ok || s.Score(Signals{Tags: 1, Links: 0.5}) != 0.5 {
+		t.Error("registered strategy not found")
+	}
+}
+
+func TestHTTPEmbedder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get("Authorization") != "Bearer key" || req.Model != "small" || len(req.Input) != 2 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		// Out of order, as the API allows
+		w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	defer srv.Close()
+
+	e := NewHTTPEmbedder(srv.URL, "small", "key")
+	vectors, err := e.Embed(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("vectors = %v", vectors)
+	}
+	if _, err := NewHTTPEmbedder(srv.URL, "small", "wrong").Embed(context.Background(), []string{"a", "b"}); err == nil {
+		t.Error("a refused request didn't fail")
+	}
+}
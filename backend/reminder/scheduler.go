@@ -0,0 +1,38 @@
+package reminder
+
+import (
+	"context"
+	"note/backend/models"
+	"note/backend/notify"
+	"time"
+)
+
+// Source hands out reminders that are due. It must mark them as fired so
+// the next poll doesn't return them again.
+type Source interface {
+	Due(now time.Time) []models.Note
+}
+
+// Run polls src every interval and dispatches a ReminderDue event for
+// every reminder that came due, until ctx is done.
+func Run(ctx context.Context, src Source, d notify.Sink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		for _, note := range src.Due(now) {
+			d.Dispatch(notify.Event{
+				Type:     notify.ReminderDue,
+				NoteID:   note.ID,
+				Title:    note.Title,
+				Notebook: note.Notebook,
+				At:       *note.RemindAt,
+			})
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package reminder
+
+import (
+	"errors"
+	"time"
+	_ "time/tzdata" // zones resolve on hosts without a tz database too
+)
+
+// LocalLayout is how wall-clock reminder times are written
+const LocalLayout = "2006-01-02T15:04:05"
+
+// How often a reminder repeats
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Yearly  = "yearly"
+)
+
+var (
+	ErrBadZone   = errors.New("unknown time zone")
+	ErrBadLocal  = errors.New("local time must look like 2006-01-02T15:04:05")
+	ErrBadRepeat = errors.New("repeat must be daily, weekly, monthly or yearly")
+)
+
+// Schedule is a reminder set on a wall clock: Local in the IANA time zone
+// Zone, repeating every Repeat unless that is empty. Firings stay at the
+// same wall-clock time when the zone's offset changes, as it does for
+// daylight saving time.
+type Schedule struct {
+	Zone   string
+	Local  string
+	Repeat string
+}
+
+// parse checks a schedule and returns its zone and first wall-clock time.
+// The wall-clock time is in UTC, only its fields mean anything.
+func (s Schedule) parse() (*time.Location, time.Time, error) {
+	loc, err := time.LoadLocation(s.Zone)
+	if err != nil || s.Zone == "" || s.Zone == "Local" {
+		return nil, time.Time{}, ErrBadZone
+	}
+	wall, err := time.Parse(LocalLayout, s.Local)
+	if err != nil {
+		return nil, time.Time{}, ErrBadLocal
+	}
+	switch s.Repeat {
+	case "", Daily, Weekly, Monthly, Yearly:
+	default:
+		return nil, time.Time{}, ErrBadRepeat
+	}
+	return loc, wall, nil
+}
+
+// Validate reports what is wrong with a schedule, if anything
+func (s Schedule) Validate() error {
+	_, _, err := s.parse()
+	return err
+}
+
+// Next returns the first firing of the schedule after t. A reminder that
+// doesn't repeat only fires once, at its local time, and has no firing
+// after that.
+func (s Schedule) Next(t time.Time) (time.Time, bool, error) {
+	loc, wall, err := s.parse()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	first := Resolve(wall, loc)
+	if s.Repeat == "" || first.After(t) {
+		return first, first.After(t), nil
+	}
+	// Skip close to t right away rather than stepping through years of
+	// daily firings; the estimate errs on the early side
+	k := int(t.Sub(first)/longest(s.Repeat)) - 1
+	for k = max(k, 1); ; k++ {
+		if at := Resolve(step(wall, s.Repeat, k), loc); at.After(t) {
+			return at, true, nil
+		}
+	}
+}
+
+// Local returns the wall-clock time of t in zone, as a Schedule's Local
+func Local(t time.Time, zone string) (string, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil || zone == "" || zone == "Local" {
+		return "", ErrBadZone
+	}
+	return t.In(loc).Format(LocalLayout), nil
+}
+
+// longest is the longest a repeat can take, allowing for an hour of
+// daylight saving time
+func longest(repeat string) time.Duration {
+	day := 24 * time.Hour
+	switch repeat {
+	case Weekly:
+		return 7*day + time.Hour
+	case Monthly:
+		return 31*day + time.Hour
+	case Yearly:
+		return 366*day + time.Hour
+	}
+	return day + time.Hour
+}
+
+// step moves a wall-clock time k repeats on. Monthly and yearly reminders
+// on days a month doesn't have, like the 31st or February 29th, fire on
+// its last day instead.
+func step(wall time.Time, repeat string, k int) time.Time {
+	y, m, d := wall.Date()
+	switch repeat {
+	case Daily:
+		d += k
+	case Weekly:
+		d += 7 * k
+	case Monthly:
+		m += time.Month(k)
+	case Yearly:
+		y += k
+	}
+	if repeat == Monthly || repeat == Yearly {
+		last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		d = min(d, last)
+	}
+	h, mi, s := wall.Clock()
+	return time.Date(y, m, d, h, mi, s, 0, time.UTC)
+}
+
+// Resolve returns the instant a wall-clock time is reached in loc. The
+// fields of wall are read as they are, its location is ignored. A time
+// that happens twice, when clocks are turned back, resolves to the first
+// time; one that is skipped, when clocks are turned forward, to as long
+// after the skip as it would have been after the time before it. That is
+// 3:30 for 2:30 when clocks skip from 2:00 to 3:00.
+func Resolve(wall time.Time, loc *time.Location) time.Time {
+	y, mo, d := wall.Date()
+	h, mi, s := wall.Clock()
+	naive := time.Date(y, mo, d, h, mi, s, 0, time.UTC)
+
+	// The zone's offsets on either side of any change around the time
+	_, before := naive.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := naive.Add(24 * time.Hour).In(loc).Zone()
+	// The larger offset gives the earlier instant
+	for _, offset := range []int{max(before, after), min(before, after)} {
+		t := naive.Add(-time.Duration(offset) * time.Second)
+		local := t.In(loc)
+		if ly, lmo, ld := local.Date(); ly == y && lmo == mo && ld == d {
+			if lh, lmi, ls := local.Clock(); lh == h && lmi == mi && ls == s {
+				return t
+			}
+		}
+	}
+	return naive.Add(-time.Duration(before) * time.Second)
+}
@@ -0,0 +1,191 @@
+package reminder
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func wall(s string) time.Time {
+	t, err := time.Parse(LocalLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestResolve(t *testing.T) {
+	for _, tt := range []struct {
+		name, zone, local, want string
+	}{
+		{"standard time", "America/New_York", "2026-01-15T09:00:00", "2026-01-15T14:00:00Z"},
+		{"daylight saving time", "America/New_York", "2026-07-15T09:00:00", "2026-07-15T13:00:00Z"},
+		{"skipped in spring", "America/New_York", "2026-03-08T02:30:00", "2026-03-08T07:30:00Z"},
+		{"right after the skip", "America/New_York", "2026-03-08T03:00:00", "2026-03-08T07:00:00Z"},
+		{"repeated in autumn", "America/New_York", "2026-11-01T01:30:00", "2026-11-01T05:30:00Z"},
+		{"right after the repeat", "America/New_York", "2026-11-01T02:00:00", "2026-11-01T07:00:00Z"},
+		{"skipped in Europe", "Europe/Berlin", "2026-03-29T02:15:00", "2026-03-29T01:15:00Z"},
+		{"repeated in Europe", "Europe/Berlin", "2026-10-25T02:15:00", "2026-10-25T00:15:00Z"},
+		{"southern hemisphere", "Australia/Sydney", "2026-04-05T02:30:00", "2026-04-04T15:30:00Z"},
+		{"half-hour shift", "Australia/Lord_Howe", "2026-10-04T02:15:00", "2026-10-03T15:45:00Z"},
+		{"no daylight saving time", "Asia/Tokyo", "2026-03-08T02:30:00", "2026-03-07T17:30:00Z"},
+	} {
+		loc, err := time.LoadLocation(tt.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Resolve(wall(tt.local), loc); !got.Equal(utc(tt.want)) {
+			t.Errorf("%s: Resolve(%s in %s) = %s, want %s", tt.name, tt.local, tt.zone, got.UTC().Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+// firings returns the next n firings of s after from
+func firings(t *testing.T, s Schedule, from time.Time, n int) []string {
+	t.Helper()
+	var got []string
+	for range n {
+		next, ok, err := s.Next(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, next.UTC().Format(time.RFC3339))
+		from = next
+	}
+	return got
+}
+
+func checkFirings(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("firings = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("firing %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNextKeepsWallClockAcrossDST(t *testing.T) {
+	s := Schedule{Zone: "America/New_York", Local: "2026-03-07T09:00:00", Repeat: Daily}
+	checkFirings(t, firings(t, s, utc("2026-03-07T00:00:00Z"), 3),
+		"2026-03-07T14:00:00Z", // EST
+		"2026-03-08T13:00:00Z", // EDT from here
+		"2026-03-09T13:00:00Z",
+	)
+
+	s = Schedule{Zone: "America/New_York", Local: "2026-10-31T09:00:00", Repeat: Daily}
+	checkFirings(t, firings(t, s, utc("2026-10-31T00:00:00Z"), 3),
+		"2026-10-31T13:00:00Z",
+		"2026-11-01T14:00:00Z",
+		"2026-11-02T14:00:00Z",
+	)
+}
+
+func TestNextInSkippedHour(t *testing.T) {
+	// 2:30 doesn't exist on the day clocks skip it, the reminder fires at
+	// 3:30 then and at 2:30 again the day after
+	s := Schedule{Zone: "America/New_York", Local: "2026-03-07T02:30:00", Repeat: Daily}
+	checkFirings(t, firings(t, s, utc("2026-03-07T00:00:00Z"), 3),
+		"2026-03-07T07:30:00Z",
+		"2026-03-08T07:30:00Z", // 3:30 EDT
+		"2026-03-09T06:30:00Z", // 2:30 EDT
+	)
+}
+
+func TestNextInRepeatedHour(t *testing.T) {
+	// 1:30 happens twice on the day clocks are turned back, the reminder
+	// fires once
+	s := Schedule{Zone: "America/New_York", Local: "2026-10-31T01:30:00", Repeat: Daily}
+	checkFirings(t, firings(t, s, utc("2026-10-31T00:00:00Z"), 3),
+		"2026-10-31T05:30:00Z",
+		"2026-11-01T05:30:00Z", // 1:30 EDT, not again at 1:30 EST
+		"2026-11-02T06:30:00Z",
+	)
+}
+
+func TestNextSkippedDay(t *testing.T) {
+	// Samoa skipped December 30th, 2011 when it moved across the date line
+	s := Schedule{Zone: "Pacific/Apia", Local: "2011-12-29T09:00:00", Repeat: Daily}
+	checkFirings(t, firings(t, s, utc("2011-12-29T00:00:00Z"), 3),
+		"2011-12-29T19:00:00Z",
+		"2011-12-30T19:00:00Z", // December 31st
+		"2011-12-31T19:00:00Z",
+	)
+}
+
+func TestNextWeeklyAcrossDST(t *testing.T) {
+	s := Schedule{Zone: "Europe/Berlin", Local: "2026-03-23T08:00:00", Repeat: Weekly}
+	checkFirings(t, firings(t, s, utc("2026-03-01T00:00:00Z"), 2),
+		"2026-03-23T07:00:00Z",
+		"2026-03-30T06:00:00Z",
+	)
+}
+
+func TestNextMonthlyOnLastDays(t *testing.T) {
+	s := Schedule{Zone: "UTC", Local: "2026-01-31T12:00:00", Repeat: Monthly}
+	checkFirings(t, firings(t, s, utc("2026-01-01T00:00:00Z"), 4),
+		"2026-01-31T12:00:00Z",
+		"2026-02-28T12:00:00Z",
+		"2026-03-31T12:00:00Z",
+		"2026-04-30T12:00:00Z",
+	)
+
+	s = Schedule{Zone: "UTC", Local: "2028-02-29T12:00:00", Repeat: Yearly}
+	checkFirings(t, firings(t, s, utc("2028-01-01T00:00:00Z"), 2),
+		"2028-02-29T12:00:00Z",
+		"2029-02-28T12:00:00Z",
+	)
+}
+
+func TestNextLongAfterStart(t *testing.T) {
+	s := Schedule{Zone: "America/New_York", Local: "2016-03-13T02:30:00", Repeat: Daily}
+	next, ok, err := s.Next(utc("2026-03-08T00:00:00Z"))
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if want := utc("2026-03-08T07:30:00Z"); !next.Equal(want) {
+		t.Errorf("Next = %s, want %s", next.UTC(), want)
+	}
+}
+
+func TestNextOnce(t *testing.T) {
+	s := Schedule{Zone: "Europe/London", Local: "2026-03-29T01:30:00"}
+	next, ok, err := s.Next(utc("2026-03-01T00:00:00Z"))
+	if err != nil || !ok || !next.Equal(utc("2026-03-29T01:30:00Z")) {
+		t.Errorf("Next = %s, %v, %v", next, ok, err)
+	}
+	if _, ok, _ := s.Next(next); ok {
+		t.Error("a reminder that doesn't repeat fired twice")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		s    Schedule
+		want error
+	}{
+		{Schedule{Zone: "Europe/Paris", Local: "2026-05-01T08:00:00", Repeat: Weekly}, nil},
+		{Schedule{Zone: "Mars/Olympus", Local: "2026-05-01T08:00:00"}, ErrBadZone},
+		{Schedule{Zone: "", Local: "2026-05-01T08:00:00"}, ErrBadZone},
+		{Schedule{Zone: "Local", Local: "2026-05-01T08:00:00"}, ErrBadZone},
+		{Schedule{Zone: "UTC", Local: "2026-05-01 08:00"}, ErrBadLocal},
+		{Schedule{Zone: "UTC", Local: "2026-05-01T08:00:00", Repeat: "hourly"}, ErrBadRepeat},
+	} {
+		if err := tt.s.Validate(); !errors.Is(err, tt.want) {
+			t.Errorf("Validate(%+v) = %v, want %v", tt.s, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"note/backend/models"
+	"note/backend/rpc/pb"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toProto(note models.Note) *pb.Note {
+	msg := &pb.Note{
+		Id:               note.ID,
+		LegacyId:         int64(note.LegacyID),
+		Title:            note.Title,
+		Content:          note.Content,
+		Notebook:         note.Notebook,
+		Published:        note.Published,
+		CreatedAt:        timestamppb.New(note.CreatedAt),
+		UpdatedAt:        timestamppb.New(note.UpdatedAt),
+		RemindAt:         timestampOrNil(note.RemindAt),
+		ReminderFiredAt:  timestampOrNil(note.ReminderFiredAt),
+		ContentEncrypted: note.ContentEncrypted,
+	}
+	for _, item := range note.Items {
+		msg.Items = append(msg.Items, &pb.TodoItem{
+			Id:       item.ID,
+			Text:     item.Text,
+			Done:     item.Done,
+			Position: int32(item.Position),
+		})
+	}
+	return msg
+}
+
+// fromProto reads the fields a client may set. The store fills in the
+// rest, so IDs and timestamps other than remind_at are ignored.
+func fromProto(msg *pb.Note) models.Note {
+	note := models.Note{
+		Title:            msg.GetTitle(),
+		Content:          msg.GetContent(),
+		Notebook:         msg.GetNotebook(),
+		Published:        msg.GetPublished(),
+		ContentEncrypted: msg.GetContentEncrypted(),
+	}
+	if msg.GetRemindAt() != nil {
+		remindAt := msg.GetRemindAt().AsTime()
+		note.RemindAt = &remindAt
+	}
+	for _, item := range msg.GetItems() {
+		note.Items = append(note.Items, models.TodoItem{
+			ID:       item.GetId(),
+			Text:     item.GetText(),
+			Done:     item.GetDone(),
+			Position: int(item.GetPosition()),
+		})
+	}
+	return note
+}
+
+func changeToProto(change models.Change) *pb.NoteChange {
+	msg := &pb.NoteChange{
+		Seq:    change.Seq,
+		NoteId: change.NoteID,
+		At:     timestamppb.New(change.At),
+	}
+	switch change.Op {
+	case models.ChangeCreate:
+		msg.Op = pb.NoteChange_OP_CREATE
+	case models.ChangeUpdate:
+		msg.Op = pb.NoteChange_OP_UPDATE
+	case models.ChangeDelete:
+		msg.Op = pb.NoteChange_OP_DELETE
+	}
+	if change.Note != nil {
+		msg.Note = toProto(*change.Note)
+	}
+	return msg
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
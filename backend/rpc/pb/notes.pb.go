@@ -0,0 +1,830 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: notes.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type NoteChange_Op int32
+
+const (
+	NoteChange_OP_UNSPECIFIED NoteChange_Op = 0
+	NoteChange_OP_CREATE      NoteChange_Op = 1
+	NoteChange_OP_UPDATE      NoteChange_Op = 2
+	NoteChange_OP_DELETE      NoteChange_Op = 3
+)
+
+// Enum value maps for NoteChange_Op.
+var (
+	NoteChange_Op_name = map[int32]string{
+		0: "OP_UNSPECIFIED",
+		1: "OP_CREATE",
+		2: "OP_UPDATE",
+		3: "OP_DELETE",
+	}
+	NoteChange_Op_value = map[string]int32{
+		"OP_UNSPECIFIED": 0,
+		"OP_CREATE":      1,
+		"OP_UPDATE":      2,
+		"OP_DELETE":      3,
+	}
+)
+
+func (x NoteChange_Op) Enum() *NoteChange_Op {
+	p := new(NoteChange_Op)
+	*p = x
+	return p
+}
+
+func (x NoteChange_Op) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (NoteChange_Op) Descriptor() protoreflect.EnumDescriptor {
+	return file_notes_proto_enumTypes[0].Descriptor()
+}
+
+func (NoteChange_Op) Type() protoreflect.EnumType {
+	return &file_notes_proto_enumTypes[0]
+}
+
+func (x NoteChange_Op) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use NoteChange_Op.Descriptor instead.
+func (NoteChange_Op) EnumDescriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{9, 0}
+}
+
+type Note struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	LegacyId         int64                  `protobuf:"varint,2,opt,name=legacy_id,json=legacyId,proto3" json:"legacy_id,omitempty"`
+	Title            string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Content          string                 `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	Notebook         string                 `protobuf:"bytes,5,opt,name=notebook,proto3" json:"notebook,omitempty"`
+	Published        bool                   `protobuf:"varint,6,opt,name=published,proto3" json:"published,omitempty"`
+	Items            []*TodoItem            `protobuf:"bytes,7,rep,name=items,proto3" json:"items,omitempty"`
+	CreatedAt        *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt        *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	RemindAt         *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=remind_at,json=remindAt,proto3" json:"remind_at,omitempty"`
+	ReminderFiredAt  *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=reminder_fired_at,json=reminderFiredAt,proto3" json:"reminder_fired_at,omitempty"`
+	ContentEncrypted bool                   `protobuf:"varint,12,opt,name=content_encrypted,json=contentEncrypted,proto3" json:"content_encrypted,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Note) Reset() {
+	*x = Note{}
+	mi := &file_notes_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Note) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Note) ProtoMessage() {}
+
+func (x *Note) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Note.ProtoReflect.Descriptor instead.
+func (*Note) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Note) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Note) GetLegacyId() int64 {
+	if x != nil {
+		return x.LegacyId
+	}
+	return 0
+}
+
+func (x *Note) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Note) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Note) GetNotebook() string {
+	if x != nil {
+		return x.Notebook
+	}
+	return ""
+}
+
+func (x *Note) GetPublished() bool {
+	if x != nil {
+		return x.Published
+	}
+	return false
+}
+
+func (x *Note) GetItems() []*TodoItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Note) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Note) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Note) GetRemindAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.RemindAt
+	}
+	return nil
+}
+
+func (x *Note) GetReminderFiredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ReminderFiredAt
+	}
+	return nil
+}
+
+func (x *Note) GetContentEncrypted() bool {
+	if x != nil {
+		return x.ContentEncrypted
+	}
+	return false
+}
+
+type TodoItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	Done          bool                   `protobuf:"varint,3,opt,name=done,proto3" json:"done,omitempty"`
+	Position      int32                  `protobuf:"varint,4,opt,name=position,proto3" json:"position,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TodoItem) Reset() {
+	*x = TodoItem{}
+	mi := &file_notes_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TodoItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TodoItem) ProtoMessage() {}
+
+func (x *TodoItem) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TodoItem.ProtoReflect.Descriptor instead.
+func (*TodoItem) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *TodoItem) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *TodoItem) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *TodoItem) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+func (x *TodoItem) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+type ListNotesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only list notes with unfinished checklist items
+	OpenTasks     bool `protobuf:"varint,1,opt,name=open_tasks,json=openTasks,proto3" json:"open_tasks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNotesRequest) Reset() {
+	*x = ListNotesRequest{}
+	mi := &file_notes_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNotesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNotesRequest) ProtoMessage() {}
+
+func (x *ListNotesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNotesRequest.ProtoReflect.Descriptor instead.
+func (*ListNotesRequest) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListNotesRequest) GetOpenTasks() bool {
+	if x != nil {
+		return x.OpenTasks
+	}
+	return false
+}
+
+type ListNotesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Notes []*Note                `protobuf:"bytes,1,rep,name=notes,proto3" json:"notes,omitempty"`
+	// Pass to WatchNotes to follow changes from this state on
+	Cursor        int64 `protobuf:"varint,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNotesResponse) Reset() {
+	*x = ListNotesResponse{}
+	mi := &file_notes_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNotesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNotesResponse) ProtoMessage() {}
+
+func (x *ListNotesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNotesResponse.ProtoReflect.Descriptor instead.
+func (*ListNotesResponse) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListNotesResponse) GetNotes() []*Note {
+	if x != nil {
+		return x.Notes
+	}
+	return nil
+}
+
+func (x *ListNotesResponse) GetCursor() int64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+type GetNoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetNoteRequest) Reset() {
+	*x = GetNoteRequest{}
+	mi := &file_notes_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetNoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetNoteRequest) ProtoMessage() {}
+
+func (x *GetNoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetNoteRequest.ProtoReflect.Descriptor instead.
+func (*GetNoteRequest) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetNoteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CreateNoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Note          *Note                  `protobuf:"bytes,1,opt,name=note,proto3" json:"note,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateNoteRequest) Reset() {
+	*x = CreateNoteRequest{}
+	mi := &file_notes_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateNoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateNoteRequest) ProtoMessage() {}
+
+func (x *CreateNoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateNoteRequest.ProtoReflect.Descriptor instead.
+func (*CreateNoteRequest) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CreateNoteRequest) GetNote() *Note {
+	if x != nil {
+		return x.Note
+	}
+	return nil
+}
+
+type UpdateNoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Note          *Note                  `protobuf:"bytes,2,opt,name=note,proto3" json:"note,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateNoteRequest) Reset() {
+	*x = UpdateNoteRequest{}
+	mi := &file_notes_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateNoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateNoteRequest) ProtoMessage() {}
+
+func (x *UpdateNoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateNoteRequest.ProtoReflect.Descriptor instead.
+func (*UpdateNoteRequest) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpdateNoteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UpdateNoteRequest) GetNote() *Note {
+	if x != nil {
+		return x.Note
+	}
+	return nil
+}
+
+type DeleteNoteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteNoteRequest) Reset() {
+	*x = DeleteNoteRequest{}
+	mi := &file_notes_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteNoteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteNoteRequest) ProtoMessage() {}
+
+func (x *DeleteNoteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteNoteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteNoteRequest) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteNoteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WatchNotesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Since         int64                  `protobuf:"varint,1,opt,name=since,proto3" json:"since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchNotesRequest) Reset() {
+	*x = WatchNotesRequest{}
+	mi := &file_notes_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchNotesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchNotesRequest) ProtoMessage() {}
+
+func (x *WatchNotesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchNotesRequest.ProtoReflect.Descriptor instead.
+func (*WatchNotesRequest) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchNotesRequest) GetSince() int64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+type NoteChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           int64                  `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Op            NoteChange_Op          `protobuf:"varint,2,opt,name=op,proto3,enum=notty.v1.NoteChange_Op" json:"op,omitempty"`
+	NoteId        string                 `protobuf:"bytes,3,opt,name=note_id,json=noteId,proto3" json:"note_id,omitempty"`
+	Note          *Note                  `protobuf:"bytes,4,opt,name=note,proto3" json:"note,omitempty"` // unset for deletes
+	At            *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=at,proto3" json:"at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NoteChange) Reset() {
+	*x = NoteChange{}
+	mi := &file_notes_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NoteChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NoteChange) ProtoMessage() {}
+
+func (x *NoteChange) ProtoReflect() protoreflect.Message {
+	mi := &file_notes_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NoteChange.ProtoReflect.Descriptor instead.
+func (*NoteChange) Descriptor() ([]byte, []int) {
+	return file_notes_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *NoteChange) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *NoteChange) GetOp() NoteChange_Op {
+	if x != nil {
+		return x.Op
+	}
+	return NoteChange_OP_UNSPECIFIED
+}
+
+func (x *NoteChange) GetNoteId() string {
+	if x != nil {
+		return x.NoteId
+	}
+	return ""
+}
+
+func (x *NoteChange) GetNote() *Note {
+	if x != nil {
+		return x.Note
+	}
+	return nil
+}
+
+func (x *NoteChange) GetAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.At
+	}
+	return nil
+}
+
+var File_notes_proto protoreflect.FileDescriptor
+
+const file_notes_proto_rawDesc = "" +
+	"\n" +
+	"\vnotes.proto\x12\bnotty.v1\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xeb\x03\n" +
+	"\x04Note\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tlegacy_id\x18\x02 \x01(\x03R\blegacyId\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x18\n" +
+	"\acontent\x18\x04 \x01(\tR\acontent\x12\x1a\n" +
+	"\bnotebook\x18\x05 \x01(\tR\bnotebook\x12\x1c\n" +
+	"\tpublished\x18\x06 \x01(\bR\tpublished\x12(\n" +
+	"\x05items\x18\a \x03(\v2\x12.notty.v1.TodoItemR\x05items\x129\n" +
+	"\n" +
+	"created_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x127\n" +
+	"\tremind_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\bremindAt\x12F\n" +
+	"\x11reminder_fired_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\x0freminderFiredAt\x12+\n" +
+	"\x11content_encrypted\x18\f \x01(\bR\x10contentEncrypted\"^\n" +
+	"\bTodoItem\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12\x12\n" +
+	"\x04done\x18\x03 \x01(\bR\x04done\x12\x1a\n" +
+	"\bposition\x18\x04 \x01(\x05R\bposition\"1\n" +
+	"\x10ListNotesRequest\x12\x1d\n" +
+	"\n" +
+	"open_tasks\x18\x01 \x01(\bR\topenTasks\"Q\n" +
+	"\x11ListNotesResponse\x12$\n" +
+	"\x05notes\x18\x01 \x03(\v2\x0e.notty.v1.NoteR\x05notes\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\x03R\x06cursor\" \n" +
+	"\x0eGetNoteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"7\n" +
+	"\x11CreateNoteRequest\x12\"\n" +
+	"\x04note\x18\x01 \x01(\v2\x0e.notty.v1.NoteR\x04note\"G\n" +
+	"\x11UpdateNoteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\"\n" +
+	"\x04note\x18\x02 \x01(\v2\x0e.notty.v1.NoteR\x04note\"#\n" +
+	"\x11DeleteNoteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\")\n" +
+	"\x11WatchNotesRequest\x12\x14\n" +
+	"\x05since\x18\x01 \x01(\x03R\x05since\"\xf7\x01\n" +
+	"\n" +
+	"NoteChange\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x03R\x03seq\x12'\n" +
+	"\x02op\x18\x02 \x01(\x0e2\x17.notty.v1.NoteChange.OpR\x02op\x12\x17\n" +
+	"\anote_id\x18\x03 \x01(\tR\x06noteId\x12\"\n" +
+	"\x04note\x18\x04 \x01(\v2\x0e.notty.v1.NoteR\x04note\x12*\n" +
+	"\x02at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x02at\"E\n" +
+	"\x02Op\x12\x12\n" +
+	"\x0eOP_UNSPECIFIED\x10\x00\x12\r\n" +
+	"\tOP_CREATE\x10\x01\x12\r\n" +
+	"\tOP_UPDATE\x10\x02\x12\r\n" +
+	"\tOP_DELETE\x10\x032\xfe\x02\n" +
+	"\x05Notes\x12D\n" +
+	"\tListNotes\x12\x1a.notty.v1.ListNotesRequest\x1a\x1b.notty.v1.ListNotesResponse\x123\n" +
+	"\aGetNote\x12\x18.notty.v1.GetNoteRequest\x1a\x0e.notty.v1.Note\x129\n" +
+	"\n" +
+	"CreateNote\x12\x1b.notty.v1.CreateNoteRequest\x1a\x0e.notty.v1.Note\x129\n" +
+	"\n" +
+	"UpdateNote\x12\x1b.notty.v1.UpdateNoteRequest\x1a\x0e.notty.v1.Note\x12A\n" +
+	"\n" +
+	"DeleteNote\x12\x1b.notty.v1.DeleteNoteRequest\x1a\x16.google.protobuf.Empty\x12A\n" +
+	"\n" +
+	"WatchNotes\x12\x1b.notty.v1.WatchNotesRequest\x1a\x14.notty.v1.NoteChange0\x01B\x15Z\x13note/backend/rpc/pbb\x06proto3"
+
+var (
+	file_notes_proto_rawDescOnce sync.Once
+	file_notes_proto_rawDescData []byte
+)
+
+func file_notes_proto_rawDescGZIP() []byte {
+	file_notes_proto_rawDescOnce.Do(func() {
+		file_notes_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_notes_proto_rawDesc), len(file_notes_proto_rawDesc)))
+	})
+	return file_notes_proto_rawDescData
+}
+
+var file_notes_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_notes_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_notes_proto_goTypes = []any{
+	(NoteChange_Op)(0),            // 0: notty.v1.NoteChange.Op
+	(*Note)(nil),                  // 1: notty.v1.Note
+	(*TodoItem)(nil),              // 2: notty.v1.TodoItem
+	(*ListNotesRequest)(nil),      // 3: notty.v1.ListNotesRequest
+	(*ListNotesResponse)(nil),     // 4: notty.v1.ListNotesResponse
+	(*GetNoteRequest)(nil),        // 5: notty.v1.GetNoteRequest
+	(*CreateNoteRequest)(nil),     // 6: notty.v1.CreateNoteRequest
+	(*UpdateNoteRequest)(nil),     // 7: notty.v1.UpdateNoteRequest
+	(*DeleteNoteRequest)(nil),     // 8: notty.v1.DeleteNoteRequest
+	(*WatchNotesRequest)(nil),     // 9: notty.v1.WatchNotesRequest
+	(*NoteChange)(nil),            // 10: notty.v1.NoteChange
+	(*timestamppb.Timestamp)(nil), // 11: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),         // 12: google.protobuf.Empty
+}
+var file_notes_proto_depIdxs = []int32{
+	2,  // 0: notty.v1.Note.items:type_name -> notty.v1.TodoItem
+	11, // 1: notty.v1.Note.created_at:type_name -> google.protobuf.Timestamp
+	11, // 2: notty.v1.Note.updated_at:type_name -> google.protobuf.Timestamp
+	11, // 3: notty.v1.Note.remind_at:type_name -> google.protobuf.Timestamp
+	11, // 4: notty.v1.Note.reminder_fired_at:type_name -> google.protobuf.Timestamp
+	1,  // 5: notty.v1.ListNotesResponse.notes:type_name -> notty.v1.Note
+	1,  // 6: notty.v1.CreateNoteRequest.note:type_name -> notty.v1.Note
+	1,  // 7: notty.v1.UpdateNoteRequest.note:type_name -> notty.v1.Note
+	0,  // 8: notty.v1.NoteChange.op:type_name -> notty.v1.NoteChange.Op
+	1,  // 9: notty.v1.NoteChange.note:type_name -> notty.v1.Note
+	11, // 10: notty.v1.NoteChange.at:type_name -> google.protobuf.Timestamp
+	3,  // 11: notty.v1.Notes.ListNotes:input_type -> notty.v1.ListNotesRequest
+	5,  // 12: notty.v1.Notes.GetNote:input_type -> notty.v1.GetNoteRequest
+	6,  // 13: notty.v1.Notes.CreateNote:input_type -> notty.v1.CreateNoteRequest
+	7,  // 14: notty.v1.Notes.UpdateNote:input_type -> notty.v1.UpdateNoteRequest
+	8,  // 15: notty.v1.Notes.DeleteNote:input_type -> notty.v1.DeleteNoteRequest
+	9,  // 16: notty.v1.Notes.WatchNotes:input_type -> notty.v1.WatchNotesRequest
+	4,  // 17: notty.v1.Notes.ListNotes:output_type -> notty.v1.ListNotesResponse
+	1,  // 18: notty.v1.Notes.GetNote:output_type -> notty.v1.Note
+	1,  // 19: notty.v1.Notes.CreateNote:output_type -> notty.v1.Note
+	1,  // 20: notty.v1.Notes.UpdateNote:output_type -> notty.v1.Note
+	12, // 21: notty.v1.Notes.DeleteNote:output_type -> google.protobuf.Empty
+	10, // 22: notty.v1.Notes.WatchNotes:output_type -> notty.v1.NoteChange
+	17, // [17:23] is the sub-list for method output_type
+	11, // [11:17] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_notes_proto_init() }
+func file_notes_proto_init() {
+	if File_notes_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_notes_proto_rawDesc), len(file_notes_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_notes_proto_goTypes,
+		DependencyIndexes: file_notes_proto_depIdxs,
+		EnumInfos:         file_notes_proto_enumTypes,
+		MessageInfos:      file_notes_proto_msgTypes,
+	}.Build()
+	File_notes_proto = out.File
+	file_notes_proto_goTypes = nil
+	file_notes_proto_depIdxs = nil
+}
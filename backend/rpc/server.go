@@ -0,0 +1,206 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"note/backend/auth"
+	"note/backend/handlers"
+	"note/backend/models"
+	"note/backend/rpc/pb"
+	"note/backend/workspace"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Store is where the gRPC API reads and writes notes, the part of the
+// handlers.Repository of the REST API it uses
+type Store interface {
+	List(openTasks bool) ([]models.Note, int64)
+	Get(id string) (models.Note, error)
+	Create(note models.Note) (models.Note, error)
+	Update(id string, note models.Note) (models.Note, error)
+	Delete(id string) error
+	Watch(since int64) ([]models.Change, <-chan struct{}, error)
+}
+
+// Metadata keys a caller authenticates and picks its workspace with, like
+// the Authorization and X-Notty-Workspace headers of the REST API
+const (
+	MetadataAuthorization = "authorization"
+	MetadataWorkspace     = "x-notty-workspace"
+)
+
+// Server implements the Notes service on top of the Store of each caller
+type Server struct {
+	pb.UnimplementedNotesServer
+
+	// Store returns the store of a caller, by the API key it sent as
+	// "authorization: Bearer <key>" and the workspace it picked, or the
+	// error to fail the call with
+	Store func(secret, workspace string) (Store, error)
+
+	// AcceptLegacyIDs resolves integer note IDs like the REST API does
+	AcceptLegacyIDs bool
+}
+
+// NewGRPCServer returns a gRPC server with the Notes service registered
+func NewGRPCServer(s *Server) *grpc.Server {
+	srv := grpc.NewServer()
+	pb.RegisterNotesServer(srv, s)
+	return srv
+}
+
+// store returns the store of the caller of ctx
+func (s *Server) store(ctx context.Context) (Store, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	secret := first(MetadataAuthorization)
+	if len(secret) > 7 && strings.EqualFold(secret[:7], "Bearer ") {
+		secret = strings.TrimSpace(secret[7:])
+	} else {
+		secret = ""
+	}
+	store, err := s.Store(secret, first(MetadataWorkspace))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return store, nil
+}
+
+func (s *Server) ListNotes(ctx context.Context, req *pb.ListNotesRequest) (*pb.ListNotesResponse, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, seq := store.List(req.GetOpenTasks())
+	res := &pb.ListNotesResponse{Cursor: seq}
+	for _, note := range list {
+		res.Notes = append(res.Notes, toProto(note))
+	}
+	return res, nil
+}
+
+func (s *Server) GetNote(ctx context.Context, req *pb.GetNoteRequest) (*pb.Note, error) {
+	id, err := s.noteID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	note, err := store.Get(id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(note), nil
+}
+
+func (s *Server) CreateNote(ctx context.Context, req *pb.CreateNoteRequest) (*pb.Note, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	note, err := store.Create(fromProto(req.GetNote()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(note), nil
+}
+
+func (s *Server) UpdateNote(ctx context.Context, req *pb.UpdateNoteRequest) (*pb.Note, error) {
+	id, err := s.noteID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	note, err := store.Update(id, fromProto(req.GetNote()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProto(note), nil
+}
+
+func (s *Server) DeleteNote(ctx context.Context, req *pb.DeleteNoteRequest) (*emptypb.Empty, error) {
+	id, err := s.noteID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Delete(id); err != nil {
+		return nil, toStatus(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) WatchNotes(req *pb.WatchNotesRequest, stream grpc.ServerStreamingServer[pb.NoteChange]) error {
+	store, err := s.store(stream.Context())
+	if err != nil {
+		return err
+	}
+	since := req.GetSince()
+	for {
+		pending, changed, err := store.Watch(since)
+		if err != nil {
+			return toStatus(err)
+		}
+		for _, change := range pending {
+			if err := stream.Send(changeToProto(change)); err != nil {
+				return err
+			}
+			since = change.Seq
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// noteID validates an ID from a request. Legacy integer IDs resolve to
+// the UUID their note was migrated to.
+func (s *Server) noteID(raw string) (string, error) {
+	id, ok := models.ResolveNoteID(raw, s.AcceptLegacyIDs)
+	if !ok {
+		return "", status.Error(codes.InvalidArgument, "invalid note ID")
+	}
+	return id, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, "invalid or missing API key")
+	case errors.Is(err, auth.ErrDisabledToken), errors.Is(err, handlers.ErrReadOnly):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, workspace.ErrNotFound):
+		return status.Error(codes.NotFound, "workspace not found")
+	case errors.Is(err, handlers.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, handlers.ErrTitleRequired), errors.Is(err, handlers.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, handlers.ErrNoteLimit), errors.Is(err, handlers.ErrNoteTooLarge),
+		errors.Is(err, handlers.ErrStorageLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, handlers.ErrCursorExpired):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,103 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"note/backend/auth"
+	"note/backend/handlers"
+	"note/backend/models"
+	"note/backend/rpc"
+	"note/backend/rpc/pb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func dial(t *testing.T) pb.NotesClient {
+	t.Helper()
+	srv := rpc.NewGRPCServer(&rpc.Server{Store: func(secret, workspace string) (rpc.Store, error) {
+		return handlers.StoreFor(secret, workspace, false, "", "grpc")
+	}})
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewNotesClient(conn)
+}
+
+// as calls with an API key in a workspace
+func as(secret, workspace string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(),
+		rpc.MetadataAuthorization, "Bearer "+secret, rpc.MetadataWorkspace, workspace)
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	client := dial(t)
+	member, memberSecret, err := handlers.APIKeys.Create("member", auth.ScopeReadWrite, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, outsiderSecret, err := handlers.APIKeys.Create("outsider", auth.ScopeReadWrite, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := handlers.Workspaces.Create("Team", member.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := handlers.Store{Workspace: ws.ID}.Create(models.Note{Title: "Team secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := client.ListNotes(context.Background(), &pb.ListNotesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range list.GetNotes() {
+		if n.GetId() == secret.ID {
+			t.Error("the default workspace lists a note of another workspace")
+		}
+	}
+	_, err = client.GetNote(context.Background(), &pb.GetNoteRequest{Id: secret.ID})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetNote from the default workspace: %v, want NotFound", err)
+	}
+	_, err = client.DeleteNote(context.Background(), &pb.DeleteNoteRequest{Id: secret.ID})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteNote from the default workspace: %v, want NotFound", err)
+	}
+
+	_, err = client.ListNotes(as(outsiderSecret, ws.ID), &pb.ListNotesRequest{})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ListNotes by a non-member: %v, want NotFound", err)
+	}
+	_, err = client.ListNotes(as("wrong", ws.ID), &pb.ListNotesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListNotes with an unknown key: %v, want Unauthenticated", err)
+	}
+
+	got, err := client.GetNote(as(memberSecret, ws.ID), &pb.GetNoteRequest{Id: secret.ID})
+	if err != nil || got.GetTitle() != "Team secret" {
+		t.Errorf("GetNote by a member = %v, %v", got, err)
+	}
+	created, err := client.CreateNote(as(memberSecret, ws.ID), &pb.CreateNoteRequest{Note: &pb.Note{Title: "Also the team's"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note, err := (handlers.Store{Workspace: ws.ID}).Get(created.GetId()); err != nil || note.Workspace != ws.ID {
+		t.Errorf("note created over gRPC in workspace %q, want %q", note.Workspace, ws.ID)
+	}
+}
@@ -0,0 +1,270 @@
+// Package sanitize removes what could run scripts from note fields that
+// end up in HTML pages, like shared notes rendered by other sites. It
+// keeps the text as written: plain text, markdown and safe markup come
+// out unchanged.
+package sanitize
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Mode is how a field is sanitized
+type Mode string
+
+const (
+	// None keeps a field as it is
+	None Mode = "none"
+	// HTML keeps safe markup and drops scripts, styles, frames, event
+	// handlers and script URLs
+	HTML Mode = "html"
+	// Text escapes all markup, so it shows as written
+	Text Mode = "text"
+)
+
+// Fields are the note fields a Policy can name; items are the texts of
+// checklist items
+var Fields = []string{"title", "content", "items"}
+
+// Policy gives the mode of each field. Fields it doesn't list are kept as
+// they are.
+type Policy map[string]Mode
+
+// Mode returns the mode of a field
+func (p Policy) Mode(field string) Mode {
+	if m, ok := p[field]; ok {
+		return m
+	}
+	return None
+}
+
+// Apply sanitizes s as field
+func (p Policy) Apply(field, s string) string {
+	switch p.Mode(field) {
+	case HTML:
+		return Clean(s)
+	case Text:
+		return html.EscapeString(s)
+	}
+	return s
+}
+
+// Validate checks the policy only names known fields and modes
+func (p Policy) Validate() error {
+	for field, mode := range p {
+		known := false
+		for _, f := range Fields {
+			known = known || f == field
+		}
+		if !known {
+			return fmt.Errorf("can't sanitize unknown field %q", field)
+		}
+		if mode != None && mode != HTML && mode != Text {
+			return fmt.Errorf("sanitize mode of %s must be none, html or text", field)
+		}
+	}
+	return nil
+}
+
+// Config says how notes are sanitized when they are saved and when they
+// are rendered for others through share links, the public API and feeds
+type Config struct {
+	Save   Policy `json:"save"`
+	Render Policy `json:"render"`
+}
+
+// DefaultConfig keeps notes as written when they are saved, markdown
+// like "x<y" and all, and cleans the markup of every field when they are
+// rendered
+func DefaultConfig() Config {
+	return Config{Save: Policy{}, Render: Policy{"title": HTML, "content": HTML, "items": HTML}}
+}
+
+// Validate checks both policies
+func (c Config) Validate() error {
+	if err := c.Save.Validate(); err != nil {
+		return err
+	}
+	return c.Render.Validate()
+}
+
+// allowed lists the elements kept and their attributes
+var allowed = map[atom.Atom][]atom.Atom{
+	atom.A: {atom.Href}, atom.Abbr: nil, atom.B: nil, atom.Blockquote: nil,
+	atom.Br: nil, atom.Code: nil, atom.Dd: nil, atom.Del: nil, atom.Div: nil,
+	atom.Dl: nil, atom.Dt: nil, atom.Em: nil, atom.H1: nil, atom.H2: nil,
+	atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil, atom.Hr: nil,
+	atom.I: nil, atom.Img: {atom.Src, atom.Alt, atom.Width, atom.Height},
+	atom.Ins: nil, atom.Kbd: nil, atom.Li: nil, atom.Mark: nil,
+	atom.Ol: {atom.Start}, atom.P: nil, atom.Pre: nil, atom.Q: nil, atom.S: nil,
+	atom.Small: nil, atom.Span: nil, atom.Strong: nil, atom.Sub: nil,
+	atom.Sup: nil, atom.Table: nil, atom.Tbody: nil, atom.Td: {atom.Colspan, atom.Rowspan},
+	atom.Tfoot: nil, atom.Th: {atom.Colspan, atom.Rowspan}, atom.Thead: nil,
+	atom.Tr: nil, atom.U: nil, atom.Ul: nil,
+}
+
+// globalAttrs are allowed on every element kept
+var globalAttrs = []atom.Atom{atom.Title, atom.Lang, atom.Dir}
+
+// dropped elements go with everything in them. Their content is script,
+// style, a nested document or foreign markup parsed by other rules.
+var dropped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true,
+	atom.Applet: true, atom.Noscript: true, atom.Noembed: true, atom.Noframes: true,
+	atom.Frameset: true, atom.Template: true, atom.Svg: true, atom.Math: true,
+	atom.Textarea: true, atom.Title: true, atom.Xmp: true, atom.Plaintext: true,
+}
+
+// rawText elements are read as text up to their end tag, even when their
+// start tag ends in "/>"
+var rawText = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Noscript: true,
+	atom.Noembed: true, atom.Noframes: true, atom.Textarea: true, atom.Title: true,
+	atom.Xmp: true, atom.Plaintext: true,
+}
+
+// Clean returns s with only the allowed elements and attributes of HTML.
+// Other HTML elements lose their tags but keep their text, except the
+// dropped ones, and comments go. Tags that aren't HTML, like the <y in
+// "x<y z", are kept without their attributes, since browsers don't run
+// anything for them.
+func Clean(s string) string {
+	if !strings.ContainsRune(s, '<') {
+		return s
+	}
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	var b strings.Builder
+	var skip atom.Atom // the dropped element being skipped
+	depth := 0
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			if z.Err() == io.EOF {
+				// A tag cut off by the end, escaped so that it can't take
+				// in what follows where the field is put in a page
+				if skip == 0 {
+					b.WriteString(html.EscapeString(string(z.Raw())))
+				}
+				return b.String()
+			}
+			return html.EscapeString(s) // can't happen reading from a string
+		}
+		raw := string(z.Raw())
+		if skip != 0 {
+			if tt != nethtml.StartTagToken && tt != nethtml.EndTagToken {
+				continue
+			}
+			name, _ := z.TagName()
+			if atom.Lookup(name) != skip {
+				continue
+			}
+			if tt == nethtml.StartTagToken {
+				depth++
+			} else if depth--; depth == 0 {
+				skip = 0
+			}
+			continue
+		}
+
+		switch tt {
+		case nethtml.TextToken:
+			b.WriteString(raw)
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			t := z.Token()
+			a := atom.Lookup([]byte(t.Data))
+			if dropped[a] {
+				if tt == nethtml.StartTagToken || rawText[a] {
+					skip, depth = a, 1
+				}
+				continue
+			}
+			b.WriteString(startTag(t, a, raw))
+		case nethtml.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if _, ok := allowed[a]; ok || a == 0 {
+				b.WriteString(raw)
+			}
+		}
+	}
+}
+
+// startTag returns the tag t read from raw with what isn't allowed of it
+// removed
+func startTag(t nethtml.Token, a atom.Atom, raw string) string {
+	attrs, ok := allowed[a]
+	if !ok && a != 0 {
+		return "" // an HTML element that isn't allowed
+	}
+	var kept []nethtml.Attribute
+	for _, attr := range t.Attr {
+		if attr.Namespace == "" && allowedAttr(attrs, atom.Lookup([]byte(attr.Key))) && safeURL(a, attr) {
+			kept = append(kept, attr)
+		}
+	}
+	if len(kept) == len(t.Attr) {
+		return raw
+	}
+	var b strings.Builder
+	b.WriteString("<" + t.Data)
+	for _, attr := range kept {
+		b.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func allowedAttr(attrs []atom.Atom, a atom.Atom) bool {
+	if a == 0 {
+		return false
+	}
+	for _, list := range [][]atom.Atom{attrs, globalAttrs} {
+		for _, allowed := range list {
+			if a == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// safeURL reports whether an attribute holding a URL points somewhere
+// that can't run scripts: relative, http(s) or mailto, or for images an
+// inline image
+func safeURL(element atom.Atom, attr nethtml.Attribute) bool {
+	key := atom.Lookup([]byte(attr.Key))
+	if key != atom.Href && key != atom.Src {
+		return true
+	}
+	// Browsers ignore whitespace and control characters in URLs
+	u := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, attr.Val)
+	colon := strings.IndexByte(u, ':')
+	if colon < 0 || strings.ContainsAny(u[:colon], "/?#") {
+		return true // no scheme
+	}
+	switch scheme := strings.ToLower(u[:colon]); scheme {
+	case "http", "https", "mailto":
+		return true
+	case "data":
+		if element != atom.Img {
+			return false
+		}
+		media := strings.ToLower(u[colon+1:])
+		for _, t := range []string{"image/png", "image/jpeg", "image/gif", "image/webp"} {
+			if strings.HasPrefix(media, t+";") || strings.HasPrefix(media, t+",") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package sanitize
+
+import "testing"
+
+func TestCleanKeepsSafeText(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"Tom & Jerry &amp; friends",
+		"# Heading\n\n- [ ] item\n- **bold** and `code`",
+		"x < y and 3 > 2",
+		"x<y>z",
+		`<p>Hello <a href="https://example.com/?a=1&amp;b=2">link</a></p>`,
+		`<A HREF="/relative">Up</A><br/><img src="data:image/png;base64,AAAA" alt="dot">`,
+		"<ul><li>one</li><li>two</li></ul>",
+		"<table><tr><td colspan=2>cell</td></tr></table>",
+	} {
+		if got := Clean(s); got != s {
+			t.Errorf("Clean(%q) = %q, want it unchanged", s, got)
+		}
+	}
+}
+
+func TestCleanRemovesScripts(t *testing.T) {
+	tests := map[string]string{
+		"<script>alert(1)</script>after":                                  "after",
+		"<SCRIPT/>alert(1)</script>after":                                 "after",
+		"<style>body{}</style><p>x</p>":                                   "<p>x</p>",
+		`<img src=x onerror="alert(1)">`:                                  `<img src="x">`,
+		`<a href="javascript:alert(1)">x</a>`:                             "<a>x</a>",
+		`<a href=" JaVa&#x09;Script:alert(1)">x</a>`:                      "<a>x</a>",
+		`<a href="vbscript:x">x</a>`:                                      "<a>x</a>",
+		`<a href="data:text/html,<script>x</script>">x</a>`:               "<a>x</a>",
+		`<img src="data:image/svg+xml,<svg onload=x>">`:                   "<img>",
+		`<iframe src="https://evil.example"></iframe>text`:                "text",
+		"<svg><script>alert(1)</script></svg>ok":                          "ok",
+		"<math><mi xlink:href=javascript:x>1</mi></math>ok":               "ok",
+		"<form action=/x><input name=a><button>Go</button>":               "Go",
+		"<!-- <script>alert(1)</script> -->ok":                            "ok",
+		"<p style=\"background:url(javascript:x)\">p</p>":                 "<p>p</p>",
+		"<custom-el onclick=alert(1)>hi</custom-el>":                      "<custom-el>hi</custom-el>",
+		"<meta http-equiv=refresh content=0;url=x>ok":                     "ok",
+		"<noscript><p title=\"</noscript><img src=x onerror=alert(1)>\">": `<img src="x">">`,
+		"<img src=x onerror=alert(1)":                                     "&lt;img src=x onerror=alert(1)",
+		"<textarea><script>alert(1)</script></textarea>ok":                "ok",
+		"<div><object data=x><p>fallback</p></object></div>":              "<div></div>",
+	}
+	for in, want := range tests {
+		if got := Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	// Markdown is saved as written; a cut-off tag like the <y of x<y is
+	// only escaped where the note is rendered, so it can't take in what
+	// follows on the page
+	for _, s := range []string{"x<y", "a <b> c", "<script>x</script>"} {
+		if got := cfg.Save.Apply("content", s); got != s {
+			t.Errorf("saving %q = %q, want it unchanged", s, got)
+		}
+	}
+	if got := cfg.Render.Apply("content", "x<y"); got != "x&lt;y" {
+		t.Errorf("rendering x<y = %q, want x&lt;y", got)
+	}
+	if got := cfg.Render.Apply("title", "<b onclick=x>A</b>"); got != "<b>A</b>" {
+		t.Errorf("rendering a title = %q, want <b>A</b>", got)
+	}
+}
+
+func TestCleanIsIdempotent(t *testing.T) {
+	for _, s := range []string{
+		`<img src=x onerror="alert(1)"><b>x</b>`,
+		"<scr<script>ipt>alert(1)</script>",
+		`<a href="java<script>x</script>script:alert(1)">x</a>`,
+	} {
+		once := Clean(s)
+		if twice := Clean(once); twice != once {
+			t.Errorf("Clean(Clean(%q)) = %q, want %q", s, twice, once)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := Policy{"title": Text, "content": HTML}
+	if got := p.Apply("title", "<b>A & B</b>"); got != "&lt;b&gt;A &amp; B&lt;/b&gt;" {
+		t.Errorf("text mode = %q", got)
+	}
+	if got := p.Apply("content", "<b onclick=x>A</b>"); got != "<b>A</b>" {
+		t.Errorf("html mode = %q", got)
+	}
+	if got := p.Apply("items", "<script>x</script>"); got != "<script>x</script>" {
+		t.Errorf("unlisted field = %q, want it unchanged", got)
+	}
+	if err := (Policy{"body": HTML}).Validate(); err == nil {
+		t.Error("unknown field accepted")
+	}
+	if err := (Policy{"title": "strip"}).Validate(); err == nil {
+		t.Error("unknown mode accepted")
+	}
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Languages with an analyzer of their own. Simple only lower-cases and
+// splits words; the others also drop stopwords and reduce words to their
+// stem, so "running" finds "runs". Chinese, Japanese and Korean text is
+// split into overlapping pairs of characters in every language, since it
+// isn't written with spaces between words.
+const (
+	Simple   = "simple"
+	English  = "en"
+	German   = "de"
+	Spanish  = "es"
+	Chinese  = "zh"
+	Japanese = "ja"
+	Korean   = "ko"
+)
+
+type analyzer struct {
+	stopwords map[string]bool
+	stem      func(string) string
+}
+
+var analyzers = map[string]analyzer{
+	Simple:   {},
+	English:  {stopwords: words(englishStopwords), stem: stemEnglish},
+	German:   {stopwords: words(germanStopwords), stem: stemGerman},
+	Spanish:  {stopwords: words(spanishStopwords), stem: stemSpanish},
+	Chinese:  {},
+	Japanese: {},
+	Korean:   {},
+}
+
+// Supported reports whether lang has an analyzer
+func Supported(lang string) bool {
+	_, ok := analyzers[lang]
+	return ok
+}
+
+// Analyze turns text into the terms it is indexed and searched by in
+// lang, which falls back to Simple when unsupported
+func Analyze(text, lang string) []string {
+	a := analyzers[lang]
+	tokens := Tokenize(text)
+	terms := tokens[:0]
+	for _, token := range tokens {
+		if a.stopwords[token] {
+			continue
+		}
+		if a.stem != nil && !isCJK([]rune(token)[0]) {
+			token = a.stem(token)
+		}
+		terms = append(terms, token)
+	}
+	return terms
+}
+
+// Tokenize splits text into lower-case words of letters and digits. Runs
+// of Chinese, Japanese or Korean characters become overlapping pairs of
+// characters, or a single one when it stands alone.
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		runes := []rune(word)
+		start := 0
+		for i := 0; i <= len(runes); i++ {
+			if i < len(runes) && isCJK(runes[i]) == isCJK(runes[start]) {
+				continue
+			}
+			if isCJK(runes[start]) {
+				tokens = append(tokens, bigrams(runes[start:i])...)
+			} else {
+				tokens = append(tokens, string(runes[start:i]))
+			}
+			start = i
+		}
+	}
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func bigrams(runes []rune) []string {
+	if len(runes) == 1 {
+		return []string{string(runes)}
+	}
+	pairs := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		pairs = append(pairs, string(runes[i:i+2]))
+	}
+	return pairs
+}
+
+func words(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(list) {
+		set[w] = true
+	}
+	return set
+}
+
+const englishStopwords = `a an and are as at be but by for from has have he her his i if in
+into is it its me my not of on or our she so than that the their them then there these they
+this to was we were what when which who will with you your`
+
+const germanStopwords = `aber als am an auch auf aus bei bin bis bist da dann das dass dein
+dem den der des die dies diese dieser dieses du durch ein eine einem einen einer eines er es
+für hat hatte ich ihr im in ist ja kein mit nach nicht noch nur ob oder sein sich sie sind so
+um und uns unter vom von vor war was wenn wie wir wird zu zum zur`
+
+const spanishStopwords = `a al algo como con de del el ella ellos en entre era es esa ese
+esta este estos fue ha han hay la las le les lo los me mi mas más muy no nos o para pero por
+que qué se ser si sí sin sobre su sus también te tu un una uno unos y ya yo`
@@ -0,0 +1,259 @@
+// Package search keeps an inverted index of note titles and content
+package search
+
+import (
+	"errors"
+	"fmt"
+	"note/backend/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned by Search while the index can't answer,
+// because it is being rebuilt or its last rebuild failed
+var ErrUnavailable = errors.New("search index unavailable")
+
+// State of the index
+type State string
+
+const (
+	Ready      State = "ready"
+	Rebuilding State = "rebuilding"
+	Down       State = "down"
+)
+
+// titleWeight makes a match in the title count like that many in content
+const titleWeight = 3
+
+// Status describes the index for status pages
+type Status struct {
+	State     State     `json:"state"`
+	Documents int       `json:"documents"`
+	Since     time.Time `json:"since"` // when it entered State
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Hit is a matching note and how well it matched
+type Hit struct {
+	ID    string `json:"id"`
+	Score int    `json:"score"`
+}
+
+type index struct {
+	postings  map[string]map[string]int // term -> note ID -> weighted count
+	terms     map[string][]string       // note ID -> its distinct terms
+	languages map[string]string         // note ID -> language it was analyzed in
+	docs      map[string]int            // language -> notes analyzed in it
+	fallback  string                    // language of notes that declare none
+}
+
+func newIndex(fallback string) index {
+	return index{
+		postings:  map[string]map[string]int{},
+		terms:     map[string][]string{},
+		languages: map[string]string{},
+		docs:      map[string]int{},
+		fallback:  fallback,
+	}
+}
+
+// Index is safe for concurrent use. It starts out Down until the first
+// rebuild.
+type Index struct {
+	mu       sync.RWMutex
+	idx      index
+	status   Status
+	pending  []models.Change // changes made during a rebuild
+	language string
+}
+
+// NewIndex returns an index that analyzes notes in their declared
+// language, or in language if they declare none or one without an
+// analyzer
+func NewIndex(language string) *Index {
+	return &Index{
+		idx:      newIndex(language),
+		status:   Status{State: Down, Since: time.Now(), LastError: "not built yet"},
+		language: language,
+	}
+}
+
+// SetLanguage changes the language of notes that declare none. It takes
+// effect on the next rebuild.
+func (ix *Index) SetLanguage(language string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.language = language
+}
+
+// Status returns the state of the index
+func (ix *Index) Status() Status {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	status := ix.status
+	status.Documents = len(ix.idx.terms)
+	return status
+}
+
+// Update applies a change to a note. Notes with encrypted content are
+// only indexed by their title.
+func (ix *Index) Update(change models.Change) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.status.State == Rebuilding {
+		ix.pending = append(ix.pending, change)
+		return
+	}
+	ix.idx.apply(change)
+}
+
+// StartRebuild switches the index to Rebuilding. Changes given to Update
+// from then on are held back and applied on top of the notes passed to
+// FinishRebuild, so callers take their snapshot of notes together with
+// StartRebuild.
+func (ix *Index) StartRebuild() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.status = Status{State: Rebuilding, Since: time.Now()}
+	ix.pending = nil
+}
+
+// FinishRebuild builds the index from notes while searches keep failing
+// with ErrUnavailable, then swaps it in
+func (ix *Index) FinishRebuild(notes []models.Note) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rebuilding search index: %v", r)
+			ix.mu.Lock()
+			ix.status = Status{State: Down, Since: time.Now(), LastError: err.Error()}
+			ix.pending = nil
+			ix.mu.Unlock()
+		}
+	}()
+	ix.mu.RLock()
+	built := newIndex(ix.language)
+	ix.mu.RUnlock()
+	for i := range notes {
+		built.add(notes[i])
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, change := range ix.pending {
+		built.apply(change)
+	}
+	ix.idx = built
+	ix.pending = nil
+	ix.status = Status{State: Ready, Since: time.Now()}
+	return nil
+}
+
+// Search returns the notes containing every word of query, best matches
+// first. The query is analyzed once for every language notes are in, and
+// each note is matched against the terms of its own language. It fails
+// with ErrUnavailable unless the index is Ready.
+func (ix *Index) Search(query string) ([]Hit, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if ix.status.State != Ready {
+		return nil, ErrUnavailable
+	}
+	hits := []Hit{}
+	for lang := range ix.idx.docs {
+		for id, score := range ix.idx.match(Analyze(query, lang), lang) {
+			hits = append(hits, Hit{ID: id, Score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits, nil
+}
+
+// match scores the notes in lang that contain every term
+func (idx index) match(terms []string, lang string) map[string]int {
+	if len(terms) == 0 {
+		return nil
+	}
+	scores := map[string]int{}
+	for id, count := range idx.postings[terms[0]] {
+		if idx.languages[id] == lang {
+			scores[id] = count
+		}
+	}
+	for _, term := range terms[1:] {
+		postings := idx.postings[term]
+		for id := range scores {
+			if count, ok := postings[id]; ok {
+				scores[id] += count
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	return scores
+}
+
+// language returns the language a note is analyzed in. Regional
+// variants like "en-GB" use the analyzer of their language.
+func (idx index) language(note models.Note) string {
+	if lang, _, _ := strings.Cut(note.Language, "-"); Supported(lang) {
+		return lang
+	}
+	if Supported(idx.fallback) {
+		return idx.fallback
+	}
+	return Simple
+}
+
+func (idx index) apply(change models.Change) {
+	idx.remove(change.NoteID)
+	if change.Op != models.ChangeDelete && change.Note != nil {
+		idx.add(*change.Note)
+	}
+}
+
+func (idx index) add(note models.Note) {
+	lang := idx.language(note)
+	counts := map[string]int{}
+	for _, term := range Analyze(note.Title, lang) {
+		counts[term] += titleWeight
+	}
+	if !note.ContentEncrypted {
+		for _, term := range Analyze(note.Content, lang) {
+			counts[term]++
+		}
+	}
+	terms := make([]string, 0, len(counts))
+	for word, count := range counts {
+		if idx.postings[word] == nil {
+			idx.postings[word] = map[string]int{}
+		}
+		idx.postings[word][note.ID] = count
+		terms = append(terms, word)
+	}
+	idx.terms[note.ID] = terms
+	idx.languages[note.ID] = lang
+	idx.docs[lang]++
+}
+
+func (idx index) remove(id string) {
+	for _, word := range idx.terms[id] {
+		delete(idx.postings[word], id)
+		if len(idx.postings[word]) == 0 {
+			delete(idx.postings, word)
+		}
+	}
+	delete(idx.terms, id)
+	if lang, ok := idx.languages[id]; ok {
+		delete(idx.languages, id)
+		if idx.docs[lang]--; idx.docs[lang] == 0 {
+			delete(idx.docs, lang)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package search
+
+import "strings"
+
+// stemEnglish is the Porter stemmer. Words with letters outside a-z are
+// left alone.
+func stemEnglish(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	p := porter{b: []byte(word)}
+	p.step1()
+	p.step2()
+	p.step3()
+	p.step4()
+	p.step5()
+	return string(p.b)
+}
+
+type porter struct {
+	b []byte
+}
+
+// consonant reports whether b[i] is a consonant; y is one unless it
+// follows a consonant
+func (p *porter) consonant(i int) bool {
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.consonant(i-1)
+	}
+	return true
+}
+
+// measure counts the vowel-consonant sequences in the first n letters
+func (p *porter) measure(n int) int {
+	m, i := 0, 0
+	for i < n && p.consonant(i) {
+		i++
+	}
+	for i < n {
+		for i < n && !p.consonant(i) {
+			i++
+		}
+		if i == n {
+			break
+		}
+		for i < n && p.consonant(i) {
+			i++
+		}
+		m++
+	}
+	return m
+}
+
+func (p *porter) hasVowel(n int) bool {
+	for i := 0; i < n; i++ {
+		if !p.consonant(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleConsonant reports whether the first n letters end in a double
+// consonant
+func (p *porter) doubleConsonant(n int) bool {
+	return n >= 2 && p.b[n-1] == p.b[n-2] && p.consonant(n-1)
+}
+
+// cvc reports whether the first n letters end consonant-vowel-consonant,
+// the last not being w, x or y, as in "hop"
+func (p *porter) cvc(n int) bool {
+	if n < 3 || !p.consonant(n-1) || p.consonant(n-2) || !p.consonant(n-3) {
+		return false
+	}
+	c := p.b[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func (p *porter) ends(suffix string) bool {
+	return strings.HasSuffix(string(p.b), suffix)
+}
+
+// replace swaps suffix for repl if the stem before it has a measure
+// above min. It reports whether the word ended in suffix at all.
+func (p *porter) replace(suffix, repl string, min int) bool {
+	if !p.ends(suffix) {
+		return false
+	}
+	stem := len(p.b) - len(suffix)
+	if p.measure(stem) > min {
+		p.b = append(p.b[:stem], repl...)
+	}
+	return true
+}
+
+func (p *porter) step1() {
+	switch {
+	case p.ends("sses"), p.ends("ies"):
+		p.b = p.b[:len(p.b)-2]
+	case p.ends("ss"):
+	case p.ends("s"):
+		p.b = p.b[:len(p.b)-1]
+	}
+
+	cut := false
+	switch {
+	case p.ends("eed"):
+		p.replace("eed", "ee", 0)
+	case p.ends("ed") && p.hasVowel(len(p.b)-2):
+		p.b, cut = p.b[:len(p.b)-2], true
+	case p.ends("ing") && p.hasVowel(len(p.b)-3):
+		p.b, cut = p.b[:len(p.b)-3], true
+	}
+	if cut {
+		n := len(p.b)
+		switch {
+		case p.ends("at"), p.ends("bl"), p.ends("iz"):
+			p.b = append(p.b, 'e')
+		case p.doubleConsonant(n) && !strings.ContainsRune("lsz", rune(p.b[n-1])):
+			p.b = p.b[:n-1]
+		case p.measure(n) == 1 && p.cvc(n):
+			p.b = append(p.b, 'e')
+		}
+	}
+
+	if p.ends("y") && p.hasVowel(len(p.b)-1) {
+		p.b[len(p.b)-1] = 'i'
+	}
+}
+
+var step2Suffixes = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"},
+	{"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"},
+	{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}, {"logi", "log"},
+}
+
+var step3Suffixes = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+var step4Suffixes = []string{
+	"ement", "ance", "ence", "able", "ible", "ment", "ant", "ent", "ism", "ate",
+	"iti", "ous", "ive", "ize", "ion", "al", "er", "ic", "ou",
+}
+
+// longest returns the index of the longest of suffixes the word ends in
+func (p *porter) longest(suffixes []string) int {
+	best := -1
+	for i, s := range suffixes {
+		if p.ends(s) && (best < 0 || len(s) > len(suffixes[best])) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (p *porter) mapSuffix(rules [][2]string) {
+	suffixes := make([]string, len(rules))
+	for i, r := range rules {
+		suffixes[i] = r[0]
+	}
+	if i := p.longest(suffixes); i >= 0 {
+		p.replace(rules[i][0], rules[i][1], 0)
+	}
+}
+
+func (p *porter) step2() { p.mapSuffix(step2Suffixes) }
+
+func (p *porter) step3() { p.mapSuffix(step3Suffixes) }
+
+func (p *porter) step4() {
+	i := p.longest(step4Suffixes)
+	if i < 0 {
+		return
+	}
+	suffix := step4Suffixes[i]
+	stem := len(p.b) - len(suffix)
+	if suffix == "ion" && (stem == 0 || (p.b[stem-1] != 's' && p.b[stem-1] != 't')) {
+		return
+	}
+	if p.measure(stem) > 1 {
+		p.b = p.b[:stem]
+	}
+}
+
+func (p *porter) step5() {
+	if n := len(p.b); p.ends("e") {
+		if m := p.measure(n - 1); m > 1 || (m == 1 && !p.cvc(n-1)) {
+			p.b = p.b[:n-1]
+		}
+	}
+	if n := len(p.b); p.ends("ll") && p.measure(n) > 1 {
+		p.b = p.b[:n-1]
+	}
+}
+
+// foldAccents maps accented vowels to plain ones, as the German and
+// Spanish stemmers compare words without them
+var foldAccents = strings.NewReplacer(
+	"ä", "a", "à", "a", "á", "a", "â", "a",
+	"ö", "o", "ò", "o", "ó", "o", "ô", "o",
+	"ü", "u", "ù", "u", "ú", "u", "û", "u",
+	"ë", "e", "è", "e", "é", "e", "ê", "e",
+	"ï", "i", "ì", "i", "í", "i", "î", "i",
+)
+
+// stemGerman is Savoy's light German stemmer: it folds umlauts and strips
+// common inflections
+func stemGerman(word string) string {
+	s := []rune(foldAccents.Replace(word))
+	s = s[:germanStep1(s)]
+	return string(s[:germanStep2(s)])
+}
+
+// stEnding reports whether an -s or -st after r is an inflection
+func stEnding(r rune) bool {
+	return strings.ContainsRune("bdfghklmnrt", r)
+}
+
+func germanStep1(s []rune) int {
+	n := len(s)
+	end := string(s[max(0, n-3):])
+	switch {
+	case n > 5 && strings.HasSuffix(end, "ern"):
+		return n - 3
+	case n > 4 && (strings.HasSuffix(end, "em") || strings.HasSuffix(end, "en") ||
+		strings.HasSuffix(end, "er") || strings.HasSuffix(end, "es")):
+		return n - 2
+	case n > 3 && s[n-1] == 'e':
+		return n - 1
+	case n > 3 && s[n-1] == 's' && stEnding(s[n-2]):
+		return n - 1
+	}
+	return n
+}
+
+func germanStep2(s []rune) int {
+	n := len(s)
+	end := string(s[max(0, n-3):])
+	switch {
+	case n > 5 && strings.HasSuffix(end, "est"):
+		return n - 3
+	case n > 4 && (strings.HasSuffix(end, "er") || strings.HasSuffix(end, "en")):
+		return n - 2
+	case n > 4 && strings.HasSuffix(end, "st") && stEnding(s[n-3]):
+		return n - 2
+	}
+	return n
+}
+
+// stemSpanish is Savoy's light Spanish stemmer: it folds accents and
+// strips gender and plural endings
+func stemSpanish(word string) string {
+	s := []rune(foldAccents.Replace(word))
+	n := len(s)
+	if n < 5 {
+		return string(s)
+	}
+	switch s[n-1] {
+	case 'o', 'a', 'e':
+		return string(s[:n-1])
+	case 's':
+		switch {
+		case s[n-2] == 'e' && s[n-3] == 's' && s[n-4] == 'e':
+			return string(s[:n-2])
+		case s[n-2] == 'e' && s[n-3] == 'c':
+			s[n-3] = 'z' // luces, luz
+			return string(s[:n-2])
+		case s[n-2] == 'o' || s[n-2] == 'a' || s[n-2] == 'e':
+			return string(s[:n-2])
+		}
+	}
+	return string(s)
+}
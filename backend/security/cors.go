@@ -0,0 +1,94 @@
+package security
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CORSConfig decides which other sites browsers let call the API. Without
+// any AllowOrigins only pages served by Notty itself can.
+type CORSConfig struct {
+	// AllowOrigins lists origins like "https://notes.example.com", or "*"
+	// for every origin
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"`
+	ExposeHeaders    []string `json:"expose_headers"`
+	AllowCredentials bool     `json:"allow_credentials"` // cookies and HTTP auth
+	MaxAge           int      `json:"max_age"`           // seconds preflights are cached
+
+	// OpenPrefixes are routes any site may read without credentials, like
+	// the published notes API meant for static sites
+	OpenPrefixes []string `json:"open_prefixes"`
+
+	// Dev also allows every localhost origin, with credentials, for
+	// frontends on a dev server. Don't turn it on in production.
+	Dev bool `json:"dev"`
+}
+
+// Validate rejects settings browsers would refuse or that make no sense
+func (cfg CORSConfig) Validate() error {
+	for _, origin := range cfg.AllowOrigins {
+		if origin == "*" {
+			// Dev mode allows credentials too
+			if cfg.AllowCredentials || cfg.Dev {
+				return fmt.Errorf("cors can't allow credentials for every origin, and dev mode does")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("invalid cors origin %q, want scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// CORS answers preflights and sets the CORS headers of the policy
+func CORS(cfg CORSConfig) echo.MiddlewareFunc {
+	allowed := map[string]bool{}
+	for _, origin := range cfg.AllowOrigins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	strict := middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOriginFunc: func(origin string) (bool, error) {
+			return allowed["*"] || allowed[origin] || (cfg.Dev && isLocalhost(origin)), nil
+		},
+		AllowMethods:     cfg.AllowMethods,
+		AllowHeaders:     cfg.AllowHeaders,
+		ExposeHeaders:    cfg.ExposeHeaders,
+		AllowCredentials: cfg.AllowCredentials || cfg.Dev,
+		MaxAge:           cfg.MaxAge,
+	})
+	open := middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{"GET", "HEAD"},
+		AllowHeaders:  cfg.AllowHeaders,
+		ExposeHeaders: cfg.ExposeHeaders,
+		MaxAge:        cfg.MaxAge,
+	})
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		strictNext, openNext := strict(next), open(next)
+		return func(c echo.Context) error {
+			for _, prefix := range cfg.OpenPrefixes {
+				if strings.HasPrefix(c.Request().URL.Path, prefix) {
+					return openNext(c)
+				}
+			}
+			return strictNext(c)
+		}
+	}
+}
+
+func isLocalhost(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
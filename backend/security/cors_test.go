@@ -0,0 +1,21 @@
+package security
+
+import "testing"
+
+func TestCORSValidate(t *testing.T) {
+	for _, tc := range []struct {
+		cfg CORSConfig
+		ok  bool
+	}{
+		{CORSConfig{AllowOrigins: []string{"*"}}, true},
+		{CORSConfig{AllowOrigins: []string{"https://notes.example.com"}, AllowCredentials: true}, true},
+		{CORSConfig{AllowOrigins: []string{"https://notes.example.com"}, Dev: true}, true},
+		{CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}, false},
+		{CORSConfig{AllowOrigins: []string{"*"}, Dev: true}, false},
+		{CORSConfig{AllowOrigins: []string{"notes.example.com"}}, false},
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%+v) = %v", tc.cfg, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"note/backend/auth"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CSRFConfig configures CSRF protection for browsers that authenticate
+// with a session cookie
+type CSRFConfig struct {
+	// SessionCookie names the cookie that authenticates a browser session,
+	// which logging in at /api/session sets. Requests without it carry no
+	// ambient credentials and aren't checked.
+	SessionCookie string `json:"session_cookie"`
+
+	// CookieName names the cookie the CSRF token is issued in. Clients
+	// echo it back in the X-CSRF-Token header or a _csrf form field.
+	CookieName string `json:"cookie_name"`
+
+	// SameSite is "strict", "lax" or "none" and applies to the token
+	// cookie; session cookies should use the same setting
+	SameSite string `json:"same_site"`
+
+	// Secure restricts the token cookie to HTTPS
+	Secure bool `json:"secure"`
+}
+
+// SameSiteMode parses SameSite
+func (cfg CSRFConfig) SameSiteMode() (http.SameSite, error) {
+	switch strings.ToLower(cfg.SameSite) {
+	case "", "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite mode %q", cfg.SameSite)
+}
+
+// CSRF issues a token cookie to browser sessions and rejects their
+// state-changing requests unless they send the token back. API clients
+// whose bearer token authenticates, as authenticated says, are exempt,
+// since a forged cross-site request can't carry one. Query tokens
+// exempt nothing: a forged request can add any ?token= to ride on the
+// session, and the routes they authenticate only read.
+func CSRF(cfg CSRFConfig, authenticated func(secret string) bool) echo.MiddlewareFunc {
+	sameSite, err := cfg.SameSiteMode()
+	if err != nil {
+		panic(err)
+	}
+	return middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper: func(c echo.Context) bool {
+			if _, err := c.Cookie(cfg.SessionCookie); err != nil {
+				return true
+			}
+			secret := auth.BearerToken(c.Request())
+			return secret != "" && authenticated(secret)
+		},
+		TokenLookup:    "header:" + echo.HeaderXCSRFToken + ",form:_csrf",
+		CookieName:     cfg.CookieName,
+		CookiePath:     "/",
+		CookieSameSite: sameSite,
+		CookieSecure:   cfg.Secure,
+	})
+}
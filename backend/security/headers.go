@@ -0,0 +1,106 @@
+package security
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Policy lists the security headers sent on responses. Empty fields are
+// not sent.
+type Policy struct {
+	ContentSecurityPolicy   string `json:"content_security_policy"`
+	StrictTransportSecurity string `json:"strict_transport_security"` // only sent over HTTPS
+	ContentTypeOptions      string `json:"x_content_type_options"`
+	ReferrerPolicy          string `json:"referrer_policy"`
+	FrameOptions            string `json:"x_frame_options"`
+}
+
+// Policies maps route prefixes to the policy for routes under them. The
+// longest matching prefix wins.
+type Policies map[string]Policy
+
+const hsts = "max-age=63072000; includeSubDomains"
+
+// DefaultPolicies locks everything down. The JSON API never needs to run
+// scripts or be framed. Embeds are meant to be framed and build their own
+// nonce-based CSP, so they only get the headers that don't get in the way.
+func DefaultPolicies() Policies {
+	return Policies{
+		"/": {
+			ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'",
+			StrictTransportSecurity: hsts,
+			ContentTypeOptions:      "nosniff",
+			ReferrerPolicy:          "no-referrer",
+			FrameOptions:            "DENY",
+		},
+		"/embed/": {
+			StrictTransportSecurity: hsts,
+			ContentTypeOptions:      "nosniff",
+			ReferrerPolicy:          "strict-origin-when-cross-origin",
+		},
+	}
+}
+
+// Merge returns p with the policies in overrides replacing those for the
+// same prefix
+func (p Policies) Merge(overrides Policies) Policies {
+	merged := make(Policies, len(p)+len(overrides))
+	for prefix, policy := range p {
+		merged[prefix] = policy
+	}
+	for prefix, policy := range overrides {
+		merged[prefix] = policy
+	}
+	return merged
+}
+
+// Headers sets the security headers of the matching policy on every
+// response. Handlers can still set a header themselves; whatever they set
+// wins, which lets pages with per-request CSP nonces build their own.
+func Headers(policies Policies) echo.MiddlewareFunc {
+	prefixes := make([]string, 0, len(policies))
+	for prefix := range policies {
+		prefixes = append(prefixes, prefix)
+	}
+	// Longest first so the first match is the most specific one
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(path, prefix) {
+					policy := policies[prefix]
+					tls := c.Scheme() == "https"
+					res := c.Response()
+					res.Before(func() { apply(res.Header(), policy, tls) })
+					break
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+type header interface {
+	Get(string) string
+	Set(string, string)
+}
+
+func apply(h header, p Policy, tls bool) {
+	setDefault(h, "Content-Security-Policy", p.ContentSecurityPolicy)
+	if tls {
+		setDefault(h, "Strict-Transport-Security", p.StrictTransportSecurity)
+	}
+	setDefault(h, "X-Content-Type-Options", p.ContentTypeOptions)
+	setDefault(h, "Referrer-Policy", p.ReferrerPolicy)
+	setDefault(h, "X-Frame-Options", p.FrameOptions)
+}
+
+func setDefault(h header, key, value string) {
+	if value != "" && h.Get(key) == "" {
+		h.Set(key, value)
+	}
+}
@@ -0,0 +1,90 @@
+package security
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// redacted replaces secrets in logged URIs
+const redacted = "REDACTED"
+
+// Logger logs every request as a line of JSON to the output of Echo's
+// logger, like Echo's Logger middleware, but with the ?token= query
+// parameter and :token path parameters that carry secrets redacted from
+// the URI
+func Logger() echo.MiddlewareFunc {
+	var mu sync.Mutex
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogRemoteIP:      true,
+		LogHost:          true,
+		LogMethod:        true,
+		LogURI:           true,
+		LogUserAgent:     true,
+		LogStatus:        true,
+		LogError:         true,
+		LogLatency:       true,
+		LogRequestID:     true,
+		LogContentLength: true,
+		LogResponseSize:  true,
+		HandleError:      true, // so the status logged is the one sent
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			line := struct {
+				Time      string `json:"time"`
+				ID        string `json:"id"`
+				RemoteIP  string `json:"remote_ip"`
+				Host      string `json:"host"`
+				Method    string `json:"method"`
+				URI       string `json:"uri"`
+				UserAgent string `json:"user_agent"`
+				Status    int    `json:"status"`
+				Error     string `json:"error"`
+				Latency   int64  `json:"latency"`
+				LatencyH  string `json:"latency_human"`
+				BytesIn   string `json:"bytes_in"`
+				BytesOut  int64  `json:"bytes_out"`
+			}{
+				Time:      v.StartTime.Format(time.RFC3339Nano),
+				ID:        v.RequestID,
+				RemoteIP:  v.RemoteIP,
+				Host:      v.Host,
+				Method:    v.Method,
+				URI:       redactURI(c, v.URI),
+				UserAgent: v.UserAgent,
+				Status:    v.Status,
+				Latency:   v.Latency.Nanoseconds(),
+				LatencyH:  v.Latency.String(),
+				BytesIn:   v.ContentLength,
+				BytesOut:  v.ResponseSize,
+			}
+			if v.Error != nil {
+				line.Error = v.Error.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return json.NewEncoder(c.Logger().Output()).Encode(line)
+		},
+	})
+}
+
+// redactURI hides the token query and path parameters of a request URI
+func redactURI(c echo.Context, uri string) string {
+	if token := c.Param("token"); token != "" {
+		uri = strings.ReplaceAll(uri, url.PathEscape(token), redacted)
+	}
+	path, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil || !query.Has("token") {
+		return uri
+	}
+	query.Set("token", redacted)
+	return path + "?" + query.Encode()
+}
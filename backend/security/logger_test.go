@@ -0,0 +1,29 @@
+package security
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoggerRedactsTokens(t *testing.T) {
+	var log bytes.Buffer
+	e := echo.New()
+	e.Logger.SetOutput(&log)
+	e.Use(Logger())
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/api/calendar.ics", ok)
+	e.GET("/embed/:token", ok)
+
+	for _, uri := range []string{"/api/calendar.ics?token=s3cret&days=7", "/embed/s3cret"} {
+		log.Reset()
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, uri, nil))
+		if strings.Contains(log.String(), "s3cret") || !strings.Contains(log.String(), redacted) {
+			t.Errorf("%s is logged as %s", uri, log.String())
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package slo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteMetrics writes the metrics in the Prometheus text format. Without
+// requests in a window errors are 0 and availability is 1, so quiet
+// periods don't set alerts off.
+func (t *Tracker) WriteMetrics(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	routes := make([]string, 0, len(t.routes))
+	for route := range t.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	budget := 1 - t.objectives.Availability
+
+	b := bufio.NewWriter(w)
+	m := metricWriter{b}
+	m.gauge("slo:objective:ratio", "Share of requests that must not fail with a server error")
+	m.sample("slo:objective:ratio", "", t.objectives.Availability)
+	m.gauge("slo:latency_objective:seconds", "p99 latency each critical route should stay under")
+	m.sample("slo:latency_objective:seconds", "", t.objectives.Latency.Seconds())
+
+	for _, level := range []string{"slo", "route"} {
+		of := "all requests"
+		if level == "route" {
+			of = "each critical route"
+		}
+		each := func(f func(s *series, labels string)) {
+			if level == "slo" {
+				f(t.all, "")
+				return
+			}
+			for _, route := range routes {
+				f(t.routes[route], routeLabels(route))
+			}
+		}
+		for _, win := range Windows {
+			name := level + ":sli_error:ratio_rate" + win.Name
+			m.gauge(name, "Share of "+of+" that failed with a server error over "+win.Name)
+			each(func(s *series, labels string) { m.sample(name, labels, s.window(now, win.Duration).ratio()) })
+
+			name = level + ":availability:ratio_rate" + win.Name
+			m.gauge(name, "Share of "+of+" that didn't fail with a server error over "+win.Name)
+			each(func(s *series, labels string) { m.sample(name, labels, 1-s.window(now, win.Duration).ratio()) })
+
+			name = level + ":error_budget_burn:ratio_rate" + win.Name
+			m.gauge(name, "How fast the error budget of "+of+" was spent over "+win.Name+"; 1 spends it exactly over the budget period")
+			each(func(s *series, labels string) {
+				m.sample(name, labels, burn(s.window(now, win.Duration).ratio(), budget))
+			})
+		}
+		name := level + ":error_budget_remaining:ratio"
+		m.gauge(name, "Share of the error budget of "+of+" left in the last 30 days; negative once overspent")
+		each(func(s *series, labels string) { m.sample(name, labels, 1-burn(s.budgetPeriod(now).ratio(), budget)) })
+	}
+
+	for _, win := range LatencyWindows {
+		name := "route:request_duration_seconds:p99_rate" + win.Name
+		over := "route:request_duration_p99_over_objective:ratio_rate" + win.Name
+		m.gauge(name, "p99 latency of each critical route over "+win.Name)
+		var ratios []string
+		for _, route := range routes {
+			p99, ok := t.routes[route].quantile(now, win.Duration, 0.99)
+			if !ok {
+				continue
+			}
+			m.sample(name, routeLabels(route), p99)
+			if t.objectives.Latency > 0 {
+				ratios = append(ratios, sampleLine(over, routeLabels(route), p99/t.objectives.Latency.Seconds()))
+			}
+		}
+		m.gauge(over, "p99 latency of each critical route over "+win.Name+" divided by the objective; above 1 misses it")
+		for _, line := range ratios {
+			b.WriteString(line)
+		}
+	}
+
+	m.counter("notty_http_requests_total", "Requests answered, by status code")
+	for _, code := range sortedCodes(t.all.codes) {
+		m.sample("notty_http_requests_total", fmt.Sprintf(`{code="%d"}`, code), float64(t.all.codes[code]))
+	}
+	m.counter("notty_route_requests_total", "Requests to critical routes answered, by status code")
+	for _, route := range routes {
+		s := t.routes[route]
+		for _, code := range sortedCodes(s.codes) {
+			labels := strings.TrimSuffix(routeLabels(route), "}") + fmt.Sprintf(`,code="%d"}`, code)
+			m.sample("notty_route_requests_total", labels, float64(s.codes[code]))
+		}
+	}
+	const hist = "notty_route_request_duration_seconds"
+	fmt.Fprintf(b, "# HELP %s Latency of critical routes\n# TYPE %s histogram\n", hist, hist)
+	for _, route := range routes {
+		s := t.routes[route]
+		labels := strings.TrimSuffix(routeLabels(route), "}")
+		var cumulative int64
+		for i, n := range s.hist.buckets {
+			cumulative += n
+			le := "+Inf"
+			if i < len(Buckets) {
+				le = formatFloat(Buckets[i])
+			}
+			m.sample(hist+"_bucket", labels+`,le="`+le+`"}`, float64(cumulative))
+		}
+		m.sample(hist+"_sum", labels+"}", s.hist.sum)
+		m.sample(hist+"_count", labels+"}", float64(cumulative))
+	}
+	return b.Flush()
+}
+
+// burn is how many times faster than allowed the error budget is spent
+func burn(errorRatio, budget float64) float64 {
+	if budget <= 0 {
+		return 0
+	}
+	return errorRatio / budget
+}
+
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (m metricWriter) gauge(name, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func (m metricWriter) counter(name, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+}
+
+func (m metricWriter) sample(name, labels string, value float64) {
+	m.w.WriteString(sampleLine(name, labels, value))
+}
+
+func sampleLine(name, labels string, value float64) string {
+	return name + labels + " " + formatFloat(value) + "\n"
+}
+
+// routeLabels turns "GET /api/notes" into {method="GET",route="/api/notes"}
+func routeLabels(route string) string {
+	method, path, _ := strings.Cut(route, " ")
+	return `{method="` + escapeLabel(method) + `",route="` + escapeLabel(path) + `"}`
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func sortedCodes(codes map[int]int64) []int {
+	list := make([]int, 0, len(codes))
+	for code := range codes {
+		list = append(list, code)
+	}
+	sort.Ints(list)
+	return list
+}
@@ -0,0 +1,44 @@
+package slo
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware records every API request with the route it matched. It
+// has to come before Recover so it sees the 500 a panic is answered with.
+func Middleware(t *Tracker) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if !strings.HasPrefix(c.Request().URL.Path, "/api/") {
+				return err
+			}
+			code := c.Response().Status
+			if err != nil {
+				// The error handler hasn't answered yet
+				code = http.StatusInternalServerError
+				var he *echo.HTTPError
+				if errors.As(err, &he) {
+					code = he.Code
+				}
+			}
+			t.Observe(c.Request().Method+" "+c.Path(), code, time.Since(start))
+			return err
+		}
+	}
+}
+
+// Handler serves the metrics to Prometheus
+func Handler(t *Tracker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return t.WriteMetrics(c.Response())
+	}
+}
@@ -0,0 +1,249 @@
+// Package slo tracks how well the service meets its service level
+// objectives and exposes the results as Prometheus metrics. The ratios
+// and quantiles that would otherwise take recording rules are computed
+// here, under names that follow the level:metric:operations convention,
+// so alerts can use them as they are.
+package slo
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Objectives are what the service aims for
+type Objectives struct {
+	// Availability is the share of requests that must not fail with a
+	// server error, like 0.999
+	Availability float64
+	// Latency is what the p99 of each critical route should stay under
+	Latency time.Duration
+	// Routes are the critical routes as "METHOD /path/:param", the way
+	// they are registered
+	Routes []string
+}
+
+// Windows the error ratio and burn rate are computed over. They are the
+// ones multiwindow burn rate alerts pair up: 5m with 1h, 30m with 6h and
+// 6h with 3d.
+var Windows = []Window{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+	{"1d", 24 * time.Hour},
+	{"3d", 72 * time.Hour},
+}
+
+// LatencyWindows are the windows the p99 latency is computed over
+var LatencyWindows = []Window{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+}
+
+// Window is a trailing time range, named as in metric names
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// BudgetPeriod is the period the error budget is spent over
+const BudgetPeriod = 30 * 24 * time.Hour
+
+// Buckets are the upper bounds of the latency histogram, in seconds
+var Buckets = [...]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	minuteSlots  = 72 * 60 // the longest window
+	latencySlots = 60      // the longest latency window, in minutes
+	daySlots     = 30      // the budget period
+)
+
+// counts are the requests and server errors seen in some time range
+type counts struct {
+	at     int64 // minute or day the counts are of
+	total  int64
+	errors int64
+}
+
+// histogram counts requests by latency; the last bucket is +Inf
+type histogram struct {
+	at      int64
+	buckets [len(Buckets) + 1]int64
+	sum     float64
+}
+
+// series is the history of one route, or of all requests
+type series struct {
+	minutes [minuteSlots]counts
+	days    [daySlots]counts
+	latency [latencySlots]histogram
+
+	// Running totals for the raw metrics
+	codes map[int]int64
+	hist  histogram
+}
+
+func newSeries() *series {
+	return &series{codes: map[int]int64{}}
+}
+
+func (s *series) observe(now time.Time, code int, d time.Duration) {
+	minute := now.Unix() / 60
+	day := now.Unix() / 86400
+	failed := code >= 500
+	s.minutes[minute%minuteSlots].add(minute, failed)
+	s.days[day%daySlots].add(day, failed)
+	h := &s.latency[minute%latencySlots]
+	if h.at != minute {
+		*h = histogram{at: minute}
+	}
+	h.add(d)
+	s.hist.add(d)
+	s.codes[code]++
+}
+
+// add counts a request in the slot, which is reset first if it still
+// holds the counts of an earlier minute or day
+func (c *counts) add(at int64, failed bool) {
+	if c.at != at {
+		*c = counts{at: at}
+	}
+	c.total++
+	if failed {
+		c.errors++
+	}
+}
+
+func (h *histogram) add(d time.Duration) {
+	seconds := d.Seconds()
+	h.buckets[sort.SearchFloat64s(Buckets[:], seconds)]++
+	h.sum += seconds
+}
+
+// window sums the counts of the last d, the current minute included
+func (s *series) window(now time.Time, d time.Duration) counts {
+	minute := now.Unix() / 60
+	first := minute - int64(d/time.Minute) + 1
+	var sum counts
+	for _, c := range s.minutes {
+		if c.at >= first && c.at <= minute {
+			sum.total += c.total
+			sum.errors += c.errors
+		}
+	}
+	return sum
+}
+
+// budgetPeriod sums the counts of the budget period, today included
+func (s *series) budgetPeriod(now time.Time) counts {
+	day := now.Unix() / 86400
+	var sum counts
+	for _, c := range s.days {
+		if c.at > day-daySlots && c.at <= day {
+			sum.total += c.total
+			sum.errors += c.errors
+		}
+	}
+	return sum
+}
+
+// quantile estimates the q quantile of the latency over the last d like
+// histogram_quantile does, by interpolating within the bucket it falls in.
+// It returns false when there were no requests.
+func (s *series) quantile(now time.Time, d time.Duration, q float64) (float64, bool) {
+	minute := now.Unix() / 60
+	first := minute - int64(d/time.Minute) + 1
+	var buckets [len(Buckets) + 1]int64
+	var total int64
+	for _, h := range s.latency {
+		if h.at >= first && h.at <= minute {
+			for i, n := range h.buckets {
+				buckets[i] += n
+				total += n
+			}
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	rank := q * float64(total)
+	var seen int64
+	for i, n := range buckets {
+		if float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		if i == len(Buckets) {
+			// Beyond the last bound all we know is that it is above it
+			return Buckets[len(Buckets)-1], true
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = Buckets[i-1]
+		}
+		return lower + (Buckets[i]-lower)*(rank-float64(seen))/float64(n), true
+	}
+	return Buckets[len(Buckets)-1], true
+}
+
+// Tracker records requests against the objectives. It is safe for
+// concurrent use.
+type Tracker struct {
+	objectives Objectives
+
+	mu     sync.Mutex
+	all    *series
+	routes map[string]*series // by "METHOD /path"
+	now    func() time.Time
+}
+
+// New returns a tracker for the objectives
+func New(objectives Objectives) *Tracker {
+	t := &Tracker{
+		objectives: objectives,
+		all:        newSeries(),
+		routes:     map[string]*series{},
+		now:        time.Now,
+	}
+	// Critical routes are reported from the start, not from their first
+	// request on
+	for _, route := range objectives.Routes {
+		t.routes[route] = newSeries()
+	}
+	return t
+}
+
+// Observe records a request to route ("METHOD /path/:param") that was
+// answered with code after d
+func (t *Tracker) Observe(route string, code int, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.all.observe(now, code, d)
+	if s, ok := t.routes[route]; ok {
+		s.observe(now, code, d)
+	}
+}
+
+// ratio returns errors/total, 0 without requests
+func (c counts) ratio() float64 {
+	if c.total == 0 {
+		return 0
+	}
+	return float64(c.errors) / float64(c.total)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Availability returns the share of requests over the budget period that
+// didn't fail with a server error. It reports false before any request.
+func (t *Tracker) Availability() (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.all.budgetPeriod(t.now())
+	return 1 - c.ratio(), c.total > 0
+}
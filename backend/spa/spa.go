@@ -0,0 +1,74 @@
+// Package spa serves a single-page app: its files where they exist and
+// index.html for every other page, which the app routes on the client
+package spa
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pageCSP lets the app load its own scripts, styles and images and talk
+// to the API it is served from
+const pageCSP = "default-src 'self'; img-src 'self' data:; style-src 'self' 'unsafe-inline'; frame-ancestors 'none'"
+
+// Cache policies. Vite puts a content hash in the names of the files under
+// assets/, so they never change; everything else may change on deploy.
+const (
+	cacheHashed   = "public, max-age=31536000, immutable"
+	cacheUnhashed = "no-cache"
+)
+
+// Handler serves the app in fsys for GET requests that no other route
+// matched. Paths under the prefixes in reserved, like "/api/", answer 404
+// instead of falling back to the app, so API clients get an error they
+// understand.
+func Handler(fsys fs.FS, reserved ...string) echo.HandlerFunc {
+	files := http.FS(fsys)
+	return func(c echo.Context) error {
+		p := c.Request().URL.Path
+		for _, prefix := range reserved {
+			if strings.HasPrefix(p, prefix) {
+				return echo.ErrNotFound
+			}
+		}
+		name := strings.TrimPrefix(path.Clean("/"+p), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		info, err := fs.Stat(fsys, name)
+		switch {
+		case err == nil && !info.IsDir():
+		case errors.Is(err, fs.ErrNotExist) && path.Ext(name) != "":
+			// A missing file, not a client route
+			return echo.ErrNotFound
+		default:
+			name = "index.html"
+		}
+
+		h := c.Response().Header()
+		if strings.HasPrefix(name, "assets/") {
+			h.Set("Cache-Control", cacheHashed)
+		} else {
+			h.Set("Cache-Control", cacheUnhashed)
+		}
+		if path.Ext(name) == ".html" {
+			h.Set("Content-Security-Policy", pageCSP)
+		}
+		f, err := files.Open("/" + name)
+		if err != nil {
+			return echo.ErrNotFound
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		http.ServeContent(c.Response(), c.Request(), name, stat.ModTime(), f)
+		return nil
+	}
+}
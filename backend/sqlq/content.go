@@ -0,0 +1,57 @@
+package sqlq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Content encodings. Rows written before content was compressed, and
+// those not worth compressing, are plain.
+const (
+	EncodingPlain = ""
+	EncodingGzip  = "gzip" // gzip, in base64 to fit a text column
+)
+
+// EncodeContent returns content compressed for ContentCompressed and its
+// encoding when that makes it smaller, or content and EncodingPlain. The
+// database can't look into compressed content, so NoteFilter.Notes
+// matches it once decoded.
+func EncodeContent(content string) (string, string) {
+	var buf bytes.Buffer
+	enc := base64.NewEncoder(base64.StdEncoding, &buf)
+	zw := gzip.NewWriter(enc)
+	zw.Write([]byte(content))
+	zw.Close()
+	enc.Close()
+	if buf.Len() >= len(content) {
+		return content, EncodingPlain
+	}
+	return buf.String(), EncodingGzip
+}
+
+// DecodeContent returns the content of a row from its Content,
+// ContentCompressed and ContentEncoding columns. Readers go through it
+// for every row, so rows a migration hasn't got to yet read the same as
+// those it has.
+func DecodeContent(content string, compressed sql.NullString, encoding string) (string, error) {
+	switch encoding {
+	case EncodingPlain:
+		return content, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, strings.NewReader(compressed.String)))
+		if err != nil {
+			return "", fmt.Errorf("decoding content: %w", err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return "", fmt.Errorf("decoding content: %w", err)
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unknown content encoding %q", encoding)
+}
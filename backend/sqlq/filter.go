@@ -0,0 +1,93 @@
+package sqlq
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// NoteFilter holds the filters note listings accept
+type NoteFilter struct {
+	Notebook     *string
+	Published    *bool
+	Text         string // matched against title and content
+	UpdatedSince *time.Time
+	Limit        int
+	Offset       int
+}
+
+// Select returns the query for the notes matching f, newest first. The
+// database can only match Text against plain content, so with Text every
+// row with compressed content is selected too and the page is left for
+// Notes to cut once it decoded them.
+func (f NoteFilter) Select() *Select {
+	s := From(Notes).Columns(NoteID, Title, Content, ContentCompressed, ContentEncoding, Notebook, Published, CreatedAt, UpdatedAt)
+	if f.Notebook != nil {
+		s.Where(Eq(Notebook, *f.Notebook))
+	}
+	if f.Published != nil {
+		s.Where(Eq(Published, *f.Published))
+	}
+	if f.Text != "" {
+		s.Where(Or(Contains(Title, f.Text), Contains(Content, f.Text), Eq(ContentEncoding, EncodingGzip)))
+	}
+	if f.UpdatedSince != nil {
+		s.Where(Gt(UpdatedAt, *f.UpdatedSince))
+	}
+	s.OrderBy(UpdatedAt, true)
+	if f.Text != "" {
+		return s
+	}
+	return s.Limit(f.Limit).Offset(f.Offset)
+}
+
+// NoteRow is a note as Notes reads it, with its content decoded
+type NoteRow struct {
+	ID        string
+	Title     string
+	Content   string
+	Notebook  string
+	Published bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Notes returns the notes matching f, newest first
+func (f NoteFilter) Notes(ctx context.Context, p *Stmts) ([]NoteRow, error) {
+	rows, err := p.Query(ctx, f.Select())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []NoteRow
+	skip := f.Offset
+	for rows.Next() {
+		var n NoteRow
+		var compressed sql.NullString
+		var encoding string
+		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &compressed, &encoding, &n.Notebook, &n.Published, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if n.Content, err = DecodeContent(n.Content, compressed, encoding); err != nil {
+			return nil, err
+		}
+		if f.Text == "" {
+			list = append(list, n)
+			continue
+		}
+		// The query matched compressed rows whatever their content
+		if encoding != EncodingPlain && !strings.Contains(n.Title, f.Text) && !strings.Contains(n.Content, f.Text) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		list = append(list, n)
+		if len(list) == f.Limit {
+			break
+		}
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,301 @@
+// Package sqlq builds the SQL the storage backends run. Table and column
+// names can only come from the values declared here and every value is
+// bound as a statement parameter, so user input never becomes part of
+// the SQL text.
+package sqlq
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Dialect picks the placeholder style of a database
+type Dialect int
+
+const (
+	Question Dialect = iota // ?, as in SQLite and MySQL
+	Dollar                  // $1, $2, ..., as in PostgreSQL
+)
+
+// Table and Column can't be built from strings outside this package
+type Table struct{ name string }
+type Column struct{ name string }
+
+var Notes = Table{"notes"}
+
+var (
+	NoteID  = Column{"id"}
+	Title   = Column{"title"}
+	Content = Column{"content"}
+	// ContentEncoding says how ContentCompressed is compressed, with
+	// Content left empty; see DecodeContent
+	ContentEncoding   = Column{"content_encoding"}
+	ContentCompressed = Column{"content_compressed"}
+	Notebook          = Column{"notebook"}
+	Published         = Column{"published"}
+	CreatedAt         = Column{"created_at"}
+	UpdatedAt         = Column{"updated_at"}
+)
+
+// Cond is a WHERE condition. Its SQL refers to values only through
+// placeholders, which are numbered when the query is built.
+type Cond struct {
+	sql  string // with ? for every value
+	args []any
+}
+
+func Eq(col Column, v any) Cond {
+	return Cond{col.name + " = ?", []any{v}}
+}
+
+func Gt(col Column, v any) Cond {
+	return Cond{col.name + " > ?", []any{v}}
+}
+
+func Lt(col Column, v any) Cond {
+	return Cond{col.name + " < ?", []any{v}}
+}
+
+// In matches any of values. Without values it matches nothing.
+func In(col Column, values ...any) Cond {
+	if len(values) == 0 {
+		return Cond{"1 = 0", nil}
+	}
+	return Cond{col.name + " IN (?" + strings.Repeat(", ?", len(values)-1) + ")", values}
+}
+
+// Contains matches s anywhere in col. LIKE wildcards in s match
+// themselves. They are escaped with ! rather than a backslash, which
+// MySQL would read as escaping the closing quote of ESCAPE '\'.
+func Contains(col Column, s string) Cond {
+	escaped := likeEscaper.Replace(s)
+	return Cond{col.name + ` LIKE ? ESCAPE '!'`, []any{"%" + escaped + "%"}}
+}
+
+var likeEscaper = strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`)
+
+// And and Or group conditions in parentheses
+func And(conds ...Cond) Cond { return join(" AND ", conds) }
+func Or(conds ...Cond) Cond  { return join(" OR ", conds) }
+
+func join(sep string, conds []Cond) Cond {
+	var parts []string
+	var args []any
+	for _, c := range conds {
+		parts = append(parts, c.sql)
+		args = append(args, c.args...)
+	}
+	return Cond{"(" + strings.Join(parts, sep) + ")", args}
+}
+
+// Select is a SELECT statement under construction
+type Select struct {
+	table   Table
+	columns []Column
+	where   []Cond
+	order   []string
+	limit   int
+	offset  int
+}
+
+func From(t Table) *Select {
+	return &Select{table: t}
+}
+
+// Columns picks the columns to select; without it every column is
+func (s *Select) Columns(cols ...Column) *Select {
+	s.columns = append(s.columns, cols...)
+	return s
+}
+
+// Where adds a condition; several are combined with AND
+func (s *Select) Where(c Cond) *Select {
+	s.where = append(s.where, c)
+	return s
+}
+
+func (s *Select) OrderBy(col Column, desc bool) *Select {
+	if desc {
+		s.order = append(s.order, col.name+" DESC")
+	} else {
+		s.order = append(s.order, col.name)
+	}
+	return s
+}
+
+// Limit and Offset take effect when positive. SQLite and MySQL have no
+// OFFSET without LIMIT, so an Offset alone is built with noLimit.
+func (s *Select) Limit(n int) *Select {
+	s.limit = n
+	return s
+}
+
+func (s *Select) Offset(n int) *Select {
+	s.offset = n
+	return s
+}
+
+// Build returns the SQL and the arguments for its placeholders
+func (s *Select) Build(d Dialect) (string, []any) {
+	var b strings.Builder
+	var args []any
+	b.WriteString("SELECT ")
+	if len(s.columns) == 0 {
+		b.WriteString("*")
+	}
+	for i, col := range s.columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(col.name)
+	}
+	b.WriteString(" FROM " + s.table.name)
+	for i, c := range s.where {
+		if i == 0 {
+			b.WriteString(" WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		b.WriteString(c.sql)
+		args = append(args, c.args...)
+	}
+	if len(s.order) > 0 {
+		b.WriteString(" ORDER BY " + strings.Join(s.order, ", "))
+	}
+	if s.limit > 0 {
+		b.WriteString(" LIMIT ?")
+		args = append(args, s.limit)
+	} else if s.offset > 0 {
+		b.WriteString(" LIMIT " + noLimit)
+	}
+	if s.offset > 0 {
+		b.WriteString(" OFFSET ?")
+		args = append(args, s.offset)
+	}
+	return placeholders(b.String(), d), args
+}
+
+// noLimit is a LIMIT no table reaches, and the largest every database
+// here takes
+const noLimit = "9223372036854775807"
+
+// Update is an UPDATE statement under construction
+type Update struct {
+	table Table
+	set   []Cond
+	where []Cond
+}
+
+func UpdateOf(t Table) *Update {
+	return &Update{table: t}
+}
+
+// Set sets col to v
+func (u *Update) Set(col Column, v any) *Update {
+	u.set = append(u.set, Cond{col.name + " = ?", []any{v}})
+	return u
+}
+
+// Where adds a condition; several are combined with AND
+func (u *Update) Where(c Cond) *Update {
+	u.where = append(u.where, c)
+	return u
+}
+
+// Build returns the SQL and the arguments for its placeholders
+func (u *Update) Build(d Dialect) (string, []any) {
+	var b strings.Builder
+	var args []any
+	b.WriteString("UPDATE " + u.table.name + " SET ")
+	for i, c := range u.set {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(c.sql)
+		args = append(args, c.args...)
+	}
+	for i, c := range u.where {
+		if i == 0 {
+			b.WriteString(" WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		b.WriteString(c.sql)
+		args = append(args, c.args...)
+	}
+	return placeholders(b.String(), d), args
+}
+
+// placeholders numbers the ? placeholders for dialects that need it.
+// All SQL text comes from this package and none of it has a literal ?,
+// so every ? is a placeholder.
+func placeholders(query string, d Dialect) string {
+	if d != Dollar {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Stmts prepares each distinct query once per database and reuses the
+// statement after that
+type Stmts struct {
+	DB      *sql.DB
+	Dialect Dialect
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// Query runs s as a prepared statement
+func (p *Stmts) Query(ctx context.Context, s *Select) (*sql.Rows, error) {
+	query, args := s.Build(p.Dialect)
+	stmt, err := p.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (p *Stmts) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if stmt, ok := p.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := p.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if p.stmts == nil {
+		p.stmts = make(map[string]*sql.Stmt)
+	}
+	p.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Close closes every prepared statement
+func (p *Stmts) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var first error
+	for query, stmt := range p.stmts {
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(p.stmts, query)
+	}
+	return first
+}
@@ -0,0 +1,210 @@
+package sqlq
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var injections = []string{
+	`'; DROP TABLE notes; --`,
+	`" OR "1"="1`,
+	`' OR 1=1 --`,
+	`1; DELETE FROM notes`,
+	`\'; SELECT * FROM tokens; --`,
+	`%' OR title LIKE '%`,
+	`$1`,
+	`?`,
+	"\x00",
+	"title = title",
+}
+
+func TestBuild(t *testing.T) {
+	notebook := "work"
+	published := true
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NoteFilter{Notebook: &notebook, Published: &published, Text: "50%_off", UpdatedSince: &since, Limit: 10, Offset: 20}
+
+	query, args := f.Select().Build(Question)
+	want := `SELECT id, title, content, content_compressed, content_encoding, notebook, published, created_at, updated_at FROM notes WHERE notebook = ? AND published = ? AND (title LIKE ? ESCAPE '!' OR content LIKE ? ESCAPE '!' OR content_encoding = ?) AND updated_at > ? ORDER BY updated_at DESC`
+	if query != want {
+		t.Errorf("query =\n%s\nwant\n%s", query, want)
+	}
+	wantArgs := []any{"work", true, `%50!%!_off%`, `%50!%!_off%`, EncodingGzip, since}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %#v, want %#v", args, wantArgs)
+	}
+
+	query, _ = f.Select().Build(Dollar)
+	want = `SELECT id, title, content, content_compressed, content_encoding, notebook, published, created_at, updated_at FROM notes WHERE notebook = $1 AND published = $2 AND (title LIKE $3 ESCAPE '!' OR content LIKE $4 ESCAPE '!' OR content_encoding = $5) AND updated_at > $6 ORDER BY updated_at DESC`
+	if query != want {
+		t.Errorf("query =\n%s\nwant\n%s", query, want)
+	}
+
+	// Without text to match the database cuts the page
+	f.Text = ""
+	if query, _ = f.Select().Build(Question); !strings.HasSuffix(query, " LIMIT ? OFFSET ?") {
+		t.Errorf("query = %s, want it paged", query)
+	}
+	f.Limit = 0
+	if query, _ = f.Select().Build(Question); !strings.HasSuffix(query, " LIMIT "+noLimit+" OFFSET ?") {
+		t.Errorf("query = %s, want a LIMIT before its OFFSET", query)
+	}
+}
+
+// The queries must run as built, with wildcards matching themselves
+func TestSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE notes (id TEXT, title TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"50% off", "500 off", "a_b", "axb", "wow!"} {
+		if _, err := db.Exec(`INSERT INTO notes VALUES (?, ?)`, title, title); err != nil {
+			t.Fatal(err)
+		}
+	}
+	matches := func(s *Select) []string {
+		t.Helper()
+		query, args := s.Build(Question)
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		defer rows.Close()
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	for text, want := range map[string][]string{"0%": {"50% off"}, "_": {"a_b"}, "!": {"wow!"}} {
+		if got := matches(From(Notes).Columns(NoteID).Where(Contains(Title, text))); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q matched %v, want %v", text, got, want)
+		}
+	}
+	if got := matches(From(Notes).Columns(NoteID).OrderBy(NoteID, false).Offset(3)); !reflect.DeepEqual(got, []string{"axb", "wow!"}) {
+		t.Errorf("offset 3 = %v", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	query, args := UpdateOf(Notes).Set(Content, "").Set(ContentEncoding, EncodingGzip).
+		Where(Eq(NoteID, "a")).Where(Eq(ContentEncoding, EncodingPlain)).Build(Dollar)
+	if want := "UPDATE notes SET content = $1, content_encoding = $2 WHERE id = $3 AND content_encoding = $4"; query != want {
+		t.Errorf("query = %s, want %s", query, want)
+	}
+	if want := []any{"", EncodingGzip, "a", EncodingPlain}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+}
+
+func TestIn(t *testing.T) {
+	query, args := From(Notes).Columns(NoteID, Title).Where(In(NoteID, "a", "b")).Build(Dollar)
+	if want := "SELECT id, title FROM notes WHERE id IN ($1, $2)"; query != want {
+		t.Errorf("query = %s, want %s", query, want)
+	}
+	if len(args) != 2 {
+		t.Errorf("args = %v", args)
+	}
+	query, _ = From(Notes).Where(In(NoteID)).Build(Question)
+	if want := "SELECT * FROM notes WHERE 1 = 0"; query != want {
+		t.Errorf("query = %s, want %s", query, want)
+	}
+}
+
+// Every filterable parameter must reach the database as an argument and
+// never as SQL text
+func TestInjection(t *testing.T) {
+	params := map[string]func(string) NoteFilter{
+		"notebook": func(s string) NoteFilter { return NoteFilter{Notebook: &s} },
+		"text":     func(s string) NoteFilter { return NoteFilter{Text: s} },
+	}
+	for name, filter := range params {
+		want, _ := filter("benign").Select().Build(Dollar)
+		for _, payload := range injections {
+			query, args := filter(payload).Select().Build(Dollar)
+			if query != want {
+				t.Errorf("%s=%q changed the query to %s", name, payload, query)
+			}
+			if !containsArg(args, payload) {
+				t.Errorf("%s=%q is missing from args %#v", name, payload, args)
+			}
+		}
+	}
+}
+
+func FuzzNoteFilter(f *testing.F) {
+	for _, payload := range injections {
+		f.Add(payload, payload, 1, 0)
+	}
+	want, _ := benign().Select().Build(Dollar)
+	f.Fuzz(func(t *testing.T, notebook, text string, limit, offset int) {
+		if text == "" || limit <= 0 || offset <= 0 {
+			t.Skip() // these leave out clauses, so the query differs anyway
+		}
+		filter := benign()
+		filter.Notebook = &notebook
+		filter.Text = text
+		filter.Limit = limit
+		filter.Offset = offset
+		query, args := filter.Select().Build(Dollar)
+		if query != want {
+			t.Fatalf("input changed the query to %s", query)
+		}
+		if strings.Count(query, "$") != len(args) {
+			t.Fatalf("%d placeholders for %d args", strings.Count(query, "$"), len(args))
+		}
+	})
+}
+
+func benign() NoteFilter {
+	notebook := "work"
+	published := false
+	since := time.Unix(0, 0)
+	return NoteFilter{Notebook: &notebook, Published: &published, Text: "x", UpdatedSince: &since, Limit: 1, Offset: 1}
+}
+
+// containsArg reports whether s was passed as is, or escaped for LIKE
+func containsArg(args []any, s string) bool {
+	escaped := "%" + likeEscaper.Replace(s) + "%"
+	for _, arg := range args {
+		if arg == s || arg == escaped {
+			return true
+		}
+	}
+	return false
+}
+
+func TestContentEncoding(t *testing.T) {
+	for _, content := range []string{"", "short", strings.Repeat("a long note that compresses well ", 100)} {
+		stored, encoding := EncodeContent(content)
+		if len(stored) > len(content) {
+			t.Errorf("%d bytes of content are stored in %d", len(content), len(stored))
+		}
+		plain, compressed := stored, sql.NullString{}
+		if encoding != EncodingPlain {
+			plain, compressed = "", sql.NullString{String: stored, Valid: true}
+		}
+		if got, err := DecodeContent(plain, compressed, encoding); err != nil || got != content {
+			t.Errorf("decoding %q as %q = %q, %v", stored, encoding, got, err)
+		}
+	}
+	if _, encoding := EncodeContent(strings.Repeat("x", 1000)); encoding != EncodingGzip {
+		t.Errorf("repetitive content encoded as %q", encoding)
+	}
+	if _, err := DecodeContent("x", sql.NullString{}, "zstd"); err == nil {
+		t.Error("decoded an unknown encoding")
+	}
+}
@@ -0,0 +1,105 @@
+// Package stats counts what notes are made of, like their words and
+// hashtags, and when they were written, for dashboards
+package stats
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// WordsPerMinute is the reading speed reading times are estimated at
+const WordsPerMinute = 200
+
+// Counts are the sizes of a text
+type Counts struct {
+	Words      int `json:"words"`
+	Characters int `json:"characters"`
+	// ReadingMinutes is how long the text takes to read, rounded up
+	ReadingMinutes int `json:"reading_minutes"`
+}
+
+// Add returns the sum of c and o, with the reading time of the sum
+func (c Counts) Add(o Counts) Counts {
+	return withReadingTime(Counts{Words: c.Words + o.Words, Characters: c.Characters + o.Characters})
+}
+
+// Text counts the words and characters of s. Characters of scripts
+// written without spaces, like Chinese and Japanese, count as a word
+// each.
+func Text(s string) Counts {
+	var c Counts
+	inWord := false
+	for _, r := range s {
+		c.Characters++
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+		case unspaced(r):
+			c.Words++
+			inWord = false
+		case !inWord:
+			c.Words++
+			inWord = true
+		}
+	}
+	return withReadingTime(c)
+}
+
+func withReadingTime(c Counts) Counts {
+	c.ReadingMinutes = (c.Words + WordsPerMinute - 1) / WordsPerMinute
+	return c
+}
+
+func unspaced(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai)
+}
+
+// hashtag matches #tags that start a line or follow a space. "# Heading"
+// isn't one, nor is "#1" or a URL fragment.
+var hashtag = regexp.MustCompile(`(?:^|\s)#([\p{L}_][\p{L}\p{N}_/-]*)`)
+
+// Tags returns the hashtags in s, lowercased and without the #, each once
+// and sorted
+func Tags(s string) []string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, m := range hashtag.FindAllStringSubmatch(s, -1) {
+		tag := strings.ToLower(strings.TrimRight(m[1], "/-"))
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Day is one day of an activity series
+type Day struct {
+	Date  string `json:"date"` // like 2026-10-15
+	Count int    `json:"count"`
+}
+
+// Activity counts the times per day over the days days up to and
+// including the one now falls on, in loc, oldest first. Days without any
+// are in the series with a count of 0, ready for a heatmap.
+func Activity(times []time.Time, now time.Time, days int, loc *time.Location) []Day {
+	now = now.In(loc)
+	last := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	series := make([]Day, days)
+	index := map[string]int{}
+	for i := range series {
+		date := last.AddDate(0, 0, i-days+1).Format(time.DateOnly)
+		series[i].Date = date
+		index[date] = i
+	}
+	for _, t := range times {
+		if i, ok := index[t.In(loc).Format(time.DateOnly)]; ok {
+			series[i].Count++
+		}
+	}
+	return series
+}
@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestText(t *testing.T) {
+	tests := map[string]Counts{
+		"":                      {},
+		"  ":                    {Characters: 2},
+		"Hello, world!":         {Words: 2, Characters: 13, ReadingMinutes: 1},
+		"one\ntwo\tthree  four": {Words: 4, Characters: 19, ReadingMinutes: 1},
+		"日本語のノート":               {Words: 7, Characters: 7, ReadingMinutes: 1},
+		"Go 言語":                 {Words: 3, Characters: 5, ReadingMinutes: 1},
+		"naïve café — déjà vu":  {Words: 5, Characters: 20, ReadingMinutes: 1},
+	}
+	for s, want := range tests {
+		if got := Text(s); got != want {
+			t.Errorf("Text(%q) = %+v, want %+v", s, got, want)
+		}
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	c := Counts{Words: WordsPerMinute}.Add(Counts{Words: 1})
+	if c.ReadingMinutes != 2 {
+		t.Errorf("%d words take %d minutes, want 2", c.Words, c.ReadingMinutes)
+	}
+}
+
+func TestTags(t *testing.T) {
+	got := Tags("#Work notes\n# Heading\nsee https://x.example/#frag and #1 or #todo, #work/project-\n#todo")
+	if want := []string{"todo", "work", "work/project"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %q, want %q", got, want)
+	}
+}
+
+func TestActivity(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 14, 22, 30, 0, 0, time.UTC), // the 15th in Berlin
+		time.Date(2026, 10, 13, 9, 0, 0, 0, time.UTC),
+		time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC), // too old
+	}
+	want := []Day{{"2026-10-13", 1}, {"2026-10-14", 0}, {"2026-10-15", 2}}
+	if got := Activity(times, now, 3, berlin); !reflect.DeepEqual(got, want) {
+		t.Errorf("Activity() = %+v, want %+v", got, want)
+	}
+}
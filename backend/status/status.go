@@ -0,0 +1,194 @@
+// Package status builds the public status page of an instance: how long
+// it has been up, how its components are doing and the incidents admins
+// posted about it.
+package status
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Statuses of components and of the whole instance, from best to worst
+const (
+	Operational = "operational"
+	Maintenance = "maintenance"
+	Degraded    = "degraded"
+	Outage      = "outage"
+)
+
+// Impacts of incidents
+const (
+	ImpactMinor       = "minor"       // degrades what it affects
+	ImpactMajor       = "major"       // takes it down
+	ImpactMaintenance = "maintenance" // planned work
+)
+
+// ValidImpact reports whether impact is one of the impacts above
+func ValidImpact(impact string) bool {
+	return impact == ImpactMinor || impact == ImpactMajor || impact == ImpactMaintenance
+}
+
+// RecentIncidents is how long resolved incidents stay on the page
+const RecentIncidents = 14 * 24 * time.Hour
+
+// Component is a part of the instance and how it is doing
+type Component struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Health is what the instance knows about itself: since when it runs,
+// the share of API requests that didn't fail over the SLO budget period,
+// if there were any, and its components
+type Health struct {
+	Since        time.Time   `json:"since"`
+	Availability *float64    `json:"availability,omitempty"`
+	Components   []Component `json:"components"`
+}
+
+// Incident is a problem or planned work admins tell users about
+type Incident struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Message    string     `json:"message,omitempty"`
+	Impact     string     `json:"impact"`
+	Components []string   `json:"components,omitempty"` // all of them when empty
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Open reports whether the incident isn't resolved yet
+func (i Incident) Open() bool {
+	return i.ResolvedAt == nil
+}
+
+// affects reports whether the incident is about the named component
+func (i Incident) affects(component string) bool {
+	return len(i.Components) == 0 || slices.Contains(i.Components, component)
+}
+
+// Page is the status page
+type Page struct {
+	Title     string     `json:"title"`
+	Status    string     `json:"status"`
+	Health               // flattened into the page
+	Incidents []Incident `json:"incidents"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// NewPage puts the page together: components take the worst of their
+// health and the open incidents affecting them, and the instance the
+// worst of its components. Incidents resolved longer than
+// RecentIncidents ago are left out, the others are listed newest first.
+func NewPage(title string, health Health, incidents []Incident, now time.Time) Page {
+	p := Page{Title: title, Status: Operational, Health: health, Incidents: []Incident{}, UpdatedAt: now}
+	p.Components = slices.Clone(health.Components)
+	for _, inc := range incidents {
+		if inc.Open() || now.Sub(*inc.ResolvedAt) <= RecentIncidents {
+			p.Incidents = append(p.Incidents, inc)
+		}
+	}
+	slices.SortFunc(p.Incidents, func(a, b Incident) int { return b.StartedAt.Compare(a.StartedAt) })
+
+	for i, c := range p.Components {
+		for _, inc := range p.Incidents {
+			if inc.Open() && inc.affects(c.Name) {
+				p.Components[i].Status = worst(p.Components[i].Status, impactStatus[inc.Impact])
+			}
+		}
+		p.Status = worst(p.Status, p.Components[i].Status)
+	}
+	// Incidents about no component that exists still count
+	for _, inc := range p.Incidents {
+		if inc.Open() {
+			p.Status = worst(p.Status, impactStatus[inc.Impact])
+		}
+	}
+	return p
+}
+
+// impactStatus is the status an open incident puts what it affects in
+var impactStatus = map[string]string{
+	ImpactMinor:       Degraded,
+	ImpactMajor:       Outage,
+	ImpactMaintenance: Maintenance,
+}
+
+var rank = map[string]int{Operational: 0, Maintenance: 1, Degraded: 2, Outage: 3}
+
+func worst(a, b string) string {
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// Render writes the page as HTML. Its inline style carries nonce for the
+// Content-Security-Policy.
+func Render(w io.Writer, p Page, nonce string) error {
+	return page.Execute(w, struct {
+		Page
+		Nonce string
+	}{p, nonce})
+}
+
+var page = template.Must(template.New("status").Funcs(template.FuncMap{
+	"percent": func(f *float64) string { return fmt.Sprintf("%.2f%%", *f*100) },
+	"date":    func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+	"banner":  func(status string) string { return banners[status] },
+	"label":   func(status string) string { return strings.ToUpper(status[:1]) + status[1:] },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>{{.Title}}</title>
+<style nonce="{{.Nonce}}">
+  body { font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; color: #1f2937; max-width: 720px; margin: 0 auto; padding: 24px 16px; }
+  h1 { font-size: 1.5rem; margin: 0 0 16px; }
+  h2 { font-size: 1.1rem; margin: 32px 0 8px; }
+  .banner { padding: 12px 16px; border-radius: 6px; color: #fff; font-weight: 600; }
+  .operational { background: #15803d; } .maintenance { background: #2563eb; }
+  .degraded { background: #ca8a04; } .outage { background: #b91c1c; }
+  ul { list-style: none; padding: 0; margin: 0; }
+  li { display: flex; justify-content: space-between; padding: 8px 0; border-bottom: 1px solid #e5e7eb; }
+  .dot { display: inline-block; width: 10px; height: 10px; border-radius: 50%; margin-right: 6px; }
+  .incident { display: block; }
+  .meta, footer { color: #6b7280; font-size: 0.85rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="banner {{.Status}}">{{banner .Status}}</div>
+<p class="meta">Up since {{date .Since}}{{with .Availability}} · {{percent .}} of requests served over the last 30 days{{end}}</p>
+
+<h2>Components</h2>
+<ul>
+{{range .Components}}  <li><span>{{.Name}}{{with .Detail}} <span class="meta">({{.}})</span>{{end}}</span><span><span class="dot {{.Status}}"></span>{{label .Status}}</span></li>
+{{end}}</ul>
+
+<h2>Incidents</h2>
+{{if .Incidents}}<ul>
+{{range .Incidents}}  <li class="incident"><strong>{{.Title}}</strong>{{if .Open}} <span class="meta">· ongoing</span>{{end}}
+    {{with .Message}}<p>{{.}}</p>{{end}}
+    <p class="meta">{{label .Impact}} · started {{date .StartedAt}}{{with .ResolvedAt}} · resolved {{date .}}{{end}}{{with .Components}} · affects {{range $i, $c := .}}{{if $i}}, {{end}}{{$c}}{{end}}{{end}}</p></li>
+{{end}}</ul>
+{{else}}<p class="meta">No incidents in the last 14 days.</p>
+{{end}}
+<footer>Updated {{date .UpdatedAt}}</footer>
+</body>
+</html>
+`))
+
+var banners = map[string]string{
+	Operational: "All systems operational",
+	Maintenance: "Under maintenance",
+	Degraded:    "Degraded performance",
+	Outage:      "Outage",
+}
@@ -0,0 +1,64 @@
+package status
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPage(t *testing.T) {
+	now := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	longAgo, yesterday := now.Add(-30*24*time.Hour), now.Add(-24*time.Hour)
+	health := Health{Components: []Component{
+		{Name: "http server", Status: Operational},
+		{Name: "search index", Status: Degraded, Detail: "rebuilding"},
+		{Name: "backups", Status: Operational},
+	}}
+	incidents := []Incident{
+		{ID: "old", Impact: ImpactMajor, StartedAt: longAgo.Add(-time.Hour), ResolvedAt: &longAgo},
+		{ID: "fixed", Impact: ImpactMajor, StartedAt: yesterday.Add(-time.Hour), ResolvedAt: &yesterday},
+		{ID: "backups", Impact: ImpactMaintenance, Components: []string{"backups"}, StartedAt: now.Add(-time.Hour)},
+	}
+
+	p := NewPage("Status", health, incidents, now)
+	if p.Status != Degraded {
+		t.Errorf("status = %s, want degraded", p.Status)
+	}
+	if got := p.Components[2].Status; got != Maintenance {
+		t.Errorf("backups = %s, want maintenance", got)
+	}
+	if health.Components[2].Status != Operational {
+		t.Error("NewPage changed the health it was given")
+	}
+	var ids []string
+	for _, inc := range p.Incidents {
+		ids = append(ids, inc.ID)
+	}
+	if strings.Join(ids, ",") != "backups,fixed" {
+		t.Errorf("incidents = %v, want the recent ones newest first", ids)
+	}
+
+	// Open incidents count even without a component of their name
+	incidents = append(incidents, Incident{ID: "dns", Impact: ImpactMajor, Components: []string{"dns"}, StartedAt: now})
+	if p := NewPage("Status", health, incidents, now); p.Status != Outage {
+		t.Errorf("status = %s, want outage", p.Status)
+	}
+}
+
+func TestRender(t *testing.T) {
+	availability := 0.99952
+	p := NewPage("Acme <notes>", Health{
+		Since:        time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC),
+		Availability: &availability,
+		Components:   []Component{{Name: "job workers", Status: Operational}},
+	}, nil, time.Now())
+	var b strings.Builder
+	if err := Render(&b, p, "n0nce"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Acme &lt;notes&gt;", "All systems operational", "99.95%", "2026-05-01 08:00 UTC", `<style nonce="n0nce">`, "No incidents"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("page lacks %q:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package storetest is the conformance suite of note stores. Every
+// backend behind the REST, gRPC and GraphQL APIs, in memory or in a
+// database, must pass it:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) handlers.Repository { return newEmptyStore(t) })
+//	}
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"note/backend/handlers"
+	"note/backend/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Store is the repository under test
+type Store = handlers.Repository
+
+// Run runs the suite, with a new empty store from newStore for each test
+func Run(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Store)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"CreateRequiresTitle", testCreateRequiresTitle},
+		{"NotFound", testNotFound},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"List", testList},
+		{"ListOpenTasks", testListOpenTasks},
+		{"Watch", testWatch},
+		{"WatchCursors", testWatchCursors},
+		{"ConcurrentCreate", testConcurrentCreate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func create(t *testing.T, s Store, note models.Note) models.Note {
+	t.Helper()
+	created, err := s.Create(note)
+	if err != nil {
+		t.Fatalf("Create(%q): %v", note.Title, err)
+	}
+	return created
+}
+
+func testCreateAndGet(t *testing.T, s Store) {
+	created := create(t, s, models.Note{Title: "Groceries", Content: "milk", Notebook: "Home"})
+	if created.ID == "" {
+		t.Fatal("Create returned no ID")
+	}
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Errorf("Create left timestamps unset: %+v", created)
+	}
+	got, err := s.Get(created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Title != "Groceries" || got.Content != "milk" || got.Notebook != "Home" {
+		t.Errorf("Get = %+v, want the created note", got)
+	}
+	other := create(t, s, models.Note{Title: "Groceries"})
+	if other.ID == created.ID {
+		t.Error("two notes got the same ID")
+	}
+}
+
+func testCreateRequiresTitle(t *testing.T, s Store) {
+	if _, err := s.Create(models.Note{Content: "untitled"}); !errors.Is(err, handlers.ErrTitleRequired) {
+		t.Errorf("Create without title: err = %v, want ErrTitleRequired", err)
+	}
+	if list, _ := s.List(false); len(list) != 0 {
+		t.Errorf("a refused note was stored: %+v", list)
+	}
+}
+
+func testNotFound(t *testing.T, s Store) {
+	const missing = "01a13f0a-0000-7000-8000-000000000000"
+	if _, err := s.Get(missing); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Update(missing, models.Note{Title: "x"}); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Update: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(missing); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testUpdate(t *testing.T, s Store) {
+	created := create(t, s, models.Note{Title: "Draft", Content: "v1"})
+	time.Sleep(time.Millisecond)
+	updated, err := s.Update(created.ID, models.Note{Title: "Final", Content: "v2"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.ID != created.ID || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Update changed the ID or creation time: %+v", updated)
+	}
+	if !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("UpdatedAt = %v, want after %v", updated.UpdatedAt, created.UpdatedAt)
+	}
+	got, _ := s.Get(created.ID)
+	if got.Title != "Final" || got.Content != "v2" {
+		t.Errorf("Get after Update = %+v", got)
+	}
+	if _, err := s.Update(created.ID, models.Note{}); !errors.Is(err, handlers.ErrTitleRequired) {
+		t.Errorf("Update without title: err = %v, want ErrTitleRequired", err)
+	}
+}
+
+func testDelete(t *testing.T, s Store) {
+	created := create(t, s, models.Note{Title: "Temporary"})
+	if err := s.Delete(created.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(created.ID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(created.ID); !errors.Is(err, handlers.ErrNotFound) {
+		t.Errorf("second Delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func testList(t *testing.T, s Store) {
+	_, seq0 := s.List(false)
+	a := create(t, s, models.Note{Title: "A"})
+	b := create(t, s, models.Note{Title: "B"})
+	list, seq := s.List(false)
+	if len(list) != 2 {
+		t.Fatalf("List returned %d notes, want 2", len(list))
+	}
+	ids := map[string]bool{list[0].ID: true, list[1].ID: true}
+	if !ids[a.ID] || !ids[b.ID] {
+		t.Errorf("List = %+v, want A and B", list)
+	}
+	if seq < seq0+2 {
+		t.Errorf("sequence went from %d to %d over two writes", seq0, seq)
+	}
+	s.Delete(a.ID)
+	if list, _ := s.List(false); len(list) != 1 || list[0].ID != b.ID {
+		t.Errorf("List after Delete = %+v, want only B", list)
+	}
+}
+
+func testListOpenTasks(t *testing.T, s Store) {
+	open := create(t, s, models.Note{Title: "Open", Items: []models.TodoItem{{Text: "call back"}, {Text: "write", Done: true}}})
+	create(t, s, models.Note{Title: "Done", Items: []models.TodoItem{{Text: "called", Done: true}}})
+	create(t, s, models.Note{Title: "Plain"})
+	list, _ := s.List(true)
+	if len(list) != 1 || list[0].ID != open.ID {
+		t.Errorf("List(openTasks) = %+v, want only the note with an open item", list)
+	}
+}
+
+func testWatch(t *testing.T, s Store) {
+	_, since := s.List(false)
+	created := create(t, s, models.Note{Title: "Watched"})
+	s.Update(created.ID, models.Note{Title: "Watched twice"})
+	s.Delete(created.ID)
+
+	pending, next, err := s.Watch(since)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	var ops []string
+	for i, change := range pending {
+		if change.NoteID != created.ID {
+			t.Errorf("change %d is of note %s, want %s", i, change.NoteID, created.ID)
+		}
+		if i > 0 && change.Seq <= pending[i-1].Seq {
+			t.Errorf("change sequences don't grow: %d after %d", change.Seq, pending[i-1].Seq)
+		}
+		ops = append(ops, change.Op)
+	}
+	if want := fmt.Sprint([]string{models.ChangeCreate, models.ChangeUpdate, models.ChangeDelete}); fmt.Sprint(ops) != want {
+		t.Fatalf("ops = %v, want %v", ops, want)
+	}
+	if pending[0].Note == nil || pending[0].Note.Title != "Watched" || pending[2].Note != nil {
+		t.Errorf("changes should carry the note, except deletes: %+v", pending)
+	}
+
+	select {
+	case <-next:
+		t.Fatal("watch channel closed without a change")
+	default:
+	}
+	create(t, s, models.Note{Title: "Next"})
+	select {
+	case <-next:
+	case <-time.After(time.Second):
+		t.Fatal("watch channel not closed on the next change")
+	}
+}
+
+func testWatchCursors(t *testing.T, s Store) {
+	_, seq := s.List(false)
+	if pending, _, err := s.Watch(seq); err != nil || len(pending) != 0 {
+		t.Errorf("Watch(latest) = %v, %v; want nothing pending", pending, err)
+	}
+	if _, _, err := s.Watch(seq + 1); !errors.Is(err, handlers.ErrInvalidCursor) {
+		t.Errorf("Watch(future): err = %v, want ErrInvalidCursor", err)
+	}
+	if _, _, err := s.Watch(-1); !errors.Is(err, handlers.ErrInvalidCursor) {
+		t.Errorf("Watch(-1): err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func testConcurrentCreate(t *testing.T, s Store) {
+	const workers, perWorker = 8, 25
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				if _, err := s.Create(models.Note{Title: fmt.Sprintf("w%d-%d", w, i)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	list, _ := s.List(false)
+	ids := map[string]bool{}
+	for _, note := range list {
+		ids[note.ID] = true
+	}
+	if len(list) != workers*perWorker || len(ids) != len(list) {
+		t.Errorf("got %d notes with %d distinct IDs, want %d", len(list), len(ids), workers*perWorker)
+	}
+}
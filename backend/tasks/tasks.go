@@ -0,0 +1,111 @@
+// Package tasks finds the Markdown task lines in note content, like
+// "- [ ] call the plumber due:2026-05-04", and checks them off in place.
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotFound means content has no task with the ID, which happens once
+// the task's text was edited
+var ErrNotFound = errors.New("task not found")
+
+// Task is a task line of a note
+type Task struct {
+	// ID names the task by its text, and by how many tasks before it in
+	// the note have the same text. It stays the same while other lines
+	// come and go, and changes with the task's text.
+	ID   string `json:"id"`
+	Line int    `json:"line"` // from 1
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+	// Due is the date written with due:YYYY-MM-DD or 📅 YYYY-MM-DD in
+	// the text, if any
+	Due string `json:"due,omitempty"`
+}
+
+// taskLine matches a list item with a checkbox: its indent and bullet,
+// the box and the text
+var taskLine = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+\[)([ xX])(\]\s+)(.*?)\s*$`)
+
+// dueDate matches the due date in the text of a task
+var dueDate = regexp.MustCompile(`(?:\bdue:|📅\s*)(\d{4}-\d{2}-\d{2})\b`)
+
+// Parse returns the tasks in content, in order. Lines in fenced code
+// blocks aren't tasks.
+func Parse(content string) []Task {
+	var list []Task
+	seen := map[string]int{}
+	fence := ""
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if marker := fenceMarker(trimmed); marker != "" && (fence == "" || strings.HasPrefix(trimmed, fence)) {
+			if fence == "" {
+				fence = marker
+			} else {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		m := taskLine.FindStringSubmatch(line)
+		if m == nil || m[4] == "" {
+			continue
+		}
+		text := m[4]
+		seen[text]++
+		t := Task{ID: taskID(text, seen[text]), Line: i + 1, Text: text, Done: m[2] != " "}
+		if due := dueDate.FindStringSubmatch(text); due != nil {
+			if _, err := time.Parse(time.DateOnly, due[1]); err == nil {
+				t.Due = due[1]
+			}
+		}
+		list = append(list, t)
+	}
+	return list
+}
+
+// SetDone checks the task with the given ID off, or back on, and returns
+// content with it and the task as it is now
+func SetDone(content, id string, done bool) (string, Task, error) {
+	for _, t := range Parse(content) {
+		if t.ID != id {
+			continue
+		}
+		lines := strings.Split(content, "\n")
+		box := " "
+		if done {
+			box = "x"
+		}
+		m := taskLine.FindStringSubmatchIndex(lines[t.Line-1])
+		line := lines[t.Line-1]
+		lines[t.Line-1] = line[:m[4]] + box + line[m[5]:]
+		t.Done = done
+		return strings.Join(lines, "\n"), t, nil
+	}
+	return content, Task{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// fenceMarker returns the ``` or ~~~ a line opens or closes a fenced code
+// block with, or ""
+func fenceMarker(line string) string {
+	for _, marker := range []string{"```", "~~~"} {
+		if strings.HasPrefix(line, marker) {
+			return marker
+		}
+	}
+	return ""
+}
+
+func taskID(text string, nth int) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:4]), nth)
+}
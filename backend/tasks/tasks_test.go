@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"errors"
+	"testing"
+)
+
+const content = "# Chores\n" +
+	"- [ ] call the plumber due:2026-05-04\n" +
+	"  * [x] buy milk\n" +
+	"1. [ ] water plants 📅 2026-05-01\n" +
+	"```\n" +
+	"- [ ] not a task, just code\n" +
+	"```\n" +
+	"- [ ] buy milk\n" +
+	"- [ ]\n" +
+	"- [] neither\n" +
+	"- [ ] due:2026-02-30 is no date"
+
+func TestParse(t *testing.T) {
+	list := Parse(content)
+	want := []Task{
+		{Line: 2, Text: "call the plumber due:2026-05-04", Due: "2026-05-04"},
+		{Line: 3, Text: "buy milk", Done: true},
+		{Line: 4, Text: "water plants 📅 2026-05-01", Due: "2026-05-01"},
+		{Line: 8, Text: "buy milk"},
+		{Line: 11, Text: "due:2026-02-30 is no date"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("Parse() = %+v, want %d tasks", list, len(want))
+	}
+	for i, task := range list {
+		w := want[i]
+		if task.Line != w.Line || task.Text != w.Text || task.Done != w.Done || task.Due != w.Due {
+			t.Errorf("task %d = %+v, want %+v", i, task, w)
+		}
+	}
+	if list[1].ID == list[3].ID {
+		t.Error("tasks with the same text share an ID")
+	}
+
+	// Other lines coming and going leave IDs alone
+	moved := Parse("intro\n\n" + content)
+	if moved[0].ID != list[0].ID || moved[0].Line != 4 {
+		t.Errorf("after adding lines = %+v, want %+v two lines down", moved[0], list[0])
+	}
+}
+
+func TestSetDone(t *testing.T) {
+	list := Parse(content)
+	updated, task, err := SetDone(content, list[3].ID, true)
+	if err != nil || !task.Done || task.Line != 8 {
+		t.Fatalf("SetDone() = %+v, %v", task, err)
+	}
+	if want := content[:len(content)-len("- [ ] buy milk\n- [ ]\n- [] neither\n- [ ] due:2026-02-30 is no date")] +
+		"- [x] buy milk\n- [ ]\n- [] neither\n- [ ] due:2026-02-30 is no date"; updated != want {
+		t.Errorf("content after checking off =\n%s", updated)
+	}
+	updated, task, _ = SetDone(updated, list[1].ID, false)
+	if task.Done || Parse(updated)[1].Done {
+		t.Error("task wasn't checked back on")
+	}
+	if _, _, err := SetDone(content, "00000000-1", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetDone() of a missing task = %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package templates defines template packs, the JSON bundles templates
+// are shared in between Notty servers
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"note/backend/models"
+	"time"
+)
+
+// Format and Version identify a template pack. Version goes up only when
+// older servers could no longer read a pack correctly; new optional
+// fields don't change it.
+const (
+	Format  = "notty-template-pack"
+	Version = 1
+)
+
+// Limits on what a pack may hold
+const (
+	MaxTemplates = 200
+	MaxSize      = 4 << 20 // bytes of JSON
+	maxContent   = 1 << 20 // bytes of one template's content
+	maxItems     = 500
+)
+
+// Pack is a collection of templates with metadata about who made it
+type Pack struct {
+	Format      string     `json:"format"`
+	Version     int        `json:"version"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Homepage    string     `json:"homepage,omitempty"`
+	License     string     `json:"license,omitempty"`
+	ExportedAt  time.Time  `json:"exported_at"`
+	Templates   []Template `json:"templates"`
+}
+
+// Template is a template as it travels in a pack, without anything that
+// only means something on the server it came from
+type Template struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Title       string   `json:"title"`
+	Content     string   `json:"content"`
+	Notebook    string   `json:"notebook,omitempty"`
+	Items       []string `json:"items,omitempty"` // checklist entries, all open
+}
+
+// New returns a pack of the given templates
+func New(name string, list []models.Template) Pack {
+	pack := Pack{Format: Format, Version: Version, Name: name, ExportedAt: time.Now(), Templates: []Template{}}
+	for _, t := range list {
+		pt := Template{Name: t.Name, Description: t.Description, Title: t.Title, Content: t.Content, Notebook: t.Notebook}
+		for _, item := range t.Items {
+			pt.Items = append(pt.Items, item.Text)
+		}
+		pack.Templates = append(pack.Templates, pt)
+	}
+	return pack
+}
+
+// Decode reads and validates a pack
+func Decode(r io.Reader) (Pack, error) {
+	var pack Pack
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return pack, err
+	}
+	if len(data) > MaxSize {
+		return pack, fmt.Errorf("pack is larger than %d bytes", MaxSize)
+	}
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return pack, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return pack, pack.Validate()
+}
+
+// Validate checks that the pack is one this server can import
+func (p Pack) Validate() error {
+	if p.Format != Format {
+		return fmt.Errorf("format must be %q", Format)
+	}
+	if p.Version < 1 || p.Version > Version {
+		return fmt.Errorf("unsupported version %d", p.Version)
+	}
+	if p.Name == "" {
+		return errors.New("pack name is required")
+	}
+	if len(p.Templates) == 0 || len(p.Templates) > MaxTemplates {
+		return fmt.Errorf("a pack holds 1 to %d templates", MaxTemplates)
+	}
+	names := map[string]bool{}
+	for i, t := range p.Templates {
+		switch {
+		case t.Name == "":
+			return fmt.Errorf("template %d: name is required", i)
+		case names[t.Name]:
+			return fmt.Errorf("template %d: duplicate name %q", i, t.Name)
+		case len(t.Content) > maxContent:
+			return fmt.Errorf("template %q: content is too large", t.Name)
+		case len(t.Items) > maxItems:
+			return fmt.Errorf("template %q: too many items", t.Name)
+		}
+		names[t.Name] = true
+	}
+	return nil
+}
+
+// Model turns a template of the pack into one to store
+func (t Template) Model(pack string) models.Template {
+	m := models.Template{
+		Name:        t.Name,
+		Description: t.Description,
+		Title:       t.Title,
+		Content:     t.Content,
+		Notebook:    t.Notebook,
+		Pack:        pack,
+	}
+	for i, text := range t.Items {
+		m.Items = append(m.Items, models.TodoItem{Text: text, Position: i})
+	}
+	return m
+}
@@ -0,0 +1,91 @@
+package textdiff
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict markers around the two sides of a conflicting change, with
+// the base text between them
+const (
+	MarkerYours  = "<<<<<<< yours"
+	MarkerBase   = "||||||| base"
+	MarkerSplit  = "======="
+	MarkerTheirs = ">>>>>>> theirs"
+)
+
+// Merge3 merges the changes yours and theirs made to base, line by line.
+// Where both changed the same lines differently, the result has both
+// sides between conflict markers, with the base lines between them, and
+// the number of such conflicts is returned.
+func Merge3(base, yours, theirs string) (string, int) {
+	switch {
+	case yours == theirs || theirs == base:
+		return yours, 0
+	case yours == base:
+		return theirs, 0
+	}
+	b, y, t := strings.Split(base, "\n"), strings.Split(yours, "\n"), strings.Split(theirs, "\n")
+	inYours, inTheirs := kept(b, y), kept(b, t)
+
+	var out []string
+	conflicts := 0
+	i, j, k := 0, 0, 0 // next line of base, yours and theirs
+	for {
+		// Lines both kept where they were
+		for i < len(b) && inYours[i] == j && inTheirs[i] == k {
+			out = append(out, b[i])
+			i, j, k = i+1, j+1, k+1
+		}
+		if i == len(b) && j == len(y) && k == len(t) {
+			break
+		}
+		// The changed chunk runs up to the next base line both kept
+		end := i
+		for end < len(b) && (inYours[end] < 0 || inTheirs[end] < 0) {
+			end++
+		}
+		yEnd, tEnd := len(y), len(t)
+		if end < len(b) {
+			yEnd, tEnd = inYours[end], inTheirs[end]
+		}
+		bc, yc, tc := b[i:end], y[j:yEnd], t[k:tEnd]
+		switch {
+		case slices.Equal(yc, bc) || slices.Equal(yc, tc):
+			out = append(out, tc...)
+		case slices.Equal(tc, bc):
+			out = append(out, yc...)
+		default:
+			conflicts++
+			out = append(out, MarkerYours)
+			out = append(out, yc...)
+			out = append(out, MarkerBase)
+			out = append(out, bc...)
+			out = append(out, MarkerSplit)
+			out = append(out, tc...)
+			out = append(out, MarkerTheirs)
+		}
+		i, j, k = end, yEnd, tEnd
+	}
+	return strings.Join(out, "\n"), conflicts
+}
+
+// kept returns for each line of base the line of other it was kept as,
+// or -1 where other dropped or changed it
+func kept(base, other []string) []int {
+	at := make([]int, len(base))
+	i, j := 0, 0
+	for _, o := range diff(base, other) {
+		switch o.kind {
+		case ' ':
+			at[i] = j
+			i, j = i+1, j+1
+		case '-':
+			at[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+	return at
+}
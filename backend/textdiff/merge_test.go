@@ -0,0 +1,27 @@
+package textdiff
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	base := "title\none\ntwo\nthree\nfour"
+	for _, tc := range []struct {
+		name, yours, theirs, want string
+		conflicts                 int
+	}{
+		{"only yours", "title\none\n2\nthree\nfour", base, "title\none\n2\nthree\nfour", 0},
+		{"only theirs", base, "title\none\ntwo\nthree\n4", "title\none\ntwo\nthree\n4", 0},
+		{"apart", "title\n1\ntwo\nthree\nfour", "title\none\ntwo\nthree\nfour\nfive", "title\n1\ntwo\nthree\nfour\nfive", 0},
+		{"same change", "title\none\n2\nthree\nfour", "title\none\n2\nthree\nfour", "title\none\n2\nthree\nfour", 0},
+		{"same line", "title\none\nTWO\nthree\nfour", "title\none\n2\nthree\nfour",
+			"title\none\n<<<<<<< yours\nTWO\n||||||| base\ntwo\n=======\n2\n>>>>>>> theirs\nthree\nfour", 1},
+		{"both appended", base + "\nyes", base + "\nno",
+			base + "\n<<<<<<< yours\nyes\n||||||| base\n=======\nno\n>>>>>>> theirs", 1},
+		{"deleted and changed", "title\none\nthree\nfour", "title\none\n2\nthree\nfour",
+			"title\none\n<<<<<<< yours\n||||||| base\ntwo\n=======\n2\n>>>>>>> theirs\nthree\nfour", 1},
+	} {
+		got, conflicts := Merge3(base, tc.yours, tc.theirs)
+		if got != tc.want || conflicts != tc.conflicts {
+			t.Errorf("%s: Merge3 = %q with %d conflicts, want %q with %d", tc.name, got, conflicts, tc.want, tc.conflicts)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package textdiff renders line diffs for previews of note edits
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCells bounds the memory of the line-by-line comparison. Texts with
+// more line pairs are shown as a single hunk replacing everything.
+const maxCells = 4_000_000
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified returns the differences between a and b in unified diff format,
+// without file headers, with context unchanged lines around each change.
+// It returns "" when a and b are equal.
+func Unified(a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	ops := diff(strings.Split(a, "\n"), strings.Split(b, "\n"))
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		from := max(first-context, start)
+		to := first
+		for to < len(ops) {
+			if ops[to].kind != ' ' {
+				to++
+				continue
+			}
+			// Stop once the unchanged run is too long to join the next change
+			run := to
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-to > 2*context {
+				to = min(to+context, len(ops))
+				break
+			}
+			to = run
+		}
+		writeHunk(&out, ops, from, to)
+		start = to
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op, from, to int) {
+	// Line numbers are 1-based positions in a and b
+	aLine, bLine := 1, 1
+	for _, o := range ops[:from] {
+		if o.kind != '+' {
+			aLine++
+		}
+		if o.kind != '-' {
+			bLine++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, o := range ops[from:to] {
+		if o.kind != '+' {
+			aCount++
+		}
+		if o.kind != '-' {
+			bCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+	for _, o := range ops[from:to] {
+		out.WriteByte(o.kind)
+		out.WriteString(o.line)
+		out.WriteByte('\n')
+	}
+}
+
+// diff compares lines by their longest common subsequence
+func diff(a, b []string) []op {
+	// Common prefix and suffix don't need the table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var ops []op
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{' ', line})
+	}
+	ops = append(ops, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{' ', line})
+	}
+	return ops
+}
+
+func middle(a, b []string) []op {
+	var ops []op
+	if (len(a)+1)*(len(b)+1) > maxCells {
+		for _, line := range a {
+			ops = append(ops, op{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, op{'+', line})
+		}
+		return ops
+	}
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for webhook URLs that point into the
+// network the server runs in, which a webhook could otherwise probe
+var ErrPrivateAddress = errors.New("url must not point to a loopback, private or link-local address")
+
+// sharedAddressSpace is carrier-grade NAT, private in all but name
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// public reports whether an address is reachable on the internet
+func public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// checkHost rejects hosts that are private by their name or address.
+// Names are checked again for every connection, once they resolve.
+func checkHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !public(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// guardedClient is an HTTP client that only connects to public
+// addresses, whatever a name resolves to by then or a redirect points at
+func guardedClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil || !public(addr.Addr()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would connect on our behalf, unchecked
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
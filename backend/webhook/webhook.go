@@ -0,0 +1,355 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"note/backend/jobs"
+	"note/backend/notify"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery. The signature is an HMAC-SHA256 over
+// "<timestamp>.<body>" with the webhook's secret, so receivers can check
+// both who sent the payload and that it isn't an old one replayed.
+const (
+	HeaderSignature = "X-Notty-Signature"
+	HeaderTimestamp = "X-Notty-Timestamp"
+	HeaderDelivery  = "X-Notty-Delivery"
+)
+
+// Events a webhook can subscribe to
+var Events = []notify.EventType{notify.NoteCreated, notify.NoteUpdated, notify.NoteDeleted}
+
+// Webhook is a registered receiver
+type Webhook struct {
+	ID        string             `json:"id"`
+	URL       string             `json:"url"`
+	Events    []notify.EventType `json:"events"`
+	Workspace string             `json:"workspace,omitempty"` // whose note events it gets
+	Secret    string             `json:"secret,omitempty"`    // only shown on creation
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// Delivery is one attempt to deliver an event
+type Delivery struct {
+	ID         string           `json:"id"` // shared by all attempts of a delivery
+	WebhookID  string           `json:"webhook_id"`
+	Event      notify.EventType `json:"event"`
+	NoteID     string           `json:"note_id"`
+	Attempt    int              `json:"attempt"`
+	StatusCode int              `json:"status_code,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Success    bool             `json:"success"`
+	Duration   time.Duration    `json:"duration_ns"`
+	At         time.Time        `json:"at"`
+}
+
+// Payload is the JSON body receivers get
+type Payload struct {
+	ID    string       `json:"id"`
+	Event notify.Event `json:"event"`
+}
+
+// ErrNotFound is returned for unknown webhook IDs
+var ErrNotFound = errors.New("webhook not found")
+
+// JobKind is the kind of job a delivery runs as when the manager has a
+// job queue
+const JobKind = "webhook.delivery"
+
+// Enqueuer queues background jobs, like a *jobs.Queue
+type Enqueuer interface {
+	Enqueue(kind, owner string, payload any) (jobs.Job, error)
+}
+
+// deliveryJob is the payload of a delivery job
+type deliveryJob struct {
+	WebhookID  string       `json:"webhook_id"`
+	DeliveryID string       `json:"delivery_id"`
+	Event      notify.Event `json:"event"`
+}
+
+// Manager keeps the registered webhooks and delivers events to them. It
+// is a notify.Notifier for the subscriptions channel.
+type Manager struct {
+	// MaxAttempts and Backoff control retries: attempt n waits
+	// Backoff * 2^(n-2) before it is made.
+	MaxAttempts int
+	Backoff     time.Duration
+	Client      *http.Client // NewManager's only connects to public addresses
+	// Jobs runs deliveries as JobKind jobs when set, so they are retried
+	// by the job workers instead of a goroutine each. The kind must be
+	// handled by DeliverJob.
+	Jobs Enqueuer
+	// Admit, when set, decides whether an event is delivered to one more
+	// webhook, like under a quota. Refused deliveries are logged failed.
+	Admit func(e notify.Event) bool
+
+	mu         sync.Mutex
+	hooks      map[string]*Webhook
+	deliveries map[string][]Delivery // by webhook, newest last
+}
+
+// logSize is how many delivery attempts are kept per webhook
+const logSize = 100
+
+func NewManager() *Manager {
+	return &Manager{
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		Client:      guardedClient(10 * time.Second),
+		hooks:       make(map[string]*Webhook),
+		deliveries:  make(map[string][]Delivery),
+	}
+}
+
+// Register adds a webhook for the events of a workspace and returns it
+// with its signing secret. URLs of loopback, private and link-local
+// addresses are refused with ErrPrivateAddress.
+func (m *Manager) Register(rawURL string, events []notify.EventType, workspace string) (Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if err := checkHost(u.Hostname()); err != nil {
+		return Webhook{}, err
+	}
+	if len(events) == 0 {
+		events = Events
+	}
+	for _, e := range events {
+		if !subscribable(e) {
+			return Webhook{}, fmt.Errorf("unknown event %q", e)
+		}
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	hook := &Webhook{
+		ID:        uuid.NewString(),
+		URL:       u.String(),
+		Events:    events,
+		Workspace: workspace,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks[hook.ID] = hook
+	return *hook, nil
+}
+
+// List returns the webhooks of a workspace without their secrets, oldest
+// first
+func (m *Manager) List(workspace string) []Webhook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Webhook, 0, len(m.hooks))
+	for _, hook := range m.hooks {
+		if hook.Workspace != workspace {
+			continue
+		}
+		h := *hook
+		h.Secret = ""
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Delete removes a webhook of a workspace and its delivery log
+func (m *Manager) Delete(id, workspace string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hook, ok := m.hooks[id]; !ok || hook.Workspace != workspace {
+		return ErrNotFound
+	}
+	delete(m.hooks, id)
+	delete(m.deliveries, id)
+	return nil
+}
+
+// Deliveries returns the delivery log of a webhook of a workspace, newest
+// first
+func (m *Manager) Deliveries(id, workspace string) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hook, ok := m.hooks[id]; !ok || hook.Workspace != workspace {
+		return nil, ErrNotFound
+	}
+	log := m.deliveries[id]
+	list := make([]Delivery, len(log))
+	for i, d := range log {
+		list[len(log)-1-i] = d
+	}
+	return list, nil
+}
+
+// Notify delivers an event to every webhook of its workspace subscribed
+// to it. Deliveries run in the background and are retried with
+// exponential backoff.
+func (m *Manager) Notify(e notify.Event) error {
+	m.mu.Lock()
+	var targets []Webhook
+	for _, hook := range m.hooks {
+		if hook.Workspace == e.Workspace && hook.wants(e.Type) {
+			targets = append(targets, *hook)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, hook := range targets {
+		if m.Admit != nil && !m.Admit(e) {
+			m.log(Delivery{ID: uuid.NewString(), WebhookID: hook.ID, Event: e.Type, NoteID: e.NoteID, Error: "quota exceeded", At: time.Now()})
+			continue
+		}
+		if m.Jobs != nil {
+			payload := deliveryJob{WebhookID: hook.ID, DeliveryID: uuid.NewString(), Event: e}
+			if _, err := m.Jobs.Enqueue(JobKind, "", payload); err == nil {
+				continue
+			}
+		}
+		go m.deliver(hook, e)
+	}
+	return nil
+}
+
+// DeliverJob makes one attempt of a delivery job. Failures that retrying
+// could fix are returned for the queue to retry.
+func (m *Manager) DeliverJob(ctx context.Context, job jobs.Job) (jobs.Outcome, error) {
+	var dj deliveryJob
+	if err := json.Unmarshal(job.Payload, &dj); err != nil {
+		return jobs.Outcome{}, jobs.Permanent(err)
+	}
+	m.mu.Lock()
+	hook, ok := m.hooks[dj.WebhookID]
+	var target Webhook
+	if ok {
+		target = *hook
+	}
+	m.mu.Unlock()
+	if !ok {
+		return jobs.Outcome{}, jobs.Permanent(ErrNotFound)
+	}
+
+	body, err := json.Marshal(Payload{ID: dj.DeliveryID, Event: dj.Event})
+	if err != nil {
+		return jobs.Outcome{}, jobs.Permanent(err)
+	}
+	d := m.attempt(target, dj.DeliveryID, body)
+	d.Event, d.NoteID, d.Attempt = dj.Event.Type, dj.Event.NoteID, job.Attempts
+	m.log(d)
+	switch {
+	case d.Success:
+		return jobs.Outcome{Result: d}, nil
+	case d.StatusCode >= 400 && d.StatusCode < 500 && d.StatusCode != http.StatusTooManyRequests:
+		return jobs.Outcome{}, jobs.Permanent(fmt.Errorf("webhook answered %d", d.StatusCode))
+	case d.StatusCode != 0:
+		return jobs.Outcome{}, fmt.Errorf("webhook answered %d", d.StatusCode)
+	}
+	return jobs.Outcome{}, errors.New(d.Error)
+}
+
+func (m *Manager) deliver(hook Webhook, e notify.Event) {
+	payload := Payload{ID: uuid.NewString(), Event: e}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	for attempt := 1; attempt <= m.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(m.Backoff << (attempt - 2))
+		}
+		d := m.attempt(hook, payload.ID, body)
+		d.Event, d.NoteID, d.Attempt = e.Type, e.NoteID, attempt
+		m.log(d)
+		if d.Success {
+			return
+		}
+		// Client errors other than rate limiting won't get better by retrying
+		if d.StatusCode >= 400 && d.StatusCode < 500 && d.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+	}
+}
+
+func (m *Manager) attempt(hook Webhook, deliveryID string, body []byte) Delivery {
+	d := Delivery{ID: deliveryID, WebhookID: hook.ID, At: time.Now()}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	timestamp := strconv.FormatInt(d.At.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Notty-Webhooks/1")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(hook.Secret, timestamp, body))
+
+	res, err := m.Client.Do(req)
+	d.Duration = time.Since(d.At)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	res.Body.Close()
+	d.StatusCode = res.StatusCode
+	d.Success = res.StatusCode >= 200 && res.StatusCode < 300
+	return d
+}
+
+func (m *Manager) log(d Delivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.hooks[d.WebhookID]; !ok {
+		return // deleted while delivering
+	}
+	entries := append(m.deliveries[d.WebhookID], d)
+	if len(entries) > logSize {
+		entries = entries[len(entries)-logSize:]
+	}
+	m.deliveries[d.WebhookID] = entries
+}
+
+// Sign computes the signature receivers should compare against
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Webhook) wants(t notify.EventType) bool {
+	for _, e := range h.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribable(t notify.EventType) bool {
+	for _, e := range Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterRefusesPrivateAddresses(t *testing.T) {
+	m := NewManager()
+	for _, u := range []string{
+		"http://localhost/hook",
+		"http://api.localhost./hook",
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://172.16.0.1/hook",
+		"http://100.64.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1]/hook",
+		"http://0.0.0.0/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if _, err := m.Register(u, nil, ""); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("Register(%s) = %v, want ErrPrivateAddress", u, err)
+		}
+	}
+	if _, err := m.Register("https://93.184.215.14/hook", nil, ""); err != nil {
+		t.Errorf("Register of a public address: %v", err)
+	}
+}
+
+func TestDeliveriesOnlyConnectToPublicAddresses(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	defer receiver.Close()
+
+	// A public name can still resolve to a private address, or redirect
+	// to one, by the time it is delivered to
+	m := NewManager()
+	d := m.attempt(Webhook{ID: "hook", URL: receiver.URL}, "delivery", []byte("{}"))
+	if d.Success || called {
+		t.Errorf("delivered to %s", receiver.URL)
+	}
+}
@@ -0,0 +1,335 @@
+// Package workspace lets teams share one instance in isolated spaces.
+// Every note belongs to a workspace; the default one, with the empty ID,
+// is the instance itself and open to everyone, as before there were
+// workspaces. Other workspaces are only open to their members, who are
+// API keys, each with a role in it. New members join by invitation.
+package workspace
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default is the ID of the default workspace
+const Default = ""
+
+// Role is what a member may do in a workspace
+type Role string
+
+// Roles from least to most privileged. Viewers may read, editors also
+// write notes, admins also manage members and invitations, and owners
+// also delete the workspace.
+const (
+	Viewer Role = "viewer"
+	Editor Role = "editor"
+	Admin  Role = "admin"
+	Owner  Role = "owner"
+)
+
+var roleRank = map[Role]int{Viewer: 1, Editor: 2, Admin: 3, Owner: 4}
+
+// Valid reports whether r is one of the roles
+func (r Role) Valid() bool {
+	return roleRank[r] > 0
+}
+
+// Grants reports whether r allows at least what other allows
+func (r Role) Grants(other Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[other]
+}
+
+var (
+	ErrNotFound       = errors.New("workspace not found")
+	ErrNameRequired   = errors.New("workspace name is required")
+	ErrBadRole        = errors.New("role must be viewer, editor, admin or owner")
+	ErrNotMember      = errors.New("not a member of the workspace")
+	ErrLastOwner      = errors.New("a workspace needs an owner")
+	ErrBadInvitation  = errors.New("invitation is invalid or expired")
+	ErrInviteNotFound = errors.New("invitation not found")
+)
+
+// Workspace is a space of notes shared by its members
+type Workspace struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Members   map[string]Role `json:"members"` // by API key ID
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Invitation lets whoever has its code join a workspace with a role. The
+// code is only known when the invitation is created; the store keeps its
+// hash.
+type Invitation struct {
+	ID        string    `json:"id"`
+	Workspace string    `json:"workspace"`
+	Role      Role      `json:"role"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	hash      string
+}
+
+// Store keeps the workspaces and open invitations in memory
+type Store struct {
+	mu          sync.Mutex
+	workspaces  map[string]*Workspace
+	invitations map[string]*Invitation // by ID
+}
+
+func NewStore() *Store {
+	return &Store{workspaces: map[string]*Workspace{}, invitations: map[string]*Invitation{}}
+}
+
+// Create adds a workspace owned by owner
+func (s *Store) Create(name, owner string) (Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Workspace{}, ErrNameRequired
+	}
+	ws := &Workspace{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Members:   map[string]Role{owner: Owner},
+		CreatedAt: time.Now(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workspaces[ws.ID] = ws
+	return ws.copy(), nil
+}
+
+// Get returns a workspace by ID
+func (s *Store) Get(id string) (Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	return ws.copy(), nil
+}
+
+// List returns the workspaces user is a member of, or every workspace
+// when user is empty, oldest first
+func (s *Store) List(user string) []Workspace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Workspace{}
+	for _, ws := range s.workspaces {
+		if _, ok := ws.Members[user]; ok || user == "" {
+			list = append(list, ws.copy())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Rename changes the name of a workspace
+func (s *Store) Rename(id, name string) (Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Workspace{}, ErrNameRequired
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	ws.Name = name
+	return ws.copy(), nil
+}
+
+// Delete removes a workspace and its invitations
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workspaces[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.workspaces, id)
+	for invID, inv := range s.invitations {
+		if inv.Workspace == id {
+			delete(s.invitations, invID)
+		}
+	}
+	return nil
+}
+
+// Role returns the role of user in a workspace. Everyone is an editor of
+// the default workspace.
+func (s *Store) Role(id, user string) (Role, bool) {
+	if id == Default {
+		return Editor, true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return "", false
+	}
+	role, ok := ws.Members[user]
+	return role, ok
+}
+
+// SetRole adds user to a workspace or changes their role. The last owner
+// can't give up ownership.
+func (s *Store) SetRole(id, user string, role Role) (Workspace, error) {
+	if !role.Valid() {
+		return Workspace{}, ErrBadRole
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	if ws.Members[user] == Owner && role != Owner && ws.owners() == 1 {
+		return Workspace{}, ErrLastOwner
+	}
+	ws.Members[user] = role
+	return ws.copy(), nil
+}
+
+// RemoveMember takes user out of a workspace
+func (s *Store) RemoveMember(id, user string) (Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return Workspace{}, ErrNotFound
+	}
+	role, ok := ws.Members[user]
+	if !ok {
+		return Workspace{}, ErrNotMember
+	}
+	if role == Owner && ws.owners() == 1 {
+		return Workspace{}, ErrLastOwner
+	}
+	delete(ws.Members, user)
+	return ws.copy(), nil
+}
+
+// Invite creates an invitation to a workspace that expires after ttl and
+// returns it with its code
+func (s *Store) Invite(id string, role Role, by string, ttl time.Duration) (Invitation, string, error) {
+	if !role.Valid() {
+		return Invitation{}, "", ErrBadRole
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return Invitation{}, "", err
+	}
+	code := hex.EncodeToString(secret)
+	now := time.Now()
+	inv := &Invitation{
+		ID:        uuid.NewString(),
+		Workspace: id,
+		Role:      role,
+		CreatedBy: by,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		hash:      hash(code),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workspaces[id]; !ok {
+		return Invitation{}, "", ErrNotFound
+	}
+	s.prune(now)
+	s.invitations[inv.ID] = inv
+	return *inv, code, nil
+}
+
+// Invitations returns the open invitations to a workspace, oldest first
+func (s *Store) Invitations(id string) []Invitation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	list := []Invitation{}
+	for _, inv := range s.invitations {
+		if inv.Workspace == id {
+			list = append(list, *inv)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Revoke withdraws an invitation to a workspace
+func (s *Store) Revoke(id, invitationID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invitations[invitationID]
+	if !ok || inv.Workspace != id {
+		return ErrInviteNotFound
+	}
+	delete(s.invitations, invitationID)
+	return nil
+}
+
+// Accept makes user a member of the workspace an invitation code is for,
+// with its role. Invitations can be used once; members keep a higher
+// role they already have.
+func (s *Store) Accept(code, user string) (Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	h := hash(code)
+	for id, inv := range s.invitations {
+		if inv.hash != h {
+			continue
+		}
+		delete(s.invitations, id)
+		ws, ok := s.workspaces[inv.Workspace]
+		if !ok {
+			return Workspace{}, ErrBadInvitation
+		}
+		if !ws.Members[user].Grants(inv.Role) {
+			ws.Members[user] = inv.Role
+		}
+		return ws.copy(), nil
+	}
+	return Workspace{}, ErrBadInvitation
+}
+
+// prune drops expired invitations. Callers must hold mu.
+func (s *Store) prune(now time.Time) {
+	for id, inv := range s.invitations {
+		if now.After(inv.ExpiresAt) {
+			delete(s.invitations, id)
+		}
+	}
+}
+
+func (ws *Workspace) owners() int {
+	n := 0
+	for _, role := range ws.Members {
+		if role == Owner {
+			n++
+		}
+	}
+	return n
+}
+
+func (ws *Workspace) copy() Workspace {
+	c := *ws
+	c.Members = make(map[string]Role, len(ws.Members))
+	for user, role := range ws.Members {
+		c.Members[user] = role
+	}
+	return c
+}
+
+func hash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
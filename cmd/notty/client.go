@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"note/backend/models"
+	"strings"
+	"time"
+)
+
+// client talks to the Notty REST API
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newClient(server, token string) *client {
+	return &client{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *client) listNotes() ([]models.Note, error) {
+	var notes []models.Note
+	err := c.do(http.MethodGet, "/api/notes", nil, &notes)
+	return notes, err
+}
+
+// searchResult is the response of GET /api/search
+type searchResult struct {
+	Results  []models.Note `json:"results"`
+	Total    int           `json:"total"`
+	Degraded bool          `json:"degraded"`
+}
+
+func (c *client) search(query string) (searchResult, error) {
+	var result searchResult
+	err := c.do(http.MethodGet, "/api/search?limit=200&q="+url.QueryEscape(query), nil, &result)
+	return result, err
+}
+
+func (c *client) getNote(id string) (models.Note, error) {
+	var note models.Note
+	err := c.do(http.MethodGet, "/api/notes/"+url.PathEscape(id), nil, &note)
+	return note, err
+}
+
+func (c *client) createNote(note models.Note) (models.Note, error) {
+	var created models.Note
+	err := c.do(http.MethodPost, "/api/notes", note, &created)
+	return created, err
+}
+
+func (c *client) updateNote(note models.Note) (models.Note, error) {
+	var updated models.Note
+	err := c.do(http.MethodPut, "/api/notes/"+url.PathEscape(note.ID), note, &updated)
+	return updated, err
+}
+
+// do sends body as JSON and decodes the response into out. Error
+// responses come back as the server's {"error": "..."} message.
+func (c *client) do(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(res.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s: %s", res.Status, apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"note/backend/models"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+)
+
+type cli struct {
+	client *client
+	json   bool
+	out    io.Writer
+}
+
+func (c *cli) list(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: notty list")
+	}
+	notes, err := c.client.listNotes()
+	if err != nil {
+		return err
+	}
+	return c.printNotes(notes)
+}
+
+func (c *cli) new(args []string) error {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	title := flags.String("t", "", "title")
+	content := flags.String("c", "", "content (default: read from stdin)")
+	notebook := flags.String("n", "", "notebook")
+	flags.Parse(args)
+	if *title == "" {
+		return errors.New("usage: notty new -t TITLE [-c TEXT] [-n NOTEBOOK]")
+	}
+	note := models.Note{Title: *title, Content: *content, Notebook: *notebook}
+	if !isFlagSet(flags, "c") {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		note.Content = string(data)
+	}
+	created, err := c.client.createNote(note)
+	if err != nil {
+		return err
+	}
+	return c.printNote(created)
+}
+
+// edit opens a note in $EDITOR as its title, a blank line and its
+// content, and saves it if anything changed
+func (c *cli) edit(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: notty edit ID")
+	}
+	note, err := c.client.getNote(args[0])
+	if err != nil {
+		return err
+	}
+	if note.ContentEncrypted {
+		return errors.New("note is end-to-end encrypted and can only be edited in the app")
+	}
+
+	file, err := os.CreateTemp("", "notty-*.md")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	original := note.Title + "\n\n" + note.Content
+	if _, err := file.WriteString(original); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	editor := envOr("EDITOR", "vi")
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", file.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", editor, err)
+	}
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return err
+	}
+	if string(data) == original {
+		fmt.Fprintln(os.Stderr, "no changes")
+		return nil
+	}
+
+	title, content, _ := strings.Cut(string(data), "\n")
+	note.Title = strings.TrimSpace(title)
+	note.Content = strings.TrimPrefix(content, "\n")
+	updated, err := c.client.updateNote(note)
+	if err != nil {
+		return err
+	}
+	return c.printNote(updated)
+}
+
+// search asks the server for notes with every word of the query. While
+// its search index is unavailable, the server matches the query as typed.
+func (c *cli) search(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: notty search QUERY")
+	}
+	result, err := c.client.search(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	if result.Degraded {
+		fmt.Fprintln(os.Stderr, "notty: search index unavailable, showing substring matches")
+	}
+	return c.printNotes(result.Results)
+}
+
+func (c *cli) printNotes(notes []models.Note) error {
+	if c.json {
+		return c.printJSON(notes)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	for _, note := range notes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", note.ID, note.UpdatedAt.Local().Format("2006-01-02 15:04"), note.Notebook, note.Title)
+	}
+	return w.Flush()
+}
+
+func (c *cli) printNote(note models.Note) error {
+	if c.json {
+		return c.printJSON(note)
+	}
+	_, err := fmt.Fprintln(c.out, note.ID)
+	return err
+}
+
+func (c *cli) printJSON(v any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := c.out.Write(buf.Bytes())
+	return err
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,68 @@
+// Command notty is a command line client for a Notty server.
+//
+//	notty [-server URL] [-token TOKEN] [-json] <command> [args]
+//
+// The server and token default to $NOTTY_SERVER and $NOTTY_TOKEN.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: notty [flags] <command> [args]
+
+commands:
+  list                      list all notes
+  new -t TITLE [-c TEXT] [-n NOTEBOOK]
+                            create a note; content is read from stdin without -c
+  edit ID                   edit a note in $EDITOR
+  search QUERY              list notes whose title or content contains QUERY
+
+flags:
+`
+
+func main() {
+	flags := flag.NewFlagSet("notty", flag.ExitOnError)
+	server := flags.String("server", envOr("NOTTY_SERVER", "http://localhost:8080"), "Notty server URL")
+	token := flags.String("token", os.Getenv("NOTTY_TOKEN"), "API token")
+	asJSON := flags.Bool("json", false, "print JSON instead of plain text")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cli := &cli{client: newClient(*server, *token), json: *asJSON, out: os.Stdout}
+	var err error
+	switch cmd, args := flags.Arg(0), flags.Args()[1:]; cmd {
+	case "list":
+		err = cli.list(args)
+	case "new":
+		err = cli.new(args)
+	case "edit":
+		err = cli.edit(args)
+	case "search":
+		err = cli.search(args)
+	default:
+		fmt.Fprintf(os.Stderr, "notty: unknown command %q\n", cmd)
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "notty:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,20 @@
+//go:build embedfrontend
+
+// Package frontend ships the built web app inside the server binary. Run
+// npm run build here first, then build the server with -tags
+// embedfrontend.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns the built app, and false if it wasn't embedded
+func Dist() (fs.FS, bool) {
+	sub, err := fs.Sub(dist, "dist")
+	return sub, err == nil
+}
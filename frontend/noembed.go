@@ -0,0 +1,13 @@
+//go:build !embedfrontend
+
+// Package frontend ships the built web app inside the server binary. Run
+// npm run build here first, then build the server with -tags
+// embedfrontend.
+package frontend
+
+import "io/fs"
+
+// Dist returns the built app, and false if it wasn't embedded
+func Dist() (fs.FS, bool) {
+	return nil, false
+}